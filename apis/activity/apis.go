@@ -0,0 +1,342 @@
+package activity
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// ListActivities
+//
+// @Summary List activities
+// @Description With upcoming, activities not ended yet are listed, the earliest first; otherwise all, the latest first.
+// @Tags Activity
+// @Produce application/json
+// @Router /activities [get]
+// @Param object query ListModel false "query"
+// @Success 200 {array} models.Activity
+func ListActivities(c *fiber.Ctx) error {
+	var query ListModel
+	err := common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	activities := Activities{}
+	querySet := RequestDB(c).Where("tenant_id = ?", GetTenant(c).ID).Offset(query.Offset).Limit(query.Size)
+	if query.Upcoming {
+		querySet = querySet.Where("end_time > ?", time.Now()).Order("start_time, id")
+	} else {
+		querySet = querySet.Order("start_time DESC, id DESC")
+	}
+	if query.DivisionID != nil {
+		querySet = querySet.Where("division_id IN ?", []int{0, *query.DivisionID})
+	}
+	err = querySet.Find(&activities).Error
+	if err != nil {
+		return err
+	}
+	err = activities.LoadReminded(user.ID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(activities)
+}
+
+// GetActivity
+//
+// @Summary Get an activity
+// @Tags Activity
+// @Produce application/json
+// @Router /activities/{id} [get]
+// @Param id path int true "id"
+// @Success 200 {object} models.Activity
+func GetActivity(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	var activity Activity
+	err = RequestDB(c).Where("tenant_id = ?", GetTenant(c).ID).Take(&activity, id).Error
+	if err != nil {
+		return err
+	}
+	err = Activities{&activity}.LoadReminded(user.ID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(&activity)
+}
+
+// checkActivity checks the time range of the activity, and that its division and hole are in the tenant
+func checkActivity(c *fiber.Ctx, tx *gorm.DB, activity *Activity) error {
+	if !activity.EndTime.After(activity.StartTime) {
+		return common.BadRequest("end_time should be after start_time")
+	}
+	tenantID := GetTenant(c).ID
+	if activity.DivisionID != 0 {
+		err := tx.Where("tenant_id = ?", tenantID).Take(&Division{}, activity.DivisionID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return common.NotFound("分区不存在")
+		} else if err != nil {
+			return err
+		}
+	}
+	if activity.HoleID != 0 {
+		err := tx.Where("tenant_id = ?", tenantID).Take(&Hole{}, activity.HoleID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return common.NotFound("帖子不存在")
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddActivity
+//
+// @Summary Add an activity, operator only
+// @Tags Activity
+// @Accept application/json
+// @Produce application/json
+// @Router /activities [post]
+// @Param json body CreateModel true "json"
+// @Success 201 {object} models.Activity
+func AddActivity(c *fiber.Ctx) error {
+	var body CreateModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	// validation is skipped for empty body
+	if body.Title == "" {
+		return common.BadRequest("title is required")
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	activity := Activity{
+		TenantID:   GetTenant(c).ID,
+		Title:      body.Title,
+		StartTime:  body.StartTime,
+		EndTime:    body.EndTime,
+		DivisionID: body.DivisionID,
+		HoleID:     body.HoleID,
+		CreatedBy:  user.ID,
+	}
+	err = checkActivity(c, RequestDB(c), &activity)
+	if err != nil {
+		return err
+	}
+	err = RequestDB(c).Create(&activity).Error
+	if err != nil {
+		return err
+	}
+	MyLog("Activity", "Create", activity.ID, user.ID, RoleAdmin)
+	return c.Status(201).JSON(&activity)
+}
+
+// ModifyActivity
+//
+// @Summary Modify an activity, operator only
+// @Description Users are reminded again if the start time is changed.
+// @Tags Activity
+// @Accept application/json
+// @Produce application/json
+// @Router /activities/{id} [put]
+// @Param id path int true "id"
+// @Param json body ModifyModel true "json"
+// @Success 200 {object} models.Activity
+func ModifyActivity(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	var body ModifyModel
+	err = common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	var activity Activity
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("tenant_id = ?", GetTenant(c).ID).Take(&activity, id).Error
+		if err != nil {
+			return err
+		}
+		if body.Title != nil {
+			activity.Title = *body.Title
+		}
+		if body.StartTime != nil && !body.StartTime.Equal(activity.StartTime) {
+			activity.StartTime = *body.StartTime
+			activity.RemindedAt = nil
+		}
+		if body.EndTime != nil {
+			activity.EndTime = *body.EndTime
+		}
+		if body.DivisionID != nil {
+			activity.DivisionID = *body.DivisionID
+		}
+		if body.HoleID != nil {
+			activity.HoleID = *body.HoleID
+		}
+		err = checkActivity(c, tx, &activity)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&activity).
+			Select("Title", "StartTime", "EndTime", "DivisionID", "HoleID", "RemindedAt").Updates(&activity).Error
+	})
+	if err != nil {
+		return err
+	}
+	MyLog("Activity", "Modify", activity.ID, user.ID, RoleAdmin)
+
+	err = Activities{&activity}.LoadReminded(user.ID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(&activity)
+}
+
+// DeleteActivity
+//
+// @Summary Delete an activity, operator only
+// @Tags Activity
+// @Router /activities/{id} [delete]
+// @Param id path int true "id"
+// @Success 204
+func DeleteActivity(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("tenant_id = ?", GetTenant(c).ID).Delete(&Activity{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("activity_id = ?", id).Delete(&ActivityReminder{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	MyLog("Activity", "Delete", id, user.ID, RoleAdmin)
+	return c.Status(204).JSON(nil)
+}
+
+// AddActivityReminder
+//
+// @Summary Remind the current user before the activity starts
+// @Description The reminder is sent by the notification pipeline ACTIVITY_REMIND_BEFORE the start.
+// @Tags Activity
+// @Produce application/json
+// @Router /activities/{id}/reminder [post]
+// @Param id path int true "id"
+// @Success 201 {object} models.Activity
+func AddActivityReminder(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	var activity Activity
+	err = RequestDB(c).Where("tenant_id = ?", GetTenant(c).ID).Take(&activity, id).Error
+	if err != nil {
+		return err
+	}
+	if !activity.StartTime.After(time.Now()) {
+		return common.BadRequest("活动已开始")
+	}
+	err = RequestDB(c).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&ActivityReminder{ActivityID: activity.ID, UserID: user.ID}).Error
+	if err != nil {
+		return err
+	}
+	activity.Reminded = true
+	return c.Status(201).JSON(&activity)
+}
+
+// DeleteActivityReminder
+//
+// @Summary Cancel the reminder of the activity for the current user
+// @Tags Activity
+// @Produce application/json
+// @Router /activities/{id}/reminder [delete]
+// @Param id path int true "id"
+// @Success 200 {object} models.Activity
+func DeleteActivityReminder(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	var activity Activity
+	err = RequestDB(c).Where("tenant_id = ?", GetTenant(c).ID).Take(&activity, id).Error
+	if err != nil {
+		return err
+	}
+	err = RequestDB(c).Where("activity_id = ? AND user_id = ?", activity.ID, user.ID).Delete(&ActivityReminder{}).Error
+	if err != nil {
+		return err
+	}
+	return c.JSON(&activity)
+}
+
+// SendActivityReminders notifies users of activities starting soon, see FlushActivityReminders
+func SendActivityReminders(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := FlushActivityReminders(time.Now())
+			if err != nil {
+				log.Err(err).Msg("error send activity reminders")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package activity
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"treehole_next/models"
+)
+
+func RegisterRoutes(app fiber.Router) {
+	app.Get("/activities", ListActivities)
+	app.Get("/activities/:id<int>", GetActivity)
+	app.Post("/activities", models.MiddlewarePermission(models.PermissionManageActivity), AddActivity)
+	app.Put("/activities/:id<int>", models.MiddlewarePermission(models.PermissionManageActivity), ModifyActivity)
+	app.Delete("/activities/:id<int>", models.MiddlewarePermission(models.PermissionManageActivity), DeleteActivity)
+	app.Post("/activities/:id<int>/reminder", AddActivityReminder)
+	app.Delete("/activities/:id<int>/reminder", DeleteActivityReminder)
+}
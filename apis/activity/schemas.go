@@ -0,0 +1,30 @@
+package activity
+
+import "time"
+
+type ListModel struct {
+	// activities not ended yet, the earliest first; otherwise all activities, the latest first
+	Upcoming bool `json:"upcoming" query:"upcoming"`
+	// activities of the division and of all divisions
+	DivisionID *int `json:"division_id" query:"division_id" validate:"omitempty,min=1"`
+	Offset     int  `json:"offset" query:"offset" default:"0" validate:"min=0"`
+	Size       int  `json:"size" query:"size" default:"30" validate:"min=1,max=100"`
+}
+
+type CreateModel struct {
+	Title     string    `json:"title" validate:"required,max=64"`
+	StartTime time.Time `json:"start_time" validate:"required"`
+	EndTime   time.Time `json:"end_time" validate:"required,gtfield=StartTime"`
+	// 0 for all divisions
+	DivisionID int `json:"division_id" validate:"min=0"`
+	// the hole discussing the activity, 0 if none
+	HoleID int `json:"hole_id" validate:"min=0"`
+}
+
+type ModifyModel struct {
+	Title      *string    `json:"title" validate:"omitempty,min=1,max=64"`
+	StartTime  *time.Time `json:"start_time"`
+	EndTime    *time.Time `json:"end_time"`
+	DivisionID *int       `json:"division_id" validate:"omitempty,min=0"`
+	HoleID     *int       `json:"hole_id" validate:"omitempty,min=0"`
+}
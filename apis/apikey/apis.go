@@ -0,0 +1,94 @@
+package apikey
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+
+	. "treehole_next/models"
+)
+
+// AddAPIKey
+//
+// @Summary Add An API Key
+// @Description Add a key for internal services and bots, sent as X-API-Key header instead of a user token. Admin only.
+// @Description The key is only responded here, only its hash is stored.
+// @Tags APIKey
+// @Accept application/json
+// @Produce application/json
+// @Router /api_keys [post]
+// @Param json body CreateModel true "json"
+// @Success 201 {object} CreateResponse
+func AddAPIKey(c *fiber.Ctx) error {
+	var body CreateModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	apiKey, key, err := NewAPIKey(RequestDB(c), body.Name, body.UserID, user.ID, body.Scopes)
+	if err != nil {
+		return err
+	}
+	CreateAdminLog(RequestDB(c), AdminLogTypeAPIKey, user.ID, Map{"action": "create", "api_key_id": apiKey.ID, "scopes": apiKey.Scopes})
+	return c.Status(201).JSON(CreateResponse{APIKey: *apiKey, Key: key})
+}
+
+// ListAPIKeys
+//
+// @Summary List API Keys
+// @Description Admin only.
+// @Tags APIKey
+// @Produce application/json
+// @Router /api_keys [get]
+// @Success 200 {array} models.APIKey
+func ListAPIKeys(c *fiber.Ctx) error {
+	apiKeys := make([]APIKey, 0)
+	err := RequestDB(c).Order("id").Find(&apiKeys).Error
+	if err != nil {
+		return err
+	}
+	return c.JSON(apiKeys)
+}
+
+// RevokeAPIKey
+//
+// @Summary Revoke An API Key
+// @Description Requests with the key are rejected immediately. Admin only.
+// @Tags APIKey
+// @Produce application/json
+// @Router /api_keys/{id} [delete]
+// @Param id path int true "id"
+// @Success 200 {object} models.APIKey
+// @Failure 404 {object} common.HttpError
+func RevokeAPIKey(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	var apiKey APIKey
+	err = RequestDB(c).Take(&apiKey, id).Error
+	if err != nil {
+		return err
+	}
+	if apiKey.RevokedAt == nil {
+		now := time.Now()
+		apiKey.RevokedAt = &now
+		err = RequestDB(c).Model(&apiKey).UpdateColumn("revoked_at", now).Error
+		if err != nil {
+			return err
+		}
+		CreateAdminLog(RequestDB(c), AdminLogTypeAPIKey, user.ID, Map{"action": "revoke", "api_key_id": apiKey.ID})
+	}
+	return c.JSON(&apiKey)
+}
@@ -0,0 +1,13 @@
+package apikey
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"treehole_next/models"
+)
+
+func RegisterRoutes(app fiber.Router) {
+	app.Post("/api_keys", models.MiddlewarePermission(models.PermissionManageAPIKey), AddAPIKey)
+	app.Get("/api_keys", models.MiddlewarePermission(models.PermissionManageAPIKey), ListAPIKeys)
+	app.Delete("/api_keys/:id<int>", models.MiddlewarePermission(models.PermissionManageAPIKey), RevokeAPIKey)
+}
@@ -0,0 +1,22 @@
+package apikey
+
+import (
+	. "treehole_next/models"
+)
+
+type CreateModel struct {
+	Name string `json:"name" validate:"required,max=64"`
+
+	// service account the requests act as, should not be a human account
+	UserID int `json:"user_id" validate:"required,min=1"`
+
+	// read, holes:write, floors:write, reports:write, bot:write or courses:write
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,oneof=read holes:write floors:write reports:write bot:write courses:write"`
+}
+
+type CreateResponse struct {
+	APIKey
+
+	// sent as X-API-Key header, only responded on creation
+	Key string `json:"key"`
+}
@@ -0,0 +1,150 @@
+package appeal
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// AddAppeal
+//
+// @Summary Appeal a deleted or punished floor of the current user
+// @Description The appeal is linked to the last report and the punishment of the floor. One pending appeal a floor.
+// @Tags Appeal
+// @Accept application/json
+// @Produce application/json
+// @Router /appeals [post]
+// @Param json body CreateModel true "json"
+// @Success 201 {object} models.Appeal
+func AddAppeal(c *fiber.Ctx) error {
+	var body CreateModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	appeal, err := CreateAppeal(user.ID, body.FloorID, body.Reason)
+	if err != nil {
+		return err
+	}
+	MyLog("Appeal", "Create", appeal.ID, user.ID, RoleOwner)
+	return c.Status(201).JSON(appeal)
+}
+
+// ListAppeals
+//
+// @Summary List appeals, moderator only
+// @Tags Appeal
+// @Produce application/json
+// @Router /appeals [get]
+// @Param object query ListModel false "query"
+// @Success 200 {array} models.Appeal
+func ListAppeals(c *fiber.Ctx) error {
+	var query ListModel
+	err := common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+
+	appeals := Appeals{}
+	querySet := RequestDB(c).Order("id DESC").Offset(query.Offset).Limit(query.Size)
+	if query.Status != "" {
+		querySet = querySet.Where("status = ?", query.Status)
+	}
+	err = querySet.Find(&appeals).Error
+	if err != nil {
+		return err
+	}
+	return c.JSON(appeals)
+}
+
+// ListMyAppeals
+//
+// @Summary List appeals of the current user
+// @Tags Appeal
+// @Produce application/json
+// @Router /users/me/appeals [get]
+// @Success 200 {array} models.Appeal
+func ListMyAppeals(c *fiber.Ctx) error {
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	appeals := Appeals{}
+	err = RequestDB(c).Where("user_id = ?", user.ID).Order("id DESC").Find(&appeals).Error
+	if err != nil {
+		return err
+	}
+	return c.JSON(appeals)
+}
+
+// GetAppeal
+//
+// @Summary Get an appeal, the appellant or moderator only
+// @Tags Appeal
+// @Produce application/json
+// @Router /appeals/{id} [get]
+// @Param id path int true "id"
+// @Success 200 {object} models.Appeal
+func GetAppeal(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	var appeal Appeal
+	err = RequestDB(c).Take(&appeal, id).Error
+	if err != nil {
+		return err
+	}
+	if appeal.UserID != user.ID && !user.Can(PermissionPunishUser, 0) {
+		return common.Forbidden()
+	}
+	return c.JSON(&appeal)
+}
+
+// HandleAppeal
+//
+// @Summary Approve or reject an appeal, moderator only
+// @Description Approved appeals restore the floor to the version before deleted and revoke the punishment on it.
+// @Description The appellant and the moderator who punished are notified.
+// @Tags Appeal
+// @Accept application/json
+// @Produce application/json
+// @Router /appeals/{id} [put]
+// @Param id path int true "id"
+// @Param json body HandleModel true "json"
+// @Success 200 {object} models.Appeal
+func HandleAppeal(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	var body HandleModel
+	err = common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	appeal := Appeal{ID: id}
+	err = appeal.Handle(user.ID, body.Status, body.Result)
+	if err != nil {
+		return err
+	}
+	MyLog("Appeal", "Handle", appeal.ID, user.ID, RoleAdmin, body.Status)
+	return c.JSON(&appeal)
+}
@@ -0,0 +1,15 @@
+package appeal
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"treehole_next/models"
+)
+
+func RegisterRoutes(app fiber.Router) {
+	app.Post("/appeals", AddAppeal)
+	app.Get("/appeals", models.MiddlewarePermission(models.PermissionPunishUser), ListAppeals)
+	app.Get("/appeals/:id<int>", GetAppeal)
+	app.Put("/appeals/:id<int>", models.MiddlewarePermission(models.PermissionPunishUser), HandleAppeal)
+	app.Get("/users/me/appeals", ListMyAppeals)
+}
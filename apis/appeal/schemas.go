@@ -0,0 +1,20 @@
+package appeal
+
+type CreateModel struct {
+	FloorID int    `json:"floor_id" validate:"required"`
+	Reason  string `json:"reason" validate:"required,max=256"`
+}
+
+type ListModel struct {
+	// pending, approved or rejected, all if empty
+	Status string `json:"status" query:"status" validate:"omitempty,oneof=pending approved rejected"`
+	Offset int    `json:"offset" query:"offset" default:"0" validate:"min=0"`
+	Size   int    `json:"size" query:"size" default:"30" validate:"min=1,max=100"`
+}
+
+type HandleModel struct {
+	// approved: restore the floor and revoke the punishment; rejected: keep them
+	Status string `json:"status" validate:"required,oneof=approved rejected"`
+	// sent to the appellant
+	Result string `json:"result" validate:"required,max=128"`
+}
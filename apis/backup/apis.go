@@ -0,0 +1,55 @@
+package backup
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+
+	. "treehole_next/models"
+)
+
+// CreateMarker
+//
+// @Summary Create a backup marker, admin only
+// @Description Background writers, e.g. the hole view flusher and search indexing, are quiesced briefly
+// @Description while the marker is written to the database and the cache with the binlog position, and a Redis snapshot is started.
+// @Description Back up MySQL up to the binlog position, and Redis with a snapshot later than redis_last_save.
+// @Tags Backup
+// @Accept application/json
+// @Produce application/json
+// @Router /backup/_marker [post]
+// @Param json body CreateModel true "json"
+// @Success 201 {object} models.BackupMarker
+func CreateMarker(c *fiber.Ctx) error {
+	var body CreateModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	marker, err := CreateBackupMarker(user.ID, body.Note)
+	if err != nil {
+		return err
+	}
+	CreateAdminLog(RequestDB(c), AdminLogTypeBackup, user.ID, Map{"marker_id": marker.ID, "note": body.Note})
+	return c.Status(201).JSON(marker)
+}
+
+// GetMarkerStatus
+//
+// @Summary Compare backup markers of the database and the cache, admin only
+// @Description After restoring, the database and the cache are consistent if they have the same latest marker.
+// @Tags Backup
+// @Produce application/json
+// @Router /backup/_marker [get]
+// @Success 200 {object} models.BackupStatus
+func GetMarkerStatus(c *fiber.Ctx) error {
+	status, err := GetBackupStatus()
+	if err != nil {
+		return err
+	}
+	return c.JSON(status)
+}
@@ -0,0 +1,12 @@
+package backup
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"treehole_next/models"
+)
+
+func RegisterRoutes(app fiber.Router) {
+	app.Get("/backup/_marker", models.MiddlewarePermission(models.PermissionManageBackup), GetMarkerStatus)
+	app.Post("/backup/_marker", models.MiddlewarePermission(models.PermissionManageBackup), CreateMarker)
+}
@@ -0,0 +1,6 @@
+package backup
+
+type CreateModel struct {
+	// e.g. name of the backup job
+	Note string `json:"note" validate:"max=255"`
+}
@@ -0,0 +1,93 @@
+package batch
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/goccy/go-json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/valyala/fasthttp"
+
+	"treehole_next/config"
+)
+
+// Batch
+//
+// @Summary Batch GET Requests
+// @Description Execute several GET requests concurrently in one round trip, e.g. divisions, messages and favorites on app start.
+// @Description Each response keeps its own status code, in the same order as requests.
+// @Tags Batch
+// @Accept application/json
+// @Produce application/json
+// @Router /batch [post]
+// @Param json body BatchModel true "json"
+// @Success 200 {array} ResponseModel
+func Batch(c *fiber.Ctx) error {
+	var body BatchModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	if len(body.Requests) > config.Config.BatchSize {
+		return common.BadRequest(fmt.Sprintf("一次最多请求 %d 个接口", config.Config.BatchSize))
+	}
+	for _, request := range body.Requests {
+		if strings.HasPrefix(request.Path, "/api/batch") {
+			return common.BadRequest("不允许嵌套批量请求")
+		}
+	}
+
+	handler := c.App().Handler()
+	responses := make([]ResponseModel, len(body.Requests))
+
+	var wg sync.WaitGroup
+	for i := range body.Requests {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = do(c, handler, &body.Requests[i])
+		}(i)
+	}
+	wg.Wait()
+
+	return c.JSON(responses)
+}
+
+// do performs a GET request with the headers of the batch request, e.g. Authorization
+func do(c *fiber.Ctx, handler fasthttp.RequestHandler, request *RequestModel) ResponseModel {
+	var req fasthttp.Request
+	c.Request().Header.CopyTo(&req.Header)
+	req.Header.SetMethod(fiber.MethodGet)
+	req.Header.SetContentLength(0)
+	req.Header.Del(fiber.HeaderContentType)
+
+	uri := request.Path
+	if request.Query != "" {
+		if strings.Contains(uri, "?") {
+			uri += "&" + request.Query
+		} else {
+			uri += "?" + request.Query
+		}
+	}
+	req.SetRequestURI(uri)
+
+	var ctx fasthttp.RequestCtx
+	ctx.Init(&req, c.Context().RemoteAddr(), nil)
+	handler(&ctx)
+
+	responseBody := ctx.Response.Body()
+	if len(responseBody) == 0 {
+		responseBody = []byte("null")
+	} else if !json.Valid(responseBody) {
+		// wrap non-json body as json string
+		responseBody, _ = json.Marshal(string(responseBody))
+	}
+
+	return ResponseModel{
+		Status: ctx.Response.StatusCode(),
+		Body:   append(json.RawMessage(nil), responseBody...),
+	}
+}
@@ -0,0 +1,7 @@
+package batch
+
+import "github.com/gofiber/fiber/v2"
+
+func RegisterRoutes(app fiber.Router) {
+	app.Post("/batch", Batch)
+}
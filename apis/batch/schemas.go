@@ -0,0 +1,19 @@
+package batch
+
+import "github.com/goccy/go-json"
+
+type RequestModel struct {
+	// path of a GET api, e.g. /api/divisions
+	Path string `json:"path" validate:"required,startswith=/api/"`
+	// raw query string, e.g. not_read=true
+	Query string `json:"query"`
+}
+
+type BatchModel struct {
+	Requests []RequestModel `json:"requests" validate:"required,min=1,dive"`
+}
+
+type ResponseModel struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body" swaggertype:"object"`
+}
@@ -0,0 +1,195 @@
+package bot
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// ListBotRules
+//
+// @Summary List Bot Rules
+// @Description Operator only.
+// @Tags Bot
+// @Produce application/json
+// @Router /bot_rules [get]
+// @Success 200 {array} models.BotRule
+func ListBotRules(c *fiber.Ctx) error {
+	rules, err := LoadBotRules()
+	if err != nil {
+		return err
+	}
+	return c.JSON(rules)
+}
+
+// AddBotRule
+//
+// @Summary Add A Bot Rule
+// @Description Bot services receive bot.matched webhook events of new holes with any of the keywords. Operator only.
+// @Tags Bot
+// @Accept application/json
+// @Produce application/json
+// @Router /bot_rules [post]
+// @Param json body CreateRuleModel true "json"
+// @Success 201 {object} models.BotRule
+func AddBotRule(c *fiber.Ctx) error {
+	var body CreateRuleModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	if body.DivisionID != 0 {
+		err = RequestDB(c).Where("tenant_id = ?", GetTenant(c).ID).Take(&Division{}, body.DivisionID).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	rule := BotRule{
+		Name:       body.Name,
+		Keywords:   body.Keywords,
+		DivisionID: body.DivisionID,
+		Enabled:    true,
+		CreatedBy:  user.ID,
+	}
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&rule).Error
+		if err != nil {
+			return err
+		}
+		CreateAdminLog(tx, AdminLogTypeBotRule, user.ID, &rule)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = DeleteBotRulesCache()
+	if err != nil {
+		return err
+	}
+	return c.Status(201).JSON(&rule)
+}
+
+// DeleteBotRule
+//
+// @Summary Delete A Bot Rule
+// @Description Operator only.
+// @Tags Bot
+// @Router /bot_rules/{id} [delete]
+// @Param id path int true "id"
+// @Success 204
+// @Failure 404 {object} common.HttpError
+func DeleteBotRule(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	var rule BotRule
+	err = RequestDB(c).Take(&rule, id).Error
+	if err != nil {
+		return err
+	}
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Delete(&rule).Error
+		if err != nil {
+			return err
+		}
+		CreateAdminLog(tx, AdminLogTypeBotRule, user.ID, Map{
+			"id":     rule.ID,
+			"name":   rule.Name,
+			"action": "delete",
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = DeleteBotRulesCache()
+	if err != nil {
+		return err
+	}
+	return c.SendStatus(204)
+}
+
+// ReplyHole
+//
+// @Summary Reply A Hole As A Bot
+// @Description Post a floor of type bot named after the API key, e.g. answers of FAQ. Only API keys of scope bot:write,
+// @Description in divisions with bots enabled and within the hourly rate limit of the division.
+// @Tags Bot
+// @Accept application/json
+// @Produce application/json
+// @Router /bot/holes/{id}/floors [post]
+// @Param id path int true "hole id"
+// @Param json body CreateFloorModel true "json"
+// @Success 201 {object} models.Floor
+// @Failure 403 {object} common.HttpError
+// @Failure 429 {object} common.HttpError
+func ReplyHole(c *fiber.Ctx) error {
+	apiKey := GetAPIKey(c)
+	if apiKey == nil || !apiKey.HasScope(ScopeBotWrite) {
+		return NewError(ErrCodeAPIKeyScope, "API key 无权访问该接口")
+	}
+	var body CreateFloorModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	holeID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	var hole Hole
+	var floor *Floor
+	err = RequestDB(c).Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("tenant_id = ?", GetTenant(c).ID).Take(&hole, holeID).Error
+		if err != nil {
+			return err
+		}
+		if hole.Hidden {
+			return gorm.ErrRecordNotFound
+		}
+		if hole.Locked {
+			return NewError(ErrCodeHoleLocked, "该帖子已被锁定，非管理员禁止发帖")
+		}
+		floor, err = CreateBotFloor(tx, &hole, apiKey.Name, body.Content)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = floor.SendReply(RequestDB(c)).Send()
+	if err != nil {
+		log.Err(err).Str("model", "Notification").Msg("SendReply failed")
+	}
+	floorModel := FloorModel{ID: floor.ID, UpdatedAt: time.Now(), Content: floor.Content}
+	Go(func() { FloorIndex(floorModel) })
+	err = DeleteCache(hole.CacheName())
+	if err != nil {
+		return err
+	}
+
+	err = floor.SetDefaults(c)
+	if err != nil {
+		return err
+	}
+	return c.Status(201).JSON(floor)
+}
@@ -0,0 +1,14 @@
+package bot
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"treehole_next/models"
+)
+
+func RegisterRoutes(app fiber.Router) {
+	app.Get("/bot_rules", models.MiddlewarePermission(models.PermissionManageBot), ListBotRules)
+	app.Post("/bot_rules", models.MiddlewarePermission(models.PermissionManageBot), AddBotRule)
+	app.Delete("/bot_rules/:id<int>", models.MiddlewarePermission(models.PermissionManageBot), DeleteBotRule)
+	app.Post("/bot/holes/:id<int>/floors", models.MiddlewareAPIKeyScope(models.ScopeBotWrite), ReplyHole)
+}
@@ -0,0 +1,13 @@
+package bot
+
+type CreateRuleModel struct {
+	Name string `json:"name" validate:"required,max=32"`
+	// new holes with any of the keywords in the first floor are matched, case-insensitively
+	Keywords []string `json:"keywords" validate:"required,min=1,max=20,dive,min=1,max=32"`
+	// 0 for all divisions
+	DivisionID int `json:"division_id" validate:"min=0"`
+}
+
+type CreateFloorModel struct {
+	Content string `json:"content" validate:"required,max=2000"`
+}
@@ -0,0 +1,156 @@
+package course
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// ListCourseLinks
+//
+// @Summary List courses linked to tags
+// @Tags Course
+// @Produce application/json
+// @Router /courses [get]
+// @Param object query ListModel false "query"
+// @Success 200 {array} models.CourseLink
+func ListCourseLinks(c *fiber.Ctx) error {
+	var query ListModel
+	err := common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+
+	links := make([]CourseLink, 0)
+	querySet := RequestDB(c).Where("tenant_id = ?", GetTenant(c).ID).Order("course_code")
+	if query.Tag != "" {
+		querySet = querySet.Where("tag_name = ?", query.Tag)
+	}
+	err = querySet.Find(&links).Error
+	if err != nil {
+		return err
+	}
+	return c.JSON(links)
+}
+
+// ListHolesByCourse
+//
+// @Summary List holes discussing a course
+// @Description Holes with the tag linked to the course, empty if the tag doesn't exist yet.
+// @Tags Course
+// @Produce application/json
+// @Router /courses/{code}/holes [get]
+// @Param code path string true "course code"
+// @Param object query ListHolesModel false "query"
+// @Success 200 {array} models.Hole
+func ListHolesByCourse(c *fiber.Ctx) error {
+	var query ListHolesModel
+	err := common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+
+	var link CourseLink
+	err = RequestDB(c).Where("tenant_id = ? AND course_code = ?", GetTenant(c).ID, c.Params("code")).Take(&link).Error
+	if err != nil {
+		return err
+	}
+
+	holes := Holes{}
+	if link.TagID == 0 {
+		return Serialize(c, &holes, SerializeOptions{Fields: query.Fields})
+	}
+	querySet, err := holes.MakeQuerySet(query.Offset, query.Size, "", c)
+	if err != nil {
+		return err
+	}
+	err = querySet.Model(&Tag{ID: link.TagID}).Association("Holes").Find(&holes)
+	if err != nil {
+		return err
+	}
+	return Serialize(c, &holes, SerializeOptions{Fields: query.Fields})
+}
+
+// PutCourseLink
+//
+// @Summary Link a course to a tag, the curriculum-review service only
+// @Description Creates or replaces the link of the course code. Only API keys of scope courses:write.
+// @Tags Course
+// @Accept application/json
+// @Produce application/json
+// @Router /courses/{code} [put]
+// @Param code path string true "course code"
+// @Param json body PutModel true "json"
+// @Success 200 {object} models.CourseLink
+func PutCourseLink(c *fiber.Ctx) error {
+	apiKey := GetAPIKey(c)
+	if apiKey == nil || !apiKey.HasScope(ScopeCoursesWrite) {
+		return NewError(ErrCodeAPIKeyScope, "API key 无权访问该接口")
+	}
+	var body PutModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	code := c.Params("code")
+	if len(code) > 32 {
+		return common.BadRequest("course code too long")
+	}
+
+	link := CourseLink{
+		TenantID:   GetTenant(c).ID,
+		CourseCode: code,
+		Name:       body.Name,
+		URL:        body.URL,
+		TagName:    body.Tag,
+	}
+	err = UpsertCourseLink(RequestDB(c), &link)
+	if err != nil {
+		return err
+	}
+	MyLog("CourseLink", "Put", link.ID, apiKey.UserID, RoleOperator, "Tag: ", link.TagName)
+	return c.JSON(&link)
+}
+
+// DeleteCourseLink
+//
+// @Summary Unlink a course, the curriculum-review service only
+// @Tags Course
+// @Router /courses/{code} [delete]
+// @Param code path string true "course code"
+// @Success 204
+func DeleteCourseLink(c *fiber.Ctx) error {
+	apiKey := GetAPIKey(c)
+	if apiKey == nil || !apiKey.HasScope(ScopeCoursesWrite) {
+		return NewError(ErrCodeAPIKeyScope, "API key 无权访问该接口")
+	}
+	err := RequestDB(c).Where("tenant_id = ? AND course_code = ?", GetTenant(c).ID, c.Params("code")).
+		Delete(&CourseLink{}).Error
+	if err != nil {
+		return err
+	}
+	return c.SendStatus(204)
+}
+
+// UpdateCourseLinks keeps links following tags, see SyncCourseLinks
+func UpdateCourseLinks(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := SyncCourseLinks(DB)
+			if err != nil {
+				log.Err(err).Msg("error sync course links")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package course
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"treehole_next/models"
+)
+
+func RegisterRoutes(app fiber.Router) {
+	app.Get("/courses", ListCourseLinks)
+	app.Get("/courses/:code/holes", ListHolesByCourse)
+	app.Put("/courses/:code", models.MiddlewareAPIKeyScope(models.ScopeCoursesWrite), PutCourseLink)
+	app.Delete("/courses/:code", models.MiddlewareAPIKeyScope(models.ScopeCoursesWrite), DeleteCourseLink)
+}
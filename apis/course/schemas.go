@@ -0,0 +1,34 @@
+package course
+
+import (
+	"time"
+
+	"github.com/opentreehole/go-common"
+)
+
+type ListModel struct {
+	// links of the tag, all links if empty
+	Tag string `json:"tag" query:"tag"`
+}
+
+type ListHolesModel struct {
+	Size int `json:"size" query:"size" default:"10" validate:"max=10"`
+	// updated time < offset (default is now)
+	Offset common.CustomTime `json:"offset" query:"offset" swaggertype:"string"`
+	// comma separated fields to return, e.g. "id,tags,reply,floors.first_floor.content"; empty means all
+	Fields string `json:"fields" query:"fields"`
+}
+
+func (q *ListHolesModel) SetDefaults() {
+	if q.Offset.IsZero() {
+		q.Offset = common.CustomTime{Time: time.Now()}
+	}
+}
+
+type PutModel struct {
+	Name string `json:"name" validate:"required,max=64"`
+	// page of the course reviews
+	URL string `json:"url" validate:"required,url,max=255"`
+	// the tag discussing the course
+	Tag string `json:"tag" validate:"required,max=32"`
+}
@@ -1,6 +1,7 @@
 package division
 
 import (
+	"fmt"
 	"strconv"
 
 	"github.com/goccy/go-json"
@@ -33,27 +34,44 @@ func AddDivision(c *fiber.Ctx) error {
 		return err
 	}
 
-	// get user
-	user, err := GetCurrLoginUser(c)
-	if err != nil {
-		return err
-	}
-
-	// permission check
-	if !user.IsAdmin {
-		return common.Forbidden()
+	if body.Visibility == DivisionVisibilityRestricted && body.Group == "" {
+		return common.BadRequest("受限分区需要指定用户组")
 	}
 
 	// bind division
+	tenantID := GetTenant(c).ID
 	division := Division{
-		Name:        body.Name,
-		Description: body.Description,
+		TenantID:     tenantID,
+		Name:         body.Name,
+		Description:  body.Description,
+		RealName:     body.RealName,
+		Visibility:   body.Visibility,
+		Group:        body.Group,
+		MinTags:      body.MinTags,
+		MaxTags:      body.MaxTags,
+		RequiredTags: body.RequiredTags,
+		TagReview:    body.TagReview,
 	}
-	result := DB.FirstOrCreate(&division, Division{Name: body.Name})
+	if division.RequiredTags == nil {
+		division.RequiredTags = []string{}
+	}
+	result := RequestDB(c).FirstOrCreate(&division, map[string]any{"tenant_id": tenantID, "name": body.Name})
 	if result.RowsAffected == 0 {
 		c.Status(200)
 	} else {
 		c.Status(201)
+		if division.Visibility != DivisionVisibilityPublic {
+			err = DeleteDivisionAccessCache()
+			if err != nil {
+				return err
+			}
+		}
+		if division.RealName {
+			err = DeleteRealNameDivisionsCache()
+			if err != nil {
+				return err
+			}
+		}
 	}
 	return Serialize(c, &division)
 }
@@ -67,13 +85,21 @@ func AddDivision(c *fiber.Ctx) error {
 // @Success 200 {array} models.Division
 func ListDivisions(c *fiber.Ctx) error {
 	var divisions Divisions
-	if GetCache("divisions", &divisions) {
+	tenantID := GetTenant(c).ID
+	if GetLocalCache(DivisionsCacheKey(tenantID), &divisions) {
+		// pinned holes are listed too
+		if CheckETag(c, 0, len(divisions), divisions.LastModified(), ETagDivisions, ETagHoles) {
+			return c.SendStatus(fiber.StatusNotModified)
+		}
 		return c.JSON(divisions)
 	}
-	err := DB.Find(&divisions, "hidden = false").Error
+	err := RequestDB(c).Find(&divisions, "hidden = false AND tenant_id = ?", tenantID).Error
 	if err != nil {
 		return err
 	}
+	if CheckETag(c, 0, len(divisions), divisions.LastModified(), ETagDivisions, ETagHoles) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
 	return Serialize(c, divisions)
 }
 
@@ -91,8 +117,9 @@ func GetDivision(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	// hidden divisions are not listed, but old links to them still work
 	var division Division
-	result := DB.Where("hidden = false").First(&division, id)
+	result := RequestDB(c).Where("tenant_id = ?", GetTenant(c).ID).First(&division, id)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -129,14 +156,10 @@ func ModifyDivision(c *fiber.Ctx) error {
 		return err
 	}
 
-	// permission check
-	if !user.IsAdmin {
-		return common.Forbidden()
-	}
-
 	var division Division
-	err = DB.Transaction(func(tx *gorm.DB) error {
-		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&division, id).Error
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("tenant_id = ?", GetTenant(c).ID).First(&division, id).Error
 		if err != nil {
 			return err
 		}
@@ -152,11 +175,70 @@ func ModifyDivision(c *fiber.Ctx) error {
 			data, _ := json.Marshal(body.Pinned)
 			modifyData["pinned"] = string(data)
 		}
+		if body.RealName != nil {
+			modifyData["real_name"] = *body.RealName
+		}
+		if body.Visibility != nil {
+			modifyData["visibility"] = *body.Visibility
+		}
+		if body.Group != nil {
+			modifyData["access_group"] = *body.Group
+		}
+		if body.MinTags != nil {
+			modifyData["min_tags"] = *body.MinTags
+		}
+		if body.MaxTags != nil {
+			modifyData["max_tags"] = *body.MaxTags
+		}
+		if body.RequiredTags != nil {
+			data, _ := json.Marshal(body.RequiredTags)
+			modifyData["required_tags"] = string(data)
+		}
+		if body.TagReview != nil {
+			modifyData["tag_review"] = *body.TagReview
+		}
+		if body.BotEnabled != nil {
+			modifyData["bot_enabled"] = *body.BotEnabled
+		}
+		if body.BotRateLimit != nil {
+			modifyData["bot_rate_limit"] = *body.BotRateLimit
+		}
+		if body.MutedByDefault != nil {
+			modifyData["muted_by_default"] = *body.MutedByDefault
+		}
+		if body.EditWindow != nil {
+			modifyData["edit_window"] = *body.EditWindow
+		}
+		if body.MaxEdits != nil {
+			modifyData["max_edits"] = *body.MaxEdits
+		}
 
 		if len(modifyData) == 0 {
 			return common.BadRequest("No data to modify.")
 		}
 
+		visibility, group := division.Visibility, division.Group
+		if body.Visibility != nil {
+			visibility = *body.Visibility
+		}
+		if body.Group != nil {
+			group = *body.Group
+		}
+		if visibility == DivisionVisibilityRestricted && group == "" {
+			return common.BadRequest("受限分区需要指定用户组")
+		}
+
+		minTags, maxTags := division.MinTags, division.MaxTags
+		if body.MinTags != nil {
+			minTags = *body.MinTags
+		}
+		if body.MaxTags != nil {
+			maxTags = *body.MaxTags
+		}
+		if minTags > maxTags {
+			return common.BadRequest("最少标签数不能大于最多标签数")
+		}
+
 		return tx.Model(&division).Updates(modifyData).Error
 	})
 	if err != nil {
@@ -164,14 +246,14 @@ func ModifyDivision(c *fiber.Ctx) error {
 	}
 
 	var newDivision Division
-	err = DB.First(&newDivision, id).Error
+	err = RequestDB(c).First(&newDivision, id).Error
 	if err != nil {
 		return err
 	}
 
 	MyLog("Division", "Modify", division.ID, user.ID, RoleAdmin)
 
-	CreateAdminLog(DB, AdminLogTypeDivision, user.ID, map[string]any{
+	CreateAdminLog(RequestDB(c), AdminLogTypeDivision, user.ID, map[string]any{
 		"division_id": division.ID,
 		"before":      division,
 		"after":       newDivision,
@@ -186,6 +268,72 @@ func ModifyDivision(c *fiber.Ctx) error {
 	return Serialize(c, &newDivision)
 }
 
+// ModifyDivisionStatus
+//
+// @Summary Archive, hide or reactivate a division
+// @Description Archived divisions can be read but no holes or floors can be created, hidden divisions are archived and not listed.
+// @Description The status changes step by step: active <-> archived <-> hidden
+// @Tags Division
+// @Produce json
+// @Router /divisions/{id}/status [put]
+// @Param id path int true "id"
+// @Param json body StatusModel true "json"
+// @Success 200 {object} models.Division
+// @Failure 400 {object} MessageModel
+// @Failure 404 {object} MessageModel
+func ModifyDivisionStatus(c *fiber.Ctx) error {
+	var body StatusModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	var division Division
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("tenant_id = ?", GetTenant(c).ID).First(&division, id).Error
+		if err != nil {
+			return err
+		}
+		if !division.CanTransitTo(body.Status) {
+			return NewError(ErrCodeInvalidStatusTransition, fmt.Sprintf("分区状态无法从 %s 变为 %s", division.Status, body.Status))
+		}
+
+		err = tx.Model(&division).Updates(map[string]any{
+			"status": body.Status,
+			"hidden": body.Status == DivisionStatusHidden,
+		}).Error
+		if err != nil {
+			return err
+		}
+		CreateAdminLog(tx, AdminLogTypeDivision, user.ID, map[string]any{
+			"division_id": division.ID,
+			"status":      body.Status,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	MyLog("Division", "Modify", division.ID, user.ID, RoleAdmin, "status: ", body.Status)
+
+	err = refreshCache(c)
+	if err != nil {
+		return err
+	}
+
+	return Serialize(c, &division)
+}
+
 // DeleteDivision
 //
 // @Summary Delete A Division
@@ -214,18 +362,23 @@ func DeleteDivision(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
-	if !user.IsAdmin {
-		return common.Forbidden()
-	}
-
 	if id == body.To {
 		return common.BadRequest("The deleted division can't be the same as to.")
 	}
-	err = DB.Exec("UPDATE hole SET division_id = ? WHERE division_id = ?", body.To, id).Error
+	// divisions of other tenants are not found
+	var count int64
+	err = RequestDB(c).Model(&Division{}).Where("id IN ? AND tenant_id <> ?", []int{id, body.To}, GetTenant(c).ID).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return common.NotFound("分区不存在")
+	}
+	err = RequestDB(c).Exec("UPDATE hole SET division_id = ? WHERE division_id = ?", body.To, id).Error
 	if err != nil {
 		return err
 	}
-	err = DB.Delete(&Division{ID: id}).Error
+	err = RequestDB(c).Delete(&Division{ID: id}).Error
 	if err != nil {
 		return err
 	}
@@ -243,3 +396,76 @@ func DeleteDivision(c *fiber.Ctx) error {
 
 	return c.Status(204).JSON(nil)
 }
+
+// ListModerators
+//
+// @Summary List moderators of a division
+// @Tags Division
+// @Produce json
+// @Router /divisions/{id}/moderators [get]
+// @Param id path int true "id"
+// @Success 200 {array} models.DivisionModerator
+func ListModerators(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	err = RequestDB(c).Where("tenant_id = ?", GetTenant(c).ID).Take(&Division{}, id).Error
+	if err != nil {
+		return err
+	}
+	moderators := make([]DivisionModerator, 0)
+	err = RequestDB(c).Where("division_id = ?", id).Order("user_id").Find(&moderators).Error
+	if err != nil {
+		return err
+	}
+	return c.JSON(moderators)
+}
+
+// ModifyModerators
+//
+// @Summary Replace moderators of a division, admin only
+// @Tags Division
+// @Produce json
+// @Router /divisions/{id}/moderators [put]
+// @Param id path int true "id"
+// @Param json body ModeratorsModel true "json"
+// @Success 200 {array} models.DivisionModerator
+func ModifyModerators(c *fiber.Ctx) error {
+	var body ModeratorsModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	var moderators []DivisionModerator
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
+		err = tx.Where("tenant_id = ?", GetTenant(c).ID).Take(&Division{}, id).Error
+		if err != nil {
+			return err
+		}
+		moderators, err = SetDivisionModerators(tx, id, body.Moderators)
+		if err != nil {
+			return err
+		}
+		CreateAdminLog(tx, AdminLogTypeDivision, user.ID, map[string]any{
+			"division_id": id,
+			"moderators":  body.Moderators,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	MyLog("Division", "Modify", id, user.ID, RoleAdmin, "moderators")
+	return c.JSON(moderators)
+}
@@ -1,12 +1,19 @@
 package division
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"treehole_next/models"
+)
 
 func RegisterRoutes(app fiber.Router) {
-	app.Post("/divisions", AddDivision)
+	app.Post("/divisions", models.MiddlewarePermission(models.PermissionManageDivision), AddDivision)
 	app.Get("/divisions", ListDivisions)
 	app.Get("/divisions/:id", GetDivision)
-	app.Put("/divisions/:id", ModifyDivision)
-	app.Patch("/divisions/:id/_webvpn", ModifyDivision)
-	app.Delete("/divisions/:id", DeleteDivision)
+	app.Put("/divisions/:id", models.MiddlewarePermission(models.PermissionManageDivision), ModifyDivision)
+	app.Patch("/divisions/:id/_webvpn", models.MiddlewarePermission(models.PermissionManageDivision), ModifyDivision)
+	app.Put("/divisions/:id<int>/status", models.MiddlewarePermission(models.PermissionManageDivision), ModifyDivisionStatus)
+	app.Delete("/divisions/:id", models.MiddlewarePermission(models.PermissionManageDivision), DeleteDivision)
+	app.Get("/divisions/:id<int>/moderators", ListModerators)
+	app.Put("/divisions/:id<int>/moderators", models.MiddlewarePermission(models.PermissionManageModerators), ModifyModerators)
 }
@@ -9,10 +9,50 @@ type DeleteModel struct {
 type CreateModel struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	// floors show verified nickname instead of anonyname
+	RealName bool `json:"real_name"`
+	// public, login or restricted
+	Visibility string `json:"visibility" default:"public" validate:"oneof=public login restricted"`
+	// members of the group can see a restricted division
+	Group string `json:"group" validate:"max=64"`
+	// number of tags of a new hole
+	MinTags int `json:"min_tags" default:"1" validate:"min=0,max=10"`
+	MaxTags int `json:"max_tags" default:"10" validate:"min=1,max=10,gtefield=MinTags"`
+	// tags a new hole must have
+	RequiredTags []string `json:"required_tags" validate:"max=10,dive,min=1,max=32"`
+	// new tags are pending until approved by moderators
+	TagReview bool `json:"tag_review"`
 }
 
 type ModifyDivisionModel struct {
-	Name        *string `json:"name"`
-	Description *string `json:"description"`
-	Pinned      []int   `json:"pinned"`
+	Name         *string  `json:"name"`
+	Description  *string  `json:"description"`
+	Pinned       []int    `json:"pinned"`
+	RealName     *bool    `json:"real_name"`
+	Visibility   *string  `json:"visibility" validate:"omitempty,oneof=public login restricted"`
+	Group        *string  `json:"group" validate:"omitempty,max=64"`
+	MinTags      *int     `json:"min_tags" validate:"omitempty,min=0,max=10"`
+	MaxTags      *int     `json:"max_tags" validate:"omitempty,min=1,max=10"`
+	RequiredTags []string `json:"required_tags" validate:"omitempty,max=10,dive,min=1,max=32"`
+	TagReview    *bool    `json:"tag_review"`
+	// bots are notified of new holes matching bot rules and may reply
+	BotEnabled *bool `json:"bot_enabled"`
+	// max bot floors an hour, 0 for unlimited
+	BotRateLimit *int `json:"bot_rate_limit" validate:"omitempty,min=0"`
+	// holes are not recommended or notified in digests unless users unmute the division
+	MutedByDefault *bool `json:"muted_by_default"`
+	// authors can edit content of floors within the minutes after posting, 0 for unlimited
+	EditWindow *int `json:"edit_window" validate:"omitempty,min=0"`
+	// times authors can edit content of a floor, 0 for unlimited
+	MaxEdits *int `json:"max_edits" validate:"omitempty,min=0"`
+}
+
+type StatusModel struct {
+	// active, archived or hidden, changes one step at a time
+	Status string `json:"status" validate:"required,oneof=active archived hidden"`
+}
+
+type ModeratorsModel struct {
+	// replaces all moderators of the division
+	Moderators []int `json:"moderators" validate:"required,dive,min=1"`
 }
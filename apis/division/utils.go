@@ -8,9 +8,21 @@ import (
 )
 
 func refreshCache(c *fiber.Ctx) error {
+	err := DeleteRealNameDivisionsCache()
+	if err != nil {
+		return err
+	}
+	err = DeleteArchivedDivisionsCache()
+	if err != nil {
+		return err
+	}
+	err = DeleteDivisionAccessCache()
+	if err != nil {
+		return err
+	}
 
 	var divisions Divisions
-	err := DB.Find(&divisions).Error
+	err = RequestDB(c).Where("hidden = false AND tenant_id = ?", GetTenant(c).ID).Find(&divisions).Error
 	if err != nil {
 		return err
 	}
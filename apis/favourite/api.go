@@ -30,8 +30,8 @@ func ListFavorites(c *fiber.Ctx) error {
 		return err
 	}
 	if query.FavoriteGroupID != nil {
-		if !IsFavoriteGroupExist(DB, userID, *query.FavoriteGroupID) {
-			return common.NotFound("收藏夹不存在")
+		if !IsFavoriteGroupExist(RequestDB(c), userID, *query.FavoriteGroupID) {
+			return utils.NewError(utils.ErrCodeFavoriteGroupNotFound, "收藏夹不存在")
 		}
 	}
 
@@ -39,9 +39,9 @@ func ListFavorites(c *fiber.Ctx) error {
 		// get favorite ids
 		var data []int
 		if query.FavoriteGroupID == nil {
-			data, err = UserGetFavoriteData(DB, userID)
+			data, err = UserGetFavoriteData(RequestDB(c), userID)
 		} else {
-			data, err = UserGetFavoriteDataByFavoriteGroup(DB, userID, *query.FavoriteGroupID)
+			data, err = UserGetFavoriteDataByFavoriteGroup(RequestDB(c), userID, *query.FavoriteGroupID)
 		}
 		if err != nil {
 			return err
@@ -62,15 +62,25 @@ func ListFavorites(c *fiber.Ctx) error {
 		// get favorites
 		holes := make(Holes, 0)
 		if query.FavoriteGroupID == nil {
-			err = DB.
+			err = RequestDB(c).
 				Joins("JOIN user_favorites ON user_favorites.hole_id = hole.id AND user_favorites.user_id = ?", userID).
 				Order(order).Find(&holes).Error
 		} else {
-			err = DB.
+			err = RequestDB(c).
 				Joins("JOIN user_favorites ON user_favorites.hole_id = hole.id AND user_favorites.user_id = ? AND user_favorites.favorite_group_id = ?", userID, *query.FavoriteGroupID).
 				Order(order).Find(&holes).Error
 		}
 
+		if err != nil {
+			return err
+		}
+
+		// favorites in divisions no longer visible are kept but not shown
+		user, err := GetCurrLoginUser(c)
+		if err != nil {
+			return err
+		}
+		holes, err = holes.RemoveInvisible(user)
 		if err != nil {
 			return err
 		}
@@ -86,6 +96,7 @@ func ListFavorites(c *fiber.Ctx) error {
 // @Produce application/json
 // @Router /user/favorites [post]
 // @Param json body AddModel true "json"
+// @Param Idempotency-Key header string false "dedupe retried requests"
 // @Success 201 {object} Response
 // @Success 200 {object} Response
 func AddFavorite(c *fiber.Ctx) error {
@@ -104,7 +115,7 @@ func AddFavorite(c *fiber.Ctx) error {
 
 	var data []int
 
-	err = DB.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+	err = RequestDB(c).Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
 		// add favorite
 		err = AddUserFavorite(tx, userID, body.HoleID, body.FavoriteGroupID)
 		if err != nil {
@@ -120,7 +131,7 @@ func AddFavorite(c *fiber.Ctx) error {
 	}
 
 	return c.Status(201).JSON(&Response{
-		Message: "收藏成功",
+		Message: utils.Localize(c, "收藏成功"),
 		Data:    data,
 	})
 }
@@ -150,7 +161,7 @@ func ModifyFavorite(c *fiber.Ctx) error {
 	}
 
 	var data []int
-	err = DB.Transaction(func(tx *gorm.DB) error {
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
 		// modify favorite
 		err = ModifyUserFavorite(tx, userID, body.HoleIDs, body.FavoriteGroupID)
 		if err != nil {
@@ -169,7 +180,7 @@ func ModifyFavorite(c *fiber.Ctx) error {
 	}
 
 	return c.Status(201).JSON(&Response{
-		Message: "修改成功",
+		Message: utils.Localize(c, "修改成功"),
 		Data:    data,
 	})
 }
@@ -198,7 +209,7 @@ func DeleteFavorite(c *fiber.Ctx) error {
 	}
 
 	var data []int
-	err = DB.Transaction(func(tx *gorm.DB) error {
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
 		// delete favorite
 		err = DeleteUserFavorite(tx, userID, body.HoleID, body.FavoriteGroupID)
 		if err != nil {
@@ -217,7 +228,7 @@ func DeleteFavorite(c *fiber.Ctx) error {
 	}
 
 	return c.JSON(&Response{
-		Message: "删除成功",
+		Message: utils.Localize(c, "删除成功"),
 		Data:    data,
 	})
 }
@@ -260,8 +271,8 @@ func ListFavoriteGroups(c *fiber.Ctx) error {
 
 	// get favoriteGroups
 	var data FavoriteGroups
-	err = DB.Transaction(func(tx *gorm.DB) error {
-		data, err = UserGetFavoriteGroups(DB, userID, order)
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
+		data, err = UserGetFavoriteGroups(RequestDB(c), userID, order)
 		return err
 	})
 	if err != nil {
@@ -294,7 +305,7 @@ func AddFavoriteGroup(c *fiber.Ctx) error {
 	}
 
 	var data FavoriteGroups
-	err = DB.Transaction(func(tx *gorm.DB) error {
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
 		// add favorite group
 		err = AddUserFavoriteGroup(tx, userID, body.Name)
 		if err != nil {
@@ -341,7 +352,7 @@ func ModifyFavoriteGroup(c *fiber.Ctx) error {
 
 	var data FavoriteGroups
 
-	err = DB.Transaction(func(tx *gorm.DB) error {
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
 
 		// modify favorite group
 		err = ModifyUserFavoriteGroup(tx, userID, *body.FavoriteGroupID, body.Name)
@@ -387,7 +398,7 @@ func DeleteFavoriteGroup(c *fiber.Ctx) error {
 	}
 
 	// delete favorite group
-	err = DeleteUserFavoriteGroup(DB, userID, *body.FavoriteGroupID)
+	err = DeleteUserFavoriteGroup(RequestDB(c), userID, *body.FavoriteGroupID)
 	if err != nil {
 		return err
 	}
@@ -419,7 +430,7 @@ func MoveFavorite(c *fiber.Ctx) error {
 	}
 
 	var data []int
-	err = DB.Transaction(func(tx *gorm.DB) error {
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
 		// move favorite
 		err = MoveUserFavorite(tx, userID, body.HoleIDs, *body.FromFavoriteGroupID, *body.ToFavoriteGroupID)
 		if err != nil {
@@ -0,0 +1,380 @@
+package favourite
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+	. "treehole_next/models"
+	"treehole_next/utils"
+)
+
+// ListFloorFavorites
+//
+// @Summary List User's Floor Favorites
+// @Tags Floor Favorite
+// @Produce application/json
+// @Router /user/floor_favorites [get]
+// @Param object query ListFloorFavoriteModel false "query"
+// @Success 200 {array} models.Floor
+func ListFloorFavorites(c *fiber.Ctx) error {
+	// get userID
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var query ListFloorFavoriteModel
+	err = common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+	if query.FavoriteGroupID != nil {
+		if !IsFloorFavoriteGroupExist(RequestDB(c), userID, *query.FavoriteGroupID) {
+			return utils.NewError(utils.ErrCodeFavoriteGroupNotFound, "收藏夹不存在")
+		}
+	}
+
+	if query.Plain {
+		data, err := UserGetFloorFavoriteData(RequestDB(c), userID, query.FavoriteGroupID)
+		if err != nil {
+			return err
+		}
+		return c.JSON(Map{"data": data})
+	}
+
+	// get order
+	var order string
+	switch query.Order {
+	case "id":
+		order = "floor.id desc"
+	case "time_created":
+		order = "MAX(user_floor_favorite.created_at) desc, floor.id desc"
+	}
+
+	// get floors, a floor bookmarked in several groups is listed once
+	querySet := RequestDB(c).Joins("JOIN user_floor_favorite ON user_floor_favorite.floor_id = floor.id AND user_floor_favorite.user_id = ?", userID)
+	if query.FavoriteGroupID != nil {
+		querySet = querySet.Where("user_floor_favorite.favorite_group_id = ?", *query.FavoriteGroupID)
+	}
+	floors := make(Floors, 0)
+	err = querySet.Group("floor.id").Order(order).
+		Offset(query.Offset).Limit(query.Size).Find(&floors).Error
+	if err != nil {
+		return err
+	}
+
+	// bookmarks in divisions no longer visible are kept but not shown
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	floors, err = floors.RemoveInvisible(user)
+	if err != nil {
+		return err
+	}
+	return utils.Serialize(c, &floors)
+}
+
+// AddFloorFavorite
+//
+// @Summary Bookmark A Floor
+// @Tags Floor Favorite
+// @Accept application/json
+// @Produce application/json
+// @Router /user/floor_favorites [post]
+// @Param json body FloorFavoriteModel true "json"
+// @Param Idempotency-Key header string false "dedupe retried requests"
+// @Success 201 {object} Response
+// @Failure 404 {object} common.HttpError
+func AddFloorFavorite(c *fiber.Ctx) error {
+	// validate body
+	var body FloorFavoriteModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	// get userID
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var data []int
+	err = RequestDB(c).Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		err = AddUserFloorFavorite(tx, userID, body.FloorID, body.FavoriteGroupID)
+		if err != nil {
+			return err
+		}
+
+		// create response
+		data, err = UserGetFloorFavoriteData(tx, userID, nil)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Status(201).JSON(&Response{
+		Message: utils.Localize(c, "收藏成功"),
+		Data:    data,
+	})
+}
+
+// DeleteFloorFavorite
+//
+// @Summary Remove A Floor Bookmark
+// @Tags Floor Favorite
+// @Produce application/json
+// @Router /user/floor_favorites [delete]
+// @Param json body FloorFavoriteModel true "json"
+// @Success 200 {object} Response
+// @Failure 404 {object} common.HttpError
+func DeleteFloorFavorite(c *fiber.Ctx) error {
+	// validate body
+	var body FloorFavoriteModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	// get userID
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var data []int
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
+		err = DeleteUserFloorFavorite(tx, userID, body.FloorID, body.FavoriteGroupID)
+		if err != nil {
+			return err
+		}
+
+		// create response
+		data, err = UserGetFloorFavoriteData(tx, userID, nil)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(&Response{
+		Message: utils.Localize(c, "删除成功"),
+		Data:    data,
+	})
+}
+
+// MoveFloorFavorite
+//
+// @Summary Move User's Floor Bookmarks
+// @Tags Floor Favorite
+// @Produce application/json
+// @Router /user/floor_favorites/move [put]
+// @Param json body MoveFloorFavoriteModel true "json"
+// @Success 200 {array} int
+// @Failure 404 {object} common.HttpError
+func MoveFloorFavorite(c *fiber.Ctx) error {
+	// validate body
+	var body MoveFloorFavoriteModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	// get userID
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var data []int
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
+		err = MoveUserFloorFavorite(tx, userID, body.FloorIDs, *body.FromFavoriteGroupID, *body.ToFavoriteGroupID)
+		if err != nil {
+			return err
+		}
+
+		// create response
+		data, err = UserGetFloorFavoriteData(tx, userID, body.ToFavoriteGroupID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(&data)
+}
+
+// ExportFloorFavorites
+//
+// @Summary Export User's Floor Bookmarks
+// @Description Download all floor favorite groups and bookmarks as a json file
+// @Tags Floor Favorite
+// @Produce application/json
+// @Router /user/floor_favorites/export [get]
+// @Success 200 {object} FloorFavoriteExportModel
+func ExportFloorFavorites(c *fiber.Ctx) error {
+	// get userID
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var data FloorFavoriteExportModel
+	data.FavoriteGroups, err = UserGetFloorFavoriteGroups(RequestDB(c), userID, "favorite_group_id")
+	if err != nil {
+		return err
+	}
+	err = RequestDB(c).Where("user_id = ?", userID).Order("favorite_group_id, created_at").Find(&data.Favorites).Error
+	if err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="floor_favorites_%d.json"`, userID))
+	return c.JSON(&data)
+}
+
+// ListFloorFavoriteGroups
+//
+// @Summary List User's Floor Favorite Groups
+// @Tags Floor Favorite
+// @Produce application/json
+// @Router /user/floor_favorite_groups [get]
+// @Param object query ListFavoriteGroupModel false "query"
+// @Success 200 {array} models.FloorFavoriteGroup
+func ListFloorFavoriteGroups(c *fiber.Ctx) error {
+	// get userID
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var query ListFavoriteGroupModel
+	err = common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+
+	// get order
+	order := "favorite_group_id"
+	if !query.Plain {
+		order = map[string]string{
+			"id":           "favorite_group_id desc",
+			"time_created": "created_at desc, favorite_group_id desc",
+			"time_updated": "updated_at desc, favorite_group_id desc",
+		}[query.Order]
+	}
+
+	data, err := UserGetFloorFavoriteGroups(RequestDB(c), userID, order)
+	if err != nil {
+		return err
+	}
+	return c.JSON(&data)
+}
+
+// AddFloorFavoriteGroup
+//
+// @Summary Add A Floor Favorite Group
+// @Tags Floor Favorite
+// @Accept application/json
+// @Produce application/json
+// @Router /user/floor_favorite_groups [post]
+// @Param json body AddFavoriteGroupModel true "json"
+// @Success 201 {array} models.FloorFavoriteGroup
+func AddFloorFavoriteGroup(c *fiber.Ctx) error {
+	// validate body
+	var body AddFavoriteGroupModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	// get userID
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	err = AddUserFloorFavoriteGroup(RequestDB(c), userID, body.Name)
+	if err != nil {
+		return err
+	}
+
+	// create response
+	data, err := UserGetFloorFavoriteGroups(RequestDB(c), userID, "favorite_group_id")
+	if err != nil {
+		return err
+	}
+	return c.Status(201).JSON(&data)
+}
+
+// ModifyFloorFavoriteGroup
+//
+// @Summary Modify User's Floor Favorite Group
+// @Tags Floor Favorite
+// @Produce application/json
+// @Router /user/floor_favorite_groups [put]
+// @Param json body ModifyFavoriteGroupModel true "json"
+// @Success 200 {array} models.FloorFavoriteGroup
+// @Failure 404 {object} common.HttpError
+func ModifyFloorFavoriteGroup(c *fiber.Ctx) error {
+	// validate body
+	var body ModifyFavoriteGroupModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	// get userID
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	err = ModifyUserFloorFavoriteGroup(RequestDB(c), userID, *body.FavoriteGroupID, body.Name)
+	if err != nil {
+		return err
+	}
+
+	// create response
+	data, err := UserGetFloorFavoriteGroups(RequestDB(c), userID, "favorite_group_id")
+	if err != nil {
+		return err
+	}
+	return c.JSON(&data)
+}
+
+// DeleteFloorFavoriteGroup
+//
+// @Summary Delete A Floor Favorite Group
+// @Tags Floor Favorite
+// @Produce application/json
+// @Router /user/floor_favorite_groups [delete]
+// @Param json body DeleteFavoriteGroupModel true "json"
+// @Success 204
+// @Failure 404 {object} common.HttpError
+func DeleteFloorFavoriteGroup(c *fiber.Ctx) error {
+	// validate body
+	var body DeleteFavoriteGroupModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	// get userID
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	err = DeleteUserFloorFavoriteGroup(RequestDB(c), userID, *body.FavoriteGroupID)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(204).JSON(nil)
+}
@@ -1,10 +1,14 @@
 package favourite
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"treehole_next/utils"
+)
 
 func RegisterRoutes(app fiber.Router) {
 	app.Get("/user/favorites", ListFavorites)
-	app.Post("/user/favorites", AddFavorite)
+	app.Post("/user/favorites", utils.MiddlewareIdempotency, AddFavorite)
 	app.Put("/user/favorites", ModifyFavorite)
 	app.Patch("/user/favorites/_webvpn", ModifyFavorite)
 	app.Delete("/user/favorites", DeleteFavorite)
@@ -14,4 +18,14 @@ func RegisterRoutes(app fiber.Router) {
 	app.Patch("/user/favorite_groups/_webvpn", ModifyFavoriteGroup)
 	app.Delete("/user/favorite_groups", DeleteFavoriteGroup)
 	app.Put("/user/favorites/move", MoveFavorite)
+
+	app.Get("/user/floor_favorites", ListFloorFavorites)
+	app.Get("/user/floor_favorites/export", ExportFloorFavorites)
+	app.Post("/user/floor_favorites", utils.MiddlewareIdempotency, AddFloorFavorite)
+	app.Delete("/user/floor_favorites", DeleteFloorFavorite)
+	app.Put("/user/floor_favorites/move", MoveFloorFavorite)
+	app.Get("/user/floor_favorite_groups", ListFloorFavoriteGroups)
+	app.Post("/user/floor_favorite_groups", AddFloorFavoriteGroup)
+	app.Put("/user/floor_favorite_groups", ModifyFloorFavoriteGroup)
+	app.Delete("/user/floor_favorite_groups", DeleteFloorFavoriteGroup)
 }
@@ -1,5 +1,7 @@
 package favourite
 
+import . "treehole_next/models"
+
 type Response struct {
 	Message string `json:"message"`
 	Data    []int  `json:"data"`
@@ -49,3 +51,27 @@ type ListFavoriteGroupModel struct {
 	Order string `json:"order" query:"order" validate:"omitempty,oneof=id time_created time_updated" default:"time_created"`
 	Plain bool   `json:"plain" default:"false" query:"plain"`
 }
+
+type ListFloorFavoriteModel struct {
+	Order           string `json:"order" query:"order" validate:"omitempty,oneof=id time_created" default:"time_created"`
+	Plain           bool   `json:"plain" default:"false" query:"plain"`
+	FavoriteGroupID *int   `json:"favorite_group_id" query:"favorite_group_id"`
+	Size            int    `json:"size" query:"size" default:"30" validate:"min=0,max=50"`
+	Offset          int    `json:"offset" query:"offset" default:"0" validate:"min=0"`
+}
+
+type FloorFavoriteModel struct {
+	FloorID         int `json:"floor_id" validate:"required,min=1"`
+	FavoriteGroupID int `json:"favorite_group_id" default:"0"`
+}
+
+type MoveFloorFavoriteModel struct {
+	FloorIDs            []int `json:"floor_ids"`
+	FromFavoriteGroupID *int  `json:"from_favorite_group_id" default:"0" validate:"required"`
+	ToFavoriteGroupID   *int  `json:"to_favorite_group_id" validate:"required"`
+}
+
+type FloorFavoriteExportModel struct {
+	FavoriteGroups FloorFavoriteGroups `json:"favorite_groups"`
+	Favorites      UserFloorFavorites  `json:"favorites"`
+}
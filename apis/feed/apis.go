@@ -0,0 +1,149 @@
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+const (
+	feedSize        = 30
+	feedTitleSize   = 30
+	feedSummarySize = 500
+	// feed readers poll often, let them and proxies cache feeds for a while
+	feedMaxAge = 300
+)
+
+// GetDivisionFeed
+//
+// @Summary Atom Feed Of A Division
+// @Description Recent holes with previews of the first floors, no login required.
+// @Tags Feed
+// @Produce application/atom+xml
+// @Router /divisions/{id}/feed.atom [get]
+// @Param id path int true "id"
+// @Success 200
+// @Success 304
+// @Failure 404 {object} MessageModel
+func GetDivisionFeed(c *fiber.Ctx) error {
+	if GetTenant(c).AdminOnly() {
+		return common.Forbidden()
+	}
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	// hidden divisions are not served, like ListDivisions
+	var division Division
+	err = ReadDB(c).Where("visibility = ? AND tenant_id = ?", DivisionVisibilityPublic, GetTenant(c).ID).
+		Where("hidden = ? AND status <> ?", false, DivisionStatusHidden).
+		Take(&division, id).Error
+	if err != nil {
+		return err
+	}
+
+	var holes Holes
+	err = ReadDB(c).Where("division_id = ? AND hidden = ?", id, false).
+		Order("created_at desc").Limit(feedSize).Find(&holes).Error
+	if err != nil {
+		return err
+	}
+
+	return sendFeed(c, fmt.Sprintf("urn:treehole:division:%d", id), division.Name, holes)
+}
+
+// GetTagFeed
+//
+// @Summary Atom Feed Of A Tag
+// @Description Recent holes with previews of the first floors, no login required.
+// @Tags Feed
+// @Produce application/atom+xml
+// @Router /tags/{name}/feed.atom [get]
+// @Param name path string true "name"
+// @Success 200
+// @Success 304
+// @Failure 404 {object} MessageModel
+func GetTagFeed(c *fiber.Ctx) error {
+	if GetTenant(c).AdminOnly() {
+		return common.Forbidden()
+	}
+
+	var tag Tag
+	err := ReadDB(c).Where("name = ? AND tenant_id = ?", c.Params("name"), GetTenant(c).ID).Take(&tag).Error
+	if err != nil {
+		return err
+	}
+
+	querySet, err := WhereVisibleDivisions(ReadDB(c).Where("hole.hidden = ?", false), nil)
+	if err != nil {
+		return err
+	}
+	var holes Holes
+	err = querySet.Order("hole.created_at desc").Limit(feedSize).
+		Model(&tag).Association("Holes").Find(&holes)
+	if err != nil {
+		return err
+	}
+
+	return sendFeed(c, fmt.Sprintf("urn:treehole:tag:%d", tag.ID), "#"+tag.Name, holes)
+}
+
+func sendFeed(c *fiber.Ctx, id, title string, holes Holes) error {
+	lastModified := holes.LastModified()
+	c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", feedMaxAge))
+	if CheckETag(c, 0, len(holes), lastModified, ETagHoles) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	firstFloors, err := loadFirstFloors(c, holes)
+	if err != nil {
+		return err
+	}
+	tenant := GetTenant(c)
+
+	feed := Feed{
+		Xmlns:   atomNamespace,
+		ID:      id,
+		Title:   title,
+		Updated: atomTime(lastModified),
+		Links:   []Link{{Href: c.BaseURL() + c.OriginalURL(), Rel: "self"}},
+		Entries: make([]Entry, 0, len(holes)),
+	}
+	for _, hole := range holes {
+		entry := NewEntry(tenant, hole, firstFloors[hole.ID])
+		if entry != nil {
+			feed.Entries = append(feed.Entries, *entry)
+		}
+	}
+
+	data, err := xml.Marshal(&feed)
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, "application/atom+xml; charset=utf-8")
+	return c.Send(append([]byte(xml.Header), data...))
+}
+
+// loadFirstFloors returns first floors of holes by hole id
+func loadFirstFloors(c *fiber.Ctx, holes Holes) (map[int]*Floor, error) {
+	firstFloors := make(map[int]*Floor, len(holes))
+	if len(holes) == 0 {
+		return firstFloors, nil
+	}
+
+	var floors Floors
+	err := ReadDB(c).Where("hole_id IN ? AND ranking = 0", Models2IDSlice(holes)).Find(&floors).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, floor := range floors {
+		firstFloors[floor.HoleID] = floor
+	}
+	return firstFloors, nil
+}
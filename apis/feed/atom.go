@@ -0,0 +1,81 @@
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"time"
+
+	. "treehole_next/models"
+	"treehole_next/utils"
+)
+
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+// Feed is an Atom feed, see RFC 4287
+type Feed struct {
+	XMLName xml.Name `xml:"feed"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Links   []Link   `xml:"link"`
+	Entries []Entry  `xml:"entry"`
+}
+
+type Link struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type Entry struct {
+	ID        string `xml:"id"`
+	Title     string `xml:"title"`
+	Updated   string `xml:"updated"`
+	Published string `xml:"published"`
+	Link      Link   `xml:"link"`
+	// anonyname of the poster
+	Author  Author `xml:"author"`
+	Summary string `xml:"summary"`
+}
+
+type Author struct {
+	Name string `xml:"name"`
+}
+
+// holeLink returns the link to a hole, see Tenant.HoleLinkFormat
+func holeLink(tenant *Tenant, holeID int) string {
+	return fmt.Sprintf(tenant.HoleLinkFormat(), holeID)
+}
+
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// publicContent returns the content of floor shown publicly, false if it should not be shown
+func publicContent(floor *Floor) (string, bool) {
+	if floor == nil || floor.Deleted || floor.Sensitive() {
+		return "", false
+	}
+	if floor.Fold != "" {
+		// folded floors show the fold reason only
+		return floor.Fold, true
+	}
+	return floor.Content, true
+}
+
+// NewEntry makes an entry of hole from its first floor, nil if the first floor should not be shown publicly
+func NewEntry(tenant *Tenant, hole *Hole, firstFloor *Floor) *Entry {
+	content, ok := publicContent(firstFloor)
+	if !ok {
+		return nil
+	}
+	return &Entry{
+		ID:        fmt.Sprintf("urn:treehole:hole:%d", hole.ID),
+		Title:     fmt.Sprintf("#%d %s", hole.ID, utils.StripContent(content, feedTitleSize)),
+		Updated:   atomTime(hole.UpdatedAt),
+		Published: atomTime(hole.CreatedAt),
+		Link:      Link{Href: holeLink(tenant, hole.ID)},
+		Author:    Author{Name: utils.GetFuzzName(firstFloor.Anonyname)},
+		Summary:   utils.StripContent(content, feedSummarySize),
+	}
+}
@@ -0,0 +1,12 @@
+package feed
+
+import "github.com/gofiber/fiber/v2"
+
+// RegisterRoutes registers feeds, sitemap and hole metadata, which are public so that
+// feed readers, crawlers and chat apps can fetch them without login
+func RegisterRoutes(app fiber.Router) {
+	app.Get("/divisions/:id<int>/feed.atom", GetDivisionFeed)
+	app.Get("/tags/:name/feed.atom", GetTagFeed)
+	app.Get("/sitemap.xml", GetSitemap)
+	app.Get("/holes/:id<int>/meta", GetHoleMeta)
+}
@@ -0,0 +1,21 @@
+package feed
+
+import "time"
+
+type SitemapModel struct {
+	// page of the sitemap starting from 1, 0 for the sitemap index
+	Page int `json:"page" query:"page" default:"0" validate:"min=0"`
+}
+
+// HoleMeta is a preview of a hole for link unfurling
+type HoleMeta struct {
+	ID         int    `json:"id"`
+	DivisionID int    `json:"division_id"`
+	Title      string `json:"title"`
+	// preview of the first floor, empty if it is sensitive or deleted
+	Preview     string    `json:"preview"`
+	FloorCount  int       `json:"floor_count"`
+	URL         string    `json:"url"`
+	TimeCreated time.Time `json:"time_created"`
+	TimeUpdated time.Time `json:"time_updated"`
+}
@@ -0,0 +1,170 @@
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+
+	. "treehole_next/models"
+	"treehole_next/utils"
+)
+
+const (
+	sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	// at most 50000 urls in a sitemap
+	sitemapPageSize = 10000
+	sitemapMaxAge   = 3600
+)
+
+// SitemapIndex lists pages of the sitemap, see https://www.sitemaps.org/protocol.html
+type SitemapIndex struct {
+	XMLName  xml.Name  `xml:"sitemapindex"`
+	Xmlns    string    `xml:"xmlns,attr"`
+	Sitemaps []Sitemap `xml:"sitemap"`
+}
+
+type Sitemap struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type URLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []SitemapURL `xml:"url"`
+}
+
+type SitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// GetSitemap
+//
+// @Summary Sitemap Of Public Holes
+// @Description The sitemap index without page, or holes of the page ordered by id, no login required.
+// @Tags Feed
+// @Produce application/xml
+// @Router /sitemap.xml [get]
+// @Param object query SitemapModel false "query"
+// @Success 200
+func GetSitemap(c *fiber.Ctx) error {
+	if GetTenant(c).AdminOnly() {
+		return common.Forbidden()
+	}
+	var query SitemapModel
+	err := common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", sitemapMaxAge))
+
+	tenant := GetTenant(c)
+	publicHoles, err := WhereVisibleDivisions(ReadDB(c).Model(&Hole{}).Where("hidden = ? AND tenant_id = ?", false, tenant.ID), nil)
+	if err != nil {
+		return err
+	}
+	var data any
+	if query.Page == 0 {
+		var count int64
+		err = publicHoles.Count(&count).Error
+		if err != nil {
+			return err
+		}
+		index := SitemapIndex{Xmlns: sitemapNamespace, Sitemaps: []Sitemap{}}
+		base := c.BaseURL() + c.Path()
+		for page := 1; page <= int(count+sitemapPageSize-1)/sitemapPageSize; page++ {
+			index.Sitemaps = append(index.Sitemaps, Sitemap{Loc: fmt.Sprintf("%s?page=%d", base, page)})
+		}
+		data = &index
+	} else {
+		var holes []struct {
+			ID        int
+			UpdatedAt time.Time
+		}
+		err = publicHoles.Select("id", "updated_at").Order("id").
+			Offset((query.Page - 1) * sitemapPageSize).Limit(sitemapPageSize).Scan(&holes).Error
+		if err != nil {
+			return err
+		}
+		if len(holes) == 0 {
+			return common.NotFound()
+		}
+		urlSet := URLSet{Xmlns: sitemapNamespace, URLs: make([]SitemapURL, 0, len(holes))}
+		for _, hole := range holes {
+			urlSet.URLs = append(urlSet.URLs, SitemapURL{Loc: holeLink(tenant, hole.ID), LastMod: atomTime(hole.UpdatedAt)})
+		}
+		data = &urlSet
+	}
+
+	body, err := xml.Marshal(data)
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationXMLCharsetUTF8)
+	return c.Send(append([]byte(xml.Header), body...))
+}
+
+// GetHoleMeta
+//
+// @Summary Metadata Of A Hole
+// @Description A lightweight preview for link unfurling, no login required. Hidden holes are not found.
+// @Tags Feed
+// @Produce application/json
+// @Router /holes/{id}/meta [get]
+// @Param id path int true "id"
+// @Success 200 {object} HoleMeta
+// @Failure 404 {object} MessageModel
+func GetHoleMeta(c *fiber.Ctx) error {
+	if GetTenant(c).AdminOnly() {
+		return common.Forbidden()
+	}
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	tenant := GetTenant(c)
+	querySet, err := WhereVisibleDivisions(ReadDB(c).Where("hidden = ? AND tenant_id = ?", false, tenant.ID), nil)
+	if err != nil {
+		return err
+	}
+	var hole Hole
+	err = querySet.Take(&hole, id).Error
+	if err != nil {
+		return err
+	}
+	var firstFloor Floor
+	err = ReadDB(c).Where("hole_id = ? AND ranking = 0", id).Take(&firstFloor).Error
+	if err != nil {
+		return err
+	}
+
+	meta := HoleMeta{
+		ID:          hole.ID,
+		DivisionID:  hole.DivisionID,
+		Title:       fmt.Sprintf("#%d", hole.ID),
+		FloorCount:  hole.Reply + 1,
+		URL:         holeLink(tenant, hole.ID),
+		TimeCreated: hole.CreatedAt,
+		TimeUpdated: hole.UpdatedAt,
+	}
+	if content, ok := publicContent(&firstFloor); ok {
+		meta.Title += " " + utils.StripContent(content, feedTitleSize)
+		meta.Preview = utils.StripContent(content, feedSummarySize)
+	}
+
+	c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", feedMaxAge))
+	// folding the first floor does not update the hole
+	lastModified := hole.UpdatedAt
+	if firstFloor.UpdatedAt.After(lastModified) {
+		lastModified = firstFloor.UpdatedAt
+	}
+	if utils.CheckETag(c, 0, meta.FloorCount, lastModified, utils.ETagHoles) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+	return c.JSON(&meta)
+}
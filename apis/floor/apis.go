@@ -1,8 +1,10 @@
 package floor
 
 import (
+	"errors"
 	"fmt"
 	"slices"
+	"strings"
 	"time"
 	"treehole_next/utils/sensitive"
 
@@ -25,7 +27,8 @@ import (
 // @Produce application/json
 // @Router /holes/{hole_id}/floors [get]
 // @Param hole_id path int true "hole id"
-// @Param object query ListModel false "query"
+// @Param object query ListInAHoleModel false "query"
+// @Param format query string false "plain to return content with markdown stripped, for screen readers" Enums(plain)
 // @Success 200 {array} Floor
 func ListFloorsInAHole(c *fiber.Ctx) error {
 	// validate
@@ -34,26 +37,46 @@ func ListFloorsInAHole(c *fiber.Ctx) error {
 		return err
 	}
 
-	var query ListModel
+	var query ListInAHoleModel
 	err = common.ValidateQuery(c, &query)
 	if err != nil {
 		return err
 	}
+	err = checkHoleVisible(c, holeID)
+	if err != nil {
+		return err
+	}
 
 	// get floors
 	var floors Floors
+	if query.Order == "like" {
+		floors, err = listHotFloors(c, holeID, &query)
+		if err != nil {
+			return err
+		}
+		return Serialize(c, &floors, SerializeOptions{Fields: query.Fields})
+	}
+	if query.AroundFloorID != 0 || query.Order != "" {
+		floors, err = listFloorsByRanking(c, holeID, &query)
+		if err != nil {
+			return err
+		}
+		return Serialize(c, &floors, SerializeOptions{Fields: query.Fields})
+	}
+
 	// use ranking field to locate faster
 	querySet, err := floors.MakeQuerySet(&holeID, &query.Offset, &query.Size, c)
 	if err != nil {
 		return err
 	}
-	result := querySet.Order(query.OrderBy + " " + query.Sort).
+	result := querySet.Scopes(PosterScope(holeID, query.Poster)).
+		Order(query.OrderBy + " " + query.Sort).
 		Find(&floors)
 	if result.Error != nil {
 		return result.Error
 	}
 
-	return Serialize(c, &floors)
+	return Serialize(c, &floors, SerializeOptions{Fields: query.Fields})
 }
 
 // ListFloorsOld
@@ -64,6 +87,7 @@ func ListFloorsInAHole(c *fiber.Ctx) error {
 // @Produce application/json
 // @Router /floors [get]
 // @Param object query ListOldModel false "query"
+// @Param format query string false "plain to return content with markdown stripped, for screen readers" Enums(plain)
 // @Success 200 {array} Floor
 func ListFloorsOld(c *fiber.Ctx) error {
 	// validate
@@ -76,6 +100,10 @@ func ListFloorsOld(c *fiber.Ctx) error {
 	if query.Search != "" {
 		return SearchFloorsOld(c, &query)
 	}
+	err = checkHoleVisible(c, query.HoleID)
+	if err != nil {
+		return err
+	}
 
 	// get floors
 	var floors Floors
@@ -102,7 +130,7 @@ func ListFloorsOld(c *fiber.Ctx) error {
 		return result.Error
 	}
 
-	return Serialize(c, &floors)
+	return Serialize(c, &floors, SerializeOptions{Fields: query.Fields})
 }
 
 // GetFloor
@@ -112,6 +140,7 @@ func ListFloorsOld(c *fiber.Ctx) error {
 // @Produce application/json
 // @Router /floors/{id} [get]
 // @Param id path int true "id"
+// @Param format query string false "plain to return content with markdown stripped, for screen readers" Enums(plain)
 // @Success 200 {object} Floor
 // @Failure 404 {object} MessageModel
 func GetFloor(c *fiber.Ctx) (err error) {
@@ -132,18 +161,10 @@ func GetFloor(c *fiber.Ctx) (err error) {
 		return err
 	}
 
-	user, err := GetCurrLoginUser(c)
+	err = checkHoleVisible(c, floor.HoleID)
 	if err != nil {
 		return err
 	}
-	if !user.IsAdmin {
-		// get hole
-		var hole Hole
-		err = DB.Where("hidden = false").First(&hole, floor.HoleID).Error
-		if err != nil {
-			return err
-		}
-	}
 
 	return Serialize(c, &floor)
 }
@@ -156,6 +177,7 @@ func GetFloor(c *fiber.Ctx) (err error) {
 // @Router /holes/{hole_id}/floors [post]
 // @Param hole_id path int true "hole id"
 // @Param json body CreateModel true "json"
+// @Param Idempotency-Key header string false "dedupe retried requests"
 // @Success 201 {object} Floor
 func CreateFloor(c *fiber.Ctx) error {
 	var body CreateModel
@@ -165,7 +187,7 @@ func CreateFloor(c *fiber.Ctx) error {
 	}
 
 	if len([]rune(body.Content)) > 10000 {
-		return common.BadRequest("文本限制 10000 字")
+		return NewError(ErrCodeContentTooLong, "文本限制 10000 字")
 	}
 
 	holeID, err := c.ParamsInt("id")
@@ -192,29 +214,31 @@ func CreateFloor(c *fiber.Ctx) error {
 
 	// permission
 	if user.BanDivision[hole.DivisionID] != nil {
-		return common.Forbidden(user.BanDivisionMessage(hole.DivisionID))
+		return NewError(ErrCodeBannedInDivision, user.BanDivisionMessage(hole.DivisionID))
 	}
 	if hole.Locked && !user.IsAdmin {
-		return common.Forbidden("该帖子已被锁定，非管理员禁止发帖")
+		return NewError(ErrCodeHoleLocked, "该帖子已被锁定，非管理员禁止发帖")
 	}
 
 	// special tag
 	if body.SpecialTag != "" && !user.IsAdmin && !slices.Contains(user.SpecialTags, body.SpecialTag) {
-		return common.Forbidden("非管理员禁止发含有特殊标签的帖")
+		return NewError(ErrCodeSpecialTagAdminOnly, "非管理员禁止发含有特殊标签的帖")
 	} else if body.SpecialTag == "" && user.DefaultSpecialTag != "" {
 		body.SpecialTag = user.DefaultSpecialTag
 	}
 
 	// create floor
 	floor := Floor{
-		HoleID:     holeID,
-		UserID:     user.ID,
-		Content:    body.Content,
-		ReplyTo:    body.ReplyTo,
-		SpecialTag: body.SpecialTag,
-		IsMe:       true,
-	}
-	err = floor.Create(DB, &hole, c)
+		HoleID:         holeID,
+		UserID:         user.ID,
+		Content:        body.Content,
+		ReplyTo:        body.ReplyTo,
+		SpecialTag:     body.SpecialTag,
+		Spoiler:        body.Spoiler,
+		ContentWarning: strings.TrimSpace(body.ContentWarning),
+		IsMe:           true,
+	}
+	err = floor.Create(RequestDB(c), &hole, c)
 	if err != nil {
 		return err
 	}
@@ -230,6 +254,7 @@ func CreateFloor(c *fiber.Ctx) error {
 // @Produce application/json
 // @Router /floors [post]
 // @Param json body CreateOldModel true "json"
+// @Param Idempotency-Key header string false "dedupe retried requests"
 // @Success 201 {object} CreateOldResponse
 func CreateFloorOld(c *fiber.Ctx) error {
 	var body CreateOldModel
@@ -239,7 +264,7 @@ func CreateFloorOld(c *fiber.Ctx) error {
 	}
 
 	if len([]rune(body.Content)) > 10000 {
-		return common.BadRequest("文本限制 10000 字")
+		return NewError(ErrCodeContentTooLong, "文本限制 10000 字")
 	}
 
 	// get hole to check DivisionID and Locked
@@ -261,39 +286,43 @@ func CreateFloorOld(c *fiber.Ctx) error {
 
 	// permission
 	if user.BanDivision[hole.DivisionID] != nil {
-		return common.Forbidden(user.BanDivisionMessage(hole.DivisionID))
+		return NewError(ErrCodeBannedInDivision, user.BanDivisionMessage(hole.DivisionID))
 	}
 	if hole.Locked && !user.IsAdmin {
-		return common.Forbidden("该帖子已被锁定，非管理员禁止发帖")
+		return NewError(ErrCodeHoleLocked, "该帖子已被锁定，非管理员禁止发帖")
 	}
 
 	// special tag
 	if body.SpecialTag != "" && !user.IsAdmin && !slices.Contains(user.SpecialTags, body.SpecialTag) {
-		return common.Forbidden("非管理员禁止发含有特殊标签的帖子")
+		return NewError(ErrCodeSpecialTagAdminOnly, "非管理员禁止发含有特殊标签的帖子")
 	} else if body.SpecialTag == "" && user.DefaultSpecialTag != "" {
 		body.SpecialTag = user.DefaultSpecialTag
 	}
 
 	// create floor
 	floor := Floor{
-		HoleID:     body.HoleID,
-		UserID:     user.ID,
-		Content:    body.Content,
-		ReplyTo:    body.ReplyTo,
-		SpecialTag: body.SpecialTag,
-		IsMe:       true,
-	}
-	err = floor.Create(DB, &hole, c)
+		HoleID:         body.HoleID,
+		UserID:         user.ID,
+		Content:        body.Content,
+		ReplyTo:        body.ReplyTo,
+		SpecialTag:     body.SpecialTag,
+		Spoiler:        body.Spoiler,
+		ContentWarning: strings.TrimSpace(body.ContentWarning),
+		IsMe:           true,
+	}
+	err = floor.Create(RequestDB(c), &hole, c)
 	if err != nil {
 		return err
 	}
 
 	return c.Status(201).JSON(&CreateOldResponse{
 		Data:    floor,
-		Message: "发表成功",
+		Message: Localize(c, "发表成功"),
 	})
 }
 
+var errVersionConflict = errors.New("floor version conflict")
+
 // ModifyFloor
 //
 // @Summary Modify A Floor
@@ -306,6 +335,7 @@ func CreateFloorOld(c *fiber.Ctx) error {
 // @Param json body ModifyModel true "json"
 // @Success 200 {object} Floor
 // @Failure 404 {object} MessageModel
+// @Failure 409 {object} ConflictResponse
 func ModifyFloor(c *fiber.Ctx) error {
 	// validate request body
 	var body ModifyModel
@@ -315,11 +345,11 @@ func ModifyFloor(c *fiber.Ctx) error {
 	}
 
 	if body.DoNothing() {
-		return common.BadRequest("无效请求")
+		return NewError(ErrCodeInvalidRequest, "无效请求")
 	}
 
 	if body.Content != nil && len([]rune(*body.Content)) > 10000 {
-		return common.BadRequest("文本限制 10000 字")
+		return NewError(ErrCodeContentTooLong, "文本限制 10000 字")
 	}
 
 	// parse floor_id
@@ -335,7 +365,7 @@ func ModifyFloor(c *fiber.Ctx) error {
 	}
 
 	var floor Floor
-	err = DB.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+	err = RequestDB(c).Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
 		// load floor, lock for update
 		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&floor, floorID).Error
 		if err != nil {
@@ -355,6 +385,11 @@ func ModifyFloor(c *fiber.Ctx) error {
 			return err
 		}
 
+		// optimistic concurrency, edits based on an old version are rejected
+		if body.Version != nil && *body.Version != floor.Version {
+			return errVersionConflict
+		}
+
 		// partially modify floor
 		if body.Content != nil && *body.Content != "" {
 			var reason string
@@ -367,12 +402,31 @@ func ModifyFloor(c *fiber.Ctx) error {
 			} else {
 				return common.Forbidden()
 			}
+			if !user.Can(PermissionModerateFloor, hole.DivisionID) {
+				var division Division
+				err = tx.Take(&division, hole.DivisionID).Error
+				if err != nil {
+					return err
+				}
+				err = division.CheckFloorEdit(&floor, time.Now())
+				if err != nil {
+					return err
+				}
+			}
+			err = user.CheckLinkPrivilege(*body.Content)
+			if err != nil {
+				return err
+			}
 			floor.Modified += 1
 			err = floor.Backup(tx, user.ID, reason)
 			if err != nil {
 				return err
 			}
 			floor.Content = *body.Content
+			err = CheckLinkRules(&floor)
+			if err != nil {
+				return err
+			}
 
 			// sensitive check
 
@@ -385,7 +439,7 @@ func ModifyFloor(c *fiber.Ctx) error {
 				return err
 			}
 
-			floor.IsSensitive = !sensitiveResp.Pass
+			floor.IsSensitive = !sensitiveResp.Pass && !user.Trusted(TrustedBypassSensitive)
 			floor.IsActualSensitive = nil
 			floor.SensitiveDetail = sensitiveResp.Detail
 			// update floor.mention after update floor.content
@@ -408,7 +462,7 @@ func ModifyFloor(c *fiber.Ctx) error {
 			}
 
 			err = tx.Model(&floor).
-				Select([]string{"Content", "Modified", "IsSensitive", "IsActualSensitive", "SensitiveDetail"}).
+				Select([]string{"Content", "Modified", "IsSensitive", "IsActualSensitive", "SensitiveDetail", "Fold"}).
 				Updates(&floor).Error
 			if err != nil {
 				return err
@@ -416,13 +470,14 @@ func ModifyFloor(c *fiber.Ctx) error {
 
 			// reindex floor
 			if !hole.Hidden && !floor.IsSensitive {
-				go FloorIndex(FloorModel{
+				floorModel := FloorModel{
 					ID:        floor.ID,
 					UpdatedAt: time.Now(),
 					Content:   floor.Content,
-				})
+				}
+				Go(func() { FloorIndex(floorModel) })
 			} else {
-				go FloorDelete(floorID)
+				Go(func() { FloorDelete(floorID) })
 				if floor.IsSensitive {
 					floor.SendSensitive(tx)
 				}
@@ -463,6 +518,23 @@ func ModifyFloor(c *fiber.Ctx) error {
 			}
 		}
 
+		// update content warning
+		if body.Spoiler != nil || body.ContentWarning != nil {
+			if body.Spoiler != nil {
+				floor.Spoiler = *body.Spoiler
+			}
+			if body.ContentWarning != nil {
+				floor.ContentWarning = strings.TrimSpace(*body.ContentWarning)
+			}
+
+			err = tx.Model(&floor).
+				Select("Spoiler", "ContentWarning").
+				Updates(&floor).Error
+			if err != nil {
+				return err
+			}
+		}
+
 		// update special tag
 		if body.SpecialTag != nil {
 			floor.SpecialTag = *body.SpecialTag
@@ -484,7 +556,7 @@ func ModifyFloor(c *fiber.Ctx) error {
 			} else if *body.Like == "cancel" {
 				err = floor.ModifyLike(tx, user.ID, 0)
 			} else {
-				return common.BadRequest("like option must be add or cancel")
+				return NewError(ErrCodeInvalidLikeOption, "like option must be add or cancel")
 			}
 			if err != nil {
 				return err
@@ -499,17 +571,49 @@ func ModifyFloor(c *fiber.Ctx) error {
 			}
 		}
 
+		if body.Edits() {
+			floor.Version += 1
+			err = tx.Model(&floor).
+				Select("Version").
+				Updates(&floor).Error
+			if err != nil {
+				return err
+			}
+		}
+
 		return nil
 	})
+	if errors.Is(err, errVersionConflict) {
+		c.Status(fiber.StatusConflict)
+		return Serialize(c, &ConflictResponse{
+			Message: Localize(c, "该楼层已被修改，请刷新后重试"),
+			Version: floor.Version,
+			Floor:   &floor,
+		})
+	}
 	if err != nil {
 		return err
 	}
 
+	if body.Like != nil {
+		err = DeleteUserLikesCache(user.ID, floor.HoleID)
+		if err != nil {
+			return err
+		}
+		if floor.Liked == 1 {
+			TriggerBadges(floor.UserID, BadgeEventLike)
+		}
+	}
+
+	if body.Content != nil && *body.Content != "" {
+		ReviewFloorImages(&floor)
+	}
+
 	// SendModify only when operator or admin modify content or fold
 	if ((body.Content != nil && *body.Content != "") ||
 		body.Fold != nil || body.FoldFrontend != nil) &&
 		user.ID != floor.UserID {
-		err = floor.SendModify(DB)
+		err = floor.SendModify(RequestDB(c))
 		if err != nil {
 			log.Err(err).Str("model", "Notification").Msg("SendModify failed")
 			// return err // only for test
@@ -538,7 +642,7 @@ func ModifyFloorLike(c *fiber.Ctx) error {
 
 	// validate like option
 	if likeOption > 1 || likeOption < -1 {
-		return common.BadRequest("like option must be -1, 0 or 1")
+		return NewError(ErrCodeInvalidLikeOption, "like option must be -1, 0 or 1")
 	}
 
 	// parse floor_id
@@ -547,20 +651,57 @@ func ModifyFloorLike(c *fiber.Ctx) error {
 		return err
 	}
 
+	return modifyFloorLike(c, floorID, func(tx *gorm.DB, floor *Floor, userID int) error {
+		return floor.ModifyLike(tx, userID, int8(likeOption))
+	})
+}
+
+// ToggleFloorLike
+//
+// @Summary Toggle A Floor's like
+// @Description Liking a liked floor resets the like, disliking a liked floor changes it to dislike, and vice versa.
+// @Tags Floor
+// @Produce application/json
+// @Router /floors/{id}/like/{like}/_toggle [post]
+// @Param id path int true "id"
+// @Param like path int true "1 is like, -1 is dislike"
+// @Success 200 {object} Floor
+// @Failure 404 {object} MessageModel
+func ToggleFloorLike(c *fiber.Ctx) error {
+	action, err := c.ParamsInt("like")
+	if err != nil {
+		return err
+	}
+	if action != 1 && action != -1 {
+		return NewError(ErrCodeInvalidLikeOption, "like option must be -1 or 1")
+	}
+
+	floorID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	return modifyFloorLike(c, floorID, func(tx *gorm.DB, floor *Floor, userID int) error {
+		return floor.ToggleLike(tx, userID, int8(action))
+	})
+}
+
+// modifyFloorLike locks the floor so that likes of a floor are serialized, and saves the recomputed counters
+func modifyFloorLike(c *fiber.Ctx, floorID int, modify func(tx *gorm.DB, floor *Floor, userID int) error) error {
 	userID, err := common.GetUserID(c)
 	if err != nil {
 		return err
 	}
 
 	var floor Floor
-	err = DB.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+	err = RequestDB(c).Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
 		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&floor, floorID)
 		if result.Error != nil {
 			return result.Error
 		}
 
 		// modify like
-		err = floor.ModifyLike(tx, userID, int8(likeOption))
+		err = modify(tx, &floor, userID)
 		if err != nil {
 			return err
 		}
@@ -571,6 +712,13 @@ func ModifyFloorLike(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	err = DeleteUserLikesCache(userID, floor.HoleID)
+	if err != nil {
+		return err
+	}
+	if floor.Liked == 1 {
+		TriggerBadges(floor.UserID, BadgeEventLike)
+	}
 
 	return Serialize(c, &floor)
 }
@@ -578,6 +726,8 @@ func ModifyFloorLike(c *fiber.Ctx) error {
 // DeleteFloor
 //
 // @Summary Delete A Floor
+// @Description Moderators choose delete_category from the report categories, with delete_reason as an optional note.
+// @Description The content is kept in history and replaced by a tombstone like 该内容因人身攻击被移除, and the author is notified.
 // @Tags Floor
 // @Produce application/json
 // @Router /floors/{id} [delete]
@@ -605,7 +755,7 @@ func DeleteFloor(c *fiber.Ctx) error {
 	}
 
 	var floor Floor
-	err = DB.Transaction(func(tx *gorm.DB) error {
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
 
 		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&floor, floorID)
 		if result.Error != nil {
@@ -617,31 +767,49 @@ func DeleteFloor(c *fiber.Ctx) error {
 			return common.Forbidden()
 		}
 
-		err = floor.Backup(tx, user.ID, body.Reason)
-		if err != nil {
-			return err
+		if user.ID == floor.UserID {
+			held, err := floor.UnderLegalHold(tx)
+			if err != nil {
+				return err
+			}
+			if held {
+				return NewError(ErrCodeLegalHold, "该内容已被保全，无法删除")
+			}
+			err = floor.Backup(tx, user.ID, body.Reason)
+			if err != nil {
+				return err
+			}
+			floor.Content = generateDeleteReason(body.Reason, true)
+		} else {
+			if body.Category == "" {
+				return common.BadRequest("请选择删除理由")
+			}
+			err = floor.Backup(tx, user.ID, deleteReasonText(body.Category, body.Reason))
+			if err != nil {
+				return err
+			}
+			floor.Content = generateTombstone(body.Category)
+			floor.DeleteCategory = body.Category
 		}
-
 		floor.Deleted = true
-		floor.Content = generateDeleteReason(body.Reason, user.ID == floor.UserID)
 		return tx.Save(&floor).Error
 	})
 	if err != nil {
 		return err
 	}
 
-	go FloorDelete(floor.ID)
+	Go(func() { FloorDelete(floor.ID) })
 
 	// log
 	if user.ID == floor.UserID {
 		MyLog("Floor", "Delete", floorID, user.ID, RoleOperator, "reason: ", body.Reason)
 	} else {
-		MyLog("Floor", "Delete", floorID, user.ID, RoleOperator, "reason: ", body.Reason)
+		MyLog("Floor", "Delete", floorID, user.ID, RoleOperator, "reason: ", deleteReasonText(body.Category, body.Reason))
 
-		// SendModify when admin delete floor
-		err = floor.SendModify(DB)
+		// SendDelete when admin delete floor
+		err = floor.SendDelete(deleteReasonText(body.Category, body.Reason))
 		if err != nil {
-			log.Err(err).Str("model", "Notification").Msg("SendModify failed")
+			log.Err(err).Str("model", "Notification").Msg("SendDelete failed")
 			// return err // only for test
 		}
 	}
@@ -652,6 +820,7 @@ func DeleteFloor(c *fiber.Ctx) error {
 // ListReplyFloors
 //
 // @Summary List User's Reply Floors
+// @Description Deleted floors are included, with deleted as indicator
 // @Tags Floor
 // @Produce application/json
 // @Router /users/me/floors [get]
@@ -685,7 +854,7 @@ func ListReplyFloors(c *fiber.Ctx) error {
 		return result.Error
 	}
 
-	return Serialize(c, &floors)
+	return Serialize(c, &floors, SerializeOptions{Fields: query.Fields})
 }
 
 // GetFloorHistory
@@ -711,13 +880,13 @@ func GetFloorHistory(c *fiber.Ctx) error {
 
 	// permission
 	if !user.IsAdmin {
-		return common.Forbidden()
+		return NewError(ErrCodeAdminOnly, "仅管理员可操作")
 	}
 
 	var floor Floor
 	var histories []FloorHistory
 
-	err = DB.Transaction(func(tx *gorm.DB) (err error) {
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) (err error) {
 		err = tx.First(&floor, floorID).Error
 		if err != nil {
 			return
@@ -773,24 +942,24 @@ func RestoreFloor(c *fiber.Ctx) error {
 
 	// permission check
 	if !user.IsAdmin {
-		return common.Forbidden()
+		return NewError(ErrCodeAdminOnly, "仅管理员可操作")
 	}
 
 	var floor Floor
-	result := DB.First(&floor, floorID)
+	result := RequestDB(c).First(&floor, floorID)
 	if result.Error != nil {
 		return result.Error
 	}
 	var floorHistory FloorHistory
-	result = DB.First(&floorHistory, floorHistoryID)
+	result = RequestDB(c).First(&floorHistory, floorHistoryID)
 	if result.Error != nil {
 		return result.Error
 	}
 	if floorHistory.FloorID != floorID {
-		return common.BadRequest(fmt.Sprintf("%v 不是 #%v 的历史版本", floorHistoryID, floorID))
+		return NewError(ErrCodeNotFloorHistory, fmt.Sprintf("%v 不是 #%v 的历史版本", floorHistoryID, floorID))
 	}
 	reason := body.Reason
-	err = floor.Backup(DB, user.ID, reason)
+	err = floor.Backup(RequestDB(c), user.ID, reason)
 	if err != nil {
 		return err
 	}
@@ -799,13 +968,15 @@ func RestoreFloor(c *fiber.Ctx) error {
 	floor.IsSensitive = floorHistory.IsSensitive
 	floor.IsActualSensitive = floorHistory.IsActualSensitive
 	floor.SensitiveDetail = floorHistory.SensitiveDetail
-	DB.Save(&floor)
+	floor.Version += 1
+	RequestDB(c).Save(&floor)
 
-	go FloorIndex(FloorModel{
+	floorModel := FloorModel{
 		ID:        floor.ID,
 		UpdatedAt: time.Now(),
 		Content:   floor.Content,
-	})
+	}
+	Go(func() { FloorIndex(floorModel) })
 
 	// log
 	MyLog("Floor", "Restore", floorID, user.ID, RoleAdmin, reason)
@@ -835,12 +1006,12 @@ func GetPunishmentHistory(c *fiber.Ctx) error {
 
 	// permission, admin only
 	if !user.IsAdmin {
-		return common.Forbidden()
+		return NewError(ErrCodeAdminOnly, "仅管理员可操作")
 	}
 
 	// get floor userID
 	var floor Floor
-	result := DB.First(&floor, floorID)
+	result := RequestDB(c).First(&floor, floorID)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -848,7 +1019,7 @@ func GetPunishmentHistory(c *fiber.Ctx) error {
 
 	// search DB for user punishment history
 	punishments := make([]string, 0, 10)
-	err = DB.Raw(
+	err = RequestDB(c).Raw(
 		`SELECT f.content 
 FROM floor f
 WHERE f.id IN (
@@ -888,10 +1059,10 @@ func GetUserSilence(c *fiber.Ctx) error {
 
 	// permission, admin only
 	if !admin.IsAdmin {
-		return common.Forbidden()
+		return NewError(ErrCodeAdminOnly, "仅管理员可操作")
 	}
 	var floor Floor
-	result := DB.First(&floor, floorID)
+	result := RequestDB(c).First(&floor, floorID)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -934,12 +1105,12 @@ func ListSensitiveFloors(c *fiber.Ctx) (err error) {
 
 	// permission, admin only
 	if !user.IsAdmin {
-		return common.Forbidden()
+		return NewError(ErrCodeAdminOnly, "仅管理员可操作")
 	}
 
 	// get floors
 	var floors Floors
-	querySet := DB
+	querySet := RequestDB(c)
 	if query.All == true {
 		querySet = querySet.Where("is_sensitive = true")
 	} else {
@@ -1003,11 +1174,11 @@ func ModifyFloorSensitive(c *fiber.Ctx) (err error) {
 
 	// permission check
 	if !user.IsAdmin {
-		return common.Forbidden()
+		return NewError(ErrCodeAdminOnly, "仅管理员可操作")
 	}
 
 	var floor Floor
-	err = DB.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+	err = RequestDB(c).Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
 		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&floor, floorID).Error
 		if err != nil {
 			return err
@@ -1044,19 +1215,20 @@ func ModifyFloorSensitive(c *fiber.Ctx) (err error) {
 	}
 
 	// clear cache
-	err = DeleteCache(fmt.Sprintf("hole_%v", floor.HoleID))
+	err = DeleteHoleCache(RequestDB(c), floor.HoleID)
 	if err != nil {
 		return err
 	}
 
 	if floor.IsActualSensitive != nil && *floor.IsActualSensitive == false {
-		go FloorIndex(FloorModel{
+		floorModel := FloorModel{
 			ID:        floor.ID,
 			UpdatedAt: floor.UpdatedAt,
 			Content:   floor.Content,
-		})
+		}
+		Go(func() { FloorIndex(floorModel) })
 	} else {
-		go FloorDelete(floor.ID)
+		Go(func() { FloorDelete(floor.ID) })
 
 		MyLog("Floor", "Delete", floorID, user.ID, RoleAdmin, "reason: ", "sensitive")
 
@@ -0,0 +1,177 @@
+package floor
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// BatchModerateFloors
+//
+// @Summary Hide, fold, unfold or delete floors at once, moderator only
+// @Description All floors are modified in one transaction with one admin log, e.g. to clean a wave of spam.
+// @Description Floors not found or not allowed are skipped and reported in results, in the same order as ids.
+// @Tags Floor
+// @Accept application/json
+// @Produce application/json
+// @Router /admin/floors/batch [post]
+// @Param json body BatchModel true "json"
+// @Success 200 {array} BatchResult
+func BatchModerateFloors(c *fiber.Ctx) error {
+	var body BatchModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	if body.Reason == "" && body.Action == "fold" {
+		return common.BadRequest("折叠需要理由")
+	}
+	if body.Category == "" && body.Action == "delete" {
+		return common.BadRequest("请选择删除理由")
+	}
+
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	if !user.Can(PermissionModerateFloor, 0) && len(user.ModeratedDivisions()) == 0 {
+		return NewError(ErrCodePermissionDenied, "无权进行此操作")
+	}
+
+	floorIDs := make([]int, 0, len(body.IDs))
+	for _, id := range body.IDs {
+		if !slices.Contains(floorIDs, id) {
+			floorIDs = append(floorIDs, id)
+		}
+	}
+
+	results := make([]BatchResult, 0, len(floorIDs))
+	done := make(Floors, 0, len(floorIDs))
+	err = RequestDB(c).Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		var floors Floors
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Find(&floors, floorIDs).Error
+		if err != nil {
+			return err
+		}
+		holeIDs := make([]int, 0, len(floors))
+		for _, floor := range floors {
+			holeIDs = append(holeIDs, floor.HoleID)
+		}
+		var holes Holes
+		err = tx.Select("id", "division_id").Find(&holes, holeIDs).Error
+		if err != nil {
+			return err
+		}
+
+		for _, id := range floorIDs {
+			result := BatchResult{ID: id}
+			floorIndex := slices.IndexFunc(floors, func(floor *Floor) bool { return floor.ID == id })
+			holeIndex := -1
+			if floorIndex >= 0 {
+				holeIndex = slices.IndexFunc(holes, func(hole *Hole) bool { return hole.ID == floors[floorIndex].HoleID })
+			}
+			if holeIndex < 0 {
+				result.Message = Localize(c, "楼层不存在")
+				results = append(results, result)
+				continue
+			}
+			floor := floors[floorIndex]
+			if !user.Can(PermissionModerateFloor, holes[holeIndex].DivisionID) {
+				result.Message = Localize(c, "无权进行此操作")
+				results = append(results, result)
+				continue
+			}
+
+			switch body.Action {
+			case "hide", "delete":
+				if floor.Deleted {
+					result.Message = Localize(c, "该楼层已被删除")
+					results = append(results, result)
+					continue
+				}
+				if body.Action == "hide" {
+					isActualSensitive := true
+					floor.IsActualSensitive = &isActualSensitive
+					err = floor.Backup(tx, user.ID, "违反社区规范")
+					floor.Content = generateDeleteReason("违反社区规范", false)
+				} else {
+					err = floor.Backup(tx, user.ID, deleteReasonText(body.Category, body.Reason))
+					floor.Content = generateTombstone(body.Category)
+					floor.DeleteCategory = body.Category
+				}
+				if err != nil {
+					return err
+				}
+				floor.Deleted = true
+				err = tx.Model(floor).Select("Deleted", "Content", "DeleteCategory", "IsActualSensitive").Updates(floor).Error
+			case "fold", "unfold":
+				floor.Fold = body.Reason
+				if body.Action == "unfold" {
+					floor.Fold = ""
+				}
+				floor.Version += 1
+				err = tx.Model(floor).Select("Fold", "Version").Updates(floor).Error
+			}
+			if err != nil {
+				return err
+			}
+			result.Success = true
+			results = append(results, result)
+			done = append(done, floor)
+		}
+
+		doneIDs := make([]int, 0, len(done))
+		for _, floor := range done {
+			doneIDs = append(doneIDs, floor.ID)
+		}
+		CreateAdminLog(tx, AdminLogTypeBatchFloor, user.ID, Map{
+			"action":    body.Action,
+			"reason":    body.Reason,
+			"category":  body.Category,
+			"floor_ids": doneIDs,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	MyLog("Floor", "Batch", 0, user.ID, RoleAdmin, body.Action, " floors: ", fmt.Sprintf("%v", len(done)))
+	holeIDs := make([]int, 0, len(done))
+	for _, floor := range done {
+		holeIDs = append(holeIDs, floor.HoleID)
+	}
+	err = DeleteHoleCache(RequestDB(c), holeIDs...)
+	if err != nil {
+		return err
+	}
+	for _, floor := range done {
+		if floor.Deleted {
+			floorID := floor.ID
+			Go(func() { FloorDelete(floorID) })
+		}
+		// notify like ModifyFloor and DeleteFloor, not for sensitive floors like ModifyFloorSensitive
+		if body.Action == "hide" || floor.UserID == user.ID {
+			continue
+		}
+		if body.Action == "delete" {
+			err = floor.SendDelete(deleteReasonText(body.Category, body.Reason))
+		} else {
+			err = floor.SendModify(RequestDB(c))
+		}
+		if err != nil {
+			log.Err(err).Str("model", "Notification").Msg("notify author failed")
+		}
+	}
+
+	return c.JSON(results)
+}
@@ -0,0 +1,54 @@
+package floor
+
+import (
+	"crypto/hmac"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+
+	"treehole_next/config"
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// ImageReviewCallback
+//
+// @Summary Receive verdicts of images from the review provider
+// @Description Signed with IMAGE_REVIEW_SECRET like webhooks, see header X-Treehole-Signature.
+// @Description Floors with rejected images are folded, unknown images are skipped.
+// @Tags Floor
+// @Accept application/json
+// @Router /images/_review [post]
+// @Param json body ImageReviewModel true "json"
+// @Success 204
+// @Failure 401 {object} MessageModel
+func ImageReviewCallback(c *fiber.Ctx) error {
+	secret := config.Config.ImageReviewSecret
+	if secret == "" || !hmac.Equal([]byte(c.Get("X-Treehole-Signature")), []byte(SignWebhookPayload(secret, c.Body()))) {
+		return NewError(ErrCodeInvalidCallbackSignature, "回调签名无效")
+	}
+
+	var body ImageReviewModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	for _, result := range body.Results {
+		folded, err := SaveImageReview(result.URL, result.Status, result.Reason)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn().Str("url", result.URL).Msg("image review of unknown image")
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if folded > 0 {
+			log.Info().Str("url", result.URL).Int("floors", folded).Msg("floors with rejected image folded")
+		}
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
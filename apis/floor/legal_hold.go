@@ -0,0 +1,64 @@
+package floor
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"gorm.io/gorm"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// ModifyFloorLegalHold
+//
+// @Summary Place a floor under legal hold or release it, admin only
+// @Description Held floors are not purged by HOLE_PURGE_DAYS or user purges, nor deleted by their authors.
+// @Tags Floor
+// @Accept application/json
+// @Produce application/json
+// @Router /floors/{id}/_legal_hold [put]
+// @Param id path int true "id"
+// @Param json body LegalHoldModel true "json"
+// @Success 200 {object} models.Floor
+func ModifyFloorLegalHold(c *fiber.Ctx) error {
+	floorID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	var body LegalHoldModel
+	err = common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	// validation is skipped for empty body
+	if body.Hold == nil || body.Reason == "" {
+		return common.BadRequest("hold and reason are required")
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	var floor Floor
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Take(&floor, floorID).Error
+		if err != nil {
+			return err
+		}
+		err = floor.SetLegalHold(tx, *body.Hold)
+		if err != nil {
+			return err
+		}
+		CreateAdminLog(tx, AdminLogTypeLegalHold, user.ID, Map{
+			"floor_id": floor.ID,
+			"hole_id":  floor.HoleID,
+			"hold":     *body.Hold,
+			"reason":   body.Reason,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return Serialize(c, &floor)
+}
@@ -0,0 +1,27 @@
+package floor
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	. "treehole_next/models"
+)
+
+// SendLikeDigests notifies users of likes on their floors periodically, see LikeDigest
+func SendLikeDigests(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := FlushLikeDigests()
+			if err != nil {
+				log.Err(err).Msg("error send like digests")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package floor
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	. "treehole_next/models"
+)
+
+// MaintainFloorPartitions adds partitions of the floor table on startup and daily, see AddFloorPartitions
+func MaintainFloorPartitions(ctx context.Context) {
+	err := AddFloorPartitions()
+	if err != nil {
+		log.Err(err).Msg("error add floor partitions")
+	}
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err = AddFloorPartitions()
+			if err != nil {
+				log.Err(err).Msg("error add floor partitions")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
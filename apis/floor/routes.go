@@ -3,9 +3,15 @@ package floor
 import (
 	"github.com/gofiber/fiber/v2"
 
+	"treehole_next/models"
 	"treehole_next/utils"
 )
 
+// RegisterCallbackRoutes registers callbacks of external services, which are verified by signatures instead of login
+func RegisterCallbackRoutes(app fiber.Router) {
+	app.Post("/images/_review", ImageReviewCallback)
+}
+
 func RegisterRoutes(app fiber.Router) {
 	app.Post("/floors/search", SearchFloors)
 	app.Get("/floors/search", SearchFloors)
@@ -13,22 +19,32 @@ func RegisterRoutes(app fiber.Router) {
 	app.Get("/holes/:id<int>/floors", ListFloorsInAHole)
 	app.Get("/floors", ListFloorsOld)
 	app.Get("/floors/:id<int>", GetFloor)
-	app.Post("/holes/:id<int>/floors", utils.MiddlewareHasAnsweredQuestions, CreateFloor)
-	app.Post("/floors", utils.MiddlewareHasAnsweredQuestions, CreateFloorOld)
+	app.Post("/holes/:id<int>/floors", models.MiddlewareAPIKeyScope(models.ScopeFloorsWrite), utils.MiddlewareHasAnsweredQuestions, utils.MiddlewareIdempotency, CreateFloor)
+	app.Post("/floors", models.MiddlewareAPIKeyScope(models.ScopeFloorsWrite), utils.MiddlewareHasAnsweredQuestions, utils.MiddlewareIdempotency, CreateFloorOld)
 	app.Put("/floors/:id<int>", ModifyFloor)
 	app.Patch("/floors/:id<int>/_webvpn", ModifyFloor)
 	app.Post("/floors/:id<int>/like/:like<int>", ModifyFloorLike)
+	app.Post("/floors/:id<int>/like/:like<int>/_toggle", ToggleFloorLike)
 	app.Delete("/floors/:id<int>", DeleteFloor)
+	app.Put("/floors/:id<int>/_legal_hold", models.MiddlewarePermission(models.PermissionLegalHold), ModifyFloorLegalHold)
 
 	app.Get("/users/me/floors", ListReplyFloors)
 
+	app.Get("/floors/:id<int>/translation", GetFloorTranslation)
 	app.Get("/floors/:id<int>/history", GetFloorHistory)
 	app.Post("/floors/:id<int>/restore/:floor_history_id<int>", RestoreFloor)
 
 	app.Post("/config/search", SearchConfig)
+	app.Put("/config/search/synonyms", models.MiddlewarePermission(models.PermissionManageSearch), UpdateSearchSynonyms)
+	app.Get("/user/saved_searches", ListSavedSearches)
+	app.Post("/user/saved_searches", utils.MiddlewareIdempotency, AddSavedSearch)
+	app.Put("/user/saved_searches/:id<int>", ModifySavedSearch)
+	app.Delete("/user/saved_searches/:id<int>", DeleteSavedSearch)
 	app.Get("/floors/:id<int>/punishment", GetPunishmentHistory)
 	app.Get("/floors/:id<int>/user_silence", GetUserSilence)
 
+	app.Post("/admin/floors/batch", BatchModerateFloors)
+
 	app.Get("/floors/_sensitive", ListSensitiveFloors)
 	app.Put("/floors/:id<int>/_sensitive", ModifyFloorSensitive)
 	app.Patch("/floors/:id<int>/_sensitive/_webvpn", ModifyFloorSensitive)
@@ -0,0 +1,159 @@
+package floor
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+
+	. "treehole_next/models"
+)
+
+// ListSavedSearches
+//
+// @Summary List saved searches of current user
+// @Tags Search
+// @Produce application/json
+// @Router /user/saved_searches [get]
+// @Success 200 {array} models.SavedSearch
+func ListSavedSearches(c *fiber.Ctx) error {
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+	savedSearches := make(SavedSearches, 0)
+	err = RequestDB(c).Where("user_id = ?", userID).Order("id").Find(&savedSearches).Error
+	if err != nil {
+		return err
+	}
+	return c.JSON(savedSearches)
+}
+
+// AddSavedSearch
+//
+// @Summary Save a search, new floors matching it are notified
+// @Description Floors posted before saving are not notified. Alerts are sent at most once in the frequency.
+// @Tags Search
+// @Accept application/json
+// @Produce application/json
+// @Router /user/saved_searches [post]
+// @Param json body SavedSearchModel true "json"
+// @Success 201 {object} models.SavedSearch
+func AddSavedSearch(c *fiber.Ctx) error {
+	var body SavedSearchModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	savedSearch := SavedSearch{
+		UserID:    userID,
+		TenantID:  GetTenant(c).ID,
+		Search:    body.Search,
+		Accurate:  body.Accurate,
+		Frequency: body.Frequency,
+		Notify:    true,
+	}
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
+		return NewSavedSearch(tx, &savedSearch)
+	})
+	if err != nil {
+		return err
+	}
+	return c.Status(201).JSON(&savedSearch)
+}
+
+// ModifySavedSearch
+//
+// @Summary Modify frequency of a saved search, or pause its alerts
+// @Tags Search
+// @Accept application/json
+// @Produce application/json
+// @Router /user/saved_searches/{id} [put]
+// @Param id path int true "id"
+// @Param json body ModifySavedSearchModel true "json"
+// @Success 200 {object} models.SavedSearch
+// @Failure 404 {object} common.HttpError
+func ModifySavedSearch(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	var body ModifySavedSearchModel
+	err = common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var savedSearch SavedSearch
+	err = RequestDB(c).Where("user_id = ?", userID).Take(&savedSearch, id).Error
+	if err != nil {
+		return err
+	}
+	if body.Frequency != nil {
+		savedSearch.Frequency = *body.Frequency
+	}
+	if body.Notify != nil {
+		savedSearch.Notify = *body.Notify
+	}
+	err = RequestDB(c).Model(&savedSearch).Select("Frequency", "Notify").Updates(&savedSearch).Error
+	if err != nil {
+		return err
+	}
+	return c.JSON(&savedSearch)
+}
+
+// DeleteSavedSearch
+//
+// @Summary Delete a saved search, which unsubscribes its alerts
+// @Tags Search
+// @Router /user/saved_searches/{id} [delete]
+// @Param id path int true "id"
+// @Success 204
+// @Failure 404 {object} common.HttpError
+func DeleteSavedSearch(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+	result := RequestDB(c).Where("user_id = ?", userID).Delete(&SavedSearch{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return c.SendStatus(204)
+}
+
+// SendSavedSearchAlerts notifies users of new floors matching their saved searches, see FlushSavedSearches
+func SendSavedSearchAlerts(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := FlushSavedSearches(time.Now())
+			if err != nil {
+				log.Err(err).Msg("error send saved search alerts")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
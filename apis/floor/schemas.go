@@ -3,9 +3,11 @@ package floor
 import (
 	"time"
 
+	"github.com/gofiber/fiber/v2"
 	"github.com/opentreehole/go-common"
 
 	"treehole_next/models"
+	"treehole_next/utils"
 )
 
 type ListModel struct {
@@ -13,6 +15,18 @@ type ListModel struct {
 	Offset  int    `json:"offset" query:"offset" default:"0" validate:"min=0"`              // offset of object array
 	Sort    string `json:"sort" query:"sort" default:"asc" validate:"oneof=asc desc"`       // Sort order
 	OrderBy string `json:"order_by" query:"order_by" default:"id" validate:"oneof=id like"` // SQL ORDER BY field
+	Fields  string `json:"fields" query:"fields"`                                           // comma separated fields to return, empty means all
+}
+
+type ListInAHoleModel struct {
+	ListModel
+	// order by ranking with keyset pagination, offset counts from the last floor if desc; overrides sort and order_by.
+	// like returns the top liked floors with at least HOT_FLOOR_MIN_LIKES likes, ignores offset
+	Order string `json:"order" query:"order" validate:"omitempty,oneof=asc desc like"`
+	// jump to the floor with surrounding floors in ascending order, ignores offset
+	AroundFloorID int `json:"around_floor_id" query:"around_floor_id" validate:"min=0"`
+	// only floors posted by the anonyname, 洞主 for the poster of the hole
+	Poster string `json:"poster" query:"poster" validate:"max=32"`
 }
 
 type ListOldModel struct {
@@ -20,6 +34,7 @@ type ListOldModel struct {
 	Size   int    `query:"length"      json:"length"     validate:"min=0,max=50" `
 	Offset int    `query:"start_floor" json:"start_floor"`
 	Search string `query:"s"           json:"s"`
+	Fields string `query:"fields"      json:"fields"`
 }
 
 type CreateModel struct {
@@ -28,6 +43,10 @@ type CreateModel struct {
 	SpecialTag string `json:"special_tag" validate:"omitempty,max=16"`
 	// id of the floor to which replied
 	ReplyTo int `json:"reply_to" validate:"min=0"`
+	// collapse the floor by default as a spoiler
+	Spoiler bool `json:"spoiler"`
+	// collapse the floor by default behind the warning
+	ContentWarning string `json:"content_warning" validate:"max=32"`
 }
 
 type CreateOldModel struct {
@@ -51,45 +70,109 @@ type ModifyModel struct {
 	Fold *string `json:"fold_v2" validate:"omitempty,max=64"`
 	// 仅管理员，留空则重置，低优先级
 	FoldFrontend []string `json:"fold" validate:"omitempty"`
+	// Owner or admin, false to unmark
+	Spoiler *bool `json:"spoiler"`
+	// Owner or admin, empty to remove
+	ContentWarning *string `json:"content_warning" validate:"omitempty,max=32"`
+	// the version of floor the edit is based on, 409 if the floor has been edited since.
+	// Omit to overwrite regardless of version.
+	Version *int `json:"version" validate:"omitempty,min=0"`
+}
+
+// Edits returns true if the body edits content, fold, special tag or content warning, which increases floor.Version
+func (body ModifyModel) Edits() bool {
+	return (body.Content != nil && *body.Content != "") ||
+		body.Fold != nil || body.FoldFrontend != nil || body.SpecialTag != nil ||
+		body.Spoiler != nil || body.ContentWarning != nil
+}
+
+// ConflictResponse is returned with 409 if the floor has been edited since body.Version
+type ConflictResponse struct {
+	Message string `json:"message"`
+	// the current version of floor
+	Version int `json:"version"`
+	// the current floor
+	Floor *models.Floor `json:"floor"`
+}
+
+func (r *ConflictResponse) Preprocess(c *fiber.Ctx) error {
+	return r.Floor.Preprocess(c)
 }
 
 func (body ModifyModel) DoNothing() bool {
-	return body.Content == nil && body.SpecialTag == nil && body.Like == nil && body.Fold == nil && body.FoldFrontend == nil
+	return body.Content == nil && body.SpecialTag == nil && body.Like == nil && body.Fold == nil && body.FoldFrontend == nil &&
+		body.Spoiler == nil && body.ContentWarning == nil
 }
 
 func (body ModifyModel) CheckPermission(user *models.User, floor *models.Floor, hole *models.Hole) error {
 	if body.Content != nil {
 		if !user.IsAdmin {
 			if user.ID != floor.UserID {
-				return common.Forbidden("这不是您的楼层，您没有权限修改")
+				return utils.NewError(utils.ErrCodeNotFloorOwner, "这不是您的楼层，您没有权限修改")
 			} else {
 				if user.BanDivision[hole.DivisionID] != nil {
-					return common.Forbidden(user.BanDivisionMessage(hole.DivisionID))
+					return utils.NewError(utils.ErrCodeBannedInDivision, user.BanDivisionMessage(hole.DivisionID))
 				} else if hole.Locked {
-					return common.Forbidden("此洞已被锁定，您无法修改")
+					return utils.NewError(utils.ErrCodeHoleLocked, "此洞已被锁定，您无法修改")
 				} else if floor.Deleted {
-					return common.Forbidden("此洞已被删除，您无法修改")
+					return utils.NewError(utils.ErrCodeHoleDeleted, "此洞已被删除，您无法修改")
 				}
 			}
 		} else {
 			if user.BanDivision[hole.DivisionID] != nil {
-				return common.Forbidden(user.BanDivisionMessage(hole.DivisionID))
+				return utils.NewError(utils.ErrCodeBannedInDivision, user.BanDivisionMessage(hole.DivisionID))
 			}
 		}
 	}
-	if (body.Fold != nil || body.FoldFrontend != nil) && !user.IsAdmin {
-		return common.Forbidden("非管理员禁止折叠")
+	if (body.Spoiler != nil || body.ContentWarning != nil) && !user.IsAdmin && user.ID != floor.UserID {
+		return utils.NewError(utils.ErrCodeNotFloorOwner, "这不是您的楼层，您没有权限修改")
+	}
+	if (body.Fold != nil || body.FoldFrontend != nil) && !user.Can(models.PermissionModerateFloor, hole.DivisionID) {
+		return utils.NewError(utils.ErrCodeAdminOnly, "非管理员禁止折叠")
 	}
 	if body.SpecialTag != nil && !user.IsAdmin {
-		return common.Forbidden("非管理员禁止修改特殊标签")
+		return utils.NewError(utils.ErrCodeSpecialTagAdminOnly, "非管理员禁止修改特殊标签")
 	}
 	return nil
 }
 
 type DeleteModel struct {
+	// why moderators delete the floor, see ReportCategories, required unless deleted by the author
+	Category string `json:"delete_category" validate:"omitempty,oneof=spam abuse porn illegal privacy misinformation other"`
+	// note to the author, or the reason shown if deleted by the author
 	Reason string `json:"delete_reason" validate:"max=32"`
 }
 
+type BatchModel struct {
+	// ids of floors, no more than 100
+	IDs []int `json:"ids" validate:"required,min=1,max=100,dive,min=1"`
+	// hide: delete as sensitive; fold and unfold: change fold reason; delete: delete with reason
+	Action string `json:"action" validate:"required,oneof=hide fold unfold delete"`
+	// fold reason required by fold, or note to authors of delete
+	Reason string `json:"reason" validate:"max=32"`
+	// why floors are deleted, see ReportCategories, required by delete
+	Category string `json:"category" validate:"omitempty,oneof=spam abuse porn illegal privacy misinformation other"`
+}
+
+// BatchResult is the result of the action on a floor
+type BatchResult struct {
+	ID      int  `json:"id"`
+	Success bool `json:"success"`
+	// why the action is not done, e.g. floor not found
+	Message string `json:"message,omitempty"`
+}
+
+type ImageReviewModel struct {
+	Results []ImageReviewResult `json:"results" validate:"required,min=1,max=100,dive"`
+}
+
+type ImageReviewResult struct {
+	URL    string `json:"url" validate:"required,max=512"`
+	Status string `json:"status" validate:"required,oneof=approved rejected"`
+	// shown to moderators
+	Reason string `json:"reason" validate:"max=64"`
+}
+
 type RestoreModel struct {
 	Reason string `json:"restore_reason" validate:"required,max=32"`
 }
@@ -98,6 +181,32 @@ type SearchConfigModel struct {
 	Open bool `json:"open"`
 }
 
+type SavedSearchModel struct {
+	Search   string `json:"search" validate:"required,max=64"`
+	Accurate bool   `json:"accurate"`
+	// alerts are sent at most once in the frequency
+	Frequency string `json:"frequency" default:"daily" validate:"oneof=hourly daily weekly"`
+}
+
+type ModifySavedSearchModel struct {
+	Frequency *string `json:"frequency" validate:"omitempty,oneof=hourly daily weekly"`
+	// false to pause alerts
+	Notify *bool `json:"notify"`
+}
+
+type SynonymsModel struct {
+	// rules in solr format, e.g. "旦夕, fdu" or "复旦 => 旦夕", must be empty if synonyms are read from a file
+	Synonyms []string `json:"synonyms" validate:"max=10000,dive,min=1"`
+	// analyze existing floors again in background, not needed for synonyms which are applied at search time
+	Reanalyze bool `json:"reanalyze"`
+}
+
+type SynonymsResponse struct {
+	Message string `json:"message"`
+	// elasticsearch task of reanalyzing, empty if not requested
+	TaskID string `json:"task_id,omitempty"`
+}
+
 type SensitiveFloorRequest struct {
 	Size    int               `json:"size" query:"size" default:"10" validate:"max=10"`
 	Offset  common.CustomTime `json:"offset" query:"offset" swaggertype:"string"`
@@ -136,3 +245,21 @@ type ModifySensitiveFloorRequest struct {
 }
 
 type BanDivision map[int]*time.Time
+
+type TranslationQuery struct {
+	// target language
+	Lang string `json:"lang" query:"lang" default:"en" validate:"oneof=en zh ja ko fr de es ru"`
+}
+
+type TranslationResponse struct {
+	FloorID int    `json:"floor_id"`
+	Lang    string `json:"lang"`
+	Content string `json:"content"`
+}
+
+type LegalHoldModel struct {
+	// place under legal hold or release
+	Hold *bool `json:"hold" validate:"required"`
+	// kept in the admin log
+	Reason string `json:"reason" validate:"required,max=1000"`
+}
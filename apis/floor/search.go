@@ -18,6 +18,9 @@ type SearchQuery struct {
 	// Accurate is used to determine whether to use accurate search
 	Accurate bool `json:"accurate" query:"accurate" default:"false"`
 
+	// Fuzzy tolerates typos and matches by pinyin if ELASTICSEARCH_PINYIN is set, ignored if accurate
+	Fuzzy bool `json:"fuzzy" query:"fuzzy" default:"false"`
+
 	// StartTime and EndTime are used to filter floors by time
 	// Both are Unix timestamps, and are optional
 	StartTime *int64 `json:"start_time" query:"start_time"`
@@ -40,7 +43,7 @@ func SearchFloors(c *fiber.Ctx) error {
 		return err
 	}
 
-	floors, err := Search(c, query.Search, query.Size, query.Offset, query.Accurate, query.StartTime, query.EndTime)
+	floors, err := Search(c, query.Search, query.Size, query.Offset, query.Accurate, query.Fuzzy, query.StartTime, query.EndTime)
 	if err != nil {
 		return err
 	}
@@ -67,22 +70,60 @@ func SearchConfig(c *fiber.Ctx) error {
 		return err
 	}
 	if !user.IsAdmin {
-		return common.Forbidden()
+		return NewError(ErrCodeAdminOnly, "仅管理员可操作")
 	}
 	if DynamicConfig.OpenSearch.Load() == body.Open {
-		return c.Status(200).JSON(Map{"message": "已经被修改"})
+		return c.Status(200).JSON(Map{"message": Localize(c, "已经被修改")})
 	} else {
 		DynamicConfig.OpenSearch.Store(body.Open)
-		return c.Status(201).JSON(Map{"message": "修改成功"})
+		return c.Status(201).JSON(Map{"message": Localize(c, "修改成功")})
+	}
+}
+
+// UpdateSearchSynonyms
+//
+// @Summary update synonyms of search, admin only
+// @Description Replace the synonyms set managed by elasticsearch, or reload the synonym file set by ELASTICSEARCH_SYNONYMS_PATH
+// @Description if synonyms is empty. Synonyms take effect on search immediately.
+// @Tags Search
+// @Accept application/json
+// @Produce application/json
+// @Router /config/search/synonyms [put]
+// @Param json body SynonymsModel true "json"
+// @Success 200 {object} SynonymsResponse
+func UpdateSearchSynonyms(c *fiber.Ctx) error {
+	var body SynonymsModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	if ES == nil {
+		return NewError(ErrCodeSearchUnavailable, "搜索服务未配置")
+	}
+	if Config.ElasticsearchSynonymsPath != "" && len(body.Synonyms) > 0 {
+		return NewError(ErrCodeInvalidRequest, "同义词由文件配置，请更新文件后重新加载")
+	}
+
+	err = UpdateSynonyms(c.Context(), body.Synonyms)
+	if err != nil {
+		return err
+	}
+	response := SynonymsResponse{Message: Localize(c, "修改成功")}
+	if body.Reanalyze {
+		response.TaskID, err = Reanalyze(c.Context())
+		if err != nil {
+			return err
+		}
 	}
+	return c.JSON(response)
 }
 
 func SearchFloorsOld(c *fiber.Ctx, query *ListOldModel) error {
-	if !DynamicConfig.OpenSearch.Load() {
-		return common.Forbidden("茶楼流量激增，搜索功能暂缓开放")
+	if !GetTenant(c).OpenSearch() {
+		return NewError(ErrCodeSearchUnavailable, "茶楼流量激增，搜索功能暂缓开放")
 	}
 
-	floors, err := Search(c, query.Search, query.Size, query.Offset, false, nil, nil)
+	floors, err := Search(c, query.Search, query.Size, query.Offset, false, false, nil, nil)
 	if err != nil {
 		return err
 	}
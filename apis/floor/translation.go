@@ -0,0 +1,75 @@
+package floor
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+
+	"treehole_next/config"
+	. "treehole_next/models"
+	"treehole_next/utils"
+)
+
+// GetFloorTranslation
+//
+// @Summary Translate A Floor
+// @Description Translate the content of a floor by the translation backend, cached until the floor is modified.
+// @Tags Floor
+// @Produce application/json
+// @Router /floors/{id}/translation [get]
+// @Param id path int true "id"
+// @Param object query TranslationQuery false "query"
+// @Success 200 {object} TranslationResponse
+// @Failure 404 {object} MessageModel
+// @Failure 502 {object} MessageModel
+// @Failure 503 {object} MessageModel
+func GetFloorTranslation(c *fiber.Ctx) error {
+	floorID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	var query TranslationQuery
+	err = common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+	if config.Config.TranslationUrl == "" {
+		return &common.HttpError{Code: fiber.StatusServiceUnavailable, Message: "翻译功能未开启"}
+	}
+
+	var floor Floor
+	querySet, err := MakeFloorQuerySet(c)
+	if err != nil {
+		return err
+	}
+	err = querySet.First(&floor, floorID).Error
+	if err != nil {
+		return err
+	}
+
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	if !user.IsAdmin {
+		var hole Hole
+		querySet, err := WhereVisibleDivisions(RequestDB(c).Where("hidden = false"), user)
+		if err != nil {
+			return err
+		}
+		err = querySet.First(&hole, floor.HoleID).Error
+		if err != nil {
+			return err
+		}
+	}
+	if floor.Deleted || floor.Sensitive() {
+		return utils.NewError(utils.ErrCodeContentNotTranslatable, "该内容无法翻译")
+	}
+
+	content, err := floor.Translate(c.UserContext(), query.Lang)
+	if err != nil {
+		log.Err(err).Int("floor_id", floor.ID).Str("lang", query.Lang).Msg("translate floor failed")
+		return &common.HttpError{Code: fiber.StatusBadGateway, Message: "翻译失败，请稍后再试"}
+	}
+	return c.JSON(TranslationResponse{FloorID: floor.ID, Lang: query.Lang, Content: content})
+}
@@ -1,6 +1,13 @@
 package floor
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+
+	"treehole_next/config"
+	. "treehole_next/models"
+)
 
 func generateDeleteReason(reason string, isOwner bool) string {
 	if reason == "" {
@@ -11,3 +18,73 @@ func generateDeleteReason(reason string, isOwner bool) string {
 	}
 	return fmt.Sprintf("该内容因%s被删除", reason)
 }
+
+// generateTombstone is the content of a floor deleted by moderators, the note is only shown to the author
+func generateTombstone(category string) string {
+	return fmt.Sprintf("该内容因%s被移除", ReportCategories[category])
+}
+
+// deleteReasonText is the category name with the note, kept in history and sent to the author
+func deleteReasonText(category, note string) string {
+	if note == "" {
+		return ReportCategories[category]
+	}
+	return ReportCategories[category] + "：" + note
+}
+
+// checkHoleVisible returns ErrRecordNotFound if the hole is in another tenant or not visible to the user, see MakeHoleQuerySet
+func checkHoleVisible(c *fiber.Ctx, holeID int) error {
+	querySet, err := MakeHoleQuerySet(c)
+	if err != nil {
+		return err
+	}
+	return querySet.Select("id").Take(&Hole{}, holeID).Error
+}
+
+// listFloorsByRanking lists floors with keyset pagination on (hole_id, ranking) instead of sql offset
+func listFloorsByRanking(c *fiber.Ctx, holeID int, query *ListInAHoleModel) (floors Floors, err error) {
+	querySet, err := floors.MakeQuerySet(&holeID, nil, &query.Size, c)
+	if err != nil {
+		return nil, err
+	}
+	querySet = querySet.Scopes(PosterScope(holeID, query.Poster))
+
+	if query.AroundFloorID != 0 {
+		var floor Floor
+		err = RequestDB(c).Select("ranking").Where("hole_id = ?", holeID).Take(&floor, query.AroundFloorID).Error
+		if err != nil {
+			return nil, err
+		}
+		start := floor.Ranking - query.Size/2
+		if start < 0 {
+			start = 0
+		}
+		err = querySet.Where("ranking >= ?", start).Order("ranking asc").Find(&floors).Error
+		return floors, err
+	}
+
+	if query.Order == "desc" {
+		var maxRanking int
+		err = RequestDB(c).Model(&Floor{}).Select("coalesce(max(ranking), -1)").Where("hole_id = ?", holeID).Scan(&maxRanking).Error
+		if err != nil {
+			return nil, err
+		}
+		err = querySet.Where("ranking <= ?", maxRanking-query.Offset).Order("ranking desc").Find(&floors).Error
+		return floors, err
+	}
+
+	err = querySet.Where("ranking >= ?", query.Offset).Order("ranking asc").Find(&floors).Error
+	return floors, err
+}
+
+// listHotFloors returns the top liked floors of the hole as hot comments, deleted floors are excluded
+func listHotFloors(c *fiber.Ctx, holeID int, query *ListInAHoleModel) (floors Floors, err error) {
+	querySet, err := floors.MakeQuerySet(&holeID, nil, &query.Size, c)
+	if err != nil {
+		return nil, err
+	}
+	querySet = querySet.Scopes(PosterScope(holeID, query.Poster))
+	err = querySet.Where("deleted = ? AND "+Quote("like")+" >= ?", false, config.Config.HotFloorMinLikes).
+		Order(Quote("like") + " desc, ranking asc").Find(&floors).Error
+	return floors, err
+}
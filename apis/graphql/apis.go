@@ -0,0 +1,85 @@
+// Package graphql serves a read-only graph of divisions, holes, floors, tags and favorites,
+// so that clients can fetch a hole with its floors and tags in one round trip.
+package graphql
+
+import (
+	"fmt"
+
+	"github.com/goccy/go-json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+)
+
+// QueryGraph
+//
+// @Summary GraphQL Query
+// @Description Read-only GraphQL endpoint. Root fields: divisions, division(id), holes(division_id, offset, size, order),
+// @Description hole(id), floor(id), tags(search, offset, first), tag(name), favorites(group_id).
+// @Description Hole.floors(offset, size) is loaded by ranking for all holes in one query.
+// @Description Queries are at most 5 levels deep.
+// @Description Fragments, directives and mutations are not supported.
+// @Tags GraphQL
+// @Accept application/json
+// @Produce application/json
+// @Router /graphql [post]
+// @Router /graphql [get]
+// @Param json body QueryModel true "json"
+// @Success 200 {object} ResponseModel
+func QueryGraph(c *fiber.Ctx) error {
+	var body QueryModel
+	if c.Method() == fiber.MethodGet {
+		err := common.ValidateQuery(c, &body)
+		if err != nil {
+			return err
+		}
+		if variables := c.Query("variables"); variables != "" {
+			err = json.Unmarshal([]byte(variables), &body.Variables)
+			if err != nil {
+				return common.BadRequest("variables should be a json object")
+			}
+		}
+	} else {
+		err := common.ValidateBody(c, &body)
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err := executeQuery(c, &body)
+	if err != nil {
+		return c.JSON(ResponseModel{Errors: []ErrorModel{{Message: err.Error()}}})
+	}
+	return c.JSON(ResponseModel{Data: data})
+}
+
+func executeQuery(c *fiber.Ctx, body *QueryModel) (map[string]any, error) {
+	operations, err := parse(body.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	var op *operation
+	if body.OperationName == "" {
+		if len(operations) > 1 {
+			return nil, fmt.Errorf("operationName is required for multiple operations")
+		}
+		op = operations[0]
+	} else {
+		for _, o := range operations {
+			if o.Name == body.OperationName {
+				op = o
+				break
+			}
+		}
+		if op == nil {
+			return nil, fmt.Errorf("unknown operation %q", body.OperationName)
+		}
+	}
+
+	e := executor{
+		c:         c,
+		schema:    graphSchema,
+		variables: body.Variables,
+	}
+	return e.execute(op)
+}
@@ -0,0 +1,247 @@
+package graphql
+
+import (
+	"fmt"
+
+	"github.com/goccy/go-json"
+	"github.com/gofiber/fiber/v2"
+)
+
+// object is a resolved graph node: the model it comes from, and its serialized fields
+type object struct {
+	model  any
+	fields map[string]any
+}
+
+// newObjects serializes preprocessed models into objects
+func newObjects[T any](models []*T) ([]*object, error) {
+	objects := make([]*object, len(models))
+	for i, model := range models {
+		data, err := json.Marshal(model)
+		if err != nil {
+			return nil, err
+		}
+		objects[i] = &object{model: model}
+		err = json.Unmarshal(data, &objects[i].fields)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return objects, nil
+}
+
+// resolver loads a field for all parents at once, which batches the database queries
+// of a whole level of the graph into one, like a dataloader.
+// The i-th result belongs to parents[i] and must be nil, *object or []*object.
+type resolver func(c *fiber.Ctx, parents []*object, args arguments) ([]any, error)
+
+type field struct {
+	// name of the object type, empty for scalar fields
+	Type string
+
+	// whether the field is a list of objects
+	List bool
+
+	// nil means reading the serialized field of parent
+	Resolve resolver
+}
+
+type objectType struct {
+	Name   string
+	Fields map[string]*field
+}
+
+type schema map[string]*objectType
+
+type executor struct {
+	c         *fiber.Ctx
+	schema    schema
+	variables map[string]any
+}
+
+// maxQueryDepth limits nested selections, each level of which may multiply the objects loaded,
+// e.g. { holes { floors { hole { floors { id } } } } } is 5 levels deep
+const maxQueryDepth = 5
+
+// depth returns levels of nested selections
+func depth(selections []*selection) int {
+	result := 0
+	for _, sel := range selections {
+		result = max(result, 1+depth(sel.Selections))
+	}
+	return result
+}
+
+func (e *executor) execute(op *operation) (map[string]any, error) {
+	if depth(op.Selections) > maxQueryDepth {
+		return nil, fmt.Errorf("query is deeper than %d levels", maxQueryDepth)
+	}
+	root := &object{fields: map[string]any{}}
+	results, err := e.executeSelections(e.schema["Query"], []*object{root}, op.Selections)
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+func (e *executor) executeSelections(t *objectType, parents []*object, selections []*selection) ([]map[string]any, error) {
+	results := make([]map[string]any, len(parents))
+	for i := range results {
+		results[i] = make(map[string]any, len(selections))
+	}
+	if len(parents) == 0 {
+		return results, nil
+	}
+
+	for _, sel := range selections {
+		key := sel.key()
+		if sel.Name == "__typename" {
+			for i := range results {
+				results[i][key] = t.Name
+			}
+			continue
+		}
+
+		f, ok := t.Fields[sel.Name]
+		if !ok {
+			return nil, fmt.Errorf("cannot query field %q on type %q", sel.Name, t.Name)
+		}
+
+		// scalar fields
+		if f.Type == "" {
+			if sel.Selections != nil {
+				return nil, fmt.Errorf("field %q of type %q must not have a selection", sel.Name, t.Name)
+			}
+			for i, parent := range parents {
+				results[i][key] = parent.fields[sel.Name]
+			}
+			continue
+		}
+
+		if sel.Selections == nil {
+			return nil, fmt.Errorf("field %q of type %q must have a selection", sel.Name, t.Name)
+		}
+
+		// object fields
+		args := make(arguments, len(sel.Arguments))
+		for name, v := range sel.Arguments {
+			args[name] = v.resolve(e.variables)
+		}
+		var values []any
+		if f.Resolve != nil {
+			var err error
+			values, err = f.Resolve(e.c, parents, args)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			values = make([]any, len(parents))
+			for i, parent := range parents {
+				values[i] = parent.fields[sel.Name]
+			}
+		}
+
+		err := e.executeChildren(f, values, sel, func(i int, v any) {
+			results[i][key] = v
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// executeChildren flattens children of all parents, executes their selections together
+// and puts the results back to parents
+func (e *executor) executeChildren(f *field, values []any, sel *selection, set func(int, any)) error {
+	childType, ok := e.schema[f.Type]
+	if !ok {
+		return fmt.Errorf("unknown type %q", f.Type)
+	}
+
+	var children []*object
+	counts := make([]int, len(values))
+	for i, v := range values {
+		switch v := v.(type) {
+		case *object:
+			children = append(children, v)
+			counts[i] = 1
+		case []*object:
+			children = append(children, v...)
+			counts[i] = len(v)
+		case map[string]any:
+			// nested object in serialized fields
+			children = append(children, &object{fields: v})
+			counts[i] = 1
+		case []any:
+			for _, item := range v {
+				if m, ok := item.(map[string]any); ok {
+					children = append(children, &object{fields: m})
+					counts[i]++
+				}
+			}
+		case nil:
+		default:
+			return fmt.Errorf("invalid value of field %q", sel.Name)
+		}
+	}
+
+	childResults, err := e.executeSelections(childType, children, sel.Selections)
+	if err != nil {
+		return err
+	}
+
+	offset := 0
+	for i, count := range counts {
+		if f.List {
+			list := make([]map[string]any, 0, count)
+			list = append(list, childResults[offset:offset+count]...)
+			set(i, list)
+		} else if count > 0 {
+			set(i, childResults[offset])
+		} else {
+			set(i, nil)
+		}
+		offset += count
+	}
+	return nil
+}
+
+type arguments map[string]any
+
+func (args arguments) Int(name string, defaultValue int) (int, error) {
+	v, ok := args[name]
+	if !ok || v == nil {
+		return defaultValue, nil
+	}
+	switch v := v.(type) {
+	case int:
+		return v, nil
+	case float64:
+		// numbers in variables are decoded as float64
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	}
+	return 0, fmt.Errorf("argument %q must be Int", name)
+}
+
+func (args arguments) String(name string, defaultValue string) (string, error) {
+	v, ok := args[name]
+	if !ok || v == nil {
+		return defaultValue, nil
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	return "", fmt.Errorf("argument %q must be String", name)
+}
+
+// IntPtr returns nil if argument is not given
+func (args arguments) IntPtr(name string) (*int, error) {
+	if v, ok := args[name]; !ok || v == nil {
+		return nil, nil
+	}
+	i, err := args.Int(name, 0)
+	return &i, err
+}
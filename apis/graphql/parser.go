@@ -0,0 +1,414 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// a small parser for the read-only subset of GraphQL we serve:
+// query operations with variables, aliases, arguments and nested selections.
+// fragments, directives, mutations and subscriptions are not supported.
+
+type selection struct {
+	Alias      string
+	Name       string
+	Arguments  map[string]value
+	Selections []*selection
+}
+
+func (s *selection) key() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+	return s.Name
+}
+
+type operation struct {
+	Name       string
+	Selections []*selection
+}
+
+// value is an argument literal, or a variable reference
+type value struct {
+	Variable string
+	Literal  any
+}
+
+func (v value) resolve(variables map[string]any) any {
+	if v.Variable != "" {
+		return variables[v.Variable]
+	}
+	if list, ok := v.Literal.([]value); ok {
+		result := make([]any, len(list))
+		for i := range list {
+			result[i] = list[i].resolve(variables)
+		}
+		return result
+	}
+	return v.Literal
+}
+
+const (
+	tokenEOF = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind int
+	text string
+}
+
+type parser struct {
+	source string
+	pos    int
+	tok    token
+}
+
+func parse(source string) ([]*operation, error) {
+	p := &parser{source: source}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	var operations []*operation
+	for p.tok.kind != tokenEOF {
+		op, err := p.parseOperation()
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, op)
+	}
+	if len(operations) == 0 {
+		return nil, fmt.Errorf("no operation found")
+	}
+	return operations, nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("syntax error at %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) next() error {
+	// skip ignored tokens: whitespace, commas and comments
+	for p.pos < len(p.source) {
+		ch := p.source[p.pos]
+		if ch == '#' {
+			for p.pos < len(p.source) && p.source[p.pos] != '\n' {
+				p.pos++
+			}
+		} else if ch == ',' || ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' {
+			p.pos++
+		} else {
+			break
+		}
+	}
+	if p.pos >= len(p.source) {
+		p.tok = token{kind: tokenEOF}
+		return nil
+	}
+
+	start := p.pos
+	ch := p.source[p.pos]
+	switch {
+	case strings.ContainsRune("{}()[]:!$=@|&", rune(ch)):
+		p.pos++
+		p.tok = token{kind: tokenPunct, text: string(ch)}
+	case ch == '.':
+		if !strings.HasPrefix(p.source[p.pos:], "...") {
+			return p.errorf("unexpected character %q", ch)
+		}
+		p.pos += 3
+		p.tok = token{kind: tokenPunct, text: "..."}
+	case ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z'):
+		for p.pos < len(p.source) && (p.source[p.pos] == '_' || isAlphaNum(p.source[p.pos])) {
+			p.pos++
+		}
+		p.tok = token{kind: tokenName, text: p.source[start:p.pos]}
+	case ch == '-' || (ch >= '0' && ch <= '9'):
+		p.pos++
+		kind := tokenInt
+		for p.pos < len(p.source) {
+			c := p.source[p.pos]
+			if c == '.' || c == 'e' || c == 'E' || c == '+' || c == '-' {
+				kind = tokenFloat
+			} else if c < '0' || c > '9' {
+				break
+			}
+			p.pos++
+		}
+		p.tok = token{kind: kind, text: p.source[start:p.pos]}
+	case ch == '"':
+		p.pos++
+		var builder strings.Builder
+		for {
+			if p.pos >= len(p.source) || p.source[p.pos] == '\n' {
+				return p.errorf("unterminated string")
+			}
+			c := p.source[p.pos]
+			if c == '"' {
+				p.pos++
+				break
+			}
+			if c == '\\' && p.pos+1 < len(p.source) {
+				p.pos++
+				switch p.source[p.pos] {
+				case 'n':
+					builder.WriteByte('\n')
+				case 't':
+					builder.WriteByte('\t')
+				case 'r':
+					builder.WriteByte('\r')
+				case 'b':
+					builder.WriteByte('\b')
+				case 'f':
+					builder.WriteByte('\f')
+				case 'u':
+					if p.pos+4 >= len(p.source) {
+						return p.errorf("invalid unicode escape")
+					}
+					code, err := strconv.ParseUint(p.source[p.pos+1:p.pos+5], 16, 32)
+					if err != nil {
+						return p.errorf("invalid unicode escape")
+					}
+					builder.WriteRune(rune(code))
+					p.pos += 4
+				default:
+					builder.WriteByte(p.source[p.pos])
+				}
+				p.pos++
+				continue
+			}
+			builder.WriteByte(c)
+			p.pos++
+		}
+		p.tok = token{kind: tokenString, text: builder.String()}
+	default:
+		return p.errorf("unexpected character %q", ch)
+	}
+	return nil
+}
+
+func isAlphaNum(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (p *parser) peek(text string) bool {
+	return p.tok.kind == tokenPunct && p.tok.text == text
+}
+
+func (p *parser) expect(text string) error {
+	if !p.peek(text) {
+		return p.errorf("expected %q, got %q", text, p.tok.text)
+	}
+	return p.next()
+}
+
+func (p *parser) expectName() (string, error) {
+	if p.tok.kind != tokenName {
+		return "", p.errorf("expected name, got %q", p.tok.text)
+	}
+	name := p.tok.text
+	return name, p.next()
+}
+
+func (p *parser) parseOperation() (*operation, error) {
+	op := &operation{}
+	if p.tok.kind == tokenName {
+		switch p.tok.text {
+		case "query":
+		case "mutation", "subscription":
+			return nil, fmt.Errorf("%s is not supported", p.tok.text)
+		case "fragment":
+			return nil, fmt.Errorf("fragment is not supported")
+		default:
+			return nil, p.errorf("unexpected %q", p.tok.text)
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == tokenName {
+			op.Name = p.tok.text
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+		if p.peek("(") {
+			if err := p.skipVariableDefinitions(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	selections, err := p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.Selections = selections
+	return op, nil
+}
+
+// skipVariableDefinitions skips variable definitions, variables are typed by the resolvers
+func (p *parser) skipVariableDefinitions() error {
+	depth := 0
+	for {
+		if p.tok.kind == tokenEOF {
+			return p.errorf("unterminated variable definitions")
+		}
+		if p.peek("(") {
+			depth++
+		} else if p.peek(")") {
+			depth--
+		}
+		if err := p.next(); err != nil {
+			return err
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+func (p *parser) parseSelectionSet() ([]*selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var selections []*selection
+	for !p.peek("}") {
+		if p.tok.kind == tokenEOF {
+			return nil, p.errorf("unterminated selection set")
+		}
+		if p.peek("...") {
+			return nil, fmt.Errorf("fragment is not supported")
+		}
+		if p.peek("@") {
+			return nil, fmt.Errorf("directive is not supported")
+		}
+		sel, err := p.parseSelection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, sel)
+	}
+	if len(selections) == 0 {
+		return nil, p.errorf("empty selection set")
+	}
+	return selections, p.next()
+}
+
+func (p *parser) parseSelection() (*selection, error) {
+	name, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	sel := &selection{Name: name}
+	if p.peek(":") {
+		if err = p.next(); err != nil {
+			return nil, err
+		}
+		sel.Alias = name
+		sel.Name, err = p.expectName()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.peek("(") {
+		sel.Arguments, err = p.parseArguments()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.peek("@") {
+		return nil, fmt.Errorf("directive is not supported")
+	}
+	if p.peek("{") {
+		sel.Selections, err = p.parseSelectionSet()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sel, nil
+}
+
+func (p *parser) parseArguments() (map[string]value, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	arguments := make(map[string]value)
+	for !p.peek(")") {
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(":"); err != nil {
+			return nil, err
+		}
+		arguments[name], err = p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return arguments, p.next()
+}
+
+func (p *parser) parseValue() (value, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokenInt:
+		i, err := strconv.Atoi(tok.text)
+		if err != nil {
+			return value{}, p.errorf("invalid int %q", tok.text)
+		}
+		return value{Literal: i}, p.next()
+	case tokenFloat:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return value{}, p.errorf("invalid float %q", tok.text)
+		}
+		return value{Literal: f}, p.next()
+	case tokenString:
+		return value{Literal: tok.text}, p.next()
+	case tokenName:
+		switch tok.text {
+		case "true":
+			return value{Literal: true}, p.next()
+		case "false":
+			return value{Literal: false}, p.next()
+		case "null":
+			return value{}, p.next()
+		default:
+			// enum value
+			return value{Literal: tok.text}, p.next()
+		}
+	case tokenPunct:
+		switch tok.text {
+		case "$":
+			if err := p.next(); err != nil {
+				return value{}, err
+			}
+			name, err := p.expectName()
+			return value{Variable: name}, err
+		case "[":
+			if err := p.next(); err != nil {
+				return value{}, err
+			}
+			list := make([]value, 0)
+			for !p.peek("]") {
+				if p.tok.kind == tokenEOF {
+					return value{}, p.errorf("unterminated list")
+				}
+				item, err := p.parseValue()
+				if err != nil {
+					return value{}, err
+				}
+				list = append(list, item)
+			}
+			return value{Literal: list}, p.next()
+		}
+	}
+	return value{}, p.errorf("unexpected %q", tok.text)
+}
@@ -0,0 +1,8 @@
+package graphql
+
+import "github.com/gofiber/fiber/v2"
+
+func RegisterRoutes(app fiber.Router) {
+	app.Get("/graphql", QueryGraph)
+	app.Post("/graphql", QueryGraph)
+}
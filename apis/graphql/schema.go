@@ -0,0 +1,560 @@
+package graphql
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"gorm.io/gorm"
+
+	"treehole_next/config"
+	. "treehole_next/models"
+	"treehole_next/utils"
+)
+
+// scalar fields are served as they are in REST responses
+func scalars(names ...string) map[string]*field {
+	fields := make(map[string]*field, len(names))
+	for _, name := range names {
+		fields[name] = &field{}
+	}
+	return fields
+}
+
+var graphSchema = schema{
+	"Query": {
+		Name: "Query",
+		Fields: map[string]*field{
+			"divisions": {Type: "Division", List: true, Resolve: resolveDivisions},
+			"division":  {Type: "Division", Resolve: resolveDivision},
+			"holes":     {Type: "Hole", List: true, Resolve: resolveHoles},
+			"hole":      {Type: "Hole", Resolve: resolveHole},
+			"floor":     {Type: "Floor", Resolve: resolveFloor},
+			"tags":      {Type: "Tag", List: true, Resolve: resolveTags},
+			"tag":       {Type: "Tag", Resolve: resolveTag},
+			"favorites": {Type: "Hole", List: true, Resolve: resolveFavorites},
+		},
+	},
+	"Division": {
+		Name: "Division",
+		Fields: merge(
+			scalars("id", "division_id", "name", "description", "hidden", "real_name", "time_created", "time_updated"),
+			map[string]*field{
+				"pinned": {Type: "Hole", List: true, Resolve: resolveDivisionPinned},
+			},
+		),
+	},
+	"Hole": {
+		Name: "Hole",
+		Fields: merge(
+			scalars("id", "hole_id", "view", "reply", "hidden", "hidden_state", "locked", "good", "no_purge", "division_id", "time_created", "time_updated"),
+			map[string]*field{
+				"division":    {Type: "Division", Resolve: resolveHoleDivision},
+				"tags":        {Type: "Tag", List: true},
+				"first_floor": {Type: "Floor", Resolve: resolveHoleFloor("first_floor")},
+				"last_floor":  {Type: "Floor", Resolve: resolveHoleFloor("last_floor")},
+				"floors":      {Type: "Floor", List: true, Resolve: resolveHoleFloors},
+			},
+		),
+	},
+	"Floor": {
+		Name: "Floor",
+		Fields: merge(
+			scalars("id", "floor_id", "hole_id", "content", "anonyname", "ranking", "reply_to", "like", "dislike",
+				"deleted", "modified", "fold", "fold_v2", "special_tag", "is_sensitive", "is_actual_sensitive",
+				"sensitive_detail", "liked", "disliked", "is_me", "time_created", "time_updated"),
+			map[string]*field{
+				"mention": {Type: "Floor", List: true},
+				"hole":    {Type: "Hole", Resolve: resolveFloorHole},
+			},
+		),
+	},
+	"Tag": {
+		Name:   "Tag",
+		Fields: scalars("id", "tag_id", "name", "temperature", "nsfw"),
+	},
+}
+
+func merge(fieldMaps ...map[string]*field) map[string]*field {
+	fields := make(map[string]*field)
+	for _, m := range fieldMaps {
+		for name, f := range m {
+			fields[name] = f
+		}
+	}
+	return fields
+}
+
+func intField(o *object, name string) int {
+	switch v := o.fields[name].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+// single wraps one root object as the result of root resolvers
+func single(o *object) []any {
+	if o == nil {
+		return []any{nil}
+	}
+	return []any{o}
+}
+
+/* serializers */
+
+func divisionObjects(divisions Divisions) ([]*object, error) {
+	return newObjects(divisions)
+}
+
+func holeObjects(c *fiber.Ctx, holes Holes) ([]*object, error) {
+	err := holes.Preprocess(c)
+	if err != nil {
+		return nil, err
+	}
+	return newObjects(holes)
+}
+
+func floorObjects(c *fiber.Ctx, floors Floors) ([]*object, error) {
+	err := floors.Preprocess(c)
+	if err != nil {
+		return nil, err
+	}
+	return newObjects(floors)
+}
+
+func tagObjects(c *fiber.Ctx, tags Tags) ([]*object, error) {
+	err := tags.Preprocess(c)
+	if err != nil {
+		return nil, err
+	}
+	return newObjects(tags)
+}
+
+// makeDivisionQuerySet selects divisions of the tenant whose holes the user can see, see InvisibleDivisionIDs
+func makeDivisionQuerySet(c *fiber.Ctx) (*gorm.DB, error) {
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return nil, err
+	}
+	querySet := ReadDB(c).Where("tenant_id = ?", GetTenant(c).ID)
+	divisionIDs, err := InvisibleDivisionIDs(user)
+	if err != nil || len(divisionIDs) == 0 {
+		return querySet, err
+	}
+	return querySet.Where("id NOT IN ?", divisionIDs), nil
+}
+
+/* Query */
+
+func resolveDivisions(c *fiber.Ctx, _ []*object, _ arguments) ([]any, error) {
+	var divisions Divisions
+	err := RequestDB(c).Find(&divisions, "hidden = false AND tenant_id = ?", GetTenant(c).ID).Error
+	if err != nil {
+		return nil, err
+	}
+	objects, err := divisionObjects(divisions)
+	if err != nil {
+		return nil, err
+	}
+	return []any{objects}, nil
+}
+
+func resolveDivision(c *fiber.Ctx, _ []*object, args arguments) ([]any, error) {
+	id, err := args.Int("id", 0)
+	if err != nil {
+		return nil, err
+	}
+	var division Division
+	err = RequestDB(c).Where("hidden = false AND tenant_id = ?", GetTenant(c).ID).Take(&division, id).Error
+	if err != nil {
+		return nil, err
+	}
+	objects, err := divisionObjects(Divisions{&division})
+	if err != nil {
+		return nil, err
+	}
+	return single(objects[0]), nil
+}
+
+func resolveHoles(c *fiber.Ctx, _ []*object, args arguments) ([]any, error) {
+	divisionID, err := args.Int("division_id", 0)
+	if err != nil {
+		return nil, err
+	}
+	size, err := args.Int("size", 10)
+	if err != nil {
+		return nil, err
+	}
+	if size <= 0 || size > 10 {
+		return nil, common.BadRequest("size should be between 1 and 10")
+	}
+	order, err := args.String("order", "")
+	if err != nil {
+		return nil, err
+	}
+	offsetString, err := args.String("offset", "")
+	if err != nil {
+		return nil, err
+	}
+	offset := common.CustomTime{Time: time.Now()}
+	if offsetString != "" {
+		err = offset.UnmarshalText([]byte(offsetString))
+		if err != nil {
+			return nil, common.BadRequest("invalid offset")
+		}
+	}
+
+	var holes Holes
+	querySet, err := holes.MakeQuerySet(offset, size, order, c)
+	if err != nil {
+		return nil, err
+	}
+	if divisionID != 0 {
+		querySet = querySet.Where("hole.division_id = ?", divisionID)
+	}
+	err = querySet.Find(&holes).Error
+	if err != nil {
+		return nil, err
+	}
+	objects, err := holeObjects(c, holes)
+	if err != nil {
+		return nil, err
+	}
+	return []any{objects}, nil
+}
+
+func resolveHole(c *fiber.Ctx, _ []*object, args arguments) ([]any, error) {
+	id, err := args.Int("id", 0)
+	if err != nil {
+		return nil, err
+	}
+	querySet, err := MakeHoleQuerySet(c)
+	if err != nil {
+		return nil, err
+	}
+	var hole Hole
+	err = querySet.Take(&hole, id).Error
+	if err != nil {
+		return nil, err
+	}
+	objects, err := holeObjects(c, Holes{&hole})
+	if err != nil {
+		return nil, err
+	}
+	return single(objects[0]), nil
+}
+
+func resolveFloor(c *fiber.Ctx, _ []*object, args arguments) ([]any, error) {
+	id, err := args.Int("id", 0)
+	if err != nil {
+		return nil, err
+	}
+	querySet, err := MakeFloorQuerySet(c)
+	if err != nil {
+		return nil, err
+	}
+	var floor Floor
+	err = querySet.Take(&floor, id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// floors are visible with their hole, in the tenant and divisions of the user
+	holeQuerySet, err := MakeHoleQuerySet(c)
+	if err != nil {
+		return nil, err
+	}
+	err = holeQuerySet.Select("id").Take(&Hole{}, floor.HoleID).Error
+	if err != nil {
+		return nil, common.NotFound("floor not found")
+	}
+
+	objects, err := floorObjects(c, Floors{&floor})
+	if err != nil {
+		return nil, err
+	}
+	return single(objects[0]), nil
+}
+
+func resolveTags(c *fiber.Ctx, _ []*object, args arguments) ([]any, error) {
+	search, err := args.String("search", "")
+	if err != nil {
+		return nil, err
+	}
+	offset, err := args.Int("offset", 0)
+	if err != nil {
+		return nil, err
+	}
+	first, err := args.Int("first", config.Config.Size)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || first < 0 || first > config.Config.MaxSize {
+		return nil, common.BadRequest(fmt.Sprintf("first should be between 0 and %d", config.Config.MaxSize))
+	}
+	tags := make(Tags, 0, first)
+	querySet := RequestDB(c).Where("tenant_id = ?", GetTenant(c).ID).Order("temperature DESC, id")
+	if search != "" {
+		querySet = querySet.Where("name LIKE ?", "%"+search+"%")
+	}
+	err = querySet.Offset(offset).Limit(first).Find(&tags).Error
+	if err != nil {
+		return nil, err
+	}
+	objects, err := tagObjects(c, tags)
+	if err != nil {
+		return nil, err
+	}
+	return []any{objects}, nil
+}
+
+func resolveTag(c *fiber.Ctx, _ []*object, args arguments) ([]any, error) {
+	name, err := args.String("name", "")
+	if err != nil {
+		return nil, err
+	}
+	var tag Tag
+	err = RequestDB(c).Where("name = ? AND tenant_id = ?", name, GetTenant(c).ID).Take(&tag).Error
+	if err != nil {
+		return nil, err
+	}
+	objects, err := tagObjects(c, Tags{&tag})
+	if err != nil {
+		return nil, err
+	}
+	return single(objects[0]), nil
+}
+
+func resolveFavorites(c *fiber.Ctx, _ []*object, args arguments) ([]any, error) {
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return nil, err
+	}
+	groupID, err := args.IntPtr("group_id")
+	if err != nil {
+		return nil, err
+	}
+
+	querySet, err := MakeHoleQuerySet(c)
+	if err != nil {
+		return nil, err
+	}
+	holes := make(Holes, 0)
+	if groupID == nil {
+		err = querySet.
+			Joins("JOIN user_favorites ON user_favorites.hole_id = hole.id AND user_favorites.user_id = ?", userID).
+			Order("hole.updated_at desc").Find(&holes).Error
+	} else {
+		if !IsFavoriteGroupExist(RequestDB(c), userID, *groupID) {
+			return nil, common.NotFound("收藏夹不存在")
+		}
+		err = querySet.
+			Joins("JOIN user_favorites ON user_favorites.hole_id = hole.id AND user_favorites.user_id = ? AND user_favorites.favorite_group_id = ?", userID, *groupID).
+			Order("hole.updated_at desc").Find(&holes).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	objects, err := holeObjects(c, holes)
+	if err != nil {
+		return nil, err
+	}
+	return []any{objects}, nil
+}
+
+/* Division */
+
+func resolveDivisionPinned(c *fiber.Ctx, parents []*object, _ arguments) ([]any, error) {
+	var holeIDs []int
+	for _, parent := range parents {
+		if division, ok := parent.model.(*Division); ok {
+			holeIDs = append(holeIDs, division.Pinned...)
+		}
+	}
+
+	var holes Holes
+	if len(holeIDs) > 0 {
+		querySet, err := MakeHoleQuerySet(c)
+		if err != nil {
+			return nil, err
+		}
+		err = querySet.Find(&holes, utils.Unique(holeIDs)).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	objects, err := holeObjects(c, holes)
+	if err != nil {
+		return nil, err
+	}
+	holeMapping := make(map[int]*object, len(objects))
+	for _, o := range objects {
+		holeMapping[intField(o, "id")] = o
+	}
+
+	values := make([]any, len(parents))
+	for i, parent := range parents {
+		pinned := make([]*object, 0)
+		if division, ok := parent.model.(*Division); ok {
+			for _, holeID := range division.Pinned {
+				if o, ok := holeMapping[holeID]; ok {
+					pinned = append(pinned, o)
+				}
+			}
+		}
+		values[i] = pinned
+	}
+	return values, nil
+}
+
+/* Hole */
+
+// resolveHoleDivision loads divisions of the tenant as GetDivision does, hidden ones included for holes still in them
+func resolveHoleDivision(c *fiber.Ctx, parents []*object, _ arguments) ([]any, error) {
+	divisionIDs := make([]int, 0, len(parents))
+	for _, parent := range parents {
+		divisionIDs = append(divisionIDs, intField(parent, "division_id"))
+	}
+
+	querySet, err := makeDivisionQuerySet(c)
+	if err != nil {
+		return nil, err
+	}
+	var divisions Divisions
+	err = querySet.Find(&divisions, utils.Unique(divisionIDs)).Error
+	if err != nil {
+		return nil, err
+	}
+	objects, err := divisionObjects(divisions)
+	if err != nil {
+		return nil, err
+	}
+	divisionMapping := make(map[int]*object, len(objects))
+	for _, o := range objects {
+		divisionMapping[intField(o, "id")] = o
+	}
+
+	values := make([]any, len(parents))
+	for i, parent := range parents {
+		if o, ok := divisionMapping[intField(parent, "division_id")]; ok {
+			values[i] = o
+		}
+	}
+	return values, nil
+}
+
+func resolveHoleFloor(name string) resolver {
+	return func(_ *fiber.Ctx, parents []*object, _ arguments) ([]any, error) {
+		values := make([]any, len(parents))
+		for i, parent := range parents {
+			if holeFloor, ok := parent.fields["floors"].(map[string]any); ok {
+				values[i] = holeFloor[name]
+			}
+		}
+		return values, nil
+	}
+}
+
+// resolveHoleFloors loads floors of all holes in one query, using ranking to locate
+func resolveHoleFloors(c *fiber.Ctx, parents []*object, args arguments) ([]any, error) {
+	offset, err := args.Int("offset", 0)
+	if err != nil {
+		return nil, err
+	}
+	size, err := args.Int("size", config.Config.Size)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || size < 0 || size > config.Config.MaxSize {
+		return nil, common.BadRequest(fmt.Sprintf("size should be between 0 and %d", config.Config.MaxSize))
+	}
+
+	holeIDs := make([]int, 0, len(parents))
+	for _, parent := range parents {
+		holeIDs = append(holeIDs, intField(parent, "id"))
+	}
+
+	// floors are visible with their hole, see checkHoleVisible of floor apis
+	holeQuerySet, err := MakeHoleQuerySet(c)
+	if err != nil {
+		return nil, err
+	}
+	var visibleHoleIDs []int
+	err = holeQuerySet.Model(&Hole{}).Where("hole.id in ?", utils.Unique(holeIDs)).Pluck("id", &visibleHoleIDs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	floors := make(Floors, 0)
+	querySet, err := MakeFloorQuerySet(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(visibleHoleIDs) > 0 {
+		err = querySet.
+			Where("hole_id in ? and ranking >= ? and ranking < ?", visibleHoleIDs, offset, offset+size).
+			Order("hole_id, ranking").Find(&floors).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	objects, err := floorObjects(c, floors)
+	if err != nil {
+		return nil, err
+	}
+
+	floorMapping := make(map[int][]*object)
+	for _, o := range objects {
+		holeID := intField(o, "hole_id")
+		floorMapping[holeID] = append(floorMapping[holeID], o)
+	}
+
+	values := make([]any, len(parents))
+	for i, holeID := range holeIDs {
+		holeFloors, ok := floorMapping[holeID]
+		if !ok {
+			holeFloors = []*object{}
+		}
+		values[i] = holeFloors
+	}
+	return values, nil
+}
+
+/* Floor */
+
+func resolveFloorHole(c *fiber.Ctx, parents []*object, _ arguments) ([]any, error) {
+	holeIDs := make([]int, 0, len(parents))
+	for _, parent := range parents {
+		holeIDs = append(holeIDs, intField(parent, "hole_id"))
+	}
+
+	querySet, err := MakeHoleQuerySet(c)
+	if err != nil {
+		return nil, err
+	}
+	var holes Holes
+	err = querySet.Find(&holes, utils.Unique(holeIDs)).Error
+	if err != nil {
+		return nil, err
+	}
+	objects, err := holeObjects(c, holes)
+	if err != nil {
+		return nil, err
+	}
+	holeMapping := make(map[int]*object, len(objects))
+	for _, o := range objects {
+		holeMapping[intField(o, "id")] = o
+	}
+
+	values := make([]any, len(parents))
+	for i, holeID := range holeIDs {
+		if o, ok := holeMapping[holeID]; ok {
+			values[i] = o
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,16 @@
+package graphql
+
+type QueryModel struct {
+	Query         string         `json:"query" query:"query" validate:"required"`
+	OperationName string         `json:"operationName" query:"operationName"`
+	Variables     map[string]any `json:"variables" query:"-"`
+}
+
+type ErrorModel struct {
+	Message string `json:"message"`
+}
+
+type ResponseModel struct {
+	Data   map[string]any `json:"data"`
+	Errors []ErrorModel   `json:"errors,omitempty"`
+}
@@ -0,0 +1,97 @@
+package apis
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"treehole_next/models"
+	"treehole_next/utils"
+)
+
+const readyzTimeout = 3 * time.Second
+
+type DependencyStatus struct {
+	// up or down
+	Status string `json:"status"`
+	// latency in milliseconds
+	Latency int64  `json:"latency"`
+	Error   string `json:"error,omitempty"`
+}
+
+type ReadyzResponse struct {
+	// up or down
+	Status       string                      `json:"status"`
+	Dependencies map[string]DependencyStatus `json:"dependencies"`
+}
+
+// Healthz
+//
+// @Summary Liveness Probe
+// @Tags Health
+// @Produce application/json
+// @Router /healthz [get]
+// @Success 200 {object} models.MessageModel
+func Healthz(c *fiber.Ctx) error {
+	return c.JSON(models.MessageModel{Message: "ok"})
+}
+
+// Readyz
+//
+// @Summary Readiness Probe
+// @Description Check MySQL source and replicas, Redis and Elasticsearch, returns 503 if any of them is down.
+// @Description Replicas being down are reported without failing the probe, reads fail over to other replicas or the source.
+// @Tags Health
+// @Produce application/json
+// @Router /readyz [get]
+// @Success 200 {object} ReadyzResponse
+// @Failure 503 {object} ReadyzResponse
+func Readyz(c *fiber.Ctx) error {
+	checks := models.PingDB()
+	checks["redis"] = utils.PingCache
+	if models.ES != nil {
+		checks["elasticsearch"] = models.PingES
+	}
+	replicas := models.PingReplicas()
+	for name, check := range replicas {
+		checks[name] = check
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), readyzTimeout)
+	defer cancel()
+
+	response := ReadyzResponse{
+		Status:       "up",
+		Dependencies: make(map[string]DependencyStatus, len(checks)),
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(ctx context.Context) error) {
+			defer wg.Done()
+			start := time.Now()
+			err := check(ctx)
+			status := DependencyStatus{Status: "up", Latency: time.Since(start).Milliseconds()}
+			if err != nil {
+				status.Status = "down"
+				status.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			response.Dependencies[name] = status
+			if _, replica := replicas[name]; err != nil && !replica {
+				response.Status = "down"
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	if response.Status != "up" {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(response)
+	}
+	return c.JSON(response)
+}
@@ -1,9 +1,11 @@
 package hole
 
 import (
+	"errors"
 	"fmt"
 	"slices"
 	"strconv"
+	"strings"
 	"time"
 	"treehole_next/utils/sensitive"
 
@@ -53,7 +55,12 @@ func ListHolesByDivision(c *fiber.Ctx) error {
 	}
 	querySet.Find(&holes)
 
-	return Serialize(c, &holes)
+	userID, _ := common.GetUserID(c)
+	if CheckETag(c, userID, len(holes), holes.LastModified(), ETagHoles) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	return Serialize(c, &holes, SerializeOptions{Fields: query.Fields})
 }
 
 // ListHolesByTag
@@ -76,7 +83,7 @@ func ListHolesByTag(c *fiber.Ctx) error {
 	// get tag
 	var tag Tag
 	tagName := c.Params("name")
-	result := DB.Where("name = ?", tagName).First(&tag)
+	result := RequestDB(c).Where("name = ? AND tenant_id = ?", tagName, GetTenant(c).ID).First(&tag)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -93,19 +100,20 @@ func ListHolesByTag(c *fiber.Ctx) error {
 		return err
 	}
 
-	return Serialize(c, &holes)
+	return Serialize(c, &holes, SerializeOptions{Fields: query.Fields})
 }
 
 // ListHolesByMe
 //
 // @Summary List a Hole Created By User
+// @Description Hidden holes are listed only with include_hidden, except for holes pending review
 // @Tags Hole
 // @Produce json
 // @Router /users/me/holes [get]
-// @Param object query QueryTime false "query"
+// @Param object query ListMyModel false "query"
 // @Success 200 {array} Hole
 func ListHolesByMe(c *fiber.Ctx) error {
-	var query QueryTime
+	var query ListMyModel
 	err := common.ValidateQuery(c, &query)
 	if err != nil {
 		return err
@@ -115,16 +123,21 @@ func ListHolesByMe(c *fiber.Ctx) error {
 		return err
 	}
 
-	// get holes
+	// get holes, the author can always see their holes
 	var holes Holes
-	querySet, err := holes.MakeQuerySet(query.Offset, query.Size, "", c)
+	querySet := RequestDB(c).Where("hole.user_id = ? AND hole.tenant_id = ?", userID, GetTenant(c).ID)
+	if query.IncludeHidden {
+		querySet = querySet.Unscoped()
+	} else {
+		// holes pending review are listed to the author
+		querySet = querySet.Where("hole.hidden = ? OR hole.hidden_state = ?", false, HolePendingReview)
+	}
+	err = holes.Paginate(querySet, query.Offset, query.Size, query.Order).Find(&holes).Error
 	if err != nil {
 		return err
 	}
-	querySet = querySet.Where("hole.user_id = ?", userID)
-	querySet.Find(&holes)
 
-	return Serialize(c, &holes)
+	return Serialize(c, &holes, SerializeOptions{Fields: query.Fields})
 }
 
 // ListGoodHoles
@@ -158,7 +171,7 @@ func ListGoodHoles(c *fiber.Ctx) error {
 		return err
 	}
 
-	return Serialize(c, &holes)
+	return Serialize(c, &holes, SerializeOptions{Fields: query.Fields})
 }
 
 // ListHolesOld
@@ -176,6 +189,13 @@ func ListHolesOld(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	if query.CreatedBefore != "" {
+		query.Offset.Time, err = query.createdBefore()
+		if err != nil {
+			return err
+		}
+		query.Order = "time_created"
+	}
 
 	var holes Holes
 	querySet, err := holes.MakeQuerySet(query.Offset, query.Size, query.Order, c)
@@ -184,7 +204,7 @@ func ListHolesOld(c *fiber.Ctx) error {
 	}
 	if query.Tag != "" {
 		var tag Tag
-		err = DB.Where("name = ?", query.Tag).Find(&tag).Error
+		err = RequestDB(c).Where("name = ? AND tenant_id = ?", query.Tag, GetTenant(c).ID).Find(&tag).Error
 		if err != nil {
 			return err
 		}
@@ -200,19 +220,36 @@ func ListHolesOld(c *fiber.Ctx) error {
 		querySet.Find(&holes)
 	}
 
+	userID, _ := common.GetUserID(c)
+	if CheckETag(c, userID, len(holes), holes.LastModified(), ETagHoles) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
 	// only for danxi v1.3.10 old api
 	if query.Order == "time_created" || query.Order == "created_at" {
-		for i := range holes {
-			holes[i].UpdatedAt = holes[i].CreatedAt
-		}
+		return Serialize(c, holesCreatedAt(holes), SerializeOptions{Fields: query.Fields})
 	}
+	return Serialize(c, &holes, SerializeOptions{Fields: query.Fields})
+}
 
-	return Serialize(c, &holes)
+// holesCreatedAt shows time_created as time_updated, set after Preprocess for cache keys of holes
+type holesCreatedAt Holes
+
+func (holes holesCreatedAt) Preprocess(c *fiber.Ctx) error {
+	err := Holes(holes).Preprocess(c)
+	if err != nil {
+		return err
+	}
+	for _, hole := range holes {
+		hole.UpdatedAt = hole.CreatedAt
+	}
+	return nil
 }
 
 // GetHole
 //
 // @Summary Get A Hole
+// @Description Hidden holes are not found, except for admins, and for the author if hidden_by_author or pending_review
 // @Tags Hole
 // @Produce application/json
 // @Router /holes/{id} [get]
@@ -229,23 +266,40 @@ func GetHole(c *fiber.Ctx) error {
 
 	// get hole
 	var hole Hole
+	userID, _ := common.GetUserID(c)
 	err = querySet.Take(&hole, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// redirect stub of merged holes, see Hole.Merge
+		stub, stubErr := MergedHole(RequestDB(c), id, GetTenant(c).ID)
+		if stubErr == nil {
+			return Serialize(c, stub)
+		}
+		// the author can still get holes hidden by the author or pending review
+		err = ReadDB(c).Scopes(AuthorHoleScope(userID)).
+			Where("hole.tenant_id = ?", GetTenant(c).ID).Take(&hole, id).Error
+	}
 	if err != nil {
 		return err
 	}
 
+	if CheckETag(c, userID, 1, hole.UpdatedAt, ETagHoles) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
 	return Serialize(c, &hole)
 }
 
 // CreateHole
 //
 // @Summary Create A Hole
-// @Description Create a hole, create tags and floor binding to it and set the name mapping
+// @Description Create a hole, create tags and floor binding to it and set the name mapping.
+// @Description Near-duplicate recent holes in the division are returned in duplicates, see FindDuplicateHoles.
 // @Tags Hole
 // @Produce application/json
 // @Router /divisions/{division_id}/holes [post]
 // @Param division_id path int true "division id"
 // @Param json body CreateModel true "json"
+// @Param Idempotency-Key header string false "dedupe retried requests"
 // @Success 201 {object} Hole
 func CreateHole(c *fiber.Ctx) error {
 	// validate body
@@ -256,7 +310,7 @@ func CreateHole(c *fiber.Ctx) error {
 	}
 
 	if len([]rune(body.Content)) > 10000 {
-		return common.BadRequest("文本限制 10000 字")
+		return NewError(ErrCodeContentTooLong, "文本限制 10000 字")
 	}
 
 	divisionID, err := c.ParamsInt("id")
@@ -272,12 +326,16 @@ func CreateHole(c *fiber.Ctx) error {
 
 	// permission
 	if user.BanDivision[divisionID] != nil {
-		return common.Forbidden(user.BanDivisionMessage(divisionID))
+		return NewError(ErrCodeBannedInDivision, user.BanDivisionMessage(divisionID))
+	}
+	err = CheckDivisionArchived(divisionID)
+	if err != nil {
+		return err
 	}
 
 	// special tag
 	if body.SpecialTag != "" && !user.IsAdmin && !slices.Contains(user.SpecialTags, body.SpecialTag) {
-		return common.Forbidden("非管理员禁止发含有特殊标签的洞")
+		return NewError(ErrCodeSpecialTagAdminOnly, "非管理员禁止发含有特殊标签的洞")
 	} else if body.SpecialTag == "" && user.DefaultSpecialTag != "" {
 		body.SpecialTag = user.DefaultSpecialTag
 	}
@@ -296,6 +354,8 @@ func CreateHole(c *fiber.Ctx) error {
 			UserID:          user.ID,
 			Content:         body.Content,
 			SpecialTag:      body.SpecialTag,
+			Spoiler:         body.Spoiler,
+			ContentWarning:  strings.TrimSpace(body.ContentWarning),
 			IsMe:            true,
 			IsSensitive:     !sensitiveResp.Pass,
 			SensitiveDetail: sensitiveResp.Detail,
@@ -303,10 +363,18 @@ func CreateHole(c *fiber.Ctx) error {
 		UserID:     user.ID,
 		DivisionID: divisionID,
 	}
-	err = hole.Create(DB, user, body.ToName(), c)
+	err = hole.Create(RequestDB(c), user, body.ToName(), c)
 	if err != nil {
 		return err
 	}
+	TriggerWebhook(WebhookEventHoleCreated, NewWebhookHoleData(&hole))
+	TriggerBotRules(&hole)
+
+	// hints only, never fail the creation
+	hole.Duplicates, err = FindDuplicateHoles(RequestDB(c), &hole)
+	if err != nil {
+		log.Err(err).Int("hole_id", hole.ID).Msg("find duplicate holes failed")
+	}
 
 	return c.Status(201).JSON(&hole)
 }
@@ -319,6 +387,7 @@ func CreateHole(c *fiber.Ctx) error {
 // @Produce application/json
 // @Router /holes [post]
 // @Param json body CreateOldModel true "json"
+// @Param Idempotency-Key header string false "dedupe retried requests"
 // @Success 201 {object} CreateOldResponse
 func CreateHoleOld(c *fiber.Ctx) error {
 	// validate body
@@ -329,7 +398,7 @@ func CreateHoleOld(c *fiber.Ctx) error {
 	}
 
 	if len([]rune(body.Content)) > 10000 {
-		return common.BadRequest("文本限制 10000 字")
+		return NewError(ErrCodeContentTooLong, "文本限制 10000 字")
 	}
 
 	// get user from auth
@@ -340,12 +409,16 @@ func CreateHoleOld(c *fiber.Ctx) error {
 
 	// permission
 	if user.BanDivision[body.DivisionID] != nil {
-		return common.Forbidden(user.BanDivisionMessage(body.DivisionID))
+		return NewError(ErrCodeBannedInDivision, user.BanDivisionMessage(body.DivisionID))
+	}
+	err = CheckDivisionArchived(body.DivisionID)
+	if err != nil {
+		return err
 	}
 
 	// special tag
 	if body.SpecialTag != "" && !user.IsAdmin && !slices.Contains(user.SpecialTags, body.SpecialTag) {
-		return common.Forbidden("非管理员禁止发含有特殊标签的洞")
+		return NewError(ErrCodeSpecialTagAdminOnly, "非管理员禁止发含有特殊标签的洞")
 	} else if body.SpecialTag == "" && user.DefaultSpecialTag != "" {
 		body.SpecialTag = user.DefaultSpecialTag
 	}
@@ -365,6 +438,8 @@ func CreateHoleOld(c *fiber.Ctx) error {
 			UserID:          user.ID,
 			Content:         body.Content,
 			SpecialTag:      body.SpecialTag,
+			Spoiler:         body.Spoiler,
+			ContentWarning:  strings.TrimSpace(body.ContentWarning),
 			IsMe:            true,
 			IsSensitive:     !sensitiveResp.Pass,
 			SensitiveDetail: sensitiveResp.Detail,
@@ -372,10 +447,18 @@ func CreateHoleOld(c *fiber.Ctx) error {
 		UserID:     user.ID,
 		DivisionID: body.DivisionID,
 	}
-	err = hole.Create(DB, user, body.ToName(), c)
+	err = hole.Create(RequestDB(c), user, body.ToName(), c)
 	if err != nil {
 		return err
 	}
+	TriggerWebhook(WebhookEventHoleCreated, NewWebhookHoleData(&hole))
+	TriggerBotRules(&hole)
+
+	// hints only, never fail the creation
+	hole.Duplicates, err = FindDuplicateHoles(RequestDB(c), &hole)
+	if err != nil {
+		log.Err(err).Int("hole_id", hole.ID).Msg("find duplicate holes failed")
+	}
 
 	err = hole.Preprocess(c)
 	if err != nil {
@@ -383,7 +466,7 @@ func CreateHoleOld(c *fiber.Ctx) error {
 	}
 	return c.Status(201).JSON(&CreateOldResponse{
 		Data:    hole,
-		Message: "发表成功",
+		Message: utils.Localize(c, "发表成功"),
 	})
 }
 
@@ -393,6 +476,7 @@ func CreateHoleOld(c *fiber.Ctx) error {
 // @Description Modify a hole, modify tags and set the name mapping
 // @Description Only admin can modify division, tags, hidden, lock
 // @Description `unhidden` take effect only when hole is hidden and set to true
+// @Description The author can set hidden_state to hidden_by_author or back to visible, other states are admin only
 // @Tags Hole
 // @Produce application/json
 // @Router /holes/{id} [put]
@@ -414,7 +498,7 @@ func ModifyHole(c *fiber.Ctx) error {
 	}
 
 	if body.DoNothing() {
-		return common.BadRequest("无效请求")
+		return NewError(ErrCodeInvalidRequest, "无效请求")
 	}
 
 	// get user
@@ -428,9 +512,10 @@ func ModifyHole(c *fiber.Ctx) error {
 
 	changed := false
 
-	err = DB.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+	err = RequestDB(c).Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
 		// lock for update
-		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&hole, holeID).Error
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("tenant_id = ?", GetTenant(c).ID).Take(&hole, holeID).Error
 		if err != nil {
 			return err
 		}
@@ -443,32 +528,31 @@ func ModifyHole(c *fiber.Ctx) error {
 
 		// modify division
 		if body.DivisionID != nil && *body.DivisionID != 0 && *body.DivisionID != hole.DivisionID {
+			// holes are not moved across tenants
+			err = tx.Where("tenant_id = ?", hole.TenantID).Take(&Division{}, *body.DivisionID).Error
+			if err != nil {
+				return err
+			}
 			hole.DivisionID = *body.DivisionID
 			changed = true
 			// log
 			MyLog("Hole", "Modify", holeID, user.ID, RoleAdmin, "DivisionID to: ", strconv.Itoa(hole.DivisionID))
 		}
 
-		// modify hidden
-		if body.Hidden != nil {
-			if *body.Hidden && !hole.Hidden {
-				hole.Hidden = true
-				changed = true
+		// modify hidden state
+		if state := body.HiddenStateTo(); state != "" && state != hole.HiddenState {
+			wasHidden := hole.Hidden
+			hole.SetHiddenState(state)
+			changed = true
 
+			var floors Floors
+			if hole.Hidden && !wasHidden {
 				// delete floors from Elasticsearch
-				var floors Floors
-				_ = DB.Where("hole_id = ?", hole.ID).Find(&floors)
-				go BulkDelete(Models2IDSlice(floors))
-
-				// log
-				MyLog("Hole", "Modify", holeID, user.ID, RoleAdmin, "Hidden: ")
-			} else if !*body.Hidden && hole.Hidden {
-				hole.Hidden = false
-				changed = true
-
+				_ = tx.Where("hole_id = ?", hole.ID).Find(&floors)
+				Go(func() { BulkDelete(Models2IDSlice(floors)) })
+			} else if !hole.Hidden && wasHidden {
 				// reindex into Elasticsearch
-				var floors Floors
-				_ = DB.Where("hole_id = ?", hole.ID).Find(&floors)
+				_ = tx.Where("hole_id = ?", hole.ID).Find(&floors)
 				var floorModels []FloorModel
 				for _, floor := range floors {
 					floorModels = append(floorModels, FloorModel{
@@ -477,38 +561,21 @@ func ModifyHole(c *fiber.Ctx) error {
 						Content:   floor.Content,
 					})
 				}
-				go BulkInsert(floorModels)
-
-				// log
-				MyLog("Hole", "Modify", holeID, user.ID, RoleAdmin, "Unhidden: ")
+				Go(func() { BulkInsert(floorModels) })
 			}
-		} else {
-			if body.Unhidden != nil && *body.Unhidden && hole.Hidden {
-				hole.Hidden = false
-				changed = true
-
-				// reindex into Elasticsearch
-				var floors Floors
-				_ = DB.Where("hole_id = ?", hole.ID).Find(&floors)
-				var floorModels []FloorModel
-				for _, floor := range floors {
-					floorModels = append(floorModels, FloorModel{
-						ID:        floor.ID,
-						UpdatedAt: floor.UpdatedAt,
-						Content:   floor.Content,
-					})
-				}
-				go BulkInsert(floorModels)
 
-				// log
-				MyLog("Hole", "Modify", holeID, user.ID, RoleAdmin, "Unhidden: ")
+			// log
+			if user.Can(PermissionModerateHole, hole.DivisionID) {
+				MyLog("Hole", "Modify", holeID, user.ID, RoleAdmin, "HiddenState to: ", state)
+			} else {
+				MyLog("Hole", "Modify", holeID, user.ID, RoleOwner, "HiddenState to: ", state)
 			}
 		}
 
 		// modify tags
 		if len(body.Tags) != 0 {
 			changed = true
-			hole.Tags, err = FindOrCreateTags(tx, user, body.ToName())
+			hole.Tags, err = FindOrCreateTags(tx, user, hole.TenantID, body.ToName(), false)
 			if err != nil {
 				return err
 			}
@@ -558,7 +625,7 @@ func ModifyHole(c *fiber.Ctx) error {
 		if changed {
 			err = tx.Model(&hole).
 				Omit(clause.Associations, "UpdatedAt").
-				Select("DivisionID", "Hidden", "Locked").
+				Select("DivisionID", "Hidden", "HiddenState", "Locked").
 				Updates(&hole).Error
 			if err != nil {
 				return err
@@ -572,10 +639,11 @@ func ModifyHole(c *fiber.Ctx) error {
 				}{
 					HoleID: holeID,
 					Before: map[string]any{
-						"division_id": hole.DivisionID,
-						"hidden":      hole.Hidden,
-						"locked":      hole.Locked,
-						"tags":        hole.Tags,
+						"division_id":  hole.DivisionID,
+						"hidden":       hole.Hidden,
+						"hidden_state": hole.HiddenState,
+						"locked":       hole.Locked,
+						"tags":         hole.Tags,
 					},
 					Modify: body,
 				})
@@ -623,19 +691,20 @@ func HideHole(c *fiber.Ctx) error {
 
 	// permission
 	if !user.IsAdmin {
-		return common.Forbidden()
+		return NewError(ErrCodeAdminOnly, "仅管理员可操作")
 	}
 
 	var hole Hole
 	hole.ID = holeID
-	result := DB.Model(&hole).Select("Hidden").Omit("UpdatedAt").Updates(Hole{Hidden: true})
+	result := RequestDB(c).Model(&hole).Select("Hidden", "HiddenState").Omit("UpdatedAt").
+		Updates(Hole{Hidden: true, HiddenState: HoleHiddenByModerator})
 	if result.RowsAffected == 0 {
 		return gorm.ErrRecordNotFound
 	}
 
 	// log
 	MyLog("Hole", "Hide", holeID, user.ID, RoleAdmin)
-	CreateAdminLog(DB, AdminLogTypeHideHole, user.ID, struct {
+	CreateAdminLog(RequestDB(c), AdminLogTypeHideHole, user.ID, struct {
 		HoleID int  `json:"hole_id"`
 		Hidden bool `json:"hidden"`
 	}{
@@ -645,7 +714,7 @@ func HideHole(c *fiber.Ctx) error {
 
 	// find hole and update cache
 
-	err = DB.Take(&hole).Error
+	err = RequestDB(c).Take(&hole).Error
 	if err != nil {
 		return err
 	}
@@ -658,8 +727,8 @@ func HideHole(c *fiber.Ctx) error {
 
 	// delete floors from Elasticsearch
 	var floors Floors
-	_ = DB.Where("hole_id = ?", hole.ID).Find(&floors)
-	go BulkDelete(Models2IDSlice(floors))
+	_ = RequestDB(c).Where("hole_id = ?", hole.ID).Find(&floors)
+	Go(func() { BulkDelete(Models2IDSlice(floors)) })
 
 	return c.Status(204).JSON(nil)
 }
@@ -714,7 +783,7 @@ func DeleteHole(c *fiber.Ctx) error {
 	}
 
 	var hole Hole
-	err = DB.Take(&hole, holeID).Error
+	err = RequestDB(c).Take(&hole, holeID).Error
 	if err != nil {
 		return err
 	}
@@ -723,7 +792,7 @@ func DeleteHole(c *fiber.Ctx) error {
 		return common.Forbidden()
 	}
 
-	result := DB.Delete(&hole)
+	result := RequestDB(c).Delete(&hole)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -740,13 +809,13 @@ func DeleteHole(c *fiber.Ctx) error {
 
 	// delete floors from Elasticsearch
 	var floors Floors
-	err = DB.Where("hole_id = ?", hole.ID).Find(&floors).Error
+	err = RequestDB(c).Where("hole_id = ?", hole.ID).Find(&floors).Error
 	if err != nil {
 		return err
 	}
-	go BulkDelete(Models2IDSlice(floors))
+	Go(func() { BulkDelete(Models2IDSlice(floors)) })
 
-	err = DeleteCache("divisions")
+	err = DeleteLocalCache(DivisionsCacheKey(hole.TenantID))
 	if err != nil {
 		log.Err(err).Msg("DeleteHole: delete cache divisions")
 	}
@@ -0,0 +1,73 @@
+package hole
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+
+	"treehole_next/config"
+	. "treehole_next/models"
+)
+
+// RunAutoTag
+//
+// @Summary Suggest Tags For Untagged Holes
+// @Description Suggest tags of similar holes for visible holes without tags, the latest first, see SuggestTags.
+// @Description With apply, at most AUTO_TAG_MAX_TAGS suggestions scored at least min_score are applied as machine tags,
+// @Description listed in machine_tag_ids of holes until the tags are modified. Requires tag:manage.
+// @Tags Hole
+// @Accept json
+// @Produce json
+// @Router /holes/_auto_tag [post]
+// @Param json body AutoTagModel true "json"
+// @Success 200 {array} AutoTagResult
+func RunAutoTag(c *fiber.Ctx) error {
+	var body AutoTagModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	minScore, maxTags := config.Config.AutoTagMinScore, 0
+	if body.MinScore != nil {
+		minScore = *body.MinScore
+	}
+	if body.Apply {
+		maxTags = config.Config.AutoTagMaxTags
+	}
+	results, err := AutoTagHoles(time.Now().AddDate(0, 0, -body.Days), body.Size, minScore, maxTags)
+	if err != nil {
+		return err
+	}
+	if body.Apply {
+		CreateAdminLog(RequestDB(c), AdminLogTypeTag, user.ID, body)
+	}
+	return c.JSON(results)
+}
+
+// AutoTagNewHoles applies machine tags to untagged holes of the last day every hour, see AUTO_TAG_MIN_SCORE
+func AutoTagNewHoles(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if config.Config.AutoTagMinScore <= 0 {
+				continue
+			}
+			_, err := AutoTagHoles(time.Now().Add(-24*time.Hour), 100, config.Config.AutoTagMinScore, config.Config.AutoTagMaxTags)
+			if err != nil {
+				log.Err(err).Msg("error auto tag holes")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package hole
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// UpdateHotHoles refreshes rankings of hot holes every few minutes, see HotHoleStats
+func UpdateHotHoles(ctx context.Context) {
+	rank := func() {
+		err := RankHotHoles()
+		if err != nil {
+			log.Err(err).Msg("error rank hot holes")
+		}
+	}
+	rank()
+
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			rank()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ListHotHoles
+//
+// @Summary List Hot Holes
+// @Description Holes ranked by recent floors, repliers, likes and views with time decay, refreshed every few minutes.
+// @Tags Hole
+// @Produce json
+// @Router /holes/hot [get]
+// @Param object query ListHotModel false "query"
+// @Success 200 {array} Hole
+func ListHotHoles(c *fiber.Ctx) error {
+	var query ListHotModel
+	err := common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+
+	holeIDs, err := ListHotHoleIDs(query.DivisionID, query.Offset, query.Size)
+	if err != nil {
+		return err
+	}
+
+	holes := Holes{}
+	if len(holeIDs) > 0 {
+		// holes hidden since the last ranking are filtered
+		querySet, err := MakeHoleQuerySet(c)
+		if err != nil {
+			return err
+		}
+		err = querySet.Find(&holes, holeIDs).Error
+		if err != nil {
+			return err
+		}
+		holes = OrderInGivenOrder(holes, holeIDs)
+	}
+
+	return Serialize(c, &holes, SerializeOptions{Fields: query.Fields})
+}
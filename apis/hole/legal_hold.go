@@ -0,0 +1,63 @@
+package hole
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"gorm.io/gorm"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// ModifyHoleLegalHold
+//
+// @Summary Place a hole under legal hold or release it, admin only
+// @Description Floors of held holes are not purged by HOLE_PURGE_DAYS or user purges, nor deleted by their authors.
+// @Tags Hole
+// @Accept application/json
+// @Produce application/json
+// @Router /holes/{id}/_legal_hold [put]
+// @Param id path int true "id"
+// @Param json body LegalHoldModel true "json"
+// @Success 200 {object} models.Hole
+func ModifyHoleLegalHold(c *fiber.Ctx) error {
+	holeID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	var body LegalHoldModel
+	err = common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	// validation is skipped for empty body
+	if body.Hold == nil || body.Reason == "" {
+		return common.BadRequest("hold and reason are required")
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	var hole Hole
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("tenant_id = ?", GetTenant(c).ID).Take(&hole, holeID).Error
+		if err != nil {
+			return err
+		}
+		err = hole.SetLegalHold(tx, *body.Hold)
+		if err != nil {
+			return err
+		}
+		CreateAdminLog(tx, AdminLogTypeLegalHold, user.ID, Map{
+			"hole_id": hole.ID,
+			"hold":    *body.Hold,
+			"reason":  body.Reason,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return Serialize(c, &hole)
+}
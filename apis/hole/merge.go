@@ -0,0 +1,80 @@
+package hole
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// MergeHole
+//
+// @Summary Merge A Hole Into Another
+// @Description Merge a duplicate hole into the hole, admin only. Floors of the duplicate are appended with merged_from set,
+// @Description favorites and subscriptions are moved, and the duplicate is hidden as a redirect stub with merged_into set.
+// @Tags Hole
+// @Accept json
+// @Produce json
+// @Router /holes/{id}/merge [post]
+// @Param id path int true "id of the hole to merge into"
+// @Param json body MergeModel true "json"
+// @Success 200 {object} Hole
+// @Failure 400 {object} common.HttpError
+// @Failure 404 {object} common.HttpError
+func MergeHole(c *fiber.Ctx) error {
+	var body MergeModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	holeID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	var hole Hole
+	err = RequestDB(c).Where("tenant_id = ?", GetTenant(c).ID).Take(&hole, holeID).Error
+	if err != nil {
+		return err
+	}
+	from, err := hole.Merge(body.FromHoleID, user.ID)
+	if err != nil {
+		return err
+	}
+	MyLog("Hole", "Merge", holeID, user.ID, RoleAdmin, "FromHoleID: ", strconv.Itoa(from.ID))
+
+	// update caches
+	err = UpdateHoleCache(Holes{&hole})
+	if err != nil {
+		return err
+	}
+	err = DeleteCache(from.CacheName())
+	if err != nil {
+		return err
+	}
+
+	// reindex floors moved and the system floor
+	var floors Floors
+	err = RequestDB(c).Where("hole_id = ? AND (merged_from = ? OR ranking = ?) AND deleted = ?", hole.ID, from.ID, hole.Reply, false).
+		Find(&floors).Error
+	if err != nil {
+		return err
+	}
+	floorModels := make([]FloorModel, 0, len(floors))
+	for _, floor := range floors {
+		if floor.Sensitive() {
+			continue
+		}
+		floorModels = append(floorModels, FloorModel{ID: floor.ID, UpdatedAt: floor.UpdatedAt, Content: floor.Content})
+	}
+	Go(func() { BulkInsert(floorModels) })
+
+	return Serialize(c, &hole)
+}
@@ -0,0 +1,156 @@
+package hole
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// MoveHole
+//
+// @Summary Move A Hole To Another Division
+// @Description Move a hole to another division of the tenant, moderator only.
+// @Description Tags of the hole are checked against the rules of the destination, and a system floor notes the move.
+// @Tags Hole
+// @Accept json
+// @Produce json
+// @Router /holes/{id}/division [patch]
+// @Param id path int true "id"
+// @Param json body MoveModel true "json"
+// @Success 200 {object} Hole
+// @Failure 400 {object} common.HttpError
+// @Failure 403 {object} common.HttpError
+// @Failure 404 {object} common.HttpError
+func MoveHole(c *fiber.Ctx) error {
+	var body MoveModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	holeID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	var hole Hole
+	var from, to Division
+	var floor *Floor
+	err = RequestDB(c).Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("tenant_id = ?", GetTenant(c).ID).Take(&hole, holeID).Error
+		if err != nil {
+			return err
+		}
+		if !user.Can(PermissionMoveHole, hole.DivisionID) {
+			return NewError(ErrCodeAdminOnly, "非管理员禁止修改分区")
+		}
+		if body.DivisionID == hole.DivisionID {
+			return NewError(ErrCodeInvalidRequest, "该洞已在目标分区")
+		}
+
+		// holes are not moved across tenants
+		err = tx.Where("tenant_id = ?", hole.TenantID).Take(&to, body.DivisionID).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return NewError(ErrCodeDivisionNotFound, "分区不存在")
+			}
+			return err
+		}
+		if to.Status != DivisionStatusActive {
+			return NewError(ErrCodeDivisionArchived, "该分区已归档，无法发帖")
+		}
+		var tagNames []string
+		err = tx.Model(&Tag{}).
+			Where("id IN (?)", tx.Model(&HoleTag{}).Select("tag_id").Where("hole_id = ?", hole.ID)).
+			Pluck("name", &tagNames).Error
+		if err != nil {
+			return err
+		}
+		err = to.ValidateTags(tagNames)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Take(&from, hole.DivisionID).Error
+		if err != nil {
+			return err
+		}
+		// unpin from the source division
+		if index := slices.Index(from.Pinned, hole.ID); index >= 0 {
+			from.Pinned = slices.Delete(from.Pinned, index, index+1)
+			err = tx.Model(&from).Select("Pinned").Updates(&from).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		hole.DivisionID = to.ID
+		err = tx.Model(&hole).Omit(clause.Associations, "UpdatedAt").Select("DivisionID").Updates(&hole).Error
+		if err != nil {
+			return err
+		}
+		floor, err = CreateSystemFloor(tx, &hole, fmt.Sprintf("该洞已由管理员从「%s」移动至「%s」", from.Name, to.Name))
+		if err != nil {
+			return err
+		}
+
+		MyLog("Hole", "Move", holeID, user.ID, RoleAdmin, "DivisionID to: ", fmt.Sprint(to.ID))
+		CreateAdminLog(tx, AdminLogTypeHole, user.ID, struct {
+			HoleID int `json:"hole_id"`
+			From   int `json:"from"`
+			To     int `json:"to"`
+		}{
+			HoleID: holeID,
+			From:   from.ID,
+			To:     to.ID,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// update caches
+	err = UpdateHoleCache(Holes{&hole})
+	if err != nil {
+		return err
+	}
+	err = DeleteLocalCache(DivisionsCacheKey(hole.TenantID))
+	if err != nil {
+		return err
+	}
+
+	// reindex floors, the system floor included
+	if !hole.Hidden {
+		var floors Floors
+		err = RequestDB(c).Where("hole_id = ? AND deleted = ?", hole.ID, false).Find(&floors).Error
+		if err != nil {
+			return err
+		}
+		floorModels := make([]FloorModel, 0, len(floors))
+		for _, f := range floors {
+			if f.Sensitive() {
+				continue
+			}
+			floorModels = append(floorModels, FloorModel{ID: f.ID, UpdatedAt: f.UpdatedAt, Content: f.Content})
+		}
+		Go(func() { BulkInsert(floorModels) })
+	} else {
+		Go(func() { FloorDelete(floor.ID) })
+	}
+
+	return Serialize(c, &hole)
+}
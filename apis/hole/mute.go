@@ -0,0 +1,67 @@
+package hole
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// MuteHoleNotifications
+//
+// @Summary Mute Notifications Of A Hole
+// @Description Stop reply and subscription notifications of the hole, mentions are still sent.
+// @Tags Hole
+// @Produce json
+// @Router /holes/{id}/mute_notifications [post]
+// @Param id path int true "id"
+// @Success 201 {object} MuteResponse
+// @Failure 404 {object} common.HttpError
+func MuteHoleNotifications(c *fiber.Ctx) error {
+	return setHoleMuted(c, true)
+}
+
+// UnmuteHoleNotifications
+//
+// @Summary Unmute Notifications Of A Hole
+// @Tags Hole
+// @Produce json
+// @Router /holes/{id}/mute_notifications [delete]
+// @Param id path int true "id"
+// @Success 200 {object} MuteResponse
+// @Failure 404 {object} common.HttpError
+func UnmuteHoleNotifications(c *fiber.Ctx) error {
+	return setHoleMuted(c, false)
+}
+
+func setHoleMuted(c *fiber.Ctx, muted bool) error {
+	holeID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var hole Hole
+	err = RequestDB(c).Where("tenant_id = ?", GetTenant(c).ID).Take(&hole, holeID).Error
+	if err != nil {
+		return err
+	}
+
+	if !muted {
+		err = UnmuteHole(RequestDB(c), userID, holeID)
+		if err != nil {
+			return err
+		}
+		return c.JSON(&MuteResponse{Message: Localize(c, "已恢复该洞的通知"), Muted: false})
+	}
+
+	err = MuteHole(RequestDB(c), userID, holeID)
+	if err != nil {
+		return err
+	}
+	return c.Status(201).JSON(&MuteResponse{Message: Localize(c, "已屏蔽该洞的通知"), Muted: true})
+}
@@ -0,0 +1,113 @@
+package hole
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"gorm.io/gorm"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+	"treehole_next/utils/sensitive"
+)
+
+// PreviewHole
+//
+// @Summary Preview A Hole
+// @Description Run the checks of creating a hole without posting it. Errors the hole would be rejected for are
+// @Description returned in warnings, and tags of similar holes by TF-IDF in suggested_tags, see SuggestTags.
+// @Tags Hole
+// @Accept json
+// @Produce json
+// @Router /holes/preview [post]
+// @Param json body PreviewModel true "json"
+// @Success 200 {object} PreviewResponse
+// @Failure 404 {object} MessageModel
+func PreviewHole(c *fiber.Ctx) error {
+	var body PreviewModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	var division Division
+	tenantID := GetTenant(c).ID
+	err = RequestDB(c).Where("tenant_id = ?", tenantID).Take(&division, body.DivisionID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return NewError(ErrCodeDivisionNotFound, "分区不存在")
+		}
+		return err
+	}
+
+	// the same checks as CreateHole and Hole.Create, except for spam which counts posts
+	warnings := make([]*Error, 0)
+	warn := func(err error) error {
+		var e *Error
+		if errors.As(err, &e) {
+			warnings = append(warnings, e)
+			return nil
+		}
+		return err
+	}
+	if len([]rune(body.Content)) > 10000 {
+		warnings = append(warnings, NewError(ErrCodeContentTooLong, "文本限制 10000 字"))
+	}
+	if user.BanDivision[division.ID] != nil {
+		warnings = append(warnings, NewError(ErrCodeBannedInDivision, user.BanDivisionMessage(division.ID)))
+	}
+	if division.Status != DivisionStatusActive {
+		warnings = append(warnings, NewError(ErrCodeDivisionArchived, "该分区已归档，无法发帖"))
+	}
+	if body.SpecialTag != "" && !user.IsAdmin && !slices.Contains(user.SpecialTags, body.SpecialTag) {
+		warnings = append(warnings, NewError(ErrCodeSpecialTagAdminOnly, "非管理员禁止发含有特殊标签的洞"))
+	}
+	tagNames := body.ToName()
+	err = warn(division.ValidateTags(tagNames))
+	if err != nil {
+		return err
+	}
+	err = warn(user.CheckLinkPrivilege(body.Content))
+	if err != nil {
+		return err
+	}
+	floor := Floor{Content: body.Content}
+	err = warn(CheckLinkRules(&floor))
+	if err != nil {
+		return err
+	}
+
+	sensitiveResp, err := sensitive.CheckSensitive(sensitive.ParamsForCheck{
+		Content:  body.Content,
+		Id:       time.Now().UnixNano(),
+		TypeName: sensitive.TypeFloor,
+	})
+	if err != nil {
+		return err
+	}
+
+	suggestions, err := SuggestTags(user, tenantID, body.Content, tagNames, TagSuggestionsMaxSize)
+	if err != nil {
+		return err
+	}
+
+	response := PreviewResponse{
+		Content:       floor.Content,
+		Fold:          floor.Fold,
+		Sensitive:     !sensitiveResp.Pass,
+		SuggestedTags: suggestions,
+		Warnings:      warnings,
+	}
+	if user.IsAdmin {
+		response.SensitiveDetail = sensitiveResp.Detail
+	}
+	return c.JSON(response)
+}
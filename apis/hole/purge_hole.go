@@ -9,6 +9,7 @@ import (
 
 	"treehole_next/config"
 	. "treehole_next/models"
+	"treehole_next/utils"
 )
 
 func purgeHole() (err error) {
@@ -22,6 +23,7 @@ func purgeHole() (err error) {
 		err = tx.Model(&Hole{}).
 			Clauses(clause.Locking{Strength: "UPDATE"}).
 			Where("no_purge = ?", false).
+			Scopes(NotHeldHoles).
 			Where("division_id IN ?", config.Config.HolePurgeDivisions).
 			Where("updated_at < ?",
 				time.Now().AddDate(0, 0, -config.Config.HolePurgeDays),
@@ -92,7 +94,7 @@ func purgeHole() (err error) {
 		}
 
 		// delete floor in search engine
-		go BulkDelete(floorIDs)
+		utils.Go(func() { BulkDelete(floorIDs) })
 
 		// log
 		log.Info().
@@ -0,0 +1,173 @@
+package hole
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// canManageRaffle tells if the user is the owner of the hole or a moderator
+func canManageRaffle(user *User, hole *Hole) bool {
+	return user.ID == hole.UserID || user.Can(PermissionModerateHole, hole.DivisionID)
+}
+
+func raffleRole(user *User, hole *Hole) Role {
+	if user.ID == hole.UserID {
+		return RoleOwner
+	}
+	return RoleAdmin
+}
+
+// CreateRaffle
+//
+// @Summary Attach A Raffle To A Hole
+// @Description Owner or moderators only, one raffle per hole. Users replying in the hole, or liking the first floor,
+// @Description before the deadline enter. The seed is hidden until drawn, seed_hash commits to it.
+// @Tags Hole
+// @Accept json
+// @Produce json
+// @Router /holes/{id}/raffle [post]
+// @Param id path int true "id"
+// @Param json body CreateRaffleModel true "json"
+// @Success 201 {object} Raffle
+// @Failure 400 {object} common.HttpError
+// @Failure 403 {object} common.HttpError
+func CreateRaffle(c *fiber.Ctx) error {
+	var body CreateRaffleModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	holeID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	if !body.Deadline.After(time.Now()) {
+		return common.BadRequest("截止时间必须晚于当前时间")
+	}
+
+	var hole Hole
+	err = RequestDB(c).Where("tenant_id = ?", GetTenant(c).ID).Take(&hole, holeID).Error
+	if err != nil {
+		return err
+	}
+	if !canManageRaffle(user, &hole) {
+		return NewError(ErrCodePermissionDenied, "只有洞主或管理员可以发起抽奖")
+	}
+
+	raffle, err := NewRaffle(hole.ID, user.ID, body.Entry, body.Winners, body.Deadline)
+	if err != nil {
+		return err
+	}
+	err = RequestDB(c).Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&Raffle{}).Where("hole_id = ?", hole.ID).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return NewError(ErrCodeInvalidRequest, "该洞已有抽奖")
+		}
+		return tx.Create(raffle).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	MyLog("Raffle", "Create", raffle.ID, user.ID, raffleRole(user, &hole), "HoleID: ", strconv.Itoa(hole.ID))
+	c.Status(201)
+	return Serialize(c, raffle)
+}
+
+// GetRaffle
+//
+// @Summary Get The Raffle Of A Hole
+// @Description The seed, entrants and result are set once drawn.
+// @Tags Hole
+// @Produce json
+// @Router /holes/{id}/raffle [get]
+// @Param id path int true "id"
+// @Success 200 {object} Raffle
+// @Failure 404 {object} common.HttpError
+func GetRaffle(c *fiber.Ctx) error {
+	holeID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	var raffle Raffle
+	err = RequestDB(c).Where("hole_id = ?", holeID).Take(&raffle).Error
+	if err != nil {
+		return err
+	}
+	return Serialize(c, &raffle)
+}
+
+// DrawRaffle
+//
+// @Summary Draw Winners Of The Raffle Of A Hole
+// @Description Owner or moderators only, after the deadline. The owner of the hole doesn't enter.
+// @Description Entrants are sorted by anonyname, the i-th winner (from 0) is at index SHA-256(seed + ":" + i),
+// @Description as a big-endian integer, modulo the number of entrants left, and is removed from them.
+// @Description The result with the seed is posted as a system floor.
+// @Tags Hole
+// @Produce json
+// @Router /holes/{id}/raffle/_draw [post]
+// @Param id path int true "id"
+// @Success 200 {object} Raffle
+// @Failure 400 {object} common.HttpError
+// @Failure 403 {object} common.HttpError
+// @Failure 404 {object} common.HttpError
+func DrawRaffle(c *fiber.Ctx) error {
+	holeID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	var hole Hole
+	err = RequestDB(c).Where("tenant_id = ?", GetTenant(c).ID).Take(&hole, holeID).Error
+	if err != nil {
+		return err
+	}
+	if !canManageRaffle(user, &hole) {
+		return NewError(ErrCodePermissionDenied, "只有洞主或管理员可以开奖")
+	}
+	var raffle Raffle
+	err = RequestDB(c).Where("hole_id = ?", hole.ID).Take(&raffle).Error
+	if err != nil {
+		return err
+	}
+
+	var floor *Floor
+	err = RequestDB(c).Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		floor, err = raffle.Draw(tx, &hole, time.Now())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	MyLog("Raffle", "Draw", raffle.ID, user.ID, raffleRole(user, &hole), "HoleID: ", strconv.Itoa(hole.ID))
+
+	err = DeleteCache(hole.CacheName())
+	if err != nil {
+		return err
+	}
+	if !hole.Hidden {
+		Go(func() { FloorIndex(FloorModel{ID: floor.ID, UpdatedAt: floor.UpdatedAt, Content: floor.Content}) })
+	}
+	return Serialize(c, &raffle)
+}
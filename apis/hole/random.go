@@ -0,0 +1,76 @@
+package hole
+
+import (
+	"math/rand"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"gorm.io/gorm"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// GetRandomHole
+//
+// @Summary Get A Random Hole
+// @Description Sample a hole uniformly by id in the range of ids of candidates, optionally in a division,
+// @Description with a tag or created in a time range.
+// @Tags Hole
+// @Produce json
+// @Router /holes/random [get]
+// @Param object query RandomModel false "query"
+// @Success 200 {object} Hole
+// @Failure 404 {object} common.HttpError
+func GetRandomHole(c *fiber.Ctx) error {
+	var query RandomModel
+	err := common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+
+	querySet, err := MakeHoleQuerySet(c)
+	if err != nil {
+		return err
+	}
+	if query.DivisionID != 0 {
+		querySet = querySet.Where("hole.division_id = ?", query.DivisionID)
+	}
+	if query.Tag != "" {
+		querySet = querySet.Where("hole.id IN (?)", RequestDB(c).Table("hole_tags").Select("hole_id").
+			Joins("JOIN tag ON tag.id = hole_tags.tag_id").
+			Where("tag.name = ? AND tag.tenant_id = ?", query.Tag, GetTenant(c).ID))
+	}
+	if !query.StartTime.IsZero() {
+		querySet = querySet.Where("hole.created_at >= ?", query.StartTime.Time)
+	}
+	if !query.EndTime.IsZero() {
+		querySet = querySet.Where("hole.created_at < ?", query.EndTime.Time)
+	}
+
+	// pick a random id in the range instead of ORDER BY RAND(), which scans all candidates
+	var bounds struct {
+		MinID int
+		MaxID int
+	}
+	err = querySet.Session(&gorm.Session{}).Model(&Hole{}).
+		Select("COALESCE(MIN(hole.id), 0) AS min_id, COALESCE(MAX(hole.id), 0) AS max_id").Scan(&bounds).Error
+	if err != nil {
+		return err
+	}
+	if bounds.MaxID == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	id := bounds.MinID + rand.Intn(bounds.MaxID-bounds.MinID+1)
+
+	var holes Holes
+	err = querySet.Session(&gorm.Session{}).Where("hole.id >= ?", id).Order("hole.id").Limit(1).Find(&holes).Error
+	if err != nil {
+		return err
+	}
+	if len(holes) == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return Serialize(c, holes[0], SerializeOptions{Fields: query.Fields})
+}
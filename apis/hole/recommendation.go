@@ -0,0 +1,47 @@
+package hole
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// ListRecommendations
+//
+// @Summary List Holes Recommended For Me
+// @Description Mixes holes with tags and in divisions the user engages with and hot holes, see RecommendationScorer.
+// @Tags Hole
+// @Produce json
+// @Router /users/me/recommendations [get]
+// @Param object query ListRecommendationsModel false "query"
+// @Success 200 {array} Hole
+func ListRecommendations(c *fiber.Ctx) error {
+	var query ListRecommendationsModel
+	err := common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	holeIDs, err := RecommendHoles(c.UserContext(), ReadDB(c), user, query.Size)
+	if err != nil {
+		return err
+	}
+
+	holes := Holes{}
+	if len(holeIDs) > 0 {
+		err = ReadDB(c).Where("tenant_id = ?", GetTenant(c).ID).Find(&holes, holeIDs).Error
+		if err != nil {
+			return err
+		}
+		holes = OrderInGivenOrder(holes, holeIDs)
+	}
+
+	return Serialize(c, &holes, SerializeOptions{Fields: query.Fields})
+}
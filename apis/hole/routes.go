@@ -3,6 +3,7 @@ package hole
 import (
 	"github.com/gofiber/fiber/v2"
 
+	"treehole_next/models"
 	"treehole_next/utils"
 )
 
@@ -10,14 +11,29 @@ func RegisterRoutes(app fiber.Router) {
 	app.Get("/divisions/:id<int>/holes", ListHolesByDivision)
 	app.Get("/tags/:name/holes", ListHolesByTag)
 	app.Get("/users/me/holes", ListHolesByMe)
+	app.Get("/users/me/recommendations", ListRecommendations)
 	app.Get("/holes/:id<int>", GetHole)
 	app.Get("/holes", ListHolesOld)
 	app.Get("/holes/_good", ListGoodHoles)
-	app.Post("/divisions/:id/holes", utils.MiddlewareHasAnsweredQuestions, CreateHole)
-	app.Post("/holes", utils.MiddlewareHasAnsweredQuestions, CreateHoleOld)
+	app.Get("/holes/hot", ListHotHoles)
+	app.Get("/holes/random", GetRandomHole)
+	app.Get("/holes/:id<int>/similar", ListSimilarHoles)
+	app.Get("/holes/:id<int>/stats", GetHoleStats)
+	app.Get("/holes/:id<int>/raffle", GetRaffle)
+	app.Post("/divisions/:id/holes", models.MiddlewareAPIKeyScope(models.ScopeHolesWrite), utils.MiddlewareHasAnsweredQuestions, utils.MiddlewareIdempotency, CreateHole)
+	app.Post("/holes/preview", PreviewHole)
+	app.Post("/holes/_auto_tag", models.MiddlewarePermission(models.PermissionManageTag), RunAutoTag)
+	app.Post("/holes", models.MiddlewareAPIKeyScope(models.ScopeHolesWrite), utils.MiddlewareHasAnsweredQuestions, utils.MiddlewareIdempotency, CreateHoleOld)
 	app.Patch("/holes/:id<int>/_webvpn", ModifyHole)
+	app.Patch("/holes/:id<int>/division", MoveHole)
+	app.Post("/holes/:id<int>/merge", models.MiddlewarePermission(models.PermissionMergeHole), MergeHole)
+	app.Post("/holes/:id<int>/raffle", CreateRaffle)
+	app.Post("/holes/:id<int>/raffle/_draw", DrawRaffle)
+	app.Post("/holes/:id<int>/mute_notifications", MuteHoleNotifications)
+	app.Delete("/holes/:id<int>/mute_notifications", UnmuteHoleNotifications)
 	app.Patch("/holes/:id<int>", PatchHole)
 	app.Put("/holes/:id<int>", ModifyHole)
+	app.Put("/holes/:id<int>/_legal_hold", models.MiddlewarePermission(models.PermissionLegalHold), ModifyHoleLegalHold)
 	app.Delete("/holes/:id<int>", HideHole)
 	app.Delete("/holes/:id<int>/_force", DeleteHole)
 }
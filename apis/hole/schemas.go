@@ -1,12 +1,14 @@
 package hole
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/opentreehole/go-common"
 
 	"treehole_next/apis/tag"
 	"treehole_next/models"
+	"treehole_next/utils"
 )
 
 type QueryTime struct {
@@ -14,6 +16,8 @@ type QueryTime struct {
 	// updated time < offset (default is now)
 	Offset common.CustomTime `json:"offset" query:"offset" swaggertype:"string"`
 	Order  string            `json:"order" query:"order"`
+	// comma separated fields to return, e.g. "id,tags,reply,floors.first_floor.content"; empty means all
+	Fields string `json:"fields" query:"fields"`
 }
 
 func (q *QueryTime) SetDefaults() {
@@ -22,12 +26,22 @@ func (q *QueryTime) SetDefaults() {
 	}
 }
 
+type ListMyModel struct {
+	QueryTime
+	// include holes hidden or deleted, with hidden and time_deleted as indicators
+	IncludeHidden bool `json:"include_hidden" query:"include_hidden"`
+}
+
 type ListOldModel struct {
 	Offset     common.CustomTime `json:"start_time" query:"start_time" swaggertype:"string"`
 	Size       int               `json:"length" query:"length" default:"10" validate:"max=10" `
 	Tag        string            `json:"tag" query:"tag"`
 	DivisionID int               `json:"division_id" query:"division_id"`
 	Order      string            `json:"order" query:"order"`
+	Fields     string            `json:"fields" query:"fields"`
+	// YYYY-MM-DD, or YYYY for this day in the year, lists holes created before the end of the day
+	// in order of time_created, overrides start_time and order
+	CreatedBefore string `json:"created_before" query:"created_before"`
 }
 
 func (q *ListOldModel) SetDefaults() {
@@ -36,6 +50,20 @@ func (q *ListOldModel) SetDefaults() {
 	}
 }
 
+// createdBefore parses CreatedBefore to the end of the day
+func (q *ListOldModel) createdBefore() (time.Time, error) {
+	date, err := time.ParseInLocation("2006-01-02", q.CreatedBefore, time.Local)
+	if err == nil {
+		return date.AddDate(0, 0, 1), nil
+	}
+	year, err := strconv.Atoi(q.CreatedBefore)
+	if err != nil || len(q.CreatedBefore) != 4 {
+		return time.Time{}, utils.NewError(utils.ErrCodeInvalidRequest, "时间格式错误")
+	}
+	now := time.Now()
+	return time.Date(year, now.Month(), now.Day()+1, 0, 0, 0, 0, time.Local), nil
+}
+
 type TagCreateModelSlice struct {
 	Tags []tag.CreateModel `json:"tags" validate:"omitempty,min=1,max=10,dive"` // All users
 }
@@ -53,6 +81,10 @@ type CreateModel struct {
 	TagCreateModelSlice
 	// Admin and Operator only
 	SpecialTag string `json:"special_tag" validate:"max=16"`
+	// collapse the first floor by default as a spoiler
+	Spoiler bool `json:"spoiler"`
+	// collapse the first floor by default behind the warning
+	ContentWarning string `json:"content_warning" validate:"max=32"`
 }
 
 type CreateOldModel struct {
@@ -71,30 +103,143 @@ type ModifyModel struct {
 	Hidden     *bool `json:"hidden"`                                 // Admin only
 	Unhidden   *bool `json:"unhidden"`                               // admin only
 	Lock       *bool `json:"lock"`                                   // admin only
+	// the author can hide the hole or make it visible again, other states are admin only, see Hole.CheckHiddenState
+	HiddenState *string `json:"hidden_state" validate:"omitempty,oneof=visible hidden_by_author hidden_by_moderator pending_review"`
+}
+
+// HiddenStateTo is the hidden state to change to, hidden and unhidden are hidden_by_moderator and visible
+func (body ModifyModel) HiddenStateTo() string {
+	if body.HiddenState != nil {
+		return *body.HiddenState
+	}
+	if body.Hidden != nil {
+		if *body.Hidden {
+			return models.HoleHiddenByModerator
+		}
+		return models.HoleVisible
+	}
+	if body.Unhidden != nil && *body.Unhidden {
+		return models.HoleVisible
+	}
+	return ""
 }
 
 func (body ModifyModel) CheckPermission(user *models.User, hole *models.Hole) error {
-	if body.DivisionID != nil && !user.IsAdmin {
-		return common.Forbidden("非管理员禁止修改分区")
+	if body.DivisionID != nil && !user.Can(models.PermissionMoveHole, hole.DivisionID) {
+		return utils.NewError(utils.ErrCodeAdminOnly, "非管理员禁止修改分区")
 	}
-	if body.Hidden != nil && !user.IsAdmin {
-		return common.Forbidden("非管理员禁止隐藏帖子")
+	if body.Hidden != nil && !user.Can(models.PermissionModerateHole, hole.DivisionID) {
+		return utils.NewError(utils.ErrCodeAdminOnly, "非管理员禁止隐藏帖子")
 	}
-	if body.Unhidden != nil && !user.IsAdmin {
-		return common.BadRequest("非管理员禁止取消隐藏")
+	if body.Unhidden != nil && !user.Can(models.PermissionModerateHole, hole.DivisionID) {
+		return utils.NewError(utils.ErrCodeUnhideNotAllowed, "非管理员禁止取消隐藏")
 	}
-	if body.Tags != nil && !(user.IsAdmin) {
-		return common.Forbidden()
+	if body.Tags != nil && !user.Can(models.PermissionModerateHole, hole.DivisionID) {
+		return utils.NewError(utils.ErrCodeAdminOnly, "非管理员禁止修改标签")
 	}
 	if body.Tags != nil && len(body.Tags) == 0 {
-		return common.BadRequest("tags 不能为空")
+		return utils.NewError(utils.ErrCodeTagsRequired, "tags 不能为空")
+	}
+	if body.Lock != nil && !user.Can(models.PermissionModerateHole, hole.DivisionID) {
+		return utils.NewError(utils.ErrCodeAdminOnly, "非管理员禁止锁定帖子")
 	}
-	if body.Lock != nil && !user.IsAdmin {
-		return common.Forbidden("非管理员禁止锁定帖子")
+	if body.HiddenState != nil {
+		return hole.CheckHiddenState(user, *body.HiddenState)
 	}
 	return nil
 }
 
 func (body ModifyModel) DoNothing() bool {
-	return body.Hidden == nil && body.Unhidden == nil && body.Tags == nil && body.DivisionID == nil && body.Lock == nil
+	return body.Hidden == nil && body.Unhidden == nil && body.Tags == nil && body.DivisionID == nil && body.Lock == nil &&
+		body.HiddenState == nil
+}
+
+type MoveModel struct {
+	DivisionID int `json:"division_id" validate:"required,min=1"`
+}
+
+type MergeModel struct {
+	// the duplicate hole to merge
+	FromHoleID int `json:"from_hole_id" validate:"required,min=1"`
+}
+
+type ListHotModel struct {
+	// 0 for all divisions
+	DivisionID int `json:"division_id" query:"division_id" default:"0" validate:"min=0"`
+	Offset     int `json:"offset" query:"offset" default:"0" validate:"min=0"`
+	Size       int `json:"size" query:"size" default:"10" validate:"min=1,max=30"`
+	// comma separated fields to return, see QueryTime
+	Fields string `json:"fields" query:"fields"`
+}
+
+type ListRecommendationsModel struct {
+	Size int `json:"size" query:"size" default:"10" validate:"min=1,max=30"`
+	// comma separated fields to return, see QueryTime
+	Fields string `json:"fields" query:"fields"`
+}
+
+type ListSimilarModel struct {
+	Size int `json:"size" query:"size" default:"5" validate:"min=1,max=10"`
+	// comma separated fields to return, see QueryTime
+	Fields string `json:"fields" query:"fields"`
+}
+
+type MuteResponse struct {
+	Message string `json:"message"`
+	Muted   bool   `json:"muted"`
+}
+
+type RandomModel struct {
+	// 0 for all divisions
+	DivisionID int    `json:"division_id" query:"division_id" default:"0" validate:"min=0"`
+	Tag        string `json:"tag" query:"tag"`
+	// created at or after start_time and before end_time
+	StartTime common.CustomTime `json:"start_time" query:"start_time" swaggertype:"string"`
+	EndTime   common.CustomTime `json:"end_time" query:"end_time" swaggertype:"string"`
+	// comma separated fields to return, see QueryTime
+	Fields string `json:"fields" query:"fields"`
+}
+
+type PreviewModel struct {
+	CreateModel
+	DivisionID int `json:"division_id" validate:"omitempty,min=1" default:"1"`
+}
+
+type PreviewResponse struct {
+	// content as it would be posted, external links may be rewritten, see LinkRules
+	Content string `json:"content"`
+	// reason the floor would be folded for, empty if not folded
+	Fold string `json:"fold"`
+	// the floor would be hidden from others until reviewed by moderators
+	Sensitive bool `json:"sensitive"`
+	// admin only
+	SensitiveDetail string `json:"sensitive_detail,omitempty"`
+	// tags of similar holes, excluding tags of the request
+	SuggestedTags []models.TagSuggestion `json:"suggested_tags"`
+	// errors the hole would be rejected for
+	Warnings []*utils.Error `json:"warnings"`
+}
+
+type AutoTagModel struct {
+	// untagged holes created in the last days
+	Days int `json:"days" default:"1" validate:"min=1,max=30"`
+	Size int `json:"size" default:"100" validate:"min=1,max=1000"`
+	// apply suggestions as machine tags, otherwise only suggest
+	Apply bool `json:"apply"`
+	// defaults to AUTO_TAG_MIN_SCORE
+	MinScore *float64 `json:"min_score" validate:"omitempty,min=0"`
+}
+
+type CreateRaffleModel struct {
+	// reply: users replying before the deadline enter, like: users liking the first floor
+	Entry    string    `json:"entry" validate:"required,oneof=reply like"`
+	Winners  int       `json:"winners" validate:"required,min=1,max=100"`
+	Deadline time.Time `json:"deadline" validate:"required"`
+}
+
+type LegalHoldModel struct {
+	// place under legal hold or release
+	Hold *bool `json:"hold" validate:"required"`
+	// kept in the admin log
+	Reason string `json:"reason" validate:"required,max=1000"`
 }
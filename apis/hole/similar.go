@@ -0,0 +1,64 @@
+package hole
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// ListSimilarHoles
+//
+// @Summary List Holes Similar To A Hole
+// @Description Related holes by elasticsearch more-like-this, or by shared tags if it is unavailable.
+// @Tags Hole
+// @Produce json
+// @Router /holes/{id}/similar [get]
+// @Param id path int true "id"
+// @Param object query ListSimilarModel false "query"
+// @Success 200 {array} Hole
+// @Failure 404 {object} MessageModel
+func ListSimilarHoles(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	var query ListSimilarModel
+	err = common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+
+	querySet, err := MakeHoleQuerySet(c)
+	if err != nil {
+		return err
+	}
+	var hole Hole
+	err = querySet.Take(&hole, id).Error
+	if err != nil {
+		return err
+	}
+
+	holeIDs, err := SimilarHoleIDs(&hole)
+	if err != nil {
+		return err
+	}
+
+	holes := Holes{}
+	if len(holeIDs) > 0 {
+		// cached ids may be hidden or invisible to the user since
+		querySet, err = MakeHoleQuerySet(c)
+		if err != nil {
+			return err
+		}
+		err = querySet.Find(&holes, holeIDs).Error
+		if err != nil {
+			return err
+		}
+		holes = OrderInGivenOrder(holes, holeIDs)
+		holes = holes[:min(len(holes), query.Size)]
+	}
+
+	return Serialize(c, &holes, SerializeOptions{Fields: query.Fields})
+}
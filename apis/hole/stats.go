@@ -0,0 +1,44 @@
+package hole
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// GetHoleStats
+//
+// @Summary Get Stats Of A Hole
+// @Description Floors over time, participants, like distribution and top terms of a hole, computed in background
+// @Description and cached for an hour. Responds 202 while computing, retry after a few seconds.
+// @Tags Hole
+// @Produce json
+// @Router /holes/{id}/stats [get]
+// @Param id path int true "id"
+// @Success 200 {object} HoleStats
+// @Success 202 {object} MessageModel
+// @Failure 404 {object} common.HttpError
+func GetHoleStats(c *fiber.Ctx) error {
+	holeID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	querySet, err := MakeHoleQuerySet(c)
+	if err != nil {
+		return err
+	}
+	var hole Hole
+	err = querySet.Select("id").Take(&hole, holeID).Error
+	if err != nil {
+		return err
+	}
+
+	stats := LoadHoleStats(holeID)
+	if stats == nil {
+		c.Set(fiber.HeaderRetryAfter, "5")
+		return c.Status(fiber.StatusAccepted).JSON(Map{"message": Localize(c, "统计中，请稍后重试")})
+	}
+	return c.JSON(stats)
+}
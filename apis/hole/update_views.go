@@ -10,6 +10,7 @@ import (
 	"github.com/rs/zerolog/log"
 
 	. "treehole_next/models"
+	. "treehole_next/utils"
 )
 
 var holeViewsChan = make(chan int, 1000)
@@ -58,10 +59,15 @@ func UpdateHoleViews(ctx context.Context) {
 	for {
 		select {
 		case <-ticker.C:
-			updateHoleViews()
+			// views are kept for the next tick while writers are quiesced for backups
+			TryBackgroundWrite(updateHoleViews)
 		case holeID := <-holeViewsChan:
 			holeViews[holeID]++
 		case <-ctx.Done():
+			// drain views of requests handled before shutdown
+			for len(holeViewsChan) > 0 {
+				holeViews[<-holeViewsChan]++
+			}
 			updateHoleViews()
 			log.Info().Msg("task UpdateHoleViews stopped...")
 			return
@@ -0,0 +1,167 @@
+package link
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"gorm.io/gorm"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// RedirectLink
+//
+// @Summary Redirect to an external link
+// @Description Links in floors are rewritten to here if LINK_REDIRECT_URL is set. Links to allowed domains are
+// @Description redirected directly, links to blocked domains are rejected, others respond a warning until confirmed.
+// @Tags Link
+// @Produce application/json
+// @Router /links/redirect [get]
+// @Param object query RedirectModel true "query"
+// @Success 200 {object} RedirectResponse
+// @Success 302
+func RedirectLink(c *fiber.Ctx) error {
+	var query RedirectModel
+	err := common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+	scheme, _, _ := strings.Cut(strings.ToLower(query.URL), "://")
+	host := LinkHost(query.URL)
+	if scheme != "http" && scheme != "https" || host == "" {
+		return common.BadRequest("链接无效")
+	}
+
+	rules, err := LoadLinkRules()
+	if err != nil {
+		return err
+	}
+	rule := rules.Match(host)
+	if rule != nil && rule.Action == LinkActionBlock {
+		return NewError(ErrCodeLinkBlocked, "该链接已被禁止访问")
+	}
+	if query.Confirm || rule != nil && rule.Action == LinkActionAllow {
+		return c.Redirect(query.URL)
+	}
+	return c.JSON(RedirectResponse{
+		URL:     query.URL,
+		Host:    host,
+		Message: Localize(c, "您即将离开树洞，前往外部网站，请注意账号和财产安全"),
+	})
+}
+
+// ListLinkRules
+//
+// @Summary List Link Rules
+// @Description Moderator only.
+// @Tags Link
+// @Produce application/json
+// @Router /link_rules [get]
+// @Success 200 {array} models.LinkRule
+func ListLinkRules(c *fiber.Ctx) error {
+	rules, err := LoadLinkRules()
+	if err != nil {
+		return err
+	}
+	return c.JSON(rules)
+}
+
+// AddLinkRule
+//
+// @Summary Add A Link Rule
+// @Description Allow, fold or block links to a domain and its subdomains, replacing the rule of the same domain. Moderator only.
+// @Tags Link
+// @Accept application/json
+// @Produce application/json
+// @Router /link_rules [post]
+// @Param json body CreateModel true "json"
+// @Success 201 {object} models.LinkRule
+func AddLinkRule(c *fiber.Ctx) error {
+	var body CreateModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	rule := LinkRule{
+		Domain:    strings.ToLower(strings.TrimSuffix(body.Domain, ".")),
+		Action:    body.Action,
+		Reason:    body.Reason,
+		CreatedBy: user.ID,
+	}
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("domain = ?", rule.Domain).Delete(&LinkRule{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Create(&rule).Error
+		if err != nil {
+			return err
+		}
+		CreateAdminLog(tx, AdminLogTypeLinkRule, user.ID, Map{
+			"domain": rule.Domain,
+			"action": rule.Action,
+			"reason": rule.Reason,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = DeleteLinkRulesCache()
+	if err != nil {
+		return err
+	}
+	return c.Status(201).JSON(&rule)
+}
+
+// DeleteLinkRule
+//
+// @Summary Delete A Link Rule
+// @Description Moderator only.
+// @Tags Link
+// @Router /link_rules/{id} [delete]
+// @Param id path int true "id"
+// @Success 204
+// @Failure 404 {object} common.HttpError
+func DeleteLinkRule(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	var rule LinkRule
+	err = RequestDB(c).Take(&rule, id).Error
+	if err != nil {
+		return err
+	}
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Delete(&rule).Error
+		if err != nil {
+			return err
+		}
+		CreateAdminLog(tx, AdminLogTypeLinkRule, user.ID, Map{
+			"domain": rule.Domain,
+			"action": "delete",
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = DeleteLinkRulesCache()
+	if err != nil {
+		return err
+	}
+	return c.SendStatus(204)
+}
@@ -0,0 +1,14 @@
+package link
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"treehole_next/models"
+)
+
+func RegisterRoutes(app fiber.Router) {
+	app.Get("/links/redirect", RedirectLink)
+	app.Get("/link_rules", models.MiddlewarePermission(models.PermissionManageLinkRule), ListLinkRules)
+	app.Post("/link_rules", models.MiddlewarePermission(models.PermissionManageLinkRule), AddLinkRule)
+	app.Delete("/link_rules/:id<int>", models.MiddlewarePermission(models.PermissionManageLinkRule), DeleteLinkRule)
+}
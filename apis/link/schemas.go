@@ -0,0 +1,21 @@
+package link
+
+type CreateModel struct {
+	// subdomains are matched too, e.g. example.com matches www.example.com
+	Domain string `json:"domain" validate:"required,fqdn,max=128"`
+	// allow: not rewritten to the redirect endpoint; fold: floors are folded; block: floors are rejected
+	Action string `json:"action" validate:"required,oneof=allow fold block"`
+	Reason string `json:"reason" validate:"max=64"`
+}
+
+type RedirectModel struct {
+	URL string `json:"url" query:"url" validate:"required,url,max=2048"`
+	// skip the warning of external sites
+	Confirm bool `json:"confirm" query:"confirm"`
+}
+
+type RedirectResponse struct {
+	URL     string `json:"url"`
+	Host    string `json:"host"`
+	Message string `json:"message"`
+}
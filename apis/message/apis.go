@@ -31,7 +31,7 @@ func ListMessages(c *fiber.Ctx) error {
 	messages := Messages{}
 
 	if query.NotRead {
-		DB.Raw(`
+		RequestDB(c).Raw(`
 			SELECT message.*,message_user.has_read FROM message
 			INNER JOIN message_user 
 			WHERE message.id = message_user.message_id and message_user.user_id = ? and message_user.has_read = false
@@ -39,7 +39,7 @@ func ListMessages(c *fiber.Ctx) error {
 			userID,
 		).Scan(&messages)
 	} else {
-		DB.Raw(`
+		RequestDB(c).Raw(`
 			SELECT message.*,message_user.has_read FROM message
 			INNER JOIN message_user
 			WHERE message.id = message_user.message_id and message_user.user_id = ?
@@ -72,11 +72,6 @@ func SendMail(c *fiber.Ctx) error {
 		return err
 	}
 
-	// permission
-	if !user.IsAdmin {
-		return common.Forbidden()
-	}
-
 	// construct mail
 	mail := Notification{
 		Description: body.Description,
@@ -93,7 +88,7 @@ func SendMail(c *fiber.Ctx) error {
 		return err
 	}
 
-	CreateAdminLog(DB, AdminLogTypeMessage, user.ID, body)
+	CreateAdminLog(RequestDB(c), AdminLogTypeMessage, user.ID, body)
 
 	return Serialize(c.Status(201), &message)
 }
@@ -110,7 +105,7 @@ func ClearMessages(c *fiber.Ctx) error {
 		return err
 	}
 
-	result := DB.Exec(
+	result := RequestDB(c).Exec(
 		"UPDATE message_user SET has_read = true WHERE user_id = ?",
 		userID,
 	)
@@ -145,7 +140,7 @@ func DeleteMessage(c *fiber.Ctx) error {
 	}
 
 	id, _ := c.ParamsInt("id")
-	result := DB.Exec(
+	result := RequestDB(c).Exec(
 		"UPDATE message_user SET has_read = true WHERE user_id = ?  AND message_id = ?",
 		userID, id,
 	)
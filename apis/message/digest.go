@@ -0,0 +1,27 @@
+package message
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	. "treehole_next/models"
+)
+
+// SendDigests sends daily digests of users choosing the current hour, see FlushDigests
+func SendDigests(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := FlushDigests(time.Now())
+			if err != nil {
+				log.Err(err).Msg("error send digests")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package message
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+
+	. "treehole_next/models"
+	"treehole_next/utils"
+)
+
+const retryBatchSize = 100
+
+// RetryNotificationPushes retries failed pushes to the notification service, see NotificationJob
+func RetryNotificationPushes(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for {
+				n, err := RetryNotifications(retryBatchSize)
+				if err != nil {
+					log.Err(err).Msg("error retry notifications")
+				}
+				if err != nil || n < retryBatchSize {
+					break
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ListDeadLetters
+//
+// @Summary List Dead-lettered Notifications
+// @Description Pushes to the notification service failed after all retries, newest first. Admin only.
+// @Tags Message
+// @Produce application/json
+// @Router /messages/dead_letters [get]
+// @Param object query ListDeadLettersModel false "query"
+// @Success 200 {array} NotificationJob
+func ListDeadLetters(c *fiber.Ctx) error {
+	var query ListDeadLettersModel
+	err := common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+
+	jobs, err := ListDeadNotifications(query.Offset, query.Size)
+	if err != nil {
+		return err
+	}
+	return c.JSON(jobs)
+}
+
+// RetryDeadLetters
+//
+// @Summary Retry Dead-lettered Notifications
+// @Description Move all dead letters back to the retry queue. Admin only.
+// @Tags Message
+// @Produce application/json
+// @Router /messages/dead_letters/_retry [post]
+// @Success 200 {object} RetryDeadLettersResponse
+func RetryDeadLetters(c *fiber.Ctx) error {
+	count, err := RequeueDeadNotifications()
+	if err != nil {
+		return err
+	}
+	return c.JSON(RetryDeadLettersResponse{Message: utils.Localize(c, "已重新加入推送队列"), Count: count})
+}
@@ -1,12 +1,18 @@
 package message
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"treehole_next/models"
+)
 
 func RegisterRoutes(app fiber.Router) {
-	app.Post("/messages", SendMail)
+	app.Post("/messages", models.MiddlewarePermission(models.PermissionSendMessage), SendMail)
 	app.Get("/messages", ListMessages)
 	app.Post("/messages/clear", ClearMessages)
 	app.Put("/messages", ClearMessagesDeprecated)
 	app.Patch("/messages/_webvpn", ClearMessagesDeprecated)
 	app.Delete("/messages/:id<int>", DeleteMessage)
+	app.Get("/messages/dead_letters", models.MiddlewarePermission(models.PermissionRetryMessage), ListDeadLetters)
+	app.Post("/messages/dead_letters/_retry", models.MiddlewarePermission(models.PermissionRetryMessage), RetryDeadLetters)
 }
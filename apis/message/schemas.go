@@ -9,3 +9,13 @@ type CreateModel struct {
 type ListModel struct {
 	NotRead bool `json:"not_read" default:"false" query:"not_read"`
 }
+
+type ListDeadLettersModel struct {
+	Offset int `json:"offset" query:"offset" default:"0" validate:"min=0"`
+	Size   int `json:"size" query:"size" default:"30" validate:"min=1,max=100"`
+}
+
+type RetryDeadLettersResponse struct {
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+}
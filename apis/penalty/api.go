@@ -54,23 +54,23 @@ func BanUser(c *fiber.Ctx) error {
 		return err
 	}
 
-	// permission
-	if !user.IsAdmin {
-		return common.Forbidden()
-	}
-
 	var floor Floor
-	err = DB.Take(&floor, floorID).Error
+	err = RequestDB(c).Take(&floor, floorID).Error
 	if err != nil {
 		return err
 	}
 
 	var hole Hole
-	err = DB.Take(&hole, floor.HoleID).Error
+	err = RequestDB(c).Take(&hole, floor.HoleID).Error
 	if err != nil {
 		return err
 	}
 
+	// permission
+	if !user.Can(PermissionPunishUser, hole.DivisionID) {
+		return utils.NewError(utils.ErrCodePermissionDenied, "无权进行此操作")
+	}
+
 	var days int
 	if body.Days != nil {
 		days = *body.Days
@@ -105,6 +105,7 @@ func BanUser(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	TriggerWebhook(WebhookEventPenaltyCreated, &punishment)
 
 	// construct message for user
 	message := Notification{
@@ -156,13 +157,8 @@ func BanUserForever(c *fiber.Ctx) error {
 		return err
 	}
 
-	// permission
-	if !user.IsAdmin {
-		return common.Forbidden()
-	}
-
 	var floor Floor
-	err = DB.Take(&floor, floorID).Error
+	err = RequestDB(c).Take(&floor, floorID).Error
 	if err != nil {
 		return err
 	}
@@ -183,7 +179,7 @@ func BanUserForever(c *fiber.Ctx) error {
 	user = &User{
 		ID: floor.UserID,
 	}
-	err = DB.Transaction(func(tx *gorm.DB) (err error) {
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) (err error) {
 		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&user).Error
 		if err != nil {
 			return err
@@ -236,6 +232,7 @@ func BanUserForever(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	TriggerWebhook(WebhookEventPenaltyCreated, punishments)
 
 	// construct message for user
 	message := Notification{
@@ -325,7 +322,7 @@ func listPunishmentsByUserID(userID int) ([]Punishment, error) {
 }
 
 func RegisterRoutes(app fiber.Router) {
-	app.Post("/penalty/:id<int>/_forever", BanUserForever)
+	app.Post("/penalty/:id<int>/_forever", MiddlewarePermission(PermissionPunishUser), BanUserForever)
 	app.Post("/penalty/:id<int>", BanUser)
 	app.Get("/users/me/punishments", ListMyPunishments)
 	app.Get("/users/:id/punishments", ListPunishmentsByUserID)
@@ -31,7 +31,7 @@ func GetReport(c *fiber.Ctx) error {
 
 	// find report
 	var report Report
-	result := LoadReportFloor(DB).First(&report, reportID)
+	result := LoadReportFloor(RequestDB(c)).First(&report, reportID)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -101,14 +101,18 @@ func AddReport(c *fiber.Ctx) error {
 
 	// permission
 	if user.BanReport != nil {
-		return common.Forbidden(user.BanReportMessage())
+		return NewError(ErrCodeBannedFromReport, user.BanReportMessage())
+	}
+	if body.Category == ReportCategoryOther && body.Reason == "" {
+		return common.BadRequest("请填写举报理由")
 	}
 
 	// add report
 	report := Report{
-		FloorID: body.FloorID,
-		Reason:  body.Reason,
-		Dealt:   false,
+		FloorID:  body.FloorID,
+		Category: body.Category,
+		Reason:   body.Reason,
+		Dealt:    false,
 	}
 	err = report.Create(c)
 	if err != nil {
@@ -116,11 +120,12 @@ func AddReport(c *fiber.Ctx) error {
 	}
 
 	// Send Notification
-	err = report.SendCreate(DB)
+	err = report.SendCreate(RequestDB(c))
 	if err != nil {
 		log.Err(err).Str("model", "Notification").Msg("SendCreate failed: ")
 		// return err // only for test
 	}
+	TriggerWebhook(WebhookEventReportCreated, &report)
 
 	return c.Status(204).JSON(nil)
 }
@@ -158,20 +163,24 @@ func DeleteReport(c *fiber.Ctx) error {
 
 	// modify report
 	var report Report
-	result := LoadReportFloor(DB).First(&report, reportID)
+	result := LoadReportFloor(RequestDB(c)).First(&report, reportID)
 	if result.Error != nil {
 		return result.Error
 	}
 	report.Dealt = true
 	report.DealtBy = userID
 	report.Result = body.Result
-	DB.Omit("Floor").Save(&report)
+	report.Outcome = body.Outcome
+	RequestDB(c).Omit("Floor").Save(&report)
 
 	MyLog("Report", "Delete", reportID, userID, RoleAdmin)
-	CreateAdminLog(DB, AdminLogTypeDeleteReport, userID, report)
+	CreateAdminLog(RequestDB(c), AdminLogTypeDeleteReport, userID, report)
+	if report.Outcome == ReportOutcomeRemoved {
+		TriggerBadges(report.UserID, BadgeEventReport)
+	}
 
 	// Send Notification
-	err = report.SendModify(DB)
+	err = report.SendModify(RequestDB(c))
 	if err != nil {
 		log.Err(err).Str("model", "Notification").Msg("SendModify failed")
 		// return err // only for test
@@ -212,13 +221,8 @@ func BanReporter(c *fiber.Ctx) error {
 		return err
 	}
 
-	// permission
-	if !user.IsAdmin {
-		return common.Forbidden()
-	}
-
 	var report Report
-	err = DB.Take(&report, reportID).Error
+	err = RequestDB(c).Take(&report, reportID).Error
 	if err != nil {
 		return err
 	}
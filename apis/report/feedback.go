@@ -0,0 +1,116 @@
+package report
+
+import (
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"gorm.io/gorm"
+
+	. "treehole_next/models"
+)
+
+func feedbackOutcome(c *fiber.Ctx) (string, error) {
+	outcome := c.Params("outcome")
+	if !slices.ContainsFunc(DefaultReportFeedbackTemplates, func(template ReportFeedbackTemplate) bool {
+		return template.Outcome == outcome
+	}) {
+		return "", common.NotFound("处理结果不存在")
+	}
+	return outcome, nil
+}
+
+// ListFeedbackTemplates
+//
+// @Summary List templates of messages sent to reporters when reports are dealt, by outcome
+// @Tags Report
+// @Produce application/json
+// @Router /admin/report_feedback_templates [get]
+// @Success 200 {array} models.ReportFeedbackTemplate
+func ListFeedbackTemplates(c *fiber.Ctx) error {
+	templates, err := LoadReportFeedbackTemplates()
+	if err != nil {
+		return err
+	}
+	return c.JSON(templates)
+}
+
+// ModifyFeedbackTemplate
+//
+// @Summary Modify the template of an outcome
+// @Description Outcome is removed, no_violation or default, the default is used if dealt without an outcome.
+// @Tags Report
+// @Accept application/json
+// @Produce application/json
+// @Router /admin/report_feedback_templates/{outcome} [put]
+// @Param outcome path string true "outcome"
+// @Param json body FeedbackTemplateModel true "json"
+// @Success 200 {object} models.ReportFeedbackTemplate
+func ModifyFeedbackTemplate(c *fiber.Ctx) error {
+	outcome, err := feedbackOutcome(c)
+	if err != nil {
+		return err
+	}
+	var body FeedbackTemplateModel
+	err = common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	template := ReportFeedbackTemplate{Outcome: outcome, Title: body.Title, Content: body.Content, UpdatedBy: user.ID}
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Save(&template).Error
+		if err != nil {
+			return err
+		}
+		CreateAdminLog(tx, AdminLogTypeFeedback, user.ID, template)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = DeleteReportFeedbackTemplatesCache()
+	if err != nil {
+		return err
+	}
+	return c.JSON(&template)
+}
+
+// ResetFeedbackTemplate
+//
+// @Summary Reset the template of an outcome to the default
+// @Tags Report
+// @Router /admin/report_feedback_templates/{outcome} [delete]
+// @Param outcome path string true "outcome"
+// @Success 204
+func ResetFeedbackTemplate(c *fiber.Ctx) error {
+	outcome, err := feedbackOutcome(c)
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("outcome = ?", outcome).Delete(&ReportFeedbackTemplate{}).Error
+		if err != nil {
+			return err
+		}
+		CreateAdminLog(tx, AdminLogTypeFeedback, user.ID, Map{"outcome": outcome, "action": "reset"})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = DeleteReportFeedbackTemplatesCache()
+	if err != nil {
+		return err
+	}
+	return c.SendStatus(204)
+}
@@ -0,0 +1,98 @@
+package report
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+
+	. "treehole_next/models"
+)
+
+// ListJuryReports
+//
+// @Summary List reports to vote on, jurors only
+// @Description Users opted in with config.jury and reputation high enough are jurors. Reports are anonymized,
+// @Description those reported or posted by the juror and voted already are not included.
+// @Tags Report
+// @Produce application/json
+// @Router /reports/jury [get]
+// @Param object query JuryListModel false "query"
+// @Success 200 {array} models.JuryReport
+func ListJuryReports(c *fiber.Ctx) error {
+	var query JuryListModel
+	err := common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	err = user.CheckJuror()
+	if err != nil {
+		return err
+	}
+
+	reports, err := LoadJuryReports(user, query.Size)
+	if err != nil {
+		return err
+	}
+	return c.JSON(reports)
+}
+
+// VoteReport
+//
+// @Summary Vote to hide or keep the reported content, jurors only
+// @Description The verdict of the majority is applied when votes reach the quorum, ties keep the content.
+// @Tags Report
+// @Accept application/json
+// @Produce application/json
+// @Router /reports/{id}/vote [post]
+// @Param id path int true "id"
+// @Param json body VoteModel true "json"
+// @Success 200 {object} VoteResponse
+func VoteReport(c *fiber.Ctx) error {
+	reportID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	var body VoteModel
+	err = common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	err = user.CheckJuror()
+	if err != nil {
+		return err
+	}
+
+	report := Report{ID: reportID}
+	verdict, err := report.Vote(user.ID, body.Vote)
+	if err != nil {
+		return err
+	}
+	return c.JSON(VoteResponse{Verdict: verdict})
+}
+
+// ListReportVotes
+//
+// @Summary List votes on a report for audit, moderator only
+// @Tags Report
+// @Produce application/json
+// @Router /reports/{id}/votes [get]
+// @Param id path int true "id"
+// @Success 200 {array} models.ReportVote
+func ListReportVotes(c *fiber.Ctx) error {
+	reportID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	votes, err := LoadReportVotes(reportID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(votes)
+}
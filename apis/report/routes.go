@@ -1,12 +1,24 @@
 package report
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"treehole_next/models"
+)
 
 func RegisterRoutes(app fiber.Router) {
+	app.Get("/reports/jury", ListJuryReports)
+	app.Post("/reports/:id<int>/vote", VoteReport)
+	app.Get("/reports/:id<int>/votes", models.MiddlewarePermission(models.PermissionModerateFloor), ListReportVotes)
 	app.Get("/reports/:id", GetReport)
 	app.Get("/reports", ListReports)
-	app.Post("/reports", AddReport)
+	app.Post("/reports", models.MiddlewareAPIKeyScope(models.ScopeReportsWrite), AddReport)
 	app.Delete("/reports/:id", DeleteReport)
 
-	app.Post("/reports/ban/:id", BanReporter)
+	app.Get("/admin/reports/stats", models.MiddlewarePermission(models.PermissionModerateFloor), GetReportStats)
+	app.Get("/admin/report_feedback_templates", models.MiddlewarePermission(models.PermissionSendMessage), ListFeedbackTemplates)
+	app.Put("/admin/report_feedback_templates/:outcome", models.MiddlewarePermission(models.PermissionSendMessage), ModifyFeedbackTemplate)
+	app.Delete("/admin/report_feedback_templates/:outcome", models.MiddlewarePermission(models.PermissionSendMessage), ResetFeedbackTemplate)
+
+	app.Post("/reports/ban/:id", models.MiddlewarePermission(models.PermissionBanReporter), BanReporter)
 }
@@ -2,6 +2,7 @@ package report
 
 import (
 	"fmt"
+	"time"
 
 	"gorm.io/gorm"
 
@@ -30,15 +31,66 @@ func (q *ListModel) BaseQuery() *gorm.DB {
 	return DB.
 		Limit(q.Size).
 		Offset(q.Offset).
-		Order(fmt.Sprintf("`report`.`%s` %s", q.OrderBy, q.Sort))
+		Order(fmt.Sprintf("%s %s", Quote("report."+q.OrderBy), q.Sort))
 }
 
 type AddModel struct {
-	FloorID int    `json:"floor_id" validate:"required"`
-	Reason  string `json:"reason" validate:"required,max=128"`
+	FloorID int `json:"floor_id" validate:"required"`
+	// spam, abuse, porn, illegal, privacy, misinformation or other
+	Category string `json:"category" default:"other" validate:"oneof=spam abuse porn illegal privacy misinformation other"`
+	// detail of the reason, required if the category is other
+	Reason string `json:"reason" validate:"max=128"`
 }
 
 type DeleteModel struct {
 	// The deal result, send it to reporter
 	Result string `json:"result" validate:"required,max=128"`
+	// removed: the content is removed; no_violation: the content is kept
+	Outcome string `json:"outcome" validate:"omitempty,oneof=removed no_violation"`
+}
+
+type JuryListModel struct {
+	Size int `json:"size" query:"size" default:"10" validate:"min=1,max=30"`
+}
+
+type VoteModel struct {
+	// hide or keep the reported content
+	Vote string `json:"vote" validate:"required,oneof=hide keep"`
+}
+
+type VoteResponse struct {
+	// hide or keep if the verdict is applied by this vote, empty if votes are not enough yet
+	Verdict string `json:"verdict"`
+}
+
+type FeedbackTemplateModel struct {
+	Title string `json:"title" validate:"required,max=64"`
+	// placeholders {result}, {category}, {reason}, {floor_id} and {hole_id} are replaced
+	Content string `json:"content" validate:"required,max=1024"`
+}
+
+type StatsModel struct {
+	// stats of the last days
+	Days int `json:"days" query:"days" default:"30" validate:"min=1,max=365"`
+	// reports are counted by day, week or month
+	Bucket string `json:"bucket" query:"bucket" default:"day" validate:"oneof=day week month"`
+}
+
+type StatsResponse struct {
+	Total int `json:"total"`
+	// counts by category
+	ByCategory map[string]int `json:"by_category"`
+	// counts by division id
+	ByDivision map[int]int `json:"by_division"`
+	// counts by outcome, pending if not dealt, unspecified if dealt without an outcome
+	ByOutcome map[string]int `json:"by_outcome"`
+	// buckets without reports are omitted
+	Buckets []StatsBucket `json:"buckets"`
+}
+
+type StatsBucket struct {
+	Time       time.Time      `json:"time"`
+	Total      int            `json:"total"`
+	ByCategory map[string]int `json:"by_category"`
+	ByOutcome  map[string]int `json:"by_outcome"`
 }
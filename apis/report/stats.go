@@ -0,0 +1,91 @@
+package report
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+
+	. "treehole_next/models"
+)
+
+// GetReportStats
+//
+// @Summary Get stats of reports by category, division and outcome
+// @Tags Report
+// @Produce application/json
+// @Router /admin/reports/stats [get]
+// @Param object query StatsModel false "query"
+// @Success 200 {object} StatsResponse
+func GetReportStats(c *fiber.Ctx) error {
+	var query StatsModel
+	err := common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+
+	since := StartOfDay(time.Now()).AddDate(0, 0, -query.Days)
+	var reports []struct {
+		CreatedAt  time.Time
+		Category   string
+		Dealt      bool
+		Outcome    string
+		DivisionID int
+	}
+	err = RequestDB(c).Table("report").
+		Select("report.created_at, report.category, report.dealt, report.outcome, hole.division_id").
+		Joins("JOIN floor ON floor.id = report.floor_id").
+		Joins("JOIN hole ON hole.id = floor.hole_id").
+		Where("report.created_at >= ?", since).
+		Order("report.created_at").
+		Scan(&reports).Error
+	if err != nil {
+		return err
+	}
+
+	response := StatsResponse{
+		ByCategory: make(map[string]int),
+		ByDivision: make(map[int]int),
+		ByOutcome:  make(map[string]int),
+		Buckets:    make([]StatsBucket, 0),
+	}
+	for _, report := range reports {
+		outcome := "pending"
+		if report.Dealt {
+			outcome = report.Outcome
+			if outcome == "" {
+				outcome = "unspecified"
+			}
+		}
+		response.Total++
+		response.ByCategory[report.Category]++
+		response.ByDivision[report.DivisionID]++
+		response.ByOutcome[outcome]++
+
+		start := bucketStart(report.CreatedAt, query.Bucket)
+		if n := len(response.Buckets); n == 0 || !response.Buckets[n-1].Time.Equal(start) {
+			response.Buckets = append(response.Buckets, StatsBucket{
+				Time:       start,
+				ByCategory: make(map[string]int),
+				ByOutcome:  make(map[string]int),
+			})
+		}
+		bucket := &response.Buckets[len(response.Buckets)-1]
+		bucket.Total++
+		bucket.ByCategory[report.Category]++
+		bucket.ByOutcome[outcome]++
+	}
+	return c.JSON(&response)
+}
+
+func bucketStart(date time.Time, bucket string) time.Time {
+	date = StartOfDay(date)
+	switch bucket {
+	case "week":
+		// weeks start on monday
+		return date.AddDate(0, 0, -(int(date.Weekday())+6)%7)
+	case "month":
+		return date.AddDate(0, 0, 1-date.Day())
+	}
+	return date
+}
@@ -0,0 +1,62 @@
+package retention
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+
+	"treehole_next/config"
+	. "treehole_next/models"
+)
+
+// RunRetention
+//
+// @Summary Run retention policies, admin only
+// @Description Policies are enabled by DELETED_FLOOR_RETENTION_DAYS, MESSAGE_PURGE_DAYS and FLOOR_HISTORY_COMPRESS_DAYS.
+// @Description Use dry_run to count rows to purge.
+// @Tags Retention
+// @Accept application/json
+// @Produce application/json
+// @Router /retention/_run [post]
+// @Param json body RunModel true "json"
+// @Success 200 {object} RunResponse
+func RunRetention(c *fiber.Ctx) error {
+	var body RunModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	counts, err := RunRetentionPolicies(time.Now(), body.DryRun)
+	if err != nil {
+		return err
+	}
+	if !body.DryRun {
+		CreateAdminLog(RequestDB(c), AdminLogTypeRetention, user.ID, Map{"counts": counts})
+	}
+	return c.JSON(RunResponse{DryRun: body.DryRun, Counts: counts})
+}
+
+// PurgeExpiredData runs retention policies daily, only counting rows if RETENTION_DRY_RUN
+func PurgeExpiredData(ctx context.Context) {
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_, err := RunRetentionPolicies(time.Now(), config.Config.RetentionDryRun)
+			if err != nil {
+				log.Err(err).Msg("error run retention policies")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package retention
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"treehole_next/models"
+)
+
+func RegisterRoutes(app fiber.Router) {
+	app.Post("/retention/_run", models.MiddlewarePermission(models.PermissionRunRetention), RunRetention)
+}
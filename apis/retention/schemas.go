@@ -0,0 +1,12 @@
+package retention
+
+type RunModel struct {
+	// count rows to purge without purging
+	DryRun bool `json:"dry_run"`
+}
+
+type RunResponse struct {
+	DryRun bool `json:"dry_run"`
+	// rows purged, or to purge if dry run, of enabled policies
+	Counts map[string]int64 `json:"counts"`
+}
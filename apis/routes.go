@@ -1,23 +1,42 @@
 package apis
 
 import (
+	"strconv"
+
 	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
 
+	"treehole_next/apis/activity"
+	"treehole_next/apis/apikey"
+	"treehole_next/apis/appeal"
+	"treehole_next/apis/backup"
+	"treehole_next/apis/batch"
+	"treehole_next/apis/bot"
+	"treehole_next/apis/course"
 	"treehole_next/apis/division"
 	"treehole_next/apis/favourite"
+	"treehole_next/apis/feed"
 	"treehole_next/apis/floor"
+	"treehole_next/apis/graphql"
 	"treehole_next/apis/hole"
+	"treehole_next/apis/link"
 	"treehole_next/apis/message"
 	"treehole_next/apis/penalty"
 	"treehole_next/apis/report"
+	"treehole_next/apis/retention"
 	"treehole_next/apis/subscription"
 	"treehole_next/apis/tag"
+	"treehole_next/apis/tenant"
 	"treehole_next/apis/user"
+	"treehole_next/apis/webhook"
 	"treehole_next/config"
 	_ "treehole_next/docs"
 	"treehole_next/models"
+	"treehole_next/utils"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	fiberSwagger "github.com/swaggo/fiber-swagger"
 )
 
@@ -29,6 +48,9 @@ func registerRoutes(app *fiber.App) {
 		return c.Redirect("/docs/index.html")
 	})
 	app.Get("/docs/*", fiberSwagger.WrapHandler)
+	app.Get("/healthz", Healthz)
+	app.Get("/readyz", Readyz)
+	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
 }
 
 func RegisterRoutes(app *fiber.App) {
@@ -36,7 +58,12 @@ func RegisterRoutes(app *fiber.App) {
 
 	group := app.Group("/api")
 	group.Get("/", Index)
+	group.Use(MiddlewareTenant)
+	feed.RegisterRoutes(group)
+	floor.RegisterCallbackRoutes(group)
+	group.Use(models.MiddlewareAPIKey)
 	group.Use(MiddlewareGetUser)
+	group.Use(MiddlewareActAs)
 	division.RegisterRoutes(group)
 	tag.RegisterRoutes(group)
 	hole.RegisterRoutes(group)
@@ -47,18 +74,94 @@ func RegisterRoutes(app *fiber.App) {
 	penalty.RegisterRoutes(group)
 	user.RegisterRoutes(group)
 	message.RegisterRoutes(group)
+	graphql.RegisterRoutes(group)
+	batch.RegisterRoutes(group)
+	webhook.RegisterRoutes(group)
+	tenant.RegisterRoutes(group)
+	apikey.RegisterRoutes(group)
+	link.RegisterRoutes(group)
+	appeal.RegisterRoutes(group)
+	bot.RegisterRoutes(group)
+	activity.RegisterRoutes(group)
+	course.RegisterRoutes(group)
+	retention.RegisterRoutes(group)
+	backup.RegisterRoutes(group)
+}
+
+// MiddlewareTenant scopes the request to the tenant of X-Tenant header or subdomain
+func MiddlewareTenant(c *fiber.Ctx) error {
+	tenant, err := models.ResolveTenant(c)
+	if err != nil {
+		return err
+	}
+	c.Locals("tenant", tenant)
+	c.Vary("X-Tenant")
+	return c.Next()
 }
 
 func MiddlewareGetUser(c *fiber.Ctx) error {
+	// authenticated by models.MiddlewareAPIKey, or on routes with models.MiddlewareAPIKeyScope
+	if models.GetAPIKey(c) != nil {
+		if models.GetTenant(c).AdminOnly() {
+			return common.Forbidden()
+		}
+		return c.Next()
+	}
+
 	userObject, err := models.GetCurrLoginUser(c)
 	if err != nil {
 		return err
 	}
 	c.Locals("user", userObject)
-	if config.Config.AdminOnly {
+	if models.GetTenant(c).AdminOnly() {
 		if !userObject.IsAdmin {
 			return common.Forbidden()
 		}
 	}
 	return c.Next()
 }
+
+// MiddlewareActAs lets admins send read-only requests as the user of X-Act-As header,
+// to see what the user sees when debugging complaints. Every request acted as is saved in admin logs.
+func MiddlewareActAs(c *fiber.Ctx) error {
+	header := c.Get("X-Act-As")
+	if header == "" {
+		return c.Next()
+	}
+	if !config.Config.ActAsEnabled {
+		return utils.NewError(utils.ErrCodeActAsDisabled, "代理用户功能未开启")
+	}
+	admin, err := models.GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	if !admin.IsAdmin {
+		return utils.NewError(utils.ErrCodeAdminOnly, "仅管理员可操作")
+	}
+	if c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead {
+		return utils.NewError(utils.ErrCodeActAsReadOnly, "代理用户时只能发送只读请求")
+	}
+	userID, err := strconv.Atoi(header)
+	if err != nil || userID <= 0 {
+		return utils.NewError(utils.ErrCodeInvalidRequest, "X-Act-As 必须为用户 ID")
+	}
+
+	user, err := models.LoadActAsUser(userID)
+	if err != nil {
+		return err
+	}
+	models.CreateAdminLog(models.DB, models.AdminLogTypeActAs, admin.ID, fiber.Map{
+		"user_id": userID,
+		"method":  c.Method(),
+		"url":     c.OriginalURL(),
+	})
+	log.Ctx(c.UserContext()).Info().Int("admin_id", admin.ID).Int("user_id", userID).
+		Str("url", c.OriginalURL()).Msg("admin acts as user")
+
+	// handlers get the user from locals, or the user id from X-Consumer-Username
+	c.Locals("user", user)
+	c.Locals("act_as_admin_id", admin.ID)
+	c.Request().Header.Set("X-Consumer-Username", strconv.Itoa(userID))
+	c.Set("X-Act-As", strconv.Itoa(userID))
+	return c.Next()
+}
@@ -16,6 +16,7 @@ import (
 // @Tags Subscription
 // @Produce application/json
 // @Router /users/subscriptions [get]
+// @Router /user/subscriptions/holes [get]
 // @Param object query ListModel false "query"
 // @Success 200 {object} models.Map
 // @Success 200 {array} models.Hole
@@ -33,14 +34,14 @@ func ListSubscriptions(c *fiber.Ctx) error {
 	}
 
 	if query.Plain {
-		data, err := UserGetSubscriptionData(DB, userID)
+		data, err := UserGetSubscriptionData(RequestDB(c), userID)
 		if err != nil {
 			return err
 		}
 		return c.JSON(Map{"data": data})
 	} else {
 		holes := make(Holes, 0)
-		err := DB.
+		err := RequestDB(c).
 			Joins("JOIN user_subscription ON user_subscription.hole_id = hole.id AND user_subscription.user_id = ?", userID).
 			Order("user_subscription.created_at desc").Find(&holes).Error
 		if err != nil {
@@ -75,7 +76,7 @@ func AddSubscription(c *fiber.Ctx) error {
 
 	var data []int
 
-	err = DB.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+	err = RequestDB(c).Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
 		// add favorites
 		err = AddUserSubscription(tx, userID, body.HoleID)
 		if err != nil {
@@ -91,7 +92,7 @@ func AddSubscription(c *fiber.Ctx) error {
 	}
 
 	return c.Status(201).JSON(&Response{
-		Message: "关注成功",
+		Message: Localize(c, "关注成功"),
 		Data:    data,
 	})
 }
@@ -120,19 +121,95 @@ func DeleteSubscription(c *fiber.Ctx) error {
 	}
 
 	// delete subscriptions
-	err = DB.Delete(UserSubscription{UserID: userID, HoleID: body.HoleID}).Error
+	err = RequestDB(c).Delete(UserSubscription{UserID: userID, HoleID: body.HoleID}).Error
 	if err != nil {
 		return err
 	}
 
 	// create response
-	data, err := UserGetSubscriptionData(DB, userID)
+	data, err := UserGetSubscriptionData(RequestDB(c), userID)
 	if err != nil {
 		return err
 	}
 
 	return c.JSON(&Response{
-		Message: "删除成功",
+		Message: Localize(c, "删除成功"),
+		Data:    data,
+	})
+}
+
+// BatchAddSubscriptions
+//
+// @Summary Subscribe Holes
+// @Description Subscribed holes notify replies without being added to favorite groups.
+// @Tags Subscription
+// @Accept application/json
+// @Produce application/json
+// @Router /user/subscriptions/holes [post]
+// @Param json body BatchModel true "json"
+// @Success 201 {object} Response
+// @Failure 404 {object} common.HttpError
+func BatchAddSubscriptions(c *fiber.Ctx) error {
+	var body BatchModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var data []int
+	err = RequestDB(c).Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		err = AddUserSubscriptions(tx, userID, body.HoleIDs)
+		if err != nil {
+			return err
+		}
+		data, err = UserGetSubscriptionData(tx, userID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Status(201).JSON(&Response{
+		Message: Localize(c, "关注成功"),
+		Data:    data,
+	})
+}
+
+// BatchDeleteSubscriptions
+//
+// @Summary Unsubscribe Holes
+// @Tags Subscription
+// @Accept application/json
+// @Produce application/json
+// @Router /user/subscriptions/holes [delete]
+// @Param json body BatchModel true "json"
+// @Success 200 {object} Response
+func BatchDeleteSubscriptions(c *fiber.Ctx) error {
+	var body BatchModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	err = DeleteUserSubscriptions(RequestDB(c), userID, body.HoleIDs)
+	if err != nil {
+		return err
+	}
+	data, err := UserGetSubscriptionData(RequestDB(c), userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(&Response{
+		Message: Localize(c, "删除成功"),
 		Data:    data,
 	})
 }
@@ -7,4 +7,8 @@ func RegisterRoutes(app fiber.Router) {
 	app.Post("/users/subscriptions", AddSubscription)
 	app.Delete("/users/subscriptions", DeleteSubscription)
 	app.Delete("/users/subscription", DeleteSubscription)
+
+	app.Get("/user/subscriptions/holes", ListSubscriptions)
+	app.Post("/user/subscriptions/holes", BatchAddSubscriptions)
+	app.Delete("/user/subscriptions/holes", BatchDeleteSubscriptions)
 }
@@ -16,3 +16,7 @@ type AddModel struct {
 type DeleteModel struct {
 	HoleID int `json:"hole_id"`
 }
+
+type BatchModel struct {
+	HoleIDs []int `json:"hole_ids" validate:"required,min=1,max=100"`
+}
@@ -6,13 +6,11 @@ import (
 	"treehole_next/utils/sensitive"
 
 	"github.com/opentreehole/go-common"
-	"gorm.io/plugin/dbresolver"
 
 	. "treehole_next/models"
 	. "treehole_next/utils"
 
 	"github.com/gofiber/fiber/v2"
-	"gorm.io/gorm"
 )
 
 // ListTags
@@ -31,19 +29,20 @@ func ListTags(c *fiber.Ctx) error {
 	}
 
 	tags := make(Tags, 0, 10)
+	tenantID := GetTenant(c).ID
 	if query.Search == "" {
-		if GetCache("tags", &tags) {
+		if GetLocalCache(TagsCacheKey(tenantID), &tags) {
 			return c.JSON(&tags)
 		} else {
-			err = DB.Order("temperature DESC").Find(&tags).Error
+			err = RequestDB(c).Where("tenant_id = ? AND pending = ?", tenantID, false).Order("temperature DESC").Find(&tags).Error
 			if err != nil {
 				return err
 			}
-			go UpdateTagCache(tags)
+			go UpdateTagCache(tenantID, tags)
 			return Serialize(c, &tags)
 		}
 	}
-	err = DB.Where("name LIKE ?", "%"+query.Search+"%").
+	err = RequestDB(c).Where("name LIKE ? AND tenant_id = ? AND pending = ?", "%"+query.Search+"%", tenantID, false).
 		Order("temperature DESC").Find(&tags).Error
 	if err != nil {
 		return err
@@ -64,7 +63,7 @@ func GetTag(c *fiber.Ctx) error {
 	id, _ := c.ParamsInt("id")
 	var tag Tag
 	tag.ID = id
-	result := DB.First(&tag)
+	result := RequestDB(c).Where("tenant_id = ?", GetTenant(c).ID).First(&tag)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -122,7 +121,8 @@ func CreateTag(c *fiber.Ctx) error {
 	// bind and create tag
 	body.Name = strings.TrimSpace(body.Name)
 	tag.Name = body.Name
-	result := DB.Where("name = ?", body.Name).FirstOrCreate(&tag)
+	tag.TenantID = GetTenant(c).ID
+	result := RequestDB(c).Where("name = ? AND tenant_id = ?", body.Name, tag.TenantID).FirstOrCreate(&tag)
 
 	if result.RowsAffected == 0 {
 		c.Status(200)
@@ -144,18 +144,9 @@ func CreateTag(c *fiber.Ctx) error {
 // @Success 200 {object} Tag
 // @Failure 404 {object} MessageModel
 func ModifyTag(c *fiber.Ctx) error {
-	// admin
-	user, err := GetCurrLoginUser(c)
-	if err != nil {
-		return err
-	}
-	if !user.IsAdmin {
-		return common.Forbidden()
-	}
-
 	// validate body
 	var body ModifyModel
-	err = common.ValidateBody(c, &body)
+	err := common.ValidateBody(c, &body)
 	if err != nil {
 		return err
 	}
@@ -166,7 +157,7 @@ func ModifyTag(c *fiber.Ctx) error {
 
 	// modify tag
 	var tag Tag
-	DB.Find(&tag, id)
+	RequestDB(c).Where("tenant_id = ?", GetTenant(c).ID).Find(&tag, id)
 	tag.Name = strings.TrimSpace(body.Name)
 	tag.Temperature = body.Temperature
 
@@ -180,7 +171,7 @@ func ModifyTag(c *fiber.Ctx) error {
 	}
 	tag.IsSensitive = !sensitiveResp.Pass
 
-	DB.Save(&tag)
+	RequestDB(c).Save(&tag)
 
 	// log
 	userID, err := common.GetUserID(c)
@@ -188,7 +179,7 @@ func ModifyTag(c *fiber.Ctx) error {
 		return err
 	}
 	MyLog("Tag", "Modify", tag.ID, userID, RoleAdmin)
-	CreateAdminLog(DB, AdminLogTypeTag, userID, struct {
+	CreateAdminLog(RequestDB(c), AdminLogTypeTag, userID, struct {
 		TagID int         `json:"tag_id"`
 		Body  ModifyModel `json:"body"`
 	}{
@@ -211,18 +202,9 @@ func ModifyTag(c *fiber.Ctx) error {
 // @Success 200 {object} Tag
 // @Failure 404 {object} MessageModel
 func DeleteTag(c *fiber.Ctx) error {
-	// admin
-	user, err := GetCurrLoginUser(c)
-	if err != nil {
-		return err
-	}
-	if !user.IsAdmin {
-		return common.Forbidden()
-	}
-
 	// validate body
 	var body DeleteModel
-	err = common.ValidateBody(c, &body)
+	err := common.ValidateBody(c, &body)
 	if err != nil {
 		return err
 	}
@@ -233,46 +215,18 @@ func DeleteTag(c *fiber.Ctx) error {
 	}
 
 	var tag Tag
-	result := DB.First(&tag, id)
+	result := RequestDB(c).Where("tenant_id = ?", GetTenant(c).ID).First(&tag, id)
 	if result.Error != nil {
 		return result.Error
 	}
 
 	var newTag Tag
-	result = DB.Where("name = ?", body.To).First(&newTag)
+	result = RequestDB(c).Where("name = ? AND tenant_id = ?", body.To, tag.TenantID).First(&newTag)
 	if result.Error != nil {
 		return result.Error
 	}
 
-	newTag.Temperature += tag.Temperature
-
-	err = DB.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
-		result = tx.Exec(`
- DELETE FROM hole_tags WHERE tag_id = ? AND hole_id IN
- (SELECT a.hole_id FROM
- (SELECT hole_id FROM hole_tags WHERE tag_id = ?)a
- )`, id, newTag.ID)
-		if result.Error != nil {
-			return result.Error
-		}
-
-		result = tx.Exec(`UPDATE hole_tags SET tag_id = ? WHERE tag_id = ?`, newTag.ID, id)
-		if result.Error != nil {
-			return result.Error
-		}
-
-		result = tx.Updates(&newTag)
-		if result.Error != nil {
-			return result.Error
-		}
-
-		result = tx.Delete(&tag)
-		if result.Error != nil {
-			return result.Error
-		}
-
-		return nil
-	})
+	err = MergeTag(&tag, &newTag)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,236 @@
+package tag
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+	"treehole_next/utils/sensitive"
+)
+
+// ListPendingTags
+//
+// @Summary List tags pending for review, moderator only
+// @Tags Tag
+// @Produce application/json
+// @Router /admin/tags/pending [get]
+// @Success 200 {array} Tag
+func ListPendingTags(c *fiber.Ctx) error {
+	tags := make(Tags, 0)
+	err := RequestDB(c).Where("tenant_id = ? AND pending = ?", GetTenant(c).ID, true).Order("id").Find(&tags).Error
+	if err != nil {
+		return err
+	}
+	return c.JSON(tags)
+}
+
+// ApproveTag
+//
+// @Summary Approve a pending tag, moderator only
+// @Tags Tag
+// @Produce application/json
+// @Router /admin/tags/pending/{id}/_approve [post]
+// @Param id path int true "id"
+// @Success 200 {object} Tag
+// @Failure 404 {object} MessageModel
+func ApproveTag(c *fiber.Ctx) error {
+	tag, err := pendingTag(c)
+	if err != nil {
+		return err
+	}
+	tag.Pending = false
+	err = RequestDB(c).Model(tag).Update("pending", false).Error
+	if err != nil {
+		return err
+	}
+
+	err = reviewed(c, tag, "approve", nil)
+	if err != nil {
+		return err
+	}
+	return c.JSON(tag)
+}
+
+// RenameTag
+//
+// @Summary Rename and approve a pending tag, moderator only
+// @Description Holes of the tag are linked to the existing tag of the name if any
+// @Tags Tag
+// @Produce application/json
+// @Router /admin/tags/pending/{id} [put]
+// @Param id path int true "id"
+// @Param json body RenameModel true "json"
+// @Success 200 {object} Tag
+// @Failure 404 {object} MessageModel
+func RenameTag(c *fiber.Ctx) error {
+	var body RenameModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	name := strings.TrimSpace(body.Name)
+
+	tag, err := pendingTag(c)
+	if err != nil {
+		return err
+	}
+	holeIDs, err := tagHoleIDs(tag.ID)
+	if err != nil {
+		return err
+	}
+
+	var existing Tag
+	err = RequestDB(c).Where("name = ? AND tenant_id = ? AND id <> ?", name, tag.TenantID, tag.ID).Take(&existing).Error
+	if err == nil {
+		// merge into the existing tag, like DeleteTag
+		err = RequestDB(c).Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+			err = tx.Exec(`
+ DELETE FROM hole_tags WHERE tag_id = ? AND hole_id IN
+ (SELECT a.hole_id FROM
+ (SELECT hole_id FROM hole_tags WHERE tag_id = ?)a
+ )`, tag.ID, existing.ID).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Exec(`UPDATE hole_tags SET tag_id = ? WHERE tag_id = ?`, existing.ID, tag.ID).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Model(&existing).Update("temperature", gorm.Expr("temperature + ?", tag.Temperature)).Error
+			if err != nil {
+				return err
+			}
+			return tx.Delete(tag).Error
+		})
+		if err != nil {
+			return err
+		}
+		err = RequestDB(c).Take(&existing, existing.ID).Error
+		if err != nil {
+			return err
+		}
+		err = reviewed(c, &existing, "merge", holeIDs)
+		if err != nil {
+			return err
+		}
+		return c.JSON(&existing)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	sensitiveResp, err := sensitive.CheckSensitive(sensitive.ParamsForCheck{
+		Content:  name,
+		Id:       time.Now().UnixNano(),
+		TypeName: sensitive.TypeTag,
+	})
+	if err != nil {
+		return err
+	}
+	tag.Name = name
+	tag.IsSensitive = !sensitiveResp.Pass
+	tag.Pending = false
+	err = RequestDB(c).Model(tag).Select("Name", "IsSensitive", "Pending").Updates(tag).Error
+	if err != nil {
+		return err
+	}
+
+	err = reviewed(c, tag, "rename", holeIDs)
+	if err != nil {
+		return err
+	}
+	return c.JSON(tag)
+}
+
+// RejectTag
+//
+// @Summary Reject a pending tag and remove it from holes, moderator only
+// @Tags Tag
+// @Produce application/json
+// @Router /admin/tags/pending/{id} [delete]
+// @Param id path int true "id"
+// @Success 204
+// @Failure 404 {object} MessageModel
+func RejectTag(c *fiber.Ctx) error {
+	tag, err := pendingTag(c)
+	if err != nil {
+		return err
+	}
+	holeIDs, err := tagHoleIDs(tag.ID)
+	if err != nil {
+		return err
+	}
+
+	err = RequestDB(c).Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		err = tx.Where("tag_id = ?", tag.ID).Delete(&HoleTag{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(tag).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	err = reviewed(c, tag, "reject", holeIDs)
+	if err != nil {
+		return err
+	}
+	return c.SendStatus(204)
+}
+
+func pendingTag(c *fiber.Ctx) (*Tag, error) {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return nil, err
+	}
+	var tag Tag
+	err = RequestDB(c).Where("tenant_id = ? AND pending = ?", GetTenant(c).ID, true).Take(&tag, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+func tagHoleIDs(tagID int) (holeIDs []int, err error) {
+	err = DB.Model(&HoleTag{}).Where("tag_id = ?", tagID).Pluck("hole_id", &holeIDs).Error
+	return holeIDs, err
+}
+
+// reviewed logs the review and refreshes caches of tags and holes of the tag, holeIDs are loaded if nil
+func reviewed(c *fiber.Ctx, tag *Tag, action string, holeIDs []int) error {
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	MyLog("Tag", "Review", tag.ID, user.ID, RoleAdmin, action)
+	CreateAdminLog(RequestDB(c), AdminLogTypeTag, user.ID, map[string]any{
+		"tag_id": tag.ID,
+		"name":   tag.Name,
+		"action": action,
+	})
+
+	go UpdateTagCache(tag.TenantID, nil)
+
+	if holeIDs == nil {
+		holeIDs, err = tagHoleIDs(tag.ID)
+		if err != nil {
+			return err
+		}
+	}
+	if len(holeIDs) == 0 {
+		return nil
+	}
+	holes := make(Holes, 0, len(holeIDs))
+	err = RequestDB(c).Find(&holes, holeIDs).Error
+	if err != nil {
+		return err
+	}
+	return UpdateHoleCache(holes)
+}
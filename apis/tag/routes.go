@@ -1,12 +1,22 @@
 package tag
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"treehole_next/models"
+)
 
 func RegisterRoutes(app fiber.Router) {
 	app.Get("/tags", ListTags)
 	app.Get("/tags/:id<int>", GetTag)
+	app.Get("/tags/:name/stats", GetTagStats)
 	app.Post("/tags", CreateTag)
-	app.Put("/tags/:id<int>", ModifyTag)
-	app.Patch("/tags/:id<int>/_webvpn", ModifyTag)
-	app.Delete("/tags/:id<int>", DeleteTag)
+	app.Put("/tags/:id<int>", models.MiddlewarePermission(models.PermissionManageTag), ModifyTag)
+	app.Patch("/tags/:id<int>/_webvpn", models.MiddlewarePermission(models.PermissionManageTag), ModifyTag)
+	app.Delete("/tags/:id<int>", models.MiddlewarePermission(models.PermissionManageTag), DeleteTag)
+
+	app.Get("/admin/tags/pending", models.MiddlewarePermission(models.PermissionReviewTag), ListPendingTags)
+	app.Post("/admin/tags/pending/:id<int>/_approve", models.MiddlewarePermission(models.PermissionReviewTag), ApproveTag)
+	app.Put("/admin/tags/pending/:id<int>", models.MiddlewarePermission(models.PermissionReviewTag), RenameTag)
+	app.Delete("/admin/tags/pending/:id<int>", models.MiddlewarePermission(models.PermissionReviewTag), RejectTag)
 }
@@ -1,5 +1,11 @@
 package tag
 
+import (
+	"time"
+
+	"treehole_next/models"
+)
+
 type CreateModel struct {
 	Name string `json:"name,omitempty" validate:"max=20"` // Admin only
 }
@@ -15,6 +21,49 @@ type DeleteModel struct {
 	To string `json:"to,omitempty"`
 }
 
+type RenameModel struct {
+	// name of the tag, holes are linked to the existing tag of the name if any
+	Name string `json:"name" validate:"required,max=32"`
+}
+
 type SearchModel struct {
 	Search string `json:"s" query:"s" validate:"max=32"` // search tag by name
 }
+
+type StatsModel struct {
+	// stats of the last days
+	Days int `json:"days" query:"days" default:"30" validate:"min=1,max=365"`
+	// holes are counted by day, week or month
+	Bucket string `json:"bucket" query:"bucket" default:"day" validate:"oneof=day week month"`
+	// number of co-occurring tags
+	Cooccurring int `json:"cooccurring" query:"cooccurring" default:"10" validate:"min=0,max=50"`
+}
+
+type StatsResponse struct {
+	Tag *models.Tag `json:"tag"`
+
+	// holes created with the tag in each bucket, buckets without stats are omitted
+	Holes []HoleCountBucket `json:"holes"`
+
+	// daily temperatures
+	Temperature []TemperaturePoint `json:"temperature"`
+
+	// tags most often used together with the tag
+	Cooccurring []CooccurringTag `json:"cooccurring"`
+}
+
+type HoleCountBucket struct {
+	// start of the bucket
+	Time  time.Time `json:"time"`
+	Count int       `json:"count"`
+}
+
+type TemperaturePoint struct {
+	Time        time.Time `json:"time"`
+	Temperature int       `json:"temperature"`
+}
+
+type CooccurringTag struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
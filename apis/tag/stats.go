@@ -0,0 +1,106 @@
+package tag
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+
+	. "treehole_next/models"
+)
+
+// GetTagStats
+//
+// @Summary Get stats of a tag, for merging tags and tag pages
+// @Description Stats are refreshed nightly, today is not included
+// @Tags Tag
+// @Produce application/json
+// @Router /tags/{name}/stats [get]
+// @Param name path string true "name"
+// @Param object query StatsModel false "query"
+// @Success 200 {object} StatsResponse
+// @Failure 404 {object} MessageModel
+func GetTagStats(c *fiber.Ctx) error {
+	var query StatsModel
+	err := common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+
+	var tag Tag
+	err = RequestDB(c).Where("name = ? AND tenant_id = ? AND pending = ?", c.Params("name"), GetTenant(c).ID, false).
+		Take(&tag).Error
+	if err != nil {
+		return err
+	}
+
+	since := StartOfDay(time.Now()).AddDate(0, 0, -query.Days)
+	var stats []TagDailyStat
+	err = RequestDB(c).Where("tag_id = ? AND date >= ?", tag.ID, since).Order("date").Find(&stats).Error
+	if err != nil {
+		return err
+	}
+
+	response := StatsResponse{
+		Tag:         &tag,
+		Holes:       make([]HoleCountBucket, 0),
+		Temperature: make([]TemperaturePoint, 0),
+		Cooccurring: make([]CooccurringTag, 0),
+	}
+	for _, stat := range stats {
+		start := bucketStart(stat.Date, query.Bucket)
+		if n := len(response.Holes); n > 0 && response.Holes[n-1].Time.Equal(start) {
+			response.Holes[n-1].Count += stat.HoleCount
+		} else {
+			response.Holes = append(response.Holes, HoleCountBucket{Time: start, Count: stat.HoleCount})
+		}
+		response.Temperature = append(response.Temperature, TemperaturePoint{Time: stat.Date, Temperature: stat.Temperature})
+	}
+
+	err = RequestDB(c).Table("tag_cooccurrence").
+		Select("tag.name, tag_cooccurrence.count").
+		Joins("JOIN tag ON tag.id = tag_cooccurrence.other_tag_id").
+		Where("tag_cooccurrence.tag_id = ? AND tag.pending = ?", tag.ID, false).
+		Order("tag_cooccurrence.count DESC").Limit(query.Cooccurring).
+		Scan(&response.Cooccurring).Error
+	if err != nil {
+		return err
+	}
+
+	err = tag.Preprocess(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(&response)
+}
+
+func bucketStart(date time.Time, bucket string) time.Time {
+	date = StartOfDay(date)
+	switch bucket {
+	case "week":
+		// weeks start on monday
+		return date.AddDate(0, 0, -(int(date.Weekday())+6)%7)
+	case "month":
+		return date.AddDate(0, 0, 1-date.Day())
+	}
+	return date
+}
+
+// UpdateTagStats saves daily stats of tags once a day, see RefreshTagStats
+func UpdateTagStats(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := RefreshTagStats(time.Now())
+			if err != nil {
+				log.Err(err).Msg("error refresh tag stats")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
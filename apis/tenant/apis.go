@@ -0,0 +1,108 @@
+package tenant
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"gorm.io/gorm"
+
+	. "treehole_next/models"
+)
+
+// AddTenant
+//
+// @Summary Add A Tenant
+// @Description Add a campus or school served by the deployment. Admin only.
+// @Tags Tenant
+// @Accept application/json
+// @Produce application/json
+// @Router /tenants [post]
+// @Param json body CreateModel true "json"
+// @Success 201 {object} models.Tenant
+func AddTenant(c *fiber.Ctx) error {
+	var body CreateModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	err = RequestDB(c).Where(Quote("key")+" = ?", body.Key).Take(&Tenant{}).Error
+	if err == nil {
+		return common.BadRequest("学校标识已存在")
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	tenant := Tenant{Key: body.Key, Name: body.Name, Config: body.Config}
+	err = RequestDB(c).Create(&tenant).Error
+	if err != nil {
+		return err
+	}
+	err = DeleteTenantsCache()
+	if err != nil {
+		return err
+	}
+	return c.Status(201).JSON(&tenant)
+}
+
+// ListTenants
+//
+// @Summary List Tenants
+// @Tags Tenant
+// @Produce application/json
+// @Router /tenants [get]
+// @Success 200 {array} models.Tenant
+func ListTenants(c *fiber.Ctx) error {
+	tenants := make([]Tenant, 0)
+	err := RequestDB(c).Order("id").Find(&tenants).Error
+	if err != nil {
+		return err
+	}
+	return c.JSON(tenants)
+}
+
+// ModifyTenant
+//
+// @Summary Modify A Tenant
+// @Description Admin only.
+// @Tags Tenant
+// @Accept application/json
+// @Produce application/json
+// @Router /tenants/{id} [put]
+// @Param id path int true "id"
+// @Param json body ModifyModel true "json"
+// @Success 200 {object} models.Tenant
+// @Failure 404 {object} common.HttpError
+func ModifyTenant(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	var body ModifyModel
+	err = common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	var tenant Tenant
+	err = RequestDB(c).Take(&tenant, id).Error
+	if err != nil {
+		return err
+	}
+	if body.Name != nil {
+		tenant.Name = *body.Name
+	}
+	if body.Config != nil {
+		tenant.Config = *body.Config
+	}
+	err = RequestDB(c).Select("Name", "Config").Save(&tenant).Error
+	if err != nil {
+		return err
+	}
+	err = DeleteTenantsCache()
+	if err != nil {
+		return err
+	}
+	return c.JSON(&tenant)
+}
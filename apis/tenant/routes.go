@@ -0,0 +1,13 @@
+package tenant
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"treehole_next/models"
+)
+
+func RegisterRoutes(app fiber.Router) {
+	app.Post("/tenants", models.MiddlewarePermission(models.PermissionManageTenant), AddTenant)
+	app.Get("/tenants", ListTenants)
+	app.Put("/tenants/:id<int>", models.MiddlewarePermission(models.PermissionManageTenant), ModifyTenant)
+}
@@ -0,0 +1,18 @@
+package tenant
+
+import (
+	. "treehole_next/models"
+)
+
+type CreateModel struct {
+	// used in X-Tenant header and as subdomain
+	Key    string       `json:"key" validate:"required,max=32,alphanum,lowercase"`
+	Name   string       `json:"name" validate:"required,max=64"`
+	Config TenantConfig `json:"config"`
+}
+
+type ModifyModel struct {
+	Name *string `json:"name" validate:"omitempty,max=64"`
+	// replaces all overrides
+	Config *TenantConfig `json:"config"`
+}
@@ -0,0 +1,81 @@
+package user
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// GetAnnualReport
+//
+// @Summary Get the annual report of current user
+// @Description Reports are generated in January for the last year, see GenerateAnnualReports.
+// @Tags user
+// @Produce json
+// @Router /users/me/annual_report [get]
+// @Param object query AnnualReportModel false "query"
+// @Success 200 {object} models.AnnualReport
+// @Failure 404 {object} common.HttpError
+func GetAnnualReport(c *fiber.Ctx) error {
+	var query AnnualReportModel
+	err := common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+	if query.Year == 0 {
+		query.Year = time.Now().Year() - 1
+	}
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var reports []AnnualReport
+	err = RequestDB(c).Where("user_id = ? AND year = ?", userID, query.Year).Limit(1).Find(&reports).Error
+	if err != nil {
+		return err
+	}
+	if len(reports) == 0 {
+		return NewError(ErrCodeAnnualReportNotFound, "年度报告尚未生成")
+	}
+	return c.JSON(&reports[0])
+}
+
+// UpdateAnnualReports generates reports of the last year once in January, see GenerateAnnualReports
+func UpdateAnnualReports(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			if now.Month() != time.January {
+				continue
+			}
+			year := now.Year() - 1
+			var generated int64
+			err := DB.Model(&AnnualReport{}).Where("year = ?", year).Limit(1).Count(&generated).Error
+			if err != nil {
+				log.Err(err).Msg("error check annual reports")
+				continue
+			}
+			if generated > 0 {
+				continue
+			}
+			count, err := GenerateAnnualReports(year)
+			if err != nil {
+				log.Err(err).Int("year", year).Msg("error generate annual reports")
+				continue
+			}
+			log.Info().Int("year", year).Int("count", count).Msg("annual reports generated")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
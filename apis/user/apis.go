@@ -13,8 +13,24 @@ func RegisterRoutes(app fiber.Router) {
 	app.Get("/users/:id<int>", GetUserByID)
 	app.Put("/users/:id<int>", ModifyUser)
 	app.Patch("/users/:id<int>/_webvpn", ModifyUser)
+	app.Post("/users/:id<int>/_purge", MiddlewarePermission(PermissionPurgeUser), PurgeUser)
+	app.Post("/identities/_audit", MiddlewarePermission(PermissionAuditIdentity), AuditIdentities)
+	app.Get("/users/:id<int>/reputation", MiddlewarePermission(PermissionPunishUser), GetUserReputation)
+	app.Put("/users/:id<int>/reputation", MiddlewarePermission(PermissionManageReputation), ModifyUserReputation)
 	app.Put("/users/me", ModifyCurrentUser)
 	app.Patch("/users/me/_webvpn", ModifyCurrentUser)
+	app.Post("/users/me/export", ExportUserData)
+	app.Get("/users/me/export/:token", GetUserDataExport)
+	app.Get("/users/me/permissions", GetCurrentUserPermissions)
+	app.Get("/users/me/notification_settings", GetNotificationSettings)
+	app.Put("/users/me/notification_settings", ModifyNotificationSettings)
+	app.Get("/users/me/annual_report", GetAnnualReport)
+	app.Get("/users/me/stats", GetCurrentUserStats)
+	app.Post("/users/me/checkin", Checkin)
+	app.Get("/users/me/badges", GetCurrentUserBadges)
+	app.Put("/users/me/badges", ModifyCurrentUserBadges)
+	app.Get("/users/me/division_settings", GetDivisionSettings)
+	app.Put("/users/me/division_settings/:id<int>", ModifyDivisionSetting)
 }
 
 // GetCurrentUser
@@ -33,6 +49,21 @@ func GetCurrentUser(c *fiber.Ctx) error {
 	return c.JSON(&user)
 }
 
+// GetCurrentUserPermissions
+//
+// @Summary get roles and permissions of current user, for clients to show or hide controls
+// @Tags user
+// @Produce json
+// @Router /users/me/permissions [get]
+// @Success 200 {object} models.EffectivePermissions
+func GetCurrentUserPermissions(c *fiber.Ctx) error {
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(user.EffectivePermissions())
+}
+
 // GetUserByID
 //
 // @Summary get user by id, owner or admin
@@ -100,7 +131,7 @@ func ModifyUser(c *fiber.Ctx) error {
 		user = &User{
 			ID: userID,
 		}
-		err = DB.Take(user).Error
+		err = RequestDB(c).Take(user).Error
 		if err != nil {
 			return err
 		}
@@ -158,6 +189,12 @@ func modifyUser(_ *fiber.Ctx, user *User, body ModifyModel) error {
 		if body.Config.ShowFolded != nil {
 			newUser.Config.ShowFolded = *body.Config.ShowFolded
 		}
+		if body.Config.LikeNotify != nil {
+			newUser.Config.LikeNotify = *body.Config.LikeNotify
+		}
+		if body.Config.Jury != nil {
+			newUser.Config.Jury = *body.Config.Jury
+		}
 	}
 
 	err = DB.Model(&user).Omit(clause.Associations).Select("Config").UpdateColumns(&newUser).Error
@@ -0,0 +1,71 @@
+package user
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"gorm.io/gorm"
+
+	. "treehole_next/models"
+)
+
+// GetCurrentUserBadges
+//
+// @Summary List badges of current user
+// @Description All enabled badges, awarded or not. Badges depending on time, like year_one, are awarded when listed.
+// @Tags user
+// @Produce json
+// @Router /users/me/badges [get]
+// @Success 200 {array} models.BadgeResponse
+func GetCurrentUserBadges(c *fiber.Ctx) error {
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	_, err = AwardBadges(RequestDB(c), user.ID, user.JoinedTime, BadgeEventVisit)
+	if err != nil {
+		return err
+	}
+	badges, err := ListUserBadges(RequestDB(c), user.ID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(badges)
+}
+
+// ModifyCurrentUserBadges
+//
+// @Summary Choose badges shown next to the anonyname in holes
+// @Description Only awarded badges can be shown, badges not in shown are hidden.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Router /users/me/badges [put]
+// @Param json body BadgesModel true "json"
+// @Success 200 {array} models.BadgeResponse
+func ModifyCurrentUserBadges(c *fiber.Ctx) error {
+	var body BadgesModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	// validation is skipped for empty body
+	if body.Shown == nil {
+		return common.BadRequest("shown is required")
+	}
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
+		return ShowUserBadges(tx, userID, body.Shown)
+	})
+	if err != nil {
+		return err
+	}
+	badges, err := ListUserBadges(RequestDB(c), userID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(badges)
+}
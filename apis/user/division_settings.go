@@ -0,0 +1,91 @@
+package user
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"golang.org/x/exp/slices"
+
+	. "treehole_next/models"
+)
+
+// GetDivisionSettings
+//
+// @Summary get division settings of current user
+// @Description Holes in muted divisions are not recommended and not included in digests or saved search alerts.
+// @Description Divisions muted by default are muted unless unmuted by the user.
+// @Tags User
+// @Produce json
+// @Router /users/me/division_settings [get]
+// @Success 200 {array} DivisionSettingResponse
+func GetDivisionSettings(c *fiber.Ctx) error {
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var divisions []Division
+	err = RequestDB(c).Where("tenant_id = ?", GetTenant(c).ID).Order("id").Find(&divisions).Error
+	if err != nil {
+		return err
+	}
+	muted, err := MutedDivisionIDs(RequestDB(c), userID)
+	if err != nil {
+		return err
+	}
+
+	response := make([]DivisionSettingResponse, 0, len(divisions))
+	for _, division := range divisions {
+		response = append(response, DivisionSettingResponse{
+			DivisionID:     division.ID,
+			Muted:          slices.Contains(muted, division.ID),
+			MutedByDefault: division.MutedByDefault,
+		})
+	}
+	return c.JSON(response)
+}
+
+// ModifyDivisionSetting
+//
+// @Summary mute or unmute a division for current user
+// @Tags User
+// @Accept json
+// @Produce json
+// @Router /users/me/division_settings/{division_id} [put]
+// @Param division_id path int true "division id"
+// @Param json body DivisionSettingModel true "json"
+// @Success 200 {object} DivisionSettingResponse
+// @Failure 404 {object} common.HttpError
+func ModifyDivisionSetting(c *fiber.Ctx) error {
+	divisionID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	var body DivisionSettingModel
+	err = common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	// validation is skipped for empty body
+	if body.Muted == nil {
+		return common.BadRequest("muted is required")
+	}
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var division Division
+	err = RequestDB(c).Where("tenant_id = ?", GetTenant(c).ID).Take(&division, divisionID).Error
+	if err != nil {
+		return err
+	}
+	err = SetDivisionMuted(RequestDB(c), userID, divisionID, *body.Muted)
+	if err != nil {
+		return err
+	}
+	return c.JSON(DivisionSettingResponse{
+		DivisionID:     divisionID,
+		Muted:          *body.Muted,
+		MutedByDefault: division.MutedByDefault,
+	})
+}
@@ -0,0 +1,170 @@
+package user
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+const (
+	// a user can export data once a day
+	exportInterval = 24 * time.Hour
+
+	// archives are large, they are kept in cache until the user can export again
+	exportExpire = exportInterval
+)
+
+func exportLimitKey(userID int) string {
+	return fmt.Sprintf("user_export_limit_%d", userID)
+}
+
+func exportArchiveKey(token string) string {
+	return fmt.Sprintf("user_export_%s", token)
+}
+
+// ExportUserData
+//
+// @Summary Export Data of Current User
+// @Description Assemble all holes, floors, favorites, reports, messages and punishments of current user into a json archive asynchronously.
+// @Description The download link is delivered via message center. Once a day.
+// @Tags user
+// @Produce json
+// @Router /users/me/export [post]
+// @Success 202 {object} MessageModel
+// @Failure 429 {object} MessageModel
+func ExportUserData(c *fiber.Ctx) error {
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	// claimed atomically, so that concurrent requests don't start more exports
+	claimed, err := SetCacheNX(exportLimitKey(userID), true, exportInterval)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return &common.HttpError{
+			Code:    fiber.StatusTooManyRequests,
+			Message: "每天只能导出一次数据",
+		}
+	}
+
+	Go(func() {
+		err := exportUserData(userID)
+		if err != nil {
+			log.Err(err).Int("user_id", userID).Msg("export user data failed")
+			_ = DeleteCache(exportLimitKey(userID))
+		}
+	})
+
+	return c.Status(fiber.StatusAccepted).JSON(MessageModel{Message: Localize(c, "数据导出中，完成后将通过站内信发送下载链接")})
+}
+
+// GetUserDataExport
+//
+// @Summary Download Exported Data of Current User
+// @Tags user
+// @Produce json
+// @Router /users/me/export/{token} [get]
+// @Param token path string true "token in the message"
+// @Success 200 {object} ExportModel
+// @Failure 404 {object} MessageModel
+func GetUserDataExport(c *fiber.Ctx) error {
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var archive ExportModel
+	if !GetCache(exportArchiveKey(c.Params("token")), &archive) || archive.UserID != userID {
+		return common.NotFound("导出数据不存在或已过期")
+	}
+
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="treehole_export_%d.json"`, userID))
+	return c.JSON(&archive)
+}
+
+func exportUserData(userID int) error {
+	archive := ExportModel{
+		UserID:      userID,
+		TimeCreated: time.Now(),
+	}
+
+	err := DB.Unscoped().Preload("Tags").Where("user_id = ?", userID).Order("id").Find(&archive.Holes).Error
+	if err != nil {
+		return err
+	}
+	err = DB.Where("user_id = ?", userID).Order("id").Find(&archive.Floors).Error
+	if err != nil {
+		return err
+	}
+	err = DB.Where("user_id = ?", userID).Find(&archive.FavoriteGroups).Error
+	if err != nil {
+		return err
+	}
+	err = DB.Where("user_id = ?", userID).Find(&archive.Favorites).Error
+	if err != nil {
+		return err
+	}
+	err = DB.Where("user_id = ?", userID).Find(&archive.FloorFavoriteGroups).Error
+	if err != nil {
+		return err
+	}
+	err = DB.Where("user_id = ?", userID).Find(&archive.FloorFavorites).Error
+	if err != nil {
+		return err
+	}
+	err = DB.Where("user_id = ?", userID).Order("id").Find(&archive.SavedSearches).Error
+	if err != nil {
+		return err
+	}
+	err = DB.Where("user_id = ?", userID).Order("id").Find(&archive.Reports).Error
+	if err != nil {
+		return err
+	}
+	err = DB.Raw(`
+		SELECT message.*,message_user.has_read FROM message
+		INNER JOIN message_user
+		WHERE message.id = message_user.message_id and message_user.user_id = ?
+		ORDER BY message.id`,
+		userID,
+	).Scan(&archive.Messages).Error
+	if err != nil {
+		return err
+	}
+	err = DB.Unscoped().Where("user_id = ?", userID).Order("id").Find(&archive.Punishments).Error
+	if err != nil {
+		return err
+	}
+
+	tokenBytes := make([]byte, 16)
+	_, err = rand.Read(tokenBytes)
+	if err != nil {
+		return err
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	err = SetCache(exportArchiveKey(token), &archive, exportExpire)
+	if err != nil {
+		return err
+	}
+
+	_, err = Notification{
+		Title:       "您的数据导出已完成",
+		Description: "下载链接 24 小时内有效",
+		Data:        Map{"token": token},
+		Type:        MessageTypeMail,
+		URL:         "/api/users/me/export/" + token,
+		Recipients:  []int{userID},
+	}.Send()
+	return err
+}
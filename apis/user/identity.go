@@ -0,0 +1,94 @@
+package user
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+
+	. "treehole_next/models"
+)
+
+// AuditIdentities
+//
+// @Summary Audit identities behind a hole or a floor, admin only
+// @Description Returns user ids and anonynames of users posting in the hole, or of the author of the floor,
+// @Description for lawful investigations. Every access is kept in the admin log with the justification.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Router /identities/_audit [post]
+// @Param json body IdentityAuditModel true "json"
+// @Success 200 {object} IdentityAuditResponse
+func AuditIdentities(c *fiber.Ctx) error {
+	var body IdentityAuditModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	// validation is skipped for empty body
+	if (body.HoleID == 0) == (body.FloorID == 0) {
+		return common.BadRequest("one of hole_id and floor_id is required")
+	}
+	if body.Justification == "" {
+		return common.BadRequest("justification is required")
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	holeID := body.HoleID
+	if body.FloorID != 0 {
+		var floor Floor
+		err = RequestDB(c).Select("id", "hole_id").Take(&floor, body.FloorID).Error
+		if err != nil {
+			return err
+		}
+		holeID = floor.HoleID
+	}
+	var hole Hole
+	err = RequestDB(c).Unscoped().Select("id", "user_id").Where("tenant_id = ?", GetTenant(c).ID).Take(&hole, holeID).Error
+	if err != nil {
+		return err
+	}
+
+	var floors Floors
+	querySet := RequestDB(c).Select("id", "user_id", "anonyname").Where("hole_id = ?", hole.ID).Order("id")
+	if body.FloorID != 0 {
+		querySet = querySet.Where("id = ?", body.FloorID)
+	}
+	err = querySet.Find(&floors).Error
+	if err != nil {
+		return err
+	}
+
+	response := IdentityAuditResponse{HoleID: hole.ID, FloorID: body.FloorID, Identities: make([]IdentityResponse, 0)}
+	indexes := make(map[int]int)
+	for _, floor := range floors {
+		index, ok := indexes[floor.UserID]
+		if !ok {
+			index = len(response.Identities)
+			indexes[floor.UserID] = index
+			response.Identities = append(response.Identities, IdentityResponse{
+				UserID:    floor.UserID,
+				Anonyname: floor.Anonyname,
+				IsOwner:   floor.UserID == hole.UserID,
+			})
+		}
+		response.Identities[index].FloorIDs = append(response.Identities[index].FloorIDs, floor.ID)
+	}
+
+	userIDs := make([]int, 0, len(response.Identities))
+	for _, identity := range response.Identities {
+		userIDs = append(userIDs, identity.UserID)
+	}
+	CreateAdminLog(RequestDB(c), AdminLogTypeIdentityAudit, user.ID, Map{
+		"hole_id":       hole.ID,
+		"floor_id":      body.FloorID,
+		"justification": body.Justification,
+		"user_ids":      userIDs,
+	})
+	log.Info().Int("user_id", user.ID).Int("hole_id", hole.ID).Int("floor_id", body.FloorID).Msg("audit identities")
+
+	return c.JSON(&response)
+}
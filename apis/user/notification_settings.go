@@ -0,0 +1,89 @@
+package user
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	. "treehole_next/models"
+)
+
+// GetNotificationSettings
+//
+// @Summary get push settings of current user
+// @Description Messages are always listed in /messages, settings control which event types produce pushes.
+// @Tags User
+// @Produce json
+// @Router /users/me/notification_settings [get]
+// @Success 200 {object} NotificationSetting
+func GetNotificationSettings(c *fiber.Ctx) error {
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	settings, err := LoadNotificationSettings(RequestDB(c), []int{userID})
+	if err != nil {
+		return err
+	}
+	return c.JSON(settings[userID])
+}
+
+// ModifyNotificationSettings
+//
+// @Summary modify push settings of current user
+// @Tags User
+// @Produce json
+// @Router /users/me/notification_settings [put]
+// @Param json body NotificationSettingsModel true "json"
+// @Success 200 {object} NotificationSetting
+func ModifyNotificationSettings(c *fiber.Ctx) error {
+	var body NotificationSettingsModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var setting *NotificationSetting
+	err = RequestDB(c).Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		settings, err := LoadNotificationSettings(tx, []int{userID})
+		if err != nil {
+			return err
+		}
+		setting = settings[userID]
+
+		if body.Mention != nil {
+			setting.Mention = *body.Mention
+		}
+		if body.Reply != nil {
+			setting.Reply = *body.Reply
+		}
+		if body.Favorite != nil {
+			setting.Favorite = *body.Favorite
+		}
+		if body.ReportResult != nil {
+			setting.ReportResult = *body.ReportResult
+		}
+		if body.System != nil {
+			setting.System = *body.System
+		}
+		if body.Digest != nil {
+			setting.Digest = *body.Digest
+		}
+		if body.DigestHour != nil {
+			setting.DigestHour = *body.DigestHour
+		}
+		return setting.Save(tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(setting)
+}
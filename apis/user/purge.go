@@ -0,0 +1,46 @@
+package user
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+
+	. "treehole_next/models"
+)
+
+// PurgeUser
+//
+// @Summary Purge contents of a user, admin only
+// @Description Called by the auth service when a user is deleted. Holes, floors, floor histories and reports
+// @Description are reassigned to the purged user, likes, favorites, subscriptions and anonyname mappings are deleted.
+// @Description In delete mode, floors are also deleted and holes are hidden. Use dry_run to count affected rows.
+// @Description Holes and floors under legal hold are kept as they are, with their anonyname mappings.
+// @Tags user
+// @Produce json
+// @Router /users/{user_id}/_purge [post]
+// @Param user_id path int true "user id"
+// @Param json body PurgeModel true "json"
+// @Success 200 {object} PurgeResponse
+func PurgeUser(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	var body PurgeModel
+	err = common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	response := PurgeResponse{Mode: body.Mode, DryRun: body.DryRun}
+	response.Counts, err = PurgeUserData(user.ID, userID, body.Mode, body.DryRun)
+	if err != nil {
+		return err
+	}
+	return c.JSON(&response)
+}
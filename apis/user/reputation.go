@@ -0,0 +1,80 @@
+package user
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"gorm.io/gorm"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// GetUserReputation
+//
+// @Summary Get reputation of a user, moderator only
+// @Description Computed from account age, likes received and punishments, refreshed hourly.
+// @Description The override set by admins replaces the score, see value.
+// @Tags user
+// @Produce json
+// @Router /users/{user_id}/reputation [get]
+// @Param user_id path int true "user id"
+// @Success 200 {object} ReputationResponse
+func GetUserReputation(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	reputation, err := LoadReputation(userID, time.Time{})
+	if err != nil {
+		return err
+	}
+	return c.JSON(ReputationResponse{UserReputation: reputation, Value: reputation.Value()})
+}
+
+// ModifyUserReputation
+//
+// @Summary Override reputation of a user, admin only
+// @Description Set override to null to use the computed score again.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Router /users/{user_id}/reputation [put]
+// @Param user_id path int true "user id"
+// @Param json body ReputationModel true "json"
+// @Success 200 {object} ReputationResponse
+func ModifyUserReputation(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	var body ReputationModel
+	err = common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	var reputation *UserReputation
+	err = RequestDB(c).Transaction(func(tx *gorm.DB) error {
+		reputation, err = SetReputationOverride(tx, userID, body.Override)
+		if err != nil {
+			return err
+		}
+		CreateAdminLog(tx, AdminLogTypeReputation, user.ID, Map{
+			"user_id":  userID,
+			"override": body.Override,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	MyLog("User", "Modify", userID, user.ID, RoleAdmin, "reputation")
+	return c.JSON(ReputationResponse{UserReputation: reputation, Value: reputation.Value()})
+}
@@ -1,5 +1,11 @@
 package user
 
+import (
+	"time"
+
+	. "treehole_next/models"
+)
+
 type ModifyModel struct {
 	Nickname *string          `json:"nickname" validate:"omitempty,min=1"`
 	Config   *UserConfigModel `json:"config"`
@@ -8,4 +14,102 @@ type ModifyModel struct {
 type UserConfigModel struct {
 	Notify     []string `json:"notify"`
 	ShowFolded *string  `json:"show_folded"`
+	LikeNotify *string  `json:"like_notify" validate:"omitempty,oneof=immediate daily off"`
+	Jury       *bool    `json:"jury"`
+}
+
+// NotificationSettingsModel modifies push settings partially, omitted fields are unchanged
+type NotificationSettingsModel struct {
+	Mention      *bool `json:"mention"`
+	Reply        *bool `json:"reply"`
+	Favorite     *bool `json:"favorite"`
+	ReportResult *bool `json:"report_result"`
+	System       *bool `json:"system"`
+	// daily digest of favorite and subscribed holes
+	Digest *bool `json:"digest"`
+	// hour of day to send the digest
+	DigestHour *int `json:"digest_hour" validate:"omitempty,min=0,max=23"`
+}
+
+type DivisionSettingModel struct {
+	Muted *bool `json:"muted" validate:"required"`
+}
+
+type DivisionSettingResponse struct {
+	DivisionID int `json:"division_id"`
+	// muted by the user, or muted by default and not unmuted
+	Muted          bool `json:"muted"`
+	MutedByDefault bool `json:"muted_by_default"`
+}
+
+type AnnualReportModel struct {
+	// defaults to the last year
+	Year int `json:"year" query:"year" validate:"omitempty,min=2000"`
+}
+
+type ExportModel struct {
+	UserID              int                 `json:"user_id"`
+	TimeCreated         time.Time           `json:"time_created"`
+	Holes               Holes               `json:"holes"`
+	Floors              Floors              `json:"floors"`
+	FavoriteGroups      FavoriteGroups      `json:"favorite_groups"`
+	Favorites           UserFavorites       `json:"favorites"`
+	FloorFavoriteGroups FloorFavoriteGroups `json:"floor_favorite_groups"`
+	FloorFavorites      UserFloorFavorites  `json:"floor_favorites"`
+	SavedSearches       SavedSearches       `json:"saved_searches"`
+	Reports             Reports             `json:"reports"`
+	Messages            Messages            `json:"messages"`
+	Punishments         Punishments         `json:"punishments"`
+}
+
+type PurgeModel struct {
+	// anonymize: reassign contents to the purged user; delete: also delete contents
+	Mode string `json:"mode" default:"anonymize" validate:"oneof=anonymize delete"`
+	// only count affected rows
+	DryRun bool `json:"dry_run"`
+}
+
+type PurgeResponse struct {
+	Mode   string `json:"mode"`
+	DryRun bool   `json:"dry_run"`
+	// affected rows of each table
+	Counts map[string]int64 `json:"counts"`
+}
+
+type ReputationModel struct {
+	// replaces the computed score, null to clear
+	Override *int `json:"override" validate:"omitempty,min=-1000,max=1000"`
+}
+
+type ReputationResponse struct {
+	*UserReputation
+	// effective score, the override if set
+	Value int `json:"value"`
+}
+
+type BadgesModel struct {
+	// badges shown next to the anonyname in holes, others are hidden
+	Shown []string `json:"shown" validate:"required"`
+}
+
+type IdentityAuditModel struct {
+	// one of hole_id and floor_id
+	HoleID  int `json:"hole_id" validate:"min=0"`
+	FloorID int `json:"floor_id" validate:"min=0"`
+	// why the identities are needed, kept in the admin log
+	Justification string `json:"justification" validate:"required,min=10,max=1000"`
+}
+
+// IdentityResponse is a user posting in the hole, with the anonyname and floors posted
+type IdentityResponse struct {
+	UserID    int    `json:"user_id"`
+	Anonyname string `json:"anonyname"`
+	IsOwner   bool   `json:"is_owner"`
+	FloorIDs  []int  `json:"floor_ids"`
+}
+
+type IdentityAuditResponse struct {
+	HoleID     int                `json:"hole_id"`
+	FloorID    int                `json:"floor_id,omitempty"`
+	Identities []IdentityResponse `json:"identities"`
 }
@@ -0,0 +1,59 @@
+package user
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+
+	. "treehole_next/models"
+)
+
+// GetCurrentUserStats
+//
+// @Summary Get posting stats of current user
+// @Description Floors and holes posted, likes and favorites received, and days in a row with posts.
+// @Description Counters are kept on writes, deleted posts are still counted. Check-in streaks are included, see checkin.
+// @Tags user
+// @Produce json
+// @Router /users/me/stats [get]
+// @Success 200 {object} models.UserStatsResponse
+func GetCurrentUserStats(c *fiber.Ctx) error {
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+	stats, err := GetUserStats(RequestDB(c), userID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(stats.Response(time.Now()))
+}
+
+// CheckinResponse is stats of the user after checking in
+type CheckinResponse struct {
+	UserStatsResponse
+	// false if checked in today already
+	CheckedIn bool `json:"checked_in"`
+}
+
+// Checkin
+//
+// @Summary Check in today
+// @Description Check-ins on consecutive days make the checkin_streak, the longest is kept. Checking in again on the same day changes nothing.
+// @Tags user
+// @Produce json
+// @Router /users/me/checkin [post]
+// @Success 200 {object} CheckinResponse
+func Checkin(c *fiber.Ctx) error {
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	checkedIn, stats, err := UserCheckin(userID, now)
+	if err != nil {
+		return err
+	}
+	return c.JSON(CheckinResponse{UserStatsResponse: stats.Response(now), CheckedIn: checkedIn})
+}
@@ -0,0 +1,196 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+
+	. "treehole_next/models"
+)
+
+const retryBatchSize = 100
+
+// RetryDeliveries retries failed webhook deliveries which are due, see WebhookDelivery
+func RetryDeliveries(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for {
+				n, err := RetryWebhookDeliveries(retryBatchSize)
+				if err != nil {
+					log.Err(err).Msg("error retry webhook deliveries")
+				}
+				if err != nil || n < retryBatchSize {
+					break
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// AddWebhook
+//
+// @Summary Add A Webhook
+// @Description Payloads are signed with the secret, see header X-Treehole-Signature. Admin only.
+// @Tags Webhook
+// @Accept application/json
+// @Produce application/json
+// @Router /webhooks [post]
+// @Param json body CreateModel true "json"
+// @Success 201 {object} models.Webhook
+func AddWebhook(c *fiber.Ctx) error {
+	var body CreateModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	webhook := Webhook{
+		URL:       body.URL,
+		Secret:    body.Secret,
+		Events:    body.Events,
+		Enabled:   true,
+		CreatedBy: user.ID,
+	}
+	err = RequestDB(c).Create(&webhook).Error
+	if err != nil {
+		return err
+	}
+	return c.Status(201).JSON(&webhook)
+}
+
+// ListWebhooks
+//
+// @Summary List Webhooks
+// @Description Admin only.
+// @Tags Webhook
+// @Produce application/json
+// @Router /webhooks [get]
+// @Success 200 {array} models.Webhook
+func ListWebhooks(c *fiber.Ctx) error {
+	webhooks := Webhooks{}
+	err := RequestDB(c).Order("id").Find(&webhooks).Error
+	if err != nil {
+		return err
+	}
+	return c.JSON(webhooks)
+}
+
+// ModifyWebhook
+//
+// @Summary Modify A Webhook
+// @Description Admin only.
+// @Tags Webhook
+// @Accept application/json
+// @Produce application/json
+// @Router /webhooks/{id} [put]
+// @Param id path int true "id"
+// @Param json body ModifyModel true "json"
+// @Success 200 {object} models.Webhook
+// @Failure 404 {object} common.HttpError
+func ModifyWebhook(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	var body ModifyModel
+	err = common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	var webhook Webhook
+	err = RequestDB(c).Take(&webhook, id).Error
+	if err != nil {
+		return err
+	}
+	if body.URL != nil {
+		webhook.URL = *body.URL
+	}
+	if body.Secret != nil {
+		webhook.Secret = *body.Secret
+	}
+	if body.Events != nil {
+		webhook.Events = body.Events
+	}
+	if body.Enabled != nil {
+		webhook.Enabled = *body.Enabled
+	}
+	err = RequestDB(c).Select("URL", "Secret", "Events", "Enabled").Save(&webhook).Error
+	if err != nil {
+		return err
+	}
+	return c.JSON(&webhook)
+}
+
+// DeleteWebhook
+//
+// @Summary Delete A Webhook
+// @Description Deliveries are deleted too. Admin only.
+// @Tags Webhook
+// @Router /webhooks/{id} [delete]
+// @Param id path int true "id"
+// @Success 204
+// @Failure 404 {object} common.HttpError
+func DeleteWebhook(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	var webhook Webhook
+	err = RequestDB(c).Take(&webhook, id).Error
+	if err != nil {
+		return err
+	}
+	err = RequestDB(c).Where("webhook_id = ?", id).Delete(&WebhookDelivery{}).Error
+	if err != nil {
+		return err
+	}
+	err = RequestDB(c).Delete(&webhook).Error
+	if err != nil {
+		return err
+	}
+	return c.SendStatus(204)
+}
+
+// ListDeliveries
+//
+// @Summary List Deliveries Of A Webhook
+// @Description Newest first. Admin only.
+// @Tags Webhook
+// @Produce application/json
+// @Router /webhooks/{id}/deliveries [get]
+// @Param id path int true "id"
+// @Param object query ListDeliveriesModel false "query"
+// @Success 200 {array} models.WebhookDelivery
+func ListDeliveries(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	var query ListDeliveriesModel
+	err = common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+
+	deliveries := []WebhookDelivery{}
+	err = RequestDB(c).Where("webhook_id = ?", id).Order("id desc").
+		Offset(query.Offset).Limit(query.Size).Find(&deliveries).Error
+	if err != nil {
+		return err
+	}
+	return c.JSON(deliveries)
+}
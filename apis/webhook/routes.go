@@ -0,0 +1,15 @@
+package webhook
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"treehole_next/models"
+)
+
+func RegisterRoutes(app fiber.Router) {
+	app.Post("/webhooks", models.MiddlewarePermission(models.PermissionManageWebhook), AddWebhook)
+	app.Get("/webhooks", models.MiddlewarePermission(models.PermissionManageWebhook), ListWebhooks)
+	app.Put("/webhooks/:id<int>", models.MiddlewarePermission(models.PermissionManageWebhook), ModifyWebhook)
+	app.Delete("/webhooks/:id<int>", models.MiddlewarePermission(models.PermissionManageWebhook), DeleteWebhook)
+	app.Get("/webhooks/:id<int>/deliveries", models.MiddlewarePermission(models.PermissionManageWebhook), ListDeliveries)
+}
@@ -0,0 +1,21 @@
+package webhook
+
+type CreateModel struct {
+	URL string `json:"url" validate:"required,url,max=512"`
+	// used to sign payloads, see header X-Treehole-Signature
+	Secret string `json:"secret" validate:"required,min=16,max=128"`
+	// hole.created, report.created, penalty.created or bot.matched
+	Events []string `json:"events" validate:"required,min=1,dive,oneof=hole.created report.created penalty.created bot.matched"`
+}
+
+type ModifyModel struct {
+	URL     *string  `json:"url" validate:"omitempty,url,max=512"`
+	Secret  *string  `json:"secret" validate:"omitempty,min=16,max=128"`
+	Events  []string `json:"events" validate:"omitempty,min=1,dive,oneof=hole.created report.created penalty.created bot.matched"`
+	Enabled *bool    `json:"enabled"`
+}
+
+type ListDeliveriesModel struct {
+	Offset int `json:"offset" query:"offset" default:"0" validate:"min=0"`
+	Size   int `json:"size" query:"size" default:"30" validate:"min=1,max=100"`
+}
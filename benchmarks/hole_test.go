@@ -6,8 +6,11 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+
 	. "treehole_next/models"
 	_ "treehole_next/tests"
+	"treehole_next/utils"
 )
 
 func BenchmarkListHoles(b *testing.B) {
@@ -21,6 +24,30 @@ func BenchmarkListHoles(b *testing.B) {
 	}
 }
 
+// BenchmarkListHolesQueries lists holes not in cache, queries/op should not grow with the page size
+func BenchmarkListHolesQueries(b *testing.B) {
+	var holes Holes
+	err := DB.Find(&holes).Error
+	assert.Nil(b, err)
+
+	for _, size := range []int{1, 5, 10} {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			queries.Store(0)
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				for _, hole := range holes {
+					_ = utils.DeleteCache(hole.CacheName())
+				}
+				route := "/api/holes?length=" + strconv.Itoa(size)
+				b.StartTimer()
+
+				benchmarkCommon(b, "get", route, REQUEST_BODY)
+			}
+			b.ReportMetric(float64(queries.Load())/float64(b.N), "queries/op")
+		})
+	}
+}
+
 func BenchmarkCreateHoles(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		// prepare
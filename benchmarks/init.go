@@ -19,26 +19,16 @@ const (
 	FLOOR_MAX    = 1000
 )
 
+// divisions are created by package tests, tags, holes and floors are appended to those of tests
 func init() {
 	DB.Logger = logger.Default.LogMode(logger.Silent)
 
-	divisions := make(Divisions, 0, DIVISION_MAX)
 	tags := make(Tags, 0, TAG_MAX)
 	holes := make(Holes, 0, HOLE_MAX)
-	floors := make(Floors, 0, FLOOR_MAX)
-
-	for i := 0; i < DIVISION_MAX; i++ {
-		divisions = append(divisions, &Division{
-			ID:          i + 1,
-			Name:        strings.Repeat("d", i+1),
-			Description: strings.Repeat("dd", i+1),
-		})
-	}
 
 	for i := 0; i < TAG_MAX; i++ {
 		content := fmt.Sprintf("%v", rand.Uint64())
 		tags = append(tags, &Tag{
-			ID:   i + 1,
 			Name: content,
 		})
 	}
@@ -52,7 +42,6 @@ func init() {
 			return nowTags
 		}
 		holes = append(holes, &Hole{
-			ID:         i + 1,
 			UserID:     1,
 			DivisionID: rand.Intn(DIVISION_MAX) + 1,
 			Tags:       generateTag(),
@@ -61,37 +50,20 @@ func init() {
 
 	for i := 0; i < FLOOR_MAX; i++ {
 		content := fmt.Sprintf("%v", rand.Uint64())
-		generateMention := func() Floors {
-			floorMentions := make(Floors, 0, rand.Intn(10))
-			for j := range floorMentions {
-				floorMentions[j] = &Floor{ID: rand.Intn(FLOOR_MAX) + 1}
-			}
-			return floorMentions
-		}
-		floors = append(floors, &Floor{
-			ID:        i + 1,
+		hole := holes[rand.Intn(HOLE_MAX)]
+		hole.Floors = append(hole.Floors, &Floor{
 			Content:   strings.Repeat(content, rand.Intn(2)),
 			Anonyname: utils.GenerateName([]string{}),
-			HoleID:    rand.Intn(HOLE_MAX) + 1,
-			Mention:   generateMention(),
+			Ranking:   hole.Reply,
 		})
-		holes[floors[i].HoleID-1].Reply += 1
+		hole.Reply += 1
 	}
 
-	var err error
-	err = DB.Create(divisions).Error
-	if err != nil {
-		log.Fatal().Err(err).Send()
-	}
-	err = DB.Create(tags).Error
-	if err != nil {
-		log.Fatal().Err(err).Send()
-	}
-	err = DB.Create(holes).Error
+	err := DB.Create(&tags).Error
 	if err != nil {
 		log.Fatal().Err(err).Send()
 	}
-	err = DB.Create(floors).Error
+	err = DB.Create(&holes).Error
 	if err != nil {
 		log.Fatal().Err(err).Send()
 	}
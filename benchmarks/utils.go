@@ -2,14 +2,18 @@ package benchmarks
 
 import (
 	"bytes"
+	"encoding/base64"
 	"io"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/goccy/go-json"
 	"github.com/hetiansu5/urlquery"
+	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
 
 	"treehole_next/bootstrap"
 	. "treehole_next/models"
@@ -17,8 +21,35 @@ import (
 
 var App, _ = bootstrap.Init()
 
+// queries counts queries to the database, except subqueries built in dry run
+var queries atomic.Int64
+
+func countQuery(tx *gorm.DB) {
+	if !tx.DryRun {
+		queries.Add(1)
+	}
+}
+
+func init() {
+	err := DB.Callback().Query().After("gorm:query").Register("benchmarks:count_query", countQuery)
+	if err != nil {
+		log.Fatal().Err(err).Send()
+	}
+	err = DB.Callback().Row().After("gorm:row").Register("benchmarks:count_row", countQuery)
+	if err != nil {
+		log.Fatal().Err(err).Send()
+	}
+	err = DB.Callback().Raw().After("gorm:raw").Register("benchmarks:count_raw", countQuery)
+	if err != nil {
+		log.Fatal().Err(err).Send()
+	}
+}
+
 var _ Map
 
+// an unsigned token of user 1, tokens are verified by the gateway in production
+var token = "Bearer e30." + base64.RawURLEncoding.EncodeToString([]byte(`{"id":1,"is_admin":true}`)) + ".e30"
+
 const (
 	REQUEST_BODY = iota
 	REQUEST_QUERY
@@ -55,6 +86,7 @@ func benchmarkCommon(b *testing.B, method string, route string, requestType int,
 	}
 
 	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Authorization", token)
 	assert.Nilf(b, err, "constructs http request")
 
 	b.StartTimer()
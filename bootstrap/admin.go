@@ -0,0 +1,263 @@
+package bootstrap
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-json"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+
+	"treehole_next/config"
+	"treehole_next/models"
+	"treehole_next/utils"
+)
+
+// adminCommand is a subcommand of treehole admin, run with arguments after its name.
+// Commands call the same functions as the HTTP API, so that the behavior matches
+type adminCommand struct {
+	usage string
+	// connect elasticsearch before running
+	search bool
+	// run without database
+	offline bool
+	run     func(operatorID int, args []string) error
+}
+
+var adminCommands = map[string]adminCommand{
+	"moderator list": {
+		usage: "moderator list <division_id>",
+		run:   adminListModerators,
+	},
+	"moderator add": {
+		usage: "moderator add <division_id> <user_id>...",
+		run: func(operatorID int, args []string) error {
+			return adminModifyModerators(operatorID, args, true)
+		},
+	},
+	"moderator remove": {
+		usage: "moderator remove <division_id> <user_id>...",
+		run: func(operatorID int, args []string) error {
+			return adminModifyModerators(operatorID, args, false)
+		},
+	},
+	"tag merge": {
+		usage: "tag merge [--tenant id] <from> <to>",
+		run:   adminMergeTag,
+	},
+	"hole reindex": {
+		usage:  "hole reindex <hole_id>...",
+		search: true,
+		run:    adminReindexHoles,
+	},
+	"user purge": {
+		usage: "user purge [--mode anonymize|delete] [--dry-run] <user_id>",
+		run:   adminPurgeUser,
+	},
+	"config dump": {
+		usage:   "config dump",
+		offline: true,
+		run: func(_ int, _ []string) error {
+			return printJSON(config.Dump())
+		},
+	},
+}
+
+func adminUsage() error {
+	usages := make([]string, 0, len(adminCommands))
+	for _, command := range adminCommands {
+		usages = append(usages, "  treehole admin [--operator id] "+command.usage)
+	}
+	slices.Sort(usages)
+	return errors.New("usage:\n" + strings.Join(usages, "\n"))
+}
+
+// Admin runs the admin command: treehole admin [--operator id] <command> <subcommand> [args]
+func Admin(args []string) error {
+	flags := flag.NewFlagSet("admin", flag.ContinueOnError)
+	operatorID := flags.Int("operator", 0, "user id recorded in admin logs, 0 for the command line")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) < 2 {
+		return adminUsage()
+	}
+	command, ok := adminCommands[args[0]+" "+args[1]]
+	if !ok {
+		return adminUsage()
+	}
+
+	config.InitConfig()
+	if !command.offline {
+		utils.InitCache()
+		if command.search {
+			models.Init()
+		}
+		models.InitDB()
+		defer func() {
+			_ = models.CloseDB()
+		}()
+	}
+
+	err = command.run(*operatorID, args[2:])
+	if err != nil {
+		return fmt.Errorf("%s: %w", command.usage, err)
+	}
+	// wait for cache invalidation and search engine updates
+	utils.WaitBackground(config.Config.ShutdownTimeout)
+	return nil
+}
+
+func printJSON(data any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+// parseIDs parses positive integer ids, at least one
+func parseIDs(args []string) ([]int, error) {
+	if len(args) == 0 {
+		return nil, errors.New("missing id")
+	}
+	ids := make([]int, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid id %q", arg)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func adminListModerators(_ int, args []string) error {
+	ids, err := parseIDs(args)
+	if err != nil || len(ids) != 1 {
+		return errors.New("expect one division id")
+	}
+	moderators := make([]models.DivisionModerator, 0)
+	err = models.DB.Where("division_id = ?", ids[0]).Order("user_id").Find(&moderators).Error
+	if err != nil {
+		return err
+	}
+	return printJSON(moderators)
+}
+
+// adminModifyModerators adds or removes moderators of a division, like PUT /divisions/{id}/moderators
+func adminModifyModerators(operatorID int, args []string, add bool) error {
+	ids, err := parseIDs(args)
+	if err != nil {
+		return err
+	}
+	if len(ids) < 2 {
+		return errors.New("expect a division id and user ids")
+	}
+	divisionID, userIDs := ids[0], ids[1:]
+
+	var moderators []models.DivisionModerator
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Take(&models.Division{}, divisionID).Error
+		if err != nil {
+			return err
+		}
+		var current []int
+		err = tx.Model(&models.DivisionModerator{}).Where("division_id = ?", divisionID).
+			Order("user_id").Pluck("user_id", &current).Error
+		if err != nil {
+			return err
+		}
+		if add {
+			current = append(current, userIDs...)
+		} else {
+			current = slices.DeleteFunc(current, func(userID int) bool { return slices.Contains(userIDs, userID) })
+		}
+
+		moderators, err = models.SetDivisionModerators(tx, divisionID, current)
+		if err != nil {
+			return err
+		}
+		models.CreateAdminLog(tx, models.AdminLogTypeDivision, operatorID, map[string]any{
+			"division_id": divisionID,
+			"moderators":  current,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return printJSON(moderators)
+}
+
+// adminMergeTag links holes of a tag to another tag and deletes it, like DELETE /tags/{id}
+func adminMergeTag(_ int, args []string) error {
+	flags := flag.NewFlagSet("tag merge", flag.ContinueOnError)
+	tenantID := flags.Int("tenant", models.DefaultTenantID, "tenant of tags")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return errors.New("expect names of two tags")
+	}
+
+	var tag, newTag models.Tag
+	err = models.DB.Where("name = ? AND tenant_id = ?", flags.Arg(0), *tenantID).Take(&tag).Error
+	if err != nil {
+		return fmt.Errorf("tag %s: %w", flags.Arg(0), err)
+	}
+	err = models.DB.Where("name = ? AND tenant_id = ?", flags.Arg(1), *tenantID).Take(&newTag).Error
+	if err != nil {
+		return fmt.Errorf("tag %s: %w", flags.Arg(1), err)
+	}
+
+	err = models.MergeTag(&tag, &newTag)
+	if err != nil {
+		return err
+	}
+	return printJSON(newTag)
+}
+
+func adminReindexHoles(_ int, args []string) error {
+	holeIDs, err := parseIDs(args)
+	if err != nil {
+		return err
+	}
+	for _, holeID := range holeIDs {
+		count, err := models.ReindexHole(holeID)
+		if err != nil {
+			return fmt.Errorf("hole %d: %w", holeID, err)
+		}
+		fmt.Printf("hole %d: %d floors\n", holeID, count)
+	}
+	return nil
+}
+
+// adminPurgeUser purges contents of a user, like POST /users/{user_id}/_purge
+func adminPurgeUser(operatorID int, args []string) error {
+	flags := flag.NewFlagSet("user purge", flag.ContinueOnError)
+	mode := flags.String("mode", models.PurgeModeAnonymize, "anonymize: reassign contents to the purged user; delete: also delete contents")
+	dryRun := flags.Bool("dry-run", false, "only count affected rows")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *mode != models.PurgeModeAnonymize && *mode != models.PurgeModeDelete {
+		return fmt.Errorf("invalid mode %q", *mode)
+	}
+	userIDs, err := parseIDs(flags.Args())
+	if err != nil || len(userIDs) != 1 {
+		return errors.New("expect one user id")
+	}
+
+	counts, err := models.PurgeUserData(operatorID, userIDs[0], *mode, *dryRun)
+	if err != nil {
+		return err
+	}
+	return printJSON(map[string]any{"mode": *mode, "dry_run": *dryRun, "counts": counts})
+}
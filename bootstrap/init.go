@@ -2,13 +2,21 @@ package bootstrap
 
 import (
 	"context"
+	"sync"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/opentreehole/go-common"
 
 	"treehole_next/apis"
+	"treehole_next/apis/activity"
+	"treehole_next/apis/course"
+	"treehole_next/apis/floor"
 	"treehole_next/apis/hole"
 	"treehole_next/apis/message"
+	"treehole_next/apis/retention"
+	"treehole_next/apis/tag"
+	"treehole_next/apis/user"
+	"treehole_next/apis/webhook"
 	"treehole_next/config"
 	"treehole_next/models"
 	"treehole_next/utils"
@@ -21,14 +29,16 @@ import (
 
 func Init() (*fiber.App, context.CancelFunc) {
 	config.InitConfig()
+	utils.InitTracing()
 	utils.InitCache()
 	sensitive.InitSensitiveLabelMap()
 	models.Init()
 	models.InitDB()
 	models.InitAdminList()
+	models.InitSpamChecker()
 
 	app := fiber.New(fiber.Config{
-		ErrorHandler:          common.ErrorHandler,
+		ErrorHandler:          utils.ErrorHandler,
 		JSONEncoder:           json.Marshal,
 		JSONDecoder:           json.Unmarshal,
 		DisableStartupMessage: true,
@@ -41,19 +51,51 @@ func Init() (*fiber.App, context.CancelFunc) {
 
 func registerMiddlewares(app *fiber.App) {
 	app.Use(recover.New(recover.Config{EnableStackTrace: true}))
+	app.Use(utils.MiddlewareRequestID)
+	app.Use(utils.MiddlewareTracing)
+	app.Use(utils.MiddlewareTimeout)
 	app.Use(common.MiddlewareGetUserID)
+	app.Use(models.MiddlewareReadYourWrites)
+	app.Use(models.MiddlewareRecordVisit)
 	if config.Config.Mode != "bench" {
-		app.Use(common.MiddlewareCustomLogger)
+		app.Use(utils.MiddlewareRequestLogger)
 	}
 	app.Use(pprof.New())
 }
 
+// startTasks starts background tasks, returns a function that stops them
+// and waits for them to flush, e.g. hole views
 func startTasks() context.CancelFunc {
 	ctx, cancel := context.WithCancel(context.Background())
-	go hole.UpdateHoleViews(ctx)
-	go hole.PurgeHole(ctx)
-	go message.PurgeMessage()
+	var wg sync.WaitGroup
+	run := func(task func(ctx context.Context)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			task(ctx)
+		}()
+	}
+	run(hole.UpdateHoleViews)
+	run(hole.PurgeHole)
+	run(hole.UpdateHotHoles)
+	run(hole.AutoTagNewHoles)
+	run(tag.UpdateTagStats)
+	run(floor.SendLikeDigests)
+	run(floor.SendSavedSearchAlerts)
+	run(floor.MaintainFloorPartitions)
+	run(message.RetryNotificationPushes)
+	run(message.SendDigests)
+	run(user.UpdateAnnualReports)
+	run(webhook.RetryDeliveries)
+	run(activity.SendActivityReminders)
+	run(course.UpdateCourseLinks)
+	run(retention.PurgeExpiredData)
+	run(utils.SubscribeLocalCache)
+	run(models.ProbeReplicas)
 	// go models.UpdateAdminList(ctx)
-	go sensitive.UpdateSensitiveLabelMap(ctx)
-	return cancel
+	run(sensitive.UpdateSensitiveLabelMap)
+	return func() {
+		cancel()
+		wg.Wait()
+	}
 }
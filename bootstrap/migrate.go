@@ -0,0 +1,62 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"treehole_next/config"
+	"treehole_next/models"
+)
+
+const migrateUsage = "usage: treehole migrate up [n] | down [n] | status"
+
+// Migrate runs the migrate command: treehole migrate up [n] | down [n] | status
+func Migrate(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New(migrateUsage)
+	}
+	n := 0
+	if len(args) == 2 {
+		var err error
+		n, err = strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid number of migrations %q", args[1])
+		}
+	}
+
+	config.InitConfig()
+	models.ConnectDB()
+
+	switch args[0] {
+	case "up":
+		versions, err := models.MigrateUp(n)
+		fmt.Printf("applied migrations: %v\n", versions)
+		return err
+	case "down":
+		if n == 0 {
+			n = 1
+		}
+		versions, err := models.MigrateDown(n)
+		fmt.Printf("reverted migrations: %v\n", versions)
+		return err
+	case "status":
+		states, err := models.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			appliedAt := "pending"
+			if state.AppliedAt != nil {
+				appliedAt = state.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if state.Destructive {
+				appliedAt += "  (destructive)"
+			}
+			fmt.Printf("%4d  %-32s  %s\n", state.Version, state.Name, appliedAt)
+		}
+		return nil
+	default:
+		return errors.New(migrateUsage)
+	}
+}
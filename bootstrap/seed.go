@@ -0,0 +1,55 @@
+package bootstrap
+
+import (
+	"errors"
+	"flag"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm/logger"
+
+	"treehole_next/config"
+	"treehole_next/models"
+	"treehole_next/utils"
+)
+
+// Seed runs the seed command, which generates synthetic data for load testing:
+// treehole seed --holes 100000 --floors 5000000
+func Seed(args []string) error {
+	var options models.SeedOptions
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	flags.IntVar(&options.Holes, "holes", 1000, "number of holes")
+	flags.IntVar(&options.Floors, "floors", 20000, "number of floors, including the first floor of each hole")
+	flags.IntVar(&options.Tags, "tags", 200, "number of tags")
+	flags.IntVar(&options.Users, "users", 10000, "number of users")
+	flags.IntVar(&options.DivisionID, "division", 0, "division of holes, all divisions if 0")
+	flags.IntVar(&options.Days, "days", 365, "holes are created in the last days")
+	flags.Int64Var(&options.Seed, "seed", 1, "seed of the random generator")
+	flags.BoolVar(&options.Index, "index", false, "index floors into elasticsearch")
+	flags.IntVar(&options.BatchSize, "batch", 1000, "rows per insert")
+	force := flags.Bool("force", false, "seed in production mode")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	config.InitConfig()
+	if config.Config.Mode == "production" && !*force {
+		return errors.New("refuse to seed in production mode without --force")
+	}
+	utils.InitCache()
+	if options.Index {
+		models.Init()
+	}
+	models.InitDB()
+	// SQL of batch inserts is too long to log
+	models.DB.Logger = models.DB.Logger.LogMode(logger.Warn)
+
+	start := time.Now()
+	err = models.Seed(options)
+	if err != nil {
+		return err
+	}
+	log.Info().Int("holes", options.Holes).Int("floors", options.Floors).Dur("took", time.Since(start)).Msg("seed finished")
+	return models.CloseDB()
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+const redacted = "***"
+
+// values of variables matching secretEnv are redacted entirely,
+// passwords in DSNs and URLs, e.g. DB_URL and REDIS_URL, are redacted by urlPassword
+var (
+	secretEnv   = regexp.MustCompile(`SECRET|PASSWORD|ACCESS_KEY`)
+	urlPassword = regexp.MustCompile(`:[^:@/]*@`)
+)
+
+// Dump returns Config keyed by environment variables, with secrets redacted
+func Dump() map[string]any {
+	result := make(map[string]any)
+	value := reflect.ValueOf(Config)
+	for i := 0; i < value.NumField(); i++ {
+		name, _, _ := strings.Cut(value.Type().Field(i).Tag.Get("env"), ",")
+		if name == "" {
+			continue
+		}
+		result[name] = redact(name, value.Field(i).Interface())
+	}
+	return result
+}
+
+func redact(name string, value any) any {
+	if secretEnv.MatchString(name) {
+		if reflect.ValueOf(value).IsZero() {
+			return value
+		}
+		return redacted
+	}
+	switch value := value.(type) {
+	case string:
+		return urlPassword.ReplaceAllString(value, ":"+redacted+"@")
+	case []string:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			values = append(values, urlPassword.ReplaceAllString(v, ":"+redacted+"@"))
+		}
+		return values
+	case *string:
+		if value == nil {
+			return value
+		}
+		return redact(name, *value)
+	case *url.URL:
+		if value == nil {
+			return value
+		}
+		return value.Redacted()
+	default:
+		return value
+	}
+}
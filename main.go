@@ -8,6 +8,9 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"treehole_next/bootstrap"
+	"treehole_next/config"
+	"treehole_next/models"
+	"treehole_next/utils"
 )
 
 //	@title			Open Tree Hole
@@ -24,6 +27,31 @@ import (
 //	@BasePath	/api
 
 func main() {
+	// treehole migrate up [n] | down [n] | status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := bootstrap.Migrate(os.Args[2:])
+		if err != nil {
+			log.Fatal().Err(err).Msg("migrate failed")
+		}
+		return
+	}
+	// treehole admin <command> <subcommand> [args], see bootstrap.Admin
+	if len(os.Args) > 1 && os.Args[1] == "admin" {
+		err := bootstrap.Admin(os.Args[2:])
+		if err != nil {
+			log.Fatal().Err(err).Msg("admin failed")
+		}
+		return
+	}
+	// treehole seed --holes 100000 --floors 5000000, see bootstrap.Seed
+	if len(os.Args) > 1 && os.Args[1] == "seed" {
+		err := bootstrap.Seed(os.Args[2:])
+		if err != nil {
+			log.Fatal().Err(err).Msg("seed failed")
+		}
+		return
+	}
+
 	app, cancel := bootstrap.Init()
 	go func() {
 		err := app.Listen("0.0.0.0:8000")
@@ -38,11 +66,25 @@ func main() {
 	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
 	<-interrupt
 
-	// close app
-	err := app.Shutdown()
+	// stop accepting new connections and wait for in-flight requests
+	err := app.ShutdownWithTimeout(config.Config.ShutdownTimeout)
 	if err != nil {
 		log.Err(err).Msg("error shutdown app")
 	}
-	// stop tasks
+	// stop tasks and flush hole views
 	cancel()
+	// wait for search engine indexing and notifications
+	if !utils.WaitBackground(config.Config.ShutdownTimeout) {
+		log.Warn().Msg("background jobs not finished before shutdown timeout")
+	}
+
+	err = models.CloseDB()
+	if err != nil {
+		log.Err(err).Msg("error close database")
+	}
+	err = utils.CloseCache()
+	if err != nil {
+		log.Err(err).Msg("error close cache")
+	}
+	log.Info().Msg("shutdown gracefully")
 }
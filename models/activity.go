@@ -0,0 +1,118 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+
+	"treehole_next/config"
+)
+
+// Activity is a campus event surfaced on the home screen of clients, managed by operators.
+// Users asking for a reminder are notified ACTIVITY_REMIND_BEFORE the start, see FlushActivityReminders
+type Activity struct {
+	ID        int       `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"time_created"`
+	UpdatedAt time.Time `json:"time_updated"`
+	TenantID  int       `json:"-" gorm:"not null;default:0;index"`
+	Title     string    `json:"title" gorm:"size:64;not null"`
+	StartTime time.Time `json:"start_time" gorm:"not null;index"`
+	EndTime   time.Time `json:"end_time" gorm:"not null;index"`
+	// 0 for all divisions
+	DivisionID int `json:"division_id" gorm:"not null;default:0"`
+	// the hole discussing the activity, 0 if none
+	HoleID    int `json:"hole_id" gorm:"not null;default:0"`
+	CreatedBy int `json:"-" gorm:"not null"`
+	// reminders are sent once
+	RemindedAt *time.Time `json:"-"`
+
+	// whether the user asked for a reminder, see ActivityReminder
+	Reminded bool `json:"reminded" gorm:"-:all"`
+}
+
+type Activities []*Activity
+
+// ActivityReminder is a user asking for a reminder of an activity
+type ActivityReminder struct {
+	ActivityID int       `json:"activity_id" gorm:"primaryKey;autoIncrement:false"`
+	UserID     int       `json:"user_id" gorm:"primaryKey;autoIncrement:false;index"`
+	CreatedAt  time.Time `json:"time_created"`
+}
+
+// LoadReminded sets Reminded of activities for the user
+func (activities Activities) LoadReminded(userID int) error {
+	if len(activities) == 0 {
+		return nil
+	}
+	activityIDs := make([]int, 0, len(activities))
+	for _, activity := range activities {
+		activityIDs = append(activityIDs, activity.ID)
+	}
+	var reminded []int
+	err := DB.Model(&ActivityReminder{}).Where("user_id = ? AND activity_id IN ?", userID, activityIDs).
+		Pluck("activity_id", &reminded).Error
+	if err != nil {
+		return err
+	}
+	remindedIDs := make(map[int]bool, len(reminded))
+	for _, activityID := range reminded {
+		remindedIDs[activityID] = true
+	}
+	for _, activity := range activities {
+		activity.Reminded = remindedIDs[activity.ID]
+	}
+	return nil
+}
+
+// reminder returns the notification reminding users of the activity, nil if nobody asked
+func (activity *Activity) reminder(tx *gorm.DB) (*Notification, error) {
+	var recipients []int
+	err := tx.Model(&ActivityReminder{}).Where("activity_id = ?", activity.ID).Pluck("user_id", &recipients).Error
+	if err != nil || len(recipients) == 0 {
+		return nil, err
+	}
+	url := fmt.Sprintf("/api/activities/%d", activity.ID)
+	if activity.HoleID != 0 {
+		url = fmt.Sprintf("/api/holes/%d", activity.HoleID)
+	}
+	return &Notification{
+		Data:        activity,
+		Recipients:  recipients,
+		Description: fmt.Sprintf("「%s」将于 %s 开始", activity.Title, activity.StartTime.In(time.Local).Format("01-02 15:04")),
+		Title:       "您关注的活动即将开始",
+		Type:        MessageTypeActivity,
+		URL:         url,
+	}, nil
+}
+
+// FlushActivityReminders notifies users of activities starting within ACTIVITY_REMIND_BEFORE from now
+func FlushActivityReminders(now time.Time) error {
+	var activities Activities
+	err := DB.Where("reminded_at IS NULL AND start_time > ? AND start_time <= ?",
+		now, now.Add(config.Config.ActivityRemindBefore)).Find(&activities).Error
+	if err != nil {
+		return err
+	}
+
+	for _, activity := range activities {
+		notification, err := activity.reminder(DB)
+		if err != nil {
+			return err
+		}
+		// marked before sending, so that failures are not repeated, pushes are retried by the notification queue
+		err = DB.Model(activity).UpdateColumn("reminded_at", now).Error
+		if err != nil {
+			return err
+		}
+		if notification == nil {
+			continue
+		}
+		_, err = notification.Send()
+		if err != nil {
+			log.Err(err).Str("model", "Activity").Int("id", activity.ID).Msg("send activity reminder failed")
+		}
+	}
+	return nil
+}
@@ -24,6 +24,20 @@ const (
 	AdminLogTypeMessage         AdminLogType = "send_message"
 	AdminLogTypeDeleteReport    AdminLogType = "delete_report"
 	AdminLogTypeChangeSensitive AdminLogType = "change_sensitive"
+	AdminLogTypePurgeUser       AdminLogType = "purge_user"
+	AdminLogTypeActAs           AdminLogType = "act_as"
+	AdminLogTypeAPIKey          AdminLogType = "edit_api_key"
+	AdminLogTypeBatchFloor      AdminLogType = "batch_floor"
+	AdminLogTypeReputation      AdminLogType = "edit_reputation"
+	AdminLogTypeLinkRule        AdminLogType = "edit_link_rule"
+	AdminLogTypeFeedback        AdminLogType = "edit_feedback"
+	AdminLogTypeAppeal          AdminLogType = "handle_appeal"
+	AdminLogTypeMergeHole       AdminLogType = "merge_hole"
+	AdminLogTypeBotRule         AdminLogType = "edit_bot_rule"
+	AdminLogTypeIdentityAudit   AdminLogType = "identity_audit"
+	AdminLogTypeLegalHold       AdminLogType = "legal_hold"
+	AdminLogTypeRetention       AdminLogType = "run_retention"
+	AdminLogTypeBackup          AdminLogType = "backup_marker"
 )
 
 // CreateAdminLog
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+const annualReportFavoriteTags = 3
+
+// AnnualReport is the yearly stats of a user, generated after the year ends, see GenerateAnnualReports
+type AnnualReport struct {
+	UserID int `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	Year   int `json:"year" gorm:"primaryKey;autoIncrement:false"`
+
+	// holes created by the user in the year
+	Holes int `json:"holes" gorm:"not null;default:0"`
+
+	// floors posted by the user in the year, including the first floors of holes
+	Floors int `json:"floors" gorm:"not null;default:0"`
+
+	// likes of floors posted in the year
+	LikesReceived int `json:"likes_received" gorm:"not null;default:0"`
+
+	// the division with most floors of the user, 0 if none
+	MostActiveDivisionID int `json:"most_active_division_id" gorm:"not null;default:0"`
+
+	// tags of holes the user posted most floors in
+	FavoriteTags []string `json:"favorite_tags" gorm:"serializer:json;not null"`
+
+	// ratio of floors posted from 0 to 5 o'clock in local time
+	NightOwlIndex float64 `json:"night_owl_index" gorm:"not null;default:0"`
+
+	CreatedAt time.Time `json:"time_created"`
+}
+
+type annualReportAccumulator struct {
+	report         *AnnualReport
+	divisionFloors map[int]int
+	nightFloors    int
+}
+
+// GenerateAnnualReports computes reports of all users who posted in the year and saves them,
+// existing reports of the year are replaced. Returns the number of reports
+func GenerateAnnualReports(year int) (int, error) {
+	start := time.Date(year, 1, 1, 0, 0, 0, 0, time.Local)
+	end := start.AddDate(1, 0, 0)
+	accumulators := make(map[int]*annualReportAccumulator)
+	get := func(userID int) *annualReportAccumulator {
+		accumulator, ok := accumulators[userID]
+		if !ok {
+			accumulator = &annualReportAccumulator{
+				report:         &AnnualReport{UserID: userID, Year: year, FavoriteTags: []string{}},
+				divisionFloors: make(map[int]int),
+			}
+			accumulators[userID] = accumulator
+		}
+		return accumulator
+	}
+
+	// floors
+	rows, err := DB.Table("floor").
+		Select("floor.user_id, floor.created_at, "+Quote("floor.like")+", hole.division_id").
+		Joins("JOIN hole ON hole.id = floor.hole_id").
+		Where("floor.created_at >= ? AND floor.created_at < ? AND floor.type = ?", start, end, FloorTypeUser).
+		Rows()
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var row struct {
+			UserID     int
+			CreatedAt  time.Time
+			Like       int
+			DivisionID int
+		}
+		err = DB.ScanRows(rows, &row)
+		if err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		accumulator := get(row.UserID)
+		accumulator.report.Floors++
+		accumulator.report.LikesReceived += row.Like
+		accumulator.divisionFloors[row.DivisionID]++
+		if row.CreatedAt.Local().Hour() < 5 {
+			accumulator.nightFloors++
+		}
+	}
+	err = rows.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	// holes
+	var holeCounts []struct {
+		UserID int
+		Count  int
+	}
+	err = DB.Model(&Hole{}).Unscoped().Select("user_id, COUNT(*) AS count").
+		Where("created_at >= ? AND created_at < ?", start, end).
+		Group("user_id").Scan(&holeCounts).Error
+	if err != nil {
+		return 0, err
+	}
+	for _, holeCount := range holeCounts {
+		get(holeCount.UserID).report.Holes = holeCount.Count
+	}
+
+	// tags
+	var tagCounts []struct {
+		UserID int
+		Name   string
+		Count  int
+	}
+	err = DB.Table("floor").Select("floor.user_id, tag.name, COUNT(*) AS count").
+		Joins("JOIN hole_tags ON hole_tags.hole_id = floor.hole_id").
+		Joins("JOIN tag ON tag.id = hole_tags.tag_id").
+		Where("floor.created_at >= ? AND floor.created_at < ? AND floor.type = ?", start, end, FloorTypeUser).
+		Group("floor.user_id, tag.name").Order("count DESC, tag.name").Scan(&tagCounts).Error
+	if err != nil {
+		return 0, err
+	}
+	for _, tagCount := range tagCounts {
+		report := get(tagCount.UserID).report
+		if len(report.FavoriteTags) < annualReportFavoriteTags {
+			report.FavoriteTags = append(report.FavoriteTags, tagCount.Name)
+		}
+	}
+
+	reports := make([]*AnnualReport, 0, len(accumulators))
+	for _, accumulator := range accumulators {
+		report := accumulator.report
+		maxFloors := 0
+		for divisionID, floors := range accumulator.divisionFloors {
+			if floors > maxFloors || floors == maxFloors && divisionID < report.MostActiveDivisionID {
+				maxFloors = floors
+				report.MostActiveDivisionID = divisionID
+			}
+		}
+		if report.Floors > 0 {
+			report.NightOwlIndex = float64(accumulator.nightFloors) / float64(report.Floors)
+		}
+		reports = append(reports, report)
+	}
+	if len(reports) == 0 {
+		return 0, nil
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].UserID < reports[j].UserID
+	})
+
+	err = DB.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(reports, 500).Error
+	return len(reports), err
+}
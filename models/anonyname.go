@@ -62,3 +62,22 @@ func FindOrGenerateAnonyname(tx *gorm.DB, holeID, userID int) (string, error) {
 	}
 	return anonyname, nil
 }
+
+// PosterHoleOwner is the alias of the poster of the first floor in PosterScope
+const PosterHoleOwner = "洞主"
+
+// PosterScope filters floors of the hole by the anonyname of the poster, resolved from AnonynameMapping
+// in the query so that user ids are never returned. An empty poster matches all floors
+func PosterScope(holeID int, poster string) func(tx *gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		switch poster {
+		case "":
+			return tx
+		case PosterHoleOwner:
+			return tx.Where("floor.user_id IN (?)", DB.Model(&Hole{}).Select("user_id").Where("id = ?", holeID))
+		default:
+			return tx.Where("floor.user_id IN (?)", DB.Model(&AnonynameMapping{}).Select("user_id").
+				Where("hole_id = ? AND anonyname = ?", holeID, poster))
+		}
+	}
+}
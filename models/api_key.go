@@ -0,0 +1,176 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+
+	"treehole_next/utils"
+)
+
+// APIKey authenticates internal services and bots by X-API-Key header instead of user JWTs.
+// Requests with a key act as the service account of the key, which is never an admin.
+// Reads need ScopeRead, writes are only allowed on routes with MiddlewareAPIKeyScope.
+type APIKey struct {
+	ID        int       `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"time_created"`
+	Name      string    `json:"name" gorm:"size:64;not null"`
+
+	// leading characters of the key to tell keys apart, the key itself is only responded on creation
+	Prefix string `json:"prefix" gorm:"size:16;not null"`
+
+	// sha256 of the key
+	Hash string `json:"-" gorm:"size:64;not null;uniqueIndex"`
+
+	Scopes []string `json:"scopes" gorm:"serializer:json;not null"`
+
+	// service account the requests act as
+	UserID int `json:"user_id" gorm:"not null"`
+
+	// admin who created the key
+	CreatedBy int `json:"created_by" gorm:"not null"`
+
+	// updated at most once a minute
+	LastUsedAt *time.Time `json:"time_last_used"`
+	RevokedAt  *time.Time `json:"time_revoked"`
+}
+
+const (
+	// GET and HEAD requests on all routes
+	ScopeRead = "read"
+
+	ScopeHolesWrite   = "holes:write"
+	ScopeFloorsWrite  = "floors:write"
+	ScopeReportsWrite = "reports:write"
+	// replies of bots, see BotRule
+	ScopeBotWrite = "bot:write"
+	// links of the curriculum-review service, see CourseLink
+	ScopeCoursesWrite = "courses:write"
+)
+
+var APIKeyScopes = []string{ScopeRead, ScopeHolesWrite, ScopeFloorsWrite, ScopeReportsWrite, ScopeBotWrite, ScopeCoursesWrite}
+
+const apiKeyPrefix = "thk_"
+
+// NewAPIKey creates a key acting as userID, the key is returned only here
+func NewAPIKey(tx *gorm.DB, name string, userID, createdBy int, scopes []string) (*APIKey, string, error) {
+	buf := make([]byte, 24)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return nil, "", err
+	}
+	key := apiKeyPrefix + hex.EncodeToString(buf)
+
+	apiKey := APIKey{
+		Name:      name,
+		Prefix:    key[:len(apiKeyPrefix)+8],
+		Hash:      hashAPIKey(key),
+		Scopes:    scopes,
+		UserID:    userID,
+		CreatedBy: createdBy,
+	}
+	err = tx.Create(&apiKey).Error
+	if err != nil {
+		return nil, "", err
+	}
+	return &apiKey, key, nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (apiKey *APIKey) HasScope(scope string) bool {
+	return slices.Contains(apiKey.Scopes, scope)
+}
+
+// GetAPIKey returns the key of request set by MiddlewareAPIKey, nil if the request is from a user
+func GetAPIKey(c *fiber.Ctx) *APIKey {
+	apiKey, _ := c.Locals("api_key").(*APIKey)
+	return apiKey
+}
+
+// MiddlewareAPIKey authenticates requests with X-API-Key header, registered before MiddlewareGetUser.
+// The key replaces user credentials, writes are authenticated by MiddlewareAPIKeyScope of the route.
+func MiddlewareAPIKey(c *fiber.Ctx) error {
+	key := c.Get("X-API-Key")
+	if key == "" {
+		return c.Next()
+	}
+
+	var apiKey APIKey
+	err := RequestDB(c).Where("hash = ? AND revoked_at IS NULL", hashAPIKey(key)).Take(&apiKey).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.NewError(utils.ErrCodeInvalidAPIKey, "API key 无效或已撤销")
+		}
+		return err
+	}
+
+	now := time.Now()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > time.Minute {
+		apiKey.LastUsedAt = &now
+		err = RequestDB(c).Model(&apiKey).UpdateColumn("last_used_at", now).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	c.Request().Header.Del(fiber.HeaderAuthorization)
+	c.Request().Header.Del("X-Consumer-Username")
+	c.Locals("api_key", &apiKey)
+
+	if c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead {
+		if !apiKey.HasScope(ScopeRead) {
+			return utils.NewError(utils.ErrCodeAPIKeyScope, "API key 无权访问该接口")
+		}
+		err = apiKey.authenticate(c)
+		if err != nil {
+			return err
+		}
+	}
+	return c.Next()
+}
+
+// MiddlewareAPIKeyScope allows requests with an API key of scope to write on the route, users are not affected
+func MiddlewareAPIKeyScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		apiKey := GetAPIKey(c)
+		if apiKey == nil {
+			return c.Next()
+		}
+		if !apiKey.HasScope(scope) {
+			return utils.NewError(utils.ErrCodeAPIKeyScope, "API key 无权访问该接口")
+		}
+		err := apiKey.authenticate(c)
+		if err != nil {
+			return err
+		}
+		return c.Next()
+	}
+}
+
+// authenticate sets the service account as the user of request, see GetCurrLoginUser
+func (apiKey *APIKey) authenticate(c *fiber.Ctx) error {
+	user := &User{
+		BanDivision: make(map[int]*time.Time),
+	}
+	err := user.LoadUserByID(apiKey.UserID)
+	if err != nil {
+		return err
+	}
+	user.HasAnsweredQuestions = true
+	user.setPermission()
+
+	c.Locals("user", user)
+	c.Request().Header.Set("X-Consumer-Username", strconv.Itoa(apiKey.UserID))
+	return nil
+}
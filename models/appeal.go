@@ -0,0 +1,233 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+
+	"treehole_next/utils"
+)
+
+// status of appeals
+const (
+	AppealStatusPending  = "pending"
+	AppealStatusApproved = "approved"
+	AppealStatusRejected = "rejected"
+)
+
+// Appeal is a request of the poster to restore a deleted floor and revoke punishments on it.
+// It's linked to the report and the punishment of the floor for traceability, see Appeal.Handle
+type Appeal struct {
+	ID        int       `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"time_created"`
+	UpdatedAt time.Time `json:"time_updated"`
+	// the poster of the floor
+	UserID  int `json:"user_id" gorm:"not null;index"`
+	FloorID int `json:"floor_id" gorm:"not null;index"`
+	// the last report of the floor when appealed, if any
+	ReportID *int `json:"report_id"`
+	// the punishment on the floor when appealed, if any
+	PunishmentID *int   `json:"punishment_id"`
+	Reason       string `json:"reason" gorm:"size:256;not null"`
+	Status       string `json:"status" gorm:"size:16;not null;default:pending;index"`
+	// who handled the appeal
+	HandledBy int    `json:"handled_by"`
+	Result    string `json:"result" gorm:"size:128;not null;default:''"`
+}
+
+type Appeals []Appeal
+
+// CreateAppeal appeals a floor of the user which is deleted or punished, one pending appeal a floor
+func CreateAppeal(userID, floorID int, reason string) (*Appeal, error) {
+	appeal := Appeal{UserID: userID, FloorID: floorID, Reason: reason, Status: AppealStatusPending}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var floor Floor
+		err := tx.Take(&floor, floorID).Error
+		if err != nil {
+			return err
+		}
+		if floor.UserID != userID {
+			return utils.NewError(utils.ErrCodeNotFloorOwner, "只能申诉自己的楼层")
+		}
+
+		var report Report
+		err = tx.Where("floor_id = ?", floorID).Order("id DESC").Take(&report).Error
+		if err == nil {
+			appeal.ReportID = &report.ID
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		var punishment Punishment
+		err = tx.Where("floor_id = ?", floorID).Take(&punishment).Error
+		if err == nil {
+			appeal.PunishmentID = &punishment.ID
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if !floor.Deleted && appeal.PunishmentID == nil {
+			return utils.NewError(utils.ErrCodeInvalidRequest, "该楼层未被删除或处罚，无需申诉")
+		}
+
+		var count int64
+		err = tx.Model(&Appeal{}).Where("floor_id = ? AND status = ?", floorID, AppealStatusPending).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return utils.NewError(utils.ErrCodeInvalidRequest, "该楼层已有待处理的申诉")
+		}
+		return tx.Create(&appeal).Error
+	})
+	return &appeal, err
+}
+
+// Handle approves or rejects the pending appeal. Approved appeals restore the floor to the version
+// before deleted, revoke the punishment on the floor and notify the poster and the moderator who punished.
+func (appeal *Appeal) Handle(adminID int, status, result string) error {
+	var floor Floor
+	var punishment Punishment
+	var restored bool
+	err := DB.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(appeal, appeal.ID).Error
+		if err != nil {
+			return err
+		}
+		if appeal.Status != AppealStatusPending {
+			return utils.NewError(utils.ErrCodeInvalidStatusTransition, "该申诉已处理")
+		}
+		appeal.Status = status
+		appeal.HandledBy = adminID
+		appeal.Result = result
+		err = tx.Model(appeal).Select("Status", "HandledBy", "Result").Updates(appeal).Error
+		if err != nil || status != AppealStatusApproved {
+			return err
+		}
+
+		err = tx.Take(&floor, appeal.FloorID).Error
+		if err != nil {
+			return err
+		}
+		if floor.Deleted {
+			restored, err = restoreDeletedFloor(tx, &floor, adminID)
+			if err != nil {
+				return err
+			}
+		}
+		if appeal.PunishmentID != nil {
+			err = tx.Take(&punishment, *appeal.PunishmentID).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// revoked already
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			return punishment.Revoke(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	CreateAdminLog(DB, AdminLogTypeAppeal, adminID, appeal)
+	if restored {
+		err = DeleteHoleCache(DB, floor.HoleID)
+		if err != nil {
+			return err
+		}
+		floorModel := FloorModel{ID: floor.ID, UpdatedAt: time.Now(), Content: floor.Content}
+		utils.Go(func() { FloorIndex(floorModel) })
+	}
+	appeal.sendResult(punishment.MadeBy)
+	return nil
+}
+
+// restoreDeletedFloor restores the floor to the version backed up when it was deleted, false if no backup
+func restoreDeletedFloor(tx *gorm.DB, floor *Floor, adminID int) (bool, error) {
+	var history FloorHistory
+	err := tx.Where("floor_id = ?", floor.ID).Order("id DESC").Take(&history).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	err = floor.Backup(tx, adminID, "申诉通过")
+	if err != nil {
+		return false, err
+	}
+	floor.Deleted = false
+	floor.Content = history.Content
+	floor.IsSensitive = history.IsSensitive
+	floor.IsActualSensitive = history.IsActualSensitive
+	floor.SensitiveDetail = history.SensitiveDetail
+	floor.Version += 1
+	err = tx.Model(floor).
+		Select("Deleted", "Content", "IsSensitive", "IsActualSensitive", "SensitiveDetail", "Version").
+		Updates(floor).Error
+	return err == nil, err
+}
+
+// Revoke deletes the punishment and shortens the ban of the user by the time left
+func (punishment *Punishment) Revoke(tx *gorm.DB) error {
+	var user User
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&user, punishment.UserID).Error
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	start := punishment.StartTime
+	if start.Before(now) {
+		start = now
+	}
+	left := punishment.EndTime.Sub(start)
+	if endTime := user.BanDivision[punishment.DivisionID]; endTime != nil && left > 0 {
+		*endTime = endTime.Add(-left)
+		if !endTime.After(now) {
+			delete(user.BanDivision, punishment.DivisionID)
+		}
+	}
+	user.OffenceCount = max(user.OffenceCount-1, 0)
+	err = tx.Select("BanDivision", "OffenceCount").Save(&user).Error
+	if err != nil {
+		return err
+	}
+	return tx.Delete(punishment).Error
+}
+
+func (appeal *Appeal) sendResult(punishedBy int) {
+	description := fmt.Sprintf("您对楼层 ##%d 的申诉未通过。\n处理结果：%s", appeal.FloorID, appeal.Result)
+	if appeal.Status == AppealStatusApproved {
+		description = fmt.Sprintf("您对楼层 ##%d 的申诉已通过，内容已恢复，相关处罚已撤销。\n处理结果：%s", appeal.FloorID, appeal.Result)
+	}
+	messages := []Notification{{
+		Data:        appeal,
+		Recipients:  []int{appeal.UserID},
+		Description: description,
+		Title:       "您的申诉已得到处理",
+		Type:        MessageTypePermission,
+		URL:         fmt.Sprintf("/api/appeals/%d", appeal.ID),
+	}}
+	if appeal.Status == AppealStatusApproved && punishedBy != 0 && punishedBy != appeal.HandledBy {
+		messages = append(messages, Notification{
+			Data:        appeal,
+			Recipients:  []int{punishedBy},
+			Description: fmt.Sprintf("您对楼层 ##%d 的处罚已因申诉通过被撤销。\n处理结果：%s", appeal.FloorID, appeal.Result),
+			Title:       "处罚已撤销",
+			Type:        MessageTypePermission,
+			URL:         fmt.Sprintf("/api/appeals/%d", appeal.ID),
+		})
+	}
+	for _, message := range messages {
+		_, err := message.Send()
+		if err != nil {
+			log.Err(err).Str("model", "Notification").Msg("send appeal result failed")
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/plugin/dbresolver"
+
+	"treehole_next/config"
+	"treehole_next/utils"
+)
+
+// BackupMarker is written to the database and the cache at the same moment while background writers are quiesced,
+// a logical backup of MySQL up to the binlog position and the next Redis snapshot are consistent with each other.
+// After restoring both, the latest marker of the database should be the marker in the cache, see GetBackupStatus
+type BackupMarker struct {
+	ID        int       `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"time_created"`
+
+	// the admin who created the marker
+	UserID int `json:"user_id" gorm:"not null"`
+
+	Note string `json:"note" gorm:"size:255;not null;default:''"`
+
+	// binlog position of the source database after the marker is written, empty if not MySQL or binlog is disabled
+	BinlogFile      string `json:"binlog_file" gorm:"size:255;not null;default:''"`
+	BinlogPosition  int64  `json:"binlog_position" gorm:"not null;default:0"`
+	ExecutedGtidSet string `json:"executed_gtid_set" gorm:"type:text"`
+
+	// the last Redis snapshot before the marker, a snapshot including the marker is started in background.
+	// Null if Redis is not configured
+	RedisLastSave *time.Time `json:"redis_last_save"`
+}
+
+// the cache key of the latest marker
+const backupMarkerCacheKey = "backup_marker"
+
+type binlogStatus struct {
+	File            string `gorm:"column:File"`
+	Position        int64  `gorm:"column:Position"`
+	ExecutedGtidSet string `gorm:"column:Executed_Gtid_Set"`
+}
+
+// CreateBackupMarker quiesces background writers, records a marker in the database and the cache with the binlog position,
+// starts a Redis snapshot and resumes the writers
+func CreateBackupMarker(userID int, note string) (*BackupMarker, error) {
+	resume, err := utils.QuiesceWriters(config.Config.BackupQuiesceTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer resume()
+
+	marker := BackupMarker{UserID: userID, Note: note}
+	tx := DB.Clauses(dbresolver.Write)
+	err = tx.Create(&marker).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if isMySQL(tx) {
+		var status binlogStatus
+		// SHOW MASTER STATUS is renamed in MySQL 8.4
+		err = tx.Raw("SHOW BINARY LOG STATUS").Scan(&status).Error
+		if err != nil {
+			err = tx.Raw("SHOW MASTER STATUS").Scan(&status).Error
+		}
+		if err != nil {
+			log.Err(err).Msg("error get binlog position")
+		}
+		marker.BinlogFile = status.File
+		marker.BinlogPosition = status.Position
+		marker.ExecutedGtidSet = status.ExecutedGtidSet
+	}
+
+	err = utils.SetCache(backupMarkerCacheKey, marker.ID, 0)
+	if err != nil {
+		return nil, err
+	}
+	if redis := utils.Redis(); redis != nil {
+		ctx := context.Background()
+		lastSave, err := redis.LastSave(ctx).Result()
+		if err != nil {
+			return nil, err
+		}
+		lastSaveTime := time.Unix(lastSave, 0)
+		marker.RedisLastSave = &lastSaveTime
+		// fails if a snapshot is in progress, which may not include the marker
+		err = redis.BgSave(ctx).Err()
+		if err != nil {
+			log.Err(err).Msg("error start redis snapshot")
+		}
+	}
+
+	err = tx.Save(&marker).Error
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Int("marker_id", marker.ID).Str("binlog_file", marker.BinlogFile).
+		Int64("binlog_position", marker.BinlogPosition).Msg("backup marker created")
+	return &marker, nil
+}
+
+// BackupStatus compares the latest marker of the database with the marker in the cache
+type BackupStatus struct {
+	// the latest marker in the database, null if none
+	Marker *BackupMarker `json:"marker"`
+
+	// id of the marker in the cache, 0 if none
+	CacheMarkerID int `json:"cache_marker_id"`
+
+	// the database and the cache are restored from backups with the same marker
+	Consistent bool `json:"consistent"`
+}
+
+// GetBackupStatus tells if the database and the cache are restored from consistent backups
+func GetBackupStatus() (*BackupStatus, error) {
+	var status BackupStatus
+	var markers []BackupMarker
+	err := DB.Clauses(dbresolver.Write).Order("id desc").Limit(1).Find(&markers).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(markers) > 0 {
+		status.Marker = &markers[0]
+	}
+	utils.GetCache(backupMarkerCacheKey, &status.CacheMarkerID)
+	if status.Marker != nil {
+		status.Consistent = status.Marker.ID == status.CacheMarkerID
+	} else {
+		status.Consistent = status.CacheMarkerID == 0
+	}
+	return &status, nil
+}
@@ -0,0 +1,266 @@
+package models
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"treehole_next/config"
+	"treehole_next/utils"
+)
+
+// events checking badges, see TriggerBadges
+const (
+	// the user posted a floor or a hole
+	BadgeEventPost = "post"
+	// a floor of the user got a like
+	BadgeEventLike = "like"
+	// a report of the user was dealt with the floor removed
+	BadgeEventReport = "report"
+	// the user listed badges, checks badges depending on time
+	BadgeEventVisit = "visit"
+)
+
+const (
+	BadgeFirstPost       = "first_post"
+	BadgeLikes100        = "likes_100"
+	BadgeYearOne         = "year_one"
+	BadgeHelpfulReporter = "helpful_reporter"
+)
+
+// helpful reporters have at least the reports dealt with the floor removed
+const badgeHelpfulReports = 5
+
+// badgeSubject is the user checked for badges, data is loaded once when needed
+type badgeSubject struct {
+	tx         *gorm.DB
+	userID     int
+	joinedTime time.Time
+	stats      *UserStats
+}
+
+func (subject *badgeSubject) loadStats() (*UserStats, error) {
+	if subject.stats != nil {
+		return subject.stats, nil
+	}
+	var err error
+	subject.stats, err = GetUserStats(subject.tx, subject.userID)
+	return subject.stats, err
+}
+
+// BadgeDefinition is a badge earned once checked by any of Events, badges are enabled by config.Config.Badges
+type BadgeDefinition struct {
+	Name        string   `json:"name"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Events      []string `json:"-"`
+	earned      func(subject *badgeSubject) (bool, error)
+}
+
+var BadgeDefinitions = []BadgeDefinition{
+	{
+		Name:        BadgeFirstPost,
+		Title:       "初来乍到",
+		Description: "发布第一条内容",
+		Events:      []string{BadgeEventPost},
+		earned: func(subject *badgeSubject) (bool, error) {
+			stats, err := subject.loadStats()
+			return err == nil && stats.Floors > 0, err
+		},
+	},
+	{
+		Name:        BadgeLikes100,
+		Title:       "小有名气",
+		Description: "累计获得 100 个赞",
+		Events:      []string{BadgeEventLike},
+		earned: func(subject *badgeSubject) (bool, error) {
+			stats, err := subject.loadStats()
+			return err == nil && stats.LikesReceived >= 100, err
+		},
+	},
+	{
+		Name:        BadgeYearOne,
+		Title:       "一周年",
+		Description: "注册满一年",
+		Events:      []string{BadgeEventPost, BadgeEventVisit},
+		earned: func(subject *badgeSubject) (bool, error) {
+			joinedTime := subject.joinedTime
+			if joinedTime.IsZero() {
+				// saved from the token when the reputation is loaded
+				var reputation UserReputation
+				err := subject.tx.Where("user_id = ?", subject.userID).Limit(1).Find(&reputation).Error
+				if err != nil || reputation.JoinedTime == nil {
+					return false, err
+				}
+				joinedTime = *reputation.JoinedTime
+			}
+			return !time.Now().AddDate(-1, 0, 0).Before(joinedTime), nil
+		},
+	},
+	{
+		Name:        BadgeHelpfulReporter,
+		Title:       "热心群众",
+		Description: "5 次举报被采纳",
+		Events:      []string{BadgeEventReport},
+		earned: func(subject *badgeSubject) (bool, error) {
+			var count int64
+			err := subject.tx.Model(&Report{}).
+				Where("user_id = ? AND dealt = ? AND outcome = ?", subject.userID, true, ReportOutcomeRemoved).
+				Count(&count).Error
+			return count >= badgeHelpfulReports, err
+		},
+	},
+}
+
+// EnabledBadges returns definitions of badges in config.Config.Badges
+func EnabledBadges() []BadgeDefinition {
+	badges := make([]BadgeDefinition, 0, len(BadgeDefinitions))
+	for _, badge := range BadgeDefinitions {
+		if slices.Contains(config.Config.Badges, badge.Name) {
+			badges = append(badges, badge)
+		}
+	}
+	return badges
+}
+
+// UserBadge is a badge awarded to a user, shown next to the anonyname in holes if the user chooses to
+type UserBadge struct {
+	UserID    int       `json:"-" gorm:"primaryKey;autoIncrement:false"`
+	Badge     string    `json:"badge" gorm:"primaryKey;size:32"`
+	CreatedAt time.Time `json:"time_awarded"`
+	Shown     bool      `json:"shown" gorm:"not null;default:false"`
+}
+
+// BadgeResponse is an enabled badge with the award of the user, if awarded
+type BadgeResponse struct {
+	BadgeDefinition
+	Awarded     bool       `json:"awarded"`
+	TimeAwarded *time.Time `json:"time_awarded"`
+	Shown       bool       `json:"shown"`
+}
+
+// AwardBadges awards enabled badges checked by the event and not awarded yet to the user, returns the new badges.
+// joinedTime is from the token of the user, or zero if unknown
+func AwardBadges(tx *gorm.DB, userID int, joinedTime time.Time, event string) ([]string, error) {
+	var awarded []string
+	err := tx.Model(&UserBadge{}).Where("user_id = ?", userID).Pluck("badge", &awarded).Error
+	if err != nil {
+		return nil, err
+	}
+
+	subject := &badgeSubject{tx: tx, userID: userID, joinedTime: joinedTime}
+	var badges []string
+	for _, badge := range EnabledBadges() {
+		if !slices.Contains(badge.Events, event) || slices.Contains(awarded, badge.Name) {
+			continue
+		}
+		earned, err := badge.earned(subject)
+		if err != nil {
+			return nil, err
+		}
+		if earned {
+			badges = append(badges, badge.Name)
+		}
+	}
+	if len(badges) == 0 {
+		return badges, nil
+	}
+
+	userBadges := make([]UserBadge, 0, len(badges))
+	for _, badge := range badges {
+		userBadges = append(userBadges, UserBadge{UserID: userID, Badge: badge})
+	}
+	return badges, tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&userBadges).Error
+}
+
+// TriggerBadges awards badges checked by the event to the user in background, call after the event is committed
+func TriggerBadges(userID int, event string) {
+	if len(config.Config.Badges) == 0 {
+		return
+	}
+	utils.Go(func() {
+		badges, err := AwardBadges(DB, userID, time.Time{}, event)
+		if err != nil {
+			log.Err(err).Int("user_id", userID).Str("event", event).Msg("error award badges")
+			return
+		}
+		if len(badges) > 0 {
+			log.Info().Int("user_id", userID).Strs("badges", badges).Msg("badges awarded")
+		}
+	})
+}
+
+// ListUserBadges returns enabled badges with awards of the user
+func ListUserBadges(tx *gorm.DB, userID int) ([]BadgeResponse, error) {
+	var userBadges []UserBadge
+	err := tx.Where("user_id = ?", userID).Find(&userBadges).Error
+	if err != nil {
+		return nil, err
+	}
+	enabled := EnabledBadges()
+	badges := make([]BadgeResponse, 0, len(enabled))
+	for _, badge := range enabled {
+		response := BadgeResponse{BadgeDefinition: badge}
+		for i := range userBadges {
+			if userBadges[i].Badge == badge.Name {
+				response.Awarded = true
+				response.TimeAwarded = &userBadges[i].CreatedAt
+				response.Shown = userBadges[i].Shown
+			}
+		}
+		badges = append(badges, response)
+	}
+	return badges, nil
+}
+
+// ShowUserBadges shows awarded badges of the user in shown next to the anonyname, and hides the others
+func ShowUserBadges(tx *gorm.DB, userID int, shown []string) error {
+	var awarded []string
+	err := tx.Model(&UserBadge{}).Where("user_id = ?", userID).Pluck("badge", &awarded).Error
+	if err != nil {
+		return err
+	}
+	for _, badge := range shown {
+		if !slices.Contains(awarded, badge) {
+			return utils.NewError(utils.ErrCodeBadgeNotAwarded, "未获得该徽章")
+		}
+	}
+	err = tx.Model(&UserBadge{}).Where("user_id = ?", userID).Update("shown", false).Error
+	if err != nil {
+		return err
+	}
+	if len(shown) == 0 {
+		return nil
+	}
+	return tx.Model(&UserBadge{}).Where("user_id = ? AND badge IN ?", userID, shown).Update("shown", true).Error
+}
+
+// loadBadges sets badges shown by authors of floors, disabled badges are omitted
+func (floors Floors) loadBadges() error {
+	if len(floors) == 0 || len(config.Config.Badges) == 0 {
+		return nil
+	}
+	// user_id is not kept in hole cache, join floors
+	var rows []struct {
+		FloorID int
+		Badge   string
+	}
+	err := DB.Table("floor").Select("floor.id AS floor_id, user_badge.badge").
+		Joins("JOIN user_badge ON user_badge.user_id = floor.user_id AND user_badge.shown = ?", true).
+		Where("floor.id IN ? AND user_badge.badge IN ?", utils.Models2IDSlice(floors), config.Config.Badges).
+		Order("user_badge.created_at").Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	badges := make(map[int][]string)
+	for _, row := range rows {
+		badges[row.FloorID] = append(badges[row.FloorID], row.Badge)
+	}
+	for _, floor := range floors {
+		floor.Badges = badges[floor.ID]
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+
+	"treehole_next/utils"
+)
+
+// BotRule notifies bot services of new holes with any of the keywords by the bot.matched webhook event,
+// in divisions with Division.BotEnabled. Bots reply by POST /bot/holes/{id}/floors with an API key of ScopeBotWrite
+type BotRule struct {
+	ID        int       `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"time_created"`
+	Name      string    `json:"name" gorm:"size:32;not null"`
+	// matched case-insensitively against the first floor
+	Keywords []string `json:"keywords" gorm:"serializer:json;not null"`
+	// 0 for all divisions
+	DivisionID int  `json:"division_id" gorm:"not null;default:0"`
+	Enabled    bool `json:"enabled" gorm:"not null;default:true"`
+	CreatedBy  int  `json:"created_by"`
+}
+
+type BotRules []BotRule
+
+// BotMatchData is the data of bot.matched, the poster is not included
+type BotMatchData struct {
+	RuleID   int      `json:"rule_id"`
+	RuleName string   `json:"rule_name"`
+	Keywords []string `json:"keywords"`
+	WebhookHoleData
+}
+
+const botRulesCacheKey = "bot_rules"
+
+// LoadBotRules returns all bot rules, cached until rules are modified
+func LoadBotRules() (rules BotRules, err error) {
+	if utils.GetCache(botRulesCacheKey, &rules) {
+		return rules, nil
+	}
+	err = DB.Order("id").Find(&rules).Error
+	if err != nil {
+		return nil, err
+	}
+	return rules, utils.SetCache(botRulesCacheKey, rules, 0)
+}
+
+func DeleteBotRulesCache() error {
+	return utils.DeleteCache(botRulesCacheKey)
+}
+
+// Match returns keywords of the rule in content, nil if the rule doesn't apply to the division
+func (rule *BotRule) Match(divisionID int, content string) []string {
+	if !rule.Enabled || rule.DivisionID != 0 && rule.DivisionID != divisionID {
+		return nil
+	}
+	content = strings.ToLower(content)
+	var matched []string
+	for _, keyword := range rule.Keywords {
+		if keyword != "" && strings.Contains(content, strings.ToLower(keyword)) {
+			matched = append(matched, keyword)
+		}
+	}
+	return matched
+}
+
+// TriggerBotRules triggers bot.matched of rules matching the new hole if bots are enabled in the division.
+// Errors are logged only, bots should never fail the request.
+func TriggerBotRules(hole *Hole) {
+	if len(hole.Floors) == 0 {
+		return
+	}
+	rules, err := LoadBotRules()
+	if err != nil {
+		log.Err(err).Str("model", "BotRule").Msg("load bot rules failed")
+		return
+	}
+	if len(rules) == 0 {
+		return
+	}
+	var division Division
+	err = DB.Select("id", "bot_enabled").Take(&division, hole.DivisionID).Error
+	if err != nil {
+		log.Err(err).Str("model", "BotRule").Msg("load division failed")
+		return
+	}
+	if !division.BotEnabled {
+		return
+	}
+	for _, rule := range rules {
+		keywords := rule.Match(hole.DivisionID, hole.Floors[0].Content)
+		if len(keywords) == 0 {
+			continue
+		}
+		TriggerWebhook(WebhookEventBotMatched, BotMatchData{
+			RuleID:          rule.ID,
+			RuleName:        rule.Name,
+			Keywords:        keywords,
+			WebhookHoleData: NewWebhookHoleData(hole),
+		})
+	}
+}
+
+// CreateBotFloor appends a floor of FloorTypeBot named name to the hole, if bots are enabled in the division and
+// bot floors in the division in the last hour are fewer than Division.BotRateLimit
+func CreateBotFloor(tx *gorm.DB, hole *Hole, name, content string) (*Floor, error) {
+	var division Division
+	err := tx.Take(&division, hole.DivisionID).Error
+	if err != nil {
+		return nil, err
+	}
+	if !division.BotEnabled {
+		return nil, utils.NewError(utils.ErrCodeBotDisabled, "该分区未启用机器人")
+	}
+	if division.BotRateLimit > 0 {
+		var count int64
+		err = tx.Model(&Floor{}).Joins("JOIN hole ON hole.id = floor.hole_id").
+			Where("hole.division_id = ? AND floor.type = ? AND floor.created_at >= ?",
+				division.ID, FloorTypeBot, time.Now().Add(-time.Hour)).
+			Count(&count).Error
+		if err != nil {
+			return nil, err
+		}
+		if count >= int64(division.BotRateLimit) {
+			return nil, utils.NewError(utils.ErrCodeBotRateLimited, "机器人回复过于频繁，请稍后再试")
+		}
+	}
+	return createMachineFloor(tx, hole, FloorTypeBot, utils.StripContent(name, 32), content)
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"treehole_next/config"
+	"treehole_next/utils"
+)
+
+// ChallengeExpire is the time for clients to solve a challenge
+const ChallengeExpire = 10 * time.Minute
+
+func challengeCacheKey(token string) string {
+	return "challenge_" + token
+}
+
+// NewChallenge issues a challenge for the user, the error responds 428 with the token.
+// Clients solve a captcha of the token with the auth service, then retry the request with
+// the token and the proof in X-Challenge-Token and X-Challenge-Proof headers, see ChallengeSolved
+func NewChallenge(userID int) error {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return err
+	}
+	token := hex.EncodeToString(buf)
+	err = utils.SetCache(challengeCacheKey(token), userID, ChallengeExpire)
+	if err != nil {
+		return err
+	}
+	e := utils.NewError(utils.ErrCodeChallengeRequired, "操作过于频繁，请完成验证后重试")
+	e.Challenge = token
+	return e
+}
+
+// SignChallenge returns the proof of a solved challenge, signed by the auth service with config.ChallengeSecret
+func SignChallenge(token string) string {
+	return SignWebhookPayload(config.Config.ChallengeSecret, []byte(token))
+}
+
+// ChallengeSolved tells if the request carries a valid proof of a challenge issued to the user.
+// A challenge can be used only once.
+func ChallengeSolved(c *fiber.Ctx, userID int) bool {
+	token, proof := c.Get("X-Challenge-Token"), c.Get("X-Challenge-Proof")
+	if config.Config.ChallengeSecret == "" || token == "" || proof == "" {
+		return false
+	}
+	if !hmac.Equal([]byte(proof), []byte(SignChallenge(token))) {
+		return false
+	}
+	var challengedUserID int
+	if !utils.GetCache(challengeCacheKey(token), &challengedUserID) || challengedUserID != userID {
+		return false
+	}
+	return utils.DeleteCache(challengeCacheKey(token)) == nil
+}
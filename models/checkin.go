@@ -0,0 +1,139 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+
+	"treehole_next/utils"
+)
+
+// check-in markers outlive the day in any time zone
+const checkinMarkerExpire = 48 * time.Hour
+
+// checkinStore dedupes check-ins of a day before touching the database,
+// in redis if configured, otherwise in memory
+type checkinStore interface {
+	// Claim returns true if the user hasn't checked in on the day
+	Claim(ctx context.Context, userID int, day time.Time) (bool, error)
+	// Release undoes Claim if the check-in fails
+	Release(ctx context.Context, userID int, day time.Time) error
+}
+
+var (
+	checkinStoreOnce sync.Once
+	checkinStoreImpl checkinStore
+)
+
+func getCheckinStore() checkinStore {
+	checkinStoreOnce.Do(func() {
+		if client := utils.Redis(); client != nil {
+			checkinStoreImpl = &redisCheckinStore{client: client}
+		} else {
+			checkinStoreImpl = &memoryCheckinStore{claimed: make(map[string]time.Time)}
+		}
+	})
+	return checkinStoreImpl
+}
+
+func checkinKey(userID int, day time.Time) string {
+	return fmt.Sprintf("checkin_%d_%s", userID, day.Format("20060102"))
+}
+
+type redisCheckinStore struct {
+	client redis.UniversalClient
+}
+
+func (s *redisCheckinStore) Claim(ctx context.Context, userID int, day time.Time) (bool, error) {
+	return s.client.SetNX(ctx, utils.CacheKey(checkinKey(userID, day)), 1, checkinMarkerExpire).Result()
+}
+
+func (s *redisCheckinStore) Release(ctx context.Context, userID int, day time.Time) error {
+	return s.client.Del(ctx, utils.CacheKey(checkinKey(userID, day))).Err()
+}
+
+type memoryCheckinStore struct {
+	sync.Mutex
+	// expiration of markers
+	claimed map[string]time.Time
+}
+
+func (s *memoryCheckinStore) Claim(_ context.Context, userID int, day time.Time) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now()
+	for key, expireAt := range s.claimed {
+		if now.After(expireAt) {
+			delete(s.claimed, key)
+		}
+	}
+	key := checkinKey(userID, day)
+	if _, ok := s.claimed[key]; ok {
+		return false, nil
+	}
+	s.claimed[key] = now.Add(checkinMarkerExpire)
+	return true, nil
+}
+
+func (s *memoryCheckinStore) Release(_ context.Context, userID int, day time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.claimed, checkinKey(userID, day))
+	return nil
+}
+
+// UserCheckin checks in the user for the day of now, returns false if checked in already.
+// Check-ins on consecutive days make the streak, the longest streak is kept in UserStats
+func UserCheckin(userID int, now time.Time) (bool, *UserStats, error) {
+	today := StartOfDay(now)
+	store := getCheckinStore()
+	claimed, err := store.Claim(context.Background(), userID, today)
+	if err != nil {
+		return false, nil, err
+	}
+	if !claimed {
+		stats, err := GetUserStats(DB, userID)
+		return false, stats, err
+	}
+
+	var stats UserStats
+	checkedIn := false
+	err = DB.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&UserStats{UserID: userID}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&stats, "user_id = ?", userID).Error
+		if err != nil {
+			return err
+		}
+		// the marker may be lost, e.g. redis restarted
+		if stats.LastCheckinDate != nil && !stats.LastCheckinDate.Before(today) {
+			return nil
+		}
+
+		if stats.LastCheckinDate == nil || stats.LastCheckinDate.Before(today.AddDate(0, 0, -1)) {
+			stats.CheckinStreak = 1
+		} else {
+			stats.CheckinStreak++
+		}
+		if stats.CheckinStreak > stats.LongestCheckinStreak {
+			stats.LongestCheckinStreak = stats.CheckinStreak
+		}
+		stats.LastCheckinDate = &today
+		checkedIn = true
+		return tx.Model(&stats).
+			Select("CheckinStreak", "LongestCheckinStreak", "LastCheckinDate", "UpdatedAt").Updates(&stats).Error
+	})
+	if err != nil {
+		_ = store.Release(context.Background(), userID, today)
+		return false, nil, err
+	}
+	return checkedIn, &stats, nil
+}
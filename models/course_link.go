@@ -0,0 +1,123 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CourseLink links a course of the curriculum-review service to the tag discussing it.
+// Links are pushed by the service with an API key of ScopeCoursesWrite, holes with the tag show a chip to the reviews.
+// The tag may be created after the link, see SyncCourseLinks
+type CourseLink struct {
+	ID         int       `json:"id" gorm:"primaryKey"`
+	CreatedAt  time.Time `json:"time_created"`
+	UpdatedAt  time.Time `json:"time_updated"`
+	TenantID   int       `json:"-" gorm:"not null;default:0;uniqueIndex:idx_course_link_tenant_code,priority:1"`
+	CourseCode string    `json:"course_code" gorm:"size:32;not null;uniqueIndex:idx_course_link_tenant_code,priority:2"`
+	Name       string    `json:"name" gorm:"size:64;not null"`
+	// page of the course reviews
+	URL     string `json:"url" gorm:"size:255;not null"`
+	TagName string `json:"tag_name" gorm:"size:32;not null"`
+	// 0 until the tag exists
+	TagID int `json:"tag_id" gorm:"not null;default:0;index"`
+}
+
+// CourseReview is the chip of a course linked to a tag of the hole
+type CourseReview struct {
+	CourseCode string `json:"course_code"`
+	Name       string `json:"name"`
+	URL        string `json:"url"`
+}
+
+// UpsertCourseLink creates or replaces the link of the course code in the tenant, linking the tag if exists
+func UpsertCourseLink(tx *gorm.DB, link *CourseLink) error {
+	var tags []Tag
+	err := tx.Where("tenant_id = ? AND name = ?", link.TenantID, link.TagName).Limit(1).Find(&tags).Error
+	if err != nil {
+		return err
+	}
+	link.TagID = 0
+	if len(tags) > 0 {
+		link.TagID = tags[0].ID
+	}
+	err = tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "tenant_id"}, {Name: "course_code"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "url", "tag_name", "tag_id", "updated_at"}),
+	}).Create(link).Error
+	if err != nil {
+		return err
+	}
+	return tx.Where("tenant_id = ? AND course_code = ?", link.TenantID, link.CourseCode).Take(link).Error
+}
+
+// SyncCourseLinks follows renamed tags, unlinks deleted ones and links tags created after the links
+func SyncCourseLinks(tx *gorm.DB) error {
+	var links []CourseLink
+	err := tx.Find(&links).Error
+	if err != nil {
+		return err
+	}
+	for _, link := range links {
+		var tags []Tag
+		if link.TagID != 0 {
+			err = tx.Where("id = ?", link.TagID).Limit(1).Find(&tags).Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(tags) == 0 {
+			err = tx.Where("tenant_id = ? AND name = ?", link.TenantID, link.TagName).Limit(1).Find(&tags).Error
+			if err != nil {
+				return err
+			}
+		}
+		tagID, tagName := 0, link.TagName
+		if len(tags) > 0 {
+			tagID, tagName = tags[0].ID, tags[0].Name
+		}
+		if tagID == link.TagID && tagName == link.TagName {
+			continue
+		}
+		err = tx.Model(&link).Updates(map[string]any{"tag_id": tagID, "tag_name": tagName}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadCourseReviews sets courses linked to tags of holes, after holes are loaded from cache
+func (holes Holes) loadCourseReviews() error {
+	tagIDs := make([]int, 0)
+	for _, hole := range holes {
+		hole.CourseReviews = nil
+		for _, tag := range hole.Tags {
+			tagIDs = append(tagIDs, tag.ID)
+		}
+	}
+	if len(tagIDs) == 0 {
+		return nil
+	}
+
+	var links []CourseLink
+	err := DB.Where("tag_id IN ?", tagIDs).Order("course_code").Find(&links).Error
+	if err != nil || len(links) == 0 {
+		return err
+	}
+	for _, hole := range holes {
+		for _, tag := range hole.Tags {
+			for _, link := range links {
+				if link.TagID == tag.ID {
+					hole.CourseReviews = append(hole.CourseReviews, CourseReview{
+						CourseCode: link.CourseCode,
+						Name:       link.Name,
+						URL:        link.URL,
+					})
+				}
+			}
+		}
+	}
+	return nil
+}
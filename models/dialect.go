@@ -0,0 +1,22 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// names of gorm dialectors, see DB_TYPE
+const (
+	DialectMySQL    = "mysql"
+	DialectSQLite   = "sqlite"
+	DialectPostgres = "postgres"
+)
+
+func isMySQL(tx *gorm.DB) bool {
+	return tx.Dialector.Name() == DialectMySQL
+}
+
+// Quote quotes an identifier, e.g. a column named by a reserved word, for the dialect of DB:
+// `like` on MySQL and SQLite, "like" on PostgreSQL. Qualified names are quoted by parts, e.g. floor.like
+func Quote(name string) string {
+	return DB.Statement.Quote(name)
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+// postgresDialector quotes identifiers as PostgreSQL does, and runs queries on SQLite,
+// which accepts both quotes. The driver of PostgreSQL is not a dependency
+type postgresDialector struct {
+	sqlite.Dialector
+}
+
+func (postgresDialector) Name() string {
+	return DialectPostgres
+}
+
+func (postgresDialector) QuoteTo(writer clause.Writer, str string) {
+	for i, part := range strings.Split(str, ".") {
+		if i > 0 {
+			_ = writer.WriteByte('.')
+		}
+		_, _ = writer.WriteString(`"` + part + `"`)
+	}
+}
+
+// sqlRecorder records SQL of queries
+type sqlRecorder struct {
+	logger.Interface
+	statements []string
+}
+
+func (recorder *sqlRecorder) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	recorder.statements = append(recorder.statements, sql)
+}
+
+func TestPostgresQueries(t *testing.T) {
+	recorder := &sqlRecorder{Interface: logger.Discard}
+	db, err := gorm.Open(postgresDialector{sqlite.Dialector{DSN: "file:postgres_dialect?mode=memory"}},
+		&gorm.Config{Logger: recorder, NamingStrategy: gormConfig.NamingStrategy})
+	assert.Nil(t, err)
+	assert.Nil(t, db.AutoMigrate(&Hole{}, &Floor{}, &UserFavorite{}, &UserStats{}))
+	recorder.statements = nil
+	defer func(db *gorm.DB) { DB = db }(DB)
+	DB = db
+
+	assert.Equal(t, `"floor"."like"`, Quote("floor.like"))
+
+	_, err = loadHotHoleStats(time.Now())
+	assert.Nil(t, err)
+	assert.Nil(t, backfillUserStats(db))
+
+	assert.NotEmpty(t, recorder.statements)
+	for _, sql := range recorder.statements {
+		assert.NotContains(t, sql, "`")
+	}
+	assert.Contains(t, strings.Join(recorder.statements, "\n"), `SUM("like")`)
+	assert.Contains(t, strings.Join(recorder.statements, "\n"), `SUM("floor"."like")`)
+}
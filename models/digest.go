@@ -0,0 +1,149 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm/clause"
+
+	"treehole_next/utils"
+)
+
+// DefaultDigestHour is the hour of day to send digests if the user has not chosen one
+const DefaultDigestHour = 8
+
+// digests are sent at most once in the interval, the task may run several times in the chosen hour
+const digestMinInterval = 20 * time.Hour
+
+// visits are recorded at most once in the interval for each user
+const visitRecordInterval = 10 * time.Minute
+
+// digestMaxHoles limits holes listed in the data of a digest, the description counts all of them
+const digestMaxHoles = 20
+
+// UserVisit is when the user used the treehole last time, digests summarize floors since then
+type UserVisit struct {
+	UserID    int       `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	VisitedAt time.Time `json:"visited_at" gorm:"not null"`
+}
+
+// DigestHole is new floors of a hole in a digest
+type DigestHole struct {
+	HoleID int `json:"hole_id"`
+	Count  int `json:"count"`
+}
+
+func userVisitCacheKey(userID int) string {
+	return fmt.Sprintf("user_visit_%d", userID)
+}
+
+// MiddlewareRecordVisit records visits of users for digests, see UserVisit
+func MiddlewareRecordVisit(c *fiber.Ctx) error {
+	if GetAPIKey(c) != nil {
+		return c.Next()
+	}
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return c.Next()
+	}
+
+	var recorded bool
+	if !utils.GetCache(userVisitCacheKey(userID), &recorded) {
+		err = RequestDB(c).Clauses(clause.OnConflict{UpdateAll: true}).
+			Create(&UserVisit{UserID: userID, VisitedAt: time.Now()}).Error
+		if err != nil {
+			log.Err(err).Str("model", "UserVisit").Msg("record visit failed")
+		} else {
+			_ = utils.SetCache(userVisitCacheKey(userID), true, visitRecordInterval)
+		}
+	}
+	return c.Next()
+}
+
+// digest summarizes new floors by others in favorite and subscribed holes since the last visit or digest,
+// nil if there is nothing new. Hidden holes, holes muted by the user and holes in muted divisions are skipped,
+// see HoleMute and UserDivisionSetting
+func (setting *NotificationSetting) digest(now time.Time) (*Notification, error) {
+	userID := setting.UserID
+	since := now.Add(-24 * time.Hour)
+	if setting.DigestSentAt != nil {
+		since = *setting.DigestSentAt
+	}
+	var visit UserVisit
+	err := DB.Where("user_id = ?", userID).Limit(1).Find(&visit).Error
+	if err != nil {
+		return nil, err
+	}
+	if visit.VisitedAt.After(since) {
+		since = visit.VisitedAt
+	}
+
+	querySet, err := whereNotMutedDivisions(DB.Model(&Floor{}), userID)
+	if err != nil {
+		return nil, err
+	}
+	holes := make([]DigestHole, 0)
+	err = querySet.Select("floor.hole_id, COUNT(*) AS count").
+		Joins("JOIN hole ON hole.id = floor.hole_id AND hole.hidden = ? AND hole.deleted_at IS NULL", false).
+		Where("floor.hole_id IN (?) OR floor.hole_id IN (?)",
+			DB.Model(&UserFavorite{}).Select("hole_id").Where("user_id = ?", userID),
+			DB.Model(&UserSubscription{}).Select("hole_id").Where("user_id = ?", userID)).
+		Where("floor.hole_id NOT IN (?)", DB.Model(&HoleMute{}).Select("hole_id").Where("user_id = ?", userID)).
+		Where("floor.created_at > ? AND floor.user_id <> ? AND floor.deleted = ?", since, userID, false).
+		Group("floor.hole_id").Order("count DESC, floor.hole_id").Scan(&holes).Error
+	if err != nil || len(holes) == 0 {
+		return nil, err
+	}
+
+	total := 0
+	for _, hole := range holes {
+		total += hole.Count
+	}
+	description := fmt.Sprintf("您收藏和关注的 %d 个洞有 %d 条新回复", len(holes), total)
+	if len(holes) > digestMaxHoles {
+		holes = holes[:digestMaxHoles]
+	}
+	return &Notification{
+		Data:        Map{"holes": holes, "since": since},
+		Recipients:  []int{userID},
+		Description: description,
+		Title:       "您关注的内容有新动态",
+		Type:        MessageTypeDigest,
+		URL:         "/api/user/favorites",
+	}, nil
+}
+
+// FlushDigests sends digests of users who opted in and chose the hour of now, see NotificationSetting.Digest
+func FlushDigests(now time.Time) error {
+	var settings []NotificationSetting
+	err := DB.Where("digest = ? AND digest_hour = ? AND (digest_sent_at IS NULL OR digest_sent_at < ?)",
+		true, now.Hour(), now.Add(-digestMinInterval)).Find(&settings).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range settings {
+		setting := &settings[i]
+		notification, err := setting.digest(now)
+		if err != nil {
+			log.Err(err).Str("model", "Digest").Int("user_id", setting.UserID).Msg("generate digest failed")
+			continue
+		}
+		err = DB.Model(&NotificationSetting{}).Where("user_id = ?", setting.UserID).
+			Update("digest_sent_at", now).Error
+		if err != nil {
+			return err
+		}
+		if notification == nil {
+			continue
+		}
+		_, err = notification.Send()
+		if err != nil {
+			log.Err(err).Str("model", "Digest").Msg("send digest failed")
+		}
+	}
+	return nil
+}
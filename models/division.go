@@ -1,11 +1,14 @@
 package models
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"treehole_next/utils"
 
 	"github.com/gofiber/fiber/v2"
+	"golang.org/x/exp/slices"
 	"gorm.io/gorm"
 )
 
@@ -15,11 +18,47 @@ type Division struct {
 	CreatedAt time.Time `json:"time_created" gorm:"not null"`
 	UpdatedAt time.Time `json:"time_updated" gorm:"not null"`
 
+	// names are unique in a tenant, see Tenant
+	TenantID int `json:"tenant_id" gorm:"not null;default:0;uniqueIndex:idx_division_tenant_name,priority:1"`
+
 	/// base info
-	Name        string `json:"name" gorm:"unique;size:10"`
+	Name        string `json:"name" gorm:"size:10;uniqueIndex:idx_division_tenant_name,priority:2"`
 	Description string `json:"description" gorm:"size:64"`
 	Hidden      bool   `json:"hidden" gorm:"not null;default:false"`
 
+	// active, archived or hidden, see DivisionStatusActive
+	Status string `json:"status" gorm:"size:16;not null;default:active"`
+
+	// 实名分区，楼层展示发帖人认证昵称而非匿名名
+	RealName bool `json:"real_name" gorm:"not null;default:false"`
+
+	// who can see holes in the division: public, login or restricted, see DivisionVisibilityPublic
+	Visibility string `json:"visibility" gorm:"size:16;not null;default:public"`
+
+	// members of the group in auth service can see a restricted division
+	Group string `json:"group" gorm:"column:access_group;size:64;not null;default:''"`
+
+	// tags of a new hole, the number of distinct tags should be in [MinTags, MaxTags] and include RequiredTags
+	MinTags      int      `json:"min_tags" gorm:"not null;default:1"`
+	MaxTags      int      `json:"max_tags" gorm:"not null;default:10"`
+	RequiredTags []string `json:"required_tags" gorm:"serializer:json;not null;default:\"[]\""`
+
+	// new tags of holes are pending until approved by moderators, see Tag.Pending
+	TagReview bool `json:"tag_review" gorm:"not null;default:false"`
+
+	// bots are notified of new holes matching BotRule and may reply, see CreateBotFloor
+	BotEnabled bool `json:"bot_enabled" gorm:"not null;default:false"`
+	// max bot floors in the division an hour, 0 for unlimited
+	BotRateLimit int `json:"bot_rate_limit" gorm:"not null;default:10"`
+
+	// holes are not recommended or notified in digests unless users unmute the division, see UserDivisionSetting
+	MutedByDefault bool `json:"muted_by_default" gorm:"not null;default:false"`
+
+	// authors can edit content of floors within EditWindow minutes after posting and at most MaxEdits times,
+	// 0 for unlimited, moderators are exempt, see Division.CheckFloorEdit
+	EditWindow int `json:"edit_window" gorm:"not null;default:0"`
+	MaxEdits   int `json:"max_edits" gorm:"not null;default:0"`
+
 	// pinned holes in given order
 	Pinned []int `json:"-" gorm:"serializer:json;size:100;not null;default:\"[]\""`
 
@@ -36,6 +75,29 @@ func (division *Division) GetID() int {
 	return division.ID
 }
 
+// lifecycle of a division: active -> archived -> hidden, and back step by step
+const (
+	// holes and floors can be created
+	DivisionStatusActive = "active"
+	// no new holes or floors, holes can still be read, listed and searched
+	DivisionStatusArchived = "archived"
+	// archived and not listed, Division.Hidden is true
+	DivisionStatusHidden = "hidden"
+)
+
+// CanTransitTo tells if the division can change to status in one step
+func (division *Division) CanTransitTo(status string) bool {
+	switch division.Status {
+	case DivisionStatusActive:
+		return status == DivisionStatusArchived
+	case DivisionStatusArchived:
+		return status == DivisionStatusActive || status == DivisionStatusHidden
+	case DivisionStatusHidden:
+		return status == DivisionStatusArchived
+	}
+	return false
+}
+
 type Divisions []*Division
 
 func (divisions Divisions) Preprocess(c *fiber.Ctx) error {
@@ -45,7 +107,12 @@ func (divisions Divisions) Preprocess(c *fiber.Ctx) error {
 			return err
 		}
 	}
-	return utils.SetCache("divisions", divisions, 0)
+	return utils.SetLocalCache(DivisionsCacheKey(GetTenant(c).ID), divisions, 0)
+}
+
+// DivisionsCacheKey is the cache of divisions listed in a tenant
+func DivisionsCacheKey(tenantID int) string {
+	return TenantCacheKey(tenantID, "divisions")
 }
 
 func (division *Division) Preprocess(c *fiber.Ctx) error {
@@ -54,7 +121,7 @@ func (division *Division) Preprocess(c *fiber.Ctx) error {
 	if len(pinned) == 0 {
 		return nil
 	}
-	DB.Find(&division.Holes, pinned)
+	RequestDB(c).Find(&division.Holes, pinned)
 	if len(division.Holes) == 0 {
 		return nil
 	}
@@ -74,3 +141,91 @@ func (division *Division) AfterCreate(_ *gorm.DB) (err error) {
 	division.DivisionID = division.ID
 	return nil
 }
+
+// ValidateTags checks tags of a new hole in the division
+func (division *Division) ValidateTags(tagNames []string) error {
+	tags := make([]string, 0, len(tagNames))
+	for _, name := range tagNames {
+		name = strings.TrimSpace(name)
+		if !slices.ContainsFunc(tags, func(tag string) bool { return strings.EqualFold(tag, name) }) {
+			tags = append(tags, name)
+		}
+	}
+
+	if len(tags) < division.MinTags {
+		return utils.NewError(utils.ErrCodeTooFewTags, fmt.Sprintf("该分区至少需要 %d 个标签", division.MinTags))
+	}
+	if division.MaxTags > 0 && len(tags) > division.MaxTags {
+		return utils.NewError(utils.ErrCodeTooManyTags, fmt.Sprintf("该分区最多只能有 %d 个标签", division.MaxTags))
+	}
+	missing := make([]string, 0)
+	for _, required := range division.RequiredTags {
+		if !slices.ContainsFunc(tags, func(tag string) bool { return strings.EqualFold(tag, required) }) {
+			missing = append(missing, required)
+		}
+	}
+	if len(missing) > 0 {
+		return utils.NewError(utils.ErrCodeRequiredTagsMissing, fmt.Sprintf("该分区的洞必须包含标签：%s", strings.Join(missing, ", ")))
+	}
+	return nil
+}
+
+// CheckFloorEdit returns ErrCodeEditWindowExpired or ErrCodeEditLimitExceeded if the author can't edit content of
+// the floor any more, see EditWindow and MaxEdits
+func (division *Division) CheckFloorEdit(floor *Floor, now time.Time) error {
+	if division.EditWindow > 0 && now.Sub(floor.CreatedAt) > time.Duration(division.EditWindow)*time.Minute {
+		return utils.NewError(utils.ErrCodeEditWindowExpired, fmt.Sprintf("该分区的楼层只能在发布后 %d 分钟内修改", division.EditWindow))
+	}
+	if division.MaxEdits > 0 && floor.Modified >= division.MaxEdits {
+		return utils.NewError(utils.ErrCodeEditLimitExceeded, fmt.Sprintf("该分区的楼层最多只能修改 %d 次", division.MaxEdits))
+	}
+	return nil
+}
+
+const realNameDivisionsCacheKey = "real_name_divisions"
+
+// RealNameDivisionIDs returns ids of divisions in real-name mode, cached until divisions are modified
+func RealNameDivisionIDs() (divisionIDs []int, err error) {
+	if utils.GetLocalCache(realNameDivisionsCacheKey, &divisionIDs) {
+		return divisionIDs, nil
+	}
+	err = DB.Model(&Division{}).Where("real_name = ?", true).Pluck("id", &divisionIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	return divisionIDs, utils.SetLocalCache(realNameDivisionsCacheKey, divisionIDs, 0)
+}
+
+func DeleteRealNameDivisionsCache() error {
+	return utils.DeleteLocalCache(realNameDivisionsCacheKey)
+}
+
+const archivedDivisionsCacheKey = "archived_divisions"
+
+// ArchivedDivisionIDs returns ids of divisions not active, cached until divisions are modified
+func ArchivedDivisionIDs() (divisionIDs []int, err error) {
+	if utils.GetLocalCache(archivedDivisionsCacheKey, &divisionIDs) {
+		return divisionIDs, nil
+	}
+	err = DB.Model(&Division{}).Where("status <> ?", DivisionStatusActive).Pluck("id", &divisionIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	return divisionIDs, utils.SetLocalCache(archivedDivisionsCacheKey, divisionIDs, 0)
+}
+
+func DeleteArchivedDivisionsCache() error {
+	return utils.DeleteLocalCache(archivedDivisionsCacheKey)
+}
+
+// CheckDivisionArchived returns ErrCodeDivisionArchived if no new floors can be posted in the division
+func CheckDivisionArchived(divisionID int) error {
+	divisionIDs, err := ArchivedDivisionIDs()
+	if err != nil {
+		return err
+	}
+	if slices.Contains(divisionIDs, divisionID) {
+		return utils.NewError(utils.ErrCodeDivisionArchived, "该分区已归档，无法发帖")
+	}
+	return nil
+}
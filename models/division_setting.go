@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UserDivisionSetting overrides Division.MutedByDefault for a user. Holes in muted divisions are not
+// recommended and not included in digests or saved search alerts, but can still be browsed
+type UserDivisionSetting struct {
+	UserID     int       `json:"-" gorm:"primaryKey;autoIncrement:false"`
+	DivisionID int       `json:"division_id" gorm:"primaryKey;autoIncrement:false"`
+	Muted      bool      `json:"muted" gorm:"not null"`
+	UpdatedAt  time.Time `json:"time_updated"`
+}
+
+func (UserDivisionSetting) TableName() string {
+	return "user_division_settings"
+}
+
+// SetDivisionMuted saves the choice of the user, which is kept even if it equals the default of the division
+func SetDivisionMuted(tx *gorm.DB, userID, divisionID int, muted bool) error {
+	return tx.Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&UserDivisionSetting{UserID: userID, DivisionID: divisionID, Muted: muted}).Error
+}
+
+// MutedDivisionIDs returns divisions muted by the user, or muted by default and not unmuted by the user
+func MutedDivisionIDs(tx *gorm.DB, userID int) ([]int, error) {
+	var settings []UserDivisionSetting
+	err := tx.Where("user_id = ?", userID).Find(&settings).Error
+	if err != nil {
+		return nil, err
+	}
+	var mutedByDefault []int
+	err = tx.Model(&Division{}).Where("muted_by_default = ?", true).Pluck("id", &mutedByDefault).Error
+	if err != nil {
+		return nil, err
+	}
+
+	muted := make(map[int]bool, len(mutedByDefault)+len(settings))
+	for _, divisionID := range mutedByDefault {
+		muted[divisionID] = true
+	}
+	for _, setting := range settings {
+		muted[setting.DivisionID] = setting.Muted
+	}
+	divisionIDs := make([]int, 0, len(muted))
+	for divisionID, isMuted := range muted {
+		if isMuted {
+			divisionIDs = append(divisionIDs, divisionID)
+		}
+	}
+	return divisionIDs, nil
+}
+
+// whereNotMutedDivisions excludes holes in divisions muted by the user, the query should join or select from hole
+func whereNotMutedDivisions(tx *gorm.DB, userID int) (*gorm.DB, error) {
+	divisionIDs, err := MutedDivisionIDs(DB, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(divisionIDs) == 0 {
+		return tx, nil
+	}
+	return tx.Where("hole.division_id NOT IN ?", divisionIDs), nil
+}
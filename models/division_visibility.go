@@ -0,0 +1,144 @@
+package models
+
+import (
+	"sort"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+
+	"treehole_next/utils"
+)
+
+const (
+	// anyone can see, including feeds, sitemap and hole metadata
+	DivisionVisibilityPublic = "public"
+	// logged-in users can see
+	DivisionVisibilityLogin = "login"
+	// members of Division.Group and admins can see
+	DivisionVisibilityRestricted = "restricted"
+)
+
+// divisionAccess is the visibility of a non-public division
+type divisionAccess struct {
+	Visibility string `json:"visibility"`
+	Group      string `json:"group"`
+}
+
+const divisionAccessCacheKey = "division_access"
+
+// loadDivisionAccess returns access of non-public divisions by id, cached until divisions are modified
+func loadDivisionAccess() (access map[int]divisionAccess, err error) {
+	if utils.GetLocalCache(divisionAccessCacheKey, &access) {
+		return access, nil
+	}
+	var divisions []Division
+	err = DB.Select("id", "visibility", "access_group").
+		Where("visibility <> ?", DivisionVisibilityPublic).Find(&divisions).Error
+	if err != nil {
+		return nil, err
+	}
+	access = make(map[int]divisionAccess, len(divisions))
+	for _, division := range divisions {
+		access[division.ID] = divisionAccess{Visibility: division.Visibility, Group: division.Group}
+	}
+	return access, utils.SetLocalCache(divisionAccessCacheKey, access, 0)
+}
+
+func DeleteDivisionAccessCache() error {
+	return utils.DeleteLocalCache(divisionAccessCacheKey)
+}
+
+// InvisibleDivisionIDs returns ids of divisions whose holes user cannot see, user is nil without login.
+// Membership of restricted divisions is checked against the auth service, users are not members if it fails.
+func InvisibleDivisionIDs(user *User) ([]int, error) {
+	if user != nil && user.IsAdmin {
+		return nil, nil
+	}
+	access, err := loadDivisionAccess()
+	if err != nil {
+		return nil, err
+	}
+
+	var divisionIDs []int
+	var groups []string
+	groupsLoaded := false
+	for divisionID, division := range access {
+		if user != nil && division.Visibility == DivisionVisibilityLogin {
+			continue
+		}
+		if user != nil && division.Visibility == DivisionVisibilityRestricted {
+			if !groupsLoaded {
+				groups, err = GetUserGroups(user.ID)
+				if err != nil {
+					log.Err(err).Int("user_id", user.ID).Msg("load user groups failed")
+				}
+				groupsLoaded = true
+			}
+			if division.Group != "" && slices.Contains(groups, division.Group) {
+				continue
+			}
+		}
+		divisionIDs = append(divisionIDs, divisionID)
+	}
+	sort.Ints(divisionIDs)
+	return divisionIDs, nil
+}
+
+// WhereVisibleDivisions excludes holes in divisions user cannot see, see InvisibleDivisionIDs
+func WhereVisibleDivisions(tx *gorm.DB, user *User) (*gorm.DB, error) {
+	divisionIDs, err := InvisibleDivisionIDs(user)
+	if err != nil {
+		return nil, err
+	}
+	if len(divisionIDs) == 0 {
+		return tx, nil
+	}
+	return tx.Where("hole.division_id NOT IN ?", divisionIDs), nil
+}
+
+// RemoveInvisible removes holes in divisions user cannot see
+func (holes Holes) RemoveInvisible(user *User) (Holes, error) {
+	divisionIDs, err := InvisibleDivisionIDs(user)
+	if err != nil {
+		return nil, err
+	}
+	if len(divisionIDs) == 0 {
+		return holes, nil
+	}
+	return holes.RemoveIf(func(hole *Hole) bool {
+		return slices.Contains(divisionIDs, hole.DivisionID)
+	}), nil
+}
+
+// RemoveInvisible removes floors of holes in divisions user cannot see
+func (floors Floors) RemoveInvisible(user *User) (Floors, error) {
+	divisionIDs, err := InvisibleDivisionIDs(user)
+	if err != nil {
+		return nil, err
+	}
+	if len(divisionIDs) == 0 || len(floors) == 0 {
+		return floors, nil
+	}
+
+	holeIDs := make([]int, 0, len(floors))
+	for _, floor := range floors {
+		holeIDs = append(holeIDs, floor.HoleID)
+	}
+	var invisibleHoleIDs []int
+	err = DB.Model(&Hole{}).Where("id IN ? AND division_id IN ?", holeIDs, divisionIDs).
+		Pluck("id", &invisibleHoleIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(invisibleHoleIDs) == 0 {
+		return floors, nil
+	}
+	visible := make(Floors, 0, len(floors))
+	for _, floor := range floors {
+		if !slices.Contains(invisibleHoleIDs, floor.HoleID) {
+			visible = append(visible, floor)
+		}
+	}
+	return visible, nil
+}
@@ -9,7 +9,9 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/healthstatus"
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/refresh"
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
 	"github.com/opentreehole/go-common"
@@ -26,6 +28,21 @@ var ES *elasticsearch.TypedClient
 
 const IndexName = "floors"
 
+// esBreaker skips indexing and falls back to SearchOld while elasticsearch is down
+var esBreaker = utils.NewBreaker("elasticsearch")
+
+// PingES returns an error if elasticsearch is unreachable or its cluster status is red
+func PingES(ctx context.Context) error {
+	res, err := ES.Cluster.Health().Do(ctx)
+	if err != nil {
+		return err
+	}
+	if res.Status == healthstatus.Red {
+		return fmt.Errorf("cluster status %s", res.Status)
+	}
+	return nil
+}
+
 func Init() {
 	if config.Config.Mode == "test" || config.Config.Mode == "bench" || config.Config.ElasticsearchUrl == "" {
 		return
@@ -54,6 +71,11 @@ func Init() {
 	log.Info().Msgf("elasticsearch Server: %s\n", info.Version.Int)
 	log.Info().Msgf("elasticsearch Server Minimum Index Compatibility Version: %s\n", info.Version.MinimumIndexCompatibilityVersion)
 	log.Info().Msgf("elasticsearch Server Minimum Wire Compatibility Version: %s\n", info.Version.MinimumWireCompatibilityVersion)
+
+	err = EnsureFloorIndex(context.Background())
+	if err != nil {
+		log.Fatal().Err(err).Msg("error creating elasticsearch index")
+	}
 }
 
 type FloorModel struct {
@@ -62,24 +84,8 @@ type FloorModel struct {
 	Content   string    `json:"content"`
 }
 
-// Search searches floors by keyword.
-//
-// Parameters:
-// - c: Fiber context
-// - keyword: The keyword to search for
-// - size: The number of results to return
-// - offset: The starting point of the results
-// - accurate: Whether to use accurate search
-// - startTime and endTime: Filter floors by time (If not specified, set to nil)
-//
-// Returns:
-// - Floors: A list of floors matching the search criteria
-// - error: An error if the search fails
-func Search(c *fiber.Ctx, keyword string, size, offset int, accurate bool, startTime *int64, endTime *int64) (Floors, error) {
-	if ES == nil {
-		return SearchOld(c, keyword, size, offset, startTime, endTime)
-	}
-
+// floorSearchQuery is the query of Search, see Search for the parameters
+func floorSearchQuery(keyword string, accurate, fuzzy bool, startTime *int64, endTime *int64) types.Query {
 	// our query design:
 	// {
 	// 	"query": {
@@ -104,17 +110,20 @@ func Search(c *fiber.Ctx, keyword string, size, offset int, accurate bool, start
 	var filterQueries []types.Query
 	var disMaxQueries []types.Query
 
-	if accurate {
-		disMaxQueries = []types.Query{
-			{MatchPhrase: map[string]types.MatchPhraseQuery{"content": {Query: keyword}}},
-			{MatchPhrase: map[string]types.MatchPhraseQuery{"content.ik_smart": {Query: keyword}}},
-		}
-	} else {
-		disMaxQueries = []types.Query{
-			{Match: map[string]types.MatchQuery{"content": {Query: keyword}}},
-			{Match: map[string]types.MatchQuery{"content.ik_smart": {Query: keyword}}},
+	for _, field := range floorContentFields() {
+		if accurate {
+			disMaxQueries = append(disMaxQueries, types.Query{MatchPhrase: map[string]types.MatchPhraseQuery{field: {Query: keyword}}})
+		} else {
+			match := types.MatchQuery{Query: keyword}
+			if fuzzy {
+				match.Fuzziness = "AUTO"
+			}
+			disMaxQueries = append(disMaxQueries, types.Query{Match: map[string]types.MatchQuery{field: match}})
 		}
 	}
+	if fuzzy && !accurate && config.Config.ElasticsearchPinyin {
+		disMaxQueries = append(disMaxQueries, types.Query{Match: map[string]types.MatchQuery{"content.pinyin": {Query: keyword}}})
+	}
 
 	if startTime != nil || endTime != nil {
 		dateRangeQuery := types.DateRangeQuery{}
@@ -134,7 +143,7 @@ func Search(c *fiber.Ctx, keyword string, size, offset int, accurate bool, start
 		filterQueries = append(filterQueries, timeRangeQuery)
 	}
 
-	query := types.Query{
+	return types.Query{
 		Bool: &types.BoolQuery{
 			Must: []types.Query{
 				{
@@ -146,22 +155,52 @@ func Search(c *fiber.Ctx, keyword string, size, offset int, accurate bool, start
 			Filter: filterQueries,
 		},
 	}
+}
 
-	res, err := ES.Search().
-		Index(IndexName).From(offset).
-		Size(size).Query(&query).
-		Sort(
-			types.SortOptions{
-				SortOptions: map[string]types.FieldSort{
-					"_score": {Order: &sortorder.Desc},
-				},
-			},
-			types.SortOptions{
-				SortOptions: map[string]types.FieldSort{
-					"updated_at": {Order: &sortorder.Desc},
+// Search searches floors by keyword.
+//
+// Parameters:
+// - c: Fiber context
+// - keyword: The keyword to search for
+// - size: The number of results to return
+// - offset: The starting point of the results
+// - accurate: Whether to use accurate search
+// - fuzzy: Whether to tolerate typos and match by pinyin, ignored if accurate
+// - startTime and endTime: Filter floors by time (If not specified, set to nil)
+//
+// Returns:
+// - Floors: A list of floors matching the search criteria
+// - error: An error if the search fails
+func Search(c *fiber.Ctx, keyword string, size, offset int, accurate, fuzzy bool, startTime *int64, endTime *int64) (Floors, error) {
+	if ES == nil {
+		return SearchOld(c, keyword, size, offset, startTime, endTime)
+	}
+
+	query := floorSearchQuery(keyword, accurate, fuzzy, startTime, endTime)
+
+	var res *search.Response
+	var err error
+	breakerErr := esBreaker.Do(func() error {
+		res, err = ES.Search().
+			Index(IndexName).From(offset).
+			Size(size).Query(&query).
+			Sort(
+				types.SortOptions{
+					SortOptions: map[string]types.FieldSort{
+						"_score": {Order: &sortorder.Desc},
+					},
 				},
-			}).
-		Do(context.Background())
+				types.SortOptions{
+					SortOptions: map[string]types.FieldSort{
+						"updated_at": {Order: &sortorder.Desc},
+					},
+				}).
+			Do(context.Background())
+		return esFailure(err)
+	})
+	if errors.Is(breakerErr, utils.ErrBreakerOpen) {
+		return SearchOld(c, keyword, size, offset, startTime, endTime)
+	}
 
 	if err != nil {
 		var errorMsg = fmt.Sprintf("error searching floors: %e", err)
@@ -201,9 +240,31 @@ func Search(c *fiber.Ctx, keyword string, size, offset int, accurate bool, start
 		return nil, err
 	}
 
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return nil, err
+	}
+	floors, err = floors.RemoveInvisible(user)
+	if err != nil {
+		return nil, err
+	}
+	floors, err = floors.InTenant(GetTenant(c).ID)
+	if err != nil {
+		return nil, err
+	}
+
 	return utils.OrderInGivenOrder(floors, floorIDs), nil
 }
 
+// esFailure returns err unless elasticsearch rejected a bad request, which does not count towards esBreaker
+func esFailure(err error) error {
+	var elasticsearchError *types.ElasticsearchError
+	if errors.As(err, &elasticsearchError) && elasticsearchError.Status < 500 {
+		return nil
+	}
+	return err
+}
+
 // SearchOld searches floors by keyword by Database.
 // It is used when ElasticSearch is not available. (Not recommended)
 func SearchOld(c *fiber.Ctx, keyword string, size, offset int, startTimeUnix *int64, endTimeUnix *int64) (Floors, error) {
@@ -222,9 +283,19 @@ func SearchOld(c *fiber.Ctx, keyword string, size, offset int, startTimeUnix *in
 		return nil, err
 	}
 
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return nil, err
+	}
+	visibleHoles, err := WhereVisibleDivisions(RequestDB(c).Table("hole").Select("id").
+		Where("hidden = false AND tenant_id = ?", GetTenant(c).ID), user)
+	if err != nil {
+		return nil, err
+	}
+
 	result := querySet.
 		Where("content like ?", "%"+keyword+"%").
-		Where("hole_id in (?)", DB.Table("hole").Select("id").Where("hidden = false")).
+		Where("hole_id in (?)", visibleHoles).
 		Order("id desc").Find(&floors)
 	return floors, result.Error
 }
@@ -261,7 +332,10 @@ func BulkInsert(floors []FloorModel) {
 	}
 	log.Info().Ints("floor_ids", floorIDs).Msg("Preparing insert floors")
 
-	_, err := ES.Bulk().Index(IndexName).Raw(BulkBuffer).Do(context.Background())
+	err := esBreaker.Do(func() error {
+		_, err := ES.Bulk().Index(IndexName).Raw(BulkBuffer).Do(context.Background())
+		return err
+	})
 	if err != nil {
 		log.Printf("error indexing floors %v: %s", floorIDs, err)
 		return
@@ -286,10 +360,13 @@ func BulkDelete(floorIDs []int) {
 	}
 	log.Info().Ints("floor_ids", floorIDs).Msg("Preparing delete floors")
 
-	_, err := ES.Bulk().
-		Index(IndexName).
-		Raw(BulkBuffer).
-		Do(context.Background())
+	err := esBreaker.Do(func() error {
+		_, err := ES.Bulk().
+			Index(IndexName).
+			Raw(BulkBuffer).
+			Do(context.Background())
+		return err
+	})
 	if err != nil {
 		log.Printf("error deleting floors %v: %s", floorIDs, err)
 		return
@@ -304,12 +381,15 @@ func FloorIndex(floorModel FloorModel) {
 		return
 	}
 
-	_, err := ES.
-		Index(IndexName).
-		Id(strconv.Itoa(floorModel.ID)).
-		Document(&floorModel).
-		Refresh(refresh.Refresh{Name: "false"}).
-		Do(context.Background())
+	err := esBreaker.Do(func() error {
+		_, err := ES.
+			Index(IndexName).
+			Id(strconv.Itoa(floorModel.ID)).
+			Document(&floorModel).
+			Refresh(refresh.Refresh{Name: "false"}).
+			Do(context.Background())
+		return err
+	})
 
 	if err != nil {
 		log.Err(err).
@@ -324,9 +404,12 @@ func FloorDelete(floorID int) {
 	if ES == nil {
 		return
 	}
-	_, err := ES.Delete(
-		IndexName,
-		strconv.Itoa(floorID)).Do(context.Background())
+	err := esBreaker.Do(func() error {
+		_, err := ES.Delete(
+			IndexName,
+			strconv.Itoa(floorID)).Do(context.Background())
+		return err
+	})
 
 	if err != nil {
 		log.Err(err).
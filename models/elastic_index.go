@@ -0,0 +1,211 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/conflicts"
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog/log"
+
+	"treehole_next/config"
+	"treehole_next/utils"
+)
+
+const (
+	AnalyzerIK       = "ik"
+	AnalyzerSmartCN  = "smartcn"
+	AnalyzerStandard = "standard"
+)
+
+// synonyms are applied at search time only, so that they can be updated without reindexing
+const searchAnalyzerName = "floor_search"
+
+// pinyinAnalyzerName analyzes content.pinyin, see ELASTICSEARCH_PINYIN
+const pinyinAnalyzerName = "floor_pinyin"
+
+// floorAnalyzers maps ELASTICSEARCH_ANALYZER to the index analyzer and the tokenizer of the search analyzer
+var floorAnalyzers = map[string]struct {
+	Index     string
+	Tokenizer string
+}{
+	AnalyzerIK:       {Index: "ik_max_word", Tokenizer: "ik_smart"},
+	AnalyzerSmartCN:  {Index: "smartcn", Tokenizer: "smartcn_tokenizer"},
+	AnalyzerStandard: {Index: "standard", Tokenizer: "standard"},
+}
+
+// floorContentFields are fields searched by Search, content.ik_smart exists in ik indexes only
+func floorContentFields() []string {
+	if config.Config.ElasticsearchAnalyzer == AnalyzerIK {
+		return []string{"content", "content.ik_smart"}
+	}
+	return []string{"content"}
+}
+
+// floorIndexBody is settings and mappings to create the floors index
+func floorIndexBody() (Map, error) {
+	analyzer, ok := floorAnalyzers[config.Config.ElasticsearchAnalyzer]
+	if !ok {
+		return nil, fmt.Errorf("unknown elasticsearch analyzer %s", config.Config.ElasticsearchAnalyzer)
+	}
+
+	synonym := Map{"type": "synonym_graph", "updateable": true}
+	if config.Config.ElasticsearchSynonymsPath != "" {
+		synonym["synonyms_path"] = config.Config.ElasticsearchSynonymsPath
+	} else {
+		synonym["synonyms_set"] = IndexName
+	}
+
+	content := Map{"type": "text", "analyzer": analyzer.Index, "search_analyzer": searchAnalyzerName}
+	fields := Map{}
+	if config.Config.ElasticsearchAnalyzer == AnalyzerIK {
+		fields["ik_smart"] = Map{"type": "text", "analyzer": "ik_smart", "search_analyzer": searchAnalyzerName}
+	}
+	analyzers := Map{searchAnalyzerName: Map{
+		"type":      "custom",
+		"tokenizer": analyzer.Tokenizer,
+		"filter":    []string{"lowercase", "floor_synonym"},
+	}}
+	tokenizers := Map{}
+	if config.Config.ElasticsearchPinyin {
+		// full pinyin of each character and of the whole text, so that "tuoxie" and "托鞋" match "拖鞋"
+		tokenizers[pinyinAnalyzerName] = Map{
+			"type":                       "pinyin",
+			"keep_first_letter":          false,
+			"keep_separate_first_letter": false,
+			"keep_full_pinyin":           true,
+			"keep_joined_full_pinyin":    true,
+			"keep_original":              false,
+			"lowercase":                  true,
+			"remove_duplicated_term":     true,
+		}
+		analyzers[pinyinAnalyzerName] = Map{"type": "custom", "tokenizer": pinyinAnalyzerName}
+		fields["pinyin"] = Map{"type": "text", "analyzer": pinyinAnalyzerName}
+	}
+	if len(fields) > 0 {
+		content["fields"] = fields
+	}
+
+	return Map{
+		"settings": Map{
+			"index": Map{
+				"number_of_shards":   config.Config.ElasticsearchShards,
+				"number_of_replicas": config.Config.ElasticsearchReplicas,
+			},
+			"analysis": Map{
+				"filter":    Map{"floor_synonym": synonym},
+				"tokenizer": tokenizers,
+				"analyzer":  analyzers,
+			},
+		},
+		"mappings": Map{
+			"properties": Map{
+				"id":         Map{"type": "integer"},
+				"updated_at": Map{"type": "date"},
+				"content":    content,
+			},
+		},
+	}, nil
+}
+
+// EnsureFloorIndex creates the floors index if missing. Existing indexes are not changed,
+// delete and reindex to apply new settings
+func EnsureFloorIndex(ctx context.Context) error {
+	exists, err := ES.Indices.Exists(IndexName).Do(ctx)
+	if err != nil || exists {
+		return err
+	}
+
+	body, err := floorIndexBody()
+	if err != nil {
+		return err
+	}
+	if config.Config.ElasticsearchSynonymsPath == "" {
+		// the synonyms set must exist before the index refers to it, keep rules of a deleted index
+		found, err := ES.Synonyms.GetSynonym(IndexName).IsSuccess(ctx)
+		if err != nil {
+			return err
+		}
+		if !found {
+			_, err = ES.Synonyms.PutSynonym(IndexName).SynonymsSet().Do(ctx)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	_, err = ES.Indices.Create(IndexName).Raw(bytes.NewReader(data)).Do(ctx)
+	if err != nil {
+		return err
+	}
+	log.Info().Str("index", IndexName).Str("analyzer", config.Config.ElasticsearchAnalyzer).Msg("elasticsearch index created")
+	return nil
+}
+
+// UpdateSynonyms replaces the synonyms set with rules in solr format, e.g. "旦夕, fdu" or "复旦 => 旦夕".
+// If synonyms are read from ELASTICSEARCH_SYNONYMS_PATH, rules must be empty and search analyzers
+// are reloaded to pick up the file updated on all nodes
+func UpdateSynonyms(ctx context.Context, rules []string) error {
+	if config.Config.ElasticsearchSynonymsPath != "" {
+		_, err := ES.Indices.ReloadSearchAnalyzers(IndexName).Do(ctx)
+		return err
+	}
+
+	synonymRules := make([]types.SynonymRule, len(rules))
+	for i, rule := range rules {
+		synonymRules[i].Synonyms = rule
+	}
+	// search analyzers using the set are reloaded by elasticsearch
+	_, err := ES.Synonyms.PutSynonym(IndexName).SynonymsSet(synonymRules...).Do(ctx)
+	return err
+}
+
+// Reanalyze updates all documents in place in background so that they are analyzed again,
+// returns the id of the elasticsearch task
+func Reanalyze(ctx context.Context) (string, error) {
+	res, err := ES.UpdateByQuery(IndexName).Conflicts(conflicts.Proceed).WaitForCompletion(false).Do(ctx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(res.Task), nil
+}
+
+// ReindexHole indexes floors of the hole again, or removes them from the index if the hole is hidden,
+// returns the number of floors
+func ReindexHole(holeID int) (int, error) {
+	if ES == nil {
+		return 0, errors.New("elasticsearch not configured")
+	}
+	var hole Hole
+	err := DB.Take(&hole, holeID).Error
+	if err != nil {
+		return 0, err
+	}
+	var floors Floors
+	err = DB.Where("hole_id = ?", holeID).Find(&floors).Error
+	if err != nil {
+		return 0, err
+	}
+
+	if hole.Hidden {
+		BulkDelete(utils.Models2IDSlice(floors))
+		return len(floors), nil
+	}
+	floorModels := make([]FloorModel, 0, len(floors))
+	for _, floor := range floors {
+		floorModels = append(floorModels, FloorModel{
+			ID:        floor.ID,
+			UpdatedAt: floor.UpdatedAt,
+			Content:   floor.Content,
+		})
+	}
+	BulkInsert(floorModels)
+	return len(floors), nil
+}
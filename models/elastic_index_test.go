@@ -0,0 +1,80 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+
+	"treehole_next/config"
+)
+
+func TestFloorIndexBody(t *testing.T) {
+	defer func(analyzer, path string, pinyin bool) {
+		config.Config.ElasticsearchAnalyzer, config.Config.ElasticsearchSynonymsPath = analyzer, path
+		config.Config.ElasticsearchPinyin = pinyin
+	}(config.Config.ElasticsearchAnalyzer, config.Config.ElasticsearchSynonymsPath, config.Config.ElasticsearchPinyin)
+
+	content := func(body Map) Map {
+		return body["mappings"].(Map)["properties"].(Map)["content"].(Map)
+	}
+	synonym := func(body Map) Map {
+		return body["settings"].(Map)["analysis"].(Map)["filter"].(Map)["floor_synonym"].(Map)
+	}
+
+	config.Config.ElasticsearchAnalyzer = AnalyzerIK
+	config.Config.ElasticsearchSynonymsPath = ""
+	config.Config.ElasticsearchPinyin = false
+	body, err := floorIndexBody()
+	assert.Nil(t, err)
+	assert.Equal(t, "ik_max_word", content(body)["analyzer"])
+	assert.Contains(t, content(body), "fields")
+	assert.Equal(t, IndexName, synonym(body)["synonyms_set"])
+	assert.Equal(t, []string{"content", "content.ik_smart"}, floorContentFields())
+
+	config.Config.ElasticsearchAnalyzer = AnalyzerSmartCN
+	config.Config.ElasticsearchSynonymsPath = "analysis/synonyms.txt"
+	body, err = floorIndexBody()
+	assert.Nil(t, err)
+	assert.Equal(t, "smartcn", content(body)["analyzer"])
+	assert.NotContains(t, content(body), "fields")
+	assert.Equal(t, "analysis/synonyms.txt", synonym(body)["synonyms_path"])
+	assert.NotContains(t, synonym(body), "synonyms_set")
+	assert.Equal(t, []string{"content"}, floorContentFields())
+
+	config.Config.ElasticsearchPinyin = true
+	body, err = floorIndexBody()
+	assert.Nil(t, err)
+	assert.Equal(t, Map{"type": "text", "analyzer": pinyinAnalyzerName}, content(body)["fields"].(Map)["pinyin"])
+	assert.Contains(t, body["settings"].(Map)["analysis"].(Map)["tokenizer"], pinyinAnalyzerName)
+
+	config.Config.ElasticsearchAnalyzer = "jieba"
+	_, err = floorIndexBody()
+	assert.NotNil(t, err)
+}
+
+func TestFloorSearchQuery(t *testing.T) {
+	defer func(analyzer string, pinyin bool) {
+		config.Config.ElasticsearchAnalyzer, config.Config.ElasticsearchPinyin = analyzer, pinyin
+	}(config.Config.ElasticsearchAnalyzer, config.Config.ElasticsearchPinyin)
+	config.Config.ElasticsearchAnalyzer = AnalyzerIK
+
+	queries := func(accurate, fuzzy bool) string {
+		query := floorSearchQuery("拖鞋", accurate, fuzzy, nil, nil)
+		data, err := json.Marshal(query.Bool.Must[0].DisMax.Queries)
+		assert.Nil(t, err)
+		return string(data)
+	}
+
+	config.Config.ElasticsearchPinyin = false
+	assert.NotContains(t, queries(false, false), "fuzziness")
+	assert.Contains(t, queries(false, true), `"fuzziness":"AUTO"`)
+	assert.NotContains(t, queries(false, true), "content.pinyin")
+
+	config.Config.ElasticsearchPinyin = true
+	assert.Contains(t, queries(false, true), `"content.pinyin":{"query":"拖鞋"}`)
+	assert.NotContains(t, queries(false, false), "content.pinyin")
+	// fuzzy is ignored if accurate
+	assert.NotContains(t, queries(true, true), "content.pinyin")
+	assert.NotContains(t, queries(true, true), "fuzziness")
+}
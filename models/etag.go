@@ -0,0 +1,84 @@
+package models
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+
+	"treehole_next/utils"
+)
+
+// listings showing changes of the table, see utils.CheckETag
+var etagListings = map[string]string{
+	"division":      utils.ETagDivisions,
+	"hole":          utils.ETagHoles,
+	"floor":         utils.ETagHoles,
+	"tag":           utils.ETagHoles,
+	"hole_tags":     utils.ETagHoles,
+	"floor_like":    utils.ETagHoles,
+	"floor_mention": utils.ETagHoles,
+}
+
+// counters updated in the background, shown stale until the next change, e.g. views flushed every minute
+var etagIgnoredColumns = []string{"view"}
+
+func touchETagStamp(tx *gorm.DB) {
+	if tx.Error != nil || tx.Statement == nil {
+		return
+	}
+	listing, ok := etagListings[tx.Statement.Table]
+	if !ok || onlyETagIgnoredColumns(tx.Statement) {
+		return
+	}
+	err := utils.TouchETagStamp(listing)
+	if err != nil {
+		log.Err(err).Msg("touch etag stamp failed")
+	}
+}
+
+// onlyETagIgnoredColumns reports whether an update by map, e.g. UpdateColumn, only sets etagIgnoredColumns
+func onlyETagIgnoredColumns(stmt *gorm.Statement) bool {
+	values, ok := stmt.Dest.(map[string]any)
+	if !ok || len(values) == 0 {
+		return false
+	}
+	for column := range values {
+		if !slices.Contains(etagIgnoredColumns, column) {
+			return false
+		}
+	}
+	return true
+}
+
+// registerETagCallbacks invalidates ETags of listings on every create, update and delete of contents
+func registerETagCallbacks(db *gorm.DB) error {
+	err := db.Callback().Create().After("gorm:create").Register("etag:touch_create", touchETagStamp)
+	if err != nil {
+		return err
+	}
+	err = db.Callback().Update().After("gorm:update").Register("etag:touch_update", touchETagStamp)
+	if err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:delete").Register("etag:touch_delete", touchETagStamp)
+}
+
+func (holes Holes) LastModified() (lastModified time.Time) {
+	for _, hole := range holes {
+		if hole.UpdatedAt.After(lastModified) {
+			lastModified = hole.UpdatedAt
+		}
+	}
+	return
+}
+
+func (divisions Divisions) LastModified() (lastModified time.Time) {
+	for _, division := range divisions {
+		if division.UpdatedAt.After(lastModified) {
+			lastModified = division.UpdatedAt
+		}
+	}
+	return
+}
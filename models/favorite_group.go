@@ -2,10 +2,11 @@ package models
 
 import (
 	"errors"
-	"github.com/opentreehole/go-common"
 	"gorm.io/gorm"
 	"gorm.io/plugin/dbresolver"
 	"time"
+
+	"treehole_next/utils"
 )
 
 type FavoriteGroup struct {
@@ -43,7 +44,7 @@ func UserGetFavoriteGroups(tx *gorm.DB, userID int, order *string) (favoriteGrou
 
 func DeleteUserFavoriteGroup(tx *gorm.DB, userID int, groupID int) (err error) {
 	if groupID == 0 {
-		return common.Forbidden("默认收藏夹不可删除")
+		return utils.NewError(utils.ErrCodeDefaultFavoriteGroupUndeletable, "默认收藏夹不可删除")
 	}
 	err = tx.Model(&UserFavorite{}).Where("user_id = ? AND favorite_group_id = ?", userID, groupID).Take(&UserFavorite{}).Error
 	if err != nil {
@@ -51,7 +52,7 @@ func DeleteUserFavoriteGroup(tx *gorm.DB, userID int, groupID int) (err error) {
 			return err
 		}
 	} else {
-		return common.Forbidden("收藏夹中存在收藏内容，请先移除")
+		return utils.NewError(utils.ErrCodeFavoriteGroupNotEmpty, "收藏夹中存在收藏内容，请先移除")
 	}
 
 	result := tx.Clauses(dbresolver.Write).Where("user_id = ? AND favorite_group_id = ?", userID, groupID).Updates(FavoriteGroup{Deleted: true})
@@ -59,7 +60,7 @@ func DeleteUserFavoriteGroup(tx *gorm.DB, userID int, groupID int) (err error) {
 		return err
 	}
 	if result.RowsAffected == 0 {
-		return common.NotFound("收藏夹不存在")
+		return utils.NewError(utils.ErrCodeFavoriteGroupNotFound, "收藏夹不存在")
 	}
 	err = tx.Model(&UserFavorite{}).Where("user_id = ? AND favorite_group_id = ?", userID, groupID).Delete(&UserFavorite{}).Error
 	if err != nil {
@@ -108,7 +109,7 @@ func AddUserFavoriteGroup(tx *gorm.DB, userID int, name string) (err error) {
 			err = tx.Model(&FavoriteGroup{}).Where("user_id = ? and deleted = true", userID).Order("favorite_group_id").Limit(1).Take(&groupID).Error
 		}
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return common.Forbidden("收藏夹数量已达上限")
+			return utils.NewError(utils.ErrCodeFavoriteGroupLimitExceeded, "收藏夹数量已达上限")
 		}
 		if err != nil {
 			return err
@@ -11,6 +11,7 @@ import (
 	"treehole_next/utils"
 
 	"github.com/gofiber/fiber/v2"
+	"golang.org/x/exp/slices"
 	"gorm.io/plugin/dbresolver"
 
 	"gorm.io/gorm"
@@ -46,15 +47,35 @@ type Floor struct {
 	// whether the floor is deleted
 	Deleted bool `json:"deleted" gorm:"not null;default:false"`
 
+	// preserved for compliance, see SetLegalHold. Admins only
+	LegalHold bool `json:"legal_hold,omitempty" gorm:"not null;default:false"`
+
+	// why moderators deleted the floor, see ReportCategories, empty if deleted by the author or for sensitive content
+	DeleteCategory string `json:"delete_category,omitempty" gorm:"size:32;not null;default:''"`
+
 	// the modification times of floor.content
 	Modified int `json:"modified" gorm:"not null;default:0"`
 
+	// increased on every edit of content, fold or special tag, used to detect concurrent edits
+	Version int `json:"version" gorm:"not null;default:0"`
+
 	// fold reason
 	Fold string `json:"fold_v2"`
 
+	// set by the author, clients collapse the floor behind the warning by default, independent of Fold.
+	// A spoiler without warning text is shown as 剧透 by clients
+	Spoiler        bool   `json:"spoiler" gorm:"not null;default:false"`
+	ContentWarning string `json:"content_warning" gorm:"size:32;not null;default:''"`
+
+	// the hole the floor is moved from by merging, 0 if not merged, see Hole.Merge
+	MergedFrom int `json:"merged_from" gorm:"not null;default:0"`
+
 	// additional info, like "树洞管理团队"
 	SpecialTag string `json:"special_tag"`
 
+	// user, system or bot, machine floors are styled distinctly and can't be liked, see FloorTypeUser
+	Type string `json:"type" gorm:"size:8;not null;default:user"`
+
 	// auto sensitive check
 	IsSensitive bool `json:"is_sensitive" gorm:"index:idx_floor_actual_sensitive_updated_at,priority:1;index:idx_floor_actual_sensitive_created_at,priority:1"`
 
@@ -67,7 +88,7 @@ type Floor struct {
 	/// association info, should add foreign key
 
 	// the user who wrote it
-	UserID int `json:"-" gorm:"not null"`
+	UserID int `json:"-" gorm:"not null;index"`
 
 	// the hole it belongs to
 	HoleID int `json:"hole_id" gorm:"not null;uniqueIndex:idx_hole_ranking,priority:1"`
@@ -99,6 +120,18 @@ type Floor struct {
 
 	// whether the user is the author of the floor
 	IsMe bool `json:"is_me" gorm:"-:all"`
+
+	// whether the user has bookmarked the floor, see UserFloorFavorite
+	IsBookmarked bool `json:"is_bookmarked" gorm:"-:all"`
+
+	// whether clients collapse the floor by default, for a spoiler or content warning of the author
+	Collapsed bool `json:"collapsed" gorm:"-:all"`
+
+	// whether the frontend shows the floor number, by type, see config.Config.FloorUnnumberedTypes
+	Numbered bool `json:"numbered" gorm:"-:all"`
+
+	// badges shown by the author, see UserBadge
+	Badges []string `json:"badges" gorm:"-:all"`
 }
 
 func (floor *Floor) GetID() int {
@@ -115,8 +148,8 @@ func (floor *Floor) Preprocess(c *fiber.Ctx) error {
 	return Floors{floor}.Preprocess(c)
 }
 
-func MakeFloorQuerySet(_ *fiber.Ctx) (*gorm.DB, error) {
-	return DB.Preload("Mention"), nil
+func MakeFloorQuerySet(c *fiber.Ctx) (*gorm.DB, error) {
+	return ReadDB(c).Preload("Mention"), nil
 	//user, err := GetUser(c)
 	//if err != nil {
 	//	return nil, err
@@ -190,31 +223,18 @@ func (floors Floors) loadFloorLikes(c *fiber.Ctx) (err error) {
 		return
 	}
 
-	floorIDs := make([]int, len(floors))
-	IDFloorMapping := make(map[int]*Floor)
-	for i, floor := range floors {
-		floorIDs[i] = floor.ID
-		IDFloorMapping[floor.ID] = floors[i]
-	}
-
-	var floorLikes []FloorLike
-	err = DB.Clauses(dbresolver.Write).
-		Where("floor_id IN (?)", floorIDs).
-		Where("user_id = ?", userID).
-		Find(&floorLikes).Error
+	likes, err := loadUserLikes(userID, floors)
 	if err != nil {
 		return
 	}
 
-	for _, floorLike := range floorLikes {
-		if floor, ok := IDFloorMapping[floorLike.FloorID]; ok {
-			floor.Liked = floorLike.LikeData
-			switch floor.Liked {
-			case 1:
-				floor.LikedFrontend = true
-			case -1:
-				floor.DislikedFrontend = true
-			}
+	for _, floor := range floors {
+		floor.Liked = likes[floor.ID]
+		switch floor.Liked {
+		case 1:
+			floor.LikedFrontend = true
+		case -1:
+			floor.DislikedFrontend = true
 		}
 	}
 	return
@@ -232,6 +252,12 @@ func (floors Floors) Preprocess(c *fiber.Ctx) (err error) {
 		return
 	}
 
+	// get floors' bookmarks
+	err = floors.loadFloorBookmarks(c)
+	if err != nil {
+		return
+	}
+
 	// set floors IsMe
 	for _, floor := range floors {
 		floor.IsMe = userID == floor.UserID
@@ -244,7 +270,100 @@ func (floors Floors) Preprocess(c *fiber.Ctx) (err error) {
 			return
 		}
 	}
-	return
+
+	// show verified nickname in real-name divisions
+	err = floors.loadRealNames()
+	if err != nil {
+		return
+	}
+
+	err = floors.loadBadges()
+	if err != nil {
+		return
+	}
+
+	if c.Query("format") == FloorFormatPlain {
+		floors.toPlain()
+	}
+	return nil
+}
+
+// loadRealNames replaces anonyname with the poster's verified nickname
+// for floors (and their mentions) whose hole is in a real-name division.
+// Nothing is stored, so holes moved into or out of such a division,
+// or divisions switching the mode, are rendered correctly without migration.
+func (floors Floors) loadRealNames() error {
+	if len(floors) == 0 {
+		return nil
+	}
+
+	divisionIDs, err := RealNameDivisionIDs()
+	if err != nil {
+		return err
+	}
+	if len(divisionIDs) == 0 {
+		return nil
+	}
+
+	allFloors := make(Floors, 0, len(floors))
+	holeIDs := make([]int, 0, len(floors))
+	for _, floor := range floors {
+		allFloors = append(allFloors, floor)
+		allFloors = append(allFloors, floor.Mention...)
+	}
+	for _, floor := range allFloors {
+		holeIDs = append(holeIDs, floor.HoleID)
+	}
+
+	var realNameHoleIDs []int
+	err = DB.Model(&Hole{}).
+		Where("id in ? and division_id in ?", holeIDs, divisionIDs).
+		Pluck("id", &realNameHoleIDs).Error
+	if err != nil {
+		return err
+	}
+
+	if len(realNameHoleIDs) == 0 {
+		return nil
+	}
+
+	// user_id is not kept in hole cache, load it from database
+	floorIDs := make([]int, 0, len(allFloors))
+	for _, floor := range allFloors {
+		if slices.Contains(realNameHoleIDs, floor.HoleID) {
+			floorIDs = append(floorIDs, floor.ID)
+		}
+	}
+	var floorUsers []struct {
+		ID     int
+		UserID int
+	}
+	err = DB.Model(&Floor{}).Select("id", "user_id").Where("id in ? and hole_id in ?", floorIDs, realNameHoleIDs).Scan(&floorUsers).Error
+	if err != nil {
+		return err
+	}
+	floorUserMapping := make(map[int]int, len(floorUsers))
+	for _, floorUser := range floorUsers {
+		floorUserMapping[floorUser.ID] = floorUser.UserID
+	}
+
+	userIDs := make([]int, 0, len(floorUsers))
+	for _, floorUser := range floorUsers {
+		userIDs = append(userIDs, floorUser.UserID)
+	}
+	nicknames := GetUserNicknames(userIDs)
+
+	for _, floor := range allFloors {
+		userID, ok := floorUserMapping[floor.ID]
+		if !ok {
+			continue
+		}
+		// keep anonyname if nickname is unavailable
+		if nickname, ok := nicknames[userID]; ok {
+			floor.Anonyname = nickname
+		}
+	}
+	return nil
 }
 
 func (floor *Floor) SetDefaults(c *fiber.Ctx) (err error) {
@@ -255,6 +374,8 @@ func (floor *Floor) SetDefaults(c *fiber.Ctx) (err error) {
 	}
 
 	floor.Anonyname = utils.GetFuzzName(floor.Anonyname)
+	floor.Numbered = floor.IsNumbered()
+	floor.Collapsed = floor.Spoiler || floor.ContentWarning != ""
 	if floor.Sensitive() {
 		if user.IsAdmin {
 			floor.SpecialTag = "sensitive"
@@ -273,6 +394,7 @@ func (floor *Floor) SetDefaults(c *fiber.Ctx) (err error) {
 	}
 	if !user.IsAdmin {
 		floor.SensitiveDetail = ""
+		floor.LegalHold = false
 	}
 
 	if floor.Mention == nil {
@@ -317,6 +439,29 @@ Create
 *******************************/
 
 func (floor *Floor) Create(tx *gorm.DB, hole *Hole, c *fiber.Ctx) (err error) {
+	err = CheckDivisionArchived(hole.DivisionID)
+	if err != nil {
+		return
+	}
+
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return
+	}
+	err = user.CheckLinkPrivilege(floor.Content)
+	if err != nil {
+		return
+	}
+	floor.Type = FloorTypeOf(c)
+	spamVerdict, err := CheckSpam(c.UserContext(), user, hole.DivisionID, floor, ChallengeSolved(c, user.ID))
+	if err != nil {
+		return
+	}
+	err = CheckLinkRules(floor)
+	if err != nil {
+		return
+	}
+
 	// sensitive check
 	sensitiveCheckResp, err := sensitive.CheckSensitive(sensitive.ParamsForCheck{
 		Content:  floor.Content,
@@ -326,11 +471,11 @@ func (floor *Floor) Create(tx *gorm.DB, hole *Hole, c *fiber.Ctx) (err error) {
 	if err != nil {
 		return
 	}
-	floor.IsSensitive = !sensitiveCheckResp.Pass
+	floor.IsSensitive = !sensitiveCheckResp.Pass && !user.Trusted(TrustedBypassSensitive)
 	floor.SensitiveDetail = sensitiveCheckResp.Detail
 
 	// load floor mention, in another session
-	floor.Mention, err = LoadFloorMentions(DB, floor.Content)
+	floor.Mention, err = LoadFloorMentions(RequestDB(c), floor.Content)
 	if err != nil {
 		return
 	}
@@ -357,6 +502,15 @@ func (floor *Floor) Create(tx *gorm.DB, hole *Hole, c *fiber.Ctx) (err error) {
 			return err
 		}
 
+		err = recordPost(tx, floor.UserID, false, time.Now())
+		if err != nil {
+			return err
+		}
+		err = enterRaffle(tx, floor.HoleID, floor.UserID, RaffleEntryReply)
+		if err != nil {
+			return err
+		}
+
 		// update hole reply and update_at
 		return tx.Model(&hole).
 			Omit(clause.Associations).
@@ -367,6 +521,9 @@ func (floor *Floor) Create(tx *gorm.DB, hole *Hole, c *fiber.Ctx) (err error) {
 	if err != nil {
 		return err
 	}
+	spamVerdict.ReportFloor(floor)
+	TriggerBadges(floor.UserID, BadgeEventPost)
+	ReviewFloorImages(floor)
 
 	err = floor.SetDefaults(c)
 	if err != nil {
@@ -374,6 +531,8 @@ func (floor *Floor) Create(tx *gorm.DB, hole *Hole, c *fiber.Ctx) (err error) {
 	}
 
 	if !floor.Sensitive() {
+		checkHoleAutoMute(tx, floor.HoleID)
+
 		// Send Notification
 		var messages Notifications
 		messages = messages.Merge(floor.SendReply(tx))
@@ -391,13 +550,14 @@ func (floor *Floor) Create(tx *gorm.DB, hole *Hole, c *fiber.Ctx) (err error) {
 
 	if !hole.Hidden && !floor.Sensitive() {
 		// insert into Elasticsearch
-		go FloorIndex(FloorModel{
+		floorModel := FloorModel{
 			ID:        floor.ID,
 			UpdatedAt: time.Now(),
 			Content:   floor.Content,
-		})
+		}
+		utils.Go(func() { FloorIndex(floorModel) })
 	} else {
-		go FloorDelete(floor.ID)
+		utils.Go(func() { FloorDelete(floor.ID) })
 	}
 
 	// delete cache
@@ -447,40 +607,63 @@ func (floor *Floor) Backup(tx *gorm.DB, userID int, reason string) error {
 	return tx.Create(&history).Error
 }
 
-// ModifyLike do in transaction only
+// ModifyLike do in transaction only, the floor should be locked.
+// Repeated actions are no-ops, and counters are always recomputed from FloorLike
 func (floor *Floor) ModifyLike(tx *gorm.DB, userID int, likeOption int8) (err error) {
+	if !floor.Likeable() {
+		return utils.NewError(utils.ErrCodeFloorNotLikeable, "该楼层不能点赞")
+	}
 	if userID == floor.UserID {
 		floor.IsMe = true
 	}
-	floorLike := &FloorLike{
-		FloorID: floor.ID,
-		UserID:  userID,
+	current, err := floor.currentLike(tx, userID)
+	if err != nil {
+		return err
 	}
-	if likeOption == 0 {
-		err = tx.Delete(&floorLike).Error
+
+	if likeOption != current {
+		// notify the owner of new likes by digest
+		if likeOption == 1 && userID != floor.UserID {
+			err = floor.addLikeDigest(tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		floorLike := &FloorLike{
+			FloorID: floor.ID,
+			UserID:  userID,
+		}
+		if likeOption == 0 {
+			err = tx.Delete(&floorLike).Error
+		} else {
+			floorLike.LikeData = likeOption
+			err = tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&floorLike).Error
+		}
 		if err != nil {
 			return err
 		}
-	} else {
-		floorLike.LikeData = likeOption
-		err = tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&floorLike).Error
+
+		err = addUserStats(tx, floor.UserID, "likes_received", likeCount(likeOption)-likeCount(current))
 		if err != nil {
 			return err
 		}
-	}
 
-	var like, dislike int64
-	err = tx.Model(&FloorLike{}).Where("floor_id = ? and like_data = ?", floor.ID, 1).Count(&like).Error
-	if err != nil {
-		return err
+		// likes on the first floor enter the raffle of the hole
+		if floor.Ranking == 0 && likeOption == 1 {
+			err = enterRaffle(tx, floor.HoleID, userID, RaffleEntryLike)
+		} else if floor.Ranking == 0 && current == 1 {
+			err = leaveRaffle(tx, floor.HoleID, userID, RaffleEntryLike)
+		}
+		if err != nil {
+			return err
+		}
 	}
-	err = tx.Model(&FloorLike{}).Where("floor_id = ? and like_data = ?", floor.ID, -1).Count(&dislike).Error
+
+	err = floor.countLikes(tx)
 	if err != nil {
 		return err
 	}
-
-	floor.Like = int(like)
-	floor.Dislike = int(dislike)
 	floor.Liked = likeOption
 	if likeOption == 1 {
 		floor.LikedFrontend = true
@@ -509,6 +692,7 @@ func (floor *Floor) SendSubscription(tx *gorm.DB) Notification {
 			userIDs = append(userIDs, id)
 		}
 	}
+	userIDs = removeMutedRecipients(tx, floor.HoleID, userIDs)
 
 	// Construct Notification
 	message := Notification{
@@ -536,6 +720,7 @@ func (floor *Floor) SendReply(tx *gorm.DB) Notification {
 	if userID != 0 && userID != floor.UserID {
 		userIDs = []int{userID}
 	}
+	userIDs = removeMutedRecipients(tx, floor.HoleID, userIDs)
 
 	// construct message
 	message := Notification{
@@ -598,6 +783,20 @@ func (floor *Floor) SendModify(_ *gorm.DB) error {
 	return nil
 }
 
+// SendDelete notifies the author that moderators deleted the floor for the reason
+func (floor *Floor) SendDelete(reason string) error {
+	message := Notification{
+		Data:        floor,
+		Recipients:  []int{floor.UserID},
+		Description: reason,
+		Title:       "您的内容被管理员删除了",
+		Type:        MessageTypeModify,
+		URL:         fmt.Sprintf("/api/floors/%d", floor.ID),
+	}
+	_, err := message.Send()
+	return err
+}
+
 func (floor *Floor) SendSensitive(_ *gorm.DB) error {
 	userIDs := adminList.data
 	if len(userIDs) == 0 {
@@ -0,0 +1,244 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+
+	"treehole_next/utils"
+)
+
+// FloorFavoriteGroup is a group of bookmarked floors, independent of FavoriteGroup of holes
+type FloorFavoriteGroup struct {
+	FavoriteGroupID int       `json:"favorite_group_id" gorm:"primaryKey"`
+	UserID          int       `json:"user_id" gorm:"primaryKey"`
+	Name            string    `json:"name" gorm:"not null;size:64"`
+	CreatedAt       time.Time `json:"time_created"`
+	UpdatedAt       time.Time `json:"time_updated"`
+	Deleted         bool      `json:"deleted" gorm:"default:false"`
+	Count           int       `json:"count" gorm:"default:0"`
+}
+
+type FloorFavoriteGroups []FloorFavoriteGroup
+
+// UserFloorFavorite is a floor bookmarked by the user in a group
+type UserFloorFavorite struct {
+	UserID          int       `json:"user_id" gorm:"primaryKey"`
+	FavoriteGroupID int       `json:"favorite_group_id" gorm:"primaryKey"`
+	FloorID         int       `json:"floor_id" gorm:"primaryKey;index"`
+	CreatedAt       time.Time `json:"time_created"`
+}
+
+type UserFloorFavorites []UserFloorFavorite
+
+func IsFloorFavoriteGroupExist(tx *gorm.DB, userID int, favoriteGroupID int) bool {
+	var num int64
+	tx.Model(&FloorFavoriteGroup{}).Where("user_id = ? AND favorite_group_id = ? AND deleted = false", userID, favoriteGroupID).Count(&num)
+	return num > 0
+}
+
+// CheckDefaultFloorFavoriteGroup creates the default group 0 if not exists
+func CheckDefaultFloorFavoriteGroup(tx *gorm.DB, userID int) error {
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&FloorFavoriteGroup{
+		UserID:          userID,
+		Name:            "默认收藏夹",
+		FavoriteGroupID: 0,
+	}).Error
+}
+
+func UserGetFloorFavoriteGroups(tx *gorm.DB, userID int, order string) (groups FloorFavoriteGroups, err error) {
+	err = CheckDefaultFloorFavoriteGroup(tx, userID)
+	if err != nil {
+		return
+	}
+	err = tx.Where("user_id = ? and deleted = false", userID).Order(order).Find(&groups).Error
+	return
+}
+
+func AddUserFloorFavoriteGroup(tx *gorm.DB, userID int, name string) error {
+	return tx.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		err := CheckDefaultFloorFavoriteGroup(tx, userID)
+		if err != nil {
+			return err
+		}
+		var groupID int
+		err = tx.Model(&FloorFavoriteGroup{}).Select("COALESCE(MAX(favorite_group_id), 0)").
+			Where("user_id = ? and deleted = false", userID).Take(&groupID).Error
+		if err != nil {
+			return err
+		}
+		groupID++
+		if groupID >= MaxGroupPerUser {
+			// reuse a deleted group
+			err = tx.Model(&FloorFavoriteGroup{}).Select("favorite_group_id").Where("user_id = ? and deleted = true", userID).
+				Order("favorite_group_id").Limit(1).Take(&groupID).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return utils.NewError(utils.ErrCodeFavoriteGroupLimitExceeded, "收藏夹数量已达上限")
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Clauses(clause.OnConflict{
+			DoUpdates: clause.Assignments(Map{"name": name, "deleted": false, "count": 0, "created_at": time.Now()}),
+		}).Create(&FloorFavoriteGroup{UserID: userID, Name: name, FavoriteGroupID: groupID}).Error
+	})
+}
+
+func ModifyUserFloorFavoriteGroup(tx *gorm.DB, userID int, groupID int, name string) error {
+	result := tx.Clauses(dbresolver.Write).Where("user_id = ? AND favorite_group_id = ? AND deleted = false", userID, groupID).
+		Updates(FloorFavoriteGroup{Name: name, UpdatedAt: time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return utils.NewError(utils.ErrCodeFavoriteGroupNotFound, "收藏夹不存在")
+	}
+	return nil
+}
+
+func DeleteUserFloorFavoriteGroup(tx *gorm.DB, userID int, groupID int) error {
+	if groupID == 0 {
+		return utils.NewError(utils.ErrCodeDefaultFavoriteGroupUndeletable, "默认收藏夹不可删除")
+	}
+	var count int64
+	err := tx.Model(&UserFloorFavorite{}).Where("user_id = ? AND favorite_group_id = ?", userID, groupID).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return utils.NewError(utils.ErrCodeFavoriteGroupNotEmpty, "收藏夹中存在收藏内容，请先移除")
+	}
+	result := tx.Clauses(dbresolver.Write).Model(&FloorFavoriteGroup{}).
+		Where("user_id = ? AND favorite_group_id = ? AND deleted = false", userID, groupID).Update("deleted", true)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return utils.NewError(utils.ErrCodeFavoriteGroupNotFound, "收藏夹不存在")
+	}
+	return nil
+}
+
+func isFloorExist(tx *gorm.DB, floorIDs []int) bool {
+	var num int64
+	tx.Model(&Floor{}).Where("id in ?", floorIDs).Count(&num)
+	return num == int64(len(floorIDs))
+}
+
+func AddUserFloorFavorite(tx *gorm.DB, userID int, floorID int, favoriteGroupID int) error {
+	err := CheckDefaultFloorFavoriteGroup(tx, userID)
+	if err != nil {
+		return err
+	}
+	if !IsFloorFavoriteGroupExist(tx, userID, favoriteGroupID) {
+		return utils.NewError(utils.ErrCodeFavoriteGroupNotFound, "收藏夹不存在")
+	}
+	if !isFloorExist(tx, []int{floorID}) {
+		return utils.NewError(utils.ErrCodeFloorNotFound, "楼层不存在")
+	}
+	result := tx.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(Map{"created_at": time.Now()}),
+	}).Create(&UserFloorFavorite{UserID: userID, FloorID: floorID, FavoriteGroupID: favoriteGroupID})
+	if result.Error != nil {
+		return result.Error
+	}
+	return refreshFloorFavoriteGroupCount(tx, userID, favoriteGroupID)
+}
+
+func DeleteUserFloorFavorite(tx *gorm.DB, userID int, floorID int, favoriteGroupID int) error {
+	if !IsFloorFavoriteGroupExist(tx, userID, favoriteGroupID) {
+		return utils.NewError(utils.ErrCodeFavoriteGroupNotFound, "收藏夹不存在")
+	}
+	return tx.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		err := tx.Delete(&UserFloorFavorite{UserID: userID, FloorID: floorID, FavoriteGroupID: favoriteGroupID}).Error
+		if err != nil {
+			return err
+		}
+		return refreshFloorFavoriteGroupCount(tx, userID, favoriteGroupID)
+	})
+}
+
+// MoveUserFloorFavorite moves floors that are really in the fromFavoriteGroup, kept in the toFavoriteGroup if already there
+func MoveUserFloorFavorite(tx *gorm.DB, userID int, floorIDs []int, fromFavoriteGroupID int, toFavoriteGroupID int) error {
+	if fromFavoriteGroupID == toFavoriteGroupID || len(floorIDs) == 0 {
+		return nil
+	}
+	if !IsFloorFavoriteGroupExist(tx, userID, fromFavoriteGroupID) || !IsFloorFavoriteGroupExist(tx, userID, toFavoriteGroupID) {
+		return utils.NewError(utils.ErrCodeFavoriteGroupNotFound, "收藏夹不存在")
+	}
+	return tx.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		var favorites UserFloorFavorites
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND favorite_group_id = ? AND floor_id IN ?", userID, fromFavoriteGroupID, floorIDs).
+			Find(&favorites).Error
+		if err != nil || len(favorites) == 0 {
+			return err
+		}
+		for i := range favorites {
+			favorites[i].FavoriteGroupID = toFavoriteGroupID
+		}
+		err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&favorites).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("user_id = ? AND favorite_group_id = ? AND floor_id IN ?", userID, fromFavoriteGroupID, floorIDs).
+			Delete(&UserFloorFavorite{}).Error
+		if err != nil {
+			return err
+		}
+		err = refreshFloorFavoriteGroupCount(tx, userID, fromFavoriteGroupID)
+		if err != nil {
+			return err
+		}
+		return refreshFloorFavoriteGroupCount(tx, userID, toFavoriteGroupID)
+	})
+}
+
+func refreshFloorFavoriteGroupCount(tx *gorm.DB, userID int, favoriteGroupID int) error {
+	return tx.Model(&FloorFavoriteGroup{}).Where("user_id = ? AND favorite_group_id = ?", userID, favoriteGroupID).
+		Update("count", tx.Model(&UserFloorFavorite{}).Select("COUNT(*)").
+			Where("user_id = ? AND favorite_group_id = ?", userID, favoriteGroupID)).Error
+}
+
+// UserGetFloorFavoriteData returns ids of floors bookmarked by the user, in the group if favoriteGroupID is not nil
+func UserGetFloorFavoriteData(tx *gorm.DB, userID int, favoriteGroupID *int) ([]int, error) {
+	data := make([]int, 0, 10)
+	querySet := tx.Clauses(dbresolver.Write).Model(&UserFloorFavorite{}).Where("user_id = ?", userID)
+	if favoriteGroupID != nil {
+		querySet = querySet.Where("favorite_group_id = ?", *favoriteGroupID)
+	}
+	err := querySet.Distinct().Pluck("floor_id", &data).Error
+	return data, err
+}
+
+// loadFloorBookmarks sets IsBookmarked of floors bookmarked by the current user
+func (floors Floors) loadFloorBookmarks(c *fiber.Ctx) error {
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+	if len(floors) == 0 {
+		return nil
+	}
+	floorIDs := make([]int, 0, len(floors))
+	for _, floor := range floors {
+		floorIDs = append(floorIDs, floor.ID)
+	}
+	var bookmarked []int
+	err = ReadDB(c).Model(&UserFloorFavorite{}).Where("user_id = ? AND floor_id IN ?", userID, floorIDs).
+		Distinct().Pluck("floor_id", &bookmarked).Error
+	if err != nil {
+		return err
+	}
+	for _, floor := range floors {
+		floor.IsBookmarked = slices.Contains(bookmarked, floor.ID)
+	}
+	return nil
+}
@@ -1,6 +1,13 @@
 package models
 
-import "time"
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type FloorHistory struct {
 	/// base info
@@ -19,6 +26,37 @@ type FloorHistory struct {
 	SensitiveDetail string `json:"sensitive_detail,omitempty"`
 	// The one who modified the floor
 	UserID int `json:"user_id"`
+
+	// gzipped content of old histories, Content is empty in database, see RetentionCompressHistories
+	CompressedContent []byte `json:"-"`
+}
+
+// AfterFind restores compressed content
+func (history *FloorHistory) AfterFind(_ *gorm.DB) error {
+	if len(history.CompressedContent) == 0 {
+		return nil
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(history.CompressedContent))
+	if err != nil {
+		return err
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	history.Content = string(content)
+	return nil
+}
+
+func compressContent(content string) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	_, err := writer.Write([]byte(content))
+	if err != nil {
+		return nil, err
+	}
+	err = writer.Close()
+	return buf.Bytes(), err
 }
 
 type FloorHistorySlice []*FloorHistory
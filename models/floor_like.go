@@ -1,7 +1,147 @@
 package models
 
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"treehole_next/utils"
+)
+
+// FloorLike is the only like of a user on a floor, 1 is like and -1 is dislike.
+// Resetting deletes the row, so Floor.Like and Floor.Dislike can be recomputed by counting rows
 type FloorLike struct {
 	FloorID  int  `json:"floor_id" gorm:"primaryKey"`
 	UserID   int  `json:"user_id" gorm:"primaryKey"`
 	LikeData int8 `json:"like_data"`
 }
+
+// userLikesExpire is the expiration of cached likes of a user in a hole, see loadUserLikes
+const userLikesExpire = 10 * time.Minute
+
+func userLikesCacheKey(userID, holeID int) string {
+	return fmt.Sprintf("user_likes_%d_%d", userID, holeID)
+}
+
+// DeleteUserLikesCache should be called after likes of the user in the hole are committed
+func DeleteUserLikesCache(userID, holeID int) error {
+	return utils.DeleteCache(userLikesCacheKey(userID, holeID))
+}
+
+// deleteUserLikesCaches deletes cached likes of each user in each hole, call after committed
+func deleteUserLikesCaches(userIDs, holeIDs []int) {
+	for _, userID := range userIDs {
+		for _, holeID := range holeIDs {
+			_ = DeleteUserLikesCache(userID, holeID)
+		}
+	}
+}
+
+// NextLikeOption returns the like option after toggling action (1 or -1) on current,
+// e.g. like → neutral on like and like → dislike on dislike
+func NextLikeOption(current, action int8) int8 {
+	if current == action {
+		return 0
+	}
+	return action
+}
+
+// ToggleLike applies NextLikeOption of the current like of the user, do in transaction only,
+// the floor should be locked so that concurrent toggles are serialized
+func (floor *Floor) ToggleLike(tx *gorm.DB, userID int, action int8) error {
+	current, err := floor.currentLike(tx, userID)
+	if err != nil {
+		return err
+	}
+	return floor.ModifyLike(tx, userID, NextLikeOption(current, action))
+}
+
+// likeCount is 1 for a like, dislikes are not counted in UserStats.LikesReceived
+func likeCount(likeData int8) int {
+	if likeData == 1 {
+		return 1
+	}
+	return 0
+}
+
+func (floor *Floor) currentLike(tx *gorm.DB, userID int) (int8, error) {
+	var floorLike FloorLike
+	err := tx.Where("floor_id = ? AND user_id = ?", floor.ID, userID).Limit(1).Find(&floorLike).Error
+	return floorLike.LikeData, err
+}
+
+// countLikes recomputes Like and Dislike of the floor from FloorLike
+func (floor *Floor) countLikes(tx *gorm.DB) error {
+	var counts []struct {
+		LikeData int8
+		Count    int
+	}
+	err := tx.Model(&FloorLike{}).Select("like_data, COUNT(*) AS count").
+		Where("floor_id = ?", floor.ID).Group("like_data").Scan(&counts).Error
+	if err != nil {
+		return err
+	}
+	floor.Like, floor.Dislike = 0, 0
+	for _, count := range counts {
+		switch count.LikeData {
+		case 1:
+			floor.Like = count.Count
+		case -1:
+			floor.Dislike = count.Count
+		}
+	}
+	return nil
+}
+
+// loadUserLikes returns likes of the user on floors, cached by hole since floors are mostly listed by hole.
+// Likes are read from the source database, a lagging replica would be cached for userLikesExpire
+// and undo a like the user just made
+func loadUserLikes(userID int, floors Floors) (map[int]int8, error) {
+	likes := make(map[int]int8, len(floors))
+	loaded := make(map[int]bool)
+	var missingHoleIDs []int
+	for _, floor := range floors {
+		if loaded[floor.HoleID] {
+			continue
+		}
+		loaded[floor.HoleID] = true
+		var holeLikes map[int]int8
+		if !utils.GetCache(userLikesCacheKey(userID, floor.HoleID), &holeLikes) {
+			missingHoleIDs = append(missingHoleIDs, floor.HoleID)
+			continue
+		}
+		for floorID, likeData := range holeLikes {
+			likes[floorID] = likeData
+		}
+	}
+	if len(missingHoleIDs) == 0 {
+		return likes, nil
+	}
+
+	var rows []struct {
+		FloorID  int
+		HoleID   int
+		LikeData int8
+	}
+	err := DB.Clauses(dbresolver.Write).Table("floor_like").Select("floor_like.floor_id, floor.hole_id, floor_like.like_data").
+		Joins("JOIN floor ON floor.id = floor_like.floor_id").
+		Where("floor_like.user_id = ? AND floor.hole_id IN ?", userID, missingHoleIDs).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	holeLikes := make(map[int]map[int]int8, len(missingHoleIDs))
+	for _, holeID := range missingHoleIDs {
+		holeLikes[holeID] = make(map[int]int8)
+	}
+	for _, row := range rows {
+		holeLikes[row.HoleID][row.FloorID] = row.LikeData
+		likes[row.FloorID] = row.LikeData
+	}
+	for holeID, data := range holeLikes {
+		_ = utils.SetCache(userLikesCacheKey(userID, holeID), data, userLikesExpire)
+	}
+	return likes, nil
+}
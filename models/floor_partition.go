@@ -0,0 +1,225 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+
+	"treehole_next/config"
+)
+
+// the partition of hole ids beyond the latest partition, kept empty so that splitting it is instant
+const floorPartitionMax = "pmax"
+
+// name of the MySQL lock held by the instance adding partitions
+const floorPartitionLock = "treehole_floor_partition"
+
+var errFloorHardDelete = errors.New("floors can't be deleted from the partitioned floor table")
+
+func floorPartitionEnabled(tx *gorm.DB) bool {
+	return config.Config.FloorPartitionHoles > 0 && isMySQL(tx)
+}
+
+// floorPartitionBounds returns upper bounds of partitions of the floor table, MAXVALUE included; empty if not partitioned
+func floorPartitionBounds(tx *gorm.DB) (bounds []string, err error) {
+	err = tx.Raw(`SELECT PARTITION_DESCRIPTION FROM information_schema.PARTITIONS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'floor' AND PARTITION_NAME IS NOT NULL
+		ORDER BY PARTITION_ORDINAL_POSITION`).Scan(&bounds).Error
+	return bounds, err
+}
+
+// floorPartitionTarget returns the upper bound of partitions for the current holes, a spare partition ahead of the latest hole
+func floorPartitionTarget(tx *gorm.DB) (int, error) {
+	var maxHoleID int
+	err := tx.Model(&Hole{}).Select("COALESCE(MAX(id), 0)").Scan(&maxHoleID).Error
+	if err != nil {
+		return 0, err
+	}
+	size := config.Config.FloorPartitionHoles
+	return (maxHoleID/size + 2) * size, nil
+}
+
+// partitionFloorTable partitions the floor table by ranges of FLOOR_PARTITION_HOLES hole ids,
+// so that floors of a hole, the most frequent reads, are in a single partition. Run by the migration "partition floor".
+//
+// MySQL requires the partition key in every unique key and forbids foreign keys on partitioned tables,
+// so the primary key is replaced with (id, hole_id) and foreign keys from and to the floor table are dropped.
+// Their cascades never fire: holes are soft deleted and floors are never deleted, deleting a floor replaces its content.
+// Hard deletes of floors are rejected instead, see rejectFloorHardDelete.
+//
+// Repartitioning copies the table, which MySQL can't do in place, set ONLINE_MIGRATION_TOOL to pt-online-schema-change.
+// Nothing is done if FLOOR_PARTITION_HOLES is 0, revert and reapply the migration to partition later.
+func partitionFloorTable(tx *gorm.DB) error {
+	if !floorPartitionEnabled(tx) {
+		return nil
+	}
+	bounds, err := floorPartitionBounds(tx)
+	if err != nil || len(bounds) > 0 {
+		// already partitioned by the online migration tool
+		return err
+	}
+	target, err := floorPartitionTarget(tx)
+	if err != nil {
+		return err
+	}
+
+	err = dropFloorForeignKeys(tx)
+	if err != nil {
+		return err
+	}
+	size := config.Config.FloorPartitionHoles
+	err = OnlineAlter(tx, "floor", fmt.Sprintf(
+		"DROP PRIMARY KEY, ADD PRIMARY KEY (id, hole_id) PARTITION BY RANGE (hole_id) (%s)",
+		floorPartitionDefinitions(size, target, size),
+	))
+	if err != nil {
+		return err
+	}
+	log.Info().Int("holes", size).Int("until", target).Msg("floor table partitioned")
+	return nil
+}
+
+// unpartitionFloorTable reverts partitionFloorTable if the floor table isn't partitioned;
+// partitions are not removed, nor are foreign keys restored
+func unpartitionFloorTable(tx *gorm.DB) error {
+	if !isMySQL(tx) {
+		return nil
+	}
+	bounds, err := floorPartitionBounds(tx)
+	if err != nil {
+		return err
+	}
+	if len(bounds) > 0 {
+		return errors.New("the floor table is partitioned, remove partitions manually")
+	}
+	return nil
+}
+
+// AddFloorPartitions splits the spare partition of the floor table, so that a spare partition is kept ahead of the latest hole.
+// Call it periodically as holes grow; only one instance adds partitions at a time, others return at once.
+//
+// Lookups by floor id alone, e.g. GetFloor and floor histories, probe every partition by the primary key,
+// updates and deletes of a loaded floor include hole_id, see addFloorPartitionKey
+func AddFloorPartitions() error {
+	if !floorPartitionEnabled(DB) {
+		return nil
+	}
+	// named locks are held by the connection, which is pinned by the transaction
+	return DB.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		var locked int
+		err := tx.Raw("SELECT GET_LOCK(?, 0)", floorPartitionLock).Scan(&locked).Error
+		if err != nil || locked != 1 {
+			return err
+		}
+		defer tx.Exec("SELECT RELEASE_LOCK(?)", floorPartitionLock)
+
+		bounds, err := floorPartitionBounds(tx)
+		if err != nil || len(bounds) == 0 {
+			// not partitioned by the migration
+			return err
+		}
+		target, err := floorPartitionTarget(tx)
+		if err != nil {
+			return err
+		}
+		// MAXVALUE is skipped
+		last := 0
+		for _, bound := range bounds {
+			value, err := strconv.Atoi(bound)
+			if err == nil && value > last {
+				last = value
+			}
+		}
+		if last >= target {
+			return nil
+		}
+
+		size := config.Config.FloorPartitionHoles
+		err = tx.Exec(fmt.Sprintf(
+			"ALTER TABLE floor REORGANIZE PARTITION %s INTO (%s)",
+			floorPartitionMax, floorPartitionDefinitions(last+size, target, size),
+		)).Error
+		if err != nil {
+			return err
+		}
+		log.Info().Int("from", last).Int("until", target).Msg("floor partitions added")
+		return nil
+	})
+}
+
+// floorPartitionDefinitions returns partitions of hole ids less than from, from + size, ... up to to, and the MAXVALUE one
+func floorPartitionDefinitions(from, to, size int) string {
+	var definitions []string
+	for bound := from; ; bound += size {
+		definitions = append(definitions, fmt.Sprintf("PARTITION p%d VALUES LESS THAN (%d)", bound, bound))
+		if bound >= to {
+			break
+		}
+	}
+	definitions = append(definitions, fmt.Sprintf("PARTITION %s VALUES LESS THAN MAXVALUE", floorPartitionMax))
+	return strings.Join(definitions, ", ")
+}
+
+// dropFloorForeignKeys drops foreign keys of the floor table and those referencing it.
+// Dropping a foreign key only changes metadata, so it is done in place even if ONLINE_MIGRATION_TOOL is set,
+// which refuses tables with foreign keys
+func dropFloorForeignKeys(tx *gorm.DB) error {
+	var foreignKeys []struct {
+		TableName      string
+		ConstraintName string
+	}
+	err := tx.Raw(`SELECT TABLE_NAME AS table_name, CONSTRAINT_NAME AS constraint_name
+		FROM information_schema.REFERENTIAL_CONSTRAINTS
+		WHERE CONSTRAINT_SCHEMA = DATABASE() AND (TABLE_NAME = 'floor' OR REFERENCED_TABLE_NAME = 'floor')`).
+		Scan(&foreignKeys).Error
+	if err != nil {
+		return err
+	}
+	for _, foreignKey := range foreignKeys {
+		err = tx.Exec("ALTER TABLE ? DROP FOREIGN KEY ?, ALGORITHM=INPLACE, LOCK=NONE",
+			clause.Table{Name: foreignKey.TableName}, clause.Column{Name: foreignKey.ConstraintName}).Error
+		if err != nil {
+			return err
+		}
+		log.Info().Str("table", foreignKey.TableName).Str("constraint", foreignKey.ConstraintName).
+			Msg("foreign key dropped for floor partitions")
+	}
+	return nil
+}
+
+// addFloorPartitionKey adds hole_id of the floor to updates and deletes by model, so that only its partition is scanned
+func addFloorPartitionKey(tx *gorm.DB) {
+	if tx.Error != nil || tx.Statement == nil || tx.Statement.Table != "floor" || !floorPartitionEnabled(tx) {
+		return
+	}
+	floor, ok := tx.Statement.Model.(*Floor)
+	if !ok || floor.HoleID == 0 {
+		return
+	}
+	tx.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "hole_id"}, Value: floor.HoleID},
+	}})
+}
+
+// rejectFloorHardDelete rejects deletes of floors, which would orphan their likes, histories, reports and punishments
+// without the foreign keys dropped by partitionFloorTable
+func rejectFloorHardDelete(tx *gorm.DB) {
+	if tx.Error != nil || tx.Statement == nil || tx.Statement.Table != "floor" || !floorPartitionEnabled(tx) {
+		return
+	}
+	_ = tx.AddError(errFloorHardDelete)
+}
+
+func registerFloorPartitionCallbacks(db *gorm.DB) error {
+	err := db.Callback().Update().Before("gorm:update").Register("partition:floor_update", addFloorPartitionKey)
+	if err != nil {
+		return err
+	}
+	return db.Callback().Delete().Before("gorm:delete").Register("partition:floor_delete", rejectFloorHardDelete)
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFloorPartitionDefinitions(t *testing.T) {
+	assert.Equal(t,
+		"PARTITION p1000 VALUES LESS THAN (1000), PARTITION p2000 VALUES LESS THAN (2000), "+
+			"PARTITION pmax VALUES LESS THAN MAXVALUE",
+		floorPartitionDefinitions(1000, 2000, 1000),
+	)
+
+	// at least one partition is split from pmax
+	assert.Equal(t,
+		"PARTITION p3000 VALUES LESS THAN (3000), PARTITION pmax VALUES LESS THAN MAXVALUE",
+		floorPartitionDefinitions(3000, 2500, 1000),
+	)
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FloorFormatPlain is the value of query format to return plain content of floors,
+// for accessibility clients and text-to-speech readers
+const FloorFormatPlain = "plain"
+
+var (
+	reCodeFence    = regexp.MustCompile("(?m)^\\s*```.*$")
+	reLink         = regexp.MustCompile(`\[(.*?)\]\(.*?\)`)
+	reHeading      = regexp.MustCompile(`(?m)^\s{0,3}#{1,6}\s+`)
+	reBlockquote   = regexp.MustCompile(`(?m)^\s{0,3}(>\s?)+`)
+	reListItem     = regexp.MustCompile(`(?m)^\s*([-*+]|\d+\.)\s+`)
+	reHorizontal   = regexp.MustCompile(`(?m)^\s*([-*_]\s*){3,}$`)
+	reEmphasis     = regexp.MustCompile("\\*\\*|__|~~|`")
+	reItalic       = regexp.MustCompile(`\*(\S(?:.*?\S)?)\*`)
+	reFloorMention = regexp.MustCompile(`##(\d+)`)
+	reHoleMention  = regexp.MustCompile(`#(\d+)`)
+	reBlankLines   = regexp.MustCompile(`\n{3,}`)
+	reImageWithAlt = regexp.MustCompile(`!\[(.*?)\]\(.*?\)`)
+)
+
+// PlainContent strips markdown of content, resolves mentions to readable text with mentioned floors
+// and replaces images, stickers and formulas with placeholders
+func PlainContent(content string, mentions Floors) string {
+	content = reCodeFence.ReplaceAllString(content, "")
+	content = reFormula.ReplaceAllString(content, "[公式]")
+	content = reSticker.ReplaceAllString(content, "[表情]")
+	content = reImageWithAlt.ReplaceAllStringFunc(content, func(image string) string {
+		alt := strings.TrimSpace(reImageWithAlt.FindStringSubmatch(image)[1])
+		if alt == "" {
+			return "[图片]"
+		}
+		return "[图片：" + alt + "]"
+	})
+	content = reLink.ReplaceAllString(content, "$1")
+	content = reHorizontal.ReplaceAllString(content, "")
+	content = reHeading.ReplaceAllString(content, "")
+	content = reBlockquote.ReplaceAllString(content, "")
+	content = reListItem.ReplaceAllString(content, "")
+	content = reEmphasis.ReplaceAllString(content, "")
+	content = reItalic.ReplaceAllString(content, "$1")
+
+	// floor mentions first, the rest are hole mentions
+	content = reFloorMention.ReplaceAllStringFunc(content, func(mention string) string {
+		floorID, _ := strconv.Atoi(mention[2:])
+		for _, floor := range mentions {
+			if floor.ID == floorID {
+				return fmt.Sprintf("树洞%d的%d楼", floor.HoleID, floor.Ranking)
+			}
+		}
+		return fmt.Sprintf("楼层%d", floorID)
+	})
+	content = reHoleMention.ReplaceAllString(content, "树洞$1")
+
+	content = reBlankLines.ReplaceAllString(content, "\n\n")
+	return strings.TrimSpace(content)
+}
+
+// toPlain replaces content of floors and their mentions with plain content, see PlainContent
+func (floors Floors) toPlain() {
+	for _, floor := range floors {
+		floor.Mention.toPlain()
+		floor.Content = PlainContent(floor.Content, floor.Mention)
+	}
+}
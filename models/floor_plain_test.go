@@ -0,0 +1,26 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlainContent(t *testing.T) {
+	mentions := Floors{{ID: 20, HoleID: 3, Ranking: 5}}
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"# 标题\n**加粗** 和 *斜体* 和 ~~删除~~", "标题\n加粗 和 斜体 和 删除"},
+		{"> 引用\n- 列表一\n1. 列表二", "引用\n列表一\n列表二"},
+		{"看 [链接](https://example.com)", "看 链接"},
+		{"![猫猫](https://example.com/cat.png) ![](https://example.com/a.png) ![](dx_smile)", "[图片：猫猫] [图片] [表情]"},
+		{"公式 $x^2$", "公式 [公式]"},
+		{"##20 说得对 ##21 #3", "树洞3的5楼 说得对 楼层21 树洞3"},
+		{"```\ncode\n```\n\n\n\n结束", "code\n\n结束"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, PlainContent(test.content, mentions), test.content)
+	}
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/goccy/go-json"
+
+	"treehole_next/config"
+	"treehole_next/utils"
+)
+
+const FloorTranslationCacheExpire = 7 * 24 * time.Hour
+
+var translationClient = http.Client{Timeout: 10 * time.Second, Transport: utils.TracingTransport{}}
+
+// cachedTranslation is a translation of floor content of the hash, stale once the floor is modified
+type cachedTranslation struct {
+	ContentHash string `json:"content_hash"`
+	Content     string `json:"content"`
+}
+
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// Translate returns the content of floor translated to lang, cached per floor and language until the floor is modified
+func (floor *Floor) Translate(ctx context.Context, lang string) (string, error) {
+	cacheKey := fmt.Sprintf("floor_translation_%d_%s", floor.ID, lang)
+	hash := contentHash(floor.Content)
+	var cached cachedTranslation
+	if utils.GetCache(cacheKey, &cached) && cached.ContentHash == hash {
+		return cached.Content, nil
+	}
+
+	content, err := translate(ctx, floor.Content, lang)
+	if err != nil {
+		return "", err
+	}
+	return content, utils.SetCache(cacheKey, cachedTranslation{ContentHash: hash, Content: content}, FloorTranslationCacheExpire)
+}
+
+// translate calls the translation backend, see config.TranslationUrl
+func translate(ctx context.Context, text, lang string) (string, error) {
+	data, err := json.Marshal(map[string]string{"text": text, "target": lang})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.Config.TranslationUrl, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := translationClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("translation server response failed: %s", res.Status)
+	}
+
+	data, err = io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	var response struct {
+		Text string `json:"text"`
+	}
+	err = json.Unmarshal(data, &response)
+	if err != nil {
+		return "", err
+	}
+	return response.Text, nil
+}
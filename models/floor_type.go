@@ -0,0 +1,75 @@
+package models
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"treehole_next/config"
+)
+
+// types of floors, see Floor.Type
+const (
+	// posted by users
+	FloorTypeUser = "user"
+	// inserted by the backend, e.g. notes of moving or merging holes
+	FloorTypeSystem = "system"
+	// posted with API keys, e.g. answers of bots
+	FloorTypeBot = "bot"
+)
+
+// SystemFloorAnonyname is the anonyname of floors posted by the system, see CreateSystemFloor
+const SystemFloorAnonyname = "系统消息"
+
+// IsNumbered tells if frontends show the number of the floor, configured by type
+func (floor *Floor) IsNumbered() bool {
+	floorType := floor.Type
+	if floorType == "" {
+		floorType = FloorTypeUser
+	}
+	return !slices.Contains(config.Config.FloorUnnumberedTypes, floorType)
+}
+
+// Likeable tells if the floor can be liked, likes of machine floors are not counted
+func (floor *Floor) Likeable() bool {
+	return floor.Type == "" || floor.Type == FloorTypeUser
+}
+
+// FloorTypeOf returns the type of floors posted in the request, FloorTypeBot if authenticated by an API key
+func FloorTypeOf(c *fiber.Ctx) string {
+	if GetAPIKey(c) != nil {
+		return FloorTypeBot
+	}
+	return FloorTypeUser
+}
+
+// CreateSystemFloor appends a floor posted by the system, e.g. notes of moderation, to the hole.
+// The floor has no poster, no sensitive check and no notification, the caller should update caches and the index
+func CreateSystemFloor(tx *gorm.DB, hole *Hole, content string) (*Floor, error) {
+	return createMachineFloor(tx, hole, FloorTypeSystem, SystemFloorAnonyname, content)
+}
+
+// createMachineFloor appends a floor without poster of floorType to the hole
+func createMachineFloor(tx *gorm.DB, hole *Hole, floorType, anonyname, content string) (*Floor, error) {
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(hole, hole.ID).Error
+	if err != nil {
+		return nil, err
+	}
+	hole.Reply++
+	floor := Floor{
+		HoleID:    hole.ID,
+		Content:   content,
+		Anonyname: anonyname,
+		Ranking:   hole.Reply,
+		Type:      floorType,
+	}
+	if floorType == FloorTypeSystem {
+		floor.SpecialTag = "树洞管理团队"
+	}
+	err = tx.Omit(clause.Associations).Create(&floor).Error
+	if err != nil {
+		return nil, err
+	}
+	return &floor, tx.Model(hole).Omit(clause.Associations).Select("Reply").Updates(hole).Error
+}
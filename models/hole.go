@@ -1,14 +1,18 @@
 package models
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/goccy/go-json"
 	"golang.org/x/exp/maps"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
 	"golang.org/x/exp/slices"
+	"golang.org/x/sync/singleflight"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"gorm.io/plugin/dbresolver"
@@ -21,7 +25,7 @@ type Hole struct {
 	/// saved fields
 	ID        int            `json:"id" gorm:"primaryKey"`
 	CreatedAt time.Time      `json:"time_created" gorm:"not null;index:idx_hole_div_cre,priority:2,sort:desc"`
-	UpdatedAt time.Time      `json:"time_updated" gorm:"not null;index:idx_hole_div_upd,priority:2,sort:desc"`
+	UpdatedAt time.Time      `json:"time_updated" gorm:"not null;index:idx_hole_div_upd,priority:2,sort:desc;index:idx_hole_user_upd,priority:2,sort:desc"`
 	DeletedAt gorm.DeletedAt `json:"time_deleted,omitempty" gorm:"index"`
 
 	/// base info
@@ -32,9 +36,12 @@ type Hole struct {
 	// 回复量（即该洞下 floor 的数量 - 1）
 	Reply int `json:"reply" gorm:"not null;default:0"`
 
-	// 是否隐藏，隐藏的洞用户不可见，管理员可见
+	// 是否隐藏，隐藏的洞用户不可见，管理员可见；与 HiddenState 同步，仅 visible 时为 false
 	Hidden bool `json:"hidden" gorm:"not null;default:false"`
 
+	// 隐藏状态，see HoleVisible, HoleHiddenByAuthor, HoleHiddenByModerator, HolePendingReview
+	HiddenState string `json:"hidden_state" gorm:"size:32;not null;default:visible"`
+
 	// 锁定帖子，如果锁定则非管理员无法发帖，也无法修改已有发帖
 	Locked bool `json:"locked" gorm:"not null;default:false"`
 
@@ -42,13 +49,25 @@ type Hole struct {
 
 	NoPurge bool `json:"no_purge" gorm:"not null;default:false"`
 
+	// preserved for compliance, floors are not purged nor deleted by users, see SetLegalHold. Admins only
+	LegalHold bool `json:"legal_hold,omitempty" gorm:"not null;default:false"`
+
+	// 合并到的洞 id，未合并为 0；被合并的洞隐藏并作为跳转存根保留，see Hole.Merge
+	MergedInto int `json:"merged_into" gorm:"not null;default:0"`
+
+	// SimHash of the first floor when created, 0 if unknown, see FindDuplicateHoles
+	SimHash int64 `json:"-" gorm:"not null;default:0"`
+
 	/// association info, should add foreign key
 
+	// 所属学校，与所属 division 一致，see Tenant
+	TenantID int `json:"tenant_id" gorm:"not null;default:0;index"`
+
 	// 所属 division 的 id
 	DivisionID int `json:"division_id" gorm:"not null;index:idx_hole_div_upd,priority:1;index:idx_hole_div_cre,priority:1"`
 
 	// 洞主 id，管理员不可见
-	UserID int `json:"-" gorm:"not null"`
+	UserID int `json:"-" gorm:"not null;index:idx_hole_user_upd,priority:1"`
 
 	// tag 列表；不超过 10 个
 	Tags Tags `json:"tags" gorm:"many2many:hole_tags;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
@@ -67,6 +86,18 @@ type Hole struct {
 	// 兼容旧版 id
 	HoleID int `json:"hole_id" gorm:"-:all"`
 
+	// near-duplicate recent holes, only returned on creation
+	Duplicates []DuplicateHole `json:"duplicates,omitempty" gorm:"-:all"`
+
+	// ids of tags applied by AutoTagHoles, see HoleTag.Machine
+	MachineTagIDs []int `json:"machine_tag_ids,omitempty" gorm:"-:all"`
+
+	// the current user subscribed the hole for reply notifications, see UserSubscription
+	IsSubscribed bool `json:"is_subscribed" gorm:"-:all"`
+
+	// courses of the curriculum-review service linked to tags, see CourseLink
+	CourseReviews []CourseReview `json:"course_reviews,omitempty" gorm:"-:all"`
+
 	// 返回给前端的楼层列表，包括首楼、尾楼和预加载的前 n 个楼层
 	HoleFloor struct {
 		FirstFloor *Floor `json:"first_floor"` // 首楼
@@ -79,8 +110,29 @@ func (hole *Hole) GetID() int {
 	return hole.ID
 }
 
+// CacheName is keyed by updated_at, so that holes with new floors miss the cache and older entries just expire.
+// Changes not touching updated_at should delete the cache explicitly, see DeleteHoleCache
 func (hole *Hole) CacheName() string {
-	return fmt.Sprintf("hole_%d", hole.ID)
+	return fmt.Sprintf("hole_%d_%d", hole.ID, hole.UpdatedAt.UnixMilli())
+}
+
+// DeleteHoleCache deletes cache of holes by ids, loading updated_at of the holes for cache keys
+func DeleteHoleCache(tx *gorm.DB, holeIDs ...int) error {
+	if len(holeIDs) == 0 {
+		return nil
+	}
+	var holes Holes
+	err := tx.Unscoped().Select("id", "updated_at").Where("id IN ?", holeIDs).Find(&holes).Error
+	if err != nil {
+		return err
+	}
+	for _, hole := range holes {
+		err = utils.DeleteCache(hole.CacheName())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 type Holes []*Hole
@@ -95,7 +147,97 @@ func IsHolesExist(tx *gorm.DB, holeID []int) bool {
 	get hole methods
  *******************/
 
-const HoleCacheExpire = time.Minute * 10
+const (
+	HoleCacheExpire = time.Minute * 10
+
+	// cached holes older than this are still served, but refreshed in background
+	HoleCacheSoftExpire = time.Minute * 8
+)
+
+// holeCache is a cached hole with the time to refresh it in background
+type holeCache struct {
+	Hole      *Hole     `json:"hole"`
+	RefreshAt time.Time `json:"refresh_at"`
+}
+
+// holeCacheGroup deduplicates concurrent rebuilds of the same holes,
+// so that a hot hole is loaded from database once when its cache expires
+var holeCacheGroup singleflight.Group
+
+func setHoleCache(hole *Hole) error {
+	return utils.SetCache(hole.CacheName(), holeCache{
+		Hole:      hole,
+		RefreshAt: time.Now().Add(HoleCacheSoftExpire),
+	}, HoleCacheExpire)
+}
+
+// setHoleCaches caches holes in a single round trip
+func setHoleCaches(holes Holes) error {
+	values := make(map[string]any, len(holes))
+	refreshAt := time.Now().Add(HoleCacheSoftExpire)
+	for _, hole := range holes {
+		values[hole.CacheName()] = holeCache{Hole: hole, RefreshAt: refreshAt}
+	}
+	return utils.SetCaches(values, HoleCacheExpire)
+}
+
+// getHoleCaches loads holes from cache in a single round trip, returns holes not in cache,
+// and holes as loaded from database whose cache should be refreshed in background
+func getHoleCaches(holes Holes) (notInCache Holes, toRefresh Holes) {
+	keys := make([]string, 0, len(holes))
+	for _, hole := range holes {
+		keys = append(keys, hole.CacheName())
+	}
+	now := time.Now()
+	for i, data := range utils.GetCaches(keys) {
+		var cached holeCache
+		if data == nil || json.Unmarshal(data, &cached) != nil || cached.Hole == nil {
+			notInCache = append(notInCache, holes[i])
+			continue
+		}
+		loaded := *holes[i]
+		*holes[i] = *cached.Hole
+		if now.After(cached.RefreshAt) {
+			toRefresh = append(toRefresh, &loaded)
+		}
+	}
+	return notInCache, toRefresh
+}
+
+func holeCacheGroupKey(holes Holes) string {
+	ids := utils.Models2IDSlice(holes)
+	slices.Sort(ids)
+	return fmt.Sprint(ids)
+}
+
+// loadHoleCache rebuilds cache of holes once for concurrent identical requests,
+// the other requests read the rebuilt holes from cache
+func loadHoleCache(holes Holes) error {
+	_, err, shared := holeCacheGroup.Do(holeCacheGroupKey(holes), func() (any, error) {
+		return nil, UpdateHoleCache(holes)
+	})
+	if err != nil || !shared {
+		return err
+	}
+
+	// holes of this request may not be the ones rebuilt
+	notInCache, _ := getHoleCaches(holes)
+	if len(notInCache) > 0 {
+		return UpdateHoleCache(notInCache)
+	}
+	return nil
+}
+
+// refreshHoleCache rebuilds cache of holes in background
+func refreshHoleCache(holes Holes) {
+	holeCacheGroup.DoChan(holeCacheGroupKey(holes), func() (any, error) {
+		err := UpdateHoleCache(holes)
+		if err != nil {
+			log.Err(err).Msg("refresh hole cache failed")
+		}
+		return nil, err
+	})
+}
 
 func loadTags(holes Holes) (err error) {
 	if len(holes) == 0 {
@@ -104,6 +246,7 @@ func loadTags(holes Holes) (err error) {
 	holeIDs := utils.Models2IDSlice(holes)
 	for _, hole := range holes {
 		hole.Tags = Tags{}
+		hole.MachineTagIDs = nil
 	}
 
 	var holeTags HoleTags
@@ -113,10 +256,14 @@ func loadTags(holes Holes) (err error) {
 	}
 
 	mapping := make(map[int][]int)
+	machineTags := make(map[int][]int)
 	tagIDs := make(map[int]bool)
 	for _, holeTag := range holeTags {
 		mapping[holeTag.HoleID] = append(mapping[holeTag.HoleID], holeTag.TagID)
 		tagIDs[holeTag.TagID] = true
+		if holeTag.Machine {
+			machineTags[holeTag.HoleID] = append(machineTags[holeTag.HoleID], holeTag.TagID)
+		}
 	}
 
 	var tags Tags
@@ -137,6 +284,9 @@ func loadTags(holes Holes) (err error) {
 		for _, tagID := range mapping[hole.ID] {
 			if tagMap[tagID] != nil {
 				hole.Tags = append(hole.Tags, tagMap[tagID])
+				if slices.Contains(machineTags[hole.ID], tagID) {
+					hole.MachineTagIDs = append(hole.MachineTagIDs, tagID)
+				}
 			}
 		}
 	}
@@ -233,24 +383,17 @@ func (hole *Hole) Preprocess(c *fiber.Ctx) error {
 }
 
 func (holes Holes) Preprocess(c *fiber.Ctx) error {
-	notInCache := make(Holes, 0, len(holes))
-
-	for _, hole := range holes {
-		cachedHole := new(Hole)
-		ok := utils.GetCache(hole.CacheName(), &cachedHole)
-		if !ok {
-			notInCache = append(notInCache, hole)
-		} else {
-			*hole = *cachedHole
-		}
-	}
+	notInCache, toRefresh := getHoleCaches(holes)
 
 	if len(notInCache) > 0 {
-		err := UpdateHoleCache(notInCache)
+		err := loadHoleCache(notInCache)
 		if err != nil {
 			return err
 		}
 	}
+	if len(toRefresh) > 0 {
+		go refreshHoleCache(toRefresh)
+	}
 
 	// preprocess floors after load from hole cache
 	floors := make(Floors, 0)
@@ -268,6 +411,26 @@ func (holes Holes) Preprocess(c *fiber.Ctx) error {
 		return err
 	}
 
+	err = holes.loadSubscriptions(c)
+	if err != nil {
+		return err
+	}
+
+	err = holes.loadCourseReviews()
+	if err != nil {
+		return err
+	}
+
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	if !user.IsAdmin {
+		for _, hole := range holes {
+			hole.LegalHold = false
+		}
+	}
+
 	//user, err := GetUser(c)
 	//if err != nil {
 	//	return err
@@ -298,13 +461,7 @@ func UpdateHoleCache(holes Holes) (err error) {
 		return
 	}
 
-	for _, hole := range holes {
-		err = utils.SetCache(hole.CacheName(), hole, HoleCacheExpire)
-		if err != nil {
-			return
-		}
-	}
-	return
+	return setHoleCaches(holes)
 }
 
 func MakeHoleQuerySet(c *fiber.Ctx) (*gorm.DB, error) {
@@ -312,10 +469,11 @@ func MakeHoleQuerySet(c *fiber.Ctx) (*gorm.DB, error) {
 	if err != nil {
 		return nil, err
 	}
+	querySet := ReadDB(c).Where("hole.tenant_id = ?", GetTenant(c).ID)
 	if user.IsAdmin {
-		return DB.Unscoped(), nil
+		return querySet.Unscoped(), nil
 	} else {
-		return DB.Where("hidden = ?", false), nil
+		return WhereVisibleDivisions(querySet.Where("hidden = ?", false), user)
 		//userID, err := common.GetUserID(c)
 		//if err != nil {
 		//	return nil, err
@@ -332,14 +490,19 @@ func (holes Holes) MakeQuerySet(offset common.CustomTime, size int, order string
 		return nil, err
 	}
 	//querySet.Where("hole.hidden = ?", false)
+	return holes.Paginate(querySet, offset, size, order), nil
+}
+
+// Paginate orders holes by updated_at, or created_at if order is time_created, and limits to size holes before offset
+func (holes Holes) Paginate(querySet *gorm.DB, offset common.CustomTime, size int, order string) *gorm.DB {
 	if order == "time_created" || order == "created_at" {
 		return querySet.
 			Where("hole.created_at < ?", offset.Time).
-			Order("hole.created_at desc").Limit(size), nil
+			Order("hole.created_at desc").Limit(size)
 	} else {
 		return querySet.
 			Where("hole.updated_at < ?", offset.Time).
-			Order("hole.updated_at desc").Limit(size), nil
+			Order("hole.updated_at desc").Limit(size)
 	}
 }
 
@@ -352,6 +515,15 @@ func (holes Holes) MakeQuerySet(offset common.CustomTime, size int, order string
 // if Floors is not empty, set HoleFloor.Floors from Floors, in case loading from database
 // if Floors is empty, set HoleFloor.Floors from HoleFloor.Floors, in case loading from cache
 func (hole *Hole) SetHoleFloor() {
+	if len(hole.Floors) == 0 && len(hole.HoleFloor.Floors) != 0 {
+		// restore Floors as loaded from database, the last floor is not prefetched if there are more floors
+		hole.Floors = hole.HoleFloor.Floors
+		lastFloor := hole.HoleFloor.LastFloor
+		if lastFloor != nil && lastFloor.ID != hole.Floors[len(hole.Floors)-1].ID {
+			hole.Floors = append(slices.Clip(hole.Floors), lastFloor)
+		}
+	}
+
 	if len(hole.Floors) != 0 {
 		holeFloorSize := len(hole.Floors)
 
@@ -362,12 +534,6 @@ func (hole *Hole) SetHoleFloor() {
 		} else {
 			hole.HoleFloor.Floors = hole.Floors[0 : holeFloorSize-1]
 		}
-	} else if len(hole.HoleFloor.Floors) != 0 {
-		holeFloorSize := len(hole.Floors)
-
-		hole.HoleFloor.FirstFloor = hole.HoleFloor.Floors[0]
-		hole.HoleFloor.LastFloor = hole.HoleFloor.Floors[holeFloorSize-1]
-		hole.Floors = hole.HoleFloor.Floors
 	}
 
 	//for _, floor := range hole.HoleFloor.Floors {
@@ -381,13 +547,57 @@ func (hole *Hole) SetHoleFloor() {
 }
 
 func (hole *Hole) Create(tx *gorm.DB, user *User, tagNames []string, c *fiber.Ctx) (err error) {
+	// holes belong to the tenant of their division
+	hole.TenantID = GetTenant(c).ID
+	var division Division
+	err = tx.Where("tenant_id = ?", hole.TenantID).Take(&division, hole.DivisionID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.NewError(utils.ErrCodeDivisionNotFound, "分区不存在")
+		}
+		return err
+	}
+	if division.Status != DivisionStatusActive {
+		return utils.NewError(utils.ErrCodeDivisionArchived, "该分区已归档，无法发帖")
+	}
+	err = division.ValidateTags(tagNames)
+	if err != nil {
+		return err
+	}
+	err = user.CheckLinkPrivilege(hole.Floors[0].Content)
+	if err != nil {
+		return err
+	}
+	spamVerdict, err := CheckSpam(c.UserContext(), user, division.ID, hole.Floors[0], ChallengeSolved(c, user.ID))
+	if err != nil {
+		return err
+	}
+	err = CheckLinkRules(hole.Floors[0])
+	if err != nil {
+		return err
+	}
+
+	// flagged by the sensitive check in CreateHole
+	if hole.Floors[0].IsSensitive && user.Trusted(TrustedBypassSensitive) {
+		hole.Floors[0].IsSensitive = false
+	}
+
+	// listed to the author only until moderators make it visible
+	if NeedsReview(user, division.ID, spamVerdict) {
+		hole.SetHiddenState(HolePendingReview)
+	}
+
 	// Create hole.Tags, in different sql session
-	hole.Tags, err = FindOrCreateTags(tx, user, tagNames)
+	// tags of moderators and trusted users are approved
+	pending := division.TagReview && !user.Can(PermissionReviewTag, division.ID) && !user.Trusted(TrustedBypassReview)
+	hole.Tags, err = FindOrCreateTags(tx, user, hole.TenantID, tagNames, pending)
 	if err != nil {
 		return err
 	}
 
 	var firstFloor = hole.Floors[0]
+	firstFloor.Type = FloorTypeOf(c)
+	hole.SimHash = int64(utils.SimHash(firstFloor.Content))
 
 	// Find floor.Mentions, in different sql session
 	firstFloor.Mention, err = LoadFloorMentions(tx, firstFloor.Content)
@@ -419,12 +629,19 @@ func (hole *Hole) Create(tx *gorm.DB, user *User, tagNames []string, c *fiber.Ct
 		}
 
 		// Create floor, set floor_mention association in AfterCreate hook
-		return tx.Omit(clause.Associations).Create(&firstFloor).Error
+		err = tx.Omit(clause.Associations).Create(&firstFloor).Error
+		if err != nil {
+			return err
+		}
+		return recordPost(tx, hole.UserID, true, time.Now())
 	})
 	// transaction commit here
 	if err != nil {
 		return err
 	}
+	spamVerdict.ReportFloor(firstFloor)
+	TriggerBadges(hole.UserID, BadgeEventPost)
+	ReviewFloorImages(firstFloor)
 
 	// set hole.HoleFloor
 	hole.SetHoleFloor()
@@ -437,11 +654,12 @@ func (hole *Hole) Create(tx *gorm.DB, user *User, tagNames []string, c *fiber.Ct
 
 	// index
 	if !firstFloor.Sensitive() {
-		go FloorIndex(FloorModel{
+		floorModel := FloorModel{
 			ID:        firstFloor.ID,
 			UpdatedAt: time.Now(),
 			Content:   firstFloor.Content,
-		})
+		}
+		utils.Go(func() { FloorIndex(floorModel) })
 	} else {
 		firstFloor.SendSensitive(tx)
 		// firstFloor.Content = ""
@@ -450,7 +668,7 @@ func (hole *Hole) Create(tx *gorm.DB, user *User, tagNames []string, c *fiber.Ct
 	hole.HoleHook()
 
 	// store into cache
-	return utils.SetCache(hole.CacheName(), hole, HoleCacheExpire)
+	return setHoleCache(hole)
 }
 
 func (hole *Hole) AfterCreate(_ *gorm.DB) (err error) {
@@ -485,18 +703,22 @@ func (hole *Hole) HoleHook() {
 	}
 
 	if hole.DivisionID == 4 {
-		go utils.NotifyQQ(&utils.BotMessage{
-			MessageType: utils.MessageTypePrivate,
-			UserID:      config.Config.QQBotUserID,
-			Message:     notifyMessage,
+		utils.Go(func() {
+			utils.NotifyQQ(&utils.BotMessage{
+				MessageType: utils.MessageTypePrivate,
+				UserID:      config.Config.QQBotUserID,
+				Message:     notifyMessage,
+			})
 		})
 	}
 	for _, tag := range hole.Tags {
 		if tag != nil && tag.Name == "@物理大神" {
-			go utils.NotifyQQ(&utils.BotMessage{
-				MessageType: utils.MessageTypeGroup,
-				GroupID:     config.Config.QQBotGroupID,
-				Message:     notifyMessage,
+			utils.Go(func() {
+				utils.NotifyQQ(&utils.BotMessage{
+					MessageType: utils.MessageTypeGroup,
+					GroupID:     config.Config.QQBotGroupID,
+					Message:     notifyMessage,
+				})
 			})
 		}
 	}
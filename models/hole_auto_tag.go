@@ -0,0 +1,85 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"treehole_next/utils"
+)
+
+// AutoTagResult is tags suggested for an untagged hole, see AutoTagHoles
+type AutoTagResult struct {
+	HoleID      int             `json:"hole_id"`
+	Suggestions []TagSuggestion `json:"suggestions"`
+	// suggestions applied as machine tags, see HoleTag.Machine
+	Applied Tags `json:"applied"`
+}
+
+// AutoTagHoles suggests tags for at most size visible holes without tags created since since, the latest first.
+// If maxTags is positive, at most maxTags suggestions scored at least minScore are applied as machine tags.
+func AutoTagHoles(since time.Time, size int, minScore float64, maxTags int) ([]AutoTagResult, error) {
+	var holes Holes
+	err := DB.Select("id", "tenant_id").
+		Where("hidden = ? AND created_at >= ? AND id NOT IN (?)", false, since, DB.Model(&HoleTag{}).Select("hole_id")).
+		Order("id DESC").Limit(size).Find(&holes).Error
+	if err != nil {
+		return nil, err
+	}
+	results := make([]AutoTagResult, 0, len(holes))
+	if len(holes) == 0 {
+		return results, nil
+	}
+
+	var floors []Floor
+	err = DB.Select("hole_id", "content").Where("hole_id IN ? AND ranking = 0", utils.Models2IDSlice(holes)).Find(&floors).Error
+	if err != nil {
+		return nil, err
+	}
+	contents := make(map[int]string, len(floors))
+	for _, floor := range floors {
+		contents[floor.HoleID] = floor.Content
+	}
+
+	// admin only tags are never suggested to the bot
+	bot := &User{}
+	for _, hole := range holes {
+		suggestions, err := SuggestTags(bot, hole.TenantID, contents[hole.ID], nil, TagSuggestionsMaxSize)
+		if err != nil {
+			return nil, err
+		}
+		result := AutoTagResult{HoleID: hole.ID, Suggestions: suggestions, Applied: Tags{}}
+		for _, suggestion := range suggestions {
+			if len(result.Applied) < maxTags && suggestion.Score >= minScore {
+				result.Applied = append(result.Applied, suggestion.Tag)
+			}
+		}
+		if len(result.Applied) > 0 {
+			err = applyMachineTags(hole, result.Applied)
+			if err != nil {
+				return nil, err
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func applyMachineTags(hole *Hole, tags Tags) error {
+	holeTags := make(HoleTags, 0, len(tags))
+	for _, tag := range tags {
+		holeTags = append(holeTags, &HoleTag{HoleID: hole.ID, TagID: tag.ID, Machine: true})
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&holeTags).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&tags).Update("temperature", gorm.Expr("temperature + 1")).Error
+	})
+	if err != nil {
+		return err
+	}
+	return DeleteHoleCache(DB, hole.ID)
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"treehole_next/utils"
+)
+
+const (
+	// recent holes in the same division are compared
+	duplicateWindow  = 7 * 24 * time.Hour
+	duplicateScanMax = 2000
+	// holes of SimHash distance within are near-duplicates, unrelated contents are about 32 bits apart
+	duplicateMaxDistance = 12
+	duplicateMaxSize     = 5
+	duplicatePreviewSize = 100
+)
+
+// DuplicateHole is a recent hole similar to a new one
+type DuplicateHole struct {
+	HoleID int `json:"hole_id"`
+	// preview of the first floor, empty if it is sensitive or deleted
+	Preview string `json:"preview"`
+	// 1 for identical contents
+	Similarity float64 `json:"similarity"`
+}
+
+// FindDuplicateHoles finds recent holes in the division of hole whose first floors are
+// similar to the first floor of hole by SimHash, the most similar first
+func FindDuplicateHoles(tx *gorm.DB, hole *Hole) ([]DuplicateHole, error) {
+	if hole.SimHash == 0 {
+		return nil, nil
+	}
+
+	var recentHoles []struct {
+		ID      int
+		SimHash int64
+	}
+	err := tx.Model(&Hole{}).Select("id", "sim_hash").
+		Where("division_id = ? AND id <> ? AND hidden = ? AND sim_hash <> 0 AND created_at >= ?",
+			hole.DivisionID, hole.ID, false, time.Now().Add(-duplicateWindow)).
+		Order("created_at desc").Limit(duplicateScanMax).Scan(&recentHoles).Error
+	if err != nil {
+		return nil, err
+	}
+
+	distances := make(map[int]int)
+	var holeIDs []int
+	for _, recentHole := range recentHoles {
+		distance := utils.SimHashDistance(uint64(hole.SimHash), uint64(recentHole.SimHash))
+		if distance <= duplicateMaxDistance {
+			distances[recentHole.ID] = distance
+			holeIDs = append(holeIDs, recentHole.ID)
+		}
+	}
+	if len(holeIDs) == 0 {
+		return nil, nil
+	}
+	sort.SliceStable(holeIDs, func(i, j int) bool {
+		return distances[holeIDs[i]] < distances[holeIDs[j]]
+	})
+	holeIDs = holeIDs[:min(len(holeIDs), duplicateMaxSize)]
+
+	var firstFloors Floors
+	err = tx.Where("hole_id IN ? AND ranking = 0", holeIDs).Find(&firstFloors).Error
+	if err != nil {
+		return nil, err
+	}
+	previews := make(map[int]string, len(firstFloors))
+	for _, floor := range firstFloors {
+		if floor.Deleted || floor.Sensitive() {
+			continue
+		}
+		content := floor.Content
+		if floor.Fold != "" {
+			content = floor.Fold
+		}
+		previews[floor.HoleID] = utils.StripContent(content, duplicatePreviewSize)
+	}
+
+	duplicates := make([]DuplicateHole, 0, len(holeIDs))
+	for _, holeID := range holeIDs {
+		duplicates = append(duplicates, DuplicateHole{
+			HoleID:     holeID,
+			Preview:    previews[holeID],
+			Similarity: 1 - float64(distances[holeID])/64,
+		})
+	}
+	return duplicates, nil
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"gorm.io/gorm"
+
+	"treehole_next/config"
+	"treehole_next/utils"
+)
+
+// hidden states of holes, Hole.Hidden is true unless visible
+const (
+	HoleVisible = "visible"
+	// hidden by the author, the author can still get it and make it visible again
+	HoleHiddenByAuthor = "hidden_by_author"
+	// hidden by moderators, only moderators can get it or make it visible
+	HoleHiddenByModerator = "hidden_by_moderator"
+	// waiting for moderators, the author can still get it and it is listed in their holes
+	HolePendingReview = "pending_review"
+)
+
+// holeAuthorStates are the states the author can get the hole in
+var holeAuthorStates = []string{HoleVisible, HoleHiddenByAuthor, HolePendingReview}
+
+// SetHiddenState sets HiddenState and keeps Hidden in sync for queries
+func (hole *Hole) SetHiddenState(state string) {
+	hole.HiddenState = state
+	hole.Hidden = state != HoleVisible
+}
+
+// CheckHiddenState returns an error if the user can't change the hidden state of the hole to state.
+// Moderators can change any state, the author can only hide the hole or make it visible again if hidden by the author.
+func (hole *Hole) CheckHiddenState(user *User, state string) error {
+	if user.Can(PermissionModerateHole, hole.DivisionID) {
+		return nil
+	}
+	if user.ID != hole.UserID {
+		return utils.NewError(utils.ErrCodePermissionDenied, "无权修改帖子状态")
+	}
+	if hole.HiddenState != HoleVisible && hole.HiddenState != HoleHiddenByAuthor {
+		return utils.NewError(utils.ErrCodeUnhideNotAllowed, "帖子已被管理员隐藏或正在审核，无法修改")
+	}
+	if state != HoleVisible && state != HoleHiddenByAuthor {
+		return utils.NewError(utils.ErrCodeAdminOnly, "只能隐藏或恢复自己的帖子")
+	}
+	return nil
+}
+
+// NeedsReview tells if a new hole of the user waits for moderators as pending_review, i.e. its first floor
+// is reported by the spam check, or the user is not trusted if config.HoleReviewUntrusted. Holes of moderators never wait.
+func NeedsReview(user *User, divisionID int, verdict *SpamVerdict) bool {
+	if user.Can(PermissionModerateHole, divisionID) {
+		return false
+	}
+	if verdict != nil && verdict.Report {
+		return true
+	}
+	return config.Config.HoleReviewUntrusted && config.Config.TrustedMinReputation > 0 && !user.Trusted(TrustedBypassReview)
+}
+
+// AuthorHoleScope selects holes of the author in states they can get, see GetHole
+func AuthorHoleScope(userID int) func(tx *gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("hole.user_id = ? AND hole.hidden_state IN ?", userID, holeAuthorStates)
+	}
+}
@@ -0,0 +1,230 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+
+	"treehole_next/utils"
+)
+
+// Merge moves floors, anonynames, favorites and subscriptions of the hole fromID into the hole, e.g. a duplicate
+// question. Floors are appended in order and marked with Floor.MergedFrom, the hole fromID is hidden and kept as
+// a redirect stub with Hole.MergedInto set. Returns the stub, the caller should update caches and the index
+func (hole *Hole) Merge(fromID, adminID int) (*Hole, error) {
+	if fromID == hole.ID {
+		return nil, utils.NewError(utils.ErrCodeInvalidRequest, "不能将洞合并到自身")
+	}
+	from := Hole{ID: fromID}
+	// users who liked floors moved, whose cached likes in the hole miss the floors
+	var likeUserIDs []int
+	err := DB.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		// lock in order of id to avoid deadlocks with concurrent merges
+		first, second := &from, hole
+		if hole.ID < fromID {
+			first, second = hole, &from
+		}
+		for _, h := range []*Hole{first, second} {
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(h, h.ID).Error
+			if err != nil {
+				return err
+			}
+		}
+		if from.TenantID != hole.TenantID {
+			return gorm.ErrRecordNotFound
+		}
+		if from.MergedInto != 0 || hole.MergedInto != 0 {
+			return utils.NewError(utils.ErrCodeInvalidRequest, "该洞已被合并")
+		}
+		if hole.Hidden {
+			return utils.NewError(utils.ErrCodeInvalidRequest, "不能合并到已隐藏的洞")
+		}
+
+		err := mergeAnonynames(tx, fromID, hole.ID)
+		if err != nil {
+			return err
+		}
+
+		// append floors after the last floor, rankings of the hole fromID start from 0
+		var maxRanking int
+		err = tx.Model(&Floor{}).Select("COALESCE(MAX(ranking), -1)").Where("hole_id = ?", fromID).Scan(&maxRanking).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&FloorLike{}).
+			Where("floor_id IN (?)", tx.Model(&Floor{}).Select("id").Where("hole_id = ?", fromID)).
+			Distinct().Pluck("user_id", &likeUserIDs).Error
+		if err != nil {
+			return err
+		}
+		offset := hole.Reply + 1
+		err = tx.Model(&Floor{}).Where("hole_id = ?", fromID).Updates(map[string]any{
+			"hole_id":     hole.ID,
+			"ranking":     gorm.Expr("ranking + ?", offset),
+			"merged_from": fromID,
+		}).Error
+		if err != nil {
+			return err
+		}
+		hole.Reply += maxRanking + 1
+		err = tx.Model(hole).Omit(clause.Associations).Select("Reply").Updates(hole).Error
+		if err != nil {
+			return err
+		}
+
+		err = mergeFavorites(tx, fromID, hole.ID)
+		if err != nil {
+			return err
+		}
+		err = mergeSubscriptions(tx, fromID, hole.ID)
+		if err != nil {
+			return err
+		}
+
+		from.MergedInto = hole.ID
+		from.SetHiddenState(HoleHiddenByModerator)
+		from.Locked = true
+		from.Reply = 0
+		err = tx.Model(&from).Omit(clause.Associations).
+			Select("MergedInto", "Hidden", "HiddenState", "Locked", "Reply").Updates(&from).Error
+		if err != nil {
+			return err
+		}
+
+		_, err = CreateSystemFloor(tx, hole, fmt.Sprintf("#%d 已由管理员合并至本洞，以下楼层来自原洞", fromID))
+		if err != nil {
+			return err
+		}
+
+		CreateAdminLog(tx, AdminLogTypeMergeHole, adminID, struct {
+			HoleID     int `json:"hole_id"`
+			FromHoleID int `json:"from_hole_id"`
+			Offset     int `json:"offset"`
+		}{
+			HoleID:     hole.ID,
+			FromHoleID: fromID,
+			Offset:     offset,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	deleteUserLikesCaches(likeUserIDs, []int{fromID, hole.ID})
+	return &from, nil
+}
+
+// mergeAnonynames keeps the anonyname of users who posted in both holes, and renames users whose anonyname
+// is taken in the hole toID. Floors moved are renamed accordingly
+func mergeAnonynames(tx *gorm.DB, fromID, toID int) error {
+	var fromMappings, toMappings []AnonynameMapping
+	err := tx.Where("hole_id = ?", fromID).Find(&fromMappings).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("hole_id = ?", toID).Find(&toMappings).Error
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(toMappings))
+	nameOfUser := make(map[int]string, len(toMappings))
+	for _, mapping := range toMappings {
+		names = append(names, mapping.Anonyname)
+		nameOfUser[mapping.UserID] = mapping.Anonyname
+	}
+	sort.Strings(names)
+
+	for _, mapping := range fromMappings {
+		name, ok := nameOfUser[mapping.UserID]
+		if !ok {
+			name = mapping.Anonyname
+			if index := sort.SearchStrings(names, name); index < len(names) && names[index] == name {
+				name = utils.GenerateName(names)
+			}
+			err = tx.Create(&AnonynameMapping{HoleID: toID, UserID: mapping.UserID, Anonyname: name}).Error
+			if err != nil {
+				return err
+			}
+			names = append(names, name)
+			sort.Strings(names)
+		}
+		if name != mapping.Anonyname {
+			err = tx.Model(&Floor{}).Where("hole_id = ? AND user_id = ?", fromID, mapping.UserID).
+				Update("anonyname", name).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Where("hole_id = ?", fromID).Delete(&AnonynameMapping{}).Error
+}
+
+// mergeFavorites moves favorites to the hole toID, keeping counts of favorite groups with both holes
+func mergeFavorites(tx *gorm.DB, fromID, toID int) error {
+	var favorites UserFavorites
+	err := tx.Where("hole_id = ?", fromID).Find(&favorites).Error
+	if err != nil {
+		return err
+	}
+	fromUsers, err := countFavoriteUsers(tx, fromID)
+	if err != nil {
+		return err
+	}
+	toUsers, err := countFavoriteUsers(tx, toID)
+	if err != nil {
+		return err
+	}
+	for _, favorite := range favorites {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&UserFavorite{
+			UserID:          favorite.UserID,
+			FavoriteGroupID: favorite.FavoriteGroupID,
+			HoleID:          toID,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			err = tx.Model(&FavoriteGroup{}).
+				Where("user_id = ? AND favorite_group_id = ?", favorite.UserID, favorite.FavoriteGroupID).
+				Update("count", gorm.Expr("count - 1")).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err = tx.Where("hole_id = ?", fromID).Delete(&UserFavorite{}).Error
+	if err != nil {
+		return err
+	}
+	return mergeFavoritesReceived(tx, fromID, toID, fromUsers, toUsers)
+}
+
+// mergeSubscriptions moves subscriptions to the hole toID
+func mergeSubscriptions(tx *gorm.DB, fromID, toID int) error {
+	var subscriptions UserSubscriptions
+	err := tx.Where("hole_id = ?", fromID).Find(&subscriptions).Error
+	if err != nil {
+		return err
+	}
+	for _, subscription := range subscriptions {
+		err = tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&UserSubscription{UserID: subscription.UserID, HoleID: toID}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Where("hole_id = ?", fromID).Delete(&UserSubscription{}).Error
+}
+
+// MergedHole returns the redirect stub of a merged hole, ErrRecordNotFound if the hole is not merged
+func MergedHole(tx *gorm.DB, holeID, tenantID int) (*Hole, error) {
+	var hole Hole
+	err := tx.Where("tenant_id = ? AND merged_into <> 0", tenantID).Take(&hole, holeID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &hole, nil
+}
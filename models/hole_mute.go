@@ -0,0 +1,87 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"treehole_next/config"
+	"treehole_next/utils"
+)
+
+// HoleMute stops reply and subscription notifications of a hole to the user, mentions are still sent
+type HoleMute struct {
+	UserID    int       `json:"user_id" gorm:"primaryKey"`
+	HoleID    int       `json:"hole_id" gorm:"primaryKey;index"`
+	CreatedAt time.Time `json:"time_created"`
+}
+
+func (HoleMute) TableName() string {
+	return "hole_mute"
+}
+
+func MuteHole(tx *gorm.DB, userID, holeID int) error {
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&HoleMute{UserID: userID, HoleID: holeID}).Error
+}
+
+func UnmuteHole(tx *gorm.DB, userID, holeID int) error {
+	return tx.Delete(&HoleMute{UserID: userID, HoleID: holeID}).Error
+}
+
+func holeAutoMuteKey(holeID int) string {
+	return fmt.Sprintf("hole_auto_mute_%d", holeID)
+}
+
+// IsHoleAutoMuted returns true if notifications of the hole are muted for all users, see checkHoleAutoMute
+func IsHoleAutoMuted(holeID int) bool {
+	var muted bool
+	return utils.GetCache(holeAutoMuteKey(holeID), &muted) && muted
+}
+
+// checkHoleAutoMute mutes notifications of a hot hole for HOLE_AUTO_MUTE_DURATION
+// when it gets HOLE_AUTO_MUTE_FLOORS floors in the last hour
+func checkHoleAutoMute(tx *gorm.DB, holeID int) {
+	limit := config.Config.HoleAutoMuteFloors
+	if limit <= 0 || IsHoleAutoMuted(holeID) {
+		return
+	}
+	var count int64
+	err := tx.Model(&Floor{}).Where("hole_id = ? AND created_at > ?", holeID, time.Now().Add(-time.Hour)).
+		Count(&count).Error
+	if err != nil {
+		log.Err(err).Str("model", "HoleMute").Msg("count floors failed")
+		return
+	}
+	if count < int64(limit) {
+		return
+	}
+	err = utils.SetCache(holeAutoMuteKey(holeID), true, config.Config.HoleAutoMuteDuration)
+	if err != nil {
+		log.Err(err).Str("model", "HoleMute").Msg("set auto mute failed")
+		return
+	}
+	log.Info().Int("hole_id", holeID).Int64("floors", count).Msg("hole notifications auto muted")
+}
+
+// removeMutedRecipients removes users who muted the hole, or all users if the hole is auto muted
+func removeMutedRecipients(tx *gorm.DB, holeID int, userIDs []int) []int {
+	if len(userIDs) == 0 {
+		return userIDs
+	}
+	if IsHoleAutoMuted(holeID) {
+		return nil
+	}
+	var mutedIDs []int
+	err := tx.Model(&HoleMute{}).Where("hole_id = ? AND user_id IN ?", holeID, userIDs).Pluck("user_id", &mutedIDs).Error
+	if err != nil {
+		log.Err(err).Str("model", "HoleMute").Msg("load muted users failed")
+		return userIDs
+	}
+	return slices.DeleteFunc(userIDs, func(userID int) bool {
+		return slices.Contains(mutedIDs, userID)
+	})
+}
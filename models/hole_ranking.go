@@ -0,0 +1,203 @@
+package models
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"treehole_next/utils"
+)
+
+const (
+	// holes active within the window are ranked
+	HotHoleWindow = 7 * 24 * time.Hour
+	// holes kept per division
+	hotHoleMaxSize = 500
+
+	hotHoleKeyPrefix = "hot_holes_"
+)
+
+// hotness weights, a reply from a new user counts more than another floor of the same user
+const (
+	hotFloorWeight   = 1.0
+	hotReplierWeight = 2.0
+	hotLikeWeight    = 0.5
+	hotViewWeight    = 0.01
+	// score decays by (hours since created + 2) ^ gravity
+	hotGravity = 1.5
+)
+
+// HotHoleStats is the activity of a hole within HotHoleWindow
+type HotHoleStats struct {
+	HoleID     int
+	DivisionID int
+	CreatedAt  time.Time
+	View       int
+	Floors     int
+	Repliers   int
+	Likes      int
+}
+
+// HotScore is the hotness of a hole at now
+func (stats *HotHoleStats) HotScore(now time.Time) float64 {
+	activity := hotFloorWeight*float64(stats.Floors) +
+		hotReplierWeight*float64(stats.Repliers) +
+		hotLikeWeight*float64(stats.Likes) +
+		hotViewWeight*float64(stats.View)
+	hours := max(now.Sub(stats.CreatedAt).Hours(), 0)
+	return activity / math.Pow(hours+2, hotGravity)
+}
+
+// HotHole is a ranked hole
+type HotHole struct {
+	HoleID int
+	Score  float64
+}
+
+// hotHoleStore keeps ranked hole ids per division, division 0 for all divisions,
+// in redis sorted sets if configured, otherwise in memory
+type hotHoleStore interface {
+	// Replace replaces all rankings
+	Replace(ctx context.Context, rankings map[int][]HotHole) error
+	// Range returns hole ids of a division from the hottest
+	Range(ctx context.Context, divisionID, offset, size int) ([]int, error)
+}
+
+var (
+	hotHoleStoreOnce sync.Once
+	hotHoleStoreImpl hotHoleStore
+)
+
+func getHotHoleStore() hotHoleStore {
+	hotHoleStoreOnce.Do(func() {
+		if client := utils.Redis(); client != nil {
+			hotHoleStoreImpl = &redisHotHoleStore{client: client}
+		} else {
+			hotHoleStoreImpl = &memoryHotHoleStore{}
+		}
+	})
+	return hotHoleStoreImpl
+}
+
+// loadHotHoleStats loads activity of visible holes updated since
+func loadHotHoleStats(since time.Time) ([]HotHoleStats, error) {
+	var stats []HotHoleStats
+	err := DB.Table("hole").
+		Select("hole.id AS hole_id, hole.division_id, hole.created_at, hole.view, "+
+			"COUNT(floor.id) AS floors, COUNT(DISTINCT floor.user_id) AS repliers, COALESCE(SUM("+Quote("floor.like")+"), 0) AS likes").
+		Joins("LEFT JOIN floor ON floor.hole_id = hole.id AND floor.created_at >= ? AND floor.deleted = ?", since, false).
+		Where("hole.updated_at >= ? AND hole.hidden = ? AND hole.deleted_at IS NULL", since, false).
+		Group("hole.id, hole.division_id, hole.created_at, hole.view").
+		Scan(&stats).Error
+	return stats, err
+}
+
+// RankHotHoles recomputes hotness of recently active holes and replaces rankings of all divisions
+func RankHotHoles() error {
+	now := time.Now()
+	stats, err := loadHotHoleStats(now.Add(-HotHoleWindow))
+	if err != nil {
+		return err
+	}
+
+	rankings := make(map[int][]HotHole)
+	for i := range stats {
+		hotHole := HotHole{HoleID: stats[i].HoleID, Score: stats[i].HotScore(now)}
+		rankings[0] = append(rankings[0], hotHole)
+		rankings[stats[i].DivisionID] = append(rankings[stats[i].DivisionID], hotHole)
+	}
+	for divisionID, ranking := range rankings {
+		sort.SliceStable(ranking, func(i, j int) bool {
+			return ranking[i].Score > ranking[j].Score
+		})
+		if len(ranking) > hotHoleMaxSize {
+			rankings[divisionID] = ranking[:hotHoleMaxSize]
+		}
+	}
+	return getHotHoleStore().Replace(context.Background(), rankings)
+}
+
+// ListHotHoleIDs returns ids of hot holes in a division from the hottest, division 0 for all divisions
+func ListHotHoleIDs(divisionID, offset, size int) ([]int, error) {
+	return getHotHoleStore().Range(context.Background(), divisionID, offset, size)
+}
+
+type redisHotHoleStore struct {
+	client redis.UniversalClient
+}
+
+func hotHoleKey(divisionID int) string {
+	return utils.CacheKey(hotHoleKeyPrefix + strconv.Itoa(divisionID))
+}
+
+func (s *redisHotHoleStore) Replace(ctx context.Context, rankings map[int][]HotHole) error {
+	// divisions without active holes are cleared
+	var divisionIDs []int
+	err := DB.Model(&Division{}).Pluck("id", &divisionIDs).Error
+	if err != nil {
+		return err
+	}
+	divisionIDs = append(divisionIDs, 0)
+
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, divisionID := range divisionIDs {
+			key := hotHoleKey(divisionID)
+			pipe.Del(ctx, key)
+			ranking := rankings[divisionID]
+			if len(ranking) == 0 {
+				continue
+			}
+			members := make([]redis.Z, 0, len(ranking))
+			for _, hotHole := range ranking {
+				members = append(members, redis.Z{Score: hotHole.Score, Member: hotHole.HoleID})
+			}
+			pipe.ZAdd(ctx, key, members...)
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *redisHotHoleStore) Range(ctx context.Context, divisionID, offset, size int) ([]int, error) {
+	members, err := s.client.ZRevRange(ctx, hotHoleKey(divisionID), int64(offset), int64(offset+size-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	holeIDs := make([]int, 0, len(members))
+	for _, member := range members {
+		holeID, err := strconv.Atoi(member)
+		if err != nil {
+			continue
+		}
+		holeIDs = append(holeIDs, holeID)
+	}
+	return holeIDs, nil
+}
+
+type memoryHotHoleStore struct {
+	sync.RWMutex
+	rankings map[int][]HotHole
+}
+
+func (s *memoryHotHoleStore) Replace(_ context.Context, rankings map[int][]HotHole) error {
+	s.Lock()
+	defer s.Unlock()
+	s.rankings = rankings
+	return nil
+}
+
+func (s *memoryHotHoleStore) Range(_ context.Context, divisionID, offset, size int) ([]int, error) {
+	s.RLock()
+	defer s.RUnlock()
+	ranking := s.rankings[divisionID]
+	holeIDs := make([]int, 0, size)
+	for i := offset; i < len(ranking) && i < offset+size; i++ {
+		holeIDs = append(holeIDs, ranking[i].HoleID)
+	}
+	return holeIDs, nil
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHotScore(t *testing.T) {
+	now := time.Now()
+	stats := HotHoleStats{CreatedAt: now, Floors: 3, Repliers: 2, Likes: 4, View: 100}
+	fresh := stats.HotScore(now)
+	assert.Greater(t, fresh, 0.0)
+
+	// older holes with the same activity are colder
+	stats.CreatedAt = now.Add(-24 * time.Hour)
+	assert.Less(t, stats.HotScore(now), fresh)
+
+	// a reply from a new user counts more than another floor
+	moreFloors := HotHoleStats{CreatedAt: now, Floors: 4, Repliers: 2, Likes: 4, View: 100}
+	moreRepliers := HotHoleStats{CreatedAt: now, Floors: 3, Repliers: 3, Likes: 4, View: 100}
+	assert.Greater(t, moreRepliers.HotScore(now), moreFloors.HotScore(now))
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/exp/slices"
+
+	"treehole_next/utils"
+)
+
+const (
+	SimilarHolesMaxSize     = 10
+	similarHolesCacheExpire = time.Hour
+	// floors fetched from elasticsearch, several of them may be in the same hole
+	similarFloorsSize = 50
+)
+
+// SimilarHoleIDs returns ids of holes related to hole, the most related first: holes with floors
+// more like the first floor of hole in elasticsearch, or holes sharing most tags if it is unavailable.
+// Results are cached per hole, hidden holes are not filtered.
+func SimilarHoleIDs(hole *Hole) (holeIDs []int, err error) {
+	cacheKey := fmt.Sprintf("similar_holes_%d", hole.ID)
+	if utils.GetCache(cacheKey, &holeIDs) {
+		return holeIDs, nil
+	}
+
+	if ES != nil {
+		holeIDs, err = searchSimilarHoleIDs(hole)
+		if err != nil {
+			log.Err(err).Int("hole_id", hole.ID).Msg("search similar holes failed, fallback to tags")
+		}
+	}
+	if ES == nil || err != nil {
+		holeIDs, err = sharedTagHoleIDs(hole)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return holeIDs, utils.SetCache(cacheKey, holeIDs, similarHolesCacheExpire)
+}
+
+func searchSimilarHoleIDs(hole *Hole) ([]int, error) {
+	var firstFloorID int
+	err := DB.Model(&Floor{}).Where("hole_id = ? AND ranking = 0", hole.ID).Pluck("id", &firstFloorID).Error
+	if err != nil {
+		return nil, err
+	}
+	if firstFloorID == 0 {
+		return []int{}, nil
+	}
+
+	index, id := IndexName, strconv.Itoa(firstFloorID)
+	minTermFreq, minDocFreq := 1, 1
+	var res *search.Response
+	err = esBreaker.Do(func() (err error) {
+		res, err = ES.Search().
+			Index(IndexName).Size(similarFloorsSize).
+			Query(&types.Query{
+				MoreLikeThis: &types.MoreLikeThisQuery{
+					Fields:      []string{"content"},
+					Like:        []types.Like{types.LikeDocument{Index_: &index, Id_: &id}},
+					MinTermFreq: &minTermFreq,
+					MinDocFreq:  &minDocFreq,
+				},
+			}).
+			Do(context.Background())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	floorIDs := make([]int, 0, len(res.Hits.Hits))
+	for _, hit := range res.Hits.Hits {
+		if hit.Id_ == nil {
+			continue
+		}
+		floorID, err := strconv.Atoi(*hit.Id_)
+		if err != nil {
+			continue
+		}
+		floorIDs = append(floorIDs, floorID)
+	}
+	if len(floorIDs) == 0 {
+		return []int{}, nil
+	}
+
+	var floors []struct {
+		ID     int
+		HoleID int
+	}
+	err = DB.Model(&Floor{}).Select("id", "hole_id").Where("id IN ?", floorIDs).Scan(&floors).Error
+	if err != nil {
+		return nil, err
+	}
+	floorHoles := make(map[int]int, len(floors))
+	for _, floor := range floors {
+		floorHoles[floor.ID] = floor.HoleID
+	}
+
+	// in order of relevance
+	holeIDs := make([]int, 0, SimilarHolesMaxSize)
+	for _, floorID := range floorIDs {
+		holeID, ok := floorHoles[floorID]
+		if !ok || holeID == hole.ID || slices.Contains(holeIDs, holeID) {
+			continue
+		}
+		holeIDs = append(holeIDs, holeID)
+		if len(holeIDs) == SimilarHolesMaxSize {
+			break
+		}
+	}
+	return holeIDs, nil
+}
+
+func sharedTagHoleIDs(hole *Hole) ([]int, error) {
+	holeIDs := make([]int, 0, SimilarHolesMaxSize)
+	err := DB.Model(&HoleTag{}).
+		Where("tag_id IN (?) AND hole_id <> ?", DB.Model(&HoleTag{}).Select("tag_id").Where("hole_id = ?", hole.ID), hole.ID).
+		Group("hole_id").Order("COUNT(*) desc, hole_id desc").Limit(SimilarHolesMaxSize).
+		Pluck("hole_id", &holeIDs).Error
+	return holeIDs, err
+}
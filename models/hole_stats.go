@@ -0,0 +1,192 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+
+	"treehole_next/utils"
+)
+
+const (
+	holeStatsCacheExpire = time.Hour
+	// a computation not finished in the time is considered failed and may be started again
+	holeStatsComputingExpire = 5 * time.Minute
+	holeStatsTopTerms        = 30
+	holeStatsBatchSize       = 500
+)
+
+// likeBuckets are lower bounds of like counts in HoleStats.LikeDistribution
+var likeBuckets = []int{0, 1, 5, 10, 50, 100}
+
+// HoleStats is insights of a hole computed in background, see LoadHoleStats
+type HoleStats struct {
+	HoleID int `json:"hole_id"`
+
+	// floors not deleted
+	Floors int `json:"floors"`
+
+	// users who posted floors
+	Participants int `json:"participants"`
+
+	// floors created in each day, in local time
+	FloorsByDay []HoleStatsDay `json:"floors_by_day"`
+
+	// floors by likes, bucket Min <= like < next Min
+	LikeDistribution []HoleStatsLikeBucket `json:"like_distribution"`
+
+	// most frequent terms, words of latin letters and bigrams of chinese characters
+	TopTerms []HoleStatsTerm `json:"top_terms"`
+
+	UpdatedAt time.Time `json:"time_updated"`
+}
+
+type HoleStatsDay struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+type HoleStatsLikeBucket struct {
+	Min   int `json:"min"`
+	Count int `json:"count"`
+}
+
+type HoleStatsTerm struct {
+	Term  string `json:"term"`
+	Count int    `json:"count"`
+}
+
+func holeStatsCacheKey(holeID int) string {
+	return fmt.Sprintf("hole_stats_%d", holeID)
+}
+
+func holeStatsComputingKey(holeID int) string {
+	return fmt.Sprintf("hole_stats_computing_%d", holeID)
+}
+
+// LoadHoleStats returns cached stats of the hole, or nil and starts computing them in background
+func LoadHoleStats(holeID int) *HoleStats {
+	var stats HoleStats
+	if utils.GetCache(holeStatsCacheKey(holeID), &stats) {
+		return &stats
+	}
+
+	var computing bool
+	if utils.GetCache(holeStatsComputingKey(holeID), &computing) && computing {
+		return nil
+	}
+	_ = utils.SetCache(holeStatsComputingKey(holeID), true, holeStatsComputingExpire)
+	utils.Go(func() {
+		defer func() { _ = utils.DeleteCache(holeStatsComputingKey(holeID)) }()
+		stats, err := ComputeHoleStats(holeID)
+		if err != nil {
+			log.Err(err).Int("hole_id", holeID).Msg("compute hole stats failed")
+			return
+		}
+		err = utils.SetCache(holeStatsCacheKey(holeID), stats, holeStatsCacheExpire)
+		if err != nil {
+			log.Err(err).Int("hole_id", holeID).Msg("cache hole stats failed")
+		}
+	})
+	return nil
+}
+
+// ComputeHoleStats scans floors of the hole in batches
+func ComputeHoleStats(holeID int) (*HoleStats, error) {
+	stats := HoleStats{
+		HoleID:           holeID,
+		FloorsByDay:      []HoleStatsDay{},
+		LikeDistribution: make([]HoleStatsLikeBucket, len(likeBuckets)),
+		UpdatedAt:        time.Now(),
+	}
+	for i, bucket := range likeBuckets {
+		stats.LikeDistribution[i].Min = bucket
+	}
+	participants := make(map[int]bool)
+	days := make(map[string]int)
+	terms := make(map[string]int)
+
+	var floors Floors
+	err := DB.Select("id", "created_at", "user_id", "like", "type", "content").
+		Where("hole_id = ? AND deleted = ?", holeID, false).
+		FindInBatches(&floors, holeStatsBatchSize, func(tx *gorm.DB, batch int) error {
+			for _, floor := range floors {
+				stats.Floors++
+				participants[floor.UserID] = true
+
+				days[floor.CreatedAt.Local().Format(time.DateOnly)]++
+
+				for i := len(likeBuckets) - 1; i >= 0; i-- {
+					if floor.Like >= likeBuckets[i] {
+						stats.LikeDistribution[i].Count++
+						break
+					}
+				}
+
+				if floor.Type == FloorTypeUser {
+					countTerms(terms, PlainContent(floor.Content, nil))
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return nil, err
+	}
+	stats.Participants = len(participants)
+
+	for date, count := range days {
+		stats.FloorsByDay = append(stats.FloorsByDay, HoleStatsDay{Date: date, Count: count})
+	}
+	sort.Slice(stats.FloorsByDay, func(i, j int) bool {
+		return stats.FloorsByDay[i].Date < stats.FloorsByDay[j].Date
+	})
+
+	stats.TopTerms = make([]HoleStatsTerm, 0, len(terms))
+	for term, count := range terms {
+		stats.TopTerms = append(stats.TopTerms, HoleStatsTerm{Term: term, Count: count})
+	}
+	sort.Slice(stats.TopTerms, func(i, j int) bool {
+		if stats.TopTerms[i].Count != stats.TopTerms[j].Count {
+			return stats.TopTerms[i].Count > stats.TopTerms[j].Count
+		}
+		return stats.TopTerms[i].Term < stats.TopTerms[j].Term
+	})
+	if len(stats.TopTerms) > holeStatsTopTerms {
+		stats.TopTerms = stats.TopTerms[:holeStatsTopTerms]
+	}
+	return &stats, nil
+}
+
+// countTerms counts words of at least 2 latin letters or digits, and bigrams of consecutive chinese characters
+func countTerms(terms map[string]int, content string) {
+	var word strings.Builder
+	var lastHan rune
+	flushWord := func() {
+		if word.Len() >= 2 {
+			terms[strings.ToLower(word.String())]++
+		}
+		word.Reset()
+	}
+	for _, r := range content {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			if lastHan != 0 {
+				terms[string([]rune{lastHan, r})]++
+			}
+			lastHan = r
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			lastHan = 0
+			word.WriteRune(r)
+		default:
+			lastHan = 0
+			flushWord()
+		}
+	}
+	flushWord()
+}
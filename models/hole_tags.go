@@ -3,6 +3,9 @@ package models
 type HoleTag struct {
 	HoleID int `json:"hole_id" gorm:"index"`
 	TagID  int `json:"tag_id" gorm:"index"`
+
+	// applied by AutoTagHoles instead of users, cleared when the tags of the hole are modified
+	Machine bool `json:"machine" gorm:"not null;default:false"`
 }
 
 func (HoleTag) TableName() string {
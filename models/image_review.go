@@ -0,0 +1,199 @@
+package models
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"treehole_next/config"
+	"treehole_next/utils"
+)
+
+// status of images, see ImageReview
+const (
+	ImageStatusPending  = "pending"
+	ImageStatusApproved = "approved"
+	ImageStatusRejected = "rejected"
+)
+
+// ImageFoldReason is the fold reason of floors with rejected images
+const ImageFoldReason = "该内容包含违规图片"
+
+// ImageReview is the review result of an uploaded image, by url.
+// Images are pending until the provider posts the verdict back, see config.ImageReviewUrl
+type ImageReview struct {
+	ID        int       `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"time_created"`
+	UpdatedAt time.Time `json:"time_updated"`
+	URL       string    `json:"url" gorm:"size:512;not null;uniqueIndex"`
+	Status    string    `json:"status" gorm:"size:16;not null;default:pending;index"`
+	// reason of rejection from the provider
+	Reason string `json:"reason" gorm:"size:64;not null;default:''"`
+}
+
+// FloorImage links floors to images in their contents
+type FloorImage struct {
+	FloorID int `json:"floor_id" gorm:"primaryKey;autoIncrement:false"`
+	ImageID int `json:"image_id" gorm:"primaryKey;autoIncrement:false;index"`
+}
+
+var reImageURL = regexp.MustCompile(`!\[.*?]\(([^" )]+)`)
+
+// ImageURLs returns distinct urls of images in content uploaded to valid image hosts
+func ImageURLs(content string) []string {
+	urls := make([]string, 0)
+	for _, match := range reImageURL.FindAllStringSubmatch(content, -1) {
+		imageURL, err := url.Parse(match[1])
+		if err != nil || !slices.Contains(config.Config.ValidImageUrl, imageURL.Hostname()) {
+			continue
+		}
+		if !slices.Contains(urls, match[1]) {
+			urls = append(urls, match[1])
+		}
+	}
+	return urls
+}
+
+// ReviewFloorImages links images in the floor, submits new ones to the provider
+// and folds the floor if any image is rejected already. Errors are logged only.
+func ReviewFloorImages(floor *Floor) {
+	if config.Config.ImageReviewUrl == "" {
+		return
+	}
+	urls := ImageURLs(floor.Content)
+	if len(urls) == 0 {
+		return
+	}
+
+	images := make([]ImageReview, 0, len(urls))
+	for _, imageURL := range urls {
+		images = append(images, ImageReview{URL: imageURL, Status: ImageStatusPending})
+	}
+	var created []string
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		for i := range images {
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&images[i])
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				created = append(created, images[i].URL)
+			}
+		}
+		// ids of existing images are not returned by insert
+		images = make([]ImageReview, 0, len(urls))
+		err := tx.Where("url IN ?", urls).Find(&images).Error
+		if err != nil {
+			return err
+		}
+		floorImages := make([]FloorImage, 0, len(images))
+		for _, image := range images {
+			floorImages = append(floorImages, FloorImage{FloorID: floor.ID, ImageID: image.ID})
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&floorImages).Error
+	})
+	if err != nil {
+		log.Err(err).Int("floor_id", floor.ID).Msg("save floor images failed")
+		return
+	}
+
+	for _, imageURL := range created {
+		utils.Go(func() {
+			err := submitImageReview(imageURL)
+			if err != nil {
+				log.Err(err).Str("url", imageURL).Msg("submit image review failed")
+			}
+		})
+	}
+
+	if slices.ContainsFunc(images, func(image ImageReview) bool { return image.Status == ImageStatusRejected }) {
+		_, err = foldFloorsWithImage(DB.Where("id = ?", floor.ID))
+		if err != nil {
+			log.Err(err).Int("floor_id", floor.ID).Msg("fold floor with rejected image failed")
+			return
+		}
+		floor.Fold = ImageFoldReason
+	}
+}
+
+var imageReviewClient = http.Client{Timeout: 10 * time.Second, Transport: utils.TracingTransport{}}
+
+// imageReviewBreaker skips submissions while the provider is down, the images are kept pending and floors unfolded
+var imageReviewBreaker = utils.NewBreaker("image_review")
+
+func submitImageReview(imageURL string) error {
+	data, err := json.Marshal(map[string]string{"url": imageURL, "callback_url": config.Config.ImageReviewCallbackUrl})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, config.Config.ImageReviewUrl, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Treehole-Signature", SignWebhookPayload(config.Config.ImageReviewSecret, data))
+
+	return imageReviewBreaker.Do(func() error {
+		res, err := imageReviewClient.Do(req)
+		if err != nil {
+			return err
+		}
+		_ = res.Body.Close()
+		if res.StatusCode < 200 || res.StatusCode >= 300 {
+			return fmt.Errorf("image review response %s", res.Status)
+		}
+		return nil
+	})
+}
+
+// SaveImageReview saves the verdict of the provider, floors with a rejected image are folded.
+// Returns the number of floors folded
+func SaveImageReview(imageURL, status, reason string) (int, error) {
+	var image ImageReview
+	err := DB.Where("url = ?", imageURL).Take(&image).Error
+	if err != nil {
+		return 0, err
+	}
+	err = DB.Model(&image).Updates(map[string]any{"status": status, "reason": reason}).Error
+	if err != nil {
+		return 0, err
+	}
+	if status != ImageStatusRejected {
+		return 0, nil
+	}
+	return foldFloorsWithImage(DB.Where("id IN (?)", DB.Model(&FloorImage{}).Select("floor_id").Where("image_id = ?", image.ID)))
+}
+
+// foldFloorsWithImage folds floors of querySet not folded yet, folds of moderators are kept
+func foldFloorsWithImage(querySet *gorm.DB) (int, error) {
+	var floors Floors
+	err := querySet.Where("fold = '' OR fold IS NULL").Find(&floors).Error
+	if err != nil || len(floors) == 0 {
+		return 0, err
+	}
+	floorIDs := make([]int, 0, len(floors))
+	holeIDs := make([]int, 0, len(floors))
+	for _, floor := range floors {
+		floorIDs = append(floorIDs, floor.ID)
+		holeIDs = append(holeIDs, floor.HoleID)
+	}
+	err = DB.Model(&Floor{}).Where("id IN ?", floorIDs).
+		Updates(map[string]any{"fold": ImageFoldReason, "version": gorm.Expr("version + 1")}).Error
+	if err != nil {
+		return 0, err
+	}
+	err = DeleteHoleCache(DB, holeIDs...)
+	if err != nil {
+		return 0, err
+	}
+	return len(floors), nil
+}
@@ -1,8 +1,10 @@
 package models
 
 import (
+	"context"
+	"database/sql"
 	"os"
-	"time"
+	"path/filepath"
 
 	"github.com/rs/zerolog/log"
 
@@ -23,15 +25,19 @@ var gormConfig = &gorm.Config{
 	NamingStrategy: schema.NamingStrategy{
 		SingularTable: true, // use singular table name, table for `User` would be `user` with this option enabled
 	},
-	Logger: logger.New(
+}
+
+// newGormLogger logs errors, and queries slower than DB_SLOW_THRESHOLD as warnings
+func newGormLogger() logger.Interface {
+	return logger.New(
 		&log.Logger,
 		logger.Config{
-			SlowThreshold:             time.Second,  // 慢 SQL 阈值
-			LogLevel:                  logger.Error, // 日志级别
-			IgnoreRecordNotFoundError: true,         // 忽略ErrRecordNotFound（记录未找到）错误
-			Colorful:                  false,        // 禁用彩色打印
+			SlowThreshold:             config.Config.DbSlowThreshold, // 慢 SQL 阈值
+			LogLevel:                  logger.Warn,                   // 日志级别
+			IgnoreRecordNotFoundError: true,                          // 忽略ErrRecordNotFound（记录未找到）错误
+			Colorful:                  false,                         // 禁用彩色打印
 		},
-	),
+	)
 }
 
 // Read/Write Splitting
@@ -42,17 +48,42 @@ func mysqlDB() *gorm.DB {
 	if err != nil {
 		log.Fatal().Err(err).Send()
 	}
+	sourceDB, err := db.DB()
+	if err != nil {
+		log.Fatal().Err(err).Send()
+	}
+	sourceDB.SetMaxOpenConns(config.Config.DbMaxOpenConns)
+	sourceDB.SetMaxIdleConns(config.Config.DbMaxIdleConns)
+	sourceDB.SetConnMaxLifetime(config.Config.DbConnMaxLifetime)
 
 	// set replica databases
-	var replicas []gorm.Dialector
-	for _, url := range config.Config.MysqlReplicaURLs {
-		replicas = append(replicas, mysql.Open(url))
+	var replicaDialectors []gorm.Dialector
+	for i, url := range config.Config.MysqlReplicaURLs {
+		region, dsn := parseReplicaURL(url)
+		replicaDialectors = append(replicaDialectors, mysql.Open(dsn))
+
+		// keep a connection to each replica for health probes
+		replicaDB, err := sql.Open("mysql", dsn)
+		if err != nil {
+			log.Fatal().Err(err).Send()
+		}
+		replicaDB.SetMaxOpenConns(1)
+		replicas.replicas = append(replicas.replicas, newReplica(i, region, replicaDB))
+	}
+	if len(replicaDialectors) > 0 {
+		// reads fail over to the source if no replica is healthy, see replicaPolicy
+		replicaDialectors = append(replicaDialectors, source)
+		replicas.region = config.Config.DbRegion
+		replicas.probe(context.Background())
 	}
 	err = db.Use(dbresolver.Register(dbresolver.Config{
 		Sources:  []gorm.Dialector{source},
-		Replicas: replicas,
-		Policy:   dbresolver.RandomPolicy{},
-	}))
+		Replicas: replicaDialectors,
+		Policy:   replicas,
+	}).
+		SetMaxOpenConns(config.Config.DbMaxOpenConns).
+		SetMaxIdleConns(config.Config.DbMaxIdleConns).
+		SetConnMaxLifetime(config.Config.DbConnMaxLifetime))
 	if err != nil {
 		log.Fatal().Err(err).Send()
 	}
@@ -60,11 +91,16 @@ func mysqlDB() *gorm.DB {
 }
 
 func sqliteDB() *gorm.DB {
-	err := os.MkdirAll("data", 0750)
+	path := config.Config.DbURL
+	if path == "" {
+		path = "data/sqlite.db"
+	}
+	err := os.MkdirAll(filepath.Dir(path), 0750)
 	if err != nil {
 		log.Fatal().Err(err).Send()
 	}
-	db, err := gorm.Open(sqlite.Open("data/sqlite.db"), gormConfig)
+	// writers wait for the lock instead of failing with SQLITE_BUSY, readers don't block the writer with WAL
+	db, err := gorm.Open(sqlite.Open(path+"?_busy_timeout=5000&_journal_mode=WAL"), gormConfig)
 	if err != nil {
 		log.Fatal().Err(err).Send()
 	}
@@ -77,8 +113,21 @@ func sqliteDB() *gorm.DB {
 	return db
 }
 
+// memoryKeeper holds a connection to the in-memory database, which is gone with its last connection,
+// e.g. when the connection is discarded after the transaction of a canceled request
+var memoryKeeper *sql.DB
+
 func memoryDB() *gorm.DB {
-	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), gormConfig)
+	const dsn = "file::memory:?cache=shared"
+	var err error
+	memoryKeeper, err = sql.Open("sqlite3", dsn)
+	if err == nil {
+		err = memoryKeeper.Ping()
+	}
+	if err != nil {
+		log.Fatal().Err(err).Send()
+	}
+	db, err := gorm.Open(sqlite.Open(dsn), gormConfig)
 	if err != nil {
 		log.Fatal().Err(err).Send()
 	}
@@ -91,17 +140,26 @@ func memoryDB() *gorm.DB {
 	return db
 }
 
-func InitDB() {
+// ConnectDB connects to the database without migrating, used by migrate command
+func ConnectDB() {
 	var err error
+	gormConfig.Logger = newGormLogger()
 	switch config.Config.Mode {
 	case "production":
-		DB = mysqlDB()
+		switch config.Config.DbType {
+		case DialectMySQL:
+			DB = mysqlDB()
+		case DialectSQLite:
+			DB = sqliteDB()
+		default:
+			log.Fatal().Str("db_type", config.Config.DbType).Msg("unsupported database type")
+		}
 	case "test":
 		fallthrough
 	case "bench":
 		DB = memoryDB()
 	case "dev":
-		if config.Config.DbURL == "" {
+		if config.Config.DbURL == "" || config.Config.DbType == DialectSQLite {
 			DB = sqliteDB()
 		} else {
 			DB = mysqlDB()
@@ -117,6 +175,24 @@ func InitDB() {
 		DB = DB.Debug()
 	}
 
+	// touch etag stamp when contents change, see utils.CheckETag
+	err = registerETagCallbacks(DB)
+	if err != nil {
+		log.Fatal().Err(err).Send()
+	}
+
+	// create a span for each query, see utils.InitTracing
+	err = registerTracingCallbacks(DB)
+	if err != nil {
+		log.Fatal().Err(err).Send()
+	}
+
+	// prune partitions of floor updates and reject floor deletes, see AddFloorPartitions
+	err = registerFloorPartitionCallbacks(DB)
+	if err != nil {
+		log.Fatal().Err(err).Send()
+	}
+
 	err = DB.SetupJoinTable(&User{}, "UserLikedFloors", &FloorLike{})
 	if err != nil {
 		log.Fatal().Err(err).Send()
@@ -136,24 +212,13 @@ func InitDB() {
 	if err != nil {
 		log.Fatal().Err(err).Send()
 	}
+}
 
-	// models must be registered here to migrate into the database
-	err = DB.AutoMigrate(
-		&Division{},
-		&Tag{},
-		&User{},
-		&Floor{},
-		&Hole{},
-		&Report{},
-		&Punishment{},
-		&ReportPunishment{},
-		&Message{},
-		&FloorHistory{},
-		&AdminLog{},
-		&UserFavorite{},
-		&FavoriteGroup{},
-		&UrlHostnameWhitelist{},
-	)
+func InitDB() {
+	ConnectDB()
+
+	// check and apply migrations, see migration.go
+	err := migrateOnStartup()
 	if err != nil {
 		log.Fatal().Err(err).Send()
 	}
@@ -163,3 +228,37 @@ func InitDB() {
 		log.Fatal().Err(err).Send()
 	}
 }
+
+// CloseDB closes connections to the source and replica databases
+func CloseDB() error {
+	for _, replica := range replicas.replicas {
+		_ = replica.db.Close()
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// PingDB pings the source database, returns the ping function keyed by mysql
+func PingDB() map[string]func(ctx context.Context) error {
+	return map[string]func(ctx context.Context) error{
+		"mysql": func(ctx context.Context) error {
+			sqlDB, err := DB.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		},
+	}
+}
+
+// PingReplicas pings every replica, returns the ping functions keyed by name, e.g. mysql_replica_0
+func PingReplicas() map[string]func(ctx context.Context) error {
+	pings := make(map[string]func(ctx context.Context) error, len(replicas.replicas))
+	for _, replica := range replicas.replicas {
+		pings[replica.name] = replica.db.PingContext
+	}
+	return pings
+}
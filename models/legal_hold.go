@@ -0,0 +1,69 @@
+package models
+
+import (
+	"gorm.io/gorm"
+
+	"treehole_next/utils"
+)
+
+// heldHoles is the subquery of ids of holes under legal hold
+func heldHoles() *gorm.DB {
+	return DB.Unscoped().Model(&Hole{}).Select("id").Where("legal_hold = ?", true)
+}
+
+// heldFloors is the subquery of ids of floors under legal hold, held themselves or in held holes
+func heldFloors() *gorm.DB {
+	return DB.Model(&Floor{}).Select("id").Where("legal_hold = ? OR hole_id IN (?)", true, heldHoles())
+}
+
+// NotHeldFloors excludes floors under legal hold, held themselves or in held holes
+func NotHeldFloors(tx *gorm.DB) *gorm.DB {
+	return tx.Where("floor.legal_hold = ? AND floor.hole_id NOT IN (?)", false, heldHoles())
+}
+
+// NotHeldHoles excludes holes under legal hold, held themselves or with held floors
+func NotHeldHoles(tx *gorm.DB) *gorm.DB {
+	floorHoles := DB.Model(&Floor{}).Select("hole_id").Where("legal_hold = ?", true)
+	return tx.Where("hole.legal_hold = ? AND hole.id NOT IN (?)", false, floorHoles)
+}
+
+// NotHeldFloorHistories excludes histories of floors under legal hold
+func NotHeldFloorHistories(tx *gorm.DB) *gorm.DB {
+	return tx.Where("floor_history.floor_id NOT IN (?)", heldFloors())
+}
+
+// NotHeldAnonynames excludes anonyname mappings of holes under legal hold, held themselves or with held floors
+func NotHeldAnonynames(tx *gorm.DB) *gorm.DB {
+	floorHoles := DB.Model(&Floor{}).Select("hole_id").Where("legal_hold = ?", true)
+	return tx.Where("anonyname_mapping.hole_id NOT IN (?) AND anonyname_mapping.hole_id NOT IN (?)", heldHoles(), floorHoles)
+}
+
+// UnderLegalHold tells if the floor or its hole is under legal hold
+func (floor *Floor) UnderLegalHold(tx *gorm.DB) (bool, error) {
+	if floor.LegalHold {
+		return true, nil
+	}
+	var count int64
+	err := tx.Unscoped().Model(&Hole{}).Where("id = ? AND legal_hold = ?", floor.HoleID, true).Count(&count).Error
+	return count > 0, err
+}
+
+// SetLegalHold places the hole under legal hold or releases it, the caller should log the change
+func (hole *Hole) SetLegalHold(tx *gorm.DB, hold bool) error {
+	hole.LegalHold = hold
+	err := tx.Unscoped().Model(hole).UpdateColumn("legal_hold", hold).Error
+	if err != nil {
+		return err
+	}
+	return utils.DeleteCache(hole.CacheName())
+}
+
+// SetLegalHold places the floor under legal hold or releases it, the caller should log the change
+func (floor *Floor) SetLegalHold(tx *gorm.DB, hold bool) error {
+	floor.LegalHold = hold
+	err := tx.Model(floor).UpdateColumn("legal_hold", hold).Error
+	if err != nil {
+		return err
+	}
+	return DeleteHoleCache(tx, floor.HoleID)
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LikeDigest counts likes on floors of a user since the last digest notification
+type LikeDigest struct {
+	// recipient, the owner of liked floors
+	UserID int `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+
+	// number of likes since the last digest
+	Count int `json:"count" gorm:"not null;default:0"`
+
+	// the latest liked floor, the notification links to it
+	FloorID int `json:"floor_id" gorm:"not null;default:0"`
+
+	// time of the first like since the last digest
+	CreatedAt time.Time `json:"time_created" gorm:"not null;index"`
+
+	UpdatedAt time.Time `json:"time_updated" gorm:"not null"`
+}
+
+const (
+	LikeNotifyImmediate = "immediate"
+	LikeNotifyDaily     = "daily"
+	LikeNotifyOff       = "off"
+)
+
+var likeNotifyOptions = []string{LikeNotifyImmediate, LikeNotifyDaily, LikeNotifyOff}
+
+// LikeDigestDailyInterval is the interval between digests of users choosing daily
+const LikeDigestDailyInterval = 24 * time.Hour
+
+// addLikeDigest records a new like on floor, notified later by a digest, see FlushLikeDigests
+func (floor *Floor) addLikeDigest(tx *gorm.DB) error {
+	// users not found use the default config
+	var owner User
+	err := tx.Select("id", "config").Take(&owner, floor.UserID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if owner.Config.LikeNotify == LikeNotifyOff {
+		return nil
+	}
+
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"count":      gorm.Expr("count + 1"),
+			"floor_id":   floor.ID,
+			"updated_at": time.Now(),
+		}),
+	}).Create(&LikeDigest{
+		UserID:  floor.UserID,
+		Count:   1,
+		FloorID: floor.ID,
+	}).Error
+}
+
+func (digest *LikeDigest) Notification() Notification {
+	return Notification{
+		Data:        digest,
+		Recipients:  []int{digest.UserID},
+		Description: fmt.Sprintf("你的回复获得了 %d 个赞", digest.Count),
+		Title:       "你的回复获得了新的赞",
+		Type:        MessageTypeLike,
+		URL:         fmt.Sprintf("/api/floors/%d", digest.FloorID),
+	}
+}
+
+// FlushLikeDigests sends like digests due now: pending likes of users choosing immediate,
+// likes older than LikeDigestDailyInterval of users choosing daily. Pending likes of users
+// who turned off like notifications are dropped.
+func FlushLikeDigests() error {
+	var notifications Notifications
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var digests []LikeDigest
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Find(&digests).Error
+		if err != nil {
+			return err
+		}
+		if len(digests) == 0 {
+			return nil
+		}
+
+		userIDs := make([]int, 0, len(digests))
+		for _, digest := range digests {
+			userIDs = append(userIDs, digest.UserID)
+		}
+		var users []User
+		err = tx.Select("id", "config").Find(&users, userIDs).Error
+		if err != nil {
+			return err
+		}
+		likeNotify := make(map[int]string, len(users))
+		for _, user := range users {
+			likeNotify[user.ID] = user.Config.LikeNotify
+		}
+
+		var doneUserIDs []int
+		for i := range digests {
+			digest := &digests[i]
+			switch likeNotify[digest.UserID] {
+			case LikeNotifyImmediate:
+			case LikeNotifyOff:
+				doneUserIDs = append(doneUserIDs, digest.UserID)
+				continue
+			default:
+				if time.Since(digest.CreatedAt) < LikeDigestDailyInterval {
+					continue
+				}
+			}
+			notifications = append(notifications, digest.Notification())
+			doneUserIDs = append(doneUserIDs, digest.UserID)
+		}
+		if len(doneUserIDs) == 0 {
+			return nil
+		}
+		return tx.Delete(&LikeDigest{}, doneUserIDs).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	// send after commit, failed ones are not retried
+	for _, notification := range notifications {
+		_, err = notification.Send()
+		if err != nil {
+			log.Err(err).Str("model", "LikeDigest").Msg("send like digest failed")
+		}
+	}
+	return nil
+}
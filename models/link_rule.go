@@ -0,0 +1,136 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+	"mvdan.cc/xurls/v2"
+
+	"treehole_next/config"
+	"treehole_next/utils"
+)
+
+// actions of link rules, see LinkRule
+const (
+	LinkActionAllow = "allow"
+	LinkActionFold  = "fold"
+	LinkActionBlock = "block"
+)
+
+// LinkFoldReason is the fold reason of floors with links of fold rules
+const LinkFoldReason = "该内容包含可疑链接"
+
+// LinkRule allows, folds or blocks links to a domain and its subdomains, managed by admins.
+// Links not allowed are rewritten to the redirect endpoint if config.LinkRedirectUrl is set.
+type LinkRule struct {
+	ID        int       `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"time_created"`
+	Domain    string    `json:"domain" gorm:"size:128;not null;uniqueIndex"`
+	Action    string    `json:"action" gorm:"size:16;not null"`
+	// shown to moderators only
+	Reason    string `json:"reason" gorm:"size:64;not null;default:''"`
+	CreatedBy int    `json:"created_by"`
+}
+
+type LinkRules []LinkRule
+
+const linkRulesCacheKey = "link_rules"
+
+// LoadLinkRules returns all link rules, cached until rules are modified
+func LoadLinkRules() (rules LinkRules, err error) {
+	if utils.GetCache(linkRulesCacheKey, &rules) {
+		return rules, nil
+	}
+	err = DB.Order("id").Find(&rules).Error
+	if err != nil {
+		return nil, err
+	}
+	return rules, utils.SetCache(linkRulesCacheKey, rules, 0)
+}
+
+func DeleteLinkRulesCache() error {
+	return utils.DeleteCache(linkRulesCacheKey)
+}
+
+// Match returns the rule of the most specific domain matching host, nil if none
+func (rules LinkRules) Match(host string) *LinkRule {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	var matched *LinkRule
+	for i, rule := range rules {
+		if host != rule.Domain && !strings.HasSuffix(host, "."+rule.Domain) {
+			continue
+		}
+		if matched == nil || len(rule.Domain) > len(matched.Domain) {
+			matched = &rules[i]
+		}
+	}
+	return matched
+}
+
+// LinkHost returns the lowercase host of a link, links without scheme are parsed as http
+func LinkHost(link string) string {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// trustedHost tells if links to host are not rewritten, i.e. allowed by rules or image hosts
+func (rules LinkRules) trustedHost(host string) bool {
+	if slices.Contains(config.Config.ValidImageUrl, host) || slices.Contains(config.Config.UrlHostnameWhitelist, host) {
+		return true
+	}
+	rule := rules.Match(host)
+	return rule != nil && rule.Action == LinkActionAllow
+}
+
+// CheckLinkRules returns ErrCodeLinkBlocked if the floor has links of block rules, folds the floor
+// if it has links of fold rules, and rewrites other external links if config.LinkRedirectUrl is set
+func CheckLinkRules(floor *Floor) error {
+	links := xurls.Relaxed().FindAllString(floor.Content, -1)
+	if len(links) == 0 {
+		return nil
+	}
+	rules, err := LoadLinkRules()
+	if err != nil {
+		return err
+	}
+	for _, link := range links {
+		rule := rules.Match(LinkHost(link))
+		if rule == nil {
+			continue
+		}
+		switch rule.Action {
+		case LinkActionBlock:
+			return utils.NewError(utils.ErrCodeLinkBlocked, fmt.Sprintf("内容包含被禁止的链接：%s", rule.Domain))
+		case LinkActionFold:
+			if floor.Fold == "" {
+				floor.Fold = LinkFoldReason
+			}
+		}
+	}
+	floor.Content = rules.RewriteLinks(floor.Content)
+	return nil
+}
+
+// RewriteLinks rewrites external links with scheme to config.LinkRedirectUrl, which warns users before leaving
+func (rules LinkRules) RewriteLinks(content string) string {
+	redirectUrl := config.Config.LinkRedirectUrl
+	if redirectUrl == "" {
+		return content
+	}
+	return xurls.Strict().ReplaceAllStringFunc(content, func(link string) string {
+		scheme, _, _ := strings.Cut(strings.ToLower(link), "://")
+		if scheme != "http" && scheme != "https" || strings.HasPrefix(link, redirectUrl) || rules.trustedHost(LinkHost(link)) {
+			return link
+		}
+		return redirectUrl + "?url=" + url.QueryEscape(link)
+	})
+}
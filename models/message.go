@@ -44,6 +44,10 @@ const (
 	MessageTypeReportDealt MessageType = "report_dealt"
 	MessageTypeMail        MessageType = "mail"
 	MessageTypeSensitive   MessageType = "sensitive"
+	MessageTypeLike        MessageType = "like"         // digest of likes, see LikeDigest
+	MessageTypeDigest      MessageType = "digest"       // daily digest of favorite and subscribed holes, see FlushDigests
+	MessageTypeSavedSearch MessageType = "saved_search" // new floors matching a saved search, see FlushSavedSearches
+	MessageTypeActivity    MessageType = "activity"     // activities starting soon, see FlushActivityReminders
 )
 
 func (messages Messages) Preprocess(c *fiber.Ctx) error {
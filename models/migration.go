@@ -0,0 +1,953 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+
+	"treehole_next/config"
+)
+
+// SchemaMigration records an applied migration
+type SchemaMigration struct {
+	Version   int       `json:"version" gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `json:"name" gorm:"size:128;not null"`
+	AppliedAt time.Time `json:"applied_at" gorm:"not null"`
+}
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	// nil if the migration is irreversible
+	Down func(tx *gorm.DB) error
+	// drops or rewrites data, e.g. dropping a column, not applied on startup unless ALLOW_DESTRUCTIVE_MIGRATIONS is set.
+	// Alter large tables with OnlineAlter
+	Destructive bool
+}
+
+// MigrationState is a migration and when it is applied, nil if pending
+type MigrationState struct {
+	Version     int        `json:"version"`
+	Name        string     `json:"name"`
+	Destructive bool       `json:"destructive"`
+	AppliedAt   *time.Time `json:"applied_at"`
+}
+
+// models must be registered here to be created by the initial migration
+var allModels = []any{
+	&Division{},
+	&Tag{},
+	&User{},
+	&Floor{},
+	&Hole{},
+	&Report{},
+	&Punishment{},
+	&ReportPunishment{},
+	&Message{},
+	&FloorHistory{},
+	&AdminLog{},
+	&UserFavorite{},
+	&FavoriteGroup{},
+	&UrlHostnameWhitelist{},
+}
+
+// migrations are applied in order of version.
+// Never modify a released migration, add a new one for column renames, index changes and data backfills.
+var migrations = []Migration{
+	{
+		// creates the schema from models on new databases. Databases created by AutoMigrate before versioned migrations
+		// only get changes made until then, later columns are added by their own migrations, online for large tables
+		Version: 1,
+		Name:    "initial",
+		Up: func(tx *gorm.DB) error {
+			if !tx.Migrator().HasTable(&Hole{}) {
+				return tx.AutoMigrate(allModels...)
+			}
+			if !tx.Migrator().HasColumn(&Division{}, "RealName") {
+				err := tx.Migrator().AddColumn(&Division{}, "RealName")
+				if err != nil {
+					return err
+				}
+			}
+			for _, index := range []struct {
+				model any
+				name  string
+			}{
+				{&Floor{}, "idx_floor_user_id"},
+				{&Hole{}, "idx_hole_user_upd"},
+			} {
+				if tx.Migrator().HasIndex(index.model, index.name) {
+					continue
+				}
+				err := createIndexOnline(tx, index.model, index.name)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 2,
+		Name:    "add floor version",
+		Up: func(tx *gorm.DB) error {
+			// already created by the initial migration on new databases
+			if tx.Migrator().HasColumn(&Floor{}, "Version") {
+				return nil
+			}
+			return addColumnOnline(tx, &Floor{}, "Version")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumnOnline(tx, &Floor{}, "Version")
+		},
+	},
+	{
+		Version: 3,
+		Name:    "add like digest",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&LikeDigest{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&LikeDigest{})
+		},
+	},
+	{
+		Version: 4,
+		Name:    "add notification setting",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&NotificationSetting{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&NotificationSetting{})
+		},
+	},
+	{
+		Version: 5,
+		Name:    "add webhook",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&Webhook{}, &WebhookDelivery{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&WebhookDelivery{}, &Webhook{})
+		},
+	},
+	{
+		Version: 6,
+		Name:    "add division visibility",
+		Up: func(tx *gorm.DB) error {
+			// already created by the initial migration on new databases
+			for _, column := range []string{"Visibility", "Group"} {
+				if tx.Migrator().HasColumn(&Division{}, column) {
+					continue
+				}
+				err := tx.Migrator().AddColumn(&Division{}, column)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, column := range []string{"Visibility", "Group"} {
+				err := tx.Migrator().DropColumn(&Division{}, column)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 7,
+		Name:    "add hole sim hash",
+		Up: func(tx *gorm.DB) error {
+			// already created by the initial migration on new databases
+			if tx.Migrator().HasColumn(&Hole{}, "SimHash") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&Hole{}, "SimHash")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&Hole{}, "SimHash")
+		},
+	},
+	{
+		Version: 8,
+		Name:    "add tenant",
+		Up: func(tx *gorm.DB) error {
+			err := tx.AutoMigrate(&Tenant{})
+			if err != nil {
+				return err
+			}
+			// already created by the initial migration on new databases
+			for _, model := range []any{&Division{}, &Tag{}, &Hole{}} {
+				if tx.Migrator().HasColumn(model, "TenantID") {
+					continue
+				}
+				err = tx.Migrator().AddColumn(model, "TenantID")
+				if err != nil {
+					return err
+				}
+			}
+			if !tx.Migrator().HasIndex(&Hole{}, "TenantID") {
+				err = tx.Migrator().CreateIndex(&Hole{}, "TenantID")
+				if err != nil {
+					return err
+				}
+			}
+
+			// names are unique in a tenant instead of globally
+			for table, model := range map[string]any{"division": &Division{}, "tag": &Tag{}} {
+				for _, index := range []string{"name", "idx_" + table + "_name", "uni_" + table + "_name"} {
+					if !tx.Migrator().HasIndex(model, index) {
+						continue
+					}
+					err = tx.Migrator().DropIndex(model, index)
+					if err != nil {
+						return err
+					}
+				}
+				index := "idx_" + table + "_tenant_name"
+				if !tx.Migrator().HasIndex(model, index) {
+					err = tx.Migrator().CreateIndex(model, index)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for table, model := range map[string]any{"division": &Division{}, "tag": &Tag{}} {
+				err := tx.Migrator().DropIndex(model, "idx_"+table+"_tenant_name")
+				if err != nil {
+					return err
+				}
+				err = tx.Exec(fmt.Sprintf("CREATE UNIQUE INDEX idx_%s_name ON %s (name)", table, table)).Error
+				if err != nil {
+					return err
+				}
+			}
+			for _, model := range []any{&Division{}, &Tag{}, &Hole{}} {
+				err := tx.Migrator().DropColumn(model, "TenantID")
+				if err != nil {
+					return err
+				}
+			}
+			return tx.Migrator().DropTable(&Tenant{})
+		},
+	},
+	{
+		Version: 9,
+		Name:    "add api key",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&APIKey{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&APIKey{})
+		},
+	},
+	{
+		Version: 10,
+		Name:    "add division moderator",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&DivisionModerator{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&DivisionModerator{})
+		},
+	},
+	{
+		Version: 11,
+		Name:    "add division tag rules",
+		Up: func(tx *gorm.DB) error {
+			// already created by the initial migration on new databases
+			for _, column := range []string{"MinTags", "MaxTags", "RequiredTags"} {
+				if tx.Migrator().HasColumn(&Division{}, column) {
+					continue
+				}
+				err := tx.Migrator().AddColumn(&Division{}, column)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, column := range []string{"MinTags", "MaxTags", "RequiredTags"} {
+				err := tx.Migrator().DropColumn(&Division{}, column)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 12,
+		Name:    "add tag review",
+		Up: func(tx *gorm.DB) error {
+			// already created by the initial migration on new databases
+			if !tx.Migrator().HasColumn(&Division{}, "TagReview") {
+				err := tx.Migrator().AddColumn(&Division{}, "TagReview")
+				if err != nil {
+					return err
+				}
+			}
+			if tx.Migrator().HasColumn(&Tag{}, "Pending") {
+				return nil
+			}
+			err := tx.Migrator().AddColumn(&Tag{}, "Pending")
+			if err != nil {
+				return err
+			}
+			return tx.Migrator().CreateIndex(&Tag{}, "Pending")
+		},
+		Down: func(tx *gorm.DB) error {
+			err := tx.Migrator().DropColumn(&Tag{}, "Pending")
+			if err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&Division{}, "TagReview")
+		},
+	},
+	{
+		Version: 13,
+		Name:    "add tag stats",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&TagDailyStat{}, &TagCooccurrence{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&TagDailyStat{}, &TagCooccurrence{})
+		},
+	},
+	{
+		Version: 14,
+		Name:    "add division status",
+		Up: func(tx *gorm.DB) error {
+			// already created by the initial migration on new databases
+			if !tx.Migrator().HasColumn(&Division{}, "Status") {
+				err := tx.Migrator().AddColumn(&Division{}, "Status")
+				if err != nil {
+					return err
+				}
+			}
+			return tx.Model(&Division{}).Where("hidden = ?", true).
+				Update("status", DivisionStatusHidden).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&Division{}, "Status")
+		},
+	},
+	{
+		Version: 15,
+		Name:    "add image review",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&ImageReview{}, &FloorImage{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&ImageReview{}, &FloorImage{})
+		},
+	},
+	{
+		Version: 16,
+		Name:    "add user reputation",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&UserReputation{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&UserReputation{})
+		},
+	},
+	{
+		Version: 17,
+		Name:    "add link rules",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&LinkRule{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&LinkRule{})
+		},
+	},
+	{
+		Version: 18,
+		Name:    "add report category and outcome",
+		Up: func(tx *gorm.DB) error {
+			// already created by the initial migration on new databases
+			for _, field := range []string{"Category", "Outcome"} {
+				if !tx.Migrator().HasColumn(&Report{}, field) {
+					err := tx.Migrator().AddColumn(&Report{}, field)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			err := tx.Migrator().DropColumn(&Report{}, "Category")
+			if err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&Report{}, "Outcome")
+		},
+	},
+	{
+		Version: 19,
+		Name:    "add report feedback templates",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&ReportFeedbackTemplate{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&ReportFeedbackTemplate{})
+		},
+	},
+	{
+		Version: 20,
+		Name:    "add report votes",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&ReportVote{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&ReportVote{})
+		},
+	},
+	{
+		Version: 21,
+		Name:    "add appeals",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&Appeal{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&Appeal{})
+		},
+	},
+	{
+		Version: 22,
+		Name:    "add hole merging",
+		Up: func(tx *gorm.DB) error {
+			// already created by the initial migration on new databases
+			if !tx.Migrator().HasColumn(&Hole{}, "MergedInto") {
+				err := tx.Migrator().AddColumn(&Hole{}, "MergedInto")
+				if err != nil {
+					return err
+				}
+			}
+			if !tx.Migrator().HasColumn(&Floor{}, "MergedFrom") {
+				return addColumnOnline(tx, &Floor{}, "MergedFrom")
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			err := tx.Migrator().DropColumn(&Hole{}, "MergedInto")
+			if err != nil {
+				return err
+			}
+			return dropColumnOnline(tx, &Floor{}, "MergedFrom")
+		},
+	},
+	{
+		Version: 23,
+		Name:    "add floor type",
+		Up: func(tx *gorm.DB) error {
+			// already created by the initial migration on new databases
+			if !tx.Migrator().HasColumn(&Floor{}, "Type") {
+				return addColumnOnline(tx, &Floor{}, "Type")
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumnOnline(tx, &Floor{}, "Type")
+		},
+	},
+	{
+		Version: 24,
+		Name:    "add bot rules",
+		Up: func(tx *gorm.DB) error {
+			// already created by the initial migration on new databases
+			for _, field := range []string{"BotEnabled", "BotRateLimit"} {
+				if !tx.Migrator().HasColumn(&Division{}, field) {
+					err := tx.Migrator().AddColumn(&Division{}, field)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			return tx.AutoMigrate(&BotRule{})
+		},
+		Down: func(tx *gorm.DB) error {
+			err := tx.Migrator().DropTable(&BotRule{})
+			if err != nil {
+				return err
+			}
+			err = tx.Migrator().DropColumn(&Division{}, "BotEnabled")
+			if err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&Division{}, "BotRateLimit")
+		},
+	},
+	{
+		Version: 25,
+		Name:    "add floor favorites",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&FloorFavoriteGroup{}, &UserFloorFavorite{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&UserFloorFavorite{}, &FloorFavoriteGroup{})
+		},
+	},
+	{
+		Version: 26,
+		Name:    "add hole mutes",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&HoleMute{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&HoleMute{})
+		},
+	},
+	{
+		Version: 27,
+		Name:    "add digests",
+		Up: func(tx *gorm.DB) error {
+			// already created by the migration of notification settings on new databases
+			for _, field := range []string{"Digest", "DigestHour", "DigestSentAt"} {
+				if !tx.Migrator().HasColumn(&NotificationSetting{}, field) {
+					err := tx.Migrator().AddColumn(&NotificationSetting{}, field)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			return tx.AutoMigrate(&UserVisit{})
+		},
+		Down: func(tx *gorm.DB) error {
+			err := tx.Migrator().DropTable(&UserVisit{})
+			if err != nil {
+				return err
+			}
+			for _, field := range []string{"Digest", "DigestHour", "DigestSentAt"} {
+				err = tx.Migrator().DropColumn(&NotificationSetting{}, field)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 28,
+		Name:    "add annual reports",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&AnnualReport{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&AnnualReport{})
+		},
+	},
+	{
+		Version: 29,
+		Name:    "add saved searches",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&SavedSearch{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&SavedSearch{})
+		},
+	},
+	{
+		Version: 30,
+		Name:    "add division settings",
+		Up: func(tx *gorm.DB) error {
+			// already created by the initial migration on new databases
+			if !tx.Migrator().HasColumn(&Division{}, "MutedByDefault") {
+				err := tx.Migrator().AddColumn(&Division{}, "MutedByDefault")
+				if err != nil {
+					return err
+				}
+			}
+			return tx.AutoMigrate(&UserDivisionSetting{})
+		},
+		Down: func(tx *gorm.DB) error {
+			err := tx.Migrator().DropTable(&UserDivisionSetting{})
+			if err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&Division{}, "MutedByDefault")
+		},
+	},
+	{
+		Version: 31,
+		Name:    "add machine hole tags",
+		Up: func(tx *gorm.DB) error {
+			// hole_tags is created from Hole.Tags by the initial migration, without the column
+			if tx.Migrator().HasColumn(&HoleTag{}, "Machine") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&HoleTag{}, "Machine")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&HoleTag{}, "Machine")
+		},
+	},
+	{
+		Version: 32,
+		Name:    "add floor content warning",
+		Up: func(tx *gorm.DB) error {
+			// already created by the initial migration on new databases
+			for _, field := range []string{"Spoiler", "ContentWarning"} {
+				if tx.Migrator().HasColumn(&Floor{}, field) {
+					continue
+				}
+				err := addColumnOnline(tx, &Floor{}, field)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, field := range []string{"Spoiler", "ContentWarning"} {
+				err := dropColumnOnline(tx, &Floor{}, field)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 33,
+		Name:    "add division edit limits",
+		Up: func(tx *gorm.DB) error {
+			// already created by the initial migration on new databases
+			for _, field := range []string{"EditWindow", "MaxEdits"} {
+				if tx.Migrator().HasColumn(&Division{}, field) {
+					continue
+				}
+				err := tx.Migrator().AddColumn(&Division{}, field)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, field := range []string{"EditWindow", "MaxEdits"} {
+				err := tx.Migrator().DropColumn(&Division{}, field)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 34,
+		Name:    "add floor delete category",
+		Up: func(tx *gorm.DB) error {
+			// already created by the initial migration on new databases
+			if tx.Migrator().HasColumn(&Floor{}, "DeleteCategory") {
+				return nil
+			}
+			return addColumnOnline(tx, &Floor{}, "DeleteCategory")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumnOnline(tx, &Floor{}, "DeleteCategory")
+		},
+	},
+	{
+		Version: 35,
+		Name:    "add hole hidden state",
+		Up: func(tx *gorm.DB) error {
+			// already created by the initial migration on new databases
+			if !tx.Migrator().HasColumn(&Hole{}, "HiddenState") {
+				err := tx.Migrator().AddColumn(&Hole{}, "HiddenState")
+				if err != nil {
+					return err
+				}
+			}
+			// holes were only hidden by moderators
+			return tx.Model(&Hole{}).Unscoped().Where("hidden = ?", true).
+				UpdateColumn("hidden_state", HoleHiddenByModerator).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&Hole{}, "HiddenState")
+		},
+	},
+	{
+		Version: 36,
+		Name:    "add user stats",
+		Up: func(tx *gorm.DB) error {
+			err := tx.AutoMigrate(&UserStats{})
+			if err != nil {
+				return err
+			}
+			return backfillUserStats(tx)
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&UserStats{})
+		},
+	},
+	{
+		Version: 37,
+		Name:    "add user badges",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&UserBadge{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&UserBadge{})
+		},
+	},
+	{
+		Version: 38,
+		Name:    "add user checkin",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&UserStats{})
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, column := range []string{"CheckinStreak", "LongestCheckinStreak", "LastCheckinDate"} {
+				err := tx.Migrator().DropColumn(&UserStats{}, column)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 39,
+		Name:    "add raffles",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&Raffle{}, &RaffleEntry{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&Raffle{}, &RaffleEntry{})
+		},
+	},
+	{
+		Version: 40,
+		Name:    "add activities",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&Activity{}, &ActivityReminder{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&Activity{}, &ActivityReminder{})
+		},
+	},
+	{
+		Version: 41,
+		Name:    "add course links",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&CourseLink{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&CourseLink{})
+		},
+	},
+	{
+		Version: 42,
+		Name:    "add legal hold",
+		Up: func(tx *gorm.DB) error {
+			// already created by the initial migration on new databases
+			for _, model := range []any{&Hole{}, &Floor{}} {
+				if tx.Migrator().HasColumn(model, "LegalHold") {
+					continue
+				}
+				err := addColumnOnline(tx, model, "LegalHold")
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, model := range []any{&Hole{}, &Floor{}} {
+				err := dropColumnOnline(tx, model, "LegalHold")
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 43,
+		Name:    "add floor history compressed content",
+		Up: func(tx *gorm.DB) error {
+			// already created by the initial migration on new databases
+			if tx.Migrator().HasColumn(&FloorHistory{}, "CompressedContent") {
+				return nil
+			}
+			return addColumnOnline(tx, &FloorHistory{}, "CompressedContent")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumnOnline(tx, &FloorHistory{}, "CompressedContent")
+		},
+	},
+	{
+		Version: 44,
+		Name:    "add backup markers",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&BackupMarker{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&BackupMarker{})
+		},
+	},
+	{
+		// replaces the primary key and drops foreign keys, a no-op unless FLOOR_PARTITION_HOLES is set on MySQL
+		Version:     45,
+		Name:        "partition floor",
+		Up:          partitionFloorTable,
+		Down:        unpartitionFloorTable,
+		Destructive: true,
+	},
+}
+
+func appliedMigrations() (map[int]SchemaMigration, error) {
+	err := DB.AutoMigrate(&SchemaMigration{})
+	if err != nil {
+		return nil, err
+	}
+	var applied []SchemaMigration
+	err = DB.Order("version").Find(&applied).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[int]SchemaMigration, len(applied))
+	for _, migration := range applied {
+		result[migration.Version] = migration
+	}
+	return result, nil
+}
+
+// MigrationStatus lists all known migrations with applied time
+func MigrationStatus() ([]MigrationState, error) {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	states := make([]MigrationState, len(migrations))
+	for i, migration := range migrations {
+		states[i] = MigrationState{Version: migration.Version, Name: migration.Name, Destructive: migration.Destructive}
+		if record, ok := applied[migration.Version]; ok {
+			states[i].AppliedAt = &record.AppliedAt
+		}
+	}
+	return states, nil
+}
+
+// MigrateUp applies at most n pending migrations, all if n <= 0
+func MigrateUp(n int) (appliedVersions []int, err error) {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	for _, migration := range migrations {
+		if n > 0 && len(appliedVersions) >= n {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		err = DB.Transaction(func(tx *gorm.DB) error {
+			err := migration.Up(tx)
+			if err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return appliedVersions, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		log.Info().Int("version", migration.Version).Str("name", migration.Name).Msg("migration applied")
+		appliedVersions = append(appliedVersions, migration.Version)
+	}
+	return appliedVersions, nil
+}
+
+// MigrateDown reverts the last n applied migrations
+func MigrateDown(n int) (revertedVersions []int, err error) {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(migrations) - 1; i >= 0 && len(revertedVersions) < n; i-- {
+		migration := migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == nil {
+			return revertedVersions, fmt.Errorf("migration %d %s is irreversible", migration.Version, migration.Name)
+		}
+		err = DB.Transaction(func(tx *gorm.DB) error {
+			err := migration.Down(tx)
+			if err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{Version: migration.Version}).Error
+		})
+		if err != nil {
+			return revertedVersions, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		log.Info().Int("version", migration.Version).Str("name", migration.Name).Msg("migration reverted")
+		revertedVersions = append(revertedVersions, migration.Version)
+	}
+	return revertedVersions, nil
+}
+
+// migrateOnStartup refuses to start if the database is migrated by a newer version,
+// if there are pending migrations and AUTO_MIGRATE is off, or if any pending migration is destructive
+// and ALLOW_DESTRUCTIVE_MIGRATIONS is off on an existing database; otherwise applies pending migrations
+func migrateOnStartup() error {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	known := make(map[int]bool, len(migrations))
+	for _, migration := range migrations {
+		known[migration.Version] = true
+	}
+	for version, record := range applied {
+		if !known[version] {
+			return fmt.Errorf("database has unknown migration %d %s, please upgrade treehole", version, record.Name)
+		}
+	}
+
+	if len(applied) == len(migrations) {
+		return nil
+	}
+	// nothing to destroy in a new database
+	if !config.Config.AllowDestructiveMigrations && DB.Migrator().HasTable(&Floor{}) {
+		err = checkDestructiveMigrations(migrations, applied)
+		if err != nil {
+			return err
+		}
+	}
+	if !config.Config.AutoMigrate {
+		return fmt.Errorf("%d pending migrations, please run `treehole migrate up`", len(migrations)-len(applied))
+	}
+	_, err = MigrateUp(0)
+	return err
+}
+
+// checkDestructiveMigrations returns an error if any of migrations not applied is destructive
+func checkDestructiveMigrations(migrations []Migration, applied map[int]SchemaMigration) error {
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; !ok && migration.Destructive {
+			return fmt.Errorf("pending destructive migration %d %s, please back up the database and run `treehole migrate up`, "+
+				"or set ALLOW_DESTRUCTIVE_MIGRATIONS", migration.Version, migration.Name)
+		}
+	}
+	return nil
+}
@@ -3,7 +3,6 @@ package models
 import (
 	"bytes"
 	"context"
-	"errors"
 	"fmt"
 	"io"
 	"math/rand"
@@ -18,7 +17,6 @@ import (
 	"treehole_next/config"
 	"treehole_next/utils"
 
-	"golang.org/x/exp/slices"
 	"gorm.io/gorm/clause"
 
 	"github.com/goccy/go-json"
@@ -28,7 +26,7 @@ const (
 	timeout = time.Second * 10
 )
 
-var client = http.Client{Timeout: timeout}
+var client = http.Client{Timeout: timeout, Transport: utils.TracingTransport{}}
 
 type Notifications []Notification
 
@@ -103,27 +101,20 @@ func (messages Notifications) Send() error {
 	return nil
 }
 
-// check user.config.Notify contain message.Type
-func (message *Notification) checkConfig() {
-	// generate new recipients
-	var newRecipient []int
-
-	// find users
-	var users []User
-	result := DB.Find(&users, "id in ?", message.Recipients)
-	if result.Error != nil {
-		message.Recipients = newRecipient
-		return
+// pushRecipients returns recipients who enabled pushes of message.Type, see NotificationSetting
+func (message *Notification) pushRecipients() ([]int, error) {
+	settings, err := LoadNotificationSettings(DB, message.Recipients)
+	if err != nil {
+		return nil, err
 	}
 
-	// filter recipients
-	for _, user := range users {
-		if slices.Contains(defaultUserConfig.Notify, string(message.Type)) && !slices.Contains(user.Config.Notify, string(message.Type)) {
-			continue
+	var recipients []int
+	for _, userID := range message.Recipients {
+		if settings[userID].Enabled(message.Type) {
+			recipients = append(recipients, userID)
 		}
-		newRecipient = append(newRecipient, user.ID)
 	}
-	message.Recipients = newRecipient
+	return recipients, nil
 }
 
 func (message Notification) Send() (Message, error) {
@@ -132,7 +123,6 @@ func (message Notification) Send() (Message, error) {
 
 	var err error
 
-	message.checkConfig()
 	// return if no recipient
 	if len(message.Recipients) == 0 {
 		return Message{}, nil
@@ -155,16 +145,46 @@ func (message Notification) Send() (Message, error) {
 	if config.Config.NotificationUrl == "" {
 		return Message{}, nil
 	}
+
+	// messages are listed to all recipients, but pushed only to those who enabled
+	message.Recipients, err = message.pushRecipients()
+	if err != nil {
+		log.Err(err).Str("model", "Notification").Msg("load notification settings failed")
+		return Message{}, err
+	}
+	if len(message.Recipients) == 0 {
+		return body, nil
+	}
 	message.Title = utils.StripContent(message.Title, 32)             //varchar(32)
 	message.Description = utils.StripContent(cleanNotificationDescription(message.Description), 64) //varchar(64)
 	body.Title = message.Title
 	body.Description = message.Description
 
+	// bench and simulation
+	if config.Config.Mode == "bench" {
+		time.Sleep(time.Millisecond)
+		return Message{}, nil
+	}
+
+	err = message.push()
+	if err != nil {
+		// the message is saved, retry the push in background, see RetryNotifications
+		log.Err(err).Str("model", "Notification").Msg("error sending notification, will retry")
+		schedulePushRetry(newNotificationJob(message), err)
+	}
+
+	return body, nil
+}
+
+// notificationBreaker fails pushes fast while the notification service is down, the messages are queued for retry
+var notificationBreaker = utils.NewBreaker("notification")
+
+// push sends the notification to NOTIFICATION_URL
+func (message *Notification) push() error {
 	// construct form
 	form, err := json.Marshal(message)
 	if err != nil {
-		log.Err(err).Str("model", "Notification").Msg("error encoding notification")
-		return Message{}, err
+		return err
 	}
 
 	// construct http request
@@ -174,31 +194,29 @@ func (message Notification) Send() (Message, error) {
 		bytes.NewBuffer(form),
 	)
 	if err != nil {
-		log.Err(err).Str("model", "Notification").Msg("error making request")
-		return Message{}, err
+		return err
 	}
 	req.Header.Add("Content-Type", "application/json")
 
-	// bench and simulation
-	if config.Config.Mode == "bench" {
-		time.Sleep(time.Millisecond)
-		return Message{}, nil
-	}
-
 	// get response
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Err(err).Str("model", "Notification").Msg("error sending notification")
-		return Message{}, err
-	}
+	err = notificationBreaker.Do(func() error {
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
 
-	response := readRespNotification(resp.Body)
-	if resp.StatusCode != 201 {
-		log.Error().Str("model", "Notification").Any("response", response).Msg("notification response failed")
-		return Message{}, errors.New(fmt.Sprint(response))
+		response := readRespNotification(resp.Body)
+		if resp.StatusCode != 201 {
+			return fmt.Errorf("notification response %d: %v", resp.StatusCode, response)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	return body, nil
+	notificationDeliveries.WithLabelValues("success").Inc()
+	return nil
 }
 
 var adminList struct {
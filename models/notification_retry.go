@@ -0,0 +1,314 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+
+	"treehole_next/config"
+	"treehole_next/utils"
+)
+
+const (
+	notificationRetryKey = "notification_retry"
+	notificationDeadKey  = "notification_dead"
+
+	notificationRetryBaseDelay = 30 * time.Second
+	notificationRetryMaxDelay  = time.Hour
+	// dead letters beyond are dropped
+	notificationDeadMaxLen = 1000
+)
+
+// notificationDeliveries counts pushes to NOTIFICATION_URL by result:
+// success, failure (will be retried) and dead (no more retries)
+var notificationDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "treehole_notification_deliveries_total",
+	Help: "Pushes to the notification service by result.",
+}, []string{"result"})
+
+// NotificationJob is a failed push waiting for retry, or dead-lettered after all attempts failed
+type NotificationJob struct {
+	ID           string       `json:"id"`
+	Notification Notification `json:"notification"`
+	// attempts made
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// retryDelay returns the exponential backoff after attempts
+func retryDelay(attempts int) time.Duration {
+	delay := notificationRetryBaseDelay
+	for i := 1; i < attempts && delay < notificationRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, notificationRetryMaxDelay)
+}
+
+// notificationQueue stores retry jobs scheduled by next attempt and dead letters,
+// in redis if configured, otherwise in memory
+type notificationQueue interface {
+	Schedule(ctx context.Context, job *NotificationJob) error
+	// PopDue removes and returns at most n jobs whose next attempt is due
+	PopDue(ctx context.Context, now time.Time, n int) ([]NotificationJob, error)
+	PushDead(ctx context.Context, job *NotificationJob) error
+	// ListDead returns dead letters, newest first
+	ListDead(ctx context.Context, offset, size int) ([]NotificationJob, error)
+	// PopDead removes and returns all dead letters
+	PopDead(ctx context.Context) ([]NotificationJob, error)
+}
+
+var (
+	notificationQueueOnce sync.Once
+	notificationQueueImpl notificationQueue
+)
+
+func getNotificationQueue() notificationQueue {
+	notificationQueueOnce.Do(func() {
+		if client := utils.Redis(); client != nil {
+			notificationQueueImpl = &redisNotificationQueue{client: client}
+		} else {
+			notificationQueueImpl = &memoryNotificationQueue{}
+		}
+	})
+	return notificationQueueImpl
+}
+
+// schedulePushRetry records a failed push and schedules a retry, or dead-letters it after max attempts
+func schedulePushRetry(job *NotificationJob, pushErr error) {
+	ctx := context.Background()
+	// pushes rejected by the open breaker are not attempts
+	if !errors.Is(pushErr, utils.ErrBreakerOpen) {
+		job.Attempts++
+	}
+	job.LastError = pushErr.Error()
+	queue := getNotificationQueue()
+
+	var err error
+	if job.Attempts >= config.Config.NotificationMaxAttempts {
+		notificationDeliveries.WithLabelValues("dead").Inc()
+		log.Error().Str("model", "Notification").Str("job", job.ID).Int("attempts", job.Attempts).
+			Str("error", job.LastError).Msg("notification dead-lettered")
+		err = queue.PushDead(ctx, job)
+	} else {
+		notificationDeliveries.WithLabelValues("failure").Inc()
+		job.NextAttempt = time.Now().Add(retryDelay(job.Attempts))
+		err = queue.Schedule(ctx, job)
+	}
+	if err != nil {
+		log.Err(err).Str("model", "Notification").Str("job", job.ID).Msg("save notification job failed")
+	}
+}
+
+func newNotificationJob(message Notification) *NotificationJob {
+	var id [8]byte
+	_, _ = rand.Read(id[:])
+	return &NotificationJob{
+		ID:           hex.EncodeToString(id[:]),
+		Notification: message,
+		CreatedAt:    time.Now(),
+	}
+}
+
+// RetryNotifications pushes due jobs again, returns the number of jobs processed
+func RetryNotifications(n int) (int, error) {
+	jobs, err := getNotificationQueue().PopDue(context.Background(), time.Now(), n)
+	if err != nil {
+		return 0, err
+	}
+	for i := range jobs {
+		err = jobs[i].Notification.push()
+		if err != nil {
+			schedulePushRetry(&jobs[i], err)
+		}
+	}
+	return len(jobs), nil
+}
+
+func ListDeadNotifications(offset, size int) ([]NotificationJob, error) {
+	return getNotificationQueue().ListDead(context.Background(), offset, size)
+}
+
+// RequeueDeadNotifications moves all dead letters back to retry with attempts reset
+func RequeueDeadNotifications() (int, error) {
+	ctx := context.Background()
+	queue := getNotificationQueue()
+	jobs, err := queue.PopDead(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for i := range jobs {
+		jobs[i].Attempts = 0
+		jobs[i].NextAttempt = time.Now()
+		err = queue.Schedule(ctx, &jobs[i])
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(jobs), nil
+}
+
+type redisNotificationQueue struct {
+	client redis.UniversalClient
+}
+
+func (q *redisNotificationQueue) Schedule(ctx context.Context, job *NotificationJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return q.client.ZAdd(ctx, utils.CacheKey(notificationRetryKey), redis.Z{
+		Score:  float64(job.NextAttempt.Unix()),
+		Member: data,
+	}).Err()
+}
+
+func (q *redisNotificationQueue) PopDue(ctx context.Context, now time.Time, n int) ([]NotificationJob, error) {
+	key := utils.CacheKey(notificationRetryKey)
+	members, err := q.client.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.Unix(), 10),
+		Count: int64(n),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]NotificationJob, 0, len(members))
+	for _, member := range members {
+		// another instance may have taken it
+		removed, err := q.client.ZRem(ctx, key, member).Result()
+		if err != nil {
+			return jobs, err
+		}
+		if removed == 0 {
+			continue
+		}
+		var job NotificationJob
+		err = json.Unmarshal([]byte(member), &job)
+		if err != nil {
+			log.Err(err).Str("model", "Notification").Msg("invalid notification job")
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (q *redisNotificationQueue) PushDead(ctx context.Context, job *NotificationJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	key := utils.CacheKey(notificationDeadKey)
+	_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, key, data)
+		pipe.LTrim(ctx, key, 0, notificationDeadMaxLen-1)
+		return nil
+	})
+	return err
+}
+
+func (q *redisNotificationQueue) ListDead(ctx context.Context, offset, size int) ([]NotificationJob, error) {
+	members, err := q.client.LRange(ctx, utils.CacheKey(notificationDeadKey), int64(offset), int64(offset+size-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	return decodeNotificationJobs(members), nil
+}
+
+func (q *redisNotificationQueue) PopDead(ctx context.Context) ([]NotificationJob, error) {
+	key := utils.CacheKey(notificationDeadKey)
+	var members *redis.StringSliceCmd
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		members = pipe.LRange(ctx, key, 0, -1)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return decodeNotificationJobs(members.Val()), nil
+}
+
+func decodeNotificationJobs(members []string) []NotificationJob {
+	jobs := make([]NotificationJob, 0, len(members))
+	for _, member := range members {
+		var job NotificationJob
+		err := json.Unmarshal([]byte(member), &job)
+		if err != nil {
+			log.Err(err).Str("model", "Notification").Msg("invalid notification job")
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+type memoryNotificationQueue struct {
+	sync.Mutex
+	jobs []NotificationJob
+	dead []NotificationJob
+}
+
+func (q *memoryNotificationQueue) Schedule(_ context.Context, job *NotificationJob) error {
+	q.Lock()
+	defer q.Unlock()
+	q.jobs = append(q.jobs, *job)
+	return nil
+}
+
+func (q *memoryNotificationQueue) PopDue(_ context.Context, now time.Time, n int) ([]NotificationJob, error) {
+	q.Lock()
+	defer q.Unlock()
+	var due []NotificationJob
+	pending := q.jobs[:0]
+	for _, job := range q.jobs {
+		if len(due) < n && !job.NextAttempt.After(now) {
+			due = append(due, job)
+		} else {
+			pending = append(pending, job)
+		}
+	}
+	q.jobs = pending
+	return due, nil
+}
+
+func (q *memoryNotificationQueue) PushDead(_ context.Context, job *NotificationJob) error {
+	q.Lock()
+	defer q.Unlock()
+	q.dead = append([]NotificationJob{*job}, q.dead...)
+	if len(q.dead) > notificationDeadMaxLen {
+		q.dead = q.dead[:notificationDeadMaxLen]
+	}
+	return nil
+}
+
+func (q *memoryNotificationQueue) ListDead(_ context.Context, offset, size int) ([]NotificationJob, error) {
+	q.Lock()
+	defer q.Unlock()
+	if offset >= len(q.dead) {
+		return []NotificationJob{}, nil
+	}
+	end := min(offset+size, len(q.dead))
+	return append([]NotificationJob(nil), q.dead[offset:end]...), nil
+}
+
+func (q *memoryNotificationQueue) PopDead(_ context.Context) ([]NotificationJob, error) {
+	q.Lock()
+	defer q.Unlock()
+	dead := q.dead
+	q.dead = nil
+	return dead, nil
+}
@@ -0,0 +1,157 @@
+package models
+
+import (
+	"time"
+
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NotificationSetting controls which event types produce pushes to a user.
+// Messages are always saved and listed in /messages, only pushes are filtered.
+type NotificationSetting struct {
+	UserID int `json:"-" gorm:"primaryKey;autoIncrement:false"`
+
+	// mentioned in a floor
+	Mention bool `json:"mention" gorm:"not null"`
+
+	// new replies in holes of the user
+	Reply bool `json:"reply" gorm:"not null"`
+
+	// new replies in favorite holes
+	Favorite bool `json:"favorite" gorm:"not null"`
+
+	// result of reports submitted by the user
+	ReportResult bool `json:"report_result" gorm:"not null"`
+
+	// modifications, permissions, mails and other notices from the system
+	System bool `json:"system" gorm:"not null"`
+
+	// daily digest of new floors in favorite and subscribed holes, see FlushDigests
+	Digest bool `json:"digest" gorm:"not null;default:false"`
+
+	// hour of day in TZ to send the digest
+	DigestHour int `json:"digest_hour" gorm:"not null;default:8"`
+
+	DigestSentAt *time.Time `json:"-"`
+
+	UpdatedAt time.Time `json:"time_updated"`
+}
+
+const (
+	NotificationCategoryMention      = "mention"
+	NotificationCategoryReply        = "reply"
+	NotificationCategoryFavorite     = "favorite"
+	NotificationCategoryReportResult = "report_result"
+	NotificationCategorySystem       = "system"
+)
+
+// notificationCategory returns the category of message type, empty if it is not controlled by NotificationSetting
+func notificationCategory(messageType MessageType) string {
+	switch messageType {
+	case MessageTypeMention:
+		return NotificationCategoryMention
+	case MessageTypeReply:
+		return NotificationCategoryReply
+	case MessageTypeFavorite:
+		return NotificationCategoryFavorite
+	case MessageTypeReportDealt:
+		return NotificationCategoryReportResult
+	case MessageTypeLike:
+		// controlled by user.config.like_notify, see LikeDigest
+		return ""
+	case MessageTypeDigest:
+		// sent only if opted in, see NotificationSetting.Digest
+		return ""
+	case MessageTypeSavedSearch:
+		// controlled by SavedSearch.Notify
+		return ""
+	default:
+		return NotificationCategorySystem
+	}
+}
+
+// Enabled returns true if pushes of messageType are enabled
+func (setting *NotificationSetting) Enabled(messageType MessageType) bool {
+	switch notificationCategory(messageType) {
+	case NotificationCategoryMention:
+		return setting.Mention
+	case NotificationCategoryReply:
+		return setting.Reply
+	case NotificationCategoryFavorite:
+		return setting.Favorite
+	case NotificationCategoryReportResult:
+		return setting.ReportResult
+	case NotificationCategorySystem:
+		return setting.System
+	default:
+		return true
+	}
+}
+
+// defaultNotificationSetting is used before a user saves settings,
+// keeping the choices of legacy user.config.notify
+func defaultNotificationSetting(user *User) NotificationSetting {
+	notify := user.Config.Notify
+	if notify == nil {
+		notify = defaultUserConfig.Notify
+	}
+	return NotificationSetting{
+		UserID:       user.ID,
+		Mention:      slices.Contains(notify, string(MessageTypeMention)),
+		Reply:        true,
+		Favorite:     slices.Contains(notify, string(MessageTypeFavorite)),
+		ReportResult: true,
+		System:       true,
+		DigestHour:   DefaultDigestHour,
+	}
+}
+
+// LoadNotificationSettings loads settings of users, with defaults for users who have not saved settings
+func LoadNotificationSettings(tx *gorm.DB, userIDs []int) (map[int]*NotificationSetting, error) {
+	settings := make(map[int]*NotificationSetting, len(userIDs))
+	if len(userIDs) == 0 {
+		return settings, nil
+	}
+
+	var saved []NotificationSetting
+	err := tx.Where("user_id IN ?", userIDs).Find(&saved).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range saved {
+		settings[saved[i].UserID] = &saved[i]
+	}
+
+	var missingIDs []int
+	for _, userID := range userIDs {
+		if settings[userID] == nil {
+			missingIDs = append(missingIDs, userID)
+		}
+	}
+	if len(missingIDs) == 0 {
+		return settings, nil
+	}
+	var users []User
+	err = tx.Select("id", "config").Find(&users, missingIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range users {
+		setting := defaultNotificationSetting(&users[i])
+		settings[users[i].ID] = &setting
+	}
+	for _, userID := range missingIDs {
+		// users not found use the default config
+		if settings[userID] == nil {
+			setting := defaultNotificationSetting(&User{ID: userID})
+			settings[userID] = &setting
+		}
+	}
+	return settings, nil
+}
+
+func (setting *NotificationSetting) Save(tx *gorm.DB) error {
+	return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(setting).Error
+}
@@ -0,0 +1,169 @@
+package models
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+
+	"treehole_next/config"
+)
+
+// tools of ONLINE_MIGRATION_TOOL
+const (
+	OnlineMigrationGhost = "gh-ost"
+	OnlineMigrationPtOsc = "pt-online-schema-change"
+)
+
+// OnlineAlter alters a large table, e.g. floor and user_favorites, without blocking writes.
+// alter is the clause after ALTER TABLE, e.g. "ADD COLUMN x int NOT NULL DEFAULT 0".
+//
+// On MySQL with ONLINE_MIGRATION_TOOL set, the tool copies the table in the background and swaps it in;
+// otherwise ALGORITHM=INPLACE, LOCK=NONE is required, which fails instead of locking the table if MySQL can't,
+// e.g. changing partitions.
+// Other databases run ALTER TABLE as is.
+// The tool runs outside the transaction of the migration, so migrations using it must be idempotent.
+func OnlineAlter(tx *gorm.DB, table, alter string) error {
+	if !isMySQL(tx) {
+		return tx.Exec(fmt.Sprintf("ALTER TABLE %s %s", table, alter)).Error
+	}
+	if config.Config.OnlineMigrationTool == "" {
+		// before alter, which may end with partition options
+		return tx.Exec(fmt.Sprintf("ALTER TABLE %s ALGORITHM=INPLACE, LOCK=NONE, %s", table, alter)).Error
+	}
+
+	dsn, err := mysql.ParseDSN(config.Config.DbURL)
+	if err != nil {
+		return err
+	}
+	// credentials are passed in an option file instead of arguments visible to other processes
+	defaultsFile, err := os.CreateTemp("", "treehole-online-migration-*.cnf")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(defaultsFile.Name())
+	}()
+	_, err = fmt.Fprintf(defaultsFile, "[client]\nuser=%s\npassword=%s\n", dsn.User, dsn.Passwd)
+	_ = defaultsFile.Close()
+	if err != nil {
+		return err
+	}
+
+	cmd, err := onlineAlterCommand(config.Config.OnlineMigrationTool, dsn, defaultsFile.Name(), table, alter)
+	if err != nil {
+		return err
+	}
+	cmd.Args = append(cmd.Args, config.Config.OnlineMigrationArgs...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	log.Info().Str("table", table).Str("alter", alter).Str("tool", config.Config.OnlineMigrationTool).Msg("online migration started")
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("%s on %s: %w", config.Config.OnlineMigrationTool, table, err)
+	}
+	log.Info().Str("table", table).Msg("online migration finished")
+	return nil
+}
+
+// addColumnOnline adds the column of the field of model with OnlineAlter on MySQL, like Migrator().AddColumn
+func addColumnOnline(tx *gorm.DB, model any, name string) error {
+	if !isMySQL(tx) {
+		return tx.Migrator().AddColumn(model, name)
+	}
+	stmt := &gorm.Statement{DB: tx}
+	err := stmt.Parse(model)
+	if err != nil {
+		return err
+	}
+	field := stmt.Schema.LookUpField(name)
+	if field == nil {
+		return fmt.Errorf("failed to look up field with name: %s", name)
+	}
+	dataType := tx.Migrator().FullDataTypeOf(field)
+	return OnlineAlter(tx, stmt.Table, fmt.Sprintf("ADD COLUMN %s %s",
+		tx.Statement.Quote(field.DBName), tx.Dialector.Explain(dataType.SQL, dataType.Vars...)))
+}
+
+// dropColumnOnline drops the column of the field of model with OnlineAlter on MySQL, like Migrator().DropColumn
+func dropColumnOnline(tx *gorm.DB, model any, name string) error {
+	if !isMySQL(tx) {
+		return tx.Migrator().DropColumn(model, name)
+	}
+	stmt := &gorm.Statement{DB: tx}
+	err := stmt.Parse(model)
+	if err != nil {
+		return err
+	}
+	if field := stmt.Schema.LookUpField(name); field != nil {
+		name = field.DBName
+	}
+	return OnlineAlter(tx, stmt.Table, "DROP COLUMN "+tx.Statement.Quote(name))
+}
+
+// createIndexOnline creates the index of model with OnlineAlter on MySQL, like Migrator().CreateIndex
+func createIndexOnline(tx *gorm.DB, model any, name string) error {
+	if !isMySQL(tx) {
+		return tx.Migrator().CreateIndex(model, name)
+	}
+	stmt := &gorm.Statement{DB: tx}
+	err := stmt.Parse(model)
+	if err != nil {
+		return err
+	}
+	index := stmt.Schema.LookIndex(name)
+	if index == nil {
+		return fmt.Errorf("failed to look up index with name: %s", name)
+	}
+	columns := make([]string, 0, len(index.Fields))
+	for _, field := range index.Fields {
+		column := tx.Statement.Quote(field.DBName)
+		if field.Sort != "" {
+			column += " " + field.Sort
+		}
+		columns = append(columns, column)
+	}
+	class := ""
+	if index.Class != "" {
+		class = index.Class + " "
+	}
+	return OnlineAlter(tx, stmt.Table, fmt.Sprintf("ADD %sINDEX %s (%s)",
+		class, tx.Statement.Quote(index.Name), strings.Join(columns, ", ")))
+}
+
+func onlineAlterCommand(tool string, dsn *mysql.Config, defaultsFile, table, alter string) (*exec.Cmd, error) {
+	host, port, err := net.SplitHostPort(dsn.Addr)
+	if err != nil {
+		host, port = dsn.Addr, "3306"
+	}
+	switch tool {
+	case OnlineMigrationGhost:
+		return exec.Command(tool,
+			"--conf="+defaultsFile,
+			"--host="+host,
+			"--port="+port,
+			"--database="+dsn.DBName,
+			"--table="+table,
+			"--alter="+alter,
+			"--allow-on-master",
+			"--exact-rowcount",
+			"--concurrent-rowcount",
+			"--initially-drop-ghost-table",
+			"--initially-drop-old-table",
+			"--execute",
+		), nil
+	case OnlineMigrationPtOsc:
+		return exec.Command(tool,
+			"--alter", alter,
+			"--execute",
+			fmt.Sprintf("F=%s,h=%s,P=%s,D=%s,t=%s", defaultsFile, host, port, dsn.DBName, table),
+		), nil
+	default:
+		return nil, fmt.Errorf("unknown online migration tool %q", tool)
+	}
+}
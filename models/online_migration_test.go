@@ -0,0 +1,125 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"treehole_next/config"
+)
+
+func TestOnlineAlterCommand(t *testing.T) {
+	dsn, err := mysql.ParseDSN("user:pass@tcp(db:3307)/treehole?parseTime=true")
+	assert.Nil(t, err)
+
+	cmd, err := onlineAlterCommand(OnlineMigrationGhost, dsn, "/tmp/my.cnf", "floor", "ADD COLUMN x int")
+	assert.Nil(t, err)
+	assert.Contains(t, cmd.Args, "--conf=/tmp/my.cnf")
+	assert.Contains(t, cmd.Args, "--host=db")
+	assert.Contains(t, cmd.Args, "--port=3307")
+	assert.Contains(t, cmd.Args, "--database=treehole")
+	assert.Contains(t, cmd.Args, "--alter=ADD COLUMN x int")
+	assert.Contains(t, cmd.Args, "--execute")
+	for _, arg := range cmd.Args {
+		assert.NotContains(t, arg, "pass")
+	}
+
+	cmd, err = onlineAlterCommand(OnlineMigrationPtOsc, dsn, "/tmp/my.cnf", "user_favorites", "ADD COLUMN x int")
+	assert.Nil(t, err)
+	assert.Equal(t, "F=/tmp/my.cnf,h=db,P=3307,D=treehole,t=user_favorites", cmd.Args[len(cmd.Args)-1])
+
+	_, err = onlineAlterCommand("unknown", dsn, "/tmp/my.cnf", "floor", "ADD COLUMN x int")
+	assert.NotNil(t, err)
+}
+
+func TestCheckDestructiveMigrations(t *testing.T) {
+	migrations := []Migration{{Version: 1, Name: "add"}, {Version: 2, Name: "drop", Destructive: true}}
+	assert.NotNil(t, checkDestructiveMigrations(migrations, map[int]SchemaMigration{1: {Version: 1}}))
+	assert.Nil(t, checkDestructiveMigrations(migrations, map[int]SchemaMigration{1: {Version: 1}, 2: {Version: 2}}))
+	assert.Nil(t, checkDestructiveMigrations(migrations[:1], map[int]SchemaMigration{}))
+}
+
+func TestMigrateOnStartupRefusesDestructive(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:migrate_on_startup?mode=memory&cache=shared"), gormConfig)
+	assert.Nil(t, err)
+	var dropped bool
+	testMigrations := []Migration{
+		{Version: 1, Name: "add", Up: func(tx *gorm.DB) error { return nil }},
+		{Version: 2, Name: "drop", Destructive: true, Up: func(tx *gorm.DB) error {
+			dropped = true
+			return nil
+		}},
+	}
+	defer func(db *gorm.DB, m []Migration, autoMigrate, allow bool) {
+		DB, migrations = db, m
+		config.Config.AutoMigrate, config.Config.AllowDestructiveMigrations = autoMigrate, allow
+	}(DB, migrations, config.Config.AutoMigrate, config.Config.AllowDestructiveMigrations)
+	DB, migrations = db, testMigrations
+	config.Config.AutoMigrate = true
+	// an existing database
+	assert.Nil(t, db.Exec("CREATE TABLE floor (id integer PRIMARY KEY)").Error)
+
+	config.Config.AllowDestructiveMigrations = false
+	err = migrateOnStartup()
+	assert.ErrorContains(t, err, "pending destructive migration 2 drop")
+	assert.False(t, dropped)
+	// nothing is applied, not even migrations before the destructive one
+	applied, err := appliedMigrations()
+	assert.Nil(t, err)
+	assert.Empty(t, applied)
+
+	config.Config.AllowDestructiveMigrations = true
+	assert.Nil(t, migrateOnStartup())
+	assert.True(t, dropped)
+	applied, err = appliedMigrations()
+	assert.Nil(t, err)
+	assert.Len(t, applied, 2)
+}
+
+func TestMigrateOnStartupNewDatabase(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:migrate_new_database?mode=memory&cache=shared"), gormConfig)
+	assert.Nil(t, err)
+	testMigrations := []Migration{
+		{Version: 1, Name: "drop", Destructive: true, Up: func(tx *gorm.DB) error { return nil }},
+	}
+	defer func(db *gorm.DB, m []Migration, autoMigrate, allow bool) {
+		DB, migrations = db, m
+		config.Config.AutoMigrate, config.Config.AllowDestructiveMigrations = autoMigrate, allow
+	}(DB, migrations, config.Config.AutoMigrate, config.Config.AllowDestructiveMigrations)
+	DB, migrations = db, testMigrations
+	config.Config.AutoMigrate = true
+	config.Config.AllowDestructiveMigrations = false
+
+	assert.Nil(t, migrateOnStartup())
+	applied, err := appliedMigrations()
+	assert.Nil(t, err)
+	assert.Len(t, applied, 1)
+}
+
+func TestInitialMigrationExistingDatabase(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:initial_migration?mode=memory&cache=shared"), gormConfig)
+	assert.Nil(t, err)
+	// tables created by AutoMigrate before versioned migrations, in short
+	for _, sql := range []string{
+		"CREATE TABLE division (id integer PRIMARY KEY, name text)",
+		"CREATE TABLE hole (id integer PRIMARY KEY, user_id integer, updated_at datetime)",
+		"CREATE TABLE floor (id integer PRIMARY KEY, hole_id integer, user_id integer)",
+	} {
+		assert.Nil(t, db.Exec(sql).Error)
+	}
+
+	assert.Nil(t, migrations[0].Up(db))
+	assert.True(t, db.Migrator().HasColumn(&Division{}, "RealName"))
+	assert.True(t, db.Migrator().HasIndex(&Floor{}, "idx_floor_user_id"))
+	assert.True(t, db.Migrator().HasIndex(&Hole{}, "idx_hole_user_upd"))
+	// added by the migration of the column instead
+	assert.False(t, db.Migrator().HasColumn(&Floor{}, "Version"))
+	assert.Nil(t, migrations[1].Up(db))
+	assert.True(t, db.Migrator().HasColumn(&Floor{}, "Version"))
+
+	// idempotent
+	assert.Nil(t, migrations[0].Up(db))
+}
@@ -0,0 +1,202 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+
+	"treehole_next/utils"
+)
+
+// roles of users, admin and the global roles are issued by the auth service in the token,
+// division moderators are assigned by admins, see DivisionModerator
+const (
+	UserRoleUser              = "user"
+	UserRoleModerator         = "moderator"
+	UserRoleDivisionModerator = "division_moderator"
+	UserRoleAdmin             = "admin"
+	UserRoleOperator          = "operator"
+)
+
+// actions guarded by roles, see Permissions
+const (
+	PermissionManageDivision   = "division:manage"
+	PermissionManageModerators = "division:moderators"
+	PermissionManageTag        = "tag:manage"
+	PermissionReviewTag        = "tag:review"
+	PermissionModerateHole     = "hole:moderate"
+	PermissionMoveHole         = "hole:move"
+	PermissionMergeHole        = "hole:merge"
+	PermissionModerateFloor    = "floor:moderate"
+	PermissionPunishUser       = "user:punish"
+	PermissionPurgeUser        = "user:purge"
+	PermissionManageReputation = "user:reputation"
+	PermissionBanReporter      = "report:ban"
+	PermissionSendMessage      = "message:send"
+	PermissionRetryMessage     = "message:retry"
+	PermissionManageWebhook    = "webhook:manage"
+	PermissionManageAPIKey     = "api_key:manage"
+	PermissionManageTenant     = "tenant:manage"
+	PermissionManageLinkRule   = "link_rule:manage"
+	PermissionManageBot        = "bot:manage"
+	PermissionManageSearch     = "search:manage"
+	PermissionManageActivity   = "activity:manage"
+	PermissionAuditIdentity    = "identity:audit"
+	PermissionLegalHold        = "legal_hold:manage"
+	PermissionRunRetention     = "retention:run"
+	PermissionManageBackup     = "backup:manage"
+)
+
+// Permissions maps actions to roles allowed to do them, admins are allowed to do everything.
+// Division moderators are only allowed in divisions they moderate.
+var Permissions = map[string][]string{
+	PermissionManageDivision:   {UserRoleOperator},
+	PermissionManageModerators: {},
+	PermissionManageTag:        {UserRoleModerator, UserRoleOperator},
+	PermissionReviewTag:        {UserRoleModerator},
+	PermissionModerateHole:     {UserRoleModerator, UserRoleDivisionModerator},
+	PermissionMoveHole:         {UserRoleModerator},
+	PermissionMergeHole:        {},
+	PermissionModerateFloor:    {UserRoleModerator, UserRoleDivisionModerator},
+	PermissionPunishUser:       {UserRoleModerator, UserRoleDivisionModerator},
+	PermissionPurgeUser:        {},
+	PermissionManageReputation: {},
+	PermissionBanReporter:      {UserRoleModerator},
+	PermissionSendMessage:      {UserRoleOperator},
+	PermissionRetryMessage:     {UserRoleOperator},
+	PermissionManageWebhook:    {UserRoleOperator},
+	PermissionManageAPIKey:     {UserRoleOperator},
+	PermissionManageTenant:     {},
+	PermissionManageLinkRule:   {UserRoleModerator},
+	PermissionManageBot:        {UserRoleOperator},
+	PermissionManageSearch:     {},
+	PermissionManageActivity:   {UserRoleOperator},
+	PermissionAuditIdentity:    {},
+	PermissionLegalHold:        {},
+	PermissionRunRetention:     {},
+	PermissionManageBackup:     {},
+}
+
+// DivisionModerator makes a user moderator of a division
+type DivisionModerator struct {
+	DivisionID int       `json:"division_id" gorm:"primaryKey"`
+	UserID     int       `json:"user_id" gorm:"primaryKey;index"`
+	CreatedAt  time.Time `json:"time_created"`
+}
+
+// SetDivisionModerators replaces moderators of the division with users, duplicates are ignored
+func SetDivisionModerators(tx *gorm.DB, divisionID int, userIDs []int) ([]DivisionModerator, error) {
+	moderators := make([]DivisionModerator, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if !slices.ContainsFunc(moderators, func(moderator DivisionModerator) bool { return moderator.UserID == userID }) {
+			moderators = append(moderators, DivisionModerator{DivisionID: divisionID, UserID: userID})
+		}
+	}
+	err := tx.Where("division_id = ?", divisionID).Delete(&DivisionModerator{}).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(moderators) > 0 {
+		err = tx.Create(&moderators).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return moderators, nil
+}
+
+// ModeratedDivisions returns ids of divisions the user moderates, loaded once per request
+func (user *User) ModeratedDivisions() []int {
+	if user.moderatedDivisions == nil {
+		user.moderatedDivisions = make([]int, 0)
+		DB.Model(&DivisionModerator{}).Where("user_id = ?", user.ID).
+			Order("division_id").Pluck("division_id", &user.moderatedDivisions)
+	}
+	return user.moderatedDivisions
+}
+
+// GetRoles returns global roles of the user, UserRoleDivisionModerator if the user moderates any division
+func (user *User) GetRoles() []string {
+	roles := []string{UserRoleUser}
+	if user.IsAdmin {
+		roles = append(roles, UserRoleAdmin)
+	}
+	for _, role := range []string{UserRoleModerator, UserRoleOperator} {
+		if slices.Contains(user.Roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	if len(user.ModeratedDivisions()) > 0 {
+		roles = append(roles, UserRoleDivisionModerator)
+	}
+	return roles
+}
+
+// Can tells if the user is allowed to do permission in the division, 0 if not in a division
+func (user *User) Can(permission string, divisionID int) bool {
+	if user.IsAdmin {
+		return true
+	}
+	for _, role := range Permissions[permission] {
+		if role == UserRoleDivisionModerator {
+			if divisionID != 0 && slices.Contains(user.ModeratedDivisions(), divisionID) {
+				return true
+			}
+		} else if slices.Contains(user.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// MiddlewarePermission allows users with permission outside divisions to access the route
+func MiddlewarePermission(permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := GetCurrLoginUser(c)
+		if err != nil {
+			return err
+		}
+		if !user.Can(permission, 0) {
+			return utils.NewError(utils.ErrCodePermissionDenied, "无权进行此操作")
+		}
+		return c.Next()
+	}
+}
+
+// EffectivePermissions are actions the user is allowed to do, for clients to show or hide controls
+type EffectivePermissions struct {
+	Roles []string `json:"roles"`
+
+	// allowed everywhere
+	Permissions []string `json:"permissions"`
+
+	// key: division_id value: allowed only in the division
+	Divisions map[int][]string `json:"divisions"`
+}
+
+func (user *User) EffectivePermissions() *EffectivePermissions {
+	result := EffectivePermissions{
+		Roles:       user.GetRoles(),
+		Permissions: make([]string, 0),
+		Divisions:   make(map[int][]string),
+	}
+	for permission := range Permissions {
+		if user.Can(permission, 0) {
+			result.Permissions = append(result.Permissions, permission)
+			continue
+		}
+		for _, divisionID := range user.ModeratedDivisions() {
+			if user.Can(permission, divisionID) {
+				result.Divisions[divisionID] = append(result.Divisions[divisionID], permission)
+			}
+		}
+	}
+	sort.Strings(result.Permissions)
+	for _, permissions := range result.Divisions {
+		sort.Strings(permissions)
+	}
+	return &result
+}
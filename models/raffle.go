@@ -0,0 +1,175 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"treehole_next/utils"
+)
+
+// entries of raffles, see RaffleEntry
+const (
+	// users replying in the hole before the deadline
+	RaffleEntryReply = "reply"
+	// users liking the first floor before the deadline, entries are withdrawn by unliking
+	RaffleEntryLike = "like"
+)
+
+// Raffle draws winners among users entering before the deadline, at most one per hole.
+// The seed is generated when the raffle is created and only its SHA-256 is published until drawn,
+// so anyone can verify winners with the seed and entrants, see DrawRaffleWinners
+type Raffle struct {
+	ID        int       `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"time_created"`
+	UpdatedAt time.Time `json:"time_updated"`
+	HoleID    int       `json:"hole_id" gorm:"not null;uniqueIndex"`
+	CreatedBy int       `json:"-" gorm:"not null"`
+	Entry     string    `json:"entry" gorm:"size:16;not null"`
+	Winners   int       `json:"winners" gorm:"not null"`
+	Deadline  time.Time `json:"deadline" gorm:"not null"`
+	SeedHash  string    `json:"seed_hash" gorm:"size:64;not null"`
+	// hidden until drawn
+	Seed    string     `json:"seed,omitempty" gorm:"size:64;not null"`
+	DrawnAt *time.Time `json:"time_drawn"`
+	// anonynames of entrants in the hole, sorted, set when drawn
+	Entrants []string `json:"entrants" gorm:"serializer:json"`
+	// anonynames of winners in the order drawn
+	Result []string `json:"result" gorm:"serializer:json"`
+	// the system floor announcing the result
+	ResultFloorID int `json:"result_floor_id" gorm:"not null;default:0"`
+}
+
+// RaffleEntry is a user entering a raffle
+type RaffleEntry struct {
+	RaffleID  int       `json:"raffle_id" gorm:"primaryKey;autoIncrement:false"`
+	UserID    int       `json:"-" gorm:"primaryKey;autoIncrement:false"`
+	CreatedAt time.Time `json:"time_created"`
+}
+
+// NewRaffle returns a raffle of the hole with a new seed
+func NewRaffle(holeID, createdBy int, entry string, winners int, deadline time.Time) (*Raffle, error) {
+	seed := make([]byte, 32)
+	_, err := rand.Read(seed)
+	if err != nil {
+		return nil, err
+	}
+	raffle := Raffle{
+		HoleID:    holeID,
+		CreatedBy: createdBy,
+		Entry:     entry,
+		Winners:   winners,
+		Deadline:  deadline,
+		Seed:      hex.EncodeToString(seed),
+	}
+	hash := sha256.Sum256([]byte(raffle.Seed))
+	raffle.SeedHash = hex.EncodeToString(hash[:])
+	return &raffle, nil
+}
+
+// Preprocess hides the seed until drawn
+func (raffle *Raffle) Preprocess(_ *fiber.Ctx) error {
+	if raffle.DrawnAt == nil {
+		raffle.Seed = ""
+	}
+	return nil
+}
+
+// openRaffle returns the raffle of the hole open for the entry at now, nil if none
+func openRaffle(tx *gorm.DB, holeID int, entry string, now time.Time) (*Raffle, error) {
+	var raffles []Raffle
+	err := tx.Where("hole_id = ? AND entry = ? AND deadline > ? AND drawn_at IS NULL", holeID, entry, now).
+		Limit(1).Find(&raffles).Error
+	if err != nil || len(raffles) == 0 {
+		return nil, err
+	}
+	return &raffles[0], nil
+}
+
+// enterRaffle enters the user into the open raffle of the hole for the entry, if any. Do in transaction only
+func enterRaffle(tx *gorm.DB, holeID, userID int, entry string) error {
+	raffle, err := openRaffle(tx, holeID, entry, time.Now())
+	if err != nil || raffle == nil {
+		return err
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&RaffleEntry{RaffleID: raffle.ID, UserID: userID}).Error
+}
+
+// leaveRaffle withdraws the user from the open raffle of the hole for the entry, if any. Do in transaction only
+func leaveRaffle(tx *gorm.DB, holeID, userID int, entry string) error {
+	raffle, err := openRaffle(tx, holeID, entry, time.Now())
+	if err != nil || raffle == nil {
+		return err
+	}
+	return tx.Where("raffle_id = ? AND user_id = ?", raffle.ID, userID).Delete(&RaffleEntry{}).Error
+}
+
+// DrawRaffleWinners draws winners from entrants sorted by anonyname: the i-th winner (from 0) is at index
+// SHA-256(seed + ":" + i) as a big-endian integer modulo the number of entrants left, and removed from them
+func DrawRaffleWinners(seed string, entrants []string, winners int) []string {
+	left := append([]string{}, entrants...)
+	sort.Strings(left)
+	result := make([]string, 0, winners)
+	for i := 0; i < winners && len(left) > 0; i++ {
+		hash := sha256.Sum256([]byte(fmt.Sprintf("%s:%d", seed, i)))
+		index := new(big.Int).Mod(new(big.Int).SetBytes(hash[:]), big.NewInt(int64(len(left)))).Int64()
+		result = append(result, left[index])
+		left = append(left[:index], left[index+1:]...)
+	}
+	return result
+}
+
+// Draw draws winners after the deadline, reveals the seed and announces the result by a system floor.
+// The hole owner doesn't enter. Returns the floor, the caller should update caches and the index
+func (raffle *Raffle) Draw(tx *gorm.DB, hole *Hole, now time.Time) (*Floor, error) {
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(raffle, raffle.ID).Error
+	if err != nil {
+		return nil, err
+	}
+	if raffle.DrawnAt != nil {
+		return nil, utils.NewError(utils.ErrCodeRaffleDrawn, "已经开奖")
+	}
+	if now.Before(raffle.Deadline) {
+		return nil, utils.NewError(utils.ErrCodeRaffleNotEnded, "抽奖尚未截止")
+	}
+
+	var userIDs []int
+	err = tx.Model(&RaffleEntry{}).Where("raffle_id = ? AND user_id <> ?", raffle.ID, hole.UserID).
+		Order("user_id").Pluck("user_id", &userIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	raffle.Entrants = make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		anonyname, err := FindOrGenerateAnonyname(tx, hole.ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		raffle.Entrants = append(raffle.Entrants, anonyname)
+	}
+	sort.Strings(raffle.Entrants)
+	raffle.Result = DrawRaffleWinners(raffle.Seed, raffle.Entrants, raffle.Winners)
+	raffle.DrawnAt = &now
+
+	content := fmt.Sprintf("抽奖结果：共 %d 人参与，中奖者：%s\n种子：%s\n种子 SHA-256：%s",
+		len(raffle.Entrants), strings.Join(raffle.Result, "、"), raffle.Seed, raffle.SeedHash)
+	if len(raffle.Result) == 0 {
+		content = fmt.Sprintf("抽奖结果：无人参与\n种子：%s\n种子 SHA-256：%s", raffle.Seed, raffle.SeedHash)
+	}
+	floor, err := CreateSystemFloor(tx, hole, content)
+	if err != nil {
+		return nil, err
+	}
+	raffle.ResultFloorID = floor.ID
+	err = tx.Model(raffle).Select("Entrants", "Result", "DrawnAt", "ResultFloorID").Updates(raffle).Error
+	return floor, err
+}
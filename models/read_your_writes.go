@@ -0,0 +1,71 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"treehole_next/config"
+	"treehole_next/utils"
+)
+
+const readPrimaryKey = "read_primary"
+
+func readPrimaryCacheKey(userID int) string {
+	return fmt.Sprintf("read_primary_%d", userID)
+}
+
+// MiddlewareReadYourWrites routes reads of a user to the primary database for
+// READ_YOUR_WRITES_SECONDS after a successful mutation of the user,
+// so that a new floor shows up immediately even if replicas lag behind.
+func MiddlewareReadYourWrites(c *fiber.Ctx) error {
+	if len(config.Config.MysqlReplicaURLs) == 0 || config.Config.ReadYourWritesSeconds <= 0 {
+		return c.Next()
+	}
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return c.Next()
+	}
+
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		var wrote bool
+		if utils.GetCache(readPrimaryCacheKey(userID), &wrote) && wrote {
+			c.Locals(readPrimaryKey, true)
+		}
+		return c.Next()
+	}
+
+	err = c.Next()
+	if err == nil && c.Response().StatusCode() < 400 {
+		_ = utils.SetCache(readPrimaryCacheKey(userID), true, time.Duration(config.Config.ReadYourWritesSeconds)*time.Second)
+	}
+	return err
+}
+
+// RequestDB returns DB with the context of the request, so that queries, writes included,
+// are canceled after REQUEST_TIMEOUT, see utils.MiddlewareTimeout. Don't use it in background tasks
+func RequestDB(c *fiber.Ctx) *gorm.DB {
+	if c == nil {
+		return DB
+	}
+	return DB.WithContext(c.UserContext())
+}
+
+// ReadDB returns DB for reads of the request, which reads from the primary database
+// if the user has written recently, see MiddlewareReadYourWrites
+func ReadDB(c *fiber.Ctx) *gorm.DB {
+	if c == nil {
+		return DB
+	}
+	// carry the span of the request, see registerTracingCallbacks
+	db := RequestDB(c)
+	if readPrimary, ok := c.Locals(readPrimaryKey).(bool); ok && readPrimary {
+		return db.Clauses(dbresolver.Write)
+	}
+	return db
+}
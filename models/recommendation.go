@@ -0,0 +1,253 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/exp/maps"
+	"gorm.io/gorm"
+)
+
+// sources of recommendation candidates, also the names of their signals
+const (
+	// holes with tags of holes the user subscribes, favorites or replies
+	RecommendationSourceTag = "tag"
+	// recent holes in divisions the user reads most, approximated by holes the user engages with
+	RecommendationSourceDivision = "division"
+	// hot holes, see RankHotHoles
+	RecommendationSourceHot = "hot"
+)
+
+const (
+	recommendationWindow        = 3 * 24 * time.Hour
+	recommendationEngagedLimit  = 200
+	recommendationCandidateSize = 100
+	recommendationTopTags       = 10
+	recommendationTopDivisions  = 3
+)
+
+// RecommendationCandidate is a hole which may interest a user
+type RecommendationCandidate struct {
+	HoleID int `json:"hole_id"`
+	// signals in [0, 1] by source, 1 for the strongest
+	Signals map[string]float64 `json:"signals"`
+}
+
+// RecommendationScorer scores candidates for a user, higher first.
+// Set Recommender to swap in another implementation, e.g. a remote ML service.
+type RecommendationScorer interface {
+	Score(ctx context.Context, userID int, candidates []RecommendationCandidate) ([]float64, error)
+}
+
+// WeightedScorer scores candidates by the weighted sum of signals
+type WeightedScorer struct {
+	Weights map[string]float64
+}
+
+func (scorer WeightedScorer) Score(_ context.Context, _ int, candidates []RecommendationCandidate) ([]float64, error) {
+	scores := make([]float64, len(candidates))
+	for i, candidate := range candidates {
+		for source, signal := range candidate.Signals {
+			scores[i] += scorer.Weights[source] * signal
+		}
+	}
+	return scores, nil
+}
+
+var defaultRecommender = WeightedScorer{Weights: map[string]float64{
+	RecommendationSourceTag:      3,
+	RecommendationSourceDivision: 1,
+	RecommendationSourceHot:      2,
+}}
+
+// Recommender scores recommendation candidates, falling back to the default weights if it fails
+var Recommender RecommendationScorer = defaultRecommender
+
+// userInterest is what a user engages with: holes subscribed, favorited or replied recently
+type userInterest struct {
+	holeIDs   []int
+	tags      map[int]float64
+	divisions map[int]float64
+}
+
+func loadUserInterest(tx *gorm.DB, userID int) (*userInterest, error) {
+	var holeIDs []int
+	err := tx.Raw(
+		"SELECT hole_id FROM user_subscription WHERE user_id = ? "+
+			"UNION SELECT hole_id FROM user_favorites WHERE user_id = ? "+
+			"UNION SELECT hole_id FROM floor WHERE user_id = ? AND created_at >= ?",
+		userID, userID, userID, time.Now().Add(-30*24*time.Hour),
+	).Scan(&holeIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(holeIDs) > recommendationEngagedLimit {
+		// the latest holes reflect current interest
+		sort.Sort(sort.Reverse(sort.IntSlice(holeIDs)))
+		holeIDs = holeIDs[:recommendationEngagedLimit]
+	}
+
+	interest := userInterest{holeIDs: holeIDs, tags: map[int]float64{}, divisions: map[int]float64{}}
+	if len(holeIDs) == 0 {
+		return &interest, nil
+	}
+
+	var tagCounts []struct {
+		TagID int
+		Count int
+	}
+	err = tx.Model(&HoleTag{}).Select("tag_id, COUNT(*) AS count").Where("hole_id IN ?", holeIDs).
+		Group("tag_id").Order("count desc").Limit(recommendationTopTags).Scan(&tagCounts).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, tagCount := range tagCounts {
+		interest.tags[tagCount.TagID] = float64(tagCount.Count)
+	}
+
+	var divisionCounts []struct {
+		DivisionID int
+		Count      int
+	}
+	err = tx.Model(&Hole{}).Select("division_id, COUNT(*) AS count").Where("id IN ?", holeIDs).
+		Group("division_id").Order("count desc").Limit(recommendationTopDivisions).Scan(&divisionCounts).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, divisionCount := range divisionCounts {
+		interest.divisions[divisionCount.DivisionID] = float64(divisionCount.Count)
+	}
+
+	normalize(interest.tags)
+	normalize(interest.divisions)
+	return &interest, nil
+}
+
+// normalize scales values so that the max is 1
+func normalize(values map[int]float64) {
+	var maxValue float64
+	for _, value := range values {
+		maxValue = max(maxValue, value)
+	}
+	if maxValue == 0 {
+		return
+	}
+	for key := range values {
+		values[key] /= maxValue
+	}
+}
+
+// RecommendHoles returns ids of holes recommended to user, best first. Holes the user
+// has engaged with and holes the user cannot see are excluded.
+func RecommendHoles(ctx context.Context, tx *gorm.DB, user *User, size int) ([]int, error) {
+	interest, err := loadUserInterest(tx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make(map[int]*RecommendationCandidate)
+	addSignal := func(holeID int, source string, signal float64) {
+		candidate := candidates[holeID]
+		if candidate == nil {
+			candidate = &RecommendationCandidate{HoleID: holeID, Signals: map[string]float64{}}
+			candidates[holeID] = candidate
+		}
+		candidate.Signals[source] = max(candidate.Signals[source], signal)
+	}
+
+	since := time.Now().Add(-recommendationWindow)
+	if len(interest.tags) > 0 {
+		var holeTags []HoleTag
+		err = tx.Table("hole_tags").Select("hole_tags.hole_id", "hole_tags.tag_id").
+			Joins("JOIN hole ON hole.id = hole_tags.hole_id").
+			Where("hole_tags.tag_id IN ? AND hole.hidden = ? AND hole.updated_at >= ?", maps.Keys(interest.tags), false, since).
+			Order("hole.updated_at desc").Limit(recommendationCandidateSize).Scan(&holeTags).Error
+		if err != nil {
+			return nil, err
+		}
+		tagSignals := make(map[int]float64)
+		for _, holeTag := range holeTags {
+			tagSignals[holeTag.HoleID] += interest.tags[holeTag.TagID]
+		}
+		normalize(tagSignals)
+		for holeID, signal := range tagSignals {
+			addSignal(holeID, RecommendationSourceTag, signal)
+		}
+	}
+
+	if len(interest.divisions) > 0 {
+		var holes []Hole
+		err = tx.Select("hole.id", "hole.division_id").
+			Where("hole.hidden = ? AND hole.updated_at >= ?", false, since).
+			Where("hole.division_id IN ?", maps.Keys(interest.divisions)).
+			Order("hole.updated_at desc").Limit(recommendationCandidateSize).Find(&holes).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, hole := range holes {
+			addSignal(hole.ID, RecommendationSourceDivision, interest.divisions[hole.DivisionID])
+		}
+	}
+
+	hotHoleIDs, err := ListHotHoleIDs(0, 0, recommendationCandidateSize)
+	if err != nil {
+		return nil, err
+	}
+	for i, holeID := range hotHoleIDs {
+		addSignal(holeID, RecommendationSourceHot, 1-float64(i)/float64(len(hotHoleIDs)))
+	}
+
+	for _, holeID := range interest.holeIDs {
+		delete(candidates, holeID)
+	}
+	if len(candidates) == 0 {
+		return []int{}, nil
+	}
+
+	// candidates may be hidden, invisible to the user or in divisions muted by the user
+	visible, err := WhereVisibleDivisions(tx.Model(&Hole{}).Where("hole.hidden = ?", false), user)
+	if err != nil {
+		return nil, err
+	}
+	visible, err = whereNotMutedDivisions(visible, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	var visibleIDs []int
+	err = visible.Where("hole.id IN ?", maps.Keys(candidates)).Pluck("hole.id", &visibleIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	list := make([]RecommendationCandidate, 0, len(visibleIDs))
+	for _, holeID := range visibleIDs {
+		list = append(list, *candidates[holeID])
+	}
+
+	scores, err := Recommender.Score(ctx, user.ID, list)
+	if err == nil && len(scores) != len(list) {
+		err = fmt.Errorf("recommender returned %d scores for %d candidates", len(scores), len(list))
+	}
+	if err != nil {
+		log.Err(err).Int("user_id", user.ID).Msg("recommender failed, fallback to default")
+		scores, _ = defaultRecommender.Score(ctx, user.ID, list)
+	}
+	order := make([]int, len(list))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		if scores[order[i]] != scores[order[j]] {
+			return scores[order[i]] > scores[order[j]]
+		}
+		return list[order[i]].HoleID > list[order[j]].HoleID
+	})
+
+	holeIDs := make([]int, 0, min(size, len(order)))
+	for _, i := range order[:min(size, len(order))] {
+		holeIDs = append(holeIDs, list[i].HoleID)
+	}
+	return holeIDs, nil
+}
@@ -0,0 +1,181 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+
+	"treehole_next/config"
+)
+
+var replicaUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "treehole_db_replica_up",
+	Help: "Whether the last health probe of the read replica succeeded.",
+}, []string{"replica", "region"})
+
+var replicaLatency = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "treehole_db_replica_latency_seconds",
+	Help: "Moving average of ping latency of the read replica.",
+}, []string{"replica", "region"})
+
+const (
+	// replicas slower than the fastest by no more than the tolerance share reads randomly, so that one replica is not overloaded
+	replicaLatencyTolerance = 2 * time.Millisecond
+	// weight of the latest probe in the moving average of latency
+	replicaLatencyAlpha = 0.3
+)
+
+// replica is a read replica probed for health and latency, see replicaPolicy
+type replica struct {
+	name   string
+	region string
+	// a connection used by probes only, reads go through the pool of dbresolver
+	db *sql.DB
+
+	healthy bool
+	latency time.Duration
+}
+
+// parseReplicaURL parses an entry of MYSQL_REPLICA_URL, a DSN optionally prefixed with the region in brackets,
+// e.g. [shanghai]user:pass@tcp(10.0.1.2:3306)/treehole?parseTime=true
+func parseReplicaURL(url string) (region, dsn string) {
+	if strings.HasPrefix(url, "[") {
+		if end := strings.Index(url, "]"); end > 0 {
+			return url[1:end], url[end+1:]
+		}
+	}
+	return "", url
+}
+
+func newReplica(index int, region string, db *sql.DB) *replica {
+	return &replica{name: fmt.Sprintf("mysql_replica_%d", index), region: region, db: db, healthy: true}
+}
+
+// replicaPolicy routes reads to the healthy replica with the lowest latency, preferring replicas in DB_REGION.
+// The source database is registered as the last replica of dbresolver, reads fail over to it if no replica is healthy
+type replicaPolicy struct {
+	sync.RWMutex
+	replicas []*replica
+	region   string
+}
+
+var replicas = &replicaPolicy{}
+
+func (policy *replicaPolicy) Resolve(connPools []gorm.ConnPool) gorm.ConnPool {
+	index := policy.choose(rand.Intn)
+	if index < 0 || index >= len(connPools) {
+		return connPools[len(connPools)-1]
+	}
+	return connPools[index]
+}
+
+// choose returns the index of the replica to read from, -1 if no replica is healthy
+func (policy *replicaPolicy) choose(randN func(n int) int) int {
+	policy.RLock()
+	defer policy.RUnlock()
+
+	candidates := make([]int, 0, len(policy.replicas))
+	local := false
+	for i, replica := range policy.replicas {
+		if !replica.healthy {
+			continue
+		}
+		isLocal := policy.region != "" && replica.region == policy.region
+		if isLocal && !local {
+			// remote replicas are used only if no local replica is healthy
+			candidates = candidates[:0]
+			local = true
+		}
+		if isLocal == local {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return -1
+	}
+
+	fastest := policy.replicas[candidates[0]].latency
+	for _, i := range candidates {
+		fastest = min(fastest, policy.replicas[i].latency)
+	}
+	chosen := candidates[:0]
+	for _, i := range candidates {
+		if policy.replicas[i].latency <= fastest+replicaLatencyTolerance {
+			chosen = append(chosen, i)
+		}
+	}
+	return chosen[randN(len(chosen))]
+}
+
+// probe pings each replica, a replica failing the ping is not read from until a ping succeeds
+func (policy *replicaPolicy) probe(ctx context.Context) {
+	policy.RLock()
+	list := policy.replicas
+	policy.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, replica := range list {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, config.Config.ReplicaProbeInterval)
+			defer cancel()
+			start := time.Now()
+			err := replica.db.PingContext(ctx)
+			policy.record(replica, time.Since(start), err)
+		}()
+	}
+	wg.Wait()
+}
+
+func (policy *replicaPolicy) record(replica *replica, latency time.Duration, err error) {
+	policy.Lock()
+	defer policy.Unlock()
+
+	if err != nil {
+		if replica.healthy {
+			log.Err(err).Str("replica", replica.name).Str("region", replica.region).Msg("replica down, reads fail over")
+		}
+		replica.healthy = false
+		replicaUp.WithLabelValues(replica.name, replica.region).Set(0)
+		return
+	}
+	if !replica.healthy {
+		log.Info().Str("replica", replica.name).Str("region", replica.region).Msg("replica up")
+		replica.healthy = true
+		replica.latency = latency
+	} else if replica.latency == 0 {
+		// the first probe
+		replica.latency = latency
+	} else {
+		replica.latency = time.Duration(replicaLatencyAlpha*float64(latency) + (1-replicaLatencyAlpha)*float64(replica.latency))
+	}
+	replicaUp.WithLabelValues(replica.name, replica.region).Set(1)
+	replicaLatency.WithLabelValues(replica.name, replica.region).Set(replica.latency.Seconds())
+}
+
+// ProbeReplicas probes read replicas every REPLICA_PROBE_INTERVAL until ctx is done
+func ProbeReplicas(ctx context.Context) {
+	if len(replicas.replicas) == 0 {
+		return
+	}
+	ticker := time.NewTicker(config.Config.ReplicaProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			replicas.probe(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReplicaURL(t *testing.T) {
+	region, dsn := parseReplicaURL("[shanghai]user:pass@tcp(10.0.1.2:3306)/treehole?parseTime=true")
+	assert.Equal(t, "shanghai", region)
+	assert.Equal(t, "user:pass@tcp(10.0.1.2:3306)/treehole?parseTime=true", dsn)
+
+	region, dsn = parseReplicaURL("user:pass@tcp(10.0.1.2:3306)/treehole")
+	assert.Equal(t, "", region)
+	assert.Equal(t, "user:pass@tcp(10.0.1.2:3306)/treehole", dsn)
+}
+
+func TestReplicaPolicy(t *testing.T) {
+	policy := &replicaPolicy{region: "shanghai", replicas: []*replica{
+		newReplica(0, "beijing", nil),
+		newReplica(1, "shanghai", nil),
+		newReplica(2, "shanghai", nil),
+	}}
+	first := func(int) int { return 0 }
+	policy.record(policy.replicas[0], time.Millisecond, nil)
+	policy.record(policy.replicas[1], 30*time.Millisecond, nil)
+	policy.record(policy.replicas[2], 10*time.Millisecond, nil)
+
+	// the fastest replica in the region
+	assert.Equal(t, 2, policy.choose(first))
+
+	// replicas within the tolerance share reads
+	policy.replicas[1].latency = 11 * time.Millisecond
+	assert.Equal(t, 1, policy.choose(first))
+	assert.Equal(t, 2, policy.choose(func(n int) int { return n - 1 }))
+
+	// other regions if no replica in the region is healthy
+	policy.record(policy.replicas[1], 0, errors.New("down"))
+	policy.record(policy.replicas[2], 0, errors.New("down"))
+	assert.Equal(t, 0, policy.choose(first))
+
+	// the source if no replica is healthy
+	policy.record(policy.replicas[0], 0, errors.New("down"))
+	assert.Equal(t, -1, policy.choose(first))
+
+	// back after a successful probe
+	policy.record(policy.replicas[2], 5*time.Millisecond, nil)
+	assert.Equal(t, 2, policy.choose(first))
+	assert.Equal(t, 5*time.Millisecond, policy.replicas[2].latency)
+}
@@ -22,11 +22,56 @@ type Report struct {
 	HoleID    int       `json:"hole_id" gorm:"-:all"`
 	Floor     *Floor    `json:"floor" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 	UserID    int       `json:"-"` // the reporter's id, should keep a secret
-	Reason    string    `json:"reason" gorm:"size:128"`
-	Dealt     bool      `json:"dealt"` // the report has been dealt
+	// reason of the report, see ReportCategories
+	Category string `json:"category" gorm:"size:32;not null;default:other"`
+	// detail of the reason, required if the category is other
+	Reason string `json:"reason" gorm:"size:128"`
+	Dealt  bool   `json:"dealt"` // the report has been dealt
 	// who dealt the report
 	DealtBy int    `json:"dealt_by" gorm:"index"`
 	Result  string `json:"result" gorm:"size:128"` // deal result
+	// outcome of the dealt report, see ReportOutcomes, empty if not specified
+	Outcome string `json:"outcome" gorm:"size:16;not null;default:''"`
+}
+
+// categories of reports
+const (
+	ReportCategorySpam           = "spam"
+	ReportCategoryAbuse          = "abuse"
+	ReportCategoryPorn           = "porn"
+	ReportCategoryIllegal        = "illegal"
+	ReportCategoryPrivacy        = "privacy"
+	ReportCategoryMisinformation = "misinformation"
+	ReportCategoryOther          = "other"
+)
+
+// ReportCategories maps categories to names shown to admins
+var ReportCategories = map[string]string{
+	ReportCategorySpam:           "垃圾广告",
+	ReportCategoryAbuse:          "人身攻击",
+	ReportCategoryPorn:           "色情低俗",
+	ReportCategoryIllegal:        "违法违规",
+	ReportCategoryPrivacy:        "泄露隐私",
+	ReportCategoryMisinformation: "不实信息",
+	ReportCategoryOther:          "其他",
+}
+
+// outcomes of dealt reports
+const (
+	ReportOutcomeRemoved     = "removed"
+	ReportOutcomeNoViolation = "no_violation"
+)
+
+// ReasonText is the category name with the detail, if any
+func (report *Report) ReasonText() string {
+	name, ok := ReportCategories[report.Category]
+	if !ok {
+		name = ReportCategories[ReportCategoryOther]
+	}
+	if report.Reason == "" {
+		return name
+	}
+	return name + "：" + report.Reason
 }
 
 func (report *Report) GetID() int {
@@ -66,7 +111,7 @@ func (report *Report) Create(c *fiber.Ctx, db ...*gorm.DB) error {
 	if len(db) > 0 {
 		tx = db[0]
 	} else {
-		tx = DB
+		tx = RequestDB(c)
 	}
 	userID, err := common.GetUserID(c)
 	if err != nil {
@@ -102,8 +147,10 @@ func (report *Report) Create(c *fiber.Ctx, db ...*gorm.DB) error {
 	} else {
 		existingReport.Reason = existingReport.Reason + "\n" + report.Reason
 		err = tx.Model(&existingReport).Updates(map[string]any{
-			"reason": existingReport.Reason,
-			"dealt":  false,
+			"category": report.Category,
+			"reason":   existingReport.Reason,
+			"dealt":    false,
+			"outcome":  "",
 		}).Error // update reason and load floor in AfterUpdate hook
 		if err != nil {
 			return err
@@ -157,7 +204,7 @@ func (report *Report) SendCreate(_ *gorm.DB) error {
 		Recipients: userIDs,
 		Description: fmt.Sprintf(
 			"理由：%s，内容：%s",
-			report.Reason,
+			report.ReasonText(),
 			report.Floor.Content,
 		),
 		Title: "您有举报需要处理",
@@ -174,20 +221,21 @@ func (report *Report) SendModify(_ *gorm.DB) error {
 	// get recipients
 	userIDs := []int{report.UserID}
 
-	// construct message
+	// construct message by the template of the outcome
+	title, description, err := report.ReportFeedback()
+	if err != nil {
+		return err
+	}
 	message := Notification{
-		Data:       report,
-		Recipients: userIDs,
-		Description: fmt.Sprintf(
-			"处理结果：%s\n感谢您为维护社区秩序所做的贡献。",
-			report.Result,
-		),
-		Title: "您的举报已得到处理",
-		Type:  MessageTypeReportDealt,
-		URL:   fmt.Sprintf("/api/reports/%d", report.ID),
+		Data:        report,
+		Recipients:  userIDs,
+		Description: description,
+		Title:       title,
+		Type:        MessageTypeReportDealt,
+		URL:         fmt.Sprintf("/api/reports/%d", report.ID),
 	}
 
 	// send
-	_, err := message.Send()
+	_, err = message.Send()
 	return err
 }
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"treehole_next/utils"
+)
+
+// ReportOutcomeDefault is the template outcome of reports dealt without an outcome
+const ReportOutcomeDefault = "default"
+
+// ReportFeedbackTemplate is the message sent to reporters when their reports are dealt, by outcome.
+// Placeholders {result}, {category}, {reason}, {floor_id} and {hole_id} are replaced, see ReportFeedback
+type ReportFeedbackTemplate struct {
+	Outcome   string    `json:"outcome" gorm:"primaryKey;size:16"`
+	UpdatedAt time.Time `json:"time_updated"`
+	Title     string    `json:"title" gorm:"size:64;not null"`
+	Content   string    `json:"content" gorm:"size:1024;not null"`
+	// admin who modified the template, 0 for built-in templates
+	UpdatedBy int `json:"updated_by"`
+}
+
+type ReportFeedbackTemplates []ReportFeedbackTemplate
+
+// DefaultReportFeedbackTemplates are used until modified by admins
+var DefaultReportFeedbackTemplates = ReportFeedbackTemplates{
+	{
+		Outcome: ReportOutcomeRemoved,
+		Title:   "您的举报已得到处理",
+		Content: "您举报的内容 ##{floor_id} 经核实违反社区规范，已被处理。\n处理结果：{result}\n感谢您为维护社区秩序所做的贡献。",
+	},
+	{
+		Outcome: ReportOutcomeNoViolation,
+		Title:   "您的举报已得到处理",
+		Content: "您举报的内容 ##{floor_id} 经核实未发现违规。\n处理结果：{result}\n感谢您的反馈。",
+	},
+	{
+		Outcome: ReportOutcomeDefault,
+		Title:   "您的举报已得到处理",
+		Content: "处理结果：{result}\n感谢您为维护社区秩序所做的贡献。",
+	},
+}
+
+const reportFeedbackTemplatesCacheKey = "report_feedback_templates"
+
+// LoadReportFeedbackTemplates returns templates of all outcomes, defaults if not modified, cached until modified
+func LoadReportFeedbackTemplates() (templates ReportFeedbackTemplates, err error) {
+	if utils.GetCache(reportFeedbackTemplatesCacheKey, &templates) {
+		return templates, nil
+	}
+	var modified ReportFeedbackTemplates
+	err = DB.Find(&modified).Error
+	if err != nil {
+		return nil, err
+	}
+	templates = make(ReportFeedbackTemplates, 0, len(DefaultReportFeedbackTemplates))
+	for _, template := range DefaultReportFeedbackTemplates {
+		for _, m := range modified {
+			if m.Outcome == template.Outcome {
+				template = m
+			}
+		}
+		templates = append(templates, template)
+	}
+	return templates, utils.SetCache(reportFeedbackTemplatesCacheKey, templates, 0)
+}
+
+func DeleteReportFeedbackTemplatesCache() error {
+	return utils.DeleteCache(reportFeedbackTemplatesCacheKey)
+}
+
+// ReportFeedback returns the title and content of the message to the reporter of a dealt report
+func (report *Report) ReportFeedback() (title, content string, err error) {
+	templates, err := LoadReportFeedbackTemplates()
+	if err != nil {
+		return "", "", err
+	}
+	outcome := report.Outcome
+	if outcome == "" {
+		outcome = ReportOutcomeDefault
+	}
+	var template ReportFeedbackTemplate
+	for _, t := range templates {
+		if t.Outcome == outcome || t.Outcome == ReportOutcomeDefault && template.Outcome == "" {
+			template = t
+		}
+	}
+
+	var holeID int
+	if report.Floor != nil {
+		holeID = report.Floor.HoleID
+	}
+	replacer := strings.NewReplacer(
+		"{result}", report.Result,
+		"{category}", ReportCategories[report.Category],
+		"{reason}", report.Reason,
+		"{floor_id}", strconv.Itoa(report.FloorID),
+		"{hole_id}", strconv.Itoa(holeID),
+	)
+	return template.Title, replacer.Replace(template.Content), nil
+}
@@ -2,11 +2,12 @@ package models
 
 import (
 	"errors"
-	"github.com/opentreehole/go-common"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"gorm.io/plugin/dbresolver"
 	"time"
+
+	"treehole_next/utils"
 )
 
 type ReportPunishment struct {
@@ -57,7 +58,7 @@ func (reportPunishment *ReportPunishment) Create() (*User, error) {
 		var punishmentRecord ReportPunishment
 		err = tx.Where("user_id = ? and report_id = ?", user.ID, reportPunishment.ReportId).Take(&punishmentRecord).Error
 		if err == nil {
-			return common.Forbidden("该用户已被限制使用举报功能")
+			return utils.NewError(utils.ErrCodeUserBannedFromReport, "该用户已被限制使用举报功能")
 		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
 			return err
 		}
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+
+	"treehole_next/config"
+	"treehole_next/utils"
+)
+
+// votes of jurors, see ReportVote
+const (
+	ReportVoteHide = "hide"
+	ReportVoteKeep = "keep"
+)
+
+// ReportVote is a vote of a juror on a report, kept for audit.
+// Users opted in with UserConfig.Jury and reputation high enough are jurors, the verdict of the majority is applied
+// when votes reach config.JuryQuorum, ties keep the content.
+type ReportVote struct {
+	ReportID  int       `json:"report_id" gorm:"primaryKey;autoIncrement:false"`
+	UserID    int       `json:"user_id" gorm:"primaryKey;autoIncrement:false;index"`
+	CreatedAt time.Time `json:"time_created"`
+	Vote      string    `json:"vote" gorm:"size:8;not null"`
+}
+
+type ReportVotes []ReportVote
+
+// JuryReport is a report shown to jurors, the reporter, the poster and the hole are not included
+type JuryReport struct {
+	ReportID  int       `json:"report_id"`
+	CreatedAt time.Time `json:"time_created"`
+	Category  string    `json:"category"`
+	Reason    string    `json:"reason"`
+	Content   string    `json:"content"`
+}
+
+// CheckJuror returns ErrCodeNotJuror if the jury is disabled, the user didn't opt in or the reputation is too low
+func (user *User) CheckJuror() error {
+	if config.Config.JuryQuorum > 0 && user.Config.Jury {
+		reputation, err := LoadReputation(user.ID, user.JoinedTime)
+		if err != nil {
+			return err
+		}
+		if reputation.Value() >= config.Config.JuryMinReputation {
+			return nil
+		}
+	}
+	return utils.NewError(utils.ErrCodeNotJuror, "您暂时不能参与众裁")
+}
+
+// LoadJuryReports returns reports not dealt to the juror, except those the juror reported, posted or voted on
+func LoadJuryReports(user *User, size int) ([]JuryReport, error) {
+	reports := make([]JuryReport, 0, size)
+	err := DB.Table("report").
+		Select("report.id AS report_id, report.created_at, report.category, report.reason, floor.content").
+		Joins("JOIN floor ON floor.id = report.floor_id").
+		Where("report.dealt = ? AND floor.deleted = ? AND report.user_id <> ? AND floor.user_id <> ?",
+			false, false, user.ID, user.ID).
+		Where("report.id NOT IN (?)", DB.Model(&ReportVote{}).Select("report_id").Where("user_id = ?", user.ID)).
+		Order("report.id").Limit(size).
+		Scan(&reports).Error
+	return reports, err
+}
+
+// Vote saves the vote of the juror and applies the verdict if votes reach the quorum.
+// Returns the verdict, empty if not reached yet
+func (report *Report) Vote(userID int, vote string) (verdict string, err error) {
+	var floor Floor
+	var hidden bool
+	err = DB.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(report, report.ID).Error
+		if err != nil {
+			return err
+		}
+		if report.Dealt {
+			return utils.NewError(utils.ErrCodeReportDealt, "该举报已处理")
+		}
+		err = tx.Take(&floor, report.FloorID).Error
+		if err != nil {
+			return err
+		}
+		if report.UserID == userID || floor.UserID == userID {
+			return utils.NewError(utils.ErrCodeNotJuror, "您暂时不能参与众裁")
+		}
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&ReportVote{ReportID: report.ID, UserID: userID, Vote: vote})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return utils.NewError(utils.ErrCodeAlreadyVoted, "您已对该举报投票")
+		}
+
+		var counts []struct {
+			Vote  string
+			Count int
+		}
+		err = tx.Model(&ReportVote{}).Select("vote, COUNT(*) AS count").
+			Where("report_id = ?", report.ID).Group("vote").Scan(&counts).Error
+		if err != nil {
+			return err
+		}
+		votes := make(map[string]int)
+		for _, count := range counts {
+			votes[count.Vote] = count.Count
+		}
+		if votes[ReportVoteHide]+votes[ReportVoteKeep] < config.Config.JuryQuorum {
+			return nil
+		}
+
+		verdict = ReportVoteKeep
+		report.Outcome = ReportOutcomeNoViolation
+		if votes[ReportVoteHide] > votes[ReportVoteKeep] {
+			verdict = ReportVoteHide
+			report.Outcome = ReportOutcomeRemoved
+		}
+		if verdict == ReportVoteHide && !floor.Deleted {
+			err = floor.Backup(tx, 0, "社区众裁")
+			if err != nil {
+				return err
+			}
+			floor.Deleted = true
+			floor.Content = "该内容因违反社区规范被删除"
+			err = tx.Model(&floor).Select("Deleted", "Content").Updates(&floor).Error
+			if err != nil {
+				return err
+			}
+			hidden = true
+		}
+		report.Dealt = true
+		report.DealtBy = 0
+		report.Result = fmt.Sprintf("社区众裁：%d 票隐藏，%d 票保留", votes[ReportVoteHide], votes[ReportVoteKeep])
+		return tx.Model(report).Select("Dealt", "DealtBy", "Result", "Outcome").Updates(report).Error
+	})
+	if err != nil || verdict == "" {
+		return verdict, err
+	}
+
+	log.Info().Int("report_id", report.ID).Str("verdict", verdict).Msg("jury verdict applied")
+	if report.Outcome == ReportOutcomeRemoved {
+		TriggerBadges(report.UserID, BadgeEventReport)
+	}
+	if hidden {
+		err = DeleteHoleCache(DB, floor.HoleID)
+		if err != nil {
+			return verdict, err
+		}
+		utils.Go(func() { FloorDelete(floor.ID) })
+	}
+	report.Floor = &floor
+	err = report.SendModify(DB)
+	if err != nil {
+		log.Err(err).Str("model", "Notification").Msg("SendModify failed")
+	}
+	return verdict, nil
+}
+
+// LoadReportVotes returns votes on the report for audit, oldest first
+func LoadReportVotes(reportID int) (ReportVotes, error) {
+	votes := ReportVotes{}
+	err := DB.Where("report_id = ?", reportID).Order("created_at").Find(&votes).Error
+	return votes, err
+}
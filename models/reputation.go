@@ -0,0 +1,182 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"mvdan.cc/xurls/v2"
+
+	"treehole_next/config"
+	"treehole_next/utils"
+)
+
+// weights of reputation, likes and punishments decay by half every half-life, see UserReputation.Refresh
+const (
+	ReputationRefreshInterval    = time.Hour
+	ReputationMaxAgePoints       = 30
+	ReputationMaxLikePoints      = 50
+	ReputationLikeHalfLife       = 90 * 24 * time.Hour
+	ReputationPunishmentPenalty  = 20
+	ReputationPunishmentHalfLife = 180 * 24 * time.Hour
+)
+
+// UserReputation is computed from account age, likes received and punishments, i.e. reports upheld,
+// to gate privileges of new or abusive users. Admins may override the score.
+type UserReputation struct {
+	UserID    int       `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	UpdatedAt time.Time `json:"time_updated"`
+	// from the token of the user, saved to compute the age when loaded by others
+	JoinedTime *time.Time `json:"joined_time"`
+	// likes received, decayed
+	Likes float64 `json:"likes" gorm:"not null;default:0"`
+	// punishments received, decayed
+	Punishments float64 `json:"punishments" gorm:"not null;default:0"`
+	// computed score
+	Score int `json:"score" gorm:"not null;default:0"`
+	// set by admins, replaces the computed score if not null
+	Override *int `json:"override"`
+}
+
+// Value is the effective score, the override if set
+func (reputation *UserReputation) Value() int {
+	if reputation.Override != nil {
+		return *reputation.Override
+	}
+	return reputation.Score
+}
+
+// decay returns the weight of an event at t, halved every halfLife
+func decay(t, now time.Time, halfLife time.Duration) float64 {
+	return math.Pow(0.5, float64(now.Sub(t))/float64(halfLife))
+}
+
+// Refresh recomputes the score, events older than 4 half-lives are ignored
+func (reputation *UserReputation) Refresh(tx *gorm.DB, now time.Time) error {
+	var likes []struct {
+		Like      int
+		CreatedAt time.Time
+	}
+	err := tx.Model(&Floor{}).Select(Quote("like"), "created_at").
+		Where("user_id = ? AND deleted = ? AND "+Quote("like")+" > 0 AND created_at >= ?",
+			reputation.UserID, false, now.Add(-4*ReputationLikeHalfLife)).
+		Scan(&likes).Error
+	if err != nil {
+		return err
+	}
+	reputation.Likes = 0
+	for _, like := range likes {
+		reputation.Likes += float64(like.Like) * decay(like.CreatedAt, now, ReputationLikeHalfLife)
+	}
+
+	var punishedTimes []time.Time
+	err = tx.Model(&Punishment{}).
+		Where("user_id = ? AND created_at >= ?", reputation.UserID, now.Add(-4*ReputationPunishmentHalfLife)).
+		Pluck("created_at", &punishedTimes).Error
+	if err != nil {
+		return err
+	}
+	reputation.Punishments = 0
+	for _, punishedTime := range punishedTimes {
+		reputation.Punishments += decay(punishedTime, now, ReputationPunishmentHalfLife)
+	}
+
+	score := min(reputation.Likes, ReputationMaxLikePoints) - reputation.Punishments*ReputationPunishmentPenalty
+	if reputation.JoinedTime != nil {
+		score += min(now.Sub(*reputation.JoinedTime).Hours()/24, ReputationMaxAgePoints)
+	}
+	reputation.Score = int(math.Round(score))
+	reputation.UpdatedAt = now
+	return nil
+}
+
+// LoadReputation loads the reputation of the user, refreshed if older than ReputationRefreshInterval.
+// joinedTime is saved if not zero, it's only known from the token of the user.
+func LoadReputation(userID int, joinedTime time.Time) (*UserReputation, error) {
+	reputation := UserReputation{UserID: userID}
+	err := DB.Take(&reputation, userID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	now := time.Now()
+	joinedTimeChanged := !joinedTime.IsZero() && (reputation.JoinedTime == nil || !reputation.JoinedTime.Equal(joinedTime))
+	if !joinedTimeChanged && now.Sub(reputation.UpdatedAt) < ReputationRefreshInterval {
+		return &reputation, nil
+	}
+	if joinedTimeChanged {
+		reputation.JoinedTime = &joinedTime
+	}
+	err = reputation.Refresh(DB, now)
+	if err != nil {
+		return nil, err
+	}
+	err = DB.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "joined_time", "likes", "punishments", "score"}),
+	}).Omit("Override").Create(&reputation).Error
+	return &reputation, err
+}
+
+// SetReputationOverride sets or clears, if nil, the override of the user's reputation
+func SetReputationOverride(tx *gorm.DB, userID int, override *int) (*UserReputation, error) {
+	reputation := UserReputation{UserID: userID, Override: override}
+	err := tx.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"override"}),
+	}).Create(&reputation).Error
+	if err != nil {
+		return nil, err
+	}
+	return &reputation, tx.Take(&reputation, userID).Error
+}
+
+// checks trusted users skip, see config.TrustedBypasses
+const (
+	TrustedBypassChallenge = "challenge"
+	TrustedBypassSensitive = "sensitive"
+	TrustedBypassReview    = "review"
+)
+
+// Trusted tells if the user skips the bypass check by reputation, see config.TrustedMinReputation.
+// New users are never trusted unless admins override the score.
+func (user *User) Trusted(bypass string) bool {
+	if config.Config.TrustedMinReputation <= 0 || !slices.Contains(config.Config.TrustedBypasses, bypass) {
+		return false
+	}
+	reputation, err := LoadReputation(user.ID, user.JoinedTime)
+	if err != nil {
+		log.Err(err).Int("user_id", user.ID).Msg("load reputation failed")
+		return false
+	}
+	return reputation.Value() >= config.Config.TrustedMinReputation
+}
+
+var reImageMarkdown = regexp.MustCompile(`!\[.*?]\(`)
+
+// ContainsLinks tells if content has links or images, stickers are not counted
+func ContainsLinks(content string) bool {
+	content = reSticker.ReplaceAllString(content, "")
+	return reImageMarkdown.MatchString(content) || xurls.Strict().MatchString(content)
+}
+
+// CheckLinkPrivilege returns ErrCodeLinkNotAllowed if content has links or images and the user is too new
+// or the reputation is too low, see config.LinkRestrictDays. Admins and users with an override are exempt from the age.
+func (user *User) CheckLinkPrivilege(content string) error {
+	if user.IsAdmin || config.Config.LinkRestrictDays <= 0 && config.Config.LinkMinReputation <= 0 || !ContainsLinks(content) {
+		return nil
+	}
+	reputation, err := LoadReputation(user.ID, user.JoinedTime)
+	if err != nil {
+		return err
+	}
+	tooNew := reputation.Override == nil && reputation.JoinedTime != nil &&
+		time.Since(*reputation.JoinedTime) < time.Duration(config.Config.LinkRestrictDays)*24*time.Hour
+	lowReputation := config.Config.LinkMinReputation > 0 && reputation.Value() < config.Config.LinkMinReputation
+	if tooNew || lowReputation {
+		return utils.NewError(utils.ErrCodeLinkNotAllowed, "新用户暂时不能发送链接或图片")
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+
+	"treehole_next/config"
+)
+
+const (
+	// contents of floors deleted for DELETED_FLOOR_RETENTION_DAYS, the floors are kept as tombstones for rankings
+	RetentionDeletedFloors = "deleted_floors"
+	// messages older than MESSAGE_PURGE_DAYS
+	RetentionMessages = "messages"
+	// floor histories older than FLOOR_HISTORY_COMPRESS_DAYS are compressed instead of deleted
+	RetentionCompressHistories = "compress_floor_history"
+)
+
+// histories compressed in a transaction
+const retentionBatchSize = 1000
+
+// retentionPurgedRows counts rows purged, or compressed, by retention policies
+var retentionPurgedRows = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "treehole_retention_purged_rows_total",
+	Help: "Rows purged or compressed by retention policies.",
+}, []string{"policy"})
+
+// RetentionPolicy purges rows older than the days of the policy, disabled if days is 0
+type RetentionPolicy struct {
+	Name  string
+	days  func() int
+	count func(tx *gorm.DB, before time.Time) (int64, error)
+	purge func(tx *gorm.DB, before time.Time) (int64, error)
+}
+
+var RetentionPolicies = []RetentionPolicy{
+	{
+		Name: RetentionDeletedFloors,
+		days: func() int { return config.Config.DeletedFloorRetentionDays },
+		count: func(tx *gorm.DB, before time.Time) (n int64, err error) {
+			err = tx.Model(&FloorHistory{}).Scopes(expiredDeletedFloorHistories(before)).Count(&n).Error
+			return n, err
+		},
+		purge: func(tx *gorm.DB, before time.Time) (int64, error) {
+			result := tx.Scopes(expiredDeletedFloorHistories(before)).Delete(&FloorHistory{})
+			return result.RowsAffected, result.Error
+		},
+	},
+	{
+		Name: RetentionMessages,
+		days: func() int { return config.Config.MessagePurgeDays },
+		count: func(tx *gorm.DB, before time.Time) (n int64, err error) {
+			err = tx.Model(&Message{}).Where("created_at < ?", before).Count(&n).Error
+			return n, err
+		},
+		purge: func(tx *gorm.DB, before time.Time) (n int64, err error) {
+			err = tx.Transaction(func(tx *gorm.DB) error {
+				expired := tx.Model(&Message{}).Select("id").Where("created_at < ?", before)
+				err := tx.Where("message_id IN (?)", expired).Delete(&MessageUser{}).Error
+				if err != nil {
+					return err
+				}
+				result := tx.Where("created_at < ?", before).Delete(&Message{})
+				n = result.RowsAffected
+				return result.Error
+			})
+			return n, err
+		},
+	},
+	{
+		Name: RetentionCompressHistories,
+		days: func() int { return config.Config.FloorHistoryCompressDays },
+		count: func(tx *gorm.DB, before time.Time) (n int64, err error) {
+			err = tx.Model(&FloorHistory{}).Scopes(uncompressedFloorHistories(before)).Count(&n).Error
+			return n, err
+		},
+		purge: compressFloorHistories,
+	},
+}
+
+// expiredDeletedFloorHistories selects histories of floors deleted before, except floors under legal hold
+// or with pending appeals, which are restored from histories
+func expiredDeletedFloorHistories(before time.Time) func(tx *gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		appealed := DB.Model(&Appeal{}).Select("floor_id").Where("status = ?", AppealStatusPending)
+		floors := DB.Model(&Floor{}).Select("id").Scopes(NotHeldFloors).
+			Where("deleted = ? AND updated_at < ? AND id NOT IN (?)", true, before, appealed)
+		return tx.Where("floor_id IN (?)", floors)
+	}
+}
+
+func uncompressedFloorHistories(before time.Time) func(tx *gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("created_at < ? AND compressed_content IS NULL AND content <> ''", before)
+	}
+}
+
+func compressFloorHistories(tx *gorm.DB, before time.Time) (total int64, err error) {
+	for {
+		var histories []FloorHistory
+		err = tx.Select("id", "content").Scopes(uncompressedFloorHistories(before)).
+			Limit(retentionBatchSize).Find(&histories).Error
+		if err != nil || len(histories) == 0 {
+			return total, err
+		}
+		err = tx.Transaction(func(tx *gorm.DB) error {
+			for _, history := range histories {
+				compressed, err := compressContent(history.Content)
+				if err != nil {
+					return err
+				}
+				err = tx.Model(&FloorHistory{ID: history.ID}).
+					UpdateColumns(map[string]any{"compressed_content": compressed, "content": ""}).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+		total += int64(len(histories))
+	}
+}
+
+// RunRetentionPolicies runs enabled retention policies at now, or counts rows to purge if dryRun.
+// Returns rows of each enabled policy
+func RunRetentionPolicies(now time.Time, dryRun bool) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	for _, policy := range RetentionPolicies {
+		days := policy.days()
+		if days <= 0 {
+			continue
+		}
+		before := now.AddDate(0, 0, -days)
+		var n int64
+		var err error
+		if dryRun {
+			n, err = policy.count(DB, before)
+		} else {
+			n, err = policy.purge(DB, before)
+			retentionPurgedRows.WithLabelValues(policy.Name).Add(float64(n))
+		}
+		counts[policy.Name] = n
+		if err != nil {
+			return counts, err
+		}
+		log.Info().Str("policy", policy.Name).Int64("rows", n).Bool("dry_run", dryRun).Msg("retention")
+	}
+	return counts, nil
+}
@@ -0,0 +1,210 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+
+	"treehole_next/utils"
+)
+
+const (
+	SavedSearchFrequencyHourly = "hourly"
+	SavedSearchFrequencyDaily  = "daily"
+	SavedSearchFrequencyWeekly = "weekly"
+)
+
+// savedSearchIntervals are the least intervals between alerts of a saved search
+var savedSearchIntervals = map[string]time.Duration{
+	SavedSearchFrequencyHourly: time.Hour,
+	SavedSearchFrequencyDaily:  24 * time.Hour,
+	SavedSearchFrequencyWeekly: 7 * 24 * time.Hour,
+}
+
+// SavedSearchMaxPerUser limits saved searches of a user, each one is searched periodically
+const SavedSearchMaxPerUser = 20
+
+// savedSearchMaxFloors limits floors listed in the data of an alert
+const savedSearchMaxFloors = 20
+
+// SavedSearch is a search query of a user, new floors matching it are notified periodically, see FlushSavedSearches
+type SavedSearch struct {
+	ID       int    `json:"id" gorm:"primaryKey"`
+	UserID   int    `json:"-" gorm:"not null;index"`
+	TenantID int    `json:"-" gorm:"not null;default:0"`
+	Search   string `json:"search" gorm:"size:64;not null"`
+	Accurate bool   `json:"accurate" gorm:"not null;default:false"`
+
+	// hourly, daily or weekly
+	Frequency string `json:"frequency" gorm:"size:8;not null;default:daily"`
+
+	// alerts are paused if false
+	Notify bool `json:"notify" gorm:"not null;default:true"`
+
+	// floors with larger ids are new
+	LastFloorID int `json:"-" gorm:"not null;default:0"`
+
+	CheckedAt time.Time `json:"time_checked"`
+	CreatedAt time.Time `json:"time_created"`
+}
+
+type SavedSearches []*SavedSearch
+
+func maxFloorID(tx *gorm.DB) (int, error) {
+	var id int
+	err := tx.Model(&Floor{}).Select("COALESCE(MAX(id), 0)").Scan(&id).Error
+	return id, err
+}
+
+// NewSavedSearch creates a saved search of the user, floors already posted are not new
+func NewSavedSearch(tx *gorm.DB, savedSearch *SavedSearch) error {
+	var count int64
+	err := tx.Model(&SavedSearch{}).Where("user_id = ?", savedSearch.UserID).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count >= SavedSearchMaxPerUser {
+		return utils.NewError(utils.ErrCodeSavedSearchLimitExceeded, "保存的搜索数量已达上限")
+	}
+
+	savedSearch.LastFloorID, err = maxFloorID(tx)
+	if err != nil {
+		return err
+	}
+	savedSearch.CheckedAt = time.Now()
+	return tx.Create(savedSearch).Error
+}
+
+// searchNewFloorIDs returns ids of floors in (afterID, maxID] matching the keyword in ascending order
+func searchNewFloorIDs(keyword string, accurate bool, afterID, maxID, size int) ([]int, error) {
+	floorIDs := make([]int, 0)
+	if ES == nil {
+		err := DB.Model(&Floor{}).Where("id > ? AND id <= ? AND content LIKE ?", afterID, maxID, "%"+keyword+"%").
+			Order("id").Limit(size).Pluck("id", &floorIDs).Error
+		return floorIDs, err
+	}
+
+	var queries []types.Query
+	for _, field := range floorContentFields() {
+		if accurate {
+			queries = append(queries, types.Query{MatchPhrase: map[string]types.MatchPhraseQuery{field: {Query: keyword}}})
+		} else {
+			queries = append(queries, types.Query{Match: map[string]types.MatchQuery{field: {Query: keyword}}})
+		}
+	}
+	gt, lte := types.Float64(afterID), types.Float64(maxID)
+	query := types.Query{
+		Bool: &types.BoolQuery{
+			Must:   []types.Query{{DisMax: &types.DisMaxQuery{Queries: queries}}},
+			Filter: []types.Query{{Range: map[string]types.RangeQuery{"id": types.NumberRangeQuery{Gt: &gt, Lte: &lte}}}},
+		},
+	}
+	var res *search.Response
+	err := esBreaker.Do(func() (err error) {
+		res, err = ES.Search().Index(IndexName).Size(size).Query(&query).
+			Sort(types.SortOptions{SortOptions: map[string]types.FieldSort{"id": {Order: &sortorder.Asc}}}).
+			Do(context.Background())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, hit := range res.Hits.Hits {
+		floorID, err := strconv.Atoi(*hit.Id_)
+		if err != nil {
+			return nil, err
+		}
+		floorIDs = append(floorIDs, floorID)
+	}
+	return floorIDs, nil
+}
+
+// alert returns a notification of new floors by others matching the search, nil if there are none.
+// Floors of hidden holes, other tenants and divisions invisible to or muted by the user are skipped
+func (savedSearch *SavedSearch) alert(maxID int) (*Notification, error) {
+	floorIDs, err := searchNewFloorIDs(savedSearch.Search, savedSearch.Accurate, savedSearch.LastFloorID, maxID, savedSearchMaxFloors)
+	if err != nil || len(floorIDs) == 0 {
+		return nil, err
+	}
+
+	var user User
+	err = DB.Take(&user, savedSearch.UserID).Error
+	if err != nil {
+		return nil, err
+	}
+	querySet, err := WhereVisibleDivisions(DB.Model(&Floor{}).
+		Joins("JOIN hole ON hole.id = floor.hole_id AND hole.hidden = ? AND hole.deleted_at IS NULL AND hole.tenant_id = ?",
+			false, savedSearch.TenantID), &user)
+	if err != nil {
+		return nil, err
+	}
+	querySet, err = whereNotMutedDivisions(querySet, savedSearch.UserID)
+	if err != nil {
+		return nil, err
+	}
+	var visibleIDs []int
+	err = querySet.Where("floor.id IN ? AND floor.deleted = ? AND floor.user_id <> ?", floorIDs, false, savedSearch.UserID).
+		Order("floor.id").Pluck("floor.id", &visibleIDs).Error
+	if err != nil || len(visibleIDs) == 0 {
+		return nil, err
+	}
+
+	return &Notification{
+		Data: Map{
+			"saved_search_id": savedSearch.ID,
+			"search":          savedSearch.Search,
+			"floor_ids":       visibleIDs,
+		},
+		Recipients:  []int{savedSearch.UserID},
+		Description: fmt.Sprintf("「%s」有 %d 条新结果", savedSearch.Search, len(visibleIDs)),
+		Title:       "您保存的搜索有新结果",
+		Type:        MessageTypeSavedSearch,
+		// DELETE to unsubscribe
+		URL: fmt.Sprintf("/api/user/saved_searches/%d", savedSearch.ID),
+	}, nil
+}
+
+// FlushSavedSearches searches new floors for saved searches due at now and notifies their owners
+func FlushSavedSearches(now time.Time) error {
+	maxID, err := maxFloorID(DB)
+	if err != nil {
+		return err
+	}
+
+	querySet := DB.Where("1 = 0")
+	for frequency, interval := range savedSearchIntervals {
+		querySet = querySet.Or("frequency = ? AND checked_at <= ?", frequency, now.Add(-interval))
+	}
+	var savedSearches SavedSearches
+	err = DB.Where("notify = ?", true).Where(querySet).Find(&savedSearches).Error
+	if err != nil {
+		return err
+	}
+
+	for _, savedSearch := range savedSearches {
+		notification, err := savedSearch.alert(maxID)
+		if err != nil {
+			log.Err(err).Str("model", "SavedSearch").Int("id", savedSearch.ID).Msg("search new floors failed")
+			continue
+		}
+		err = DB.Model(savedSearch).Updates(map[string]any{"last_floor_id": maxID, "checked_at": now}).Error
+		if err != nil {
+			return err
+		}
+		if notification == nil {
+			continue
+		}
+		_, err = notification.Send()
+		if err != nil {
+			log.Err(err).Str("model", "SavedSearch").Msg("send saved search alert failed")
+		}
+	}
+	return nil
+}
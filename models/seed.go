@@ -0,0 +1,324 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"treehole_next/utils"
+)
+
+// SeedOptions of Seed, see treehole seed
+type SeedOptions struct {
+	Holes  int
+	Floors int // including the first floor of each hole, no less than Holes
+	Tags   int
+	Users  int
+
+	// holes are created in the division, or spread over all divisions if 0
+	DivisionID int
+
+	// holes are created evenly in the last Days days
+	Days int
+
+	// seed of the random generator, the same seed generates the same data on an empty database except anonynames
+	Seed int64
+
+	// index floors into elasticsearch
+	Index bool
+
+	BatchSize int
+}
+
+// exponent of the power law of floors per hole, a few holes have most of the floors
+const seedFloorsAlpha = 1.5
+
+var seedWords = []string{
+	"今天", "食堂", "图书馆", "宿舍", "考试", "期末", "绩点", "选课", "老师", "作业",
+	"实验", "论文", "保研", "考研", "实习", "校园卡", "快递", "外卖", "社团", "跑步",
+	"有没有人", "求助", "请问", "真的", "好像", "感觉", "怎么办", "哈哈哈", "救命", "蹲一个",
+	"的", "了", "吗", "在", "也", "都", "不", "很", "还是", "但是",
+}
+
+// Seed generates synthetic holes, floors and tags for load testing pagination and search.
+// Floors per hole follow a power law, tags of holes follow a Zipf distribution.
+// Floors are not checked for sensitive content, users are ids 1 to Users without rows in the user table.
+func Seed(options SeedOptions) error {
+	if options.Holes <= 0 || options.Floors < options.Holes {
+		return errors.New("floors should be no less than holes")
+	}
+	if options.Users <= 0 {
+		options.Users = 1
+	}
+	if options.Days <= 0 {
+		options.Days = 365
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = 1000
+	}
+	rng := rand.New(rand.NewSource(options.Seed))
+
+	divisions, err := seedDivisions(options.DivisionID)
+	if err != nil {
+		return err
+	}
+	tags, err := seedTags(divisions, options.Tags)
+	if err != nil {
+		return err
+	}
+	floorCounts := seedFloorCounts(rng, options.Holes, options.Floors)
+
+	var tagZipf *rand.Zipf
+	if options.Tags > 1 {
+		tagZipf = rand.NewZipf(rng, 1.2, 1, uint64(options.Tags-1))
+	}
+	tagHoles := make(map[int]int)
+
+	start := time.Now().Add(-time.Duration(options.Days) * 24 * time.Hour)
+	interval := time.Duration(options.Days) * 24 * time.Hour / time.Duration(options.Holes)
+
+	var floorsCreated int
+	for offset := 0; offset < options.Holes; offset += options.BatchSize {
+		batch := min(options.BatchSize, options.Holes-offset)
+		holes := make(Holes, 0, batch)
+		holeFloors := make([]Floors, 0, batch)
+		for i := offset; i < offset+batch; i++ {
+			division := divisions[rng.Intn(len(divisions))]
+			createdAt := start.Add(time.Duration(i) * interval)
+			floors := seedHoleFloors(rng, floorCounts[i], options.Users, createdAt)
+			holes = append(holes, &Hole{
+				CreatedAt:  createdAt,
+				UpdatedAt:  floors[len(floors)-1].CreatedAt,
+				View:       floorCounts[i] * (1 + rng.Intn(20)),
+				Reply:      floorCounts[i] - 1,
+				TenantID:   division.TenantID,
+				DivisionID: division.ID,
+				UserID:     floors[0].UserID,
+			})
+			holeFloors = append(holeFloors, floors)
+		}
+
+		err = DB.Transaction(func(tx *gorm.DB) error {
+			err := tx.Omit(clause.Associations).CreateInBatches(holes, options.BatchSize).Error
+			if err != nil {
+				return err
+			}
+
+			floors := make(Floors, 0, options.BatchSize)
+			mappings := make([]AnonynameMapping, 0, options.BatchSize)
+			holeTags := make(HoleTags, 0, batch)
+			for i, hole := range holes {
+				anonynames := make(map[int]bool)
+				for _, floor := range holeFloors[i] {
+					floor.HoleID = hole.ID
+					floors = append(floors, floor)
+					if !anonynames[floor.UserID] {
+						anonynames[floor.UserID] = true
+						mappings = append(mappings, AnonynameMapping{HoleID: hole.ID, UserID: floor.UserID, Anonyname: floor.Anonyname})
+					}
+				}
+				if tagZipf != nil {
+					holeTagIDs := make(map[int]bool)
+					for range rng.Intn(4) {
+						tag := tags[tagZipf.Uint64()]
+						if !holeTagIDs[tag.ID] {
+							holeTagIDs[tag.ID] = true
+							holeTags = append(holeTags, &HoleTag{HoleID: hole.ID, TagID: tag.ID})
+							tagHoles[tag.ID]++
+						}
+					}
+				}
+			}
+
+			err = tx.Omit(clause.Associations).CreateInBatches(floors, options.BatchSize).Error
+			if err != nil {
+				return err
+			}
+			err = tx.CreateInBatches(mappings, options.BatchSize).Error
+			if err != nil {
+				return err
+			}
+			if len(holeTags) > 0 {
+				err = tx.CreateInBatches(holeTags, options.BatchSize).Error
+				if err != nil {
+					return err
+				}
+			}
+
+			if options.Index {
+				floorModels := make([]FloorModel, 0, options.BatchSize)
+				for _, floor := range floors {
+					floorModels = append(floorModels, FloorModel{ID: floor.ID, UpdatedAt: floor.UpdatedAt, Content: floor.Content})
+					if len(floorModels) == options.BatchSize {
+						BulkInsert(floorModels)
+						floorModels = floorModels[:0]
+					}
+				}
+				BulkInsert(floorModels)
+			}
+			floorsCreated += len(floors)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		log.Info().Int("holes", offset+batch).Int("floors", floorsCreated).Msg("seeding")
+	}
+
+	for tagID, count := range tagHoles {
+		err = DB.Model(&Tag{}).Where("id = ?", tagID).
+			UpdateColumn("temperature", gorm.Expr("temperature + ?", count)).Error
+		if err != nil {
+			return err
+		}
+	}
+	if len(tags) > 0 {
+		return utils.DeleteLocalCache(TagsCacheKey(tags[0].TenantID))
+	}
+	return nil
+}
+
+func seedDivisions(divisionID int) (Divisions, error) {
+	var divisions Divisions
+	querySet := DB
+	if divisionID != 0 {
+		querySet = querySet.Where("id = ?", divisionID)
+	}
+	err := querySet.Find(&divisions).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(divisions) > 0 {
+		return divisions, nil
+	}
+	if divisionID != 0 {
+		return nil, fmt.Errorf("division %d not found", divisionID)
+	}
+
+	division := Division{Name: "seed", Description: "generated by treehole seed"}
+	err = DB.Create(&division).Error
+	if err != nil {
+		return nil, err
+	}
+	return Divisions{&division}, nil
+}
+
+// seedTags finds or creates tags seed_0 to seed_{n-1} in the tenant of the first division
+func seedTags(divisions Divisions, n int) (Tags, error) {
+	tags := make(Tags, 0, n)
+	if n == 0 {
+		return tags, nil
+	}
+	tenantID := divisions[0].TenantID
+	names := make([]string, 0, n)
+	for i := range n {
+		name := fmt.Sprintf("seed_%d", i)
+		names = append(names, name)
+		tags = append(tags, &Tag{TenantID: tenantID, Name: name})
+	}
+	err := DB.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(tags, 1000).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// ordered by name, so that seed_0 is the most popular one
+	var found Tags
+	err = DB.Where("tenant_id = ? AND name IN ?", tenantID, names).Find(&found).Error
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*Tag, len(found))
+	for _, tag := range found {
+		byName[tag.Name] = tag
+	}
+	for i, name := range names {
+		tags[i] = byName[name]
+	}
+	return tags, nil
+}
+
+// seedFloorCounts splits floors into holes by weights of a Pareto distribution, every hole has at least one floor
+func seedFloorCounts(rng *rand.Rand, holes, floors int) []int {
+	weights := make([]float64, holes)
+	var sum float64
+	for i := range weights {
+		weights[i] = math.Pow(1-rng.Float64(), -1/seedFloorsAlpha)
+		sum += weights[i]
+	}
+
+	counts := make([]int, holes)
+	extra := floors - holes
+	allocated := 0
+	for i, weight := range weights {
+		counts[i] = 1 + int(float64(extra)*weight/sum)
+		allocated += counts[i] - 1
+	}
+	for ; allocated < extra; allocated++ {
+		counts[rng.Intn(holes)]++
+	}
+	return counts
+}
+
+// seedHoleFloors generates floors of a hole, replies are written by a pool of users growing with the floors
+func seedHoleFloors(rng *rand.Rand, count, users int, createdAt time.Time) Floors {
+	participants := make([]int, 0, int(math.Sqrt(float64(count)))+1)
+	anonynames := make(map[int]string)
+	names := make([]string, 0, cap(participants))
+	user := func() int {
+		if len(participants) < cap(participants) && (len(participants) == 0 || rng.Intn(3) == 0) {
+			userID := 1 + rng.Intn(users)
+			if _, ok := anonynames[userID]; !ok {
+				participants = append(participants, userID)
+				// GenerateName expects names in order
+				name := utils.GenerateName(names)
+				index, _ := slices.BinarySearch(names, name)
+				names = slices.Insert(names, index, name)
+				anonynames[userID] = name
+			}
+			return userID
+		}
+		return participants[rng.Intn(len(participants))]
+	}
+
+	now := time.Now()
+	floors := make(Floors, 0, count)
+	floorTime := createdAt
+	for ranking := range count {
+		if ranking > 0 {
+			// replies slow down as the hole gets older
+			floorTime = floorTime.Add(time.Duration(rng.ExpFloat64() * math.Sqrt(float64(ranking)) * float64(time.Minute)))
+			if floorTime.After(now) {
+				floorTime = now
+			}
+		}
+		userID := user()
+		floors = append(floors, &Floor{
+			CreatedAt: floorTime,
+			UpdatedAt: floorTime,
+			Content:   seedContent(rng),
+			Anonyname: anonynames[userID],
+			Ranking:   ranking,
+			Like:      int(rng.ExpFloat64() * 2),
+			UserID:    userID,
+		})
+	}
+	return floors
+}
+
+// seedContent generates content of 2 to about 200 words, most of them short
+func seedContent(rng *rand.Rand) string {
+	length := 2 + int(rng.ExpFloat64()*20)
+	var builder strings.Builder
+	for range min(length, 200) {
+		builder.WriteString(seedWords[rng.Intn(len(seedWords))])
+	}
+	return builder.String()
+}
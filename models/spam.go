@@ -0,0 +1,220 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog/log"
+
+	"treehole_next/config"
+	"treehole_next/utils"
+)
+
+// SpamContent is a new hole or floor to check before it's created
+type SpamContent struct {
+	UserID     int    `json:"user_id"`
+	DivisionID int    `json:"division_id"`
+	Content    string `json:"content"`
+}
+
+// SpamScore is in [0, 1], 1 for spam, with reasons for moderators
+type SpamScore struct {
+	Score   float64
+	Reasons []string
+}
+
+// SpamChecker scores new contents, higher for spam.
+// Set Spam to swap in another implementation, e.g. with more features.
+type SpamChecker interface {
+	Check(ctx context.Context, content *SpamContent) (SpamScore, error)
+}
+
+// RateSpamChecker scores by the number of floors the user posts recently, see config.SpamRateLimit
+type RateSpamChecker struct{}
+
+func (RateSpamChecker) Check(ctx context.Context, content *SpamContent) (SpamScore, error) {
+	limit := config.Config.SpamRateLimit
+	if limit <= 0 {
+		return SpamScore{}, nil
+	}
+	var count int64
+	err := DB.WithContext(ctx).Model(&Floor{}).
+		Where("user_id = ? AND created_at >= ?", content.UserID, time.Now().Add(-config.Config.SpamRateWindow)).
+		Count(&count).Error
+	if err != nil {
+		return SpamScore{}, err
+	}
+	score := min(float64(count)/float64(limit), 1)
+	if score < 1 {
+		return SpamScore{Score: score}, nil
+	}
+	return SpamScore{Score: score, Reasons: []string{fmt.Sprintf("%d floors in %s", count, config.Config.SpamRateWindow)}}, nil
+}
+
+// DuplicateSpamChecker scores by the number of times the same content is posted recently by anyone,
+// counted by content hashes in cache, see config.SpamDuplicateLimit
+type DuplicateSpamChecker struct{}
+
+func (DuplicateSpamChecker) Check(_ context.Context, content *SpamContent) (SpamScore, error) {
+	limit := config.Config.SpamDuplicateLimit
+	text := strings.TrimSpace(content.Content)
+	if limit <= 0 || text == "" {
+		return SpamScore{}, nil
+	}
+	cacheKey := "spam_content_" + contentHash(text)
+	var count int
+	utils.GetCache(cacheKey, &count)
+	// not atomic, a few concurrent posts may be missed
+	err := utils.SetCache(cacheKey, count+1, config.Config.SpamDuplicateWindow)
+	if err != nil {
+		return SpamScore{}, err
+	}
+	score := min(float64(count)/float64(limit), 1)
+	if score < 1 {
+		return SpamScore{Score: score}, nil
+	}
+	return SpamScore{Score: score, Reasons: []string{fmt.Sprintf("posted %d times in %s", count+1, config.Config.SpamDuplicateWindow)}}, nil
+}
+
+var spamClassifierClient = http.Client{Timeout: 3 * time.Second, Transport: utils.TracingTransport{}}
+
+// RemoteSpamChecker asks the external classifier, see config.SpamClassifierUrl
+type RemoteSpamChecker struct {
+	URL string
+}
+
+func (checker RemoteSpamChecker) Check(ctx context.Context, content *SpamContent) (SpamScore, error) {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return SpamScore{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, checker.URL, bytes.NewReader(data))
+	if err != nil {
+		return SpamScore{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := spamClassifierClient.Do(req)
+	if err != nil {
+		return SpamScore{}, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return SpamScore{}, fmt.Errorf("spam classifier response failed: %s", res.Status)
+	}
+
+	data, err = io.ReadAll(res.Body)
+	if err != nil {
+		return SpamScore{}, err
+	}
+	var response struct {
+		Score float64 `json:"score"`
+	}
+	err = json.Unmarshal(data, &response)
+	if err != nil {
+		return SpamScore{}, err
+	}
+	score := min(max(response.Score, 0), 1)
+	return SpamScore{Score: score, Reasons: []string{fmt.Sprintf("classifier %.2f", score)}}, nil
+}
+
+// CombinedSpamChecker scores the max of checkers, so any strong signal counts.
+// Failed checkers are logged and skipped, contents are never blocked by outages.
+type CombinedSpamChecker []SpamChecker
+
+func (checkers CombinedSpamChecker) Check(ctx context.Context, content *SpamContent) (SpamScore, error) {
+	var result SpamScore
+	for _, checker := range checkers {
+		score, err := checker.Check(ctx, content)
+		if err != nil {
+			log.Err(err).Int("user_id", content.UserID).Msg("spam checker failed")
+			continue
+		}
+		result.Score = max(result.Score, score.Score)
+		result.Reasons = append(result.Reasons, score.Reasons...)
+	}
+	return result, nil
+}
+
+// Spam checks new holes and floors, the classifier is added if config.SpamClassifierUrl is set, see InitSpamChecker
+var Spam SpamChecker = CombinedSpamChecker{RateSpamChecker{}, DuplicateSpamChecker{}}
+
+func InitSpamChecker() {
+	if config.Config.SpamClassifierUrl != "" {
+		Spam = CombinedSpamChecker{RateSpamChecker{}, DuplicateSpamChecker{}, RemoteSpamChecker{URL: config.Config.SpamClassifierUrl}}
+	}
+}
+
+// SpamVerdict is what to do with a new floor by its spam score, see config.SpamFoldThreshold
+type SpamVerdict struct {
+	SpamScore
+	Fold   bool
+	Report bool
+}
+
+func spamThresholdReached(score, threshold float64) bool {
+	return threshold > 0 && score >= threshold
+}
+
+// CheckSpam scores a new floor by Spam, ErrCodeSpamBlocked if blocked, ErrCodeChallengeRequired
+// if the user should solve a challenge first and challengeSolved is false, see ChallengeSolved.
+// The floor is folded if the score is high enough, call verdict.ReportFloor after it's created.
+func CheckSpam(ctx context.Context, user *User, divisionID int, floor *Floor, challengeSolved bool) (*SpamVerdict, error) {
+	var verdict SpamVerdict
+	if user.IsAdmin || config.Config.SpamFoldThreshold <= 0 && config.Config.SpamReportThreshold <= 0 &&
+		config.Config.SpamBlockThreshold <= 0 && config.Config.SpamChallengeThreshold <= 0 {
+		return &verdict, nil
+	}
+
+	score, err := Spam.Check(ctx, &SpamContent{UserID: user.ID, DivisionID: divisionID, Content: floor.Content})
+	if err != nil {
+		log.Err(err).Int("user_id", user.ID).Msg("spam check failed")
+		return &verdict, nil
+	}
+	verdict.SpamScore = score
+	if spamThresholdReached(score.Score, config.Config.SpamBlockThreshold) {
+		log.Info().Int("user_id", user.ID).Float64("score", score.Score).Strs("reasons", score.Reasons).Msg("spam blocked")
+		return nil, utils.NewError(utils.ErrCodeSpamBlocked, "内容疑似垃圾信息，发送失败")
+	}
+	if !challengeSolved && config.Config.ChallengeSecret != "" &&
+		spamThresholdReached(score.Score, config.Config.SpamChallengeThreshold) && !user.Trusted(TrustedBypassChallenge) {
+		return nil, NewChallenge(user.ID)
+	}
+	verdict.Fold = spamThresholdReached(score.Score, config.Config.SpamFoldThreshold)
+	verdict.Report = spamThresholdReached(score.Score, config.Config.SpamReportThreshold)
+	if verdict.Fold && floor.Fold == "" {
+		floor.Fold = "该内容疑似垃圾信息"
+	}
+	return &verdict, nil
+}
+
+// ReportFloor reports the created floor to admins if the verdict says so, errors are logged only
+func (verdict *SpamVerdict) ReportFloor(floor *Floor) {
+	if verdict == nil || !verdict.Report {
+		return
+	}
+	report := Report{
+		FloorID:  floor.ID,
+		Floor:    floor,
+		Category: ReportCategorySpam,
+		Reason:   utils.StripContent(fmt.Sprintf("疑似垃圾信息：%.2f %s", verdict.Score, strings.Join(verdict.Reasons, "; ")), 128),
+	}
+	err := DB.Omit("Floor").Create(&report).Error
+	if err != nil {
+		log.Err(err).Int("floor_id", floor.ID).Msg("report spam failed")
+		return
+	}
+	err = report.SendCreate(DB)
+	if err != nil {
+		log.Err(err).Str("model", "Notification").Msg("SendCreate failed")
+	}
+}
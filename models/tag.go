@@ -15,6 +15,7 @@ import (
 	"golang.org/x/exp/slices"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
 
 	"treehole_next/utils"
 )
@@ -25,8 +26,11 @@ type Tag struct {
 	CreatedAt time.Time `json:"-" gorm:"not null"`
 	UpdatedAt time.Time `json:"-" gorm:"not null"`
 
+	// names are unique in a tenant, see Tenant
+	TenantID int `json:"tenant_id" gorm:"not null;default:0;uniqueIndex:idx_tag_tenant_name,priority:1"`
+
 	/// base info
-	Name        string `json:"name" gorm:"not null;unique;size:32"`
+	Name        string `json:"name" gorm:"not null;size:32;uniqueIndex:idx_tag_tenant_name,priority:2"`
 	Temperature int    `json:"temperature" gorm:"not null;default:0"`
 
 	IsZZMG bool `json:"-" gorm:"not null;default:false"`
@@ -42,6 +46,9 @@ type Tag struct {
 	TagID int `json:"tag_id" gorm:"-:all"`
 
 	Nsfw bool `json:"nsfw" gorm:"not null;default:false;index"`
+
+	// new tags of holes in divisions with TagReview wait for moderators, clients show them grayed out
+	Pending bool `json:"pending" gorm:"not null;default:false;index"`
 }
 
 type Tags []*Tag
@@ -67,12 +74,13 @@ func (tag *Tag) AfterCreate(_ *gorm.DB) (err error) {
 	return nil
 }
 
-func FindOrCreateTags(tx *gorm.DB, user *User, names []string) (Tags, error) {
+// FindOrCreateTags finds tags by names in the tenant, creates missing ones, which are pending for review if pending
+func FindOrCreateTags(tx *gorm.DB, user *User, tenantID int, names []string, pending bool) (Tags, error) {
 	tags := make(Tags, 0)
 	for i, name := range names {
 		names[i] = strings.TrimSpace(name)
 	}
-	err := tx.Where("name in ?", names).Find(&tags).Error
+	err := tx.Where("name in ? AND tenant_id = ?", names, tenantID).Find(&tags).Error
 	if err != nil {
 		return nil, err
 	}
@@ -95,7 +103,7 @@ func FindOrCreateTags(tx *gorm.DB, user *User, names []string) (Tags, error) {
 		if !slices.ContainsFunc(existTagNames, func(s string) bool {
 			return strings.EqualFold(s, name)
 		}) {
-			newTags = append(newTags, &Tag{Name: name})
+			newTags = append(newTags, &Tag{TenantID: tenantID, Name: name, Pending: pending})
 		}
 	}
 
@@ -139,25 +147,67 @@ func FindOrCreateTags(tx *gorm.DB, user *User, names []string) (Tags, error) {
 
 	err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&newTags).Error
 
-	go UpdateTagCache(nil)
+	go UpdateTagCache(tenantID, nil)
 
 	return append(tags, newTags...), err
 }
 
-func UpdateTagCache(tags Tags) {
+// TagsCacheKey is the cache of tags listed in a tenant
+func TagsCacheKey(tenantID int) string {
+	return TenantCacheKey(tenantID, "tags")
+}
+
+func UpdateTagCache(tenantID int, tags Tags) {
 	var err error
 	if len(tags) == 0 {
-		err := DB.Order("temperature desc").Find(&tags).Error
+		err := DB.Where("tenant_id = ? AND pending = ?", tenantID, false).Order("temperature desc").Find(&tags).Error
 		if err != nil {
 			log.Printf("update tag cache error: %s", err)
 		}
 	}
-	err = utils.SetCache("tags", tags, 10*time.Minute)
+	err = utils.SetLocalCache(TagsCacheKey(tenantID), tags, 10*time.Minute)
 	if err != nil {
 		log.Printf("update tag cache error: %s", err)
 	}
 }
 
+// MergeTag links holes of tag to newTag and deletes tag, newTag takes over the temperature
+func MergeTag(tag, newTag *Tag) error {
+	if tag.ID == newTag.ID {
+		return common.BadRequest("不能合并到同一标签")
+	}
+	newTag.Temperature += tag.Temperature
+
+	err := DB.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		result := tx.Exec(`
+ DELETE FROM hole_tags WHERE tag_id = ? AND hole_id IN
+ (SELECT a.hole_id FROM
+ (SELECT hole_id FROM hole_tags WHERE tag_id = ?)a
+ )`, tag.ID, newTag.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		result = tx.Exec(`UPDATE hole_tags SET tag_id = ? WHERE tag_id = ?`, newTag.ID, tag.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		result = tx.Updates(newTag)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		return tx.Delete(tag).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	go UpdateTagCache(tag.TenantID, nil)
+	return nil
+}
+
 func (tag *Tag) Preprocess(c *fiber.Ctx) error {
 	return Tags{tag}.Preprocess(c)
 }
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TagDailyStat is the number of new holes and the temperature of a tag in a day, see RefreshTagStats
+type TagDailyStat struct {
+	TagID int `json:"tag_id" gorm:"primaryKey;autoIncrement:false"`
+
+	// start of the day in local time
+	Date time.Time `json:"date" gorm:"primaryKey;index"`
+
+	// holes created in the day with the tag
+	HoleCount int `json:"hole_count" gorm:"not null;default:0"`
+
+	// temperature of the tag when refreshed
+	Temperature int `json:"temperature" gorm:"not null;default:0"`
+}
+
+// TagCooccurrence is the number of holes with both tags, see RefreshTagStats
+type TagCooccurrence struct {
+	TagID      int `json:"tag_id" gorm:"primaryKey;autoIncrement:false"`
+	OtherTagID int `json:"other_tag_id" gorm:"primaryKey;autoIncrement:false"`
+	Count      int `json:"count" gorm:"not null;default:0;index"`
+}
+
+// TagStatsBackfillDays limits days refreshed at once after the task is down for a while
+const TagStatsBackfillDays = 30
+
+// StartOfDay returns the start of the day of t in local time
+func StartOfDay(t time.Time) time.Time {
+	year, month, day := t.In(time.Local).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+}
+
+// RefreshTagStats saves stats of days since the last refresh until the day before now,
+// and recounts co-occurrences of tags. It's a no-op if stats of yesterday are saved.
+func RefreshTagStats(now time.Time) error {
+	today := StartOfDay(now)
+	yesterday := today.AddDate(0, 0, -1)
+
+	var last TagDailyStat
+	err := DB.Order("date DESC").Limit(1).Find(&last).Error
+	if err != nil {
+		return err
+	}
+	day := yesterday
+	if last.TagID != 0 {
+		if !last.Date.Before(yesterday) {
+			return nil
+		}
+		day = StartOfDay(last.Date).AddDate(0, 0, 1)
+	}
+	if earliest := today.AddDate(0, 0, -TagStatsBackfillDays); day.Before(earliest) {
+		day = earliest
+	}
+
+	for ; day.Before(today); day = day.AddDate(0, 0, 1) {
+		err = RefreshTagDailyStats(DB, day)
+		if err != nil {
+			return err
+		}
+	}
+	return RefreshTagCooccurrences(DB)
+}
+
+// RefreshTagDailyStats saves stats of all tags in the day starting at day, temperatures are the current ones
+func RefreshTagDailyStats(tx *gorm.DB, day time.Time) error {
+	var counts []struct {
+		TagID int
+		Count int
+	}
+	err := tx.Table("hole_tags").
+		Select("hole_tags.tag_id, COUNT(*) AS count").
+		Joins("JOIN hole ON hole.id = hole_tags.hole_id").
+		Where("hole.created_at >= ? AND hole.created_at < ?", day, day.AddDate(0, 0, 1)).
+		Group("hole_tags.tag_id").Scan(&counts).Error
+	if err != nil {
+		return err
+	}
+	holeCounts := make(map[int]int, len(counts))
+	for _, count := range counts {
+		holeCounts[count.TagID] = count.Count
+	}
+
+	var tags Tags
+	err = tx.Select("id", "temperature").Where("pending = ?", false).Find(&tags).Error
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	stats := make([]TagDailyStat, 0, len(tags))
+	for _, tag := range tags {
+		stats = append(stats, TagDailyStat{
+			TagID:       tag.ID,
+			Date:        day,
+			HoleCount:   holeCounts[tag.ID],
+			Temperature: tag.Temperature,
+		})
+	}
+	return tx.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(stats, 500).Error
+}
+
+// RefreshTagCooccurrences recounts co-occurrences of all tags
+func RefreshTagCooccurrences(tx *gorm.DB) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("1 = 1").Delete(&TagCooccurrence{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec(`INSERT INTO tag_cooccurrence (tag_id, other_tag_id, count)
+ SELECT a.tag_id, b.tag_id, COUNT(*) FROM hole_tags a
+ JOIN hole_tags b ON a.hole_id = b.hole_id AND a.tag_id <> b.tag_id
+ GROUP BY a.tag_id, b.tag_id`).Error
+	})
+}
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slices"
+
+	"treehole_next/config"
+	"treehole_next/utils"
+)
+
+const (
+	TagSuggestionsMaxSize = 5
+	// latest tagged holes a tag model learns from
+	tagModelHoles  = 5000
+	tagModelExpire = time.Hour
+	// tags of fewer holes are never suggested
+	tagModelMinHoles = 2
+	// suggestions less similar to the content are omitted
+	tagSuggestionMinScore = 0.1
+)
+
+// TagSuggestion is a tag similar to a content by TF-IDF over first floors of tagged holes, see SuggestTags
+type TagSuggestion struct {
+	Tag   *Tag    `json:"tag"`
+	Score float64 `json:"score"`
+}
+
+type tagModel struct {
+	*utils.TFIDF
+	expireAt time.Time
+}
+
+// tag models of tenants are kept in memory, they are too large for the cache
+var tagModels = struct {
+	sync.Mutex
+	models map[int]*tagModel
+}{models: make(map[int]*tagModel)}
+
+// loadTagModel returns the tag model of the tenant, rebuilt if expired. Machine tags are not learned from, see AutoTagHoles
+func loadTagModel(tenantID int) (*utils.TFIDF, error) {
+	tagModels.Lock()
+	defer tagModels.Unlock()
+	model := tagModels.models[tenantID]
+	if model != nil && time.Now().Before(model.expireAt) {
+		return model.TFIDF, nil
+	}
+
+	var holeIDs []int
+	err := DB.Model(&Hole{}).
+		Where("tenant_id = ? AND hidden = ? AND id IN (?)", tenantID, false, DB.Model(&HoleTag{}).Select("hole_id")).
+		Order("id DESC").Limit(tagModelHoles).Pluck("id", &holeIDs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	documents := make([]utils.LabeledDocument, 0, len(holeIDs))
+	if len(holeIDs) > 0 {
+		var floors []struct {
+			HoleID  int
+			Content string
+		}
+		err = DB.Model(&Floor{}).Select("hole_id", "content").
+			Where("hole_id IN ? AND ranking = 0", holeIDs).Scan(&floors).Error
+		if err != nil {
+			return nil, err
+		}
+		var holeTags []HoleTag
+		err = DB.Table("hole_tags").Select("hole_tags.hole_id, hole_tags.tag_id").
+			Joins("JOIN tag ON tag.id = hole_tags.tag_id AND tag.pending = ?", false).
+			Where("hole_tags.hole_id IN ? AND hole_tags.machine = ?", holeIDs, false).Scan(&holeTags).Error
+		if err != nil {
+			return nil, err
+		}
+
+		labels := make(map[int][]int, len(holeIDs))
+		for _, holeTag := range holeTags {
+			labels[holeTag.HoleID] = append(labels[holeTag.HoleID], holeTag.TagID)
+		}
+		for _, floor := range floors {
+			documents = append(documents, utils.LabeledDocument{Content: floor.Content, Labels: labels[floor.HoleID]})
+		}
+	}
+
+	model = &tagModel{
+		TFIDF:    utils.NewTFIDF(documents, tagModelMinHoles),
+		expireAt: time.Now().Add(tagModelExpire),
+	}
+	tagModels.models[tenantID] = model
+	return model.TFIDF, nil
+}
+
+// SuggestTags returns at most size tags of the tenant for content, the most similar first.
+// Tags in exclude and admin only tags for other users are skipped.
+func SuggestTags(user *User, tenantID int, content string, exclude []string, size int) ([]TagSuggestion, error) {
+	model, err := loadTagModel(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	// extra candidates in place of skipped tags
+	scores := model.Rank(content, size+len(exclude)+len(config.Config.AdminOnlyTagIds), tagSuggestionMinScore)
+	suggestions := make([]TagSuggestion, 0, size)
+	if len(scores) == 0 {
+		return suggestions, nil
+	}
+
+	tagIDs := make([]int, 0, len(scores))
+	for _, score := range scores {
+		tagIDs = append(tagIDs, score.Label)
+	}
+	var tags Tags
+	err = DB.Where("id IN ? AND tenant_id = ? AND pending = ?", tagIDs, tenantID, false).Find(&tags).Error
+	if err != nil {
+		return nil, err
+	}
+	tagsByID := make(map[int]*Tag, len(tags))
+	for _, tag := range tags {
+		tagsByID[tag.ID] = tag
+	}
+
+	for _, score := range scores {
+		tag, ok := tagsByID[score.Label]
+		if !ok || !user.IsAdmin && slices.Contains(config.Config.AdminOnlyTagIds, tag.ID) {
+			continue
+		}
+		if slices.ContainsFunc(exclude, func(name string) bool { return strings.EqualFold(strings.TrimSpace(name), tag.Name) }) {
+			continue
+		}
+		suggestions = append(suggestions, TagSuggestion{Tag: tag, Score: score.Score})
+		if len(suggestions) == size {
+			break
+		}
+	}
+	return suggestions, nil
+}
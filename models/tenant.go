@@ -0,0 +1,154 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"golang.org/x/exp/slices"
+
+	"treehole_next/config"
+	"treehole_next/utils"
+)
+
+// Tenant is a campus or school served by the deployment. Divisions, holes and tags belong to a tenant,
+// requests are scoped by X-Tenant header or subdomain of TENANT_DOMAIN, see ResolveTenant.
+// Requests without a tenant use the default tenant with id 0, which holds data created before tenancy.
+type Tenant struct {
+	ID        int       `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"time_created"`
+	UpdatedAt time.Time `json:"time_updated"`
+
+	// used in X-Tenant header and as subdomain, lowercase letters and digits
+	Key  string `json:"key" gorm:"size:32;not null;uniqueIndex"`
+	Name string `json:"name" gorm:"size:64;not null"`
+
+	// overrides of the deployment config
+	Config TenantConfig `json:"config" gorm:"serializer:json;not null"`
+}
+
+// TenantConfig overrides the deployment config for a tenant, nil fields use the deployment config
+type TenantConfig struct {
+	AdminOnly      *bool   `json:"admin_only,omitempty"`
+	OpenSearch     *bool   `json:"open_search,omitempty"`
+	HoleLinkFormat *string `json:"hole_link_format,omitempty" validate:"omitempty,contains=%d"`
+}
+
+// DefaultTenantID is the tenant of requests without X-Tenant header or tenant subdomain
+const DefaultTenantID = 0
+
+const tenantsCacheKey = "tenants"
+
+// loadTenants returns tenants by key, cached until tenants are modified
+func loadTenants() (tenants map[string]*Tenant, err error) {
+	if utils.GetLocalCache(tenantsCacheKey, &tenants) {
+		return tenants, nil
+	}
+	var list []*Tenant
+	err = DB.Find(&list).Error
+	if err != nil {
+		return nil, err
+	}
+	tenants = make(map[string]*Tenant, len(list))
+	for _, tenant := range list {
+		tenants[tenant.Key] = tenant
+	}
+	return tenants, utils.SetLocalCache(tenantsCacheKey, tenants, 0)
+}
+
+func DeleteTenantsCache() error {
+	return utils.DeleteLocalCache(tenantsCacheKey)
+}
+
+// ResolveTenant finds the tenant of request by X-Tenant header, or subdomain if TENANT_DOMAIN is set
+func ResolveTenant(c *fiber.Ctx) (*Tenant, error) {
+	key := strings.ToLower(strings.TrimSpace(c.Get("X-Tenant")))
+	if key == "" && config.Config.TenantDomain != "" {
+		hostname := strings.ToLower(c.Hostname())
+		if subdomain, ok := strings.CutSuffix(hostname, "."+config.Config.TenantDomain); ok && !strings.Contains(subdomain, ".") {
+			key = subdomain
+		}
+	}
+	if key == "" {
+		return &Tenant{ID: DefaultTenantID}, nil
+	}
+
+	tenants, err := loadTenants()
+	if err != nil {
+		return nil, err
+	}
+	tenant, ok := tenants[key]
+	if !ok {
+		return nil, common.NotFound("学校不存在")
+	}
+	return tenant, nil
+}
+
+// GetTenant returns the tenant of request set by MiddlewareTenant, the default tenant if not set
+func GetTenant(c *fiber.Ctx) *Tenant {
+	if c != nil {
+		if tenant, ok := c.Locals("tenant").(*Tenant); ok {
+			return tenant
+		}
+	}
+	return &Tenant{ID: DefaultTenantID}
+}
+
+// TenantCacheKey isolates caches of data scoped by tenant, keys of the default tenant are unchanged
+func TenantCacheKey(tenantID int, key string) string {
+	if tenantID == DefaultTenantID {
+		return key
+	}
+	return fmt.Sprintf("tenant_%d_%s", tenantID, key)
+}
+
+func (tenant *Tenant) AdminOnly() bool {
+	if tenant.Config.AdminOnly != nil {
+		return *tenant.Config.AdminOnly
+	}
+	return config.Config.AdminOnly
+}
+
+func (tenant *Tenant) OpenSearch() bool {
+	if tenant.Config.OpenSearch != nil {
+		return *tenant.Config.OpenSearch
+	}
+	return config.DynamicConfig.OpenSearch.Load()
+}
+
+// HoleLinkFormat is the link to a hole in feeds and sitemaps, see config.HoleLinkFormat
+func (tenant *Tenant) HoleLinkFormat() string {
+	if tenant.Config.HoleLinkFormat != nil {
+		return *tenant.Config.HoleLinkFormat
+	}
+	return config.Config.HoleLinkFormat
+}
+
+// InTenant removes floors of holes in other tenants
+func (floors Floors) InTenant(tenantID int) (Floors, error) {
+	if len(floors) == 0 {
+		return floors, nil
+	}
+	holeIDs := make([]int, 0, len(floors))
+	for _, floor := range floors {
+		holeIDs = append(holeIDs, floor.HoleID)
+	}
+	var otherHoleIDs []int
+	err := DB.Model(&Hole{}).Unscoped().Where("id IN ? AND tenant_id <> ?", holeIDs, tenantID).
+		Pluck("id", &otherHoleIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(otherHoleIDs) == 0 {
+		return floors, nil
+	}
+	inTenant := make(Floors, 0, len(floors))
+	for _, floor := range floors {
+		if !slices.Contains(otherHoleIDs, floor.HoleID) {
+			inTenant = append(inTenant, floor)
+		}
+	}
+	return inTenant, nil
+}
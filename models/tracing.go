@@ -0,0 +1,82 @@
+package models
+
+import (
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+
+	"treehole_next/utils"
+)
+
+const tracingSpanKey = "tracing:span"
+
+func startQuerySpan(operation string) func(tx *gorm.DB) {
+	return func(tx *gorm.DB) {
+		ctx, span := utils.Tracer().Start(tx.Statement.Context, "gorm "+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.DBSystemKey.String(tx.Dialector.Name()),
+				semconv.DBOperationName(operation),
+			),
+		)
+		tx.Statement.Context = ctx
+		tx.InstanceSet(tracingSpanKey, span)
+	}
+}
+
+func endQuerySpan(tx *gorm.DB) {
+	// logged by utils.MiddlewareRequestLogger
+	utils.CountQuery(tx.Statement.Context)
+
+	value, ok := tx.InstanceGet(tracingSpanKey)
+	if !ok {
+		return
+	}
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+
+	span.SetAttributes(
+		semconv.DBCollectionName(tx.Statement.Table),
+		semconv.DBQueryText(tx.Statement.SQL.String()),
+	)
+	if tx.Error != nil && tx.Error != gorm.ErrRecordNotFound {
+		span.RecordError(tx.Error)
+		span.SetStatus(codes.Error, tx.Error.Error())
+	}
+}
+
+type callbackRegister interface {
+	Register(name string, fn func(*gorm.DB)) error
+}
+
+// registerQuerySpan registers span callbacks around gorm:<operation>
+func registerQuerySpan[C callbackRegister](before, after func(name string) C, operation string) error {
+	err := before("gorm:"+operation).Register("tracing:before_"+operation, startQuerySpan(operation))
+	if err != nil {
+		return err
+	}
+	return after("gorm:"+operation).Register("tracing:after_"+operation, endQuerySpan)
+}
+
+// registerTracingCallbacks creates a span for each query and counts queries of the request, the parent span
+// is taken from the context of DB, e.g. ReadDB(c) or DB.WithContext(ctx)
+func registerTracingCallbacks(db *gorm.DB) error {
+	callback := db.Callback()
+	for _, err := range []error{
+		registerQuerySpan(callback.Create().Before, callback.Create().After, "create"),
+		registerQuerySpan(callback.Query().Before, callback.Query().After, "query"),
+		registerQuerySpan(callback.Update().Before, callback.Update().After, "update"),
+		registerQuerySpan(callback.Delete().Before, callback.Delete().After, "delete"),
+		registerQuerySpan(callback.Row().Before, callback.Row().After, "row"),
+		registerQuerySpan(callback.Raw().Before, callback.Raw().After, "raw"),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,12 +3,18 @@ package models
 import (
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"golang.org/x/exp/slices"
 
 	"treehole_next/config"
+	"treehole_next/utils"
 
+	"github.com/goccy/go-json"
 	"github.com/gofiber/fiber/v2"
 	"github.com/opentreehole/go-common"
 	"github.com/rs/zerolog/log"
@@ -83,6 +89,12 @@ type User struct {
 	JoinedTime           time.Time `json:"joined_time" gorm:"-:all"`
 	Nickname             string    `json:"nickname" gorm:"-:all"`
 	HasAnsweredQuestions bool      `json:"has_answered_questions" gorm:"-:all"`
+
+	// global roles besides admin, like moderator and operator, see GetRoles
+	Roles []string `json:"roles" gorm:"-:all"`
+
+	// see ModeratedDivisions
+	moderatedDivisions []int
 }
 
 type Users []*User
@@ -94,11 +106,19 @@ type UserConfig struct {
 	// 对折叠内容的处理
 	// fold 折叠, hide 隐藏, show 展示
 	ShowFolded string `json:"show_folded"`
+
+	// 点赞通知
+	// immediate 即时, daily 每日汇总, off 关闭
+	LikeNotify string `json:"like_notify"`
+
+	// 参与众裁，见 ReportVote
+	Jury bool `json:"jury"`
 }
 
 var defaultUserConfig = UserConfig{
 	Notify:     []string{"mention", "favorite", "report"},
 	ShowFolded: "hide",
+	LikeNotify: LikeNotifyDaily,
 }
 
 var showFoldedOptions = []string{"hide", "fold", "show"}
@@ -137,6 +157,16 @@ func GetCurrLoginUser(c *fiber.Ctx) (*User, error) {
 	user := &User{
 		BanDivision: make(map[int]*time.Time),
 	}
+	// set by MiddlewareGetUser, or the user acted as, see MiddlewareActAs
+	if c.Locals("user") != nil {
+		return c.Locals("user").(*User), nil
+	}
+
+	// writes with an API key are only authenticated on routes with MiddlewareAPIKeyScope
+	if GetAPIKey(c) != nil {
+		return nil, utils.NewError(utils.ErrCodeAPIKeyScope, "API key 无权访问该接口")
+	}
+
 	if config.Config.Mode == "dev" || config.Config.Mode == "test" {
 		user.ID = 1
 		user.IsAdmin = true
@@ -144,8 +174,13 @@ func GetCurrLoginUser(c *fiber.Ctx) (*User, error) {
 		return user, nil
 	}
 
-	if c.Locals("user") != nil {
-		return c.Locals("user").(*User), nil
+	// verify token locally, the user id of token overrides X-Consumer-Username of the gateway
+	if config.Config.JWKSUrl != "" {
+		claims, err := utils.VerifyJWT(c.UserContext(), common.GetJWTToken(c))
+		if err != nil {
+			return nil, err
+		}
+		c.Request().Header.Set("X-Consumer-Username", strconv.Itoa(claims.GetUserID()))
 	}
 
 	// get id
@@ -163,6 +198,29 @@ func GetCurrLoginUser(c *fiber.Ctx) (*User, error) {
 	// load user from database in transaction
 	err = user.LoadUserByID(userID)
 
+	user.setPermission()
+
+	// save user in c.Locals
+	c.Locals("user", user)
+
+	return user, err
+}
+
+// LoadActAsUser loads the user an admin acts as without writing to the database, see MiddlewareActAs.
+// Admin status is only known from the token, so the user is treated as a normal user.
+func LoadActAsUser(userID int) (*User, error) {
+	user := &User{
+		BanDivision: make(map[int]*time.Time),
+	}
+	err := DB.Take(user, userID).Error
+	if err != nil {
+		return nil, err
+	}
+	user.setPermission()
+	return user, nil
+}
+
+func (user *User) setPermission() {
 	if user.IsAdmin {
 		user.Permission.Admin = maxTime
 	} else {
@@ -174,11 +232,6 @@ func GetCurrLoginUser(c *fiber.Ctx) (*User, error) {
 	if config.Config.UserAllShowHidden {
 		user.Config.ShowFolded = "hide"
 	}
-
-	// save user in c.Locals
-	c.Locals("user", user)
-
-	return user, err
 }
 
 func (user *User) LoadUserByID(userID int) error {
@@ -224,6 +277,11 @@ func (user *User) LoadUserByID(userID int) error {
 			modified = true
 		}
 
+		if !slices.Contains(likeNotifyOptions, user.Config.LikeNotify) {
+			user.Config.LikeNotify = defaultUserConfig.LikeNotify
+			modified = true
+		}
+
 		if modified {
 			err = tx.Select("BanDivision", "Config").Save(&user).Error
 			if err != nil {
@@ -254,3 +312,155 @@ func (user *User) BanReportMessage() string {
 			user.BanReport.Format("2006-01-02 15:04:05"))
 	}
 }
+
+const UserNicknameCacheExpire = time.Hour
+
+// results of the auth service are kept for the duration, used while the auth service is down
+const UserAuthStaleCacheExpire = 7 * 24 * time.Hour
+
+// authBreaker fails calls to the auth service fast while it is down, stale cached results are used instead
+var authBreaker = utils.NewBreaker("auth")
+
+// getAuthUser fetches the user from auth service into authUser, only server errors count towards authBreaker
+func getAuthUser(userID int, authUser any) error {
+	if config.Config.AuthUrl == "" {
+		return errors.New("auth url not set")
+	}
+
+	var err error
+	breakerErr := authBreaker.Do(func() error {
+		var res *http.Response
+		res, err = client.Get(fmt.Sprintf("%s/users/%d", config.Config.AuthUrl, userID))
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = res.Body.Close()
+		}()
+
+		if res.StatusCode != http.StatusOK {
+			err = fmt.Errorf("auth server response failed: %s", res.Status)
+			if res.StatusCode >= http.StatusInternalServerError {
+				return err
+			}
+			return nil
+		}
+
+		var data []byte
+		data, err = io.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+		err = json.Unmarshal(data, authUser)
+		return nil
+	})
+	if breakerErr != nil {
+		return breakerErr
+	}
+	return err
+}
+
+// GetUserNickname
+// fetch the verified nickname of a user from auth service, used by real-name divisions
+func GetUserNickname(userID int) (string, error) {
+	cacheKey := fmt.Sprintf("user_nickname_%d", userID)
+	var nickname string
+	if utils.GetCache(cacheKey, &nickname) {
+		return nickname, nil
+	}
+
+	var authUser struct {
+		Nickname string `json:"nickname"`
+	}
+	err := getAuthUser(userID, &authUser)
+	if err != nil {
+		if utils.GetCache(cacheKey+"_stale", &nickname) {
+			log.Warn().Err(err).Int("user_id", userID).Msg("auth service unavailable, use stale nickname")
+			return nickname, nil
+		}
+		return "", err
+	}
+	if authUser.Nickname == "" {
+		return "", errors.New("empty nickname")
+	}
+
+	_ = utils.SetCache(cacheKey+"_stale", authUser.Nickname, UserAuthStaleCacheExpire)
+	return authUser.Nickname, utils.SetCache(cacheKey, authUser.Nickname, UserNicknameCacheExpire)
+}
+
+// concurrent calls to the auth service by GetUserNicknames
+const userNicknameFetchConcurrency = 8
+
+// GetUserNicknames returns verified nicknames of users, cached ones are read in a single round trip and
+// the rest are fetched concurrently with GetUserNickname. Users whose nickname is unavailable are left out
+func GetUserNicknames(userIDs []int) map[int]string {
+	userIDs = utils.Unique(userIDs)
+	nicknames := make(map[int]string, len(userIDs))
+	keys := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		keys = append(keys, fmt.Sprintf("user_nickname_%d", userID))
+	}
+	var missed []int
+	for i, data := range utils.GetCaches(keys) {
+		var nickname string
+		if data == nil || json.Unmarshal(data, &nickname) != nil {
+			missed = append(missed, userIDs[i])
+			continue
+		}
+		nicknames[userIDs[i]] = nickname
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, userNicknameFetchConcurrency)
+	for _, userID := range missed {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func() {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			nickname, err := GetUserNickname(userID)
+			if err != nil {
+				log.Err(err).Int("user_id", userID).Msg("load real name failed")
+				return
+			}
+			mutex.Lock()
+			nicknames[userID] = nickname
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+	return nicknames
+}
+
+const UserGroupsCacheExpire = 10 * time.Minute
+
+// GetUserGroups
+// fetch groups of a user from auth service, used by restricted divisions
+func GetUserGroups(userID int) ([]string, error) {
+	cacheKey := fmt.Sprintf("user_groups_%d", userID)
+	var groups []string
+	if utils.GetCache(cacheKey, &groups) {
+		return groups, nil
+	}
+
+	var authUser struct {
+		Groups []string `json:"groups"`
+	}
+	err := getAuthUser(userID, &authUser)
+	if err != nil {
+		if utils.GetCache(cacheKey+"_stale", &groups) {
+			log.Warn().Err(err).Int("user_id", userID).Msg("auth service unavailable, use stale groups")
+			return groups, nil
+		}
+		return nil, err
+	}
+	if authUser.Groups == nil {
+		authUser.Groups = []string{}
+	}
+
+	_ = utils.SetCache(cacheKey+"_stale", authUser.Groups, UserAuthStaleCacheExpire)
+	return authUser.Groups, utils.SetCache(cacheKey, authUser.Groups, UserGroupsCacheExpire)
+}
@@ -1,7 +1,6 @@
 package models
 
 import (
-	"github.com/opentreehole/go-common"
 	"time"
 
 	"gorm.io/gorm"
@@ -36,10 +35,10 @@ func ModifyUserFavorite(tx *gorm.DB, userID int, holeIDs []int, favoriteGroupID
 		return nil
 	}
 	if !IsFavoriteGroupExist(tx, userID, favoriteGroupID) {
-		return common.NotFound("收藏夹不存在")
+		return utils.NewError(utils.ErrCodeFavoriteGroupNotFound, "收藏夹不存在")
 	}
 	if !IsHolesExist(tx, holeIDs) {
-		return common.Forbidden("帖子不存在")
+		return utils.NewError(utils.ErrCodeHoleNotFound, "帖子不存在")
 	}
 	return tx.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
 		var oldHoleIDs []int
@@ -49,6 +48,11 @@ func ModifyUserFavorite(tx *gorm.DB, userID int, holeIDs []int, favoriteGroupID
 		if err != nil {
 			return err
 		}
+		changedHoleIDs := append(append([]int{}, holeIDs...), oldHoleIDs...)
+		favorited, err := favoritedHoles(tx, userID, changedHoleIDs)
+		if err != nil {
+			return err
+		}
 
 		// remove user_favorite that not in holeIDs
 		var removingHoleIDMapping = make(map[int]bool)
@@ -93,18 +97,26 @@ func ModifyUserFavorite(tx *gorm.DB, userID int, holeIDs []int, favoriteGroupID
 				return err
 			}
 		}
+		err = updateFavoritesReceived(tx, userID, changedHoleIDs, favorited)
+		if err != nil {
+			return err
+		}
 		return tx.Model(&FavoriteGroup{}).Where("user_id = ? AND favorite_group_id = ?", userID, favoriteGroupID).Update("count", len(holeIDs)).Error
 	})
 }
 
 func AddUserFavorite(tx *gorm.DB, userID int, holeID int, favoriteGroupID int) error {
 	if !IsFavoriteGroupExist(tx, userID, favoriteGroupID) {
-		return common.NotFound("收藏夹不存在")
+		return utils.NewError(utils.ErrCodeFavoriteGroupNotFound, "收藏夹不存在")
 	}
 	if !IsHolesExist(tx, []int{holeID}) {
-		return common.NotFound("帖子不存在")
+		return utils.NewError(utils.ErrCodeHoleNotFound, "帖子不存在")
+	}
+	favorited, err := favoritedHoles(tx, userID, []int{holeID})
+	if err != nil {
+		return err
 	}
-	var err = tx.Clauses(clause.OnConflict{
+	err = tx.Clauses(clause.OnConflict{
 		DoUpdates: clause.Assignments(Map{"created_at": time.Now()}),
 	}).Create(&UserFavorite{
 		UserID:          userID,
@@ -114,6 +126,10 @@ func AddUserFavorite(tx *gorm.DB, userID int, holeID int, favoriteGroupID int) e
 	if err != nil {
 		return err
 	}
+	err = updateFavoritesReceived(tx, userID, []int{holeID}, favorited)
+	if err != nil {
+		return err
+	}
 	return tx.Clauses(dbresolver.Write).Model(&FavoriteGroup{}).
 		Where("user_id = ? AND favorite_group_id = ?", userID, favoriteGroupID).Update("count", gorm.Expr("count + 1")).Error
 }
@@ -129,7 +145,7 @@ func UserGetFavoriteData(tx *gorm.DB, userID int) ([]int, error) {
 // UserGetFavoriteDataByFavoriteGroup get favorite data in specific favorite group
 func UserGetFavoriteDataByFavoriteGroup(tx *gorm.DB, userID int, favoriteGroupID int) ([]int, error) {
 	if !IsFavoriteGroupExist(tx, userID, favoriteGroupID) {
-		return nil, common.NotFound("收藏夹不存在")
+		return nil, utils.NewError(utils.ErrCodeFavoriteGroupNotFound, "收藏夹不存在")
 	}
 	data := make([]int, 0, 10)
 	err := tx.Clauses(dbresolver.Write).Model(&UserFavorite{}).
@@ -142,13 +158,21 @@ func UserGetFavoriteDataByFavoriteGroup(tx *gorm.DB, userID int, favoriteGroupID
 // otherwise, delete the favorite in the specific favorite group
 func DeleteUserFavorite(tx *gorm.DB, userID int, holeID int, favoriteGroupID int) error {
 	if !IsFavoriteGroupExist(tx, userID, favoriteGroupID) {
-		return common.NotFound("收藏夹不存在")
+		return utils.NewError(utils.ErrCodeFavoriteGroupNotFound, "收藏夹不存在")
 	}
 	if !IsHolesExist(tx, []int{holeID}) {
-		return common.NotFound("帖子不存在")
+		return utils.NewError(utils.ErrCodeHoleNotFound, "帖子不存在")
 	}
 	return tx.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
-		err := tx.Delete(&UserFavorite{UserID: userID, HoleID: holeID, FavoriteGroupID: favoriteGroupID}).Error
+		favorited, err := favoritedHoles(tx, userID, []int{holeID})
+		if err != nil {
+			return err
+		}
+		err = tx.Delete(&UserFavorite{UserID: userID, HoleID: holeID, FavoriteGroupID: favoriteGroupID}).Error
+		if err != nil {
+			return err
+		}
+		err = updateFavoritesReceived(tx, userID, []int{holeID}, favorited)
 		if err != nil {
 			return err
 		}
@@ -165,10 +189,10 @@ func MoveUserFavorite(tx *gorm.DB, userID int, holeIDs []int, fromFavoriteGroupI
 		return nil
 	}
 	if !IsFavoriteGroupExist(tx, userID, fromFavoriteGroupID) || !IsFavoriteGroupExist(tx, userID, toFavoriteGroupID) {
-		return common.NotFound("收藏夹不存在")
+		return utils.NewError(utils.ErrCodeFavoriteGroupNotFound, "收藏夹不存在")
 	}
 	if !IsHolesExist(tx, holeIDs) {
-		return common.Forbidden("帖子不存在")
+		return utils.NewError(utils.ErrCodeHoleNotFound, "帖子不存在")
 	}
 	return tx.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
 		var oldHoleIDs []int
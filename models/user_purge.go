@@ -0,0 +1,274 @@
+package models
+
+import (
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+
+	"treehole_next/config"
+	"treehole_next/utils"
+)
+
+// modes of PurgeUserData
+const (
+	// reassign contents to the purged user, see PURGED_USER_ID
+	PurgeModeAnonymize = "anonymize"
+	// also delete floors and hide holes
+	PurgeModeDelete = "delete"
+)
+
+const (
+	purgeBatchSize     = 1000
+	purgeDeleteContent = "该内容因账号注销被删除"
+	purgeDeleteReason  = "账号注销"
+)
+
+// PurgeUserData purges contents of a user deleted in the auth service, returns affected rows of each table.
+// Holes, floors, floor histories and reports are reassigned to the purged user,
+// likes, favorites, subscriptions and anonyname mappings are deleted.
+// Holes and floors under legal hold are kept as they are, with their anonyname mappings.
+// If dryRun, affected rows are counted without purging. operatorID is recorded in the admin log
+func PurgeUserData(operatorID, userID int, mode string, dryRun bool) (counts map[string]int64, err error) {
+	purgedUserID := config.Config.PurgedUserID
+	if purgedUserID == 0 {
+		return nil, common.BadRequest("未配置 PURGED_USER_ID")
+	}
+	if userID == purgedUserID {
+		return nil, common.BadRequest("不能清除该用户")
+	}
+	if dryRun {
+		return countUserContents(userID, mode)
+	}
+
+	err = DB.FirstOrCreate(&User{ID: purgedUserID}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err = purgeUserContents(userID, purgedUserID, mode)
+	if err != nil {
+		return counts, err
+	}
+
+	CreateAdminLog(DB, AdminLogTypePurgeUser, operatorID, Map{"user_id": userID, "mode": mode, "counts": counts})
+	log.Info().Int("user_id", userID).Str("mode", mode).Any("counts", counts).Msg("purge user")
+	return counts, nil
+}
+
+func countUserContents(userID int, mode string) (counts map[string]int64, err error) {
+	counts = make(map[string]int64)
+	count := func(name string, querySet *gorm.DB) {
+		if err != nil {
+			return
+		}
+		var n int64
+		err = querySet.Count(&n).Error
+		counts[name] = n
+	}
+
+	if mode == PurgeModeDelete {
+		count("deleted_floors", DB.Model(&Floor{}).Where("user_id = ? and deleted = ?", userID, false).Scopes(NotHeldFloors))
+		count("hidden_holes", DB.Model(&Hole{}).Where("user_id = ? and hidden = ?", userID, false).Scopes(NotHeldHoles))
+	}
+	count("holes", DB.Unscoped().Model(&Hole{}).Where("user_id = ?", userID).Scopes(NotHeldHoles))
+	count("floors", DB.Model(&Floor{}).Where("user_id = ?", userID).Scopes(NotHeldFloors))
+	count("floor_history", DB.Model(&FloorHistory{}).Where("user_id = ?", userID).Scopes(NotHeldFloorHistories))
+	count("reports", DB.Model(&Report{}).Where("user_id = ?", userID))
+	count("likes", DB.Model(&FloorLike{}).Where("user_id = ?", userID))
+	count("favorites", DB.Model(&UserFavorite{}).Where("user_id = ?", userID))
+	count("favorite_groups", DB.Model(&FavoriteGroup{}).Where("user_id = ?", userID))
+	count("floor_favorites", DB.Model(&UserFloorFavorite{}).Where("user_id = ?", userID))
+	count("floor_favorite_groups", DB.Model(&FloorFavoriteGroup{}).Where("user_id = ?", userID))
+	count("subscriptions", DB.Model(&UserSubscription{}).Where("user_id = ?", userID))
+	count("hole_mutes", DB.Model(&HoleMute{}).Where("user_id = ?", userID))
+	count("visits", DB.Model(&UserVisit{}).Where("user_id = ?", userID))
+	count("annual_reports", DB.Model(&AnnualReport{}).Where("user_id = ?", userID))
+	count("saved_searches", DB.Model(&SavedSearch{}).Where("user_id = ?", userID))
+	count("division_settings", DB.Model(&UserDivisionSetting{}).Where("user_id = ?", userID))
+	count("anonyname_mapping", DB.Model(&AnonynameMapping{}).Where("user_id = ?", userID).Scopes(NotHeldAnonynames))
+	return counts, err
+}
+
+// inBatches runs fn in a transaction for each batch of ids selected by querySet,
+// fn must make the rows not selected any more, e.g. change user_id.
+// committed, if not nil, runs after each transaction is committed, e.g. to delete caches
+func inBatches(querySet func() *gorm.DB, fn func(tx *gorm.DB, ids []int) error, committed func(ids []int)) (total int64, err error) {
+	for {
+		var ids []int
+		err = querySet().Limit(purgeBatchSize).Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return total, err
+		}
+		err = DB.Transaction(func(tx *gorm.DB) error {
+			return fn(tx, ids)
+		})
+		if err != nil {
+			return total, err
+		}
+		if committed != nil {
+			committed(ids)
+		}
+		total += int64(len(ids))
+	}
+}
+
+func purgeUserContents(userID, purgedUserID int, mode string) (counts map[string]int64, err error) {
+	counts = make(map[string]int64)
+	run := func(name string, querySet func() *gorm.DB, fn func(tx *gorm.DB, ids []int) error, committed func(ids []int)) {
+		if err != nil {
+			return
+		}
+		counts[name], err = inBatches(querySet, fn, committed)
+	}
+	reassign := func(model any) func(tx *gorm.DB, ids []int) error {
+		return func(tx *gorm.DB, ids []int) error {
+			return tx.Unscoped().Model(model).Where("id in ?", ids).UpdateColumn("user_id", purgedUserID).Error
+		}
+	}
+
+	if mode == PurgeModeDelete {
+		// holes of the floors deleted in the batch
+		var holeIDs []int
+		run("deleted_floors", func() *gorm.DB {
+			return DB.Model(&Floor{}).Where("user_id = ? and deleted = ?", userID, false).Scopes(NotHeldFloors)
+		}, func(tx *gorm.DB, ids []int) error {
+			var floors Floors
+			err := tx.Where("id in ?", ids).Find(&floors).Error
+			if err != nil {
+				return err
+			}
+			// histories keep the original contents for moderation
+			for _, floor := range floors {
+				err = floor.Backup(tx, purgedUserID, purgeDeleteReason)
+				if err != nil {
+					return err
+				}
+			}
+			err = tx.Model(&Floor{}).Where("id in ?", ids).
+				Updates(map[string]any{"deleted": true, "content": purgeDeleteContent}).Error
+			if err != nil {
+				return err
+			}
+			return tx.Model(&Floor{}).Where("id in ?", ids).Distinct().Pluck("hole_id", &holeIDs).Error
+		}, func(ids []int) {
+			_ = DeleteHoleCache(DB, holeIDs...)
+			utils.Go(func() { BulkDelete(ids) })
+		})
+		run("hidden_holes", func() *gorm.DB {
+			return DB.Model(&Hole{}).Where("user_id = ? and hidden = ?", userID, false).Scopes(NotHeldHoles)
+		}, func(tx *gorm.DB, ids []int) error {
+			// not HoleHiddenByAuthor, which the purged user, shared by all purged contents, could revert
+			return tx.Model(&Hole{}).Where("id in ?", ids).
+				UpdateColumns(map[string]any{"hidden": true, "hidden_state": HoleHiddenByModerator}).Error
+		}, func(ids []int) {
+			_ = DeleteHoleCache(DB, ids...)
+		})
+	}
+
+	run("holes", func() *gorm.DB {
+		return DB.Unscoped().Model(&Hole{}).Where("user_id = ?", userID).Scopes(NotHeldHoles)
+	}, reassign(&Hole{}), nil)
+	run("floors", func() *gorm.DB {
+		return DB.Model(&Floor{}).Where("user_id = ?", userID).Scopes(NotHeldFloors)
+	}, reassign(&Floor{}), nil)
+	run("floor_history", func() *gorm.DB {
+		return DB.Model(&FloorHistory{}).Where("user_id = ?", userID).Scopes(NotHeldFloorHistories)
+	}, reassign(&FloorHistory{}), nil)
+	run("reports", func() *gorm.DB {
+		return DB.Model(&Report{}).Where("user_id = ?", userID)
+	}, reassign(&Report{}), nil)
+	if err != nil {
+		return counts, err
+	}
+
+	counts["likes"], err = purgeUserLikes(userID)
+	if err != nil {
+		return counts, err
+	}
+
+	err = RemoveFavoritesReceived(DB, userID)
+	if err != nil {
+		return counts, err
+	}
+
+	// personal records without id, small enough to delete at once
+	for name, model := range map[string]any{
+		"favorites":             &UserFavorite{},
+		"favorite_groups":       &FavoriteGroup{},
+		"floor_favorites":       &UserFloorFavorite{},
+		"floor_favorite_groups": &FloorFavoriteGroup{},
+		"subscriptions":         &UserSubscription{},
+		"hole_mutes":            &HoleMute{},
+		"visits":                &UserVisit{},
+		"annual_reports":        &AnnualReport{},
+		"saved_searches":        &SavedSearch{},
+		"division_settings":     &UserDivisionSetting{},
+		"stats":                 &UserStats{},
+	} {
+		result := DB.Where("user_id = ?", userID).Delete(model)
+		if result.Error != nil {
+			return counts, result.Error
+		}
+		counts[name] = result.RowsAffected
+	}
+	// kept in holes under legal hold
+	result := DB.Where("user_id = ?", userID).Scopes(NotHeldAnonynames).Delete(&AnonynameMapping{})
+	if result.Error != nil {
+		return counts, result.Error
+	}
+	counts["anonyname_mapping"] = result.RowsAffected
+	return counts, DB.Model(&User{ID: userID}).UpdateColumn("favorite_group_count", 0).Error
+}
+
+// purgeUserLikes deletes likes of the user and decreases like and dislike of floors
+func purgeUserLikes(userID int) (total int64, err error) {
+	for {
+		var floorLikes []FloorLike
+		err = DB.Where("user_id = ?", userID).Limit(purgeBatchSize).Find(&floorLikes).Error
+		if err != nil || len(floorLikes) == 0 {
+			return total, err
+		}
+
+		var likedIDs, dislikedIDs, floorIDs []int
+		for _, floorLike := range floorLikes {
+			floorIDs = append(floorIDs, floorLike.FloorID)
+			if floorLike.LikeData > 0 {
+				likedIDs = append(likedIDs, floorLike.FloorID)
+			} else if floorLike.LikeData < 0 {
+				dislikedIDs = append(dislikedIDs, floorLike.FloorID)
+			}
+		}
+
+		var holeIDs []int
+		err = DB.Transaction(func(tx *gorm.DB) error {
+			err := tx.Model(&Floor{}).Where("id in ?", floorIDs).Distinct().Pluck("hole_id", &holeIDs).Error
+			if err != nil {
+				return err
+			}
+			if len(likedIDs) > 0 {
+				err := tx.Model(&Floor{}).Where("id in ?", likedIDs).
+					UpdateColumn("like", gorm.Expr(Quote("like")+" - 1")).Error
+				if err != nil {
+					return err
+				}
+				err = RemoveLikesReceived(tx, likedIDs)
+				if err != nil {
+					return err
+				}
+			}
+			if len(dislikedIDs) > 0 {
+				err := tx.Model(&Floor{}).Where("id in ?", dislikedIDs).
+					UpdateColumn("dislike", gorm.Expr("dislike - 1")).Error
+				if err != nil {
+					return err
+				}
+			}
+			return tx.Where("user_id = ? and floor_id in ?", userID, floorIDs).Delete(&FloorLike{}).Error
+		})
+		if err != nil {
+			return total, err
+		}
+		deleteUserLikesCaches([]int{userID}, holeIDs)
+		total += int64(len(floorLikes))
+	}
+}
@@ -0,0 +1,288 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"treehole_next/utils"
+)
+
+// UserStats is posting stats of a user, counters are updated in write paths instead of counting rows, see GetUserStats.
+// Floors and holes are posted ones, deleting them doesn't decrease the counters
+type UserStats struct {
+	UserID    int       `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	UpdatedAt time.Time `json:"time_updated"`
+	// floors posted, including first floors of holes
+	Floors int `json:"floors" gorm:"not null;default:0"`
+	Holes  int `json:"holes" gorm:"not null;default:0"`
+	// likes on floors of the user, dislikes are not counted
+	LikesReceived int `json:"likes_received" gorm:"not null;default:0"`
+	// users favoriting holes of the user, once per user and hole regardless of favorite groups
+	FavoritesReceived int `json:"favorites_received" gorm:"not null;default:0"`
+	// consecutive days with posts until LastPostDate, see CurrentStreak
+	Streak       int        `json:"-" gorm:"not null;default:0"`
+	LastPostDate *time.Time `json:"last_post_date"`
+	// consecutive days with check-ins until LastCheckinDate, see Checkin
+	CheckinStreak        int        `json:"-" gorm:"not null;default:0"`
+	LongestCheckinStreak int        `json:"longest_checkin_streak" gorm:"not null;default:0"`
+	LastCheckinDate      *time.Time `json:"last_checkin_date"`
+}
+
+// UserStatsResponse is UserStats with current streaks
+type UserStatsResponse struct {
+	*UserStats
+	Streak        int `json:"streak"`
+	CheckinStreak int `json:"checkin_streak"`
+}
+
+// currentStreak is streak if the last day is today or yesterday, 0 otherwise
+func currentStreak(streak int, lastDay *time.Time, now time.Time) int {
+	if lastDay == nil || lastDay.Before(StartOfDay(now).AddDate(0, 0, -1)) {
+		return 0
+	}
+	return streak
+}
+
+// CurrentStreak is Streak if the user posted today or yesterday, 0 otherwise
+func (stats *UserStats) CurrentStreak(now time.Time) int {
+	return currentStreak(stats.Streak, stats.LastPostDate, now)
+}
+
+// Response returns the stats with streaks at now
+func (stats *UserStats) Response(now time.Time) UserStatsResponse {
+	return UserStatsResponse{
+		UserStats:     stats,
+		Streak:        stats.CurrentStreak(now),
+		CheckinStreak: currentStreak(stats.CheckinStreak, stats.LastCheckinDate, now),
+	}
+}
+
+// GetUserStats returns stats of the user, zero if the user never posted or received anything
+func GetUserStats(tx *gorm.DB, userID int) (*UserStats, error) {
+	stats := UserStats{UserID: userID}
+	err := tx.Where("user_id = ?", userID).Limit(1).Find(&stats).Error
+	return &stats, err
+}
+
+// addUserStats adds delta to the counter column of the user, creating the stats if not exist
+func addUserStats(tx *gorm.DB, userID int, column string, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&UserStats{UserID: userID}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Model(&UserStats{}).Where("user_id = ?", userID).
+		Updates(map[string]any{column: gorm.Expr(column+" + ?", delta), "updated_at": time.Now()}).Error
+}
+
+// recordPost counts a floor posted by the user at now, and the hole if it's the first floor. Do in transaction only
+func recordPost(tx *gorm.DB, userID int, firstFloor bool, now time.Time) error {
+	err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&UserStats{UserID: userID}).Error
+	if err != nil {
+		return err
+	}
+	var stats UserStats
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&stats, "user_id = ?", userID).Error
+	if err != nil {
+		return err
+	}
+
+	today := StartOfDay(now)
+	switch {
+	case stats.LastPostDate == nil || stats.LastPostDate.Before(today.AddDate(0, 0, -1)):
+		stats.Streak = 1
+	case stats.LastPostDate.Before(today):
+		stats.Streak++
+	}
+	stats.LastPostDate = &today
+	stats.Floors++
+	if firstFloor {
+		stats.Holes++
+	}
+	return tx.Model(&stats).Select("Floors", "Holes", "Streak", "LastPostDate", "UpdatedAt").Updates(&stats).Error
+}
+
+// favoritedHoles returns holes of holeIDs in any favorite group of the user
+func favoritedHoles(tx *gorm.DB, userID int, holeIDs []int) (map[int]bool, error) {
+	var favorited []int
+	err := tx.Model(&UserFavorite{}).Where("user_id = ? AND hole_id IN ?", userID, holeIDs).
+		Distinct().Pluck("hole_id", &favorited).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[int]bool, len(favorited))
+	for _, holeID := range favorited {
+		result[holeID] = true
+	}
+	return result, nil
+}
+
+// updateFavoritesReceived adds favorites of the user on holeIDs, compared with before, to owners of the holes
+func updateFavoritesReceived(tx *gorm.DB, userID int, holeIDs []int, before map[int]bool) error {
+	after, err := favoritedHoles(tx, userID, holeIDs)
+	if err != nil {
+		return err
+	}
+	deltas := make(map[int]int)
+	for _, holeID := range holeIDs {
+		if after[holeID] != before[holeID] {
+			if after[holeID] {
+				deltas[holeID] = 1
+			} else {
+				deltas[holeID] = -1
+			}
+		}
+	}
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	var holes []Hole
+	err = tx.Select("id", "user_id").Where("id IN ?", utils.Keys(deltas)).Find(&holes).Error
+	if err != nil {
+		return err
+	}
+	for _, hole := range holes {
+		err = addUserStats(tx, hole.UserID, "favorites_received", deltas[hole.ID])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countFavoriteUsers returns the number of users favoriting the hole
+func countFavoriteUsers(tx *gorm.DB, holeID int) (int, error) {
+	var count int64
+	err := tx.Model(&UserFavorite{}).Where("hole_id = ?", holeID).Distinct("user_id").Count(&count).Error
+	return int(count), err
+}
+
+// mergeFavoritesReceived moves favorites received of the hole fromID to the hole toID after favorites are merged,
+// fromUsers and toUsers are numbers of users favoriting the holes before
+func mergeFavoritesReceived(tx *gorm.DB, fromID, toID, fromUsers, toUsers int) error {
+	users, err := countFavoriteUsers(tx, toID)
+	if err != nil {
+		return err
+	}
+	var holes []Hole
+	err = tx.Select("id", "user_id").Where("id IN ?", []int{fromID, toID}).Find(&holes).Error
+	if err != nil {
+		return err
+	}
+	for _, hole := range holes {
+		delta := users - toUsers
+		if hole.ID == fromID {
+			delta = -fromUsers
+		}
+		err = addUserStats(tx, hole.UserID, "favorites_received", delta)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveLikesReceived decreases likes received by owners of the floors by one each, when a like on each is deleted
+// without ModifyLike, e.g. PurgeUser
+func RemoveLikesReceived(tx *gorm.DB, floorIDs []int) error {
+	var counts []struct {
+		UserID int
+		Count  int
+	}
+	err := tx.Model(&Floor{}).Select("user_id, COUNT(*) AS count").
+		Where("id IN ?", floorIDs).Group("user_id").Scan(&counts).Error
+	if err != nil {
+		return err
+	}
+	for _, count := range counts {
+		err = addUserStats(tx, count.UserID, "likes_received", -count.Count)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveFavoritesReceived decreases favorites received from the user, call before all favorites of the user are deleted
+func RemoveFavoritesReceived(tx *gorm.DB, userID int) error {
+	var counts []struct {
+		UserID int
+		Count  int
+	}
+	favorites := tx.Model(&UserFavorite{}).Where("user_id = ?", userID).Distinct("hole_id")
+	err := tx.Table("(?) AS favorites", favorites).Select("hole.user_id, COUNT(*) AS count").
+		Joins("JOIN hole ON hole.id = favorites.hole_id").Group("hole.user_id").Scan(&counts).Error
+	if err != nil {
+		return err
+	}
+	for _, count := range counts {
+		err = addUserStats(tx, count.UserID, "favorites_received", -count.Count)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillUserStats counts posts, likes and favorites received of all users, streaks start from the next post
+func backfillUserStats(tx *gorm.DB) error {
+	stats := make(map[int]*UserStats)
+	get := func(userID int) *UserStats {
+		if stats[userID] == nil {
+			stats[userID] = &UserStats{UserID: userID}
+		}
+		return stats[userID]
+	}
+
+	var counts []struct {
+		UserID int
+		Count  int
+		Likes  int
+	}
+	err := tx.Model(&Floor{}).Select("user_id, COUNT(*) AS count, SUM(" + Quote("like") + ") AS likes").
+		Group("user_id").Scan(&counts).Error
+	if err != nil {
+		return err
+	}
+	for _, count := range counts {
+		get(count.UserID).Floors = count.Count
+		get(count.UserID).LikesReceived = count.Likes
+	}
+
+	counts = nil
+	err = tx.Model(&Hole{}).Unscoped().Select("user_id, COUNT(*) AS count").Group("user_id").Scan(&counts).Error
+	if err != nil {
+		return err
+	}
+	for _, count := range counts {
+		get(count.UserID).Holes = count.Count
+	}
+
+	counts = nil
+	favorites := tx.Model(&UserFavorite{}).Distinct("user_id", "hole_id")
+	err = tx.Table("(?) AS favorites", favorites).Select("hole.user_id, COUNT(*) AS count").
+		Joins("JOIN hole ON hole.id = favorites.hole_id").Group("hole.user_id").Scan(&counts).Error
+	if err != nil {
+		return err
+	}
+	for _, count := range counts {
+		get(count.UserID).FavoritesReceived = count.Count
+	}
+
+	delete(stats, 0)
+	if len(stats) == 0 {
+		return nil
+	}
+	rows := make([]*UserStats, 0, len(stats))
+	for _, row := range stats {
+		rows = append(rows, row)
+	}
+	return tx.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"floors", "holes", "likes_received", "favorites_received"}),
+	}).CreateInBatches(rows, 1000).Error
+}
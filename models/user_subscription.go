@@ -3,9 +3,14 @@ package models
 import (
 	"time"
 
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"golang.org/x/exp/slices"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"gorm.io/plugin/dbresolver"
+
+	"treehole_next/utils"
 )
 
 type UserSubscription struct {
@@ -33,3 +38,54 @@ func AddUserSubscription(tx *gorm.DB, userID int, holeID int) error {
 		UserID: userID,
 		HoleID: holeID}).Error
 }
+
+// AddUserSubscriptions subscribes holes at once, repeated ids are ignored
+func AddUserSubscriptions(tx *gorm.DB, userID int, holeIDs []int) error {
+	holeIDs = utils.Unique(holeIDs)
+	if len(holeIDs) == 0 {
+		return nil
+	}
+	if !IsHolesExist(tx, holeIDs) {
+		return utils.NewError(utils.ErrCodeHoleNotFound, "帖子不存在")
+	}
+	subscriptions := make(UserSubscriptions, 0, len(holeIDs))
+	for _, holeID := range holeIDs {
+		subscriptions = append(subscriptions, UserSubscription{UserID: userID, HoleID: holeID})
+	}
+	return tx.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(Map{"created_at": time.Now()}),
+	}).Create(&subscriptions).Error
+}
+
+// DeleteUserSubscriptions unsubscribes holes at once, holes not subscribed are ignored
+func DeleteUserSubscriptions(tx *gorm.DB, userID int, holeIDs []int) error {
+	if len(holeIDs) == 0 {
+		return nil
+	}
+	return tx.Where("user_id = ? AND hole_id IN ?", userID, holeIDs).Delete(&UserSubscription{}).Error
+}
+
+// loadSubscriptions sets IsSubscribed of holes for the current user
+func (holes Holes) loadSubscriptions(c *fiber.Ctx) error {
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+	if len(holes) == 0 {
+		return nil
+	}
+	holeIDs := make([]int, 0, len(holes))
+	for _, hole := range holes {
+		holeIDs = append(holeIDs, hole.ID)
+	}
+	var subscribed []int
+	err = ReadDB(c).Model(&UserSubscription{}).Where("user_id = ? AND hole_id IN ?", userID, holeIDs).
+		Pluck("hole_id", &subscribed).Error
+	if err != nil {
+		return err
+	}
+	for _, hole := range holes {
+		hole.IsSubscribed = slices.Contains(subscribed, hole.ID)
+	}
+	return nil
+}
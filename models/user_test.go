@@ -1,10 +1,18 @@
 package models
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/opentreehole/go-common"
 	"github.com/stretchr/testify/assert"
+
+	"treehole_next/config"
+	"treehole_next/utils"
 )
 
 func TestParseJWT(t *testing.T) {
@@ -13,3 +21,32 @@ func TestParseJWT(t *testing.T) {
 	err := common.ParseJWTToken(jwt, &user)
 	assert.Nilf(t, err, "ParseJWTToken failed: %v", err)
 }
+
+func TestGetUserNicknames(t *testing.T) {
+	utils.InitCache()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		userID := strings.TrimPrefix(r.URL.Path, "/users/")
+		if userID == "3" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"nickname": "user %s"}`, userID)
+	}))
+	defer server.Close()
+	authURL := config.Config.AuthUrl
+	config.Config.AuthUrl = server.URL
+	defer func() { config.Config.AuthUrl = authURL }()
+
+	assert.Nil(t, utils.SetCache("user_nickname_1", "cached", UserNicknameCacheExpire))
+
+	nicknames := GetUserNicknames([]int{1, 2, 2, 3})
+	assert.Equal(t, map[int]string{1: "cached", 2: "user 2"}, nicknames)
+	// cached users are not fetched, and each user is fetched once
+	assert.EqualValues(t, 2, requests.Load())
+
+	nicknames = GetUserNicknames([]int{2})
+	assert.Equal(t, map[int]string{2: "user 2"}, nicknames)
+	assert.EqualValues(t, 2, requests.Load())
+}
@@ -0,0 +1,232 @@
+package models
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+
+	"treehole_next/utils"
+)
+
+// Webhook receives signed JSON payloads of events, registered by admins
+type Webhook struct {
+	ID        int       `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"time_created"`
+	UpdatedAt time.Time `json:"time_updated"`
+	URL       string    `json:"url" gorm:"size:512;not null"`
+	// used to sign payloads with HMAC-SHA256, never returned
+	Secret string `json:"-" gorm:"size:128;not null"`
+	// events to receive, see WebhookEvents
+	Events  []string `json:"events" gorm:"serializer:json;not null"`
+	Enabled bool     `json:"enabled" gorm:"not null;default:true"`
+	// admin who registered the webhook
+	CreatedBy int `json:"created_by"`
+}
+
+type Webhooks []Webhook
+
+// WebhookDelivery is a delivery of an event to a webhook, retried until success or max attempts
+type WebhookDelivery struct {
+	ID        int       `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"time_created"`
+	UpdatedAt time.Time `json:"time_updated"`
+	WebhookID int       `json:"webhook_id" gorm:"not null;index"`
+	Event     string    `json:"event" gorm:"size:32;not null"`
+	Payload   string    `json:"payload" gorm:"type:text;not null"`
+	Success   bool      `json:"success" gorm:"not null;default:false;index:idx_webhook_delivery_retry,priority:1"`
+	Attempts  int       `json:"attempts" gorm:"not null;default:0"`
+	// nil if no more attempts
+	NextAttemptAt *time.Time `json:"next_attempt_at" gorm:"index:idx_webhook_delivery_retry,priority:2"`
+	// status code of the last attempt, 0 if the request failed
+	StatusCode int    `json:"status_code"`
+	Error      string `json:"error" gorm:"size:256"`
+}
+
+const (
+	WebhookEventHoleCreated    = "hole.created"
+	WebhookEventReportCreated  = "report.created"
+	WebhookEventPenaltyCreated = "penalty.created"
+	// new holes matching a BotRule
+	WebhookEventBotMatched = "bot.matched"
+)
+
+var WebhookEvents = []string{WebhookEventHoleCreated, WebhookEventReportCreated, WebhookEventPenaltyCreated, WebhookEventBotMatched}
+
+// WebhookHoleData is the data of hole.created, the poster is not included
+type WebhookHoleData struct {
+	HoleID     int    `json:"hole_id"`
+	DivisionID int    `json:"division_id"`
+	FloorID    int    `json:"floor_id"`
+	Content    string `json:"content"`
+}
+
+func NewWebhookHoleData(hole *Hole) WebhookHoleData {
+	data := WebhookHoleData{HoleID: hole.ID, DivisionID: hole.DivisionID}
+	if len(hole.Floors) > 0 {
+		data.FloorID = hole.Floors[0].ID
+		data.Content = utils.StripContent(hole.Floors[0].Content, 200)
+	}
+	return data
+}
+
+const (
+	webhookMaxAttempts = 5
+	webhookRetryDelay  = time.Minute
+	webhookTimeout     = 5 * time.Second
+)
+
+var webhookClient = http.Client{Timeout: webhookTimeout, Transport: utils.TracingTransport{}}
+
+// webhookPayload is the body posted to webhooks
+type webhookPayload struct {
+	ID        int       `json:"id"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// SignWebhookPayload returns the value of X-Treehole-Signature header
+func SignWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// TriggerWebhook creates deliveries of event to all enabled webhooks subscribing it and sends them in background.
+// Errors are logged only, webhooks should never fail the request.
+func TriggerWebhook(event string, data any) {
+	var webhooks Webhooks
+	err := DB.Where("enabled = ?", true).Find(&webhooks).Error
+	if err != nil {
+		log.Err(err).Str("model", "Webhook").Msg("load webhooks failed")
+		return
+	}
+
+	for _, webhook := range webhooks {
+		if !slices.Contains(webhook.Events, event) {
+			continue
+		}
+		delivery := WebhookDelivery{WebhookID: webhook.ID, Event: event, Payload: "{}"}
+		err = DB.Transaction(func(tx *gorm.DB) error {
+			err := tx.Create(&delivery).Error
+			if err != nil {
+				return err
+			}
+			payload, err := json.Marshal(webhookPayload{
+				ID:        delivery.ID,
+				Event:     event,
+				CreatedAt: delivery.CreatedAt,
+				Data:      data,
+			})
+			if err != nil {
+				return err
+			}
+			delivery.Payload = string(payload)
+			return tx.Model(&delivery).Update("payload", delivery.Payload).Error
+		})
+		if err != nil {
+			log.Err(err).Str("model", "Webhook").Int("webhook_id", webhook.ID).Msg("create webhook delivery failed")
+			continue
+		}
+
+		utils.Go(func() { delivery.deliver(&webhook) })
+	}
+}
+
+// deliver posts the payload to webhook and saves the result, schedules a retry if failed
+func (delivery *WebhookDelivery) deliver(webhook *Webhook) {
+	delivery.Attempts++
+	delivery.StatusCode, delivery.Error = 0, ""
+	err := delivery.post(webhook)
+	if err != nil {
+		delivery.Error = utils.StripContent(err.Error(), 256)
+	}
+	delivery.Success = err == nil
+	delivery.NextAttemptAt = nil
+	if !delivery.Success && delivery.Attempts < webhookMaxAttempts {
+		next := time.Now().Add(webhookRetryDelay << (delivery.Attempts - 1))
+		delivery.NextAttemptAt = &next
+	}
+
+	err = DB.Model(delivery).
+		Select("Success", "Attempts", "NextAttemptAt", "StatusCode", "Error").
+		Updates(delivery).Error
+	if err != nil {
+		log.Err(err).Str("model", "Webhook").Int("delivery_id", delivery.ID).Msg("save webhook delivery failed")
+	}
+}
+
+func (delivery *WebhookDelivery) post(webhook *Webhook) error {
+	payload := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "treehole-webhook")
+	req.Header.Set("X-Treehole-Event", delivery.Event)
+	req.Header.Set("X-Treehole-Delivery", strconv.Itoa(delivery.ID))
+	req.Header.Set("X-Treehole-Signature", SignWebhookPayload(webhook.Secret, payload))
+
+	res, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	delivery.StatusCode = res.StatusCode
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook response %s", res.Status)
+	}
+	return nil
+}
+
+// RetryWebhookDeliveries retries failed deliveries which are due, returns the number of deliveries retried
+func RetryWebhookDeliveries(n int) (int, error) {
+	var deliveries []WebhookDelivery
+	err := DB.Where("success = ? AND next_attempt_at <= ?", false, time.Now()).
+		Order("next_attempt_at").Limit(n).Find(&deliveries).Error
+	if err != nil {
+		return 0, err
+	}
+	if len(deliveries) == 0 {
+		return 0, nil
+	}
+
+	webhookIDs := make([]int, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		webhookIDs = append(webhookIDs, delivery.WebhookID)
+	}
+	var webhooks Webhooks
+	err = DB.Find(&webhooks, webhookIDs).Error
+	if err != nil {
+		return 0, err
+	}
+	webhookMap := make(map[int]*Webhook, len(webhooks))
+	for i := range webhooks {
+		webhookMap[webhooks[i].ID] = &webhooks[i]
+	}
+
+	for i := range deliveries {
+		webhook := webhookMap[deliveries[i].WebhookID]
+		if webhook == nil || !webhook.Enabled {
+			// webhook deleted or disabled, give up
+			err = DB.Model(&deliveries[i]).Update("next_attempt_at", nil).Error
+			if err != nil {
+				return i, err
+			}
+			continue
+		}
+		deliveries[i].deliver(webhook)
+	}
+	return len(deliveries), nil
+}
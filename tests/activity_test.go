@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+
+	. "treehole_next/models"
+)
+
+func TestActivities(t *testing.T) {
+	now := time.Now()
+	soon := Map{"title": "讲座", "start_time": now.Add(30 * time.Minute), "end_time": now.Add(2 * time.Hour), "division_id": 1}
+	activity := testAPI(t, "post", "/api/activities", 201, soon)
+	route := "/api/activities/" + strconv.Itoa(int(activity["id"].(float64)))
+	testAPI(t, "post", "/api/activities", 201,
+		Map{"title": "往届活动", "start_time": now.AddDate(0, 0, -2), "end_time": now.AddDate(0, 0, -1)})
+	testAPI(t, "post", "/api/activities", 400,
+		Map{"title": "invalid", "start_time": now.Add(time.Hour), "end_time": now})
+	testAPI(t, "post", "/api/activities", 404,
+		Map{"title": "invalid", "start_time": now, "end_time": now.Add(time.Hour), "hole_id": 1 << 30})
+
+	// upcoming activities exclude ended ones
+	var activities Activities
+	err := json.Unmarshal(testCommonQuery(t, "get", "/api/activities", 200, Map{"upcoming": true}), &activities)
+	assert.Nil(t, err)
+	for _, upcoming := range activities {
+		assert.True(t, upcoming.EndTime.After(now))
+	}
+	assert.Contains(t, activityIDs(activities), int(activity["id"].(float64)))
+
+	activity = testAPI(t, "post", route+"/reminder", 201)
+	assert.EqualValues(t, true, activity["reminded"])
+	activity = testAPI(t, "get", route, 200)
+	assert.EqualValues(t, true, activity["reminded"])
+
+	assert.Nil(t, FlushActivityReminders(now))
+	var message Message
+	DB.Where("type = ?", MessageTypeActivity).Last(&message)
+	assert.Contains(t, message.Description, "讲座")
+	// reminders are sent once
+	var count int64
+	assert.Nil(t, FlushActivityReminders(now))
+	DB.Model(&Message{}).Where("type = ?", MessageTypeActivity).Count(&count)
+	assert.EqualValues(t, 1, count)
+
+	// a changed start time reminds again
+	testAPI(t, "put", route, 200, Map{"start_time": now.Add(40 * time.Minute)})
+	assert.Nil(t, FlushActivityReminders(now))
+	DB.Model(&Message{}).Where("type = ?", MessageTypeActivity).Count(&count)
+	assert.EqualValues(t, 2, count)
+
+	activity = testAPI(t, "delete", route+"/reminder", 200)
+	assert.EqualValues(t, false, activity["reminded"])
+	testCommon(t, "delete", route, 204)
+	testCommon(t, "get", route, 404)
+}
+
+func activityIDs(activities Activities) []int {
+	ids := make([]int, 0, len(activities))
+	for _, activity := range activities {
+		ids = append(ids, activity.ID)
+	}
+	return ids
+}
@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+
+	. "treehole_next/models"
+	"treehole_next/utils"
+)
+
+func TestAPIKey(t *testing.T) {
+	const userID = 4260
+	DB.Create(&UserFavorite{UserID: userID, HoleID: 4})
+
+	created := testAPI(t, "post", "/api/api_keys", 201, Map{"name": "bot", "user_id": userID, "scopes": []string{"read"}})
+	key := created["key"].(string)
+	assert.NotEmpty(t, key)
+	assert.NotContains(t, created, "hash")
+	testAPI(t, "post", "/api/api_keys", 400, Map{"name": "bot", "user_id": userID, "scopes": []string{"admin"}})
+
+	withKey := func(method, route, key string, statusCode int) Map {
+		req, err := http.NewRequest(method, route, nil)
+		assert.Nil(t, err)
+		req.Header.Add("X-API-Key", key)
+		res, err := App.Test(req, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, statusCode, res.StatusCode)
+		var data Map
+		_ = json.NewDecoder(res.Body).Decode(&data)
+		return data
+	}
+
+	// reads act as the service account
+	data := withKey("GET", "/api/user/favorites?plain=true", key, 200)
+	assert.EqualValues(t, []any{float64(4)}, data["data"])
+
+	// writes need the scope of route
+	data = withKey("POST", "/api/divisions/1/holes", key, 403)
+	assert.EqualValues(t, utils.ErrCodeAPIKeyScope, data["code"])
+	data = withKey("POST", "/api/tenants", key, 403)
+	assert.EqualValues(t, utils.ErrCodeAPIKeyScope, data["code"])
+
+	data = withKey("GET", "/api/user/favorites", "thk_invalid", 401)
+	assert.EqualValues(t, utils.ErrCodeInvalidAPIKey, data["code"])
+
+	id := strconv.Itoa(int(created["id"].(float64)))
+	revoked := testAPI(t, "delete", "/api/api_keys/"+id, 200)
+	assert.NotNil(t, revoked["time_revoked"])
+	withKey("GET", "/api/user/favorites", key, 401)
+}
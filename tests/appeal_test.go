@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	. "treehole_next/models"
+)
+
+func TestAppeal(t *testing.T) {
+	// requests are sent by user 1
+	var user User
+	DB.FirstOrCreate(&user, User{ID: 1})
+	defer DB.Model(&user).Select("BanDivision", "OffenceCount").Updates(&user)
+
+	hole := Hole{DivisionID: 1, UserID: 1, Floors: Floors{{Content: "appeal", UserID: 1}}}
+	DB.Create(&hole)
+	floor := hole.Floors[0]
+	assert.Nil(t, floor.Backup(DB, 4400, "违反社区规范"))
+	DB.Model(floor).Updates(map[string]any{"deleted": true, "content": "该内容因违反社区规范被删除"})
+	report := Report{FloorID: floor.ID, UserID: 4401, Reason: "appeal", Dealt: true}
+	DB.Create(&report)
+	duration := 24 * time.Hour
+	punishment := Punishment{UserID: 1, MadeBy: 4400, FloorID: &floor.ID, DivisionID: 1, Duration: &duration, Day: 1}
+	_, err := punishment.Create()
+	assert.Nil(t, err)
+
+	// floors of others can't be appealed
+	other := Hole{DivisionID: 1, UserID: 4402, Floors: Floors{{Content: "other", UserID: 4402, Deleted: true}}}
+	DB.Create(&other)
+	testAPI(t, "post", "/api/appeals", 403, Map{"floor_id": other.Floors[0].ID, "reason": "误删"})
+
+	appeal := testAPI(t, "post", "/api/appeals", 201, Map{"floor_id": floor.ID, "reason": "误删"})
+	assert.EqualValues(t, report.ID, appeal["report_id"])
+	assert.NotNil(t, appeal["punishment_id"])
+	testAPI(t, "post", "/api/appeals", 400, Map{"floor_id": floor.ID, "reason": "误删"})
+
+	route := "/api/appeals/" + strconv.Itoa(int(appeal["id"].(float64)))
+	appeals := testAPIArray(t, "get", "/api/users/me/appeals", 200)
+	assert.EqualValues(t, appeal["id"], appeals[0]["id"])
+
+	appeal = testAPI(t, "put", route, 200, Map{"status": "approved", "result": "恢复"})
+	assert.EqualValues(t, AppealStatusApproved, appeal["status"])
+	testAPI(t, "put", route, 400, Map{"status": "rejected", "result": "驳回"})
+
+	// the floor is restored and the punishment is revoked
+	var restored Floor
+	DB.First(&restored, floor.ID)
+	assert.False(t, restored.Deleted)
+	assert.EqualValues(t, "appeal", restored.Content)
+	assert.ErrorIs(t, DB.Take(&Punishment{}, punishment.ID).Error, gorm.ErrRecordNotFound)
+	var appellant User
+	DB.First(&appellant, 1)
+	assert.Nil(t, appellant.BanDivision[1])
+
+	var message Message
+	DB.Where("title = ?", "处罚已撤销").Last(&message)
+	assert.Contains(t, message.Description, strconv.Itoa(floor.ID))
+}
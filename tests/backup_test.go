@@ -0,0 +1,26 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "treehole_next/models"
+	"treehole_next/utils"
+)
+
+func TestBackupMarker(t *testing.T) {
+	marker := decodeBody[BackupMarker](t, testCommon(t, "post", "/api/backup/_marker", 201, Map{"note": "nightly"}))
+	assert.NotZero(t, marker.ID)
+	assert.Equal(t, "nightly", marker.Note)
+	assert.Nil(t, marker.RedisLastSave)
+
+	status := testAPI(t, "get", "/api/backup/_marker", 200)
+	assert.EqualValues(t, marker.ID, status["cache_marker_id"])
+	assert.Equal(t, true, status["consistent"])
+
+	// the cache restored from an older snapshot
+	assert.Nil(t, utils.SetCache("backup_marker", marker.ID-1, 0))
+	status = testAPI(t, "get", "/api/backup/_marker", 200)
+	assert.Equal(t, false, status["consistent"])
+}
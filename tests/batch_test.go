@@ -0,0 +1,36 @@
+package tests
+
+import (
+	"strconv"
+	"testing"
+
+	"treehole_next/config"
+	. "treehole_next/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatch(t *testing.T) {
+	data := Map{"requests": []Map{
+		{"path": "/api/divisions"},
+		{"path": "/api/holes/" + strconv.Itoa(largeInt)},
+		{"path": "/api/tags", "query": "s=11"},
+	}}
+	resp := testAPIArray(t, "post", "/api/batch", 200, data)
+	assert.Len(t, resp, 3)
+	assert.EqualValues(t, 200, resp[0]["status"])
+	assert.IsType(t, []any{}, resp[0]["body"])
+	assert.EqualValues(t, 404, resp[1]["status"])
+	assert.EqualValues(t, 200, resp[2]["status"])
+}
+
+func TestBatchInvalid(t *testing.T) {
+	testAPI(t, "post", "/api/batch", 400, Map{"requests": []Map{{"path": "/api/batch"}}})
+	testAPI(t, "post", "/api/batch", 400, Map{"requests": []Map{{"path": "/docs"}}})
+
+	requests := make([]Map, config.Config.BatchSize+1)
+	for i := range requests {
+		requests[i] = Map{"path": "/api/divisions"}
+	}
+	testAPI(t, "post", "/api/batch", 400, Map{"requests": requests})
+}
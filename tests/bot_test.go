@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+
+	. "treehole_next/models"
+	"treehole_next/utils"
+)
+
+func TestBot(t *testing.T) {
+	var matched atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := io.ReadAll(r.Body)
+		matched.Store(payload)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	webhook := testAPI(t, "post", "/api/webhooks", 201, Map{
+		"url":    server.URL,
+		"secret": "bot-webhook-test-secret",
+		"events": []string{WebhookEventBotMatched},
+	})
+	defer testAPI(t, "delete", "/api/webhooks/"+strconv.Itoa(int(webhook["id"].(float64))), 204)
+
+	var division Division
+	testAPIModel(t, "post", "/api/divisions", 201, &division, Map{"name": "TestBot"})
+	rule := testAPI(t, "post", "/api/bot_rules", 201, Map{"name": "hotline", "keywords": []string{"Hotline"}, "division_id": division.ID})
+	defer testAPI(t, "delete", "/api/bot_rules/"+strconv.Itoa(int(rule["id"].(float64))), 204)
+	testAPI(t, "post", "/api/bot_rules", 400, Map{"name": "empty", "keywords": []string{}})
+
+	hole := Hole{DivisionID: division.ID, UserID: 1}
+	DB.Create(&hole)
+	floor := Floor{HoleID: hole.ID, UserID: 1, Content: "where is the hotline"}
+	DB.Create(&floor)
+	hole.Floors = Floors{&floor}
+
+	// not triggered until bots are enabled in the division
+	TriggerBotRules(&hole)
+	assert.True(t, utils.WaitBackground(5*time.Second))
+	assert.Nil(t, matched.Load())
+	testAPI(t, "put", "/api/divisions/"+strconv.Itoa(division.ID), 200, Map{"bot_enabled": true, "bot_rate_limit": 1})
+	TriggerBotRules(&hole)
+	assert.True(t, utils.WaitBackground(5*time.Second))
+	var payload struct {
+		Event string       `json:"event"`
+		Data  BotMatchData `json:"data"`
+	}
+	assert.Nil(t, json.Unmarshal(matched.Load().([]byte), &payload))
+	assert.Equal(t, WebhookEventBotMatched, payload.Event)
+	assert.Equal(t, hole.ID, payload.Data.HoleID)
+	assert.Equal(t, []string{"Hotline"}, payload.Data.Keywords)
+
+	withKey := func(key string, statusCode int) Map {
+		req, err := http.NewRequest("POST", "/api/bot/holes/"+strconv.Itoa(hole.ID)+"/floors",
+			bytes.NewBufferString(`{"content": "hotline: 12345"}`))
+		assert.Nil(t, err)
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("X-API-Key", key)
+		res, err := App.Test(req, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, statusCode, res.StatusCode)
+		var data Map
+		_ = json.NewDecoder(res.Body).Decode(&data)
+		return data
+	}
+	reader := testAPI(t, "post", "/api/api_keys", 201, Map{"name": "reader", "user_id": 4261, "scopes": []string{"read"}})
+	data := withKey(reader["key"].(string), 403)
+	assert.EqualValues(t, utils.ErrCodeAPIKeyScope, data["code"])
+
+	bot := testAPI(t, "post", "/api/api_keys", 201, Map{"name": "hotline bot", "user_id": 4261, "scopes": []string{"bot:write"}})
+	data = withKey(bot["key"].(string), 201)
+	assert.Equal(t, FloorTypeBot, data["type"])
+	assert.Equal(t, "hotline bot", data["anonyname"])
+	assert.EqualValues(t, 1, data["ranking"])
+
+	// rate limited in the division
+	data = withKey(bot["key"].(string), 429)
+	assert.EqualValues(t, utils.ErrCodeBotRateLimited, data["code"])
+}
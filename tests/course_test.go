@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+
+	. "treehole_next/models"
+	"treehole_next/utils"
+)
+
+func TestCourseLinks(t *testing.T) {
+	route := "/api/courses/COMP130004"
+	withKey := func(key, method string, statusCode int, body string) Map {
+		req, err := http.NewRequest(method, route, bytes.NewBufferString(body))
+		assert.Nil(t, err)
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("X-API-Key", key)
+		res, err := App.Test(req, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, statusCode, res.StatusCode)
+		var data Map
+		_ = json.NewDecoder(res.Body).Decode(&data)
+		return data
+	}
+	body := `{"name": "数据结构", "url": "https://review.example.com/courses/COMP130004", "tag": "数据结构"}`
+
+	// only the review service links courses
+	testAPI(t, "put", route, 403, Map{"name": "数据结构", "url": "https://example.com", "tag": "数据结构"})
+	reader := testAPI(t, "post", "/api/api_keys", 201, Map{"name": "reader", "user_id": 4640, "scopes": []string{"read"}})
+	data := withKey(reader["key"].(string), "PUT", 403, body)
+	assert.EqualValues(t, utils.ErrCodeAPIKeyScope, data["code"])
+
+	// the tag doesn't exist yet
+	service := testAPI(t, "post", "/api/api_keys", 201,
+		Map{"name": "curriculum", "user_id": 4640, "scopes": []string{"read", "courses:write"}})
+	data = withKey(service["key"].(string), "PUT", 200, body)
+	assert.EqualValues(t, 0, data["tag_id"])
+	assert.Empty(t, testAPIArray(t, "get", route+"/holes", 200))
+
+	hole := Hole{DivisionID: 1, UserID: 4641, Tags: Tags{{Name: "数据结构"}}, Floors: Floors{{Content: "期末", UserID: 4641}}}
+	DB.Create(&hole)
+	assert.Nil(t, SyncCourseLinks(DB))
+	holes := testAPIArray(t, "get", route+"/holes", 200)
+	if assert.Len(t, holes, 1) {
+		assert.EqualValues(t, hole.ID, holes[0]["hole_id"])
+	}
+	links := testAPIArray(t, "get", "/api/courses?tag=数据结构", 200)
+	assert.Len(t, links, 1)
+
+	// holes with the tag show the course
+	data = testAPI(t, "get", "/api/holes/"+strconv.Itoa(hole.ID), 200)
+	reviews, _ := data["course_reviews"].([]any)
+	if assert.Len(t, reviews, 1) {
+		assert.EqualValues(t, "COMP130004", reviews[0].(map[string]any)["course_code"])
+	}
+
+	// links follow renamed tags
+	DB.Model(hole.Tags[0]).Update("name", "数据结构与算法")
+	assert.Nil(t, SyncCourseLinks(DB))
+	var link CourseLink
+	DB.Where("course_code = ?", "COMP130004").Take(&link)
+	assert.Equal(t, "数据结构与算法", link.TagName)
+	assert.Equal(t, hole.Tags[0].ID, link.TagID)
+
+	withKey(service["key"].(string), "DELETE", 204, "")
+	testCommon(t, "get", route+"/holes", 404)
+}
@@ -1,9 +1,17 @@
 package tests
 
 import (
+	"context"
+	"errors"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"treehole_next/config"
+	. "treehole_next/models"
 )
 
 func TestIndex(t *testing.T) {
@@ -17,3 +25,64 @@ func TestDocs(t *testing.T) {
 	testCommon(t, "get", "/docs", 302)
 	testCommon(t, "get", "/docs/index.html", 200)
 }
+
+func TestHealth(t *testing.T) {
+	testAPI(t, "get", "/healthz", 200)
+
+	readyz := testAPI(t, "get", "/readyz", 200)
+	assert.EqualValues(t, "up", readyz["status"])
+	dependencies, ok := readyz["dependencies"].(map[string]any)
+	assert.True(t, ok)
+	assert.Contains(t, dependencies, "mysql")
+	assert.Contains(t, dependencies, "redis")
+}
+
+func TestRequestID(t *testing.T) {
+	req, err := http.NewRequest("GET", "/api/divisions", nil)
+	assert.Nil(t, err)
+	req.Header.Set("X-Request-ID", "support-ticket-1")
+	res, err := App.Test(req, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, "support-ticket-1", res.Header.Get("X-Request-ID"))
+
+	// generate one if absent or invalid
+	req, err = http.NewRequest("GET", "/api/divisions", nil)
+	assert.Nil(t, err)
+	req.Header.Set("X-Request-ID", "invalid id")
+	res, err = App.Test(req, -1)
+	assert.Nil(t, err)
+	assert.Len(t, res.Header.Get("X-Request-ID"), 32)
+}
+
+func TestRequestTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { config.Config.RequestTimeout = timeout }(config.Config.RequestTimeout)
+	config.Config.RequestTimeout = 50 * time.Millisecond
+
+	// creating a favorite group is slower than the timeout
+	var queryErr error
+	err := DB.Callback().Create().Before("gorm:create").Register("test:slow_create", func(tx *gorm.DB) {
+		if tx.Statement.Table != "favorite_groups" {
+			return
+		}
+		select {
+		case <-tx.Statement.Context.Done():
+		case <-time.After(time.Second):
+		}
+	})
+	assert.Nil(t, err)
+	defer func() { _ = DB.Callback().Create().Remove("test:slow_create") }()
+	err = DB.Callback().Create().After("gorm:create").Register("test:create_error", func(tx *gorm.DB) {
+		if tx.Statement.Table == "favorite_groups" {
+			queryErr = tx.Error
+		}
+	})
+	assert.Nil(t, err)
+	defer func() { _ = DB.Callback().Create().Remove("test:create_error") }()
+
+	testCommon(t, "post", "/api/user/favorite_groups", 503, Map{"name": "timeout"})
+	assert.True(t, errors.Is(queryErr, context.DeadlineExceeded))
+
+	var count int64
+	DB.Model(&FavoriteGroup{}).Where("name = ?", "timeout").Count(&count)
+	assert.Zero(t, count)
+}
@@ -1,10 +1,14 @@
 package tests
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"strconv"
 	"testing"
 
+	"treehole_next/config"
 	. "treehole_next/models"
+	"treehole_next/utils"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -98,3 +102,130 @@ func TestDeleteDivisionDefaultValue(t *testing.T) {
 	assert.Equal(t, toID, getHole.DivisionID)
 
 }
+
+func TestModifyDivisionRealName(t *testing.T) {
+	var division Division
+	testAPIModel(t, "put", "/api/divisions/2", 200, &division, Map{"real_name": true})
+	assert.True(t, division.RealName)
+
+	divisionIDs, err := RealNameDivisionIDs()
+	assert.Nil(t, err)
+	assert.Contains(t, divisionIDs, 2)
+
+	testAPIModel(t, "put", "/api/divisions/2", 200, &division, Map{"real_name": false})
+	assert.False(t, division.RealName)
+
+	divisionIDs, err = RealNameDivisionIDs()
+	assert.Nil(t, err)
+	assert.NotContains(t, divisionIDs, 2)
+}
+
+func TestDivisionVisibility(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/users/2" {
+			_, _ = w.Write([]byte(`{"id": 2, "groups": ["staff"]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"groups": []}`))
+	}))
+	defer server.Close()
+	saved := config.Config.AuthUrl
+	defer func() { config.Config.AuthUrl = saved }()
+	config.Config.AuthUrl = server.URL
+
+	testAPI(t, "post", "/api/divisions", 400, Map{"name": "nogroup", "visibility": "restricted"})
+	var login, staff, secret Division
+	testAPIModel(t, "post", "/api/divisions", 201, &login, Map{"name": "login", "visibility": "login"})
+	testAPIModel(t, "post", "/api/divisions", 201, &staff, Map{"name": "staff", "visibility": "restricted", "group": "staff"})
+	testAPIModel(t, "post", "/api/divisions", 201, &secret, Map{"name": "secret", "visibility": "restricted", "group": "secret"})
+	assert.Equal(t, "staff", staff.Group)
+
+	divisionIDs, err := InvisibleDivisionIDs(nil)
+	assert.Nil(t, err)
+	assert.Subset(t, divisionIDs, []int{login.ID, staff.ID, secret.ID})
+
+	divisionIDs, err = InvisibleDivisionIDs(&User{ID: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{secret.ID}, divisionIDs)
+
+	divisionIDs, err = InvisibleDivisionIDs(&User{ID: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{staff.ID, secret.ID}, divisionIDs)
+
+	divisionIDs, err = InvisibleDivisionIDs(&User{ID: 3, IsAdmin: true})
+	assert.Nil(t, err)
+	assert.Empty(t, divisionIDs)
+
+	// non-public divisions are not in feeds
+	testCommon(t, "get", "/api/divisions/"+strconv.Itoa(login.ID)+"/feed.atom", 404)
+
+	// making the division public takes effect at once
+	testAPIModel(t, "put", "/api/divisions/"+strconv.Itoa(login.ID), 200, &login, Map{"visibility": "public"})
+	divisionIDs, err = InvisibleDivisionIDs(nil)
+	assert.Nil(t, err)
+	assert.NotContains(t, divisionIDs, login.ID)
+	testCommon(t, "get", "/api/divisions/"+strconv.Itoa(login.ID)+"/feed.atom", 200)
+}
+
+func TestDivisionTagRules(t *testing.T) {
+	data := Map{"name": "TestDivisionTagRules", "max_tags": 3, "required_tags": []string{"课程"}}
+	resp := testAPI(t, "post", "/api/divisions", 201, data)
+	assert.EqualValues(t, 1, resp["min_tags"])
+	id := strconv.Itoa(int(resp["id"].(float64)))
+	testAPI(t, "post", "/api/divisions", 400, Map{"name": "TestDivisionTagRulesInvalid", "min_tags": 3, "max_tags": 2})
+
+	var division Division
+	testAPIModel(t, "put", "/api/divisions/"+id, 200, &division, Map{"min_tags": 2})
+	assert.Equal(t, 2, division.MinTags)
+	assert.Equal(t, []string{"课程"}, division.RequiredTags)
+	testAPI(t, "put", "/api/divisions/"+id, 400, Map{"min_tags": 4})
+
+	errorCode := func(err error) int {
+		if e, ok := err.(*utils.Error); ok {
+			return e.Code
+		}
+		return 0
+	}
+	assert.Nil(t, division.ValidateTags([]string{"课程", "数学"}))
+	assert.Equal(t, utils.ErrCodeTooFewTags, errorCode(division.ValidateTags([]string{"课程", " 课程"})))
+	assert.Equal(t, utils.ErrCodeTooManyTags, errorCode(division.ValidateTags([]string{"课程", "a", "b", "c"})))
+	assert.Equal(t, utils.ErrCodeRequiredTagsMissing, errorCode(division.ValidateTags([]string{"a", "b"})))
+}
+
+func TestDivisionStatus(t *testing.T) {
+	var division Division
+	testAPIModel(t, "post", "/api/divisions", 201, &division, Map{"name": "TestDivisionStatus"})
+	assert.Equal(t, DivisionStatusActive, division.Status)
+	hole := Hole{DivisionID: division.ID, UserID: 1}
+	DB.Create(&hole)
+	id := strconv.Itoa(division.ID)
+
+	resp := testAPI(t, "put", "/api/divisions/"+id+"/status", 400, Map{"status": "hidden"})
+	assert.EqualValues(t, utils.ErrCodeInvalidStatusTransition, resp["code"])
+
+	// archived divisions are listed and readable, but no new floors
+	testAPIModel(t, "put", "/api/divisions/"+id+"/status", 200, &division, Map{"status": "archived"})
+	assert.Equal(t, DivisionStatusArchived, division.Status)
+	assert.False(t, division.Hidden)
+	resp = testAPI(t, "post", "/api/holes/"+strconv.Itoa(hole.ID)+"/floors", 403, Map{"content": "archived"})
+	assert.EqualValues(t, utils.ErrCodeDivisionArchived, resp["code"])
+	resp = testAPI(t, "post", "/api/divisions/"+id+"/holes", 403, Map{"content": "archived", "tags": []Map{{"name": "archived"}}})
+	assert.EqualValues(t, utils.ErrCodeDivisionArchived, resp["code"])
+	testAPI(t, "get", "/api/holes/"+strconv.Itoa(hole.ID), 200)
+
+	// hidden divisions are not listed, old links still work
+	testAPIModel(t, "put", "/api/divisions/"+id+"/status", 200, &division, Map{"status": "hidden"})
+	assert.True(t, division.Hidden)
+	var divisions Divisions
+	testAPIModel(t, "get", "/api/divisions", 200, &divisions)
+	for _, d := range divisions {
+		assert.NotEqual(t, division.ID, d.ID)
+	}
+	testAPIModel(t, "get", "/api/divisions/"+id, 200, &division)
+	assert.Equal(t, DivisionStatusHidden, division.Status)
+
+	testAPI(t, "put", "/api/divisions/"+id+"/status", 400, Map{"status": "active"})
+	testAPIModel(t, "put", "/api/divisions/"+id+"/status", 200, &division, Map{"status": "archived"})
+	testAPIModel(t, "put", "/api/divisions/"+id+"/status", 200, &division, Map{"status": "active"})
+	assert.Nil(t, CheckDivisionArchived(division.ID))
+}
@@ -1,9 +1,13 @@
 package tests
 
 import (
+	"net/http"
+	"strconv"
+	"strings"
 	"testing"
 
 	. "treehole_next/models"
+	"treehole_next/utils"
 
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/exp/slices"
@@ -42,3 +46,147 @@ func TestDeleteFavorite(t *testing.T) {
 	DB.Where("user_id = ?", 1).Find(&userFavorites)
 	assert.EqualValues(t, favouriteLen, len(userFavorites))
 }
+
+func TestAddFavoriteIdempotency(t *testing.T) {
+	post := func(key, body string) *http.Response {
+		req, err := http.NewRequest("POST", "/api/user/favorites", strings.NewReader(body))
+		assert.Nil(t, err)
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("X-Consumer-Username", "1")
+		req.Header.Add("Idempotency-Key", key)
+		res, err := App.Test(req, -1)
+		assert.Nil(t, err)
+		return res
+	}
+	countFavorites := func() int64 {
+		var count int64
+		DB.Model(&UserFavorite{}).Where("user_id = ? AND hole_id = ?", 1, 12).Count(&count)
+		return count
+	}
+	defer DB.Where("user_id = ? AND hole_id = ?", 1, 12).Delete(&UserFavorite{})
+
+	res := post("retry-1", `{"hole_id": 12}`)
+	assert.Equal(t, 201, res.StatusCode)
+	assert.EqualValues(t, 1, countFavorites())
+
+	// retried request returns the original response without adding again
+	DB.Where("user_id = ? AND hole_id = ?", 1, 12).Delete(&UserFavorite{})
+	res = post("retry-1", `{"hole_id": 12}`)
+	assert.Equal(t, 201, res.StatusCode)
+	assert.Equal(t, "true", res.Header.Get("Idempotent-Replayed"))
+	assert.EqualValues(t, 0, countFavorites())
+
+	// same key with different body
+	res = post("retry-1", `{"hole_id": 13}`)
+	assert.Equal(t, 422, res.StatusCode)
+
+	res = post("retry-2", `{"hole_id": 12}`)
+	assert.Equal(t, 201, res.StatusCode)
+	assert.Empty(t, res.Header.Get("Idempotent-Replayed"))
+	assert.EqualValues(t, 1, countFavorites())
+}
+
+func TestFavoriteErrorCodes(t *testing.T) {
+	data := testAPI(t, "get", "/api/user/favorites?favorite_group_id=9999", 404)
+	assert.EqualValues(t, utils.ErrCodeFavoriteGroupNotFound, data["code"])
+	assert.EqualValues(t, "favorite_group_not_found", data["key"])
+	assert.EqualValues(t, "收藏夹不存在", data["message"])
+
+	data = testAPI(t, "put", "/api/user/favorites", 404, Map{"hole_ids": []int{99999}})
+	assert.EqualValues(t, utils.ErrCodeHoleNotFound, data["code"])
+	assert.EqualValues(t, "hole_not_found", data["key"])
+
+	data = testAPI(t, "delete", "/api/user/favorite_groups", 400, Map{})
+	assert.EqualValues(t, utils.ErrCodeValidation, data["code"])
+	assert.EqualValues(t, "validation_failed", data["key"])
+	assert.NotEmpty(t, data["fields"])
+}
+
+func TestFloorFavorites(t *testing.T) {
+	var floor Floor
+	DB.Where("content = ?", strings.Repeat("1", 3)).Take(&floor)
+
+	data := testAPI(t, "post", "/api/user/floor_favorites", 201, Map{"floor_id": floor.ID})
+	assert.Contains(t, data["data"], float64(floor.ID))
+
+	groups := testAPIArray(t, "post", "/api/user/floor_favorite_groups", 201, Map{"name": "questions"})
+	assert.EqualValues(t, 2, len(groups))
+	assert.EqualValues(t, 1, groups[0]["count"])
+	assert.EqualValues(t, 1, groups[1]["favorite_group_id"])
+	testCommon(t, "put", "/api/user/floor_favorites/move", 200, Map{
+		"floor_ids":              []int{floor.ID},
+		"from_favorite_group_id": 0,
+		"to_favorite_group_id":   1,
+	})
+
+	var floors Floors
+	testAPIModel(t, "get", "/api/user/floor_favorites?favorite_group_id=1", 200, &floors)
+	assert.EqualValues(t, 1, len(floors))
+	assert.True(t, floors[0].IsBookmarked)
+	testAPIModel(t, "get", "/api/user/floor_favorites?favorite_group_id=0", 200, &floors)
+	assert.EqualValues(t, 0, len(floors))
+
+	// hole favorites are independent
+	var holeGroups FavoriteGroups
+	DB.Where("user_id = ? AND favorite_group_id = 1", 1).Find(&holeGroups)
+	assert.EqualValues(t, 0, len(holeGroups))
+
+	export := testAPI(t, "get", "/api/user/floor_favorites/export", 200)
+	assert.EqualValues(t, 2, len(export["favorite_groups"].([]any)))
+	assert.EqualValues(t, 1, len(export["favorites"].([]any)))
+
+	data = testAPI(t, "delete", "/api/user/floor_favorite_groups", 403, Map{"favorite_group_id": 1})
+	assert.EqualValues(t, utils.ErrCodeFavoriteGroupNotEmpty, data["code"])
+	testAPI(t, "delete", "/api/user/floor_favorites", 200, Map{"floor_id": floor.ID, "favorite_group_id": 1})
+	testAPI(t, "delete", "/api/user/floor_favorite_groups", 204, Map{"favorite_group_id": 1})
+
+	data = testAPI(t, "post", "/api/user/floor_favorites", 404, Map{"floor_id": 999999})
+	assert.EqualValues(t, utils.ErrCodeFloorNotFound, data["code"])
+}
+
+func TestBatchSubscriptions(t *testing.T) {
+	holes := Holes{{DivisionID: 1}, {DivisionID: 1}}
+	DB.Create(&holes)
+	a, b := holes[0].ID, holes[1].ID
+
+	data := testAPI(t, "post", "/api/user/subscriptions/holes", 201, Map{"hole_ids": []int{a, b, a}})
+	assert.Subset(t, data["data"], []any{float64(a), float64(b)})
+	hole := testAPI(t, "get", "/api/holes/"+strconv.Itoa(a), 200)
+	assert.Equal(t, true, hole["is_subscribed"])
+
+	data = testAPI(t, "delete", "/api/user/subscriptions/holes", 200, Map{"hole_ids": []int{a}})
+	assert.NotContains(t, data["data"], float64(a))
+	assert.Contains(t, data["data"], float64(b))
+	hole = testAPI(t, "get", "/api/holes/"+strconv.Itoa(a), 200)
+	assert.Equal(t, false, hole["is_subscribed"])
+
+	testAPI(t, "post", "/api/user/subscriptions/holes", 404, Map{"hole_ids": []int{b, largeInt}})
+	testAPI(t, "post", "/api/user/subscriptions/holes", 400, Map{"hole_ids": []int{}})
+}
+
+func TestFavoriteRoutes(t *testing.T) {
+	hole := newTestHole(t, nil)
+	favorited := func(want bool) func(t *testing.T, body []byte) {
+		return func(t *testing.T, body []byte) {
+			holes := decodeBody[Holes](t, body)
+			assert.Equal(t, want, slices.ContainsFunc(holes, func(h *Hole) bool { return h.ID == hole.ID }))
+		}
+	}
+	var groupID int
+
+	runAPITests(t, []apiTestCase{
+		{name: "add", method: "post", route: "/api/user/favorites", body: Map{"hole_id": hole.ID}, statusCode: 201},
+		{name: "list", method: "get", route: "/api/user/favorites", statusCode: 200, check: favorited(true)},
+		{name: "add group", method: "post", route: "/api/user/favorite_groups", body: Map{"name": "routes"}, statusCode: 201,
+			check: func(t *testing.T, body []byte) {
+				groups := decodeBody[[]FavoriteGroup](t, body)
+				groupID = groups[len(groups)-1].FavoriteGroupID
+				assert.Equal(t, "routes", groups[len(groups)-1].Name)
+			}},
+		{name: "add group without name", method: "post", route: "/api/user/favorite_groups", body: Map{}, statusCode: 400},
+		{name: "delete", method: "delete", route: "/api/user/favorites", body: Map{"hole_id": hole.ID}, statusCode: 200},
+		{name: "list after delete", method: "get", route: "/api/user/favorites", statusCode: 200, check: favorited(false)},
+	})
+
+	testCommon(t, "delete", "/api/user/favorite_groups", 204, Map{"favorite_group_id": groupID})
+}
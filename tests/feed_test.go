@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"encoding/xml"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"treehole_next/apis/feed"
+	. "treehole_next/models"
+)
+
+func TestDivisionFeed(t *testing.T) {
+	division := Division{Name: "feed", Description: "feed"}
+	assert.Nil(t, DB.Create(&division).Error)
+	holes := Holes{
+		{DivisionID: division.ID, Floors: Floors{{Content: "public content", Anonyname: "Alice", UserID: 1}}},
+		{DivisionID: division.ID, Floors: Floors{{Content: "folded content", Fold: "folded", Anonyname: "Bob", UserID: 1}}},
+		{DivisionID: division.ID, Floors: Floors{{Content: "sensitive content", IsSensitive: true, Anonyname: "Carol", UserID: 1}}},
+		{DivisionID: division.ID, Hidden: true, Floors: Floors{{Content: "hidden content", Anonyname: "Dave", UserID: 1}}},
+	}
+	assert.Nil(t, DB.Create(&holes).Error)
+
+	route := "/api/divisions/" + strconv.Itoa(division.ID) + "/feed.atom"
+	res, err := App.Test(httptest.NewRequest("GET", route, nil), -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Contains(t, res.Header.Get("Content-Type"), "application/atom+xml")
+	assert.Contains(t, res.Header.Get("Cache-Control"), "max-age")
+
+	var atom feed.Feed
+	assert.Nil(t, xml.NewDecoder(res.Body).Decode(&atom))
+	assert.Equal(t, "feed", atom.Title)
+	assert.Len(t, atom.Entries, 2)
+	summaries := map[string]string{}
+	for _, entry := range atom.Entries {
+		summaries[entry.Author.Name] = entry.Summary
+	}
+	assert.Equal(t, map[string]string{"Alice": "public content", "Bob": "folded"}, summaries)
+
+	req := httptest.NewRequest("GET", route, nil)
+	req.Header.Set("If-None-Match", res.Header.Get("ETag"))
+	res, err = App.Test(req, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 304, res.StatusCode)
+
+	testCommon(t, "get", "/api/divisions/1000000/feed.atom", 404)
+}
+
+func TestHiddenDivisionFeed(t *testing.T) {
+	division := Division{Name: "hidden feed", Description: "hidden feed", Hidden: true, Status: DivisionStatusHidden}
+	assert.Nil(t, DB.Create(&division).Error)
+	hole := Hole{DivisionID: division.ID, Floors: Floors{{Content: "hidden division", Anonyname: "Alice", UserID: 1}}}
+	assert.Nil(t, DB.Create(&hole).Error)
+
+	testCommon(t, "get", "/api/divisions/"+strconv.Itoa(division.ID)+"/feed.atom", 404)
+}
+
+func TestTagFeed(t *testing.T) {
+	tag := Tag{Name: "feed"}
+	holes := Holes{
+		{DivisionID: 1, Tags: Tags{&tag}, Floors: Floors{{Content: "tagged", Anonyname: "Alice", UserID: 1}}},
+		{DivisionID: 1, Tags: Tags{&tag}, Hidden: true, Floors: Floors{{Content: "hidden", Anonyname: "Bob", UserID: 1}}},
+	}
+	assert.Nil(t, DB.Create(&holes).Error)
+
+	res, err := App.Test(httptest.NewRequest("GET", "/api/tags/feed/feed.atom", nil), -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	var atom feed.Feed
+	assert.Nil(t, xml.NewDecoder(res.Body).Decode(&atom))
+	assert.Equal(t, "#feed", atom.Title)
+	assert.Len(t, atom.Entries, 1)
+	assert.Equal(t, "/api/holes/"+strconv.Itoa(holes[0].ID), atom.Entries[0].Link.Href)
+}
+
+func TestSitemap(t *testing.T) {
+	var count int64
+	DB.Model(&Hole{}).Where("hidden = ?", false).Count(&count)
+
+	var index feed.SitemapIndex
+	assert.Nil(t, xml.Unmarshal(testCommon(t, "get", "/api/sitemap.xml", 200), &index))
+	assert.Len(t, index.Sitemaps, int(count+9999)/10000)
+
+	var urlSet feed.URLSet
+	assert.Nil(t, xml.Unmarshal(testCommon(t, "get", "/api/sitemap.xml?page=1", 200), &urlSet))
+	assert.Len(t, urlSet.URLs, int(count))
+
+	testCommon(t, "get", "/api/sitemap.xml?page=100", 404)
+}
+
+func TestHoleMeta(t *testing.T) {
+	holes := Holes{
+		{DivisionID: 1, Reply: 2, Floors: Floors{{Content: "meta content", Anonyname: "Alice", UserID: 1}}},
+		{DivisionID: 1, Floors: Floors{{Content: "sensitive", IsSensitive: true, Anonyname: "Bob", UserID: 1}}},
+		{DivisionID: 1, Hidden: true, Floors: Floors{{Content: "hidden", Anonyname: "Carol", UserID: 1}}},
+	}
+	assert.Nil(t, DB.Create(&holes).Error)
+
+	meta := testAPI(t, "get", "/api/holes/"+strconv.Itoa(holes[0].ID)+"/meta", 200)
+	assert.Equal(t, "meta content", meta["preview"])
+	assert.EqualValues(t, 3, meta["floor_count"])
+
+	meta = testAPI(t, "get", "/api/holes/"+strconv.Itoa(holes[1].ID)+"/meta", 200)
+	assert.Empty(t, meta["preview"])
+	assert.Equal(t, "#"+strconv.Itoa(holes[1].ID), meta["title"])
+
+	testCommon(t, "get", "/api/holes/"+strconv.Itoa(holes[2].ID)+"/meta", 404)
+}
@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "treehole_next/models"
+)
+
+// fixtures create rows for a single test, holes in a division of their own,
+// so that tests don't depend on the data of init.go or on the order of other tests.
+// Options modify the row before it is created.
+
+var fixtureSeq atomic.Int64
+
+// fixtureName returns a name unique in the test run
+func fixtureName(prefix string) string {
+	return fmt.Sprintf("%s_%d", prefix, fixtureSeq.Add(1))
+}
+
+func newTestDivision(t *testing.T, options ...func(*Division)) *Division {
+	division := Division{Name: fixtureName("division"), Description: "fixture"}
+	for _, option := range options {
+		option(&division)
+	}
+	assert.Nil(t, DB.Create(&division).Error, "create division")
+	return &division
+}
+
+// newTestUser creates a user other than the user of requests, which is 1 in test mode
+func newTestUser(t *testing.T, options ...func(*User)) *User {
+	user := User{ID: 100000 + int(fixtureSeq.Add(1))}
+	for _, option := range options {
+		option(&user)
+	}
+	assert.Nil(t, DB.Create(&user).Error, "create user")
+	return &user
+}
+
+// newTestHole creates a hole of user 1 with its first floor, in a new division if division is nil
+func newTestHole(t *testing.T, division *Division, options ...func(*Hole)) *Hole {
+	if division == nil {
+		division = newTestDivision(t)
+	}
+	hole := Hole{DivisionID: division.ID, UserID: 1}
+	for _, option := range options {
+		option(&hole)
+	}
+	if len(hole.Floors) == 0 {
+		hole.Floors = Floors{{Content: fixtureName("floor"), UserID: hole.UserID, Ranking: 0}}
+	}
+	assert.Nil(t, DB.Create(&hole).Error, "create hole")
+	return &hole
+}
+
+// newTestFloor appends a floor of user 1 to the hole
+func newTestFloor(t *testing.T, hole *Hole, options ...func(*Floor)) *Floor {
+	var ranking int64
+	DB.Model(&Floor{}).Where("hole_id = ?", hole.ID).Count(&ranking)
+	floor := Floor{HoleID: hole.ID, UserID: 1, Content: fixtureName("floor"), Ranking: int(ranking)}
+	for _, option := range options {
+		option(&floor)
+	}
+	assert.Nil(t, DB.Create(&floor).Error, "create floor")
+	assert.Nil(t, DB.Model(hole).UpdateColumn("reply", ranking).Error, "update reply")
+	return &floor
+}
+
+// newTestFavorite adds the hole to the default favorite group of the user
+func newTestFavorite(t *testing.T, userID int, hole *Hole) {
+	assert.Nil(t, DB.Create(&UserFavorite{UserID: userID, HoleID: hole.ID}).Error, "create favorite")
+}
+
+// newTestReport reports the floor by user 1
+func newTestReport(t *testing.T, floor *Floor, options ...func(*Report)) *Report {
+	report := Report{FloorID: floor.ID, UserID: 1, Reason: fixtureName("reason")}
+	for _, option := range options {
+		option(&report)
+	}
+	assert.Nil(t, DB.Create(&report).Error, "create report")
+	return &report
+}
@@ -1,16 +1,25 @@
 package tests
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
 
 	. "treehole_next/config"
 	. "treehole_next/models"
+	"treehole_next/utils"
 
 	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
 )
 
 func TestListFloorsInAHole(t *testing.T) {
@@ -42,6 +51,37 @@ func TestListFloorsInAHole(t *testing.T) {
 	}
 }
 
+func TestListFloorsInAHoleByRanking(t *testing.T) {
+	var hole Hole
+	DB.Where("division_id = ?", 7).First(&hole)
+	route := "/api/holes/" + strconv.Itoa(hole.ID) + "/floors"
+
+	// newest first
+	var floors Floors
+	testAPIModelWithQuery(t, "get", route, 200, &floors, Map{"order": "desc", "size": 5})
+	assert.EqualValues(t, 5, len(floors))
+	if len(floors) == 5 {
+		assert.EqualValues(t, 49, floors[0].Ranking)
+		assert.EqualValues(t, 45, floors[4].Ranking)
+	}
+	testAPIModelWithQuery(t, "get", route, 200, &floors, Map{"order": "desc", "size": 5, "offset": 5})
+	if len(floors) != 0 {
+		assert.EqualValues(t, 44, floors[0].Ranking)
+	}
+
+	// jump to floor
+	var floor Floor
+	DB.Where("hole_id = ? and ranking = ?", hole.ID, 20).First(&floor)
+	testAPIModelWithQuery(t, "get", route, 200, &floors, Map{"around_floor_id": floor.ID, "size": 6})
+	assert.EqualValues(t, 6, len(floors))
+	if len(floors) == 6 {
+		assert.EqualValues(t, 17, floors[0].Ranking)
+		assert.EqualValues(t, floor.ID, floors[3].ID)
+	}
+
+	testCommonQuery(t, "get", route, 404, Map{"around_floor_id": largeInt})
+}
+
 func TestListFloorsOld(t *testing.T) {
 	var hole Hole
 	DB.Where("division_id = ?", 7).First(&hole)
@@ -172,6 +212,82 @@ func TestModifyFloor(t *testing.T) {
 	assert.EqualValues(t, 0, getFloor.Like)
 }
 
+func TestModifyFloorVersion(t *testing.T) {
+	var hole Hole
+	DB.Where("division_id = ?", 7).Offset(5).First(&hole)
+	var floor Floor
+	DB.Where("hole_id = ?", hole.ID).First(&floor)
+	route := "/api/floors/" + strconv.Itoa(floor.ID)
+
+	// edit based on the current version
+	var modified Floor
+	testAPIModel(t, "put", route, 200, &modified, Map{"fold_v2": "device 1", "version": floor.Version})
+	assert.EqualValues(t, floor.Version+1, modified.Version)
+
+	// another device edits based on the old version
+	conflict := testAPI(t, "put", route, 409, Map{"fold_v2": "device 2", "version": floor.Version})
+	assert.EqualValues(t, modified.Version, conflict["version"])
+	assert.EqualValues(t, "device 1", conflict["floor"].(Map)["fold_v2"])
+	var getFloor Floor
+	DB.Find(&getFloor, floor.ID)
+	assert.EqualValues(t, "device 1", getFloor.Fold)
+
+	// version omitted, overwrite
+	testAPI(t, "put", route, 200, Map{"fold_v2": "device 2"})
+	DB.Find(&getFloor, floor.ID)
+	assert.EqualValues(t, "device 2", getFloor.Fold)
+	assert.EqualValues(t, floor.Version+2, getFloor.Version)
+}
+
+func TestLikeDigest(t *testing.T) {
+	var hole Hole
+	DB.Where("division_id = ?", 7).Offset(6).First(&hole)
+	floor := Floor{HoleID: hole.ID, UserID: 5, Content: "like digest", Ranking: 1000}
+	DB.Create(&floor)
+	owner := User{ID: 5}
+	DB.FirstOrCreate(&owner)
+	setLikeNotify := func(likeNotify string) {
+		owner.Config.LikeNotify = likeNotify
+		DB.Model(&owner).Select("Config").Updates(&owner)
+	}
+	route := "/api/floors/" + strconv.Itoa(floor.ID) + "/like/"
+	countMessages := func() int64 {
+		var count int64
+		DB.Model(&Message{}).
+			Joins("JOIN message_user ON message_user.message_id = message.id").
+			Where("message_user.user_id = ? AND message.type = ?", owner.ID, MessageTypeLike).
+			Count(&count)
+		return count
+	}
+
+	// liked again is not counted
+	setLikeNotify(LikeNotifyImmediate)
+	testAPI(t, "post", route+"1", 200)
+	testAPI(t, "post", route+"1", 200)
+	var digest LikeDigest
+	DB.Take(&digest, owner.ID)
+	assert.EqualValues(t, 1, digest.Count)
+	assert.EqualValues(t, floor.ID, digest.FloorID)
+
+	assert.Nil(t, FlushLikeDigests())
+	assert.EqualValues(t, 1, countMessages())
+	assert.ErrorIs(t, DB.Take(&LikeDigest{}, owner.ID).Error, gorm.ErrRecordNotFound)
+
+	// daily digests wait
+	setLikeNotify(LikeNotifyDaily)
+	testAPI(t, "post", route+"0", 200)
+	testAPI(t, "post", route+"1", 200)
+	assert.Nil(t, FlushLikeDigests())
+	assert.EqualValues(t, 1, countMessages())
+	assert.Nil(t, DB.Take(&LikeDigest{}, owner.ID).Error)
+
+	// turned off, pending likes are dropped
+	setLikeNotify(LikeNotifyOff)
+	assert.Nil(t, FlushLikeDigests())
+	assert.EqualValues(t, 1, countMessages())
+	assert.ErrorIs(t, DB.Take(&LikeDigest{}, owner.ID).Error, gorm.ErrRecordNotFound)
+}
+
 func TestModifyFloorLike(t *testing.T) {
 	var hole Hole
 	DB.Where("division_id = ?", 7).Offset(4).First(&hole)
@@ -200,6 +316,46 @@ func TestModifyFloorLike(t *testing.T) {
 	assert.EqualValues(t, 0, floor.Like)
 }
 
+func TestToggleFloorLike(t *testing.T) {
+	hole := Hole{DivisionID: 7, UserID: 5}
+	DB.Create(&hole)
+	floor := Floor{HoleID: hole.ID, UserID: 5, Content: "TestToggleFloorLike"}
+	DB.Create(&floor)
+	route := "/api/floors/" + strconv.Itoa(floor.ID) + "/like/"
+
+	// cached likes are refreshed after toggling
+	var floors Floors
+	testAPIModel(t, "get", "/api/holes/"+strconv.Itoa(hole.ID)+"/floors", 200, &floors)
+	assert.False(t, floors[0].LikedFrontend)
+
+	// like → neutral → like → dislike
+	for _, step := range []struct {
+		action, like, dislike int
+		liked, disliked       bool
+	}{
+		{1, 1, 0, true, false},
+		{1, 0, 0, false, false},
+		{1, 1, 0, true, false},
+		{-1, 0, 1, false, true},
+	} {
+		var got Floor
+		testAPIModel(t, "post", route+strconv.Itoa(step.action)+"/_toggle", 200, &got)
+		assert.Equal(t, step.liked, got.LikedFrontend)
+		assert.Equal(t, step.disliked, got.DislikedFrontend)
+		assert.EqualValues(t, step.like, got.Like)
+		assert.EqualValues(t, step.dislike, got.Dislike)
+
+		testAPIModel(t, "get", "/api/holes/"+strconv.Itoa(hole.ID)+"/floors", 200, &floors)
+		assert.Equal(t, step.liked, floors[0].LikedFrontend)
+		assert.Equal(t, step.disliked, floors[0].DislikedFrontend)
+	}
+	testAPI(t, "post", route+"0/_toggle", 400)
+
+	var count int64
+	DB.Model(&FloorLike{}).Where("floor_id = ?", floor.ID).Count(&count)
+	assert.EqualValues(t, 1, count)
+}
+
 func TestDeleteFloor(t *testing.T) {
 	var hole Hole
 	DB.Where("division_id = ?", 7).Offset(5).First(&hole)
@@ -212,6 +368,8 @@ func TestDeleteFloor(t *testing.T) {
 
 	DB.First(&floor, floor.ID)
 	assert.EqualValues(t, true, floor.Deleted)
+	// no category if deleted by the author
+	assert.Empty(t, floor.DeleteCategory)
 	var floorHistory FloorHistory
 	DB.Where("floor_id = ?", floor.ID).First(&floorHistory)
 	assert.EqualValues(t, content, floorHistory.Reason)
@@ -219,5 +377,553 @@ func TestDeleteFloor(t *testing.T) {
 	// permission
 	floor = Floor{}
 	DB.Where("hole_id = ?", hole.ID).Offset(1).First(&floor)
+	// moderators choose a category
+	testAPI(t, "delete", "/api/floors/"+strconv.Itoa(floor.ID), 400, data)
+	testAPI(t, "delete", "/api/floors/"+strconv.Itoa(floor.ID), 400, Map{"delete_category": "unknown"})
+	data["delete_category"] = ReportCategoryAbuse
 	testAPI(t, "delete", "/api/floors/"+strconv.Itoa(floor.ID), 200, data)
+
+	DB.First(&floor, floor.ID)
+	assert.EqualValues(t, "该内容因人身攻击被移除", floor.Content)
+	assert.EqualValues(t, ReportCategoryAbuse, floor.DeleteCategory)
+	floorHistory = FloorHistory{}
+	DB.Where("floor_id = ?", floor.ID).First(&floorHistory)
+	assert.EqualValues(t, "人身攻击：1234567", floorHistory.Reason)
+
+	// the tombstone is shown to users
+	var getFloor Floor
+	testAPIModel(t, "get", "/api/floors/"+strconv.Itoa(floor.ID), 200, &getFloor)
+	assert.EqualValues(t, "该内容因人身攻击被移除", getFloor.Content)
+	assert.EqualValues(t, ReportCategoryAbuse, getFloor.DeleteCategory)
+
+	// the author is notified with the note
+	var message Message
+	err := DB.Where("url = ? AND title = ?", "/api/floors/"+strconv.Itoa(floor.ID), "您的内容被管理员删除了").Take(&message).Error
+	assert.Nil(t, err)
+	assert.EqualValues(t, "人身攻击：1234567", message.Description)
+}
+
+func TestBatchModerateFloors(t *testing.T) {
+	hole := Hole{DivisionID: 1, UserID: 1, Floors: Floors{
+		{Content: "spam 1", Anonyname: "Alice", UserID: 1},
+		{Content: "spam 2", Anonyname: "Alice", UserID: 1, Ranking: 1},
+		{Content: "spam 3", Anonyname: "Alice", UserID: 1, Ranking: 2},
+	}}
+	DB.Create(&hole)
+	ids := []int{hole.Floors[0].ID, hole.Floors[1].ID, largeInt}
+
+	testAPI(t, "post", "/api/admin/floors/batch", 400, Map{"ids": ids, "action": "delete"})
+	testAPI(t, "post", "/api/admin/floors/batch", 400, Map{"ids": ids, "action": "delete", "category": "unknown"})
+
+	var results []Map
+	err := json.Unmarshal(testCommon(t, "post", "/api/admin/floors/batch", 200, Map{"ids": ids, "action": "fold", "reason": "spam"}), &results)
+	assert.Nil(t, err)
+	assert.Len(t, results, 3)
+	assert.Equal(t, true, results[0]["success"])
+	assert.Equal(t, false, results[2]["success"])
+	var floor Floor
+	DB.First(&floor, hole.Floors[1].ID)
+	assert.Equal(t, "spam", floor.Fold)
+
+	err = json.Unmarshal(testCommon(t, "post", "/api/admin/floors/batch", 200, Map{"ids": []int{hole.Floors[1].ID, hole.Floors[2].ID}, "action": "hide"}), &results)
+	assert.Nil(t, err)
+	assert.Equal(t, true, results[1]["success"])
+	floor = Floor{}
+	DB.First(&floor, hole.Floors[2].ID)
+	assert.True(t, floor.Deleted)
+	assert.True(t, floor.Sensitive())
+
+	// deleted floors are skipped
+	err = json.Unmarshal(testCommon(t, "post", "/api/admin/floors/batch", 200, Map{"ids": ids, "action": "delete", "category": ReportCategorySpam}), &results)
+	assert.Nil(t, err)
+	assert.Equal(t, true, results[0]["success"])
+	assert.Equal(t, false, results[1]["success"])
+	floor = Floor{}
+	DB.First(&floor, hole.Floors[0].ID)
+	assert.Equal(t, "该内容因垃圾广告被移除", floor.Content)
+	assert.Equal(t, ReportCategorySpam, floor.DeleteCategory)
+
+	var count int64
+	DB.Model(&AdminLog{}).Where("type = ?", AdminLogTypeBatchFloor).Count(&count)
+	assert.EqualValues(t, 3, count)
+}
+
+func TestGetFloorTranslation(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		_ = json.NewEncoder(w).Encode(map[string]string{"text": body["target"] + ":" + body["text"]})
+	}))
+	defer server.Close()
+	translationUrl := Config.TranslationUrl
+	defer func() { Config.TranslationUrl = translationUrl }()
+
+	var hole Hole
+	DB.Where("division_id = ?", 7).Offset(7).First(&hole)
+	floor := Floor{HoleID: hole.ID, UserID: 1, Content: "translate me", Ranking: 1001}
+	DB.Create(&floor)
+	route := "/api/floors/" + strconv.Itoa(floor.ID) + "/translation"
+
+	// disabled
+	Config.TranslationUrl = ""
+	testAPI(t, "get", route, 503)
+
+	Config.TranslationUrl = server.URL
+	resp := testAPI(t, "get", route+"?lang=ja", 200)
+	assert.EqualValues(t, "ja:translate me", resp["content"])
+	assert.EqualValues(t, 1, calls.Load())
+
+	// cached
+	resp = testAPI(t, "get", route+"?lang=ja", 200)
+	assert.EqualValues(t, "ja:translate me", resp["content"])
+	assert.EqualValues(t, 1, calls.Load())
+
+	// modified floors are translated again
+	DB.Model(&floor).Update("content", "translate me again")
+	resp = testAPI(t, "get", route+"?lang=ja", 200)
+	assert.EqualValues(t, "ja:translate me again", resp["content"])
+	assert.EqualValues(t, 2, calls.Load())
+
+	// default language
+	resp = testAPI(t, "get", route, 200)
+	assert.EqualValues(t, "en", resp["lang"])
+
+	testAPI(t, "get", route+"?lang=xx", 400)
+}
+
+func TestGetFloorPlain(t *testing.T) {
+	var hole Hole
+	DB.Where("division_id = ?", 7).Offset(8).First(&hole)
+	floor := Floor{HoleID: hole.ID, UserID: 1, Content: "## 标题\n**你好** ![猫猫](https://example.com/cat.png)", Ranking: 1002}
+	DB.Create(&floor)
+
+	var getFloor Floor
+	testAPIModel(t, "get", "/api/floors/"+strconv.Itoa(floor.ID)+"?format=plain", 200, &getFloor)
+	assert.EqualValues(t, "标题\n你好 [图片：猫猫]", getFloor.Content)
+
+	testAPIModel(t, "get", "/api/floors/"+strconv.Itoa(floor.ID), 200, &getFloor)
+	assert.EqualValues(t, floor.Content, getFloor.Content)
+}
+
+type stubSpamChecker float64
+
+func (score stubSpamChecker) Check(_ context.Context, _ *SpamContent) (SpamScore, error) {
+	return SpamScore{Score: float64(score), Reasons: []string{"stub"}}, nil
+}
+
+func TestCheckSpam(t *testing.T) {
+	saved := Spam
+	defer func() { Spam = saved }()
+	defer func(fold, report, block float64) {
+		Config.SpamFoldThreshold, Config.SpamReportThreshold, Config.SpamBlockThreshold = fold, report, block
+	}(Config.SpamFoldThreshold, Config.SpamReportThreshold, Config.SpamBlockThreshold)
+	Config.SpamFoldThreshold, Config.SpamReportThreshold, Config.SpamBlockThreshold = 0.5, 0.7, 0.9
+
+	ctx := context.Background()
+	user := &User{ID: 950}
+
+	// the same content scores higher each time
+	content := &SpamContent{UserID: user.ID, Content: "buy now"}
+	first, err := DuplicateSpamChecker{}.Check(ctx, content)
+	assert.Nil(t, err)
+	assert.Zero(t, first.Score)
+	for i := 0; i < Config.SpamDuplicateLimit; i++ {
+		_, _ = DuplicateSpamChecker{}.Check(ctx, content)
+	}
+	last, err := DuplicateSpamChecker{}.Check(ctx, content)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, last.Score)
+	assert.NotEmpty(t, last.Reasons)
+
+	Spam = stubSpamChecker(0.3)
+	floor := Floor{Content: "hello"}
+	verdict, err := CheckSpam(ctx, user, 1, &floor, false)
+	assert.Nil(t, err)
+	assert.False(t, verdict.Fold)
+	assert.Empty(t, floor.Fold)
+
+	Spam = stubSpamChecker(0.8)
+	verdict, err = CheckSpam(ctx, user, 1, &floor, false)
+	assert.Nil(t, err)
+	assert.True(t, verdict.Fold)
+	assert.True(t, verdict.Report)
+	assert.NotEmpty(t, floor.Fold)
+
+	floor = Floor{HoleID: 1, UserID: 950, Content: "TestCheckSpam"}
+	DB.Create(&floor)
+	verdict.ReportFloor(&floor)
+	var report Report
+	err = DB.Where("floor_id = ? AND user_id = 0", floor.ID).Take(&report).Error
+	assert.Nil(t, err)
+	assert.Contains(t, report.Reason, "stub")
+
+	Spam = stubSpamChecker(0.95)
+	_, err = CheckSpam(ctx, user, 1, &Floor{Content: "hello"}, false)
+	assert.Equal(t, utils.ErrCodeSpamBlocked, err.(*utils.Error).Code)
+
+	// admins are not checked
+	_, err = CheckSpam(ctx, &User{ID: 1, IsAdmin: true}, 1, &Floor{Content: "hello"}, false)
+	assert.Nil(t, err)
+}
+
+func TestSpamChallenge(t *testing.T) {
+	saved := Spam
+	defer func() { Spam = saved }()
+	defer func(threshold float64, secret string) {
+		Config.SpamChallengeThreshold, Config.ChallengeSecret = threshold, secret
+	}(Config.SpamChallengeThreshold, Config.ChallengeSecret)
+	Config.SpamChallengeThreshold, Config.ChallengeSecret = 0.5, "secret"
+	Spam = stubSpamChecker(0.6)
+
+	ctx := context.Background()
+	user := &User{ID: 951}
+	_, err := CheckSpam(ctx, user, 1, &Floor{Content: "hello"}, false)
+	e, ok := err.(*utils.Error)
+	assert.True(t, ok)
+	assert.Equal(t, utils.ErrCodeChallengeRequired, e.Code)
+	assert.Equal(t, 428, e.StatusCode())
+	assert.NotEmpty(t, e.Challenge)
+
+	solved := func(token, proof string, userID int) bool {
+		c := App.AcquireCtx(&fasthttp.RequestCtx{})
+		defer App.ReleaseCtx(c)
+		c.Request().Header.Set("X-Challenge-Token", token)
+		c.Request().Header.Set("X-Challenge-Proof", proof)
+		return ChallengeSolved(c, userID)
+	}
+	assert.False(t, solved(e.Challenge, "sha256=invalid", user.ID))
+	assert.False(t, solved(e.Challenge, SignChallenge(e.Challenge), 952))
+	assert.True(t, solved(e.Challenge, SignChallenge(e.Challenge), user.ID))
+	// used only once
+	assert.False(t, solved(e.Challenge, SignChallenge(e.Challenge), user.ID))
+
+	_, err = CheckSpam(ctx, user, 1, &Floor{Content: "hello"}, true)
+	assert.Nil(t, err)
+}
+
+func TestImageReview(t *testing.T) {
+	submitted := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		submitted <- body["url"]
+	}))
+	defer server.Close()
+	defer func(reviewUrl, secret string, hosts []string) {
+		Config.ImageReviewUrl, Config.ImageReviewSecret, Config.ValidImageUrl = reviewUrl, secret, hosts
+	}(Config.ImageReviewUrl, Config.ImageReviewSecret, Config.ValidImageUrl)
+	Config.ImageReviewUrl, Config.ImageReviewSecret, Config.ValidImageUrl = server.URL, "secret", []string{"img.example.com"}
+
+	imageURL := "https://img.example.com/review.png"
+	hole := Hole{DivisionID: 1, UserID: 1, Floors: Floors{
+		{Content: "![](" + imageURL + ") ![](https://other.example.com/a.png)", Anonyname: "Alice", UserID: 1},
+		{Content: "again ![cat](" + imageURL + ")", Anonyname: "Alice", UserID: 1, Ranking: 1},
+	}}
+	DB.Create(&hole)
+	for _, floor := range hole.Floors {
+		ReviewFloorImages(floor)
+	}
+	assert.Equal(t, imageURL, <-submitted)
+	var image ImageReview
+	DB.Where("url = ?", imageURL).Take(&image)
+	assert.Equal(t, ImageStatusPending, image.Status)
+	var count int64
+	DB.Model(&FloorImage{}).Where("image_id = ?", image.ID).Count(&count)
+	assert.EqualValues(t, 2, count)
+
+	callback := func(body string, signature string) int {
+		req, err := http.NewRequest("POST", "/api/images/_review", strings.NewReader(body))
+		assert.Nil(t, err)
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("X-Treehole-Signature", signature)
+		res, err := App.Test(req, -1)
+		assert.Nil(t, err)
+		return res.StatusCode
+	}
+	body := `{"results": [{"url": "` + imageURL + `", "status": "rejected", "reason": "porn"}, {"url": "https://img.example.com/unknown.png", "status": "approved"}]}`
+	assert.Equal(t, 401, callback(body, "sha256=invalid"))
+	assert.Equal(t, 204, callback(body, SignWebhookPayload("secret", []byte(body))))
+
+	DB.Where("url = ?", imageURL).Take(&image)
+	assert.Equal(t, ImageStatusRejected, image.Status)
+	var floors Floors
+	DB.Where("hole_id = ?", hole.ID).Find(&floors)
+	for _, floor := range floors {
+		assert.Equal(t, ImageFoldReason, floor.Fold)
+	}
+
+	// new floors with the rejected image are folded at once
+	floor := Floor{HoleID: hole.ID, Content: "![](" + imageURL + ")", Anonyname: "Bob", UserID: 2, Ranking: 2}
+	DB.Create(&floor)
+	ReviewFloorImages(&floor)
+	assert.Equal(t, ImageFoldReason, floor.Fold)
+}
+
+func TestLinkRules(t *testing.T) {
+	defer func(redirectUrl string) { Config.LinkRedirectUrl = redirectUrl }(Config.LinkRedirectUrl)
+	Config.LinkRedirectUrl = "https://treehole.test/api/links/redirect"
+
+	blocked := testAPI(t, "post", "/api/link_rules", 201, Map{"domain": "spam.test", "action": "block"})
+	testAPI(t, "post", "/api/link_rules", 201, Map{"domain": "shady.test", "action": "fold"})
+	testAPI(t, "post", "/api/link_rules", 201, Map{"domain": "Trusted.test", "action": "allow"})
+	// the rule of a domain is replaced
+	testAPI(t, "post", "/api/link_rules", 201, Map{"domain": "shady.test", "action": "fold", "reason": "phishing"})
+	rules := testAPIArray(t, "get", "/api/link_rules", 200)
+	assert.Len(t, rules, 3)
+
+	// subdomains are matched
+	floor := Floor{Content: "see http://www.spam.test/buy"}
+	err := CheckLinkRules(&floor)
+	var e *utils.Error
+	assert.ErrorAs(t, err, &e)
+	assert.EqualValues(t, utils.ErrCodeLinkBlocked, e.Code)
+
+	floor = Floor{Content: "see https://shady.test/a and https://docs.trusted.test/b"}
+	assert.Nil(t, CheckLinkRules(&floor))
+	assert.EqualValues(t, LinkFoldReason, floor.Fold)
+	assert.EqualValues(t, "see https://treehole.test/api/links/redirect?url=https%3A%2F%2Fshady.test%2Fa and https://docs.trusted.test/b", floor.Content)
+	// rewritten links are kept
+	content := floor.Content
+	assert.Nil(t, CheckLinkRules(&floor))
+	assert.EqualValues(t, content, floor.Content)
+
+	testCommon(t, "get", "/api/links/redirect?url="+url.QueryEscape("https://docs.trusted.test/b"), 302)
+	testCommon(t, "get", "/api/links/redirect?url="+url.QueryEscape("https://spam.test/"), 403)
+	testCommon(t, "get", "/api/links/redirect?url="+url.QueryEscape("javascript://alert"), 400)
+	warning := testAPI(t, "get", "/api/links/redirect?url="+url.QueryEscape("https://other.test/"), 200)
+	assert.EqualValues(t, "other.test", warning["host"])
+	testCommon(t, "get", "/api/links/redirect?confirm=true&url="+url.QueryEscape("https://other.test/"), 302)
+
+	testCommon(t, "delete", "/api/link_rules/"+strconv.Itoa(int(blocked["id"].(float64))), 204)
+	floor = Floor{Content: "see http://www.spam.test/buy"}
+	assert.Nil(t, CheckLinkRules(&floor))
+}
+
+func TestSystemFloor(t *testing.T) {
+	hole := Hole{DivisionID: 1, UserID: 1}
+	DB.Create(&hole)
+	userFloor := Floor{HoleID: hole.ID, UserID: 1, Content: "TestSystemFloor"}
+	DB.Create(&userFloor)
+	systemFloor, err := CreateSystemFloor(DB, &hole, "TestSystemFloor system")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, systemFloor.Ranking)
+	assert.Equal(t, 1, hole.Reply)
+
+	var floor Floor
+	testAPIModel(t, "get", "/api/floors/"+strconv.Itoa(userFloor.ID), 200, &floor)
+	assert.Equal(t, FloorTypeUser, floor.Type)
+	assert.True(t, floor.Numbered)
+	floor = Floor{}
+	testAPIModel(t, "get", "/api/floors/"+strconv.Itoa(systemFloor.ID), 200, &floor)
+	assert.Equal(t, FloorTypeSystem, floor.Type)
+	assert.False(t, floor.Numbered)
+
+	// machine floors are excluded from likes
+	resp := testAPI(t, "post", "/api/floors/"+strconv.Itoa(systemFloor.ID)+"/like/1", 400)
+	assert.EqualValues(t, utils.ErrCodeFloorNotLikeable, resp["code"])
+	testAPIModel(t, "post", "/api/floors/"+strconv.Itoa(userFloor.ID)+"/like/1", 200, &floor)
+	assert.Equal(t, 1, floor.Like)
+}
+
+func TestListHotFloors(t *testing.T) {
+	hole := Hole{DivisionID: 7}
+	DB.Create(&hole)
+	for i, like := range []int{3, 8, 5, 20, 5, 30} {
+		DB.Create(&Floor{HoleID: hole.ID, Content: "TestListHotFloors", Ranking: i, Like: like, Deleted: like == 30})
+	}
+
+	var floors Floors
+	testAPIModel(t, "get", "/api/holes/"+strconv.Itoa(hole.ID)+"/floors?order=like&size=3", 200, &floors)
+	assert.Equal(t, 3, len(floors))
+	assert.Equal(t, []int{20, 8, 5}, []int{floors[0].Like, floors[1].Like, floors[2].Like})
+	assert.Equal(t, 2, floors[2].Ranking)
+
+	testAPIModel(t, "get", "/api/holes/"+strconv.Itoa(hole.ID)+"/floors?order=like", 200, &floors)
+	assert.Equal(t, 4, len(floors))
+}
+
+func TestListFloorsByPoster(t *testing.T) {
+	hole := Hole{DivisionID: 7, UserID: 601}
+	DB.Create(&hole)
+	DB.Create(&AnonynameMapping{HoleID: hole.ID, UserID: 601, Anonyname: "Alice"})
+	DB.Create(&AnonynameMapping{HoleID: hole.ID, UserID: 602, Anonyname: "Bob"})
+	for i, userID := range []int{601, 602, 601, 602, 602} {
+		DB.Create(&Floor{HoleID: hole.ID, UserID: userID, Content: "TestListFloorsByPoster", Ranking: i})
+	}
+	path := "/api/holes/" + strconv.Itoa(hole.ID) + "/floors"
+
+	var floors Floors
+	testAPIModel(t, "get", path+"?poster=Bob", 200, &floors)
+	assert.Equal(t, 3, len(floors))
+	testAPIModel(t, "get", path+"?poster=Bob&order=desc&size=2", 200, &floors)
+	assert.Equal(t, []int{4, 3}, []int{floors[0].Ranking, floors[1].Ranking})
+	testAPIModel(t, "get", path+"?poster="+url.QueryEscape(PosterHoleOwner)+"&order=asc", 200, &floors)
+	assert.Equal(t, []int{0, 2}, []int{floors[0].Ranking, floors[1].Ranking})
+	testAPIModel(t, "get", path+"?poster=Carol", 200, &floors)
+	assert.Equal(t, 0, len(floors))
+}
+
+func TestSavedSearches(t *testing.T) {
+	var user User
+	DB.FirstOrCreate(&user, User{ID: 1})
+	data := testAPI(t, "post", "/api/user/saved_searches", 201, Map{"search": "TestSavedSearches"})
+	assert.Equal(t, "daily", data["frequency"])
+	id := int(data["id"].(float64))
+	path := "/api/user/saved_searches/" + strconv.Itoa(id)
+	testAPI(t, "post", "/api/user/saved_searches", 400, Map{"search": "TestSavedSearches", "frequency": "monthly"})
+	data = testAPI(t, "put", path, 200, Map{"frequency": "hourly"})
+	assert.Equal(t, "hourly", data["frequency"])
+	savedSearches := testAPIArray(t, "get", "/api/user/saved_searches", 200)
+	assert.Contains(t, savedSearches, data)
+
+	hole := Hole{DivisionID: 1, UserID: 5}
+	DB.Create(&hole)
+	other := Floor{HoleID: hole.ID, UserID: 5, Content: "TestSavedSearches by others"}
+	DB.Create(&other)
+	DB.Create(&Floor{HoleID: hole.ID, UserID: 1, Content: "TestSavedSearches by myself", Ranking: 1})
+
+	countAlerts := func() int64 {
+		var count int64
+		DB.Model(&Message{}).Where("type = ?", MessageTypeSavedSearch).Count(&count)
+		return count
+	}
+	before := countAlerts()
+	// not due in an hour
+	assert.Nil(t, FlushSavedSearches(time.Now()))
+	assert.EqualValues(t, before, countAlerts())
+
+	assert.Nil(t, FlushSavedSearches(time.Now().Add(2*time.Hour)))
+	assert.EqualValues(t, before+1, countAlerts())
+	var message Message
+	DB.Where("type = ?", MessageTypeSavedSearch).Order("id DESC").Take(&message)
+	assert.Equal(t, []any{float64(other.ID)}, message.Data.(map[string]any)["floor_ids"])
+
+	// floors notified are not new any more
+	assert.Nil(t, FlushSavedSearches(time.Now().Add(4*time.Hour)))
+	assert.EqualValues(t, before+1, countAlerts())
+
+	testAPI(t, "delete", path, 204)
+	testAPI(t, "delete", path, 404)
+}
+
+func TestFloorContentWarning(t *testing.T) {
+	hole := Hole{DivisionID: 1, UserID: 1}
+	DB.Create(&hole)
+
+	floor := Floor{HoleID: hole.ID, UserID: 1, Content: "TestFloorContentWarning", ContentWarning: "恐怖"}
+	DB.Create(&floor)
+	route := "/api/floors/" + strconv.Itoa(floor.ID)
+	testAPIModel(t, "get", route, 200, &floor)
+	assert.Equal(t, "恐怖", floor.ContentWarning)
+	assert.True(t, floor.Collapsed)
+	assert.Empty(t, floor.Fold)
+
+	testAPIModel(t, "put", route, 200, &floor, Map{"spoiler": true, "content_warning": ""})
+	assert.True(t, floor.Spoiler)
+	assert.Empty(t, floor.ContentWarning)
+	assert.True(t, floor.Collapsed)
+	testAPIModel(t, "put", route, 200, &floor, Map{"spoiler": false})
+	assert.False(t, floor.Collapsed)
+	assert.Equal(t, 2, floor.Version)
+}
+
+func TestFloorEditLimits(t *testing.T) {
+	division := Division{EditWindow: 10, MaxEdits: 2}
+	floor := Floor{Modified: 1}
+	floor.CreatedAt = time.Now().Add(-5 * time.Minute)
+	assert.Nil(t, division.CheckFloorEdit(&floor, time.Now()))
+
+	err := division.CheckFloorEdit(&floor, time.Now().Add(10*time.Minute))
+	assert.Equal(t, utils.ErrCodeEditWindowExpired, err.(*utils.Error).Code)
+
+	floor.Modified = 2
+	err = division.CheckFloorEdit(&floor, time.Now())
+	assert.Equal(t, utils.ErrCodeEditLimitExceeded, err.(*utils.Error).Code)
+
+	// unlimited
+	assert.Nil(t, (&Division{}).CheckFloorEdit(&floor, time.Now().Add(time.Hour)))
+}
+
+func TestRetention(t *testing.T) {
+	Config.DeletedFloorRetentionDays = 30
+	defer func() { Config.DeletedFloorRetentionDays = 0 }()
+	longAgo := time.Now().AddDate(-2, 0, 0)
+
+	hole := Hole{DivisionID: 1, UserID: 4670, Floors: Floors{
+		{Content: "deleted", UserID: 4670, Ranking: 0},
+		{Content: "appealed", UserID: 4670, Ranking: 1},
+		{Content: "kept", UserID: 4670, Ranking: 2},
+	}}
+	DB.Create(&hole)
+	deleted, appealed, kept := hole.Floors[0], hole.Floors[1], hole.Floors[2]
+	for _, floor := range []*Floor{deleted, appealed} {
+		assert.Nil(t, floor.Backup(DB, 4670, "delete"))
+		DB.Model(floor).UpdateColumns(map[string]any{"deleted": true, "updated_at": longAgo})
+	}
+	DB.Create(&Appeal{UserID: 4670, FloorID: appealed.ID, Reason: "appeal", Status: AppealStatusPending})
+	assert.Nil(t, kept.Backup(DB, 4670, "modify"))
+	DB.Model(&FloorHistory{}).Where("floor_id = ?", kept.ID).UpdateColumn("created_at", longAgo)
+
+	message := Message{Title: "retention", Type: MessageTypeMail, Recipients: []int{4670}}
+	DB.Create(&message)
+	DB.Create(&MessageUser{MessageID: message.ID, UserID: 4670})
+	DB.Model(&message).UpdateColumn("created_at", longAgo)
+
+	data := testAPI(t, "post", "/api/retention/_run", 200, Map{"dry_run": true})
+	counts := data["counts"].(Map)
+	assert.EqualValues(t, 1, counts[RetentionDeletedFloors])
+	assert.GreaterOrEqual(t, counts[RetentionMessages], float64(1))
+	// dry run changes nothing
+	var n int64
+	DB.Model(&FloorHistory{}).Where("floor_id = ?", deleted.ID).Count(&n)
+	assert.EqualValues(t, 1, n)
+
+	data = testAPI(t, "post", "/api/retention/_run", 200, Map{})
+	counts = data["counts"].(Map)
+	assert.EqualValues(t, 1, counts[RetentionDeletedFloors])
+	DB.Model(&FloorHistory{}).Where("floor_id = ?", deleted.ID).Count(&n)
+	assert.EqualValues(t, 0, n)
+	DB.Model(&FloorHistory{}).Where("floor_id = ?", appealed.ID).Count(&n)
+	assert.EqualValues(t, 1, n)
+	DB.Model(&Message{}).Where("id = ?", message.ID).Count(&n)
+	assert.EqualValues(t, 0, n)
+	DB.Model(&MessageUser{}).Where("message_id = ?", message.ID).Count(&n)
+	assert.EqualValues(t, 0, n)
+
+	// compressed histories are restored on reads
+	var history FloorHistory
+	DB.Where("floor_id = ?", kept.ID).Take(&history)
+	assert.NotEmpty(t, history.CompressedContent)
+	assert.Equal(t, "kept", history.Content)
+	var raw string
+	DB.Model(&FloorHistory{}).Where("id = ?", history.ID).Pluck("content", &raw)
+	assert.Empty(t, raw)
+}
+
+func TestFloorRoutes(t *testing.T) {
+	hole := newTestHole(t, nil)
+	floor := newTestFloor(t, hole)
+	route := "/api/floors/" + strconv.Itoa(floor.ID)
+
+	runAPITests(t, []apiTestCase{
+		{name: "get", method: "get", route: route, statusCode: 200, check: func(t *testing.T, body []byte) {
+			got := decodeBody[Floor](t, body)
+			assert.Equal(t, floor.Content, got.Content)
+			assert.Equal(t, 1, got.Ranking)
+		}},
+		{name: "get missing", method: "get", route: "/api/floors/" + strconv.Itoa(largeInt), statusCode: 404},
+		{name: "create", method: "post", route: "/api/holes/" + strconv.Itoa(hole.ID) + "/floors", body: Map{"content": "routes"}, statusCode: 201},
+		{name: "create without content", method: "post", route: "/api/holes/" + strconv.Itoa(hole.ID) + "/floors", body: Map{}, statusCode: 400},
+		{name: "like", method: "post", route: route + "/like/1", statusCode: 200, check: func(t *testing.T, body []byte) {
+			assert.Equal(t, 1, decodeBody[Floor](t, body).Like)
+		}},
+		{name: "unlike", method: "post", route: route + "/like/0", statusCode: 200, check: func(t *testing.T, body []byte) {
+			assert.Equal(t, 0, decodeBody[Floor](t, body).Like)
+		}},
+		{name: "delete", method: "delete", route: route, body: Map{"delete_reason": "routes"}, statusCode: 200, check: func(t *testing.T, body []byte) {
+			assert.True(t, decodeBody[Floor](t, body).Deleted)
+		}},
+	})
 }
@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/goccy/go-json"
+
+	"treehole_next/config"
+	. "treehole_next/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphQLHoleWithFloors(t *testing.T) {
+	var hole Hole
+	DB.Where("division_id = ?", 7).Order("id").First(&hole)
+
+	query := `query GetHole($id: Int!) {
+		hole(id: $id) {
+			id
+			division { id name }
+			tags { name }
+			first: floors(size: 3) { ranking content }
+			rest: floors(offset: 3, size: 2) { ranking }
+		}
+	}`
+	resp := testAPI(t, "post", "/api/graphql", 200, Map{"query": query, "variables": Map{"id": hole.ID}})
+	assert.Nil(t, resp["errors"])
+
+	data := resp["data"].(Map)["hole"].(Map)
+	assert.EqualValues(t, hole.ID, data["id"])
+	assert.EqualValues(t, 7, data["division"].(Map)["id"])
+	assert.Len(t, data["first"], 3)
+	assert.EqualValues(t, "1", data["first"].([]any)[0].(Map)["content"])
+	assert.Len(t, data["rest"], 2)
+	assert.EqualValues(t, 3, data["rest"].([]any)[0].(Map)["ranking"])
+	assert.NotContains(t, data, "time_created")
+}
+
+func TestGraphQLHolesInDivision(t *testing.T) {
+	query := `{ holes(division_id: 6, size: 5) { id __typename floors(size: 1) { hole { id } } } }`
+	resp := testAPI(t, "post", "/api/graphql", 200, Map{"query": query})
+	assert.Nil(t, resp["errors"])
+	holes := resp["data"].(Map)["holes"].([]any)
+	assert.Len(t, holes, 5)
+	assert.Equal(t, "Hole", holes[0].(Map)["__typename"])
+}
+
+func TestGraphQLErrors(t *testing.T) {
+	resp := testAPI(t, "post", "/api/graphql", 200, Map{"query": `{ hole(id: 1) { unknown } }`})
+	assert.NotEmpty(t, resp["errors"])
+
+	resp = testAPI(t, "post", "/api/graphql", 200, Map{"query": `mutation { hole }`})
+	assert.NotEmpty(t, resp["errors"])
+
+	testAPI(t, "post", "/api/graphql", 400, Map{})
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	resp := testAPI(t, "post", "/api/graphql", 200, Map{"query": `{ tags(first: 2) { name } }`})
+	assert.Nil(t, resp["errors"])
+	assert.Len(t, resp["data"].(Map)["tags"], 2)
+
+	resp = testAPI(t, "post", "/api/graphql", 200, Map{"query": `{ tags(first: 100000) { name } }`})
+	assert.NotEmpty(t, resp["errors"])
+
+	query := `{ holes(size: 1) { floors(size: 1) { hole { floors(size: 1) { hole { id } } } } } }`
+	resp = testAPI(t, "post", "/api/graphql", 200, Map{"query": query})
+	assert.NotEmpty(t, resp["errors"])
+}
+
+// testGraphQLActAs queries as a user other than the admin of test mode, see MiddlewareActAs
+func testGraphQLActAs(t *testing.T, userID int, query string) Map {
+	req, err := http.NewRequest("GET", "/api/graphql?query="+url.QueryEscape(query), nil)
+	assert.Nil(t, err)
+	req.Header.Add("X-Consumer-Username", "1")
+	req.Header.Add("X-Act-As", strconv.Itoa(userID))
+	res, err := App.Test(req, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	var data Map
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(&data))
+	return data
+}
+
+func TestGraphQLVisibility(t *testing.T) {
+	config.Config.ActAsEnabled = true
+	defer func() { config.Config.ActAsEnabled = false }()
+	user := newTestUser(t)
+
+	division := newTestDivision(t)
+	visible := newTestHole(t, division)
+	hidden := newTestHole(t, division, func(hole *Hole) { hole.Hidden = true })
+	secret := newTestDivision(t, func(division *Division) {
+		division.Visibility = DivisionVisibilityRestricted
+		division.Group = "secret"
+	})
+	restricted := newTestHole(t, secret)
+	assert.Nil(t, DeleteDivisionAccessCache())
+	division.Pinned = []int{hidden.ID, visible.ID}
+	assert.Nil(t, DB.Model(division).Select("Pinned").Updates(division).Error)
+	for _, hole := range []*Hole{visible, hidden, restricted} {
+		newTestFavorite(t, user.ID, hole)
+	}
+
+	// favorites and pinned holes are only those visible
+	query := `{ favorites { id division { id } } division(id: ` + strconv.Itoa(division.ID) + `) { pinned { id } } }`
+	resp := testGraphQLActAs(t, user.ID, query)
+	assert.Nil(t, resp["errors"])
+	data := resp["data"].(Map)
+	favorites := data["favorites"].([]any)
+	assert.Len(t, favorites, 1)
+	assert.EqualValues(t, visible.ID, favorites[0].(Map)["id"])
+	assert.EqualValues(t, division.ID, favorites[0].(Map)["division"].(Map)["id"])
+	pinned := data["division"].(Map)["pinned"].([]any)
+	assert.Len(t, pinned, 1)
+	assert.EqualValues(t, visible.ID, pinned[0].(Map)["id"])
+
+	// floors are visible with their hole
+	for _, hole := range []*Hole{hidden, restricted} {
+		resp = testGraphQLActAs(t, user.ID, `{ floor(id: `+strconv.Itoa(hole.Floors[0].ID)+`) { id } }`)
+		assert.NotEmpty(t, resp["errors"])
+	}
+	resp = testGraphQLActAs(t, user.ID, `{ floor(id: `+strconv.Itoa(visible.Floors[0].ID)+`) { id } }`)
+	assert.Nil(t, resp["errors"])
+}
@@ -1,15 +1,24 @@
 package tests
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	. "treehole_next/config"
 	. "treehole_next/models"
 	"treehole_next/utils"
 
+	"github.com/goccy/go-json"
 	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	"gorm.io/gorm"
 )
 
 func TestListHoleInADivision(t *testing.T) {
@@ -129,3 +138,630 @@ func TestDeleteHole(t *testing.T) {
 	DB.Where("id = ?", 10).Find(&hole)
 	assert.Equal(t, true, hole.Hidden)
 }
+
+func TestGetHoleETag(t *testing.T) {
+	route := "/api/holes/3"
+	get := func(etag string) *http.Response {
+		req, err := http.NewRequest("GET", route, nil)
+		assert.Nil(t, err)
+		req.Header.Add("X-Consumer-Username", "1")
+		if etag != "" {
+			req.Header.Add("If-None-Match", etag)
+		}
+		res, err := App.Test(req, -1)
+		assert.Nil(t, err)
+		return res
+	}
+
+	res := get("")
+	assert.Equal(t, 200, res.StatusCode)
+	etag := res.Header.Get("ETag")
+	assert.True(t, strings.HasPrefix(etag, `W/"`))
+	assert.NotEmpty(t, res.Header.Get("Last-Modified"))
+
+	assert.Equal(t, 304, get(etag).StatusCode)
+
+	// contents changed without updated_at changed
+	DB.Model(&Hole{}).Where("id = ?", 3).UpdateColumn("locked", true)
+	assert.Equal(t, 200, get(etag).StatusCode)
+	DB.Model(&Hole{}).Where("id = ?", 3).UpdateColumn("locked", false)
+
+	// views and divisions are not shown
+	etag = get("").Header.Get("ETag")
+	DB.Model(&Hole{}).Where("id = ?", 3).UpdateColumn("view", gorm.Expr("view + 1"))
+	DB.Model(newTestDivision(t)).UpdateColumn("description", "TestGetHoleETag")
+	assert.Equal(t, 304, get(etag).StatusCode)
+}
+
+func TestListHolesFields(t *testing.T) {
+	data := testAPIArray(t, "get", "/api/divisions/1/holes?fields=id,tags,floors.first_floor.content", 200)
+	assert.NotEmpty(t, data)
+	for _, hole := range data {
+		assert.Len(t, hole, 3)
+		assert.Contains(t, hole, "id")
+		assert.Contains(t, hole, "tags")
+		floors, ok := hole["floors"].(map[string]any)
+		assert.True(t, ok)
+		assert.Len(t, floors, 1)
+		assert.Contains(t, floors, "first_floor")
+		if firstFloor, ok := floors["first_floor"].(map[string]any); ok {
+			assert.Len(t, firstFloor, 1)
+			assert.Contains(t, firstFloor, "content")
+		}
+	}
+}
+
+func TestListHolesByMe(t *testing.T) {
+	hole := Hole{DivisionID: 1, UserID: 1, Hidden: true}
+	DB.Create(&hole)
+	defer DB.Unscoped().Delete(&hole)
+
+	contains := func(holes []Map) bool {
+		for _, h := range holes {
+			if int(h["id"].(float64)) == hole.ID {
+				return true
+			}
+		}
+		return false
+	}
+
+	holes := testAPIArray(t, "get", "/api/users/me/holes", 200)
+	assert.False(t, contains(holes))
+
+	holes = testAPIArray(t, "get", "/api/users/me/holes?include_hidden=true", 200)
+	assert.True(t, contains(holes))
+	for _, h := range holes {
+		if int(h["id"].(float64)) == hole.ID {
+			assert.Equal(t, true, h["hidden"])
+		}
+	}
+}
+
+func TestHoleHiddenState(t *testing.T) {
+	hole := Hole{DivisionID: 1, UserID: 1}
+	DB.Create(&hole)
+	defer DB.Unscoped().Delete(&hole)
+	route := "/api/holes/" + strconv.Itoa(hole.ID)
+
+	contains := func(holes []Map) bool {
+		for _, h := range holes {
+			if int(h["id"].(float64)) == hole.ID {
+				return true
+			}
+		}
+		return false
+	}
+
+	testAPIModel(t, "put", route, 200, &hole, Map{"hidden_state": HoleHiddenByAuthor})
+	assert.True(t, hole.Hidden)
+	assert.Equal(t, HoleHiddenByAuthor, hole.HiddenState)
+	assert.False(t, contains(testAPIArray(t, "get", "/api/users/me/holes", 200)))
+
+	// holes pending review are listed to the author
+	testAPIModel(t, "put", route, 200, &hole, Map{"hidden_state": HolePendingReview})
+	assert.True(t, contains(testAPIArray(t, "get", "/api/users/me/holes", 200)))
+
+	testAPIModel(t, "put", route, 200, &hole, Map{"unhidden": true})
+	assert.False(t, hole.Hidden)
+	assert.Equal(t, HoleVisible, hole.HiddenState)
+	testAPIModel(t, "put", route, 200, &hole, Map{"hidden": true})
+	assert.Equal(t, HoleHiddenByModerator, hole.HiddenState)
+	testAPI(t, "put", route, 400, Map{"hidden_state": "deleted"})
+
+	// transitions of authors and other users
+	author := &User{ID: 1}
+	assert.NotNil(t, hole.CheckHiddenState(author, HoleVisible))
+	hole.SetHiddenState(HoleVisible)
+	assert.Nil(t, hole.CheckHiddenState(author, HoleHiddenByAuthor))
+	assert.NotNil(t, hole.CheckHiddenState(author, HolePendingReview))
+	assert.NotNil(t, hole.CheckHiddenState(&User{ID: 2}, HoleHiddenByAuthor))
+}
+
+func TestHolePendingReview(t *testing.T) {
+	saved := Spam
+	defer func() { Spam = saved }()
+	defer func(threshold float64) { Config.SpamReportThreshold = threshold }(Config.SpamReportThreshold)
+	Config.SpamReportThreshold = 0.7
+
+	c := App.AcquireCtx(&fasthttp.RequestCtx{})
+	defer App.ReleaseCtx(c)
+	user := &User{ID: 960}
+	create := func() *Hole {
+		hole := Hole{DivisionID: 1, UserID: user.ID, Floors: Floors{{UserID: user.ID, Content: "TestHolePendingReview"}}}
+		err := hole.Create(DB, user, []string{"HoleReview"}, c)
+		assert.Nil(t, err)
+		return &hole
+	}
+
+	// reported by the spam check
+	Spam = stubSpamChecker(0.8)
+	hole := create()
+	assert.True(t, hole.Hidden)
+	assert.Equal(t, HolePendingReview, hole.HiddenState)
+	var report Report
+	assert.Nil(t, DB.Where("floor_id = ? AND user_id = 0", hole.Floors[0].ID).Take(&report).Error)
+
+	// moderators make it visible
+	route := "/api/holes/" + strconv.Itoa(hole.ID)
+	testAPIModel(t, "put", route, 200, hole, Map{"hidden_state": HoleVisible})
+	assert.False(t, hole.Hidden)
+	assert.Equal(t, HoleVisible, hole.HiddenState)
+
+	Spam = stubSpamChecker(0.3)
+	hole = create()
+	assert.False(t, hole.Hidden)
+	assert.Equal(t, HoleVisible, hole.HiddenState)
+}
+
+func TestGetHoleConcurrently(t *testing.T) {
+	var hole Hole
+	DB.Where("division_id = ?", 7).First(&hole)
+	route := "/api/holes/" + strconv.Itoa(hole.ID)
+	_ = utils.DeleteCache(hole.CacheName())
+
+	var wg sync.WaitGroup
+	results := make([]Hole, 20)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			testAPIModel(t, "get", route, 200, &results[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		assert.Equal(t, hole.ID, result.ID)
+		assert.NotNil(t, result.HoleFloor.FirstFloor)
+	}
+
+	var cached struct {
+		Hole      Map       `json:"hole"`
+		RefreshAt time.Time `json:"refresh_at"`
+	}
+	assert.True(t, utils.GetCache(hole.CacheName(), &cached))
+	assert.EqualValues(t, hole.ID, cached.Hole["id"])
+	assert.True(t, cached.RefreshAt.After(time.Now()))
+}
+
+func TestHoleCacheKeyedByUpdateTime(t *testing.T) {
+	hole := Hole{DivisionID: 7, Floors: Floors{{Content: "cached", Anonyname: "a", UserID: 1}}}
+	assert.Nil(t, DB.Create(&hole).Error)
+	route := "/api/holes/" + strconv.Itoa(hole.ID)
+	var got Hole
+	testAPIModel(t, "get", route, 200, &got)
+	assert.Equal(t, "cached", got.HoleFloor.FirstFloor.Content)
+
+	// changes with updated_at miss the cache of the former version
+	assert.Nil(t, DB.Model(&Floor{}).Where("hole_id = ?", hole.ID).Update("content", "new reply").Error)
+	assert.Nil(t, DB.Model(&hole).Update("updated_at", time.Now().Add(time.Second)).Error)
+	testAPIModel(t, "get", route, 200, &got)
+	assert.Equal(t, "new reply", got.HoleFloor.FirstFloor.Content)
+
+	// other changes delete the cache explicitly
+	assert.Nil(t, DB.Model(&Floor{}).Where("hole_id = ?", hole.ID).UpdateColumn("content", "folded").Error)
+	testAPIModel(t, "get", route, 200, &got)
+	assert.Equal(t, "new reply", got.HoleFloor.FirstFloor.Content)
+	assert.Nil(t, DeleteHoleCache(DB, hole.ID))
+	testAPIModel(t, "get", route, 200, &got)
+	assert.Equal(t, "folded", got.HoleFloor.FirstFloor.Content)
+}
+
+func TestListHotHoles(t *testing.T) {
+	division := Division{Name: "hot", Description: "hot"}
+	assert.Nil(t, DB.Create(&division).Error)
+	holes := Holes{
+		{DivisionID: division.ID, Floors: Floors{
+			{Content: "1", Anonyname: "a", UserID: 1, Like: 3},
+			{Content: "2", Anonyname: "b", UserID: 2, Ranking: 1},
+			{Content: "3", Anonyname: "c", UserID: 3, Ranking: 2},
+		}},
+		{DivisionID: division.ID, Floors: Floors{{Content: "1", Anonyname: "a", UserID: 1}}},
+		{DivisionID: division.ID, Hidden: true, Floors: Floors{
+			{Content: "1", Anonyname: "a", UserID: 1, Like: 10},
+			{Content: "2", Anonyname: "b", UserID: 2, Ranking: 1},
+		}},
+	}
+	assert.Nil(t, DB.Create(&holes).Error)
+	assert.Nil(t, RankHotHoles())
+
+	var hotHoles Holes
+	testAPIModel(t, "get", "/api/holes/hot?division_id="+strconv.Itoa(division.ID), 200, &hotHoles)
+	assert.Len(t, hotHoles, 2)
+	assert.Equal(t, holes[0].ID, hotHoles[0].ID)
+	assert.Equal(t, holes[1].ID, hotHoles[1].ID)
+
+	testAPIModel(t, "get", "/api/holes/hot?division_id="+strconv.Itoa(division.ID)+"&offset=1&size=1", 200, &hotHoles)
+	assert.Len(t, hotHoles, 1)
+	assert.Equal(t, holes[1].ID, hotHoles[0].ID)
+}
+
+func TestListRecommendations(t *testing.T) {
+	division := Division{Name: "recommend", Description: "recommend"}
+	assert.Nil(t, DB.Create(&division).Error)
+	tag := Tag{Name: "recommend"}
+	holes := Holes{
+		{DivisionID: division.ID, UserID: 901, Tags: Tags{&tag}},
+		{DivisionID: division.ID, UserID: 902, Tags: Tags{&tag}},
+		{DivisionID: division.ID, UserID: 902},
+		{DivisionID: division.ID, UserID: 902, Tags: Tags{&tag}, Hidden: true},
+	}
+	assert.Nil(t, DB.Create(&holes).Error)
+	assert.Nil(t, AddUserSubscription(DB, 900, holes[0].ID))
+
+	// hot holes of other tests are ignored
+	saved := Recommender
+	defer func() { Recommender = saved }()
+	Recommender = WeightedScorer{Weights: map[string]float64{
+		RecommendationSourceTag:      3,
+		RecommendationSourceDivision: 1,
+	}}
+
+	holeIDs, err := RecommendHoles(context.Background(), DB, &User{ID: 900}, 10)
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, len(holeIDs), 2)
+	assert.Equal(t, []int{holes[1].ID, holes[2].ID}, holeIDs[:2])
+	assert.NotContains(t, holeIDs, holes[0].ID)
+	assert.NotContains(t, holeIDs, holes[3].ID)
+
+	testAPIArray(t, "get", "/api/users/me/recommendations", 200)
+}
+
+func TestFindDuplicateHoles(t *testing.T) {
+	division := Division{Name: "duplicate", Description: "duplicate"}
+	assert.Nil(t, DB.Create(&division).Error)
+	contents := []string{
+		"请问本部食堂今天几点关门？有人知道吗",
+		"求推荐计算机系的选修课，最好给分好一点的",
+		"请问本部食堂今天几点关门？有人知道吗",
+		"请问本部食堂今天几点关门啊，有人知道吗",
+	}
+	holes := make(Holes, len(contents))
+	for i, content := range contents {
+		holes[i] = &Hole{
+			DivisionID: division.ID,
+			SimHash:    int64(utils.SimHash(content)),
+			Floors:     Floors{{Content: content, Anonyname: "a", UserID: 1}},
+		}
+	}
+	holes[2].Hidden = true
+	assert.Nil(t, DB.Create(&holes).Error)
+
+	duplicates, err := FindDuplicateHoles(DB, holes[3])
+	assert.Nil(t, err)
+	assert.Len(t, duplicates, 1)
+	assert.Equal(t, holes[0].ID, duplicates[0].HoleID)
+	assert.Equal(t, contents[0], duplicates[0].Preview)
+	assert.Greater(t, duplicates[0].Similarity, 0.8)
+
+	duplicates, err = FindDuplicateHoles(DB, holes[1])
+	assert.Nil(t, err)
+	assert.Empty(t, duplicates)
+}
+
+func TestListSimilarHoles(t *testing.T) {
+	tags := Tags{{Name: "similar1"}, {Name: "similar2"}, {Name: "similar3"}}
+	holes := Holes{
+		{DivisionID: 1, Tags: tags},
+		{DivisionID: 1, Tags: tags[:1]},
+		{DivisionID: 1, Tags: tags[:2]},
+		{DivisionID: 1},
+	}
+	assert.Nil(t, DB.Create(&holes).Error)
+
+	var similarHoles Holes
+	testAPIModel(t, "get", "/api/holes/"+strconv.Itoa(holes[0].ID)+"/similar", 200, &similarHoles)
+	assert.Len(t, similarHoles, 2)
+	assert.Equal(t, holes[2].ID, similarHoles[0].ID)
+	assert.Equal(t, holes[1].ID, similarHoles[1].ID)
+
+	testAPIModel(t, "get", "/api/holes/"+strconv.Itoa(holes[0].ID)+"/similar?size=1", 200, &similarHoles)
+	assert.Len(t, similarHoles, 1)
+
+	testAPIModel(t, "get", "/api/holes/"+strconv.Itoa(holes[3].ID)+"/similar", 200, &similarHoles)
+	assert.Empty(t, similarHoles)
+}
+
+func TestMoveHole(t *testing.T) {
+	var from, to Division
+	testAPIModel(t, "post", "/api/divisions", 201, &from, Map{"name": "TestMoveHoleFrom"})
+	testAPIModel(t, "post", "/api/divisions", 201, &to, Map{"name": "TestMoveHoleTo", "required_tags": []string{"课程"}})
+	tag := Tag{Name: "TestMoveHole"}
+	DB.Create(&tag)
+	hole := Hole{DivisionID: from.ID, UserID: 1, Tags: Tags{&tag}}
+	DB.Create(&hole)
+	DB.Create(&Floor{HoleID: hole.ID, UserID: 1, Content: "TestMoveHole"})
+	DB.Model(&from).Update("pinned", "["+strconv.Itoa(hole.ID)+"]")
+	id := strconv.Itoa(hole.ID)
+
+	// tags are checked against the destination
+	resp := testAPI(t, "patch", "/api/holes/"+id+"/division", 400, Map{"division_id": to.ID})
+	assert.EqualValues(t, utils.ErrCodeRequiredTagsMissing, resp["code"])
+	testAPI(t, "patch", "/api/holes/"+id+"/division", 400, Map{"division_id": from.ID})
+	testAPI(t, "patch", "/api/holes/"+id+"/division", 404, Map{"division_id": largeInt})
+
+	DB.Model(&to).Update("required_tags", "[]")
+	testAPIModel(t, "patch", "/api/holes/"+id+"/division", 200, &hole, Map{"division_id": to.ID})
+	assert.Equal(t, to.ID, hole.DivisionID)
+
+	var floor Floor
+	DB.Where("hole_id = ?", hole.ID).Order("ranking DESC").Take(&floor)
+	assert.Equal(t, 1, floor.Ranking)
+	assert.Equal(t, SystemFloorAnonyname, floor.Anonyname)
+	assert.Contains(t, floor.Content, "TestMoveHoleTo")
+
+	from = Division{}
+	DB.First(&from, "name = ?", "TestMoveHoleFrom")
+	assert.Empty(t, from.Pinned)
+}
+
+func TestMergeHole(t *testing.T) {
+	into := Hole{DivisionID: 1, UserID: 1, Reply: 1}
+	from := Hole{DivisionID: 1, UserID: 2, Reply: 1}
+	DB.Create(&into)
+	DB.Create(&from)
+	DB.Create(&Floor{HoleID: into.ID, UserID: 1, Anonyname: "Alice", Content: "TestMergeHole into 0"})
+	DB.Create(&Floor{HoleID: into.ID, UserID: 3, Anonyname: "Bob", Content: "TestMergeHole into 1", Ranking: 1})
+	DB.Create(&Floor{HoleID: from.ID, UserID: 2, Anonyname: "Bob", Content: "TestMergeHole from 0"})
+	DB.Create(&Floor{HoleID: from.ID, UserID: 1, Anonyname: "Carol", Content: "TestMergeHole from 1", Ranking: 1})
+	DB.Create(&[]AnonynameMapping{
+		{HoleID: into.ID, UserID: 1, Anonyname: "Alice"}, {HoleID: into.ID, UserID: 3, Anonyname: "Bob"},
+		{HoleID: from.ID, UserID: 2, Anonyname: "Bob"}, {HoleID: from.ID, UserID: 1, Anonyname: "Carol"},
+	})
+	DB.Create(&UserSubscription{UserID: 2, HoleID: from.ID})
+	DB.Create(&UserFavorite{UserID: 1, FavoriteGroupID: 0, HoleID: from.ID})
+	id := strconv.Itoa(into.ID)
+
+	testAPI(t, "post", "/api/holes/"+id+"/merge", 400, Map{"from_hole_id": into.ID})
+	testAPI(t, "post", "/api/holes/"+id+"/merge", 404, Map{"from_hole_id": largeInt})
+	testAPIModel(t, "post", "/api/holes/"+id+"/merge", 200, &into, Map{"from_hole_id": from.ID})
+	assert.Equal(t, 4, into.Reply)
+
+	var floors Floors
+	DB.Where("hole_id = ?", into.ID).Order("ranking").Find(&floors)
+	assert.Len(t, floors, 5)
+	assert.Equal(t, "TestMergeHole from 0", floors[2].Content)
+	assert.Equal(t, from.ID, floors[2].MergedFrom)
+	assert.NotEqual(t, "Bob", floors[2].Anonyname) // taken by another user
+	assert.Equal(t, "Alice", floors[3].Anonyname)  // posted in both holes
+	assert.Equal(t, SystemFloorAnonyname, floors[4].Anonyname)
+
+	var count int64
+	DB.Model(&UserSubscription{}).Where("user_id = 2 AND hole_id = ?", into.ID).Count(&count)
+	assert.EqualValues(t, 1, count)
+	DB.Model(&UserFavorite{}).Where("user_id = 1 AND hole_id = ?", into.ID).Count(&count)
+	assert.EqualValues(t, 1, count)
+	DB.Model(&UserFavorite{}).Where("hole_id = ?", from.ID).Count(&count)
+	assert.EqualValues(t, 0, count)
+
+	// the merged hole is kept as a redirect stub
+	var stub Hole
+	testAPIModel(t, "get", "/api/holes/"+strconv.Itoa(from.ID), 200, &stub)
+	assert.Equal(t, into.ID, stub.MergedInto)
+	assert.True(t, stub.Hidden)
+	testAPI(t, "post", "/api/holes/"+id+"/merge", 400, Map{"from_hole_id": from.ID})
+}
+
+func TestMuteHoleNotifications(t *testing.T) {
+	hole := Hole{DivisionID: 1, UserID: 1}
+	DB.Create(&hole)
+	DB.Create(&UserSubscription{UserID: 1, HoleID: hole.ID})
+	floor := Floor{HoleID: hole.ID, UserID: 5, Content: "TestMuteHoleNotifications"}
+	DB.Create(&floor)
+	id := strconv.Itoa(hole.ID)
+
+	assert.Equal(t, []int{1}, floor.SendReply(DB).Recipients)
+	resp := testAPI(t, "post", "/api/holes/"+id+"/mute_notifications", 201)
+	assert.Equal(t, true, resp["muted"])
+	testAPI(t, "post", "/api/holes/"+id+"/mute_notifications", 201) // duplicated
+	assert.Empty(t, floor.SendReply(DB).Recipients)
+	assert.Empty(t, floor.SendSubscription(DB).Recipients)
+
+	resp = testAPI(t, "delete", "/api/holes/"+id+"/mute_notifications", 200)
+	assert.Equal(t, false, resp["muted"])
+	assert.Equal(t, []int{1}, floor.SendSubscription(DB).Recipients)
+
+	testAPI(t, "post", "/api/holes/"+strconv.Itoa(largeInt)+"/mute_notifications", 404)
+}
+
+func TestRandomHole(t *testing.T) {
+	var division Division
+	testAPIModel(t, "post", "/api/divisions", 201, &division, Map{"name": "TestRandomHole"})
+	ids := make([]int, 0, 5)
+	for i := 0; i < 5; i++ {
+		hole := Hole{DivisionID: division.ID, CreatedAt: time.Date(2020, 3, 1+i, 12, 0, 0, 0, time.Local)}
+		DB.Create(&hole)
+		ids = append(ids, hole.ID)
+	}
+	route := "/api/holes/random?division_id=" + strconv.Itoa(division.ID)
+
+	for i := 0; i < 10; i++ {
+		var hole Hole
+		testAPIModel(t, "get", route, 200, &hole)
+		assert.Contains(t, ids, hole.ID)
+	}
+
+	var hole Hole
+	testAPIModel(t, "get", route+"&start_time=2020-03-04T00:00:00%2B08:00&end_time=2020-03-05T00:00:00%2B08:00", 200, &hole)
+	assert.Equal(t, ids[3], hole.ID)
+	testAPI(t, "get", route+"&start_time=2021-01-01T00:00:00%2B08:00", 404)
+
+	// on this day
+	var holes Holes
+	testAPIModel(t, "get", "/api/holes?division_id="+strconv.Itoa(division.ID)+"&created_before=2020-03-02", 200, &holes)
+	assert.Equal(t, 2, len(holes))
+	assert.Equal(t, ids[1], holes[0].ID)
+	testAPI(t, "get", "/api/holes?created_before=20", 400)
+}
+
+func TestHoleStats(t *testing.T) {
+	hole := Hole{DivisionID: 1}
+	DB.Create(&hole)
+	day := time.Date(2023, 5, 1, 12, 0, 0, 0, time.Local)
+	for i, content := range []string{"期末考试好难", "期末考试 GPA", "gpa 4.0", "deleted"} {
+		DB.Create(&Floor{
+			HoleID:    hole.ID,
+			UserID:    i % 2,
+			Content:   content,
+			Ranking:   i,
+			Like:      i * 5,
+			Deleted:   content == "deleted",
+			CreatedAt: day.AddDate(0, 0, i/2),
+		})
+	}
+	route := "/api/holes/" + strconv.Itoa(hole.ID) + "/stats"
+
+	testAPI(t, "get", route, 202)
+	utils.WaitBackground(time.Second)
+	stats := testAPI(t, "get", route, 200)
+	assert.EqualValues(t, 3, stats["floors"])
+	assert.EqualValues(t, 2, stats["participants"])
+	assert.Equal(t, []any{
+		Map{"date": "2023-05-01", "count": float64(2)},
+		Map{"date": "2023-05-02", "count": float64(1)},
+	}, stats["floors_by_day"])
+	assert.Equal(t, Map{"min": float64(10), "count": float64(1)}, stats["like_distribution"].([]any)[3])
+	terms := stats["top_terms"].([]any)
+	assert.Equal(t, Map{"term": "gpa", "count": float64(2)}, terms[0])
+	assert.Contains(t, terms, Map{"term": "期末", "count": float64(2)})
+
+	testAPI(t, "get", "/api/holes/"+strconv.Itoa(largeInt)+"/stats", 404)
+}
+
+func TestPreviewHole(t *testing.T) {
+	tag := Tag{Name: "TestPreviewHole"}
+	DB.Create(&tag)
+	holes := Holes{
+		{DivisionID: 1, Tags: Tags{&tag}, Floors: Floors{{Content: "图书馆自习室的座位怎么预约"}}},
+		{DivisionID: 1, Tags: Tags{&tag}, Floors: Floors{{Content: "图书馆自习室几点开门"}}},
+	}
+	DB.Create(&holes)
+
+	data := testAPI(t, "post", "/api/holes/preview", 200, Map{"content": "图书馆自习室又没座位了", "division_id": 1})
+	assert.Equal(t, "图书馆自习室又没座位了", data["content"])
+	suggestions := data["suggested_tags"].([]any)
+	if assert.NotEmpty(t, suggestions) {
+		assert.Equal(t, "TestPreviewHole", suggestions[0].(map[string]any)["tag"].(map[string]any)["name"])
+	}
+	warnings := data["warnings"].([]any)
+	if assert.Len(t, warnings, 1) {
+		assert.EqualValues(t, utils.ErrCodeTooFewTags, warnings[0].(map[string]any)["code"])
+	}
+
+	// tags of the hole are not suggested
+	data = testAPI(t, "post", "/api/holes/preview", 200, Map{"content": "图书馆自习室又没座位了", "tags": []Map{{"name": "TestPreviewHole"}}})
+	assert.Empty(t, data["suggested_tags"])
+	assert.Empty(t, data["warnings"])
+
+	testAPI(t, "post", "/api/holes/preview", 404, Map{"content": "图书馆", "division_id": largeInt})
+}
+
+func TestAutoTag(t *testing.T) {
+	// holes of another tenant, whose tag model is not built yet
+	tenantID := 9001
+	tag := Tag{TenantID: tenantID, Name: "TestAutoTag"}
+	DB.Create(&tag)
+	holes := Holes{
+		{TenantID: tenantID, DivisionID: 1, Tags: Tags{&tag}, Floors: Floors{{Content: "食堂的麻辣烫涨价了"}}},
+		{TenantID: tenantID, DivisionID: 1, Tags: Tags{&tag}, Floors: Floors{{Content: "食堂的麻辣烫好吃吗"}}},
+		{TenantID: tenantID, DivisionID: 1, Floors: Floors{{Content: "食堂麻辣烫排队好长"}}},
+	}
+	DB.Create(&holes)
+	holeID := holes[2].ID
+
+	results := testAPIArray(t, "post", "/api/holes/_auto_tag", 200, Map{"size": 1})
+	if assert.Len(t, results, 1) {
+		assert.EqualValues(t, holeID, results[0]["hole_id"])
+		assert.NotEmpty(t, results[0]["suggestions"])
+		assert.Empty(t, results[0]["applied"])
+	}
+
+	results = testAPIArray(t, "post", "/api/holes/_auto_tag", 200, Map{"size": 1, "apply": true, "min_score": 0})
+	if assert.Len(t, results, 1) {
+		applied := results[0]["applied"].([]any)
+		if assert.Len(t, applied, 1) {
+			assert.EqualValues(t, tag.ID, applied[0].(map[string]any)["id"])
+		}
+	}
+	var holeTags []HoleTag
+	DB.Where("hole_id = ?", holeID).Find(&holeTags)
+	assert.Equal(t, []HoleTag{{HoleID: holeID, TagID: tag.ID, Machine: true}}, holeTags)
+
+	// tagged holes are skipped
+	results = testAPIArray(t, "post", "/api/holes/_auto_tag", 200, Map{"size": 1})
+	if assert.Len(t, results, 1) {
+		assert.NotEqualValues(t, holeID, results[0]["hole_id"])
+	}
+}
+
+func TestRaffle(t *testing.T) {
+	hole := Hole{DivisionID: 1, UserID: 1}
+	DB.Create(&hole)
+	DB.Create(&Floor{HoleID: hole.ID, UserID: 1, Content: "TestRaffle", Ranking: 0})
+	route := "/api/holes/" + strconv.Itoa(hole.ID) + "/raffle"
+
+	testAPI(t, "post", route, 400, Map{"entry": "reply", "winners": 2, "deadline": time.Now().Add(-time.Hour)})
+	raffle := testAPI(t, "post", route, 201, Map{"entry": "reply", "winners": 2, "deadline": time.Now().Add(time.Hour)})
+	assert.Nil(t, raffle["seed"])
+	assert.NotEmpty(t, raffle["seed_hash"])
+	testAPI(t, "post", route, 400, Map{"entry": "like", "winners": 1, "deadline": time.Now().Add(time.Hour)}) // one per hole
+	testAPI(t, "post", route+"/_draw", 400)                                                                   // not ended
+
+	// replies enter, the owner doesn't win
+	testAPI(t, "post", "/api/holes/"+strconv.Itoa(hole.ID)+"/floors", 201, Map{"content": "TestRaffle"})
+	var entries []RaffleEntry
+	DB.Where("raffle_id = ?", raffle["id"]).Find(&entries)
+	assert.EqualValues(t, 1, len(entries))
+	for _, userID := range []int{4290, 4291, 4292} {
+		DB.Create(&RaffleEntry{RaffleID: int(raffle["id"].(float64)), UserID: userID})
+	}
+
+	DB.Model(&Raffle{}).Where("hole_id = ?", hole.ID).Update("deadline", time.Now().Add(-time.Minute))
+	var drawn Raffle
+	err := json.Unmarshal(testCommon(t, "post", route+"/_draw", 200), &drawn)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, len(drawn.Entrants))
+	assert.EqualValues(t, DrawRaffleWinners(drawn.Seed, drawn.Entrants, 2), drawn.Result)
+	assert.EqualValues(t, 2, len(drawn.Result))
+	seedHash := sha256.Sum256([]byte(drawn.Seed))
+	assert.EqualValues(t, raffle["seed_hash"], hex.EncodeToString(seedHash[:]))
+
+	var floor Floor
+	DB.Take(&floor, drawn.ResultFloorID)
+	assert.EqualValues(t, FloorTypeSystem, floor.Type)
+	assert.Contains(t, floor.Content, drawn.Seed)
+	testAPI(t, "post", route+"/_draw", 400) // drawn
+}
+
+func TestHoleRoutes(t *testing.T) {
+	division := newTestDivision(t)
+	hole := newTestHole(t, division)
+	newTestFloor(t, hole)
+	route := "/api/holes/" + strconv.Itoa(hole.ID)
+
+	runAPITests(t, []apiTestCase{
+		{name: "get", method: "get", route: route, statusCode: 200, check: func(t *testing.T, body []byte) {
+			got := decodeBody[Hole](t, body)
+			assert.Equal(t, hole.ID, got.ID)
+			assert.Equal(t, 1, got.Reply)
+		}},
+		{name: "get missing", method: "get", route: "/api/holes/" + strconv.Itoa(largeInt), statusCode: 404},
+		{name: "list in division", method: "get", route: "/api/divisions/" + strconv.Itoa(division.ID) + "/holes", statusCode: 200,
+			check: func(t *testing.T, body []byte) {
+				holes := decodeBody[Holes](t, body)
+				assert.Len(t, holes, 1)
+			}},
+		{name: "list floors", method: "get", route: route + "/floors", statusCode: 200, check: func(t *testing.T, body []byte) {
+			floors := decodeBody[Floors](t, body)
+			assert.Len(t, floors, 2)
+		}},
+		{name: "lock", method: "put", route: route, body: Map{"lock": true}, statusCode: 200, check: func(t *testing.T, body []byte) {
+			assert.True(t, decodeBody[Hole](t, body).Locked)
+		}},
+		{name: "hide", method: "delete", route: route, statusCode: 204},
+	})
+
+	var hidden Hole
+	DB.Take(&hidden, hole.ID)
+	assert.True(t, hidden.Hidden)
+}
@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"treehole_next/config"
+	. "treehole_next/models"
+)
+
+func TestNotificationRetry(t *testing.T) {
+	var healthy atomic.Bool
+	var pushes atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushes.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	saved := config.Config
+	defer func() { config.Config = saved }()
+	config.Config.NotificationUrl = server.URL
+	config.Config.NotificationMaxAttempts = 1
+
+	// the message is saved even if the push fails
+	message, err := Notification{
+		Title:      "retry",
+		Recipients: []int{1},
+		Type:       MessageTypeMail,
+		URL:        "/api/messages",
+	}.Send()
+	assert.Nil(t, err)
+	assert.NotZero(t, message.ID)
+	assert.EqualValues(t, 1, pushes.Load())
+
+	deadLetters := testAPIArray(t, "get", "/api/messages/dead_letters", 200)
+	assert.Len(t, deadLetters, 1)
+	assert.EqualValues(t, 1, deadLetters[0]["attempts"])
+	assert.NotEmpty(t, deadLetters[0]["last_error"])
+
+	// requeue after the notification service recovers
+	healthy.Store(true)
+	retried := testAPI(t, "post", "/api/messages/dead_letters/_retry", 200)
+	assert.EqualValues(t, 1, retried["count"])
+	n, err := RetryNotifications(100)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.EqualValues(t, 2, pushes.Load())
+
+	deadLetters = testAPIArray(t, "get", "/api/messages/dead_letters", 200)
+	assert.Empty(t, deadLetters)
+	n, err = RetryNotifications(100)
+	assert.Nil(t, err)
+	assert.Zero(t, n)
+
+	metrics := string(testCommon(t, "get", "/metrics", 200))
+	assert.Contains(t, metrics, `treehole_notification_deliveries_total{result="dead"} 1`)
+	assert.Contains(t, metrics, `treehole_notification_deliveries_total{result="success"} 1`)
+}
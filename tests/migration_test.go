@@ -0,0 +1,33 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "treehole_next/models"
+)
+
+func TestMigrationStatus(t *testing.T) {
+	states, err := MigrationStatus()
+	assert.Nil(t, err)
+	assert.NotEmpty(t, states)
+	for _, state := range states {
+		assert.NotNilf(t, state.AppliedAt, "migration %d applied on startup", state.Version)
+	}
+
+	// nothing pending
+	versions, err := MigrateUp(0)
+	assert.Nil(t, err)
+	assert.Empty(t, versions)
+}
+
+func TestQuote(t *testing.T) {
+	// tests run on SQLite
+	assert.Equal(t, "`like`", Quote("like"))
+	assert.Equal(t, "`floor`.`like`", Quote("floor.like"))
+
+	var count int64
+	err := DB.Model(&Floor{}).Where(Quote("like") + " >= 0").Count(&count).Error
+	assert.Nil(t, err)
+}
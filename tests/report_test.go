@@ -1,11 +1,13 @@
 package tests
 
 import (
+	"slices"
 	"strconv"
 	"testing"
 
 	"github.com/rs/zerolog/log"
 
+	"treehole_next/config"
 	. "treehole_next/models"
 
 	"github.com/stretchr/testify/assert"
@@ -54,3 +56,140 @@ func TestDeleteReport(t *testing.T) {
 	DB.First(&getReport, reportID)
 	assert.EqualValues(t, true, getReport.Dealt)
 }
+
+func TestReportStats(t *testing.T) {
+	before := testAPI(t, "get", "/api/admin/reports/stats", 200)
+
+	// the detail is required for other reasons only
+	testAPI(t, "post", "/api/reports", 400, Map{"floor_id": REPORT_FLOOR_BASE_ID + 15})
+	testAPI(t, "post", "/api/reports", 400, Map{"floor_id": REPORT_FLOOR_BASE_ID + 15, "category": "unknown"})
+	testAPI(t, "post", "/api/reports", 204, Map{"floor_id": REPORT_FLOOR_BASE_ID + 15, "category": "spam"})
+
+	var report Report
+	DB.Where("floor_id = ?", REPORT_FLOOR_BASE_ID+15).Last(&report)
+	assert.EqualValues(t, ReportCategorySpam, report.Category)
+	testAPI(t, "delete", "/api/reports/"+strconv.Itoa(report.ID), 200, Map{"result": "已删除", "outcome": "removed"})
+
+	data := testAPI(t, "get", "/api/admin/reports/stats?bucket=week", 200)
+	assert.EqualValues(t, before["total"].(float64)+1, data["total"])
+	spamBefore, _ := before["by_category"].(Map)["spam"].(float64)
+	assert.EqualValues(t, spamBefore+1, data["by_category"].(Map)["spam"])
+	assert.GreaterOrEqual(t, data["by_outcome"].(Map)["removed"], float64(1))
+	assert.NotEmpty(t, data["buckets"])
+
+	testAPI(t, "get", "/api/admin/reports/stats?bucket=year", 400)
+}
+
+func TestReportFeedback(t *testing.T) {
+	templates := testAPIArray(t, "get", "/api/admin/report_feedback_templates", 200)
+	assert.Len(t, templates, len(DefaultReportFeedbackTemplates))
+
+	testAPI(t, "put", "/api/admin/report_feedback_templates/unknown", 404, Map{"title": "a", "content": "b"})
+	testAPI(t, "put", "/api/admin/report_feedback_templates/no_violation", 400, Map{"title": "a"})
+	testAPI(t, "put", "/api/admin/report_feedback_templates/no_violation", 200, Map{
+		"title":   "举报结果",
+		"content": "##{floor_id} 未违规：{result}",
+	})
+	defer testCommon(t, "delete", "/api/admin/report_feedback_templates/no_violation", 204)
+
+	reportID := REPORT_BASE_ID + 8
+	testAPI(t, "delete", "/api/reports/"+strconv.Itoa(reportID), 200, Map{"result": "内容正常", "outcome": "no_violation"})
+	var report Report
+	DB.First(&report, reportID)
+	assert.EqualValues(t, ReportOutcomeNoViolation, report.Outcome)
+
+	var message Message
+	DB.Where("type = ?", MessageTypeReportDealt).Last(&message)
+	assert.EqualValues(t, "举报结果", message.Title)
+	assert.EqualValues(t, "##"+strconv.Itoa(report.FloorID)+" 未违规：内容正常", message.Description)
+
+	// reports dealt without an outcome use the default template
+	title, content, err := (&Report{FloorID: 1, Result: "已处理"}).ReportFeedback()
+	assert.Nil(t, err)
+	assert.EqualValues(t, "您的举报已得到处理", title)
+	assert.Contains(t, content, "处理结果：已处理")
+}
+
+func TestJuryVote(t *testing.T) {
+	defer func(quorum int) { config.Config.JuryQuorum = quorum }(config.Config.JuryQuorum)
+	config.Config.JuryQuorum = 3
+
+	hole := Hole{DivisionID: 1, UserID: 4300, Floors: Floors{{Content: "jury", UserID: 4300}}}
+	DB.Create(&hole)
+	floor := hole.Floors[0]
+	report := Report{FloorID: floor.ID, UserID: 4301, Category: ReportCategoryAbuse}
+	DB.Create(&report)
+
+	jurors := make([]*User, 0, 3)
+	for userID := 4302; userID < 4305; userID++ {
+		override := 100
+		_, err := SetReputationOverride(DB, userID, &override)
+		assert.Nil(t, err)
+		juror := &User{ID: userID}
+		juror.Config.Jury = true
+		assert.Nil(t, juror.CheckJuror())
+		jurors = append(jurors, juror)
+	}
+	// not opted in
+	assert.Error(t, (&User{ID: 4302}).CheckJuror())
+	testAPI(t, "get", "/api/reports/jury", 403)
+	testAPI(t, "post", "/api/reports/"+strconv.Itoa(report.ID)+"/vote", 403, Map{"vote": "hide"})
+
+	// contents are anonymized
+	reports, err := LoadJuryReports(jurors[0], 30)
+	assert.Nil(t, err)
+	index := slices.IndexFunc(reports, func(r JuryReport) bool { return r.ReportID == report.ID })
+	assert.GreaterOrEqual(t, index, 0)
+	assert.EqualValues(t, "jury", reports[index].Content)
+
+	// the reporter and the poster can't vote
+	_, err = (&Report{ID: report.ID}).Vote(4301, ReportVoteHide)
+	assert.Error(t, err)
+
+	verdict, err := (&Report{ID: report.ID}).Vote(jurors[0].ID, ReportVoteHide)
+	assert.Nil(t, err)
+	assert.Empty(t, verdict)
+	_, err = (&Report{ID: report.ID}).Vote(jurors[0].ID, ReportVoteKeep)
+	assert.Error(t, err)
+	reports, _ = LoadJuryReports(jurors[0], 30)
+	assert.False(t, slices.ContainsFunc(reports, func(r JuryReport) bool { return r.ReportID == report.ID }))
+
+	_, _ = (&Report{ID: report.ID}).Vote(jurors[1].ID, ReportVoteKeep)
+	verdict, err = (&Report{ID: report.ID}).Vote(jurors[2].ID, ReportVoteHide)
+	assert.Nil(t, err)
+	assert.EqualValues(t, ReportVoteHide, verdict)
+
+	DB.First(&report, report.ID)
+	assert.True(t, report.Dealt)
+	assert.EqualValues(t, ReportOutcomeRemoved, report.Outcome)
+	var hidden Floor
+	DB.First(&hidden, floor.ID)
+	assert.True(t, hidden.Deleted)
+
+	_, err = (&Report{ID: report.ID}).Vote(4305, ReportVoteKeep)
+	assert.Error(t, err)
+
+	votes := testAPIArray(t, "get", "/api/reports/"+strconv.Itoa(report.ID)+"/votes", 200)
+	assert.Len(t, votes, 3)
+}
+
+func TestReportRoutes(t *testing.T) {
+	hole := newTestHole(t, nil)
+	floor := newTestFloor(t, hole)
+	report := newTestReport(t, floor)
+	route := "/api/reports/" + strconv.Itoa(report.ID)
+
+	runAPITests(t, []apiTestCase{
+		{name: "get", method: "get", route: route, statusCode: 200, check: func(t *testing.T, body []byte) {
+			got := decodeBody[Report](t, body)
+			assert.Equal(t, floor.ID, got.FloorID)
+			assert.False(t, got.Dealt)
+		}},
+		{name: "get missing", method: "get", route: "/api/reports/" + strconv.Itoa(largeInt), statusCode: 404},
+		{name: "add", method: "post", route: "/api/reports", body: Map{"floor_id": floor.ID, "reason": "routes"}, statusCode: 204},
+		{name: "add without reason", method: "post", route: "/api/reports", body: Map{"floor_id": floor.ID}, statusCode: 400},
+		{name: "deal", method: "delete", route: route, body: Map{"result": "routes"}, statusCode: 200, check: func(t *testing.T, body []byte) {
+			assert.True(t, decodeBody[Report](t, body).Dealt)
+		}},
+	})
+}
@@ -0,0 +1,32 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "treehole_next/models"
+)
+
+func TestSeed(t *testing.T) {
+	division := newTestDivision(t)
+	err := Seed(SeedOptions{Holes: 20, Floors: 300, Tags: 5, Users: 50, DivisionID: division.ID, BatchSize: 7})
+	assert.Nil(t, err)
+
+	var holes Holes
+	DB.Where("division_id = ?", division.ID).Find(&holes)
+	assert.EqualValues(t, 20, len(holes))
+
+	var floors int64
+	for _, hole := range holes {
+		var count, maxRanking int64
+		DB.Model(&Floor{}).Where("hole_id = ?", hole.ID).Count(&count)
+		DB.Model(&Floor{}).Where("hole_id = ?", hole.ID).Select("max(ranking)").Scan(&maxRanking)
+		assert.EqualValues(t, hole.Reply+1, count, "reply of hole %d", hole.ID)
+		assert.EqualValues(t, count-1, maxRanking, "ranking of hole %d", hole.ID)
+		floors += count
+	}
+	assert.EqualValues(t, 300, floors)
+
+	assert.NotNil(t, Seed(SeedOptions{Holes: 10, Floors: 5, DivisionID: division.ID}))
+}
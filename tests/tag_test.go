@@ -3,6 +3,7 @@ package tests
 import (
 	"strconv"
 	"testing"
+	"time"
 
 	. "treehole_next/models"
 
@@ -79,3 +80,60 @@ func TestDeleteTag(t *testing.T) {
 	data["to"] = "iii555"
 	testAPI(t, "delete", "/api/tags/"+strconv.Itoa(id), 404, data)
 }
+
+func TestTagReview(t *testing.T) {
+	tags := Tags{{Name: "pending_a", Pending: true}, {Name: "pending_b", Pending: true}, {Name: "pending_c", Pending: true}}
+	DB.Create(&tags)
+	for _, tag := range tags {
+		DB.Create(&HoleTag{HoleID: 5, TagID: tag.ID})
+	}
+
+	pending := testAPIArray(t, "get", "/api/admin/tags/pending", 200)
+	assert.Len(t, pending, 3)
+	assert.Equal(t, true, pending[0]["pending"])
+	assert.Empty(t, testAPIArray(t, "get", "/api/tags?s=pending_", 200))
+
+	approved := testAPI(t, "post", "/api/admin/tags/pending/"+strconv.Itoa(tags[0].ID)+"/_approve", 200)
+	assert.Equal(t, false, approved["pending"])
+	testCommon(t, "post", "/api/admin/tags/pending/"+strconv.Itoa(tags[0].ID)+"/_approve", 404)
+
+	// renamed to an existing tag, holes are linked to it
+	merged := testAPI(t, "put", "/api/admin/tags/pending/"+strconv.Itoa(tags[1].ID), 200, Map{"name": "pending_a"})
+	assert.EqualValues(t, tags[0].ID, merged["id"])
+	var count int64
+	DB.Model(&Tag{}).Where("id = ?", tags[1].ID).Count(&count)
+	assert.EqualValues(t, 0, count)
+
+	testCommon(t, "delete", "/api/admin/tags/pending/"+strconv.Itoa(tags[2].ID), 204)
+	DB.Model(&HoleTag{}).Where("tag_id = ?", tags[2].ID).Count(&count)
+	assert.EqualValues(t, 0, count)
+	DB.Model(&HoleTag{}).Where("tag_id = ? AND hole_id = ?", tags[0].ID, 5).Count(&count)
+	assert.EqualValues(t, 1, count)
+}
+
+func TestTagStats(t *testing.T) {
+	holes := Holes{{DivisionID: 1}, {DivisionID: 1}, {DivisionID: 1}}
+	tags := Tags{
+		{Name: "stats_a", Temperature: 3, Holes: holes},
+		{Name: "stats_b", Holes: holes[:2]},
+		{Name: "stats_c", Holes: holes[2:]},
+	}
+	DB.Create(&tags)
+
+	today := StartOfDay(time.Now())
+	assert.Nil(t, RefreshTagDailyStats(DB, today))
+	assert.Nil(t, RefreshTagCooccurrences(DB))
+
+	data := testAPI(t, "get", "/api/tags/stats_a/stats?bucket=week", 200)
+	assert.Equal(t, "stats_a", data["tag"].(Map)["name"])
+	buckets := data["holes"].([]any)
+	assert.Len(t, buckets, 1)
+	assert.EqualValues(t, 3, buckets[0].(Map)["count"])
+	assert.EqualValues(t, 3, data["temperature"].([]any)[0].(Map)["temperature"])
+	cooccurring := data["cooccurring"].([]any)
+	assert.Len(t, cooccurring, 2)
+	assert.Equal(t, Map{"name": "stats_b", "count": float64(2)}, cooccurring[0])
+
+	testCommon(t, "get", "/api/tags/stats_none/stats", 404)
+	testCommon(t, "get", "/api/tags/stats_a/stats?bucket=year", 400)
+}
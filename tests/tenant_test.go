@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+
+	. "treehole_next/models"
+)
+
+// testTenantAPI requests route in the tenant of key, see X-Tenant
+func testTenantAPI(t *testing.T, key, method, route string, statusCode int, data ...Map) Map {
+	var requestData []byte
+	if len(data) > 0 {
+		var err error
+		requestData, err = json.Marshal(data[0])
+		assert.Nilf(t, err, "encode request body")
+	}
+	req, err := http.NewRequest(method, route, bytes.NewBuffer(requestData))
+	assert.Nilf(t, err, "constructs http request")
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("X-Consumer-Username", "1")
+	req.Header.Add("X-Tenant", key)
+
+	res, err := App.Test(req, -1)
+	assert.Nilf(t, err, "perform request")
+	assert.Equalf(t, statusCode, res.StatusCode, "status code")
+	responseBody, err := io.ReadAll(res.Body)
+	assert.Nilf(t, err, "decode response")
+
+	var responseData Map
+	_ = json.Unmarshal(responseBody, &responseData)
+	return responseData
+}
+
+func TestTenant(t *testing.T) {
+	testAPI(t, "post", "/api/tenants", 201, Map{
+		"key":    "campusa",
+		"name":   "Campus A",
+		"config": Map{"hole_link_format": "https://a.example.com/holes/%d"},
+	})
+	testAPI(t, "post", "/api/tenants", 400, Map{"key": "campusa", "name": "Campus A"})
+	testAPI(t, "post", "/api/tenants", 400, Map{"key": "Campus-B", "name": "Campus B"})
+	testTenantAPI(t, "unknown", "GET", "/api/divisions", 404)
+
+	// names are unique in a tenant
+	var defaultDivision Division
+	DB.Where("tenant_id = 0").First(&defaultDivision)
+	division := testTenantAPI(t, "campusa", "POST", "/api/divisions", 201, Map{"name": defaultDivision.Name})
+	divisionID := int(division["id"].(float64))
+	assert.NotEqual(t, defaultDivision.ID, divisionID)
+
+	divisions := testAPIArray(t, "get", "/api/divisions", 200)
+	for _, division := range divisions {
+		assert.NotEqualValues(t, divisionID, division["id"])
+	}
+	testTenantAPI(t, "campusa", "GET", "/api/divisions/"+strconv.Itoa(defaultDivision.ID), 404)
+	testTenantAPI(t, "campusa", "GET", "/api/divisions/"+strconv.Itoa(divisionID), 200)
+
+	// holes are scoped by tenant
+	var tenant Tenant
+	DB.Where("`key` = ?", "campusa").Take(&tenant)
+	hole := Hole{TenantID: tenant.ID, DivisionID: divisionID, Floors: Floors{{Content: "tenant hole"}}}
+	DB.Create(&hole)
+	route := "/api/holes/" + strconv.Itoa(hole.ID)
+	testAPI(t, "get", route, 404)
+	testTenantAPI(t, "campusa", "GET", route, 200)
+
+	// floors too
+	floorRoute := "/api/floors/" + strconv.Itoa(hole.Floors[0].ID)
+	testAPI(t, "get", floorRoute, 404)
+	testTenantAPI(t, "campusa", "GET", floorRoute, 200)
+	testAPI(t, "get", route+"/floors", 404)
+	testTenantAPI(t, "campusa", "GET", route+"/floors", 200)
+
+	// in GraphQL too
+	floorQuery := Map{"query": "{ floor(id: " + strconv.Itoa(hole.Floors[0].ID) + ") { id } }"}
+	resp := testAPI(t, "post", "/api/graphql", 200, floorQuery)
+	assert.NotEmpty(t, resp["errors"])
+	resp = testTenantAPI(t, "campusa", "POST", "/api/graphql", 200, floorQuery)
+	assert.Nil(t, resp["errors"])
+	holeQuery := Map{"query": "{ hole(id: " + strconv.Itoa(hole.ID) + ") { floors { id } } }"}
+	resp = testTenantAPI(t, "campusa", "POST", "/api/graphql", 200, holeQuery)
+	assert.Len(t, resp["data"].(Map)["hole"].(Map)["floors"], 1)
+
+	// tags too
+	tag := Tag{TenantID: tenant.ID, Name: "114"}
+	assert.Nil(t, DB.Create(&tag).Error)
+	testTenantAPI(t, "campusa", "GET", "/api/tags/"+strconv.Itoa(tag.ID), 200)
+	testAPI(t, "get", "/api/tags/"+strconv.Itoa(tag.ID), 404)
+	for _, defaultTag := range testAPIArray(t, "get", "/api/tags", 200) {
+		assert.NotEqualValues(t, tag.ID, defaultTag["id"])
+	}
+
+	// config overrides
+	meta := testTenantAPI(t, "campusa", "GET", route+"/meta", 200)
+	assert.EqualValues(t, "https://a.example.com/holes/"+strconv.Itoa(hole.ID), meta["url"])
+	testTenantAPI(t, "campusa", "PUT", "/api/tenants/"+strconv.Itoa(tenant.ID), 200, Map{"config": Map{"admin_only": true}})
+	testTenantAPI(t, "campusa", "GET", route+"/meta", 403)
+	testAPI(t, "get", route+"/meta", 404)
+}
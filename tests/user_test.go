@@ -0,0 +1,562 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+
+	"treehole_next/config"
+	. "treehole_next/models"
+	"treehole_next/utils"
+)
+
+func TestExportUserData(t *testing.T) {
+	// the download link is sent to an existing user
+	DB.FirstOrCreate(&User{ID: 1})
+
+	testAPI(t, "post", "/api/users/me/export", 202)
+	testAPI(t, "post", "/api/users/me/export", 429)
+
+	// wait for the archive
+	var message Message
+	for i := 0; i < 50; i++ {
+		DB.Where("title = ?", "您的数据导出已完成").Last(&message)
+		if message.ID != 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.True(t, strings.HasPrefix(message.URL, "/api/users/me/export/"))
+
+	archive := testAPI(t, "get", message.URL, 200)
+	assert.EqualValues(t, 1, archive["user_id"])
+	assert.Contains(t, archive, "holes")
+	assert.Contains(t, archive, "floors")
+
+	testAPI(t, "get", "/api/users/me/export/invalid", 404)
+}
+
+func TestPurgeUser(t *testing.T) {
+	const userID = 4242
+	config.Config.PurgedUserID = 4243
+	defer func() { config.Config.PurgedUserID = 0 }()
+
+	hole := Hole{DivisionID: 1, UserID: userID, Floors: Floors{{Content: "purge", UserID: userID}}}
+	DB.Create(&hole)
+	floor := hole.Floors[0]
+	DB.Create(&FloorLike{FloorID: floor.ID, UserID: userID, LikeData: 1})
+	DB.Model(&Floor{}).Where("id = ?", floor.ID).UpdateColumn("like", 1)
+
+	route := "/api/users/" + strconv.Itoa(userID) + "/_purge"
+	data := testAPI(t, "post", route, 200, Map{"mode": "delete", "dry_run": true})
+	counts := data["counts"].(Map)
+	assert.EqualValues(t, 1, counts["holes"])
+	assert.EqualValues(t, 1, counts["floors"])
+	assert.EqualValues(t, 1, counts["likes"])
+	assert.EqualValues(t, 1, counts["deleted_floors"])
+
+	// dry run changes nothing
+	var n int64
+	DB.Model(&Floor{}).Where("user_id = ?", userID).Count(&n)
+	assert.EqualValues(t, 1, n)
+
+	data = testAPI(t, "post", route, 200, Map{"mode": "delete"})
+	counts = data["counts"].(Map)
+	assert.EqualValues(t, 1, counts["floors"])
+	assert.EqualValues(t, 1, counts["likes"])
+
+	var getFloor Floor
+	DB.First(&getFloor, floor.ID)
+	assert.Equal(t, config.Config.PurgedUserID, getFloor.UserID)
+	assert.True(t, getFloor.Deleted)
+	assert.NotEqual(t, "purge", getFloor.Content)
+	assert.EqualValues(t, 0, getFloor.Like)
+
+	// the original content is kept for moderation
+	var history FloorHistory
+	DB.Where("floor_id = ?", floor.ID).Last(&history)
+	assert.Equal(t, "purge", history.Content)
+
+	var getHole Hole
+	DB.Unscoped().First(&getHole, hole.ID)
+	assert.Equal(t, config.Config.PurgedUserID, getHole.UserID)
+	assert.True(t, getHole.Hidden)
+	// the purged user can't unhide the hole
+	assert.Equal(t, HoleHiddenByModerator, getHole.HiddenState)
+
+	testAPI(t, "post", "/api/users/"+strconv.Itoa(config.Config.PurgedUserID)+"/_purge", 400, Map{})
+}
+
+func TestReadYourWrites(t *testing.T) {
+	config.Config.MysqlReplicaURLs = []string{"replica"}
+	defer func() { config.Config.MysqlReplicaURLs = nil }()
+	_ = utils.DeleteCache("read_primary_1")
+
+	var wrote bool
+	testCommon(t, "get", "/api/divisions", 200)
+	assert.False(t, utils.GetCache("read_primary_1", &wrote))
+
+	testCommon(t, "post", "/api/batch", 200, Map{"requests": []Map{{"path": "/api/divisions"}}})
+	assert.True(t, utils.GetCache("read_primary_1", &wrote))
+	assert.True(t, wrote)
+}
+
+func TestNotificationSettings(t *testing.T) {
+	DB.FirstOrCreate(&User{ID: 1})
+	defer DB.Where("user_id = ?", 1).Delete(&NotificationSetting{})
+
+	settings := testAPI(t, "get", "/api/users/me/notification_settings", 200)
+	for _, category := range []string{"mention", "reply", "favorite", "report_result", "system"} {
+		assert.Equalf(t, true, settings[category], "%s enabled by default", category)
+	}
+
+	settings = testAPI(t, "put", "/api/users/me/notification_settings", 200, Map{"reply": false})
+	assert.Equal(t, false, settings["reply"])
+	assert.Equal(t, true, settings["mention"])
+
+	settings = testAPI(t, "get", "/api/users/me/notification_settings", 200)
+	assert.Equal(t, false, settings["reply"])
+
+	saved, err := LoadNotificationSettings(DB, []int{1})
+	assert.Nil(t, err)
+	assert.False(t, saved[1].Enabled(MessageTypeReply))
+	assert.True(t, saved[1].Enabled(MessageTypeMention))
+	assert.True(t, saved[1].Enabled(MessageTypeLike))
+}
+
+func TestActAs(t *testing.T) {
+	const userID = 4250
+	DB.Create(&User{ID: userID})
+	DB.Create(&UserFavorite{UserID: userID, HoleID: 3})
+
+	actAs := func(method, route, header string, statusCode int) Map {
+		req, err := http.NewRequest(method, route, nil)
+		assert.Nil(t, err)
+		req.Header.Add("X-Consumer-Username", "1")
+		req.Header.Add("X-Act-As", header)
+		res, err := App.Test(req, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, statusCode, res.StatusCode)
+		var data Map
+		_ = json.NewDecoder(res.Body).Decode(&data)
+		return data
+	}
+
+	// disabled by default
+	data := actAs("GET", "/api/user/favorites?plain=true", strconv.Itoa(userID), 403)
+	assert.EqualValues(t, utils.ErrCodeActAsDisabled, data["code"])
+
+	config.Config.ActAsEnabled = true
+	defer func() { config.Config.ActAsEnabled = false }()
+
+	// other tests act as users too
+	var before, count int64
+	DB.Model(&AdminLog{}).Where("type = ? AND user_id = ?", AdminLogTypeActAs, 1).Count(&before)
+	data = actAs("GET", "/api/user/favorites?plain=true", strconv.Itoa(userID), 200)
+	assert.EqualValues(t, []any{float64(3)}, data["data"])
+	DB.Model(&AdminLog{}).Where("type = ? AND user_id = ?", AdminLogTypeActAs, 1).Count(&count)
+	assert.EqualValues(t, before+1, count)
+
+	data = actAs("DELETE", "/api/user/favorites", strconv.Itoa(userID), 403)
+	assert.EqualValues(t, utils.ErrCodeActAsReadOnly, data["code"])
+	actAs("GET", "/api/user/favorites?plain=true", "abc", 400)
+	actAs("GET", "/api/user/favorites?plain=true", "99999", 404)
+}
+
+func TestPermissions(t *testing.T) {
+	const userID = 4270
+
+	data := testAPI(t, "get", "/api/users/me/permissions", 200)
+	assert.Contains(t, data["roles"], UserRoleAdmin)
+	assert.Contains(t, data["permissions"], PermissionManageTenant)
+
+	testAPIArray(t, "put", "/api/divisions/1/moderators", 200, Map{"moderators": []int{userID, userID}})
+	moderators := testAPIArray(t, "get", "/api/divisions/1/moderators", 200)
+	assert.Len(t, moderators, 1)
+	testCommon(t, "put", "/api/divisions/99999/moderators", 404, Map{"moderators": []int{userID}})
+
+	_, key, err := NewAPIKey(DB, "moderator", userID, 1, []string{ScopeRead})
+	assert.Nil(t, err)
+	asModerator := func(route string, statusCode int) Map {
+		req, err := http.NewRequest("GET", route, nil)
+		assert.Nil(t, err)
+		req.Header.Add("X-API-Key", key)
+		res, err := App.Test(req, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, statusCode, res.StatusCode)
+		var data Map
+		_ = json.NewDecoder(res.Body).Decode(&data)
+		return data
+	}
+
+	// division moderators are only allowed in their divisions
+	data = asModerator("/api/users/me/permissions", 200)
+	assert.EqualValues(t, []any{UserRoleUser, UserRoleDivisionModerator}, data["roles"])
+	assert.Empty(t, data["permissions"])
+	assert.Contains(t, data["divisions"].(Map)["1"], PermissionModerateHole)
+	assert.NotContains(t, data["divisions"].(Map)["1"], PermissionMoveHole)
+
+	data = asModerator("/api/webhooks", 403)
+	assert.EqualValues(t, utils.ErrCodePermissionDenied, data["code"])
+}
+
+func TestReputation(t *testing.T) {
+	const userID = 4250
+	defer func(days, minReputation int) {
+		config.Config.LinkRestrictDays, config.Config.LinkMinReputation = days, minReputation
+	}(config.Config.LinkRestrictDays, config.Config.LinkMinReputation)
+	config.Config.LinkRestrictDays, config.Config.LinkMinReputation = 7, 5
+
+	hole := Hole{DivisionID: 1, UserID: userID, Floors: Floors{{Content: "reputation", UserID: userID, Like: 8}}}
+	DB.Create(&hole)
+
+	// likes count, a recent punishment costs more
+	user := &User{ID: userID, JoinedTime: time.Now().Add(-30 * 24 * time.Hour)}
+	reputation, err := LoadReputation(user.ID, user.JoinedTime)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 38, reputation.Score)
+	assert.Nil(t, user.CheckLinkPrivilege("see https://example.com"))
+
+	DB.Create(&Punishment{UserID: userID, StartTime: time.Now(), EndTime: time.Now()})
+	DB.Model(&UserReputation{}).Where("user_id = ?", userID).UpdateColumn("updated_at", time.Now().Add(-2*ReputationRefreshInterval))
+	reputation, err = LoadReputation(user.ID, time.Time{})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 18, reputation.Score)
+
+	// new users can't post links or images, stickers are fine
+	newUser := &User{ID: userID + 1, JoinedTime: time.Now()}
+	assert.Nil(t, newUser.CheckLinkPrivilege("hello ![](dx_sticker)"))
+	err = newUser.CheckLinkPrivilege("![](https://example.com/a.png)")
+	var e *utils.Error
+	assert.ErrorAs(t, err, &e)
+	assert.EqualValues(t, utils.ErrCodeLinkNotAllowed, e.Code)
+
+	// admins override the score and the age
+	route := "/api/users/" + strconv.Itoa(newUser.ID) + "/reputation"
+	data := testAPI(t, "put", route, 200, Map{"override": 10})
+	assert.EqualValues(t, 10, data["value"])
+	assert.Nil(t, newUser.CheckLinkPrivilege("see https://example.com"))
+
+	data = testAPI(t, "put", route, 200, Map{"override": nil})
+	assert.Nil(t, data["override"])
+	data = testAPI(t, "get", route, 200)
+	assert.EqualValues(t, 0, data["value"])
+	assert.Error(t, newUser.CheckLinkPrivilege("see https://example.com"))
+}
+
+func TestDigest(t *testing.T) {
+	now := time.Now()
+	settings := testAPI(t, "put", "/api/users/me/notification_settings", 200, Map{"digest": true, "digest_hour": now.Hour()})
+	assert.Equal(t, true, settings["digest"])
+	testAPI(t, "put", "/api/users/me/notification_settings", 400, Map{"digest_hour": 24})
+
+	hole := Hole{DivisionID: 1, UserID: 5}
+	DB.Create(&hole)
+	DB.Create(&UserSubscription{UserID: 1, HoleID: hole.ID})
+	DB.Create(&Floor{HoleID: hole.ID, UserID: 5, Content: "TestDigest"})
+	DB.Create(&Floor{HoleID: hole.ID, UserID: 5, Content: "TestDigest", Ranking: 1})
+
+	countDigests := func() int64 {
+		var count int64
+		DB.Model(&Message{}).Where("type = ?", MessageTypeDigest).Count(&count)
+		return count
+	}
+	before := countDigests()
+	assert.Nil(t, FlushDigests(now))
+	assert.EqualValues(t, before+1, countDigests())
+
+	var message Message
+	DB.Where("type = ?", MessageTypeDigest).Order("id DESC").Take(&message)
+	holes := message.Data.(map[string]any)["holes"].([]any)
+	assert.Contains(t, holes, map[string]any{"hole_id": float64(hole.ID), "count": float64(2)})
+
+	// sent once a day
+	assert.Nil(t, FlushDigests(now.Add(time.Minute)))
+	assert.EqualValues(t, before+1, countDigests())
+}
+
+func TestTrustedUser(t *testing.T) {
+	defer func(minReputation int, bypasses []string) {
+		config.Config.TrustedMinReputation, config.Config.TrustedBypasses = minReputation, bypasses
+	}(config.Config.TrustedMinReputation, config.Config.TrustedBypasses)
+	config.Config.TrustedMinReputation = 20
+	config.Config.TrustedBypasses = []string{TrustedBypassChallenge, TrustedBypassReview}
+
+	user := &User{ID: 4260, JoinedTime: time.Now()}
+	assert.False(t, user.Trusted(TrustedBypassReview))
+
+	override := 30
+	_, err := SetReputationOverride(DB, user.ID, &override)
+	assert.Nil(t, err)
+	assert.True(t, user.Trusted(TrustedBypassReview))
+	assert.False(t, user.Trusted(TrustedBypassSensitive))
+
+	// trusted users skip the challenge
+	saved := Spam
+	defer func() { Spam = saved }()
+	defer func(threshold float64, secret string) {
+		config.Config.SpamChallengeThreshold, config.Config.ChallengeSecret = threshold, secret
+	}(config.Config.SpamChallengeThreshold, config.Config.ChallengeSecret)
+	config.Config.SpamChallengeThreshold, config.Config.ChallengeSecret = 0.5, "secret"
+	Spam = stubSpamChecker(0.6)
+	_, err = CheckSpam(context.Background(), user, 1, &Floor{Content: "hello"}, false)
+	assert.Nil(t, err)
+	_, err = CheckSpam(context.Background(), &User{ID: 4261}, 1, &Floor{Content: "hello"}, false)
+	assert.NotNil(t, err)
+
+	// holes of untrusted users are pending review
+	defer func(review bool) { config.Config.HoleReviewUntrusted = review }(config.Config.HoleReviewUntrusted)
+	config.Config.HoleReviewUntrusted = true
+	config.Config.SpamChallengeThreshold = 0
+	c := App.AcquireCtx(&fasthttp.RequestCtx{})
+	defer App.ReleaseCtx(c)
+	for _, author := range []*User{user, {ID: 4261, JoinedTime: time.Now()}} {
+		hole := Hole{DivisionID: 1, UserID: author.ID, Floors: Floors{{UserID: author.ID, Content: "TestTrustedUser"}}}
+		err = hole.Create(DB, author, []string{"TrustedUser"}, c)
+		assert.Nil(t, err)
+		if author == user {
+			assert.False(t, hole.Hidden)
+		} else {
+			assert.True(t, hole.Hidden)
+			assert.Equal(t, HolePendingReview, hole.HiddenState)
+		}
+	}
+}
+
+func TestDivisionSettings(t *testing.T) {
+	division := Division{Name: "TestDivisionSettings", MutedByDefault: true}
+	DB.Create(&division)
+	route := "/api/users/me/division_settings/" + strconv.Itoa(division.ID)
+
+	settings := testAPIArray(t, "get", "/api/users/me/division_settings", 200)
+	assert.Contains(t, settings, Map{"division_id": float64(division.ID), "muted": true, "muted_by_default": true})
+
+	setting := testAPI(t, "put", route, 200, Map{"muted": false})
+	assert.Equal(t, false, setting["muted"])
+	muted, err := MutedDivisionIDs(DB, 1)
+	assert.Nil(t, err)
+	assert.NotContains(t, muted, division.ID)
+
+	testAPI(t, "put", route, 400)
+	testAPI(t, "put", "/api/users/me/division_settings/"+strconv.Itoa(largeInt), 404, Map{"muted": true})
+}
+
+func TestAnnualReport(t *testing.T) {
+	testAPI(t, "get", "/api/users/me/annual_report?year=2001", 404)
+
+	night := time.Date(2001, 3, 1, 2, 0, 0, 0, time.Local)
+	tag := Tag{Name: "TestAnnualReport"}
+	hole := Hole{DivisionID: 1, UserID: 1, Tags: Tags{&tag}}
+	hole.CreatedAt = night
+	DB.Create(&hole)
+	for i, like := range []int{3, 2} {
+		floor := Floor{HoleID: hole.ID, UserID: 1, Content: "TestAnnualReport", Ranking: i, Like: like}
+		floor.CreatedAt = night.Add(time.Duration(i*12) * time.Hour)
+		DB.Create(&floor)
+	}
+	// other years are not counted
+	DB.Create(&Floor{HoleID: hole.ID, UserID: 1, Content: "TestAnnualReport", Ranking: 2, Like: 10})
+
+	_, err := GenerateAnnualReports(2001)
+	assert.Nil(t, err)
+
+	report := testAPI(t, "get", "/api/users/me/annual_report?year=2001", 200)
+	assert.EqualValues(t, 1, report["holes"])
+	assert.EqualValues(t, 2, report["floors"])
+	assert.EqualValues(t, 5, report["likes_received"])
+	assert.EqualValues(t, 1, report["most_active_division_id"])
+	assert.EqualValues(t, []any{"TestAnnualReport"}, report["favorite_tags"])
+	assert.EqualValues(t, 0.5, report["night_owl_index"])
+}
+
+func TestUserStats(t *testing.T) {
+	before := testAPI(t, "get", "/api/users/me/stats", 200)
+
+	var hole Hole
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &hole, Map{"content": "TestUserStats", "tags": []Map{{"name": "TestUserStats"}}})
+	var floor Floor
+	testAPIModel(t, "post", "/api/holes/"+strconv.Itoa(hole.ID)+"/floors", 201, &floor, Map{"content": "TestUserStats"})
+	testAPI(t, "put", "/api/floors/"+strconv.Itoa(floor.ID), 200, Map{"like": "add"})
+	testAPI(t, "put", "/api/floors/"+strconv.Itoa(floor.ID), 200, Map{"like": "add"}) // already liked
+	testAPI(t, "post", "/api/user/favorites", 201, Map{"hole_id": hole.ID})
+
+	stats := testAPI(t, "get", "/api/users/me/stats", 200)
+	assert.EqualValues(t, before["floors"].(float64)+2, stats["floors"])
+	assert.EqualValues(t, before["holes"].(float64)+1, stats["holes"])
+	assert.EqualValues(t, before["likes_received"].(float64)+1, stats["likes_received"])
+	assert.EqualValues(t, before["favorites_received"].(float64)+1, stats["favorites_received"])
+	assert.EqualValues(t, 1, stats["streak"])
+
+	testAPI(t, "put", "/api/floors/"+strconv.Itoa(floor.ID), 200, Map{"like": "cancel"})
+	testAPI(t, "delete", "/api/user/favorites", 200, Map{"hole_id": hole.ID})
+	stats = testAPI(t, "get", "/api/users/me/stats", 200)
+	assert.EqualValues(t, before["likes_received"], stats["likes_received"])
+	assert.EqualValues(t, before["favorites_received"], stats["favorites_received"])
+
+	// streaks are broken by a day without posts
+	twoDaysAgo := StartOfDay(time.Now()).AddDate(0, 0, -2)
+	assert.EqualValues(t, 0, (&UserStats{Streak: 3, LastPostDate: &twoDaysAgo}).CurrentStreak(time.Now()))
+}
+
+func TestBadges(t *testing.T) {
+	DB.Create(&UserStats{UserID: 4270, Floors: 1})
+	badges, err := AwardBadges(DB, 4270, time.Time{}, BadgeEventPost)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{BadgeFirstPost}, badges)
+	badges, err = AwardBadges(DB, 4270, time.Now().AddDate(-2, 0, 0), BadgeEventVisit)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{BadgeYearOne}, badges)
+	badges, err = AwardBadges(DB, 4270, time.Time{}, BadgeEventPost) // awarded once
+	assert.Nil(t, err)
+	assert.Empty(t, badges)
+
+	_, err = AwardBadges(DB, 1, time.Time{}, BadgeEventPost)
+	assert.Nil(t, err)
+	testAPI(t, "put", "/api/users/me/badges", 400, Map{"shown": []string{BadgeHelpfulReporter}}) // not awarded
+	testCommon(t, "put", "/api/users/me/badges", 200, Map{"shown": []string{BadgeFirstPost}})
+	var list []BadgeResponse
+	err = json.Unmarshal(testCommon(t, "get", "/api/users/me/badges", 200), &list)
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(BadgeDefinitions), len(list))
+	assert.True(t, list[0].Awarded && list[0].Shown)
+
+	hole := Hole{DivisionID: 1, UserID: 1}
+	DB.Create(&hole)
+	floor := Floor{HoleID: hole.ID, UserID: 1, Content: "TestBadges"}
+	DB.Create(&floor)
+	var getFloor Floor
+	testAPIModel(t, "get", "/api/floors/"+strconv.Itoa(floor.ID), 200, &getFloor)
+	assert.EqualValues(t, []string{BadgeFirstPost}, getFloor.Badges)
+
+	testCommon(t, "put", "/api/users/me/badges", 200, Map{"shown": []string{}})
+	testAPIModel(t, "get", "/api/floors/"+strconv.Itoa(floor.ID), 200, &getFloor)
+	assert.Empty(t, getFloor.Badges)
+}
+
+func TestCheckin(t *testing.T) {
+	data := testAPI(t, "post", "/api/users/me/checkin", 200)
+	assert.EqualValues(t, true, data["checked_in"])
+	assert.EqualValues(t, 1, data["checkin_streak"])
+	data = testAPI(t, "post", "/api/users/me/checkin", 200)
+	assert.EqualValues(t, false, data["checked_in"])
+	assert.EqualValues(t, 1, data["checkin_streak"])
+	stats := testAPI(t, "get", "/api/users/me/stats", 200)
+	assert.EqualValues(t, 1, stats["longest_checkin_streak"])
+
+	now := time.Now()
+	for i, checkin := range []struct {
+		day     time.Time
+		streak  int
+		longest int
+	}{
+		{now.AddDate(0, 0, -1), 1, 1},
+		{now, 2, 2},
+		{now.AddDate(0, 0, 3), 1, 2},
+	} {
+		checkedIn, stats, err := UserCheckin(4280, checkin.day)
+		assert.Nil(t, err)
+		assert.True(t, checkedIn, i)
+		assert.EqualValues(t, checkin.streak, stats.CheckinStreak, i)
+		assert.EqualValues(t, checkin.longest, stats.LongestCheckinStreak, i)
+	}
+}
+
+func TestAuditIdentities(t *testing.T) {
+	hole := Hole{DivisionID: 1, UserID: 4650, Floors: Floors{
+		{Content: "audit", UserID: 4650, Anonyname: "Alice", Ranking: 0},
+		{Content: "reply", UserID: 4651, Anonyname: "Bob", Ranking: 1},
+		{Content: "again", UserID: 4650, Anonyname: "Alice", Ranking: 2},
+	}}
+	DB.Create(&hole)
+	justification := "公安机关调查函 2026-001 号"
+
+	testAPI(t, "post", "/api/identities/_audit", 400, Map{"hole_id": hole.ID})
+	testAPI(t, "post", "/api/identities/_audit", 400,
+		Map{"hole_id": hole.ID, "floor_id": hole.Floors[1].ID, "justification": justification})
+
+	var response struct {
+		HoleID     int `json:"hole_id"`
+		Identities []struct {
+			UserID    int    `json:"user_id"`
+			Anonyname string `json:"anonyname"`
+			IsOwner   bool   `json:"is_owner"`
+			FloorIDs  []int  `json:"floor_ids"`
+		} `json:"identities"`
+	}
+	err := json.Unmarshal(testCommon(t, "post", "/api/identities/_audit", 200,
+		Map{"hole_id": hole.ID, "justification": justification}), &response)
+	assert.Nil(t, err)
+	if assert.Len(t, response.Identities, 2) {
+		assert.Equal(t, 4650, response.Identities[0].UserID)
+		assert.True(t, response.Identities[0].IsOwner)
+		assert.Equal(t, []int{hole.Floors[0].ID, hole.Floors[2].ID}, response.Identities[0].FloorIDs)
+		assert.Equal(t, "Bob", response.Identities[1].Anonyname)
+	}
+
+	err = json.Unmarshal(testCommon(t, "post", "/api/identities/_audit", 200,
+		Map{"floor_id": hole.Floors[1].ID, "justification": justification}), &response)
+	assert.Nil(t, err)
+	assert.Equal(t, hole.ID, response.HoleID)
+	if assert.Len(t, response.Identities, 1) {
+		assert.Equal(t, 4651, response.Identities[0].UserID)
+		assert.False(t, response.Identities[0].IsOwner)
+	}
+
+	// accesses are logged with the justification
+	var count int64
+	DB.Model(&AdminLog{}).Where("type = ?", AdminLogTypeIdentityAudit).Count(&count)
+	assert.EqualValues(t, 2, count)
+}
+
+func TestLegalHold(t *testing.T) {
+	const userID = 4660
+	config.Config.PurgedUserID = 4661
+	defer func() { config.Config.PurgedUserID = 0 }()
+
+	held := Hole{DivisionID: 1, UserID: userID, Floors: Floors{{Content: "held", UserID: userID, Anonyname: "Alice"}}}
+	DB.Create(&held)
+	DB.Create(&AnonynameMapping{HoleID: held.ID, UserID: userID, Anonyname: "Alice"})
+	other := Hole{DivisionID: 1, UserID: userID, Floors: Floors{
+		{Content: "other", UserID: userID, Ranking: 0},
+		{Content: "held floor", UserID: 1, Ranking: 1},
+	}}
+	DB.Create(&other)
+
+	testAPI(t, "put", "/api/holes/"+strconv.Itoa(held.ID)+"/_legal_hold", 400, Map{"reason": "调查函"})
+	data := testAPI(t, "put", "/api/holes/"+strconv.Itoa(held.ID)+"/_legal_hold", 200, Map{"hold": true, "reason": "调查函"})
+	assert.Equal(t, true, data["legal_hold"])
+	floorRoute := "/api/floors/" + strconv.Itoa(other.Floors[1].ID)
+	data = testAPI(t, "put", floorRoute+"/_legal_hold", 200, Map{"hold": true, "reason": "调查函"})
+	assert.Equal(t, true, data["legal_hold"])
+
+	// authors can't delete held floors
+	data = testAPI(t, "delete", floorRoute, 403, Map{"reason": "delete"})
+	assert.EqualValues(t, utils.ErrCodeLegalHold, data["code"])
+
+	// held contents are kept by user purges, floors not held in a hole with held floors are purged
+	data = testAPI(t, "post", "/api/users/"+strconv.Itoa(userID)+"/_purge", 200, Map{"mode": "delete"})
+	counts := data["counts"].(Map)
+	assert.EqualValues(t, 0, counts["holes"])
+	assert.EqualValues(t, 1, counts["floors"])
+	assert.EqualValues(t, 0, counts["anonyname_mapping"])
+	var floor Floor
+	DB.First(&floor, held.Floors[0].ID)
+	assert.Equal(t, userID, floor.UserID)
+	assert.Equal(t, "held", floor.Content)
+
+	// released
+	testAPI(t, "put", "/api/holes/"+strconv.Itoa(held.ID)+"/_legal_hold", 200, Map{"hold": false, "reason": "结案"})
+	data = testAPI(t, "post", "/api/users/"+strconv.Itoa(userID)+"/_purge", 200, Map{"mode": "delete"})
+	assert.EqualValues(t, 1, data["counts"].(Map)["holes"])
+
+	var count int64
+	DB.Model(&AdminLog{}).Where("type = ?", AdminLogTypeLegalHold).Count(&count)
+	assert.EqualValues(t, 3, count)
+}
@@ -117,3 +117,33 @@ func testAPIModelWithQuery[T Models](t *testing.T, method string, route string,
 	err := json.Unmarshal(responseBytes, obj)
 	assert.Nilf(t, err, "unmarshal response")
 }
+
+// apiTestCase is a request and the expected status code, see runAPITests
+type apiTestCase struct {
+	name       string
+	method     string
+	route      string
+	body       Map
+	statusCode int
+	// checks the response body, optional
+	check func(t *testing.T, body []byte)
+}
+
+// runAPITests runs table-driven API tests in order as subtests, later cases may depend on earlier ones
+func runAPITests(t *testing.T, cases []apiTestCase) {
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			body := testCommon(t, c.method, c.route, c.statusCode, c.body)
+			if c.check != nil {
+				c.check(t, body)
+			}
+		})
+	}
+}
+
+// decodeBody decodes the response body of a case
+func decodeBody[T any](t *testing.T, body []byte) T {
+	var data T
+	assert.Nilf(t, json.Unmarshal(body, &data), "decode response")
+	return data
+}
@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	. "treehole_next/models"
+	"treehole_next/utils"
+)
+
+func TestWebhook(t *testing.T) {
+	const secret = "webhook-test-secret"
+	var healthy atomic.Bool
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := io.ReadAll(r.Body)
+		assert.Equal(t, SignWebhookPayload(secret, payload), r.Header.Get("X-Treehole-Signature"))
+		assert.Equal(t, WebhookEventReportCreated, r.Header.Get("X-Treehole-Event"))
+		received.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	testAPI(t, "post", "/api/webhooks", 400, Map{"url": server.URL, "secret": secret, "events": []string{"floor.created"}})
+	webhook := testAPI(t, "post", "/api/webhooks", 201, Map{
+		"url":    server.URL,
+		"secret": secret,
+		"events": []string{WebhookEventReportCreated},
+	})
+	assert.Nil(t, webhook["secret"])
+	webhookURL := "/api/webhooks/" + strconv.Itoa(int(webhook["id"].(float64)))
+	defer testAPI(t, "delete", webhookURL, 204)
+
+	testAPI(t, "post", "/api/reports", 204, Map{"floor_id": REPORT_FLOOR_BASE_ID + 15, "reason": "webhook"})
+	assert.True(t, utils.WaitBackground(5*time.Second))
+	assert.EqualValues(t, 1, received.Load())
+
+	deliveries := testAPIArray(t, "get", webhookURL+"/deliveries", 200)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, false, deliveries[0]["success"])
+	assert.EqualValues(t, 500, deliveries[0]["status_code"])
+	assert.NotNil(t, deliveries[0]["next_attempt_at"])
+
+	// retry when due
+	healthy.Store(true)
+	DB.Model(&WebhookDelivery{}).Where("id = ?", deliveries[0]["id"]).Update("next_attempt_at", time.Now())
+	n, err := RetryWebhookDeliveries(100)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.EqualValues(t, 2, received.Load())
+
+	deliveries = testAPIArray(t, "get", webhookURL+"/deliveries", 200)
+	assert.Equal(t, true, deliveries[0]["success"])
+	assert.EqualValues(t, 2, deliveries[0]["attempts"])
+	assert.Nil(t, deliveries[0]["next_attempt_at"])
+
+	// disabled webhooks receive nothing
+	testAPI(t, "put", webhookURL, 200, Map{"enabled": false})
+	testAPI(t, "post", "/api/reports", 204, Map{"floor_id": REPORT_FLOOR_BASE_ID + 16, "reason": "webhook"})
+	assert.True(t, utils.WaitBackground(5*time.Second))
+	assert.EqualValues(t, 2, received.Load())
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"errors"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var background sync.WaitGroup
+
+// held for reading by background writers, for writing by QuiesceWriters
+var quiesce sync.RWMutex
+
+// Go runs fn in a goroutine which is waited for on shutdown, e.g. indexing floors in search engine.
+// fn waits while writers are quiesced, a panic of fn is logged instead of crashing the process
+func Go(fn func()) {
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Error().Any("panic", r).Bytes("stack", debug.Stack()).Msg("background task panicked")
+			}
+		}()
+		quiesce.RLock()
+		defer quiesce.RUnlock()
+		fn()
+	}()
+}
+
+// TryBackgroundWrite runs fn unless writers are quiesced, for periodic writers which retry later, e.g. hole views
+func TryBackgroundWrite(fn func()) bool {
+	if !quiesce.TryRLock() {
+		return false
+	}
+	defer quiesce.RUnlock()
+	fn()
+	return true
+}
+
+// QuiesceWriters waits for running background writers and blocks new ones until resume is called,
+// e.g. to take a consistent backup. It fails if writers are still running after timeout
+func QuiesceWriters(timeout time.Duration) (resume func(), err error) {
+	acquired := make(chan struct{})
+	go func() {
+		quiesce.Lock()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		return sync.OnceFunc(quiesce.Unlock), nil
+	case <-time.After(timeout):
+		// release the lock once the running writers finish
+		go func() {
+			<-acquired
+			quiesce.Unlock()
+		}()
+		return nil, errors.New("background writers not finished before timeout")
+	}
+}
+
+// WaitBackground waits for goroutines started by Go, returns false on timeout
+func WaitBackground(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
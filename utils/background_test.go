@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuiesceWriters(t *testing.T) {
+	// a running writer delays quiescing
+	release := make(chan struct{})
+	Go(func() { <-release })
+	time.Sleep(10 * time.Millisecond)
+	_, err := QuiesceWriters(10 * time.Millisecond)
+	assert.Error(t, err)
+	close(release)
+	assert.True(t, WaitBackground(time.Second))
+
+	resume, err := QuiesceWriters(time.Second)
+	assert.NoError(t, err)
+	assert.False(t, TryBackgroundWrite(func() {}))
+
+	// writers started while quiesced wait for resume
+	written := make(chan struct{})
+	Go(func() { close(written) })
+	select {
+	case <-written:
+		t.Fatal("writer not quiesced")
+	case <-time.After(10 * time.Millisecond):
+	}
+	resume()
+	resume()
+	<-written
+	assert.True(t, TryBackgroundWrite(func() {}))
+}
+
+func TestGoRecovers(t *testing.T) {
+	Go(func() { panic("background") })
+	assert.True(t, WaitBackground(time.Second))
+	// the lock of quiesce is released
+	assert.True(t, TryBackgroundWrite(func() {}))
+}
+
+func TestWaitBackground(t *testing.T) {
+	release := make(chan struct{})
+	done := false
+	Go(func() {
+		<-release
+		done = true
+	})
+	assert.False(t, WaitBackground(10*time.Millisecond))
+	close(release)
+	assert.True(t, WaitBackground(time.Second))
+	// the task finished before WaitBackground returns
+	assert.True(t, done)
+}
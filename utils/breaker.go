@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+
+	"treehole_next/config"
+)
+
+// states of a Breaker, also the values of its gauge
+const (
+	BreakerClosed = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+var ErrBreakerOpen = errors.New("circuit breaker open")
+
+// breakerState is the state of the breaker of each dependency, 0 closed, 1 open, 2 half open
+var breakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "treehole_circuit_breaker_state",
+	Help: "State of the circuit breaker of each external dependency, 0 closed, 1 open, 2 half open.",
+}, []string{"dependency"})
+
+// breakerCalls counts calls through breakers by result: success, failure and rejected
+var breakerCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "treehole_circuit_breaker_calls_total",
+	Help: "Calls to external dependencies through circuit breakers by result.",
+}, []string{"dependency", "result"})
+
+// Breaker fails fast calls to an external dependency after BREAKER_FAILURE_THRESHOLD consecutive failures.
+// After BREAKER_COOLDOWN a single trial call is let through, which closes the breaker on success
+// or opens it again on failure.
+type Breaker struct {
+	name     string
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+}
+
+func NewBreaker(name string) *Breaker {
+	breakerState.WithLabelValues(name).Set(BreakerClosed)
+	return &Breaker{name: name}
+}
+
+func (b *Breaker) State() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Do calls fn if the breaker allows, returns ErrBreakerOpen otherwise
+func (b *Breaker) Do(fn func() error) error {
+	if !b.allow() {
+		breakerCalls.WithLabelValues(b.name, "rejected").Inc()
+		return ErrBreakerOpen
+	}
+	err := fn()
+	b.done(err)
+	return err
+}
+
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < config.Config.BreakerCooldown {
+			return false
+		}
+		b.setState(BreakerHalfOpen)
+		return true
+	case BreakerHalfOpen:
+		// the trial call is in flight
+		return false
+	default:
+		return true
+	}
+}
+
+func (b *Breaker) done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		breakerCalls.WithLabelValues(b.name, "success").Inc()
+		b.failures = 0
+		if b.state != BreakerClosed {
+			log.Info().Str("dependency", b.name).Msg("circuit breaker closed")
+			b.setState(BreakerClosed)
+		}
+		return
+	}
+
+	breakerCalls.WithLabelValues(b.name, "failure").Inc()
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= config.Config.BreakerFailureThreshold {
+		if b.state != BreakerOpen {
+			log.Warn().Err(err).Str("dependency", b.name).Int("failures", b.failures).Msg("circuit breaker open")
+		}
+		b.openedAt = time.Now()
+		b.setState(BreakerOpen)
+	}
+}
+
+func (b *Breaker) setState(state int) {
+	b.state = state
+	breakerState.WithLabelValues(b.name).Set(float64(state))
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"treehole_next/config"
+)
+
+func TestBreaker(t *testing.T) {
+	saved := config.Config
+	defer func() { config.Config = saved }()
+	config.Config.BreakerFailureThreshold = 2
+	config.Config.BreakerCooldown = 50 * time.Millisecond
+
+	breaker := NewBreaker("test")
+	failure := errors.New("unavailable")
+	calls := 0
+	fail := func() error { calls++; return failure }
+	succeed := func() error { calls++; return nil }
+
+	// failures below the threshold are returned as is
+	assert.ErrorIs(t, breaker.Do(fail), failure)
+	assert.Equal(t, BreakerClosed, breaker.State())
+	assert.ErrorIs(t, breaker.Do(fail), failure)
+	assert.Equal(t, BreakerOpen, breaker.State())
+	assert.Equal(t, float64(BreakerOpen), testutil.ToFloat64(breakerState.WithLabelValues("test")))
+
+	// open breaker fails fast
+	assert.ErrorIs(t, breaker.Do(succeed), ErrBreakerOpen)
+	assert.Equal(t, 2, calls)
+
+	// a failed trial opens it again
+	time.Sleep(config.Config.BreakerCooldown)
+	assert.ErrorIs(t, breaker.Do(fail), failure)
+	assert.Equal(t, BreakerOpen, breaker.State())
+	assert.ErrorIs(t, breaker.Do(succeed), ErrBreakerOpen)
+
+	// a successful trial closes it
+	time.Sleep(config.Config.BreakerCooldown)
+	assert.NoError(t, breaker.Do(succeed))
+	assert.Equal(t, BreakerClosed, breaker.State())
+	assert.Equal(t, float64(BreakerClosed), testutil.ToFloat64(breakerState.WithLabelValues("test")))
+	assert.Equal(t, 4, calls)
+}
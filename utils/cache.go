@@ -2,6 +2,9 @@ package utils
 
 import (
 	"context"
+	"crypto/tls"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/eko/gocache/lib/v4/cache"
@@ -11,17 +14,25 @@ import (
 	"github.com/goccy/go-json"
 	gocache "github.com/patrickmn/go-cache"
 	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
 
 	"treehole_next/config"
 )
 
 var Cache *cache.Cache[[]byte]
 
+var redisClient redis.UniversalClient
+
 func InitCache() {
-	if config.Config.RedisURL != "" {
-		redisStore := redis_store.NewRedis(redis.NewClient(&redis.Options{
-			Addr: config.Config.RedisURL,
-		}))
+	initLocalCache()
+	if config.Config.RedisURL != "" || len(config.Config.RedisAddrs) > 0 {
+		var err error
+		redisClient, err = newRedisClient()
+		if err != nil {
+			log.Fatal().Err(err).Msg("invalid redis config")
+		}
+		redisClient.AddHook(redisTracingHook{})
+		redisStore := redis_store.NewRedis(redisClient)
 		Cache = cache.New[[]byte](redisStore)
 	} else {
 		gocacheStore := gocache_store.NewGoCache(gocache.New(5*time.Minute, 10*time.Minute))
@@ -29,6 +40,91 @@ func InitCache() {
 	}
 }
 
+// newRedisClient connects to redis sentinel, cluster or a single node
+func newRedisClient() (redis.UniversalClient, error) {
+	var tlsConfig *tls.Config
+	if config.Config.RedisTLS {
+		tlsConfig = &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: config.Config.RedisTLSInsecure,
+		}
+	}
+
+	switch {
+	case config.Config.RedisSentinelMaster != "":
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       config.Config.RedisSentinelMaster,
+			SentinelAddrs:    config.Config.RedisAddrs,
+			SentinelUsername: config.Config.RedisUsername,
+			SentinelPassword: config.Config.RedisPassword,
+			Username:         config.Config.RedisUsername,
+			Password:         config.Config.RedisPassword,
+			TLSConfig:        tlsConfig,
+		}), nil
+	case len(config.Config.RedisAddrs) > 0:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     config.Config.RedisAddrs,
+			Username:  config.Config.RedisUsername,
+			Password:  config.Config.RedisPassword,
+			TLSConfig: tlsConfig,
+		}), nil
+	case strings.Contains(config.Config.RedisURL, "://"):
+		options, err := redis.ParseURL(config.Config.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+		if options.TLSConfig != nil {
+			// rediss://
+			options.TLSConfig.InsecureSkipVerify = config.Config.RedisTLSInsecure
+		} else {
+			options.TLSConfig = tlsConfig
+		}
+		if config.Config.RedisPassword != "" {
+			options.Username = config.Config.RedisUsername
+			options.Password = config.Config.RedisPassword
+		}
+		return redis.NewClient(options), nil
+	default:
+		return redis.NewClient(&redis.Options{
+			Addr:      config.Config.RedisURL,
+			Username:  config.Config.RedisUsername,
+			Password:  config.Config.RedisPassword,
+			TLSConfig: tlsConfig,
+		}), nil
+	}
+}
+
+// PingCache pings redis, returns nil if redis is not configured
+func PingCache(ctx context.Context) error {
+	if redisClient == nil {
+		return nil
+	}
+	return redisClient.Ping(ctx).Err()
+}
+
+// CloseCache closes the redis connections
+func CloseCache() error {
+	if redisClient == nil {
+		return nil
+	}
+	return redisClient.Close()
+}
+
+// Redis returns the redis client for data structures other than cache, e.g. queues,
+// nil if redis is not configured. Keys should be prefixed with CacheKey.
+func Redis() redis.UniversalClient {
+	return redisClient
+}
+
+// CacheKey prefixes key with CACHE_KEY_PREFIX
+func CacheKey(key string) string {
+	return cacheKey(key)
+}
+
+func cacheKey(key string) string {
+	return config.Config.CacheKeyPrefix + key
+}
+
 const maxDuration time.Duration = 1<<63 - 1
 
 func SetCache(key string, value any, expiration time.Duration) error {
@@ -39,11 +135,38 @@ func SetCache(key string, value any, expiration time.Duration) error {
 	if expiration == 0 {
 		expiration = maxDuration
 	}
-	return Cache.Set(context.Background(), key, data, store.WithExpiration(expiration))
+	return Cache.Set(context.Background(), cacheKey(key), data, store.WithExpiration(expiration))
+}
+
+// setCacheNXLock serializes SetCacheNX without redis
+var setCacheNXLock sync.Mutex
+
+// SetCacheNX sets the value only if the key doesn't exist, returns true if set.
+// It is atomic across instances with redis, and within the process otherwise, e.g. for rate limits
+func SetCacheNX(key string, value any, expiration time.Duration) (bool, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	ctx := context.Background()
+	if redisClient != nil {
+		return redisClient.SetNX(ctx, cacheKey(key), data, expiration).Result()
+	}
+
+	setCacheNXLock.Lock()
+	defer setCacheNXLock.Unlock()
+	_, err = Cache.Get(ctx, cacheKey(key))
+	if err == nil {
+		return false, nil
+	}
+	if expiration == 0 {
+		expiration = maxDuration
+	}
+	return true, Cache.Set(ctx, cacheKey(key), data, store.WithExpiration(expiration))
 }
 
 func GetCache(key string, value any) bool {
-	data, err := Cache.Get(context.Background(), key)
+	data, err := Cache.Get(context.Background(), cacheKey(key))
 	if err != nil {
 		return false
 	}
@@ -52,7 +175,7 @@ func GetCache(key string, value any) bool {
 }
 
 func DeleteCache(key string) error {
-	err := Cache.Delete(context.Background(), key)
+	err := Cache.Delete(context.Background(), cacheKey(key))
 	if err == nil {
 		return nil
 	}
@@ -61,3 +184,83 @@ func DeleteCache(key string) error {
 	}
 	return err
 }
+
+// GetCaches gets raw values of keys in a single round trip, nil for keys not found, see GetCache
+func GetCaches(keys []string) [][]byte {
+	ctx := context.Background()
+	values := make([][]byte, len(keys))
+	if redisClient == nil {
+		for i, key := range keys {
+			data, err := Cache.Get(ctx, cacheKey(key))
+			if err == nil {
+				values[i] = data
+			}
+		}
+		return values
+	}
+
+	prefixed := make([]string, 0, len(keys))
+	for _, key := range keys {
+		prefixed = append(prefixed, cacheKey(key))
+	}
+	if _, ok := redisClient.(*redis.ClusterClient); !ok {
+		results, err := redisClient.MGet(ctx, prefixed...).Result()
+		if err != nil {
+			return values
+		}
+		for i, result := range results {
+			if data, ok := result.(string); ok {
+				values[i] = []byte(data)
+			}
+		}
+		return values
+	}
+
+	// MGET is not allowed across slots of a cluster
+	cmds, _ := redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range prefixed {
+			pipe.Get(ctx, key)
+		}
+		return nil
+	})
+	for i, cmd := range cmds {
+		data, err := cmd.(*redis.StringCmd).Bytes()
+		if err == nil {
+			values[i] = data
+		}
+	}
+	return values
+}
+
+// SetCaches sets values keyed by keys in a single round trip, see SetCache
+func SetCaches(values map[string]any, expiration time.Duration) error {
+	ctx := context.Background()
+	data := make(map[string][]byte, len(values))
+	for key, value := range values {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		data[cacheKey(key)] = encoded
+	}
+	if redisClient == nil {
+		if expiration == 0 {
+			expiration = maxDuration
+		}
+		for key, encoded := range data {
+			err := Cache.Set(ctx, key, encoded, store.WithExpiration(expiration))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	_, err := redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, encoded := range data {
+			pipe.Set(ctx, key, encoded, expiration)
+		}
+		return nil
+	})
+	return err
+}
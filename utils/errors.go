@@ -1,5 +1,284 @@
 package utils
 
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"gorm.io/gorm"
+)
+
+// Error codes are the status code followed by 3 digits, clients branch on codes or keys instead of messages.
+// Codes are part of the API, only append to the lists.
+const (
+	ErrCodeValidation = iota + 400001
+	ErrCodeInvalidRequest
+	ErrCodeContentTooLong
+	ErrCodeTagsRequired
+	ErrCodeUnhideNotAllowed
+	ErrCodeInvalidLikeOption
+	ErrCodeNotFloorHistory
+	ErrCodeContentNotTranslatable
+	ErrCodeTooFewTags
+	ErrCodeTooManyTags
+	ErrCodeRequiredTagsMissing
+	ErrCodeInvalidStatusTransition
+	ErrCodeReportDealt
+	ErrCodeAlreadyVoted
+	ErrCodeFloorNotLikeable
+	ErrCodeBotDisabled
+	ErrCodeBadgeNotAwarded
+	ErrCodeRaffleNotEnded
+	ErrCodeRaffleDrawn
+)
+
+const (
+	ErrCodeInvalidAPIKey = iota + 401001
+	ErrCodeTokenRequired
+	ErrCodeTokenMalformed
+	ErrCodeTokenInvalidSignature
+	ErrCodeTokenExpired
+	ErrCodeTokenNotYetValid
+	ErrCodeTokenWrongAudience
+	ErrCodeInvalidCallbackSignature
+)
+
 const (
 	ErrCodeNotAnsweredQuestions = iota + 403001
+	ErrCodeBannedInDivision
+	ErrCodeBannedFromReport
+	ErrCodeUserBannedFromReport
+	ErrCodeHoleLocked
+	ErrCodeHoleDeleted
+	ErrCodeAdminOnly
+	ErrCodeSpecialTagAdminOnly
+	ErrCodeNotFloorOwner
+	ErrCodeSearchUnavailable
+	ErrCodeDefaultFavoriteGroupUndeletable
+	ErrCodeFavoriteGroupNotEmpty
+	ErrCodeFavoriteGroupLimitExceeded
+	ErrCodeActAsDisabled
+	ErrCodeActAsReadOnly
+	ErrCodeAPIKeyScope
+	ErrCodePermissionDenied
+	ErrCodeDivisionArchived
+	ErrCodeSpamBlocked
+	ErrCodeLinkNotAllowed
+	ErrCodeLinkBlocked
+	ErrCodeNotJuror
+	ErrCodeSavedSearchLimitExceeded
+	ErrCodeEditWindowExpired
+	ErrCodeEditLimitExceeded
+	ErrCodeLegalHold
+)
+
+const (
+	ErrCodeHoleNotFound = iota + 404001
+	ErrCodeDivisionNotFound
+	ErrCodeFavoriteGroupNotFound
+	ErrCodeFloorNotFound
+	ErrCodeAnnualReportNotFound
+)
+
+const (
+	ErrCodeChallengeRequired = iota + 428001
 )
+
+const (
+	ErrCodeBotRateLimited = iota + 429001
+)
+
+var errorKeys = map[int]string{
+	ErrCodeValidation:              "validation_failed",
+	ErrCodeInvalidRequest:          "invalid_request",
+	ErrCodeContentTooLong:          "content_too_long",
+	ErrCodeTagsRequired:            "tags_required",
+	ErrCodeUnhideNotAllowed:        "unhide_not_allowed",
+	ErrCodeInvalidLikeOption:       "invalid_like_option",
+	ErrCodeNotFloorHistory:         "not_floor_history",
+	ErrCodeContentNotTranslatable:  "content_not_translatable",
+	ErrCodeTooFewTags:              "too_few_tags",
+	ErrCodeTooManyTags:             "too_many_tags",
+	ErrCodeRequiredTagsMissing:     "required_tags_missing",
+	ErrCodeInvalidStatusTransition: "invalid_status_transition",
+	ErrCodeReportDealt:             "report_dealt",
+	ErrCodeAlreadyVoted:            "already_voted",
+	ErrCodeFloorNotLikeable:        "floor_not_likeable",
+	ErrCodeBotDisabled:             "bot_disabled",
+	ErrCodeBadgeNotAwarded:         "badge_not_awarded",
+	ErrCodeRaffleNotEnded:          "raffle_not_ended",
+	ErrCodeRaffleDrawn:             "raffle_drawn",
+
+	ErrCodeInvalidAPIKey:            "invalid_api_key",
+	ErrCodeTokenRequired:            "token_required",
+	ErrCodeTokenMalformed:           "token_malformed",
+	ErrCodeTokenInvalidSignature:    "token_invalid_signature",
+	ErrCodeTokenExpired:             "token_expired",
+	ErrCodeTokenNotYetValid:         "token_not_yet_valid",
+	ErrCodeTokenWrongAudience:       "token_wrong_audience",
+	ErrCodeInvalidCallbackSignature: "invalid_callback_signature",
+
+	ErrCodeNotAnsweredQuestions:            "not_answered_questions",
+	ErrCodeBannedInDivision:                "banned_in_division",
+	ErrCodeBannedFromReport:                "banned_from_report",
+	ErrCodeUserBannedFromReport:            "user_banned_from_report",
+	ErrCodeHoleLocked:                      "hole_locked",
+	ErrCodeHoleDeleted:                     "hole_deleted",
+	ErrCodeAdminOnly:                       "admin_only",
+	ErrCodeSpecialTagAdminOnly:             "special_tag_admin_only",
+	ErrCodeNotFloorOwner:                   "not_floor_owner",
+	ErrCodeSearchUnavailable:               "search_unavailable",
+	ErrCodeDefaultFavoriteGroupUndeletable: "default_favorite_group_undeletable",
+	ErrCodeFavoriteGroupNotEmpty:           "favorite_group_not_empty",
+	ErrCodeFavoriteGroupLimitExceeded:      "favorite_group_limit_exceeded",
+	ErrCodeActAsDisabled:                   "act_as_disabled",
+	ErrCodeActAsReadOnly:                   "act_as_read_only",
+	ErrCodeAPIKeyScope:                     "api_key_scope",
+	ErrCodePermissionDenied:                "permission_denied",
+	ErrCodeDivisionArchived:                "division_archived",
+	ErrCodeSpamBlocked:                     "spam_blocked",
+	ErrCodeLinkNotAllowed:                  "link_not_allowed",
+	ErrCodeLinkBlocked:                     "link_blocked",
+	ErrCodeNotJuror:                        "not_juror",
+	ErrCodeSavedSearchLimitExceeded:        "saved_search_limit_exceeded",
+	ErrCodeEditWindowExpired:               "edit_window_expired",
+	ErrCodeEditLimitExceeded:               "edit_limit_exceeded",
+	ErrCodeLegalHold:                       "legal_hold",
+
+	ErrCodeHoleNotFound:          "hole_not_found",
+	ErrCodeDivisionNotFound:      "division_not_found",
+	ErrCodeFavoriteGroupNotFound: "favorite_group_not_found",
+	ErrCodeFloorNotFound:         "floor_not_found",
+	ErrCodeAnnualReportNotFound:  "annual_report_not_found",
+
+	ErrCodeChallengeRequired: "challenge_required",
+
+	ErrCodeBotRateLimited: "bot_rate_limited",
+}
+
+// Error is the error response of all APIs, see ErrorHandler
+type Error struct {
+	// status code, or status code followed by 3 digits, see ErrCodeValidation
+	Code int `json:"code"`
+
+	// machine-readable name of code, like favorite_group_not_found, or bad_request for plain status codes
+	Key string `json:"key"`
+
+	// human-readable message in the language of request
+	Message string `json:"message"`
+
+	// errors of request fields, only for validation errors
+	Fields []FieldError `json:"fields,omitempty"`
+
+	// token of the challenge to solve before retrying, only for ErrCodeChallengeRequired
+	Challenge string `json:"challenge,omitempty"`
+}
+
+type FieldError struct {
+	// json name of the field
+	Field string `json:"field"`
+
+	// validate tag failed, like required or max
+	Tag string `json:"tag"`
+
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// StatusCode is the leading 3 digits of a 6-digit code, 500 if invalid
+func (e *Error) StatusCode() int {
+	code := e.Code
+	if code > 999 {
+		code, _ = strconv.Atoi(strconv.Itoa(code)[:3])
+	}
+	if code < 400 || code >= 600 {
+		return http.StatusInternalServerError
+	}
+	return code
+}
+
+func NewError(code int, message string) *Error {
+	return &Error{Code: code, Key: errorKey(code), Message: message}
+}
+
+func errorKey(code int) string {
+	if key, ok := errorKeys[code]; ok {
+		return key
+	}
+	text := http.StatusText(code)
+	if text == "" {
+		text = http.StatusText(http.StatusInternalServerError)
+	}
+	return strings.ReplaceAll(strings.ToLower(text), " ", "_")
+}
+
+// ToError converts errors of handlers to Error, like common.ErrorHandler does to common.HttpError
+func ToError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return NewError(http.StatusNotFound, err.Error())
+	}
+	// the request runs longer than REQUEST_TIMEOUT, see MiddlewareTimeout
+	if errors.Is(err, context.DeadlineExceeded) {
+		return NewError(http.StatusServiceUnavailable, "请求超时，请稍后重试")
+	}
+
+	var httpError *common.HttpError
+	var fiberError *fiber.Error
+	var detail *common.ErrorDetail
+	var multiError fiber.MultiError
+	switch {
+	case errors.As(err, &httpError):
+		e = NewError(httpError.Code, httpError.Message)
+		if httpError.Detail != nil {
+			e.Fields = fieldErrors(*httpError.Detail)
+		}
+	case errors.As(err, &fiberError):
+		e = NewError(fiberError.Code, fiberError.Message)
+	case errors.As(err, &detail):
+		e = NewError(ErrCodeValidation, detail.Error())
+		e.Fields = fieldErrors(*detail)
+	case errors.As(err, &multiError):
+		messages := make([]string, 0, len(multiError))
+		for _, err := range multiError {
+			messages = append(messages, err.Error())
+		}
+		e = NewError(ErrCodeValidation, strings.Join(messages, "\n"))
+	default:
+		e = NewError(http.StatusInternalServerError, err.Error())
+	}
+	return e
+}
+
+func fieldErrors(detail common.ErrorDetail) []FieldError {
+	fields := make([]FieldError, 0, len(detail))
+	for _, element := range detail {
+		fields = append(fields, FieldError{
+			Field:   element.Field,
+			Tag:     element.Tag,
+			Param:   element.Param,
+			Message: element.Error(),
+		})
+	}
+	return fields
+}
+
+// ErrorHandler responds errors as Error in the language of request, replaces common.ErrorHandler
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	if err == nil {
+		return nil
+	}
+	e := ToError(LocalizeError(c, err))
+	return c.Status(e.StatusCode()).JSON(e)
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestToError(t *testing.T) {
+	e := ToError(fmt.Errorf("wrapped: %w", NewError(ErrCodeHoleLocked, "locked")))
+	assert.Equal(t, ErrCodeHoleLocked, e.Code)
+	assert.Equal(t, "hole_locked", e.Key)
+	assert.Equal(t, 403, e.StatusCode())
+
+	e = ToError(common.NotFound("not found"))
+	assert.Equal(t, 404, e.Code)
+	assert.Equal(t, "not_found", e.Key)
+	assert.Equal(t, "not found", e.Message)
+
+	e = ToError(gorm.ErrRecordNotFound)
+	assert.Equal(t, 404, e.StatusCode())
+
+	e = ToError(fiber.ErrTooManyRequests)
+	assert.Equal(t, "too_many_requests", e.Key)
+
+	e = ToError(fmt.Errorf("query: %w", context.DeadlineExceeded))
+	assert.Equal(t, 503, e.StatusCode())
+	assert.Equal(t, "service_unavailable", e.Key)
+
+	e = ToError(errors.New("boom"))
+	assert.Equal(t, 500, e.StatusCode())
+	assert.Equal(t, "internal_server_error", e.Key)
+
+	assert.Equal(t, 500, (&Error{Code: 200001}).StatusCode())
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gofiber/fiber/v2"
+)
+
+// listings sharing an ETag stamp, see TouchETagStamp
+const (
+	ETagHoles     = "holes"
+	ETagDivisions = "divisions"
+)
+
+func etagStampKey(listing string) string {
+	return "etag_stamp_" + listing
+}
+
+// TouchETagStamp makes ETags of the listing computed before stale.
+// Contents may change without updated_at changed, e.g. hiding a hole or liking a floor,
+// so the stamp is kept in cache and shared by all instances.
+func TouchETagStamp(listing string) error {
+	return SetCache(etagStampKey(listing), time.Now().UnixNano(), 0)
+}
+
+// getETagStamp returns the latest stamp of the listings
+func getETagStamp(listings []string) (stamp int64) {
+	keys := make([]string, 0, len(listings))
+	for _, listing := range listings {
+		keys = append(keys, etagStampKey(listing))
+	}
+	for _, data := range GetCaches(keys) {
+		var value int64
+		if data != nil && json.Unmarshal(data, &value) == nil && value > stamp {
+			stamp = value
+		}
+	}
+	return stamp
+}
+
+// CheckETag sets a weak ETag and Last-Modified computed from the max updated_at of the result set,
+// returns true if the copy of the client is still fresh, then the handler should respond 304.
+// Responses differ between users, e.g. is_me and liked, and between queries, e.g. fields,
+// so user id and query string are parts of ETag. listings are those the response shows, see TouchETagStamp
+func CheckETag(c *fiber.Ctx, userID int, count int, lastModified time.Time, listings ...string) bool {
+	stamp := getETagStamp(listings)
+	if stampTime := time.Unix(0, stamp); stampTime.After(lastModified) {
+		lastModified = stampTime
+	}
+
+	query := crc32.ChecksumIEEE(c.Request().URI().QueryString())
+	etag := fmt.Sprintf(`W/"%x-%x-%x-%x-%x"`, userID, query, count, lastModified.UnixNano(), stamp)
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderLastModified, lastModified.UTC().Format(http.TimeFormat))
+
+	if match := c.Get(fiber.HeaderIfNoneMatch); match != "" {
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if since := c.Get(fiber.HeaderIfModifiedSince); since != "" {
+		sinceTime, err := http.ParseTime(since)
+		return err == nil && !lastModified.Truncate(time.Second).After(sinceTime)
+	}
+	return false
+}
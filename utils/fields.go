@@ -0,0 +1,256 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/goccy/go-json"
+)
+
+// fieldSet is a tree of selected fields, nil means selecting all fields
+type fieldSet map[string]fieldSet
+
+// parseFields parses comma separated fields, nested fields are separated by dots,
+// e.g. "id,tags,floors.first_floor.content"
+func parseFields(fields string) fieldSet {
+	set := fieldSet{}
+	for _, path := range strings.Split(fields, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		current := set
+		names := strings.Split(path, ".")
+		for i, name := range names {
+			next, ok := current[name]
+			if ok && next == nil {
+				// parent field already selected as a whole
+				break
+			}
+			if i == len(names)-1 {
+				current[name] = nil
+				break
+			}
+			if !ok {
+				next = fieldSet{}
+				current[name] = next
+			}
+			current = next
+		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	return set
+}
+
+// project keeps only the selected fields of a json object, or of each object in a json array.
+// data is scanned once and selected values are copied as they are, so that keys keep their order
+// and numbers their precision
+func (set fieldSet) project(data []byte) ([]byte, error) {
+	if set == nil {
+		return data, nil
+	}
+	p := projector{data: data, out: make([]byte, 0, len(data))}
+	err := p.value(set)
+	if err != nil {
+		return nil, err
+	}
+	return p.out, nil
+}
+
+var errInvalidJSON = errors.New("invalid json to project")
+
+// projector copies data to out, skipping fields not selected
+type projector struct {
+	data []byte
+	pos  int
+	out  []byte
+}
+
+func (p *projector) skipSpaces() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// value copies the value at pos, objects and arrays of objects with only the fields of set
+func (p *projector) value(set fieldSet) error {
+	p.skipSpaces()
+	if p.pos >= len(p.data) {
+		return errInvalidJSON
+	}
+	if set != nil {
+		switch p.data[p.pos] {
+		case '{':
+			return p.object(set)
+		case '[':
+			return p.array(set)
+		}
+	}
+	// scalars have no fields to select
+	start := p.pos
+	err := p.skipValue()
+	if err != nil {
+		return err
+	}
+	p.out = append(p.out, p.data[start:p.pos]...)
+	return nil
+}
+
+func (p *projector) object(set fieldSet) error {
+	p.pos++
+	p.out = append(p.out, '{')
+	first := true
+	for i := 0; ; i++ {
+		p.skipSpaces()
+		if p.pos >= len(p.data) {
+			return errInvalidJSON
+		}
+		if p.data[p.pos] == '}' {
+			p.pos++
+			p.out = append(p.out, '}')
+			return nil
+		}
+		if i > 0 {
+			if p.data[p.pos] != ',' {
+				return errInvalidJSON
+			}
+			p.pos++
+			p.skipSpaces()
+		}
+		keyStart := p.pos
+		err := p.skipString()
+		if err != nil {
+			return err
+		}
+		rawKey := p.data[keyStart:p.pos]
+		p.skipSpaces()
+		if p.pos >= len(p.data) || p.data[p.pos] != ':' {
+			return errInvalidJSON
+		}
+		p.pos++
+
+		subset, selected := set.lookup(rawKey)
+		if !selected {
+			err = p.skipValue()
+		} else {
+			if !first {
+				p.out = append(p.out, ',')
+			}
+			first = false
+			p.out = append(p.out, rawKey...)
+			p.out = append(p.out, ':')
+			err = p.value(subset)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (p *projector) array(set fieldSet) error {
+	p.pos++
+	p.out = append(p.out, '[')
+	for i := 0; ; i++ {
+		p.skipSpaces()
+		if p.pos >= len(p.data) {
+			return errInvalidJSON
+		}
+		if p.data[p.pos] == ']' {
+			p.pos++
+			p.out = append(p.out, ']')
+			return nil
+		}
+		if i > 0 {
+			if p.data[p.pos] != ',' {
+				return errInvalidJSON
+			}
+			p.pos++
+			p.out = append(p.out, ',')
+		}
+		err := p.value(set)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// skipString moves pos after the string at pos
+func (p *projector) skipString() error {
+	if p.pos >= len(p.data) || p.data[p.pos] != '"' {
+		return errInvalidJSON
+	}
+	for p.pos++; p.pos < len(p.data); p.pos++ {
+		switch p.data[p.pos] {
+		case '\\':
+			p.pos++
+		case '"':
+			p.pos++
+			return nil
+		}
+	}
+	return errInvalidJSON
+}
+
+// skipValue moves pos after the value at pos
+func (p *projector) skipValue() error {
+	p.skipSpaces()
+	if p.pos >= len(p.data) {
+		return errInvalidJSON
+	}
+	switch p.data[p.pos] {
+	case '"':
+		return p.skipString()
+	case '{', '[':
+		depth := 0
+		for p.pos < len(p.data) {
+			switch p.data[p.pos] {
+			case '"':
+				err := p.skipString()
+				if err != nil {
+					return err
+				}
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					p.pos++
+					return nil
+				}
+			}
+			p.pos++
+		}
+		return errInvalidJSON
+	default:
+		for p.pos < len(p.data) {
+			switch p.data[p.pos] {
+			case ',', '}', ']', ' ', '\t', '\n', '\r':
+				return nil
+			}
+			p.pos++
+		}
+		return nil
+	}
+}
+
+// lookup finds the field of a quoted object key
+func (set fieldSet) lookup(rawKey []byte) (fieldSet, bool) {
+	if bytes.IndexByte(rawKey, '\\') < 0 {
+		// converted without allocation
+		subset, ok := set[string(rawKey[1:len(rawKey)-1])]
+		return subset, ok
+	}
+	var key string
+	_ = json.Unmarshal(rawKey, &key)
+	subset, ok := set[key]
+	return subset, ok
+}
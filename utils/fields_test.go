@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldSetProject(t *testing.T) {
+	data := []byte(`[
+		{"id": 9007199254740993, "tags": [{"id": 1, "name": "a,b"}], "floors": {"first_floor": {"id": 2, "content": "x \"}\" y", "like": 3}}, "view": 1},
+		{"id": 2, "tags": null, "floors": null, "view": 2}
+	]`)
+	projected, err := parseFields("id,tags,floors.first_floor.content").project(data)
+	assert.Nil(t, err)
+	assert.Equal(t,
+		`[{"id":9007199254740993,"tags":[{"id": 1, "name": "a,b"}],"floors":{"first_floor":{"content":"x \"}\" y"}}},{"id":2,"tags":null,"floors":null}]`,
+		string(projected))
+
+	projected, err = parseFields("id").project([]byte(`{"view": 1, "id": 3}`))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"id":3}`, string(projected))
+
+	projected, err = parseFields("unknown").project([]byte(`{"id": 1}`))
+	assert.Nil(t, err)
+	assert.Equal(t, `{}`, string(projected))
+
+	_, err = parseFields("id").project([]byte(`{"id": 1`))
+	assert.NotNil(t, err)
+}
+
+func BenchmarkSerializeFields(b *testing.B) {
+	type floor struct {
+		ID      int    `json:"id"`
+		Content string `json:"content"`
+		Like    int    `json:"like"`
+	}
+	type hole struct {
+		ID     int     `json:"id"`
+		Tags   []int   `json:"tags"`
+		Floors []floor `json:"floors"`
+		View   int     `json:"view"`
+	}
+	holes := make([]hole, 10)
+	for i := range holes {
+		holes[i] = hole{ID: i, Tags: []int{1, 2, 3}, View: i}
+		for j := 0; j < 10; j++ {
+			holes[i].Floors = append(holes[i].Floors, floor{ID: j, Content: strings.Repeat(fmt.Sprint(j), 100)})
+		}
+	}
+	fields := parseFields("id,tags,floors.content")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data, err := json.Marshal(holes)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, err = fields.project(data)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
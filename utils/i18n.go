@@ -0,0 +1,288 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+)
+
+const (
+	LanguageZh = "zh"
+	LanguageEn = "en"
+)
+
+// Languages are offered in order of preference, messages are written in the first one
+var Languages = []string{LanguageZh, LanguageEn}
+
+// messageCatalogs translates messages written in LanguageZh, by language.
+// Keys with %s, %d or %v match formatted messages, whose arguments are filled into translations as %s in order.
+var messageCatalogs = map[string]map[string]string{
+	LanguageEn: {
+		// favourite and subscription
+		"收藏成功":     "Added to favorites",
+		"修改成功":     "Modified",
+		"删除成功":     "Deleted",
+		"关注成功":     "Subscribed",
+		"已屏蔽该洞的通知": "Notifications of the hole muted",
+		"已恢复该洞的通知": "Notifications of the hole unmuted",
+		"收藏夹不存在":   "Favorite group not found",
+		"收藏夹中存在收藏内容，请先移除": "The favorite group is not empty, remove its holes first",
+		"收藏夹数量已达上限":       "Too many favorite groups",
+		"默认收藏夹不可删除":       "The default favorite group cannot be deleted",
+
+		// division, hole and tag
+		"分区不存在":               "Division not found",
+		"受限分区需要指定用户组":         "A restricted division requires a group",
+		"楼层不存在":               "Floor not found",
+		"时间格式错误":              "Malformed time",
+		"统计中，请稍后重试":           "Computing stats, please retry later",
+		"年度报告尚未生成":            "The annual report is not generated yet",
+		"搜索服务未配置":             "Search service is not configured",
+		"同义词由文件配置，请更新文件后重新加载": "Synonyms are configured by the file, update the file and reload",
+		"保存的搜索数量已达上限":         "Too many saved searches",
+		"该楼层已被删除":             "The floor has been deleted",
+		"该楼层不能点赞":             "The floor cannot be liked",
+		"该分区未启用机器人":           "Bots are not enabled in the division",
+		"机器人回复过于频繁，请稍后再试":     "Too many bot replies, please retry later",
+		"折叠或删除需要理由":           "A reason is required to fold or delete",
+		"操作过于频繁，请完成验证后重试":     "Too many requests, please complete the challenge and retry",
+		"回调签名无效":              "Invalid callback signature",
+		"内容疑似垃圾信息，发送失败":       "The content looks like spam and is not sent",
+		"新用户暂时不能发送链接或图片":      "New users can't post links or images yet",
+		"该分区已归档，无法发帖":         "The division is archived, posting is not allowed",
+		"该洞已在目标分区":            "The hole is already in the division",
+		"不能将洞合并到自身":           "A hole cannot be merged into itself",
+		"该洞已被合并":              "The hole has been merged",
+		"不能合并到已隐藏的洞":          "Cannot merge into a hidden hole",
+		"分区状态无法从 %s 变为 %s":    "The status of the division cannot change from %s to %s",
+		"帖子不存在":               "Hole not found",
+		"发表成功":                "Posted",
+		"文本限制 10000 字":        "Content is limited to 10000 characters",
+		"此洞已被删除，您无法修改":        "The hole has been deleted and cannot be modified",
+		"此洞已被锁定，您无法修改":        "The hole is locked and cannot be modified",
+		"该帖子已被锁定，非管理员禁止发帖":    "The hole is locked, only admins can reply",
+		"非管理员禁止修改分区":          "Only admins can change the division",
+		"非管理员禁止修改特殊标签":        "Only admins can change special tags",
+		"非管理员禁止发含有特殊标签的帖":     "Only admins can post with special tags",
+		"非管理员禁止发含有特殊标签的帖子":    "Only admins can post with special tags",
+		"非管理员禁止发含有特殊标签的洞":     "Only admins can post with special tags",
+		"非管理员禁止取消隐藏":          "Only admins can unhide holes",
+		"非管理员禁止折叠":            "Only admins can fold floors",
+		"非管理员禁止锁定帖子":          "Only admins can lock holes",
+		"非管理员禁止隐藏帖子":          "Only admins can hide holes",
+		"非管理员禁止修改标签":          "Only admins can change tags",
+		"仅管理员可操作":             "Admins only",
+		"tags 不能为空":           "Tags are required",
+		"tag 名称长度不能超过 15 个字符": "Tag names are limited to 15 characters",
+		"标签长度不能超过 15 个字符":     "Tag names are limited to 15 characters",
+		"只有管理员才能创建 # 开头的 tag": "Only admins can create tags starting with #",
+		"只有管理员才能创建 @ 开头的 tag": "Only admins can create tags starting with @",
+		"只有管理员才能创建 * 开头的 tag": "Only admins can create tags starting with *",
+		"标签 %s 为管理员专用标签":      "Tag %s is reserved for admins",
+		"学校不存在":               "Tenant not found",
+		"学校标识已存在":             "Tenant key already exists",
+		"不允许使用外部图片链接":         "External image links are not allowed",
+
+		// floor
+		"这不是您的楼层，您没有权限修改":   "You can only modify your own floors",
+		"该楼层已被修改，请刷新后重试":    "The floor has been modified, please refresh and retry",
+		"%v 不是 #%v 的历史版本":   "%s is not a history of #%s",
+		"茶楼流量激增，搜索功能暂缓开放":   "Search is temporarily unavailable due to heavy traffic",
+		"已经被修改":             "Already modified",
+		"翻译功能未开启":           "Translation is disabled",
+		"翻译失败，请稍后再试":        "Translation failed, please retry later",
+		"该内容无法翻译":           "This content cannot be translated",
+		"您在此板块已被禁言":         "You are banned in this division",
+		"您在此板块已被禁言，解封时间：%s": "You are banned in this division until %s",
+
+		// links
+		"内容包含被禁止的链接：%s": "The content contains a blocked link: %s",
+		"该链接已被禁止访问":     "The link is blocked",
+		"链接无效":          "Invalid link",
+		"您即将离开树洞，前往外部网站，请注意账号和财产安全": "You are leaving for an external site, please keep your account and property safe",
+
+		// report, penalty and user
+		"该用户已被限制使用举报功能":         "The user has been banned from reporting",
+		"您已被限制使用举报功能":           "You are banned from reporting",
+		"您已被限制使用举报功能，解封时间：%s":   "You are banned from reporting until %s",
+		"不能清除该用户":               "The user cannot be purged",
+		"未配置 PURGED_USER_ID":    "PURGED_USER_ID is not configured",
+		"请先通过注册答题":              "Please pass the registration quiz first",
+		"每天只能导出一次数据":            "Data can be exported once a day",
+		"数据导出中，完成后将通过站内信发送下载链接": "Exporting, the download link will be sent by message when done",
+		"导出数据不存在或已过期":           "The export does not exist or has expired",
+		"已重新加入推送队列":             "Requeued for pushing",
+		"代理用户功能未开启":             "Acting as users is disabled",
+		"代理用户时只能发送只读请求":         "Only read-only requests are allowed when acting as a user",
+		"X-Act-As 必须为用户 ID":     "X-Act-As must be a user id",
+		"API key 无效或已撤销":        "The API key is invalid or revoked",
+		"API key 无权访问该接口":       "The API key is not allowed to access this API",
+		"未登录":                   "Not logged in",
+		"登录凭证格式错误":              "Malformed token",
+		"登录凭证签名无效":              "Invalid token signature",
+		"登录已过期，请重新登录":           "Token expired, please log in again",
+		"登录凭证尚未生效":              "Token is not valid yet",
+		"登录凭证不适用于本服务":           "Token is issued for another audience",
+		"认证服务暂时不可用":             "The auth service is temporarily unavailable",
+		"无权进行此操作":               "You are not allowed to do this",
+		"该分区至少需要 %d 个标签":        "At least %s tags are required in this division",
+		"该分区最多只能有 %d 个标签":       "At most %s tags are allowed in this division",
+		"该分区的洞必须包含标签：%s":        "Holes in this division must have tags: %s",
+		"最少标签数不能大于最多标签数":        "min_tags should not be greater than max_tags",
+		"请填写举报理由":               "Please fill in the reason of the report",
+		"处理结果不存在":               "The outcome does not exist",
+		"您暂时不能参与众裁":             "You can't join the community review yet",
+		"该举报已处理":                "The report has been dealt",
+		"您已对该举报投票":              "You have voted on the report",
+		"只能申诉自己的楼层":             "You can only appeal your own floors",
+		"该楼层未被删除或处罚，无需申诉":       "The floor is not deleted or punished",
+		"该楼层已有待处理的申诉":           "The floor has a pending appeal",
+		"该申诉已处理":                "The appeal has been handled",
+
+		// batch and requests
+		"无效请求":                      "Invalid request",
+		"不允许嵌套批量请求":                 "Nested batch requests are not allowed",
+		"一次最多请求 %d 个接口":             "At most %s requests in a batch",
+		"Idempotency-Key 已用于不同的请求":  "Idempotency-Key has been used by a different request",
+		"Idempotency-Key 长度不能超过 %d": "Idempotency-Key is limited to %s characters",
+		"相同的请求正在处理中，请稍后重试":          "The same request is in progress, please retry later",
+	},
+}
+
+// messagePattern matches messages formatted from a catalog key with arguments
+type messagePattern struct {
+	re          *regexp.Regexp
+	translation string
+}
+
+var (
+	reFormatVerb    = regexp.MustCompile(`%[sdv]`)
+	messagePatterns = compileMessagePatterns()
+)
+
+func compileMessagePatterns() map[string][]messagePattern {
+	patterns := make(map[string][]messagePattern, len(messageCatalogs))
+	for language, catalog := range messageCatalogs {
+		for key, translation := range catalog {
+			if !reFormatVerb.MatchString(key) {
+				continue
+			}
+			quoted := regexp.QuoteMeta(key)
+			re := regexp.MustCompile("^" + reFormatVerb.ReplaceAllString(quoted, "(.+?)") + "$")
+			patterns[language] = append(patterns[language], messagePattern{re: re, translation: translation})
+		}
+	}
+	return patterns
+}
+
+// Language returns the language of response by Accept-Language, LanguageZh if not accepted
+func Language(c *fiber.Ctx) string {
+	language := c.AcceptsLanguages(Languages...)
+	if language == "" {
+		return LanguageZh
+	}
+	return language
+}
+
+// Translate returns message in language, unchanged if not in the catalog
+func Translate(language, message string) string {
+	catalog, ok := messageCatalogs[language]
+	if !ok {
+		return message
+	}
+	if translation, ok := catalog[message]; ok {
+		return translation
+	}
+	for _, pattern := range messagePatterns[language] {
+		matches := pattern.re.FindStringSubmatch(message)
+		if matches == nil {
+			continue
+		}
+		args := make([]any, 0, len(matches)-1)
+		for _, match := range matches[1:] {
+			args = append(args, match)
+		}
+		return fmt.Sprintf(pattern.translation, args...)
+	}
+	return message
+}
+
+// Localize translates message to the language of request, used for Response.Message
+func Localize(c *fiber.Ctx, message string) string {
+	return Translate(Language(c), message)
+}
+
+// LocalizeError translates messages of Error, HttpError and validation errors to the language of request,
+// the original error is not modified since it is logged
+func LocalizeError(c *fiber.Ctx, err error) error {
+	language := Language(c)
+	if language == LanguageZh {
+		return err
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		localized := *e
+		localized.Message = Translate(language, e.Message)
+		localized.Fields = make([]FieldError, 0, len(e.Fields))
+		for _, field := range e.Fields {
+			field.Message = Translate(language, field.Message)
+			localized.Fields = append(localized.Fields, field)
+		}
+		return &localized
+	}
+	var detail *common.ErrorDetail
+	if errors.As(err, &detail) {
+		return localizeErrorDetail(language, *detail)
+	}
+	var httpError *common.HttpError
+	if errors.As(err, &httpError) {
+		localized := *httpError
+		localized.Message = Translate(language, httpError.Message)
+		if httpError.Detail != nil {
+			localized.Detail = localizeErrorDetail(language, *httpError.Detail)
+		}
+		return &localized
+	}
+	return err
+}
+
+func localizeErrorDetail(language string, detail common.ErrorDetail) *common.ErrorDetail {
+	localized := make(common.ErrorDetail, 0, len(detail))
+	for _, element := range detail {
+		localizedElement := *element
+		localizedElement.Message = validationMessage(language, element)
+		localized = append(localized, &localizedElement)
+	}
+	return &localized
+}
+
+// validationMessage is the message of a validation error in language, see common.ErrorDetailElement
+func validationMessage(language string, element *common.ErrorDetailElement) string {
+	if language != LanguageEn {
+		return element.Error()
+	}
+	switch element.Tag {
+	case "min":
+		if element.Kind == reflect.String {
+			return fmt.Sprintf("%s must be at least %s characters", element.Field, element.Param)
+		}
+		return fmt.Sprintf("%s must be at least %s", element.Field, element.Param)
+	case "max":
+		if element.Kind == reflect.String {
+			return fmt.Sprintf("%s must be at most %s characters", element.Field, element.Param)
+		}
+		return fmt.Sprintf("%s must be at most %s", element.Field, element.Param)
+	case "required":
+		return element.Field + " is required"
+	case "email":
+		return "invalid email"
+	default:
+		return "invalid " + strings.ToLower(element.StructField)
+	}
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslate(t *testing.T) {
+	assert.Equal(t, "Division not found", Translate(LanguageEn, "分区不存在"))
+	assert.Equal(t, "分区不存在", Translate(LanguageZh, "分区不存在"))
+	assert.Equal(t, "unknown", Translate(LanguageEn, "unknown"))
+	assert.Equal(t, "Tag #114 is reserved for admins", Translate(LanguageEn, "标签 #114 为管理员专用标签"))
+	assert.Equal(t, "12 is not a history of #34", Translate(LanguageEn, "12 不是 #34 的历史版本"))
+}
+
+func TestErrorHandler(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/error", func(c *fiber.Ctx) error {
+		return common.NotFound("分区不存在")
+	})
+	app.Get("/validate", func(c *fiber.Ctx) error {
+		var body struct {
+			Name string `json:"name" validate:"required"`
+		}
+		return common.ValidateStruct(&body)
+	})
+	app.Get("/success", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"message": Localize(c, "删除成功")})
+	})
+
+	request := func(route, language string) (int, string) {
+		req := httptest.NewRequest("GET", route, nil)
+		if language != "" {
+			req.Header.Set("Accept-Language", language)
+		}
+		res, err := app.Test(req, -1)
+		assert.Nil(t, err)
+		body, err := io.ReadAll(res.Body)
+		assert.Nil(t, err)
+		var data struct {
+			Message string `json:"message"`
+		}
+		assert.Nil(t, json.Unmarshal(body, &data))
+		return res.StatusCode, data.Message
+	}
+
+	status, message := request("/error", "en-US,en;q=0.9")
+	assert.Equal(t, 404, status)
+	assert.Equal(t, "Division not found", message)
+	_, message = request("/error", "zh-CN,zh;q=0.9,en;q=0.8")
+	assert.Equal(t, "分区不存在", message)
+	_, message = request("/error", "")
+	assert.Equal(t, "分区不存在", message)
+
+	status, message = request("/validate", "en")
+	assert.Equal(t, 400, status)
+	assert.Equal(t, "name is required", message)
+	_, message = request("/validate", "")
+	assert.Equal(t, "name不能为空", message)
+
+	_, message = request("/success", "en")
+	assert.Equal(t, "Deleted", message)
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+
+	"treehole_next/config"
+)
+
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+const maxIdempotencyKeyLen = 255
+
+// the pending marker expires soon, in case the server crashes while handling
+const idempotencyPendingExpire = time.Minute
+
+// idempotentResponse is the cached response of a request with Idempotency-Key,
+// Pending is true while the first request is being handled
+type idempotentResponse struct {
+	Pending     bool   `json:"pending"`
+	Fingerprint string `json:"fingerprint"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+}
+
+// MiddlewareIdempotency dedupes retried requests with the same Idempotency-Key header
+// within IDEMPOTENCY_TTL, returns the original response instead of creating again.
+// Requests without the header are not affected.
+func MiddlewareIdempotency(c *fiber.Ctx) error {
+	key := c.Get(HeaderIdempotencyKey)
+	if key == "" {
+		return c.Next()
+	}
+	if len(key) > maxIdempotencyKeyLen {
+		return common.BadRequest(fmt.Sprintf("Idempotency-Key 长度不能超过 %d", maxIdempotencyKeyLen))
+	}
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	cacheKey := fmt.Sprintf("idempotency_%d_%s_%s_%s", userID, c.Method(), c.Path(), key)
+	fingerprint := sha256.Sum256(c.Body())
+	response := idempotentResponse{Pending: true, Fingerprint: hex.EncodeToString(fingerprint[:])}
+
+	var cached idempotentResponse
+	if GetCache(cacheKey, &cached) {
+		if cached.Fingerprint != response.Fingerprint {
+			return &common.HttpError{
+				Code:    fiber.StatusUnprocessableEntity,
+				Message: "Idempotency-Key 已用于不同的请求",
+			}
+		}
+		if cached.Pending {
+			return &common.HttpError{
+				Code:    fiber.StatusConflict,
+				Message: "相同的请求正在处理中，请稍后重试",
+			}
+		}
+		c.Set("Idempotent-Replayed", "true")
+		c.Set(fiber.HeaderContentType, cached.ContentType)
+		return c.Status(cached.Status).Send(cached.Body)
+	}
+
+	err = SetCache(cacheKey, response, idempotencyPendingExpire)
+	if err != nil {
+		return err
+	}
+
+	handled := false
+	defer func() {
+		// only successful responses are replayed, failed requests can be retried
+		if !handled {
+			_ = DeleteCache(cacheKey)
+		}
+	}()
+	err = c.Next()
+	if err != nil || c.Response().StatusCode() >= fiber.StatusBadRequest {
+		return err
+	}
+	handled = true
+
+	response.Pending = false
+	response.Status = c.Response().StatusCode()
+	response.ContentType = string(c.Response().Header.ContentType())
+	response.Body = append([]byte(nil), c.Response().Body()...)
+	_ = SetCache(cacheKey, response, config.Config.IdempotencyTTL)
+	return nil
+}
@@ -0,0 +1,345 @@
+package utils
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/singleflight"
+
+	"treehole_next/config"
+)
+
+// JWTClaims are the claims of a verified token, see VerifyJWT
+type JWTClaims struct {
+	ID        int         `json:"id"`
+	UserID    int         `json:"user_id"`
+	IsAdmin   bool        `json:"is_admin"`
+	Issuer    string      `json:"iss"`
+	Audience  jwtAudience `json:"aud"`
+	ExpiresAt *float64    `json:"exp"`
+	NotBefore *float64    `json:"nbf"`
+}
+
+// GetUserID returns id of the user, both id and user_id are issued by the auth service
+func (claims *JWTClaims) GetUserID() int {
+	if claims.ID != 0 {
+		return claims.ID
+	}
+	return claims.UserID
+}
+
+// jwtAudience is a string or an array of strings
+type jwtAudience []string
+
+func (audience *jwtAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if json.Unmarshal(data, &single) == nil {
+		*audience = jwtAudience{single}
+		return nil
+	}
+	var multiple []string
+	err := json.Unmarshal(data, &multiple)
+	if err != nil {
+		return err
+	}
+	*audience = multiple
+	return nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+var jwtHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+}
+
+func newJWTHash(hash crypto.Hash) hash.Hash {
+	switch hash {
+	case crypto.SHA384:
+		return sha512.New384()
+	case crypto.SHA512:
+		return sha512.New()
+	default:
+		return sha256.New()
+	}
+}
+
+// VerifyJWT verifies signature of token with keys of JWKS_URL, and expiry and audience with JWT_LEEWAY of clock skew.
+// Errors are 401 with codes telling expired, malformed and wrong audience tokens apart.
+func VerifyJWT(ctx context.Context, token string) (*JWTClaims, error) {
+	token = strings.TrimSpace(strings.TrimPrefix(token, "Bearer "))
+	if token == "" {
+		return nil, NewError(ErrCodeTokenRequired, "未登录")
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, NewError(ErrCodeTokenMalformed, "登录凭证格式错误")
+	}
+
+	var header jwtHeader
+	var claims JWTClaims
+	if decodeJWTPart(parts[0], &header) != nil || decodeJWTPart(parts[1], &claims) != nil {
+		return nil, NewError(ErrCodeTokenMalformed, "登录凭证格式错误")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, NewError(ErrCodeTokenMalformed, "登录凭证格式错误")
+	}
+	// alg none and HMAC are never accepted
+	hashType, ok := jwtHashes[header.Alg]
+	if !ok {
+		return nil, NewError(ErrCodeTokenMalformed, "登录凭证格式错误")
+	}
+
+	key, err := jwksKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := newJWTHash(hashType)
+	digest.Write([]byte(parts[0] + "." + parts[1]))
+	if !verifyJWTSignature(key, header.Alg, hashType, digest.Sum(nil), signature) {
+		return nil, NewError(ErrCodeTokenInvalidSignature, "登录凭证签名无效")
+	}
+
+	now := time.Now()
+	leeway := config.Config.JWTLeeway
+	if claims.ExpiresAt == nil || now.After(unixTime(*claims.ExpiresAt).Add(leeway)) {
+		return nil, NewError(ErrCodeTokenExpired, "登录已过期，请重新登录")
+	}
+	if claims.NotBefore != nil && now.Add(leeway).Before(unixTime(*claims.NotBefore)) {
+		return nil, NewError(ErrCodeTokenNotYetValid, "登录凭证尚未生效")
+	}
+	if audience := config.Config.JWTAudience; audience != "" && !containsString(claims.Audience, audience) {
+		return nil, NewError(ErrCodeTokenWrongAudience, "登录凭证不适用于本服务")
+	}
+	if claims.GetUserID() == 0 {
+		return nil, NewError(ErrCodeTokenMalformed, "登录凭证格式错误")
+	}
+	return &claims, nil
+}
+
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func verifyJWTSignature(key crypto.PublicKey, alg string, hashType crypto.Hash, digest, signature []byte) bool {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") && rsa.VerifyPKCS1v15(key, hashType, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(key, digest, r, s)
+	}
+	return false
+}
+
+func unixTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+/* JWKS */
+
+// jwksRefreshInterval limits refreshes on unknown key ids, which happen when the auth service rotates keys,
+// and retries while the auth service is unavailable
+var jwksRefreshInterval = 30 * time.Second
+
+var jwks struct {
+	sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+// jwksRefresh shares a fetch between concurrent refreshes
+var jwksRefresh singleflight.Group
+
+var jwksClient = &http.Client{Timeout: 5 * time.Second}
+
+// jwksKey returns the key of kid, refreshing keys cached for JWKS_CACHE_TTL or when kid is unknown.
+// Expired keys are used while they are refreshed in background, so a slow auth service only delays
+// tokens of unknown key ids. Stale keys are used if the auth service is unavailable.
+func jwksKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	jwks.RLock()
+	key, ok := jwks.keys[kid]
+	fetched := jwks.keys != nil
+	expired := time.Since(jwks.fetchedAt) > config.Config.JWKSCacheTTL
+	throttled := time.Since(jwks.attemptedAt) <= jwksRefreshInterval
+	jwks.RUnlock()
+
+	if ok {
+		if expired && !throttled {
+			jwksRefresh.DoChan("jwks", refreshJWKS)
+		}
+		return key, nil
+	}
+	if throttled {
+		if !fetched {
+			return nil, NewError(http.StatusServiceUnavailable, "认证服务暂时不可用")
+		}
+		return nil, NewError(ErrCodeTokenInvalidSignature, "登录凭证签名无效")
+	}
+
+	select {
+	case result := <-jwksRefresh.DoChan("jwks", refreshJWKS):
+		if result.Err != nil {
+			return nil, NewError(http.StatusServiceUnavailable, "认证服务暂时不可用")
+		}
+		key, ok = result.Val.(map[string]crypto.PublicKey)[kid]
+	case <-ctx.Done():
+		return nil, NewError(http.StatusServiceUnavailable, "认证服务暂时不可用")
+	}
+	if !ok {
+		return nil, NewError(ErrCodeTokenInvalidSignature, "登录凭证签名无效")
+	}
+	return key, nil
+}
+
+// refreshJWKS fetches keys outside the lock of jwks, not canceled with the request that started it
+func refreshJWKS() (any, error) {
+	jwks.Lock()
+	jwks.attemptedAt = time.Now()
+	jwks.Unlock()
+
+	keys, err := fetchJWKS(context.Background())
+	if err != nil {
+		log.Err(err).Str("url", config.Config.JWKSUrl).Msg("failed to fetch jwks")
+		return nil, err
+	}
+	jwks.Lock()
+	jwks.keys = keys
+	jwks.fetchedAt = time.Now()
+	jwks.Unlock()
+	return keys, nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func fetchJWKS(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.Config.JWKSUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := jwksClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks responded %s", res.Status)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&set)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.Warn().Err(err).Str("kid", jwk.Kid).Msg("skip invalid jwk")
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func (jwk *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := func(s string) (*big.Int, error) {
+		data, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(data), nil
+	}
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, errors.New("unsupported key type " + jwk.Kty)
+}
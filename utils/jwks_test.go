@@ -0,0 +1,164 @@
+package utils
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+
+	"treehole_next/config"
+)
+
+func TestVerifyJWT(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	var rotated atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys := []any{jwkOf("old", &oldKey.PublicKey)}
+		if rotated.Load() {
+			keys = []any{jwkOf("new", &newKey.PublicKey)}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	}))
+	defer server.Close()
+
+	saved := config.Config
+	defer func() { config.Config = saved }()
+	config.Config.JWKSUrl = server.URL
+	config.Config.JWKSCacheTTL = time.Hour
+	config.Config.JWTAudience = "treehole"
+	config.Config.JWTLeeway = time.Minute
+	savedInterval := jwksRefreshInterval
+	jwksRefreshInterval = 0
+	defer func() { jwksRefreshInterval = savedInterval }()
+
+	now := time.Now().Unix()
+	claims := map[string]any{"id": 42, "aud": "treehole", "exp": now + 60}
+	errorCode := func(err error) int {
+		if e, ok := err.(*Error); ok {
+			return e.Code
+		}
+		return 0
+	}
+	ctx := context.Background()
+
+	verified, err := VerifyJWT(ctx, "Bearer "+signJWT(oldKey, "old", claims))
+	assert.Nil(t, err)
+	assert.Equal(t, 42, verified.GetUserID())
+
+	// clock skew within leeway
+	_, err = VerifyJWT(ctx, signJWT(oldKey, "old", map[string]any{"id": 42, "aud": []string{"treehole"}, "exp": now - 30}))
+	assert.Nil(t, err)
+
+	_, err = VerifyJWT(ctx, signJWT(oldKey, "old", map[string]any{"id": 42, "aud": "treehole", "exp": now - 120}))
+	assert.Equal(t, ErrCodeTokenExpired, errorCode(err))
+	_, err = VerifyJWT(ctx, signJWT(oldKey, "old", map[string]any{"id": 42, "aud": "auth", "exp": now + 60}))
+	assert.Equal(t, ErrCodeTokenWrongAudience, errorCode(err))
+	_, err = VerifyJWT(ctx, signJWT(newKey, "old", claims))
+	assert.Equal(t, ErrCodeTokenInvalidSignature, errorCode(err))
+	_, err = VerifyJWT(ctx, "not.a-token")
+	assert.Equal(t, ErrCodeTokenMalformed, errorCode(err))
+	_, err = VerifyJWT(ctx, "")
+	assert.Equal(t, ErrCodeTokenRequired, errorCode(err))
+
+	// alg none is rejected
+	token := signJWT(oldKey, "old", claims)
+	parts := strings.Split(token, ".")
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"old"}`))
+	_, err = VerifyJWT(ctx, header+"."+parts[1]+".")
+	assert.Equal(t, ErrCodeTokenMalformed, errorCode(err))
+
+	// keys are refreshed on unknown key id after rotation
+	rotated.Store(true)
+	verified, err = VerifyJWT(ctx, signJWT(newKey, "new", claims))
+	assert.Nil(t, err)
+	assert.Equal(t, 42, verified.GetUserID())
+}
+
+func TestJWKSSlowAuthService(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	var slow atomic.Bool
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow.Load() {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []any{jwkOf("slow", &key.PublicKey)}})
+	}))
+	defer server.Close()
+
+	saved := config.Config
+	defer func() { config.Config = saved }()
+	config.Config.JWKSUrl = server.URL
+	config.Config.JWKSCacheTTL = time.Hour
+	config.Config.JWTAudience = ""
+	savedInterval := jwksRefreshInterval
+	jwksRefreshInterval = 0
+	defer func() { jwksRefreshInterval = savedInterval }()
+	jwks.Lock()
+	jwks.keys = nil
+	jwks.Unlock()
+
+	claims := map[string]any{"id": 42, "exp": time.Now().Unix() + 60}
+	ctx := context.Background()
+	_, err = VerifyJWT(ctx, signJWT(key, "slow", claims))
+	assert.Nil(t, err)
+
+	// cached keys are used at once while expired keys are refreshed
+	slow.Store(true)
+	config.Config.JWKSCacheTTL = 0
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		_, err = VerifyJWT(ctx, signJWT(key, "slow", claims))
+		assert.Nil(t, err)
+	}
+	assert.Less(t, time.Since(start), time.Second)
+
+	// unknown key ids wait for the refresh until the request is done
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, err = VerifyJWT(ctx, signJWT(key, "unknown", claims))
+	assert.Equal(t, http.StatusServiceUnavailable, err.(*Error).Code)
+
+	// wait for the refresh before config is restored
+	close(release)
+	_, _, _ = jwksRefresh.Do("jwks", func() (any, error) { return nil, nil })
+}
+
+func jwkOf(kid string, key *rsa.PublicKey) map[string]any {
+	return map[string]any{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func signJWT(key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]any{"alg": "RS256", "typ": "JWT", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signing := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signing))
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	return signing + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
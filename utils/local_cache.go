@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog/log"
+
+	"treehole_next/config"
+)
+
+// keys set or deleted by a replica are published on the channel, other replicas drop their local copies
+const localCacheChannel = "local_cache_invalidate"
+
+// localCache is an in-process LRU tier in front of Cache for near-static data read on most requests,
+// e.g. tenants, divisions and tags, nil if disabled
+var localCache *localLRU
+
+func initLocalCache() {
+	if config.Config.LocalCacheSize > 0 {
+		localCache = newLocalLRU(config.Config.LocalCacheSize)
+	}
+}
+
+type localCacheEntry struct {
+	key      string
+	data     []byte
+	expireAt time.Time
+}
+
+type localLRU struct {
+	mu    sync.Mutex
+	size  int
+	items map[string]*list.Element
+	order *list.List
+}
+
+func newLocalLRU(size int) *localLRU {
+	return &localLRU{size: size, items: make(map[string]*list.Element), order: list.New()}
+}
+
+func (l *localLRU) get(key string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	element, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*localCacheEntry)
+	if time.Now().After(entry.expireAt) {
+		l.order.Remove(element)
+		delete(l.items, key)
+		return nil, false
+	}
+	l.order.MoveToFront(element)
+	return entry.data, true
+}
+
+func (l *localLRU) set(key string, data []byte, expiration time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	expireAt := time.Now().Add(expiration)
+	if element, ok := l.items[key]; ok {
+		element.Value = &localCacheEntry{key: key, data: data, expireAt: expireAt}
+		l.order.MoveToFront(element)
+		return
+	}
+	l.items[key] = l.order.PushFront(&localCacheEntry{key: key, data: data, expireAt: expireAt})
+	for l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(*localCacheEntry).key)
+	}
+}
+
+func (l *localLRU) delete(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if element, ok := l.items[key]; ok {
+		l.order.Remove(element)
+		delete(l.items, key)
+	}
+}
+
+func (l *localLRU) purge() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.items = make(map[string]*list.Element)
+	l.order.Init()
+}
+
+// localCacheExpiration returns LOCAL_CACHE_TTL, or expiration of the shared entry if shorter
+func localCacheExpiration(expiration time.Duration) time.Duration {
+	if expiration > 0 && expiration < config.Config.LocalCacheTTL {
+		return expiration
+	}
+	return config.Config.LocalCacheTTL
+}
+
+// GetLocalCache gets the value of key from the in-process cache, or from Cache on a miss,
+// keys must be set and deleted by SetLocalCache and DeleteLocalCache only
+func GetLocalCache(key string, value any) bool {
+	if localCache == nil {
+		return GetCache(key, value)
+	}
+	data, ok := localCache.get(key)
+	if !ok {
+		var err error
+		data, err = Cache.Get(context.Background(), cacheKey(key))
+		if err != nil {
+			return false
+		}
+		localCache.set(key, data, localCacheExpiration(0))
+	}
+	return json.Unmarshal(data, value) == nil
+}
+
+// SetLocalCache sets the value in Cache and the in-process cache, copies of other replicas are invalidated
+func SetLocalCache(key string, value any, expiration time.Duration) error {
+	if localCache == nil {
+		return SetCache(key, value, expiration)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	err = SetCache(key, json.RawMessage(data), expiration)
+	if err != nil {
+		return err
+	}
+	localCache.set(key, data, localCacheExpiration(expiration))
+	publishLocalCacheInvalidation(key)
+	return nil
+}
+
+// DeleteLocalCache deletes the key from Cache and the in-process caches of all replicas
+func DeleteLocalCache(key string) error {
+	if localCache == nil {
+		return DeleteCache(key)
+	}
+	localCache.delete(key)
+	err := DeleteCache(key)
+	publishLocalCacheInvalidation(key)
+	return err
+}
+
+func publishLocalCacheInvalidation(key string) {
+	if redisClient == nil {
+		return
+	}
+	err := redisClient.Publish(context.Background(), cacheKey(localCacheChannel), key).Err()
+	if err != nil {
+		log.Err(err).Str("key", key).Msg("publish local cache invalidation failed")
+	}
+}
+
+// SubscribeLocalCache drops local copies of keys set or deleted by other replicas until ctx is done.
+// Invalidations published while disconnected are lost, the copies expire after LOCAL_CACHE_TTL
+func SubscribeLocalCache(ctx context.Context) {
+	if localCache == nil || redisClient == nil {
+		return
+	}
+	pubsub := redisClient.Subscribe(ctx, cacheKey(localCacheChannel))
+	defer func() {
+		_ = pubsub.Close()
+	}()
+	// drop copies cached before subscribing
+	localCache.purge()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			localCache.delete(message.Payload)
+		}
+	}
+}
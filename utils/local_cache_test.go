@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"treehole_next/config"
+)
+
+func TestLocalLRU(t *testing.T) {
+	lru := newLocalLRU(2)
+	lru.set("a", []byte("1"), time.Minute)
+	lru.set("b", []byte("2"), time.Minute)
+	_, ok := lru.get("a")
+	assert.True(t, ok)
+
+	// b is the least recently used
+	lru.set("c", []byte("3"), time.Minute)
+	_, ok = lru.get("b")
+	assert.False(t, ok)
+	data, ok := lru.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "1", string(data))
+
+	lru.set("d", []byte("4"), time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	_, ok = lru.get("d")
+	assert.False(t, ok)
+}
+
+func TestLocalCache(t *testing.T) {
+	saved := config.Config
+	defer func() { config.Config = saved }()
+	config.Config.RedisURL = ""
+	config.Config.RedisAddrs = nil
+	config.Config.LocalCacheSize = 10
+	config.Config.LocalCacheTTL = time.Minute
+	InitCache()
+	defer func() { localCache = nil }()
+
+	var value []int
+	assert.False(t, GetLocalCache("local_cache_test", &value))
+	assert.NoError(t, SetLocalCache("local_cache_test", []int{1, 2}, 0))
+	assert.True(t, GetLocalCache("local_cache_test", &value))
+	assert.Equal(t, []int{1, 2}, value)
+
+	// the local copy is served without reading Cache
+	assert.NoError(t, Cache.Delete(context.Background(), cacheKey("local_cache_test")))
+	assert.True(t, GetLocalCache("local_cache_test", &value))
+
+	assert.NoError(t, DeleteLocalCache("local_cache_test"))
+	assert.False(t, GetLocalCache("local_cache_test", &value))
+}
@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+
+	"treehole_next/config"
+)
+
+const (
+	HeaderRequestID = "X-Request-ID"
+	requestIDKey    = "request_id"
+	maxRequestIDLen = 128
+)
+
+type queryCounterKey struct{}
+
+// GetRequestID returns the request ID set by MiddlewareRequestID
+func GetRequestID(c *fiber.Ctx) string {
+	requestID, _ := c.Locals(requestIDKey).(string)
+	return requestID
+}
+
+// MiddlewareRequestID attaches a request ID to each request, honoring X-Request-ID
+// from upstream, and returns it in the response so that users can quote it in support tickets.
+// Use log.Ctx(c.UserContext()) to log with the request ID.
+func MiddlewareRequestID(c *fiber.Ctx) error {
+	requestID := c.Get(HeaderRequestID)
+	if !validRequestID(requestID) {
+		requestID = newRequestID()
+	}
+	c.Locals(requestIDKey, requestID)
+	c.Set(HeaderRequestID, requestID)
+
+	logger := log.With().Str("request_id", requestID).Logger()
+	ctx := logger.WithContext(c.UserContext())
+	ctx = context.WithValue(ctx, queryCounterKey{}, new(atomic.Int64))
+	c.SetUserContext(ctx)
+	return c.Next()
+}
+
+// MiddlewareTimeout sets a deadline of REQUEST_TIMEOUT on the context of each request, so that queries
+// with the context, i.e. models.RequestDB and models.ReadDB, are canceled instead of piling up on a slow database
+func MiddlewareTimeout(c *fiber.Ctx) error {
+	if config.Config.RequestTimeout <= 0 {
+		return c.Next()
+	}
+	ctx, cancel := context.WithTimeout(c.UserContext(), config.Config.RequestTimeout)
+	defer cancel()
+	c.SetUserContext(ctx)
+	return c.Next()
+}
+
+// MiddlewareRequestLogger logs method, route, user ID, status, duration and
+// DB query count of each request in JSON, replaces common.MiddlewareCustomLogger
+func MiddlewareRequestLogger(c *fiber.Ctx) error {
+	startTime := time.Now()
+	chainErr := c.Next()
+
+	if chainErr != nil {
+		if err := c.App().ErrorHandler(c, chainErr); err != nil {
+			_ = c.SendStatus(fiber.StatusInternalServerError)
+		}
+	}
+
+	output := log.Info().
+		Str("request_id", GetRequestID(c)).
+		Int("status_code", c.Response().StatusCode()).
+		Str("method", c.Method()).
+		Str("route", c.Route().Path).
+		Str("origin_url", c.OriginalURL()).
+		Str("remote_ip", c.Get("X-Real-IP")).
+		Str("user_agent", c.Get("User-Agent", "")).
+		Int64("latency", time.Since(startTime).Milliseconds()).
+		Int64("db_queries", QueryCount(c.UserContext())).
+		Str("content_type", string(c.Request().Header.ContentType()))
+
+	if xForwardFor := c.Get("X-Forwarded-For"); xForwardFor != "" {
+		output = output.Str("x_forwarded_for", xForwardFor)
+	}
+	if userID, ok := c.Locals("user_id").(int); ok {
+		output = output.Int("user_id", userID)
+	}
+	if adminID, ok := c.Locals("act_as_admin_id").(int); ok {
+		output = output.Int("act_as_admin_id", adminID)
+	}
+	if spanContext := trace.SpanContextFromContext(c.UserContext()); spanContext.IsValid() {
+		output = output.Str("trace_id", spanContext.TraceID().String())
+	}
+	if chainErr != nil {
+		output = output.Err(chainErr)
+	}
+	if c.Method() == fiber.MethodPost || c.Method() == fiber.MethodPut {
+		output = logBody(output, c.Body())
+	}
+	output.Msg("http log")
+	return nil
+}
+
+func logBody(output *zerolog.Event, rawBody []byte) *zerolog.Event {
+	var body = make(map[string]any)
+	err := json.Unmarshal(rawBody, &body)
+	if err != nil {
+		return output.Bytes("body", common.StripBytes(rawBody, 32))
+	}
+	delete(body, "password")
+	return output.Any("body", body)
+}
+
+// CountQuery increases the DB query count of the request, if ctx is a request context
+func CountQuery(ctx context.Context) {
+	if ctx == nil {
+		return
+	}
+	if counter, ok := ctx.Value(queryCounterKey{}).(*atomic.Int64); ok {
+		counter.Add(1)
+	}
+}
+
+// QueryCount returns the DB query count of the request
+func QueryCount(ctx context.Context) int64 {
+	if counter, ok := ctx.Value(queryCounterKey{}).(*atomic.Int64); ok {
+		return counter.Load()
+	}
+	return 0
+}
+
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLen {
+		return false
+	}
+	// printable ascii only, to keep logs and headers clean
+	for i := 0; i < len(requestID); i++ {
+		if requestID[i] < 0x21 || requestID[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
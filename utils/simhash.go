@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+)
+
+// Bigrams returns character bigrams of letters and digits in lower case, which work for Chinese without
+// word segmentation. Content of a single letter or digit is doubled, returns nil for content without them.
+func Bigrams(content string) []string {
+	runes := make([]rune, 0, len(content))
+	for _, r := range strings.ToLower(content) {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			runes = append(runes, r)
+		}
+	}
+	if len(runes) == 0 {
+		return nil
+	}
+	if len(runes) == 1 {
+		runes = append(runes, runes[0])
+	}
+
+	bigrams := make([]string, 0, len(runes)-1)
+	for i := 0; i+1 < len(runes); i++ {
+		bigrams = append(bigrams, string(runes[i:i+2]))
+	}
+	return bigrams
+}
+
+// SimHash returns the 64-bit SimHash of content, similar contents have hashes of small Hamming distance.
+// Features are character bigrams, see Bigrams. Returns 0 for content without letters or digits.
+func SimHash(content string) uint64 {
+	bigrams := Bigrams(content)
+	if len(bigrams) == 0 {
+		return 0
+	}
+
+	var weights [64]int
+	hash := fnv.New64a()
+	for _, bigram := range bigrams {
+		hash.Reset()
+		_, _ = hash.Write([]byte(bigram))
+		feature := hash.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if feature&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var simHash uint64
+	for bit := 0; bit < 64; bit++ {
+		if weights[bit] > 0 {
+			simHash |= 1 << bit
+		}
+	}
+	return simHash
+}
+
+// SimHashDistance returns the number of different bits of two SimHashes
+func SimHashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
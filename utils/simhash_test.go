@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimHash(t *testing.T) {
+	assert.Zero(t, SimHash(""))
+	assert.Zero(t, SimHash("。！？"))
+
+	a := SimHash("请问本部食堂今天几点关门？有人知道吗")
+	b := SimHash("请问本部食堂今天几点关门啊，有人知道吗")
+	c := SimHash("求推荐计算机系的选修课，最好给分好一点的")
+	assert.Equal(t, a, SimHash("请问本部食堂今天几点关门? 有人知道吗"))
+	assert.Less(t, SimHashDistance(a, b), SimHashDistance(a, c))
+	assert.LessOrEqual(t, SimHashDistance(a, b), 10)
+}
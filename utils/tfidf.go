@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"math"
+	"sort"
+)
+
+// labelVectorMaxTerms limits terms kept for each label, the heaviest first
+const labelVectorMaxTerms = 200
+
+// LabeledDocument is a document for NewTFIDF, e.g. the first floor of a hole labeled with ids of its tags
+type LabeledDocument struct {
+	Content string
+	Labels  []int
+}
+
+// LabelScore is the cosine similarity of a content to a label, see TFIDF.Rank
+type LabelScore struct {
+	Label int
+	Score float64
+}
+
+// TFIDF ranks labels of contents by TF-IDF over character bigrams, see Bigrams.
+// Each label is the normalized sum of vectors of its documents.
+type TFIDF struct {
+	idf    map[string]float64
+	labels map[int]map[string]float64
+}
+
+// NewTFIDF learns labels from documents, labels of less than minDocuments documents are skipped
+func NewTFIDF(documents []LabeledDocument, minDocuments int) *TFIDF {
+	model := &TFIDF{
+		idf:    make(map[string]float64),
+		labels: make(map[int]map[string]float64),
+	}
+
+	termCounts := make([]map[string]int, 0, len(documents))
+	for _, document := range documents {
+		counts := countTerms(document.Content)
+		for term := range counts {
+			model.idf[term]++
+		}
+		termCounts = append(termCounts, counts)
+	}
+	for term, documentFrequency := range model.idf {
+		model.idf[term] = math.Log(float64(1+len(documents))/(1+documentFrequency)) + 1
+	}
+
+	labelDocuments := make(map[int]int)
+	for i, document := range documents {
+		vector := model.vector(termCounts[i])
+		for _, label := range document.Labels {
+			labelVector := model.labels[label]
+			if labelVector == nil {
+				labelVector = make(map[string]float64, len(vector))
+				model.labels[label] = labelVector
+			}
+			for term, weight := range vector {
+				labelVector[term] += weight
+			}
+			labelDocuments[label]++
+		}
+	}
+	for label, vector := range model.labels {
+		if labelDocuments[label] < minDocuments {
+			delete(model.labels, label)
+			continue
+		}
+		model.labels[label] = normalize(truncate(vector, labelVectorMaxTerms))
+	}
+	return model
+}
+
+// Rank returns at most size labels similar to content by more than minScore, the most similar first
+func (model *TFIDF) Rank(content string, size int, minScore float64) []LabelScore {
+	vector := model.vector(countTerms(content))
+	scores := make([]LabelScore, 0)
+	if len(vector) == 0 {
+		return scores
+	}
+	for label, labelVector := range model.labels {
+		var score float64
+		for term, weight := range vector {
+			score += weight * labelVector[term]
+		}
+		if score > minScore {
+			scores = append(scores, LabelScore{Label: label, Score: score})
+		}
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].Label < scores[j].Label
+	})
+	return scores[:min(len(scores), size)]
+}
+
+// vector returns the normalized TF-IDF vector of counts, terms unknown to the model are skipped
+func (model *TFIDF) vector(counts map[string]int) map[string]float64 {
+	vector := make(map[string]float64, len(counts))
+	for term, count := range counts {
+		if idf, ok := model.idf[term]; ok {
+			vector[term] = float64(count) * idf
+		}
+	}
+	return normalize(vector)
+}
+
+func countTerms(content string) map[string]int {
+	counts := make(map[string]int)
+	for _, bigram := range Bigrams(content) {
+		counts[bigram]++
+	}
+	return counts
+}
+
+func normalize(vector map[string]float64) map[string]float64 {
+	var sum float64
+	for _, weight := range vector {
+		sum += weight * weight
+	}
+	if sum == 0 {
+		return vector
+	}
+	norm := math.Sqrt(sum)
+	for term := range vector {
+		vector[term] /= norm
+	}
+	return vector
+}
+
+// truncate keeps size heaviest terms of vector
+func truncate(vector map[string]float64, size int) map[string]float64 {
+	if len(vector) <= size {
+		return vector
+	}
+	terms := make([]string, 0, len(vector))
+	for term := range vector {
+		terms = append(terms, term)
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if vector[terms[i]] != vector[terms[j]] {
+			return vector[terms[i]] > vector[terms[j]]
+		}
+		return terms[i] < terms[j]
+	})
+	truncated := make(map[string]float64, size)
+	for _, term := range terms[:size] {
+		truncated[term] = vector[term]
+	}
+	return truncated
+}
@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTFIDF(t *testing.T) {
+	model := NewTFIDF([]LabeledDocument{
+		{Content: "本部食堂今天的红烧肉好吃吗", Labels: []int{1}},
+		{Content: "食堂的饭越来越贵了", Labels: []int{1, 3}},
+		{Content: "求推荐计算机系的选修课", Labels: []int{2}},
+		{Content: "选修课期末考试怎么复习", Labels: []int{2}},
+		{Content: "宿舍楼下新开了一家店", Labels: []int{4}},
+	}, 2)
+
+	scores := model.Rank("食堂几点关门", 5, 0)
+	assert.NotEmpty(t, scores)
+	assert.Equal(t, 1, scores[0].Label)
+
+	scores = model.Rank("这学期的选修课好难", 5, 0)
+	assert.NotEmpty(t, scores)
+	assert.Equal(t, 2, scores[0].Label)
+
+	// labels of less than 2 documents are skipped
+	for _, score := range model.Rank("食堂的饭越来越贵了，宿舍楼下新开了一家店", 5, 0) {
+		assert.NotContains(t, []int{3, 4}, score.Label)
+	}
+	assert.Empty(t, model.Rank("。！？", 5, 0))
+	assert.Empty(t, model.Rank("食堂", 5, 1))
+}
@@ -0,0 +1,212 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+)
+
+// logTracerProvider writes finished spans to the log in JSON,
+// so that traces can be collected by the log pipeline and joined by trace_id
+type logTracerProvider struct {
+	embedded.TracerProvider
+	sampleRatio float64
+}
+
+func newLogTracerProvider(sampleRatio float64) *logTracerProvider {
+	return &logTracerProvider{sampleRatio: sampleRatio}
+}
+
+func (p *logTracerProvider) Tracer(name string, _ ...trace.TracerOption) trace.Tracer {
+	return &logTracer{provider: p, name: name}
+}
+
+type logTracer struct {
+	embedded.Tracer
+	provider *logTracerProvider
+	name     string
+}
+
+func (t *logTracer) Start(ctx context.Context, spanName string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	spanConfig := trace.NewSpanStartConfig(opts...)
+
+	parent := trace.SpanContextFromContext(ctx)
+	if spanConfig.NewRoot() {
+		parent = trace.SpanContext{}
+	}
+
+	var traceID trace.TraceID
+	var flags trace.TraceFlags
+	if parent.IsValid() {
+		// follow the sampling decision of parent
+		traceID = parent.TraceID()
+		flags = parent.TraceFlags()
+	} else {
+		_, _ = rand.Read(traceID[:])
+		if t.sample(traceID) {
+			flags = trace.FlagsSampled
+		}
+	}
+	var spanID trace.SpanID
+	_, _ = rand.Read(spanID[:])
+
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: flags,
+		TraceState: parent.TraceState(),
+	})
+	if !spanContext.IsSampled() {
+		// non-recording span, only propagates the span context
+		ctx = trace.ContextWithSpanContext(ctx, spanContext)
+		return ctx, trace.SpanFromContext(ctx)
+	}
+
+	start := spanConfig.Timestamp()
+	if start.IsZero() {
+		start = time.Now()
+	}
+	span := &logSpan{
+		tracer:      t,
+		name:        spanName,
+		spanContext: spanContext,
+		parentID:    parent.SpanID(),
+		kind:        spanConfig.SpanKind(),
+		start:       start,
+		attributes:  spanConfig.Attributes(),
+	}
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+// sample decides by the trace id, so that all services make the same decision
+func (t *logTracer) sample(traceID trace.TraceID) bool {
+	if t.provider.sampleRatio >= 1 {
+		return true
+	}
+	if t.provider.sampleRatio <= 0 {
+		return false
+	}
+	bound := uint64(t.provider.sampleRatio * (1 << 63))
+	return binary.BigEndian.Uint64(traceID[8:16])>>1 < bound
+}
+
+type logSpan struct {
+	embedded.Span
+	tracer      *logTracer
+	spanContext trace.SpanContext
+	parentID    trace.SpanID
+	kind        trace.SpanKind
+	start       time.Time
+
+	mu          sync.Mutex
+	name        string
+	attributes  []attribute.KeyValue
+	events      []string
+	status      codes.Code
+	description string
+	ended       bool
+}
+
+func (s *logSpan) End(options ...trace.SpanEndOption) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	s.ended = true
+
+	endConfig := trace.NewSpanEndConfig(options...)
+	end := endConfig.Timestamp()
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	attributes := zerolog.Dict()
+	for _, kv := range s.attributes {
+		attributes.Interface(string(kv.Key), kv.Value.AsInterface())
+	}
+	event := log.Info().
+		Str("trace_id", s.spanContext.TraceID().String()).
+		Str("span_id", s.spanContext.SpanID().String()).
+		Str("span", s.name).
+		Str("kind", s.kind.String()).
+		Str("scope", s.tracer.name).
+		Time("start", s.start).
+		Dur("duration", end.Sub(s.start)).
+		Dict("attributes", attributes)
+	if s.parentID.IsValid() {
+		event = event.Str("parent_id", s.parentID.String())
+	}
+	if len(s.events) > 0 {
+		event = event.Strs("events", s.events)
+	}
+	if s.status != codes.Unset {
+		event = event.Str("status", s.status.String()).Str("status_description", s.description)
+	}
+	event.Msg("span")
+}
+
+func (s *logSpan) AddEvent(name string, _ ...trace.EventOption) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, name)
+}
+
+func (s *logSpan) AddLink(trace.Link) {}
+
+func (s *logSpan) IsRecording() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.ended
+}
+
+func (s *logSpan) RecordError(err error, _ ...trace.EventOption) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, "exception: "+err.Error())
+}
+
+func (s *logSpan) SpanContext() trace.SpanContext {
+	return s.spanContext
+}
+
+func (s *logSpan) SetStatus(code codes.Code, description string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Ok is final, Error overrides Unset
+	if s.status == codes.Ok || code < s.status {
+		return
+	}
+	s.status = code
+	if code == codes.Error {
+		s.description = description
+	}
+}
+
+func (s *logSpan) SetName(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+}
+
+func (s *logSpan) SetAttributes(kv ...attribute.KeyValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes = append(s.attributes, kv...)
+}
+
+func (s *logSpan) TracerProvider() trace.TracerProvider {
+	return s.tracer.provider
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestLogTracer(t *testing.T) {
+	tracer := newLogTracerProvider(1).Tracer("test")
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	assert.True(t, parent.IsRecording())
+	assert.True(t, parent.SpanContext().IsSampled())
+
+	_, child := tracer.Start(ctx, "child")
+	assert.Equal(t, parent.SpanContext().TraceID(), child.SpanContext().TraceID())
+	assert.NotEqual(t, parent.SpanContext().SpanID(), child.SpanContext().SpanID())
+	assert.Equal(t, parent.SpanContext().SpanID(), child.(*logSpan).parentID)
+	child.End()
+	assert.False(t, child.IsRecording())
+	parent.End()
+
+	// not sampled spans still propagate the span context
+	tracer = newLogTracerProvider(0).Tracer("test")
+	ctx, span := tracer.Start(context.Background(), "dropped")
+	assert.False(t, span.IsRecording())
+	assert.True(t, span.SpanContext().IsValid())
+	_, child = tracer.Start(ctx, "child")
+	assert.False(t, child.IsRecording())
+	assert.Equal(t, span.SpanContext().TraceID(), child.SpanContext().TraceID())
+}
+
+func TestTracingTransport(t *testing.T) {
+	savedProvider, savedPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	defer func() {
+		otel.SetTracerProvider(savedProvider)
+		otel.SetTextMapPropagator(savedPropagator)
+	}()
+	otel.SetTracerProvider(newLogTracerProvider(1))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer server.Close()
+
+	ctx, span := Tracer().Start(context.Background(), "request")
+	defer span.End()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	assert.Nil(t, err)
+	client := http.Client{Transport: TracingTransport{}}
+	res, err := client.Do(req)
+	assert.Nil(t, err)
+	_ = res.Body.Close()
+
+	remote := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(
+		context.Background(), propagation.HeaderCarrier{"Traceparent": []string{traceparent}},
+	))
+	assert.Equal(t, span.SpanContext().TraceID(), remote.TraceID())
+	assert.NotEqual(t, span.SpanContext().SpanID(), remote.SpanID())
+	assert.Empty(t, req.Header.Get("traceparent"))
+}
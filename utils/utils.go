@@ -4,6 +4,7 @@ import (
 	"golang.org/x/exp/slices"
 	"strconv"
 
+	"github.com/goccy/go-json"
 	"github.com/gofiber/fiber/v2"
 	"github.com/opentreehole/go-common"
 	"golang.org/x/exp/constraints"
@@ -15,12 +16,39 @@ type CanPreprocess interface {
 	Preprocess(c *fiber.Ctx) error
 }
 
-func Serialize(c *fiber.Ctx, obj CanPreprocess) error {
+// SerializeOptions customizes the response of Serialize
+type SerializeOptions struct {
+	// comma separated fields to return, nested fields are separated by dots,
+	// e.g. "id,tags,floors.first_floor.content"; empty means all fields
+	Fields string
+}
+
+func Serialize(c *fiber.Ctx, obj CanPreprocess, options ...SerializeOptions) error {
 	err := obj.Preprocess(c)
 	if err != nil {
 		return err
 	}
-	return c.JSON(obj)
+
+	var fields fieldSet
+	for _, option := range options {
+		if option.Fields != "" {
+			fields = parseFields(option.Fields)
+		}
+	}
+	if fields == nil {
+		return c.JSON(obj)
+	}
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	data, err = fields.project(data)
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(data)
 }
 
 func RegText2IntArray(IDs [][]string) ([]int, error) {
@@ -78,6 +106,21 @@ func Difference[T comparable](a, b []T) []T {
 	return result
 }
 
+// Unique returns the elements of a without duplicates, in their first appearance order
+func Unique[T comparable](a []T) []T {
+	m := make(map[T]bool, len(a))
+	result := make([]T, 0, len(a))
+
+	for _, item := range a {
+		if !m[item] {
+			m[item] = true
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
 func StripContent(content string, contentMaxSize int) string {
 	return string([]rune(content)[:Min(len([]rune(content)), contentMaxSize)])
 }
@@ -86,6 +129,10 @@ func MiddlewareHasAnsweredQuestions(c *fiber.Ctx) error {
 	if config.Config.Mode == "test" || config.Config.Mode == "bench" {
 		return c.Next()
 	}
+	// services with an API key don't answer questions, see models.MiddlewareAPIKeyScope
+	if c.Locals("api_key") != nil {
+		return c.Next()
+	}
 	var user struct {
 		HasAnsweredQuestions bool `json:"has_answered_questions"`
 	}
@@ -94,10 +141,7 @@ func MiddlewareHasAnsweredQuestions(c *fiber.Ctx) error {
 		return err
 	}
 	if !user.HasAnsweredQuestions {
-		return &common.HttpError{
-			Code:    ErrCodeNotAnsweredQuestions,
-			Message: "请先通过注册答题",
-		}
+		return NewError(ErrCodeNotAnsweredQuestions, "请先通过注册答题")
 	}
 	return c.Next()
 }